@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/anomaly"
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/tracker"
+	"github.com/spf13/cobra"
+)
+
+func newAnomaliesCmd() *cobra.Command {
+	var (
+		configPath string
+		hours      int
+		q          models.AnomalyQuery
+	)
+
+	cmd := &cobra.Command{
+		Use:   "anomalies",
+		Short: "List API keys and teams whose usage departed from their history",
+		Long: `List the usage windows in which an API key's or team's tokens or estimated
+cost stood out from the windows before it, as recorded by the anomaly
+detection job (anomaly.enabled in the config).`,
+		Example: `  pario anomalies --hours 48
+  pario anomalies --by team --value ml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if q.Dimension != "" && !slices.Contains(anomaly.Dimensions, q.Dimension) {
+				return fmt.Errorf("invalid --by %q (use api_key or team)", q.Dimension)
+			}
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return err
+			}
+			tr, err := tracker.New(cfg.DBPath)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = tr.Close() }()
+
+			q.Since = time.Now().UTC().Add(-time.Duration(hours) * time.Hour)
+			anomalies, err := tr.Anomalies(context.Background(), q)
+			if err != nil {
+				return err
+			}
+			return printAnomalies(anomalies)
+		},
+	}
+	cmd.Flags().StringVarP(&configPath, "config", "c", "pario.yaml", "path to config file")
+	cmd.Flags().IntVar(&hours, "hours", 24, "show anomalies in windows that ended within this many hours")
+	cmd.Flags().StringVar(&q.Dimension, "by", "", "filter by dimension (api_key or team)")
+	cmd.Flags().StringVar(&q.Value, "value", "", "filter by API key or team")
+	cmd.Flags().IntVar(&q.Limit, "limit", 100, "maximum anomalies to show")
+	return cmd
+}
+
+// printAnomalies prints recorded anomalies, newest window first.
+func printAnomalies(anomalies []models.Anomaly) error {
+	if len(anomalies) == 0 {
+		fmt.Println("No anomalies found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WINDOW\tBY\tVALUE\tMETRIC\tOBSERVED\tMEDIAN\tMEAN\tZ-SCORE")
+	for _, a := range anomalies {
+		z := "-"
+		if a.ZScore != 0 {
+			z = fmt.Sprintf("%.1f", a.ZScore)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			a.WindowStart.Local().Format("2006-01-02 15:04"), a.Dimension, a.Value, a.Metric,
+			formatAnomalyAmount(a.Metric, a.Observed), formatAnomalyAmount(a.Metric, a.Median),
+			formatAnomalyAmount(a.Metric, a.Mean), z)
+	}
+	return w.Flush()
+}
+
+// formatAnomalyAmount formats a token count or dollar amount.
+func formatAnomalyAmount(metric string, v float64) string {
+	if metric == models.AnomalyMetricCost {
+		return fmt.Sprintf("$%.2f", v)
+	}
+	return fmt.Sprintf("%.0f", v)
+}
@@ -50,7 +50,7 @@ func newAuditSearchCmd() *cobra.Command {
 			opts := models.AuditQueryOpts{
 				Model:        model,
 				APIKeyPrefix: keyPrefix,
-				SessionID:    session,
+				SessionID:    expandSessionPrefix(cmd, session),
 				Limit:        limit,
 			}
 			if since != "" {
@@ -76,6 +76,7 @@ func newAuditSearchCmd() *cobra.Command {
 	cmd.Flags().StringVar(&keyPrefix, "key-prefix", "", "filter by API key prefix")
 	cmd.Flags().StringVar(&session, "session", "", "filter by session ID")
 	cmd.Flags().IntVar(&limit, "limit", 50, "max entries to return")
+	registerCompletions(cmd, map[string]string{"model": "model", "session": "session_id"})
 
 	return cmd
 }
@@ -100,19 +101,15 @@ func newAuditShowCmd() *cobra.Command {
 			}
 			defer cleanup()
 
-			entries, err := l.Query(context.Background(), models.AuditQueryOpts{
-				RequestID: requestID,
-				Limit:     1,
-			})
+			e, err := l.Get(context.Background(), requestID)
 			if err != nil {
 				return err
 			}
-			if len(entries) == 0 {
+			if e == nil {
 				fmt.Println("No entry found for that request ID.")
 				return nil
 			}
 
-			e := entries[0]
 			fmt.Printf("Request ID:    %s\n", e.RequestID)
 			fmt.Printf("Model:         %s\n", e.Model)
 			fmt.Printf("Provider:      %s\n", e.Provider)
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/backup"
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/sigv4"
+	"github.com/spf13/cobra"
+)
+
+// s3Flags holds the S3 connection flags shared by backup and restore.
+type s3Flags struct {
+	region   string
+	endpoint string
+}
+
+func (f *s3Flags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.region, "s3-region", "", "S3 region (default $AWS_REGION or us-east-1)")
+	cmd.Flags().StringVar(&f.endpoint, "s3-endpoint", "", "S3-compatible endpoint URL (default $AWS_ENDPOINT_URL_S3)")
+}
+
+func (f *s3Flags) client() (*backup.S3, error) {
+	creds, err := sigv4.FromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &backup.S3{
+		Region:      defaultStr(f.region, defaultStr(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"))),
+		Endpoint:    defaultStr(f.endpoint, os.Getenv("AWS_ENDPOINT_URL_S3")),
+		Credentials: creds,
+	}, nil
+}
+
+// backupDatabases lists the databases covered by backup and restore. The
+// cache shares the tracker's database file.
+func backupDatabases(cfg *config.Config) []backup.Database {
+	dbs := []backup.Database{{Name: "tracker", Path: cfg.DBPath}}
+	if cfg.Audit.Enabled {
+		dbs = append(dbs, backup.Database{Name: "audit", Path: cfg.Audit.DBPath})
+	}
+	return dbs
+}
+
+func newBackupCmd() *cobra.Command {
+	var (
+		configPath string
+		s3         s3Flags
+	)
+
+	cmd := &cobra.Command{
+		Use:   "backup [destination]",
+		Short: "Snapshot the tracker, cache, and audit databases into one archive",
+		Long: `Snapshot the tracker, cache, and audit databases into a single tar.gz archive.
+
+Snapshots use SQLite's online backup API, so they are consistent while the
+proxy is running. The destination is a local path or an s3://bucket/key URL;
+it defaults to pario-backup-<timestamp>.tar.gz in the current directory.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return err
+			}
+
+			dest := "pario-backup-" + time.Now().UTC().Format("20060102T150405Z") + ".tar.gz"
+			if len(args) == 1 {
+				dest = args[0]
+			}
+
+			// S3 uploads need the archive's hash and length up front, so
+			// stage it in a temp file first.
+			path := dest
+			if backup.IsS3(dest) {
+				f, err := os.CreateTemp("", "pario-backup-*.tar.gz")
+				if err != nil {
+					return err
+				}
+				path = f.Name()
+				_ = f.Close()
+				defer func() { _ = os.Remove(path) }()
+			}
+
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+			if err != nil {
+				return fmt.Errorf("create archive: %w", err)
+			}
+			ctx := context.Background()
+			m, err := backup.Create(ctx, f, backupDatabases(cfg))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				_ = os.Remove(path)
+				return err
+			}
+
+			if backup.IsS3(dest) {
+				bucket, key, err := backup.ParseS3(dest)
+				if err != nil {
+					return err
+				}
+				client, err := s3.client()
+				if err != nil {
+					return err
+				}
+				if err := client.Put(ctx, bucket, key, path); err != nil {
+					return fmt.Errorf("upload backup: %w", err)
+				}
+			}
+
+			printManifest(m)
+			fmt.Printf("\nBackup written to %s\n", dest)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configPath, "config", "c", "pario.yaml", "path to config file")
+	s3.register(cmd)
+	return cmd
+}
+
+func newRestoreCmd() *cobra.Command {
+	var (
+		configPath string
+		only       []string
+		force      bool
+		s3         s3Flags
+	)
+
+	cmd := &cobra.Command{
+		Use:   "restore <archive>",
+		Short: "Restore databases from a pario backup archive",
+		Long: `Restore the tracker, cache, and audit databases from an archive written by
+pario backup. The archive is a local path or an s3://bucket/key URL.
+
+Databases are restored to the paths in the current config. Stop the proxy
+before restoring; existing databases are only overwritten with --force.
+Restoring the tracker resets the budget usage counters in budget.counters.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return err
+			}
+
+			targets := make(map[string]string)
+			for _, d := range backupDatabases(cfg) {
+				targets[d.Name] = d.Path
+			}
+			if len(only) > 0 {
+				selected := make(map[string]string, len(only))
+				for _, name := range only {
+					p, ok := targets[name]
+					if !ok {
+						return fmt.Errorf("unknown database %q (want tracker or audit)", name)
+					}
+					selected[name] = p
+				}
+				targets = selected
+			}
+			if !force {
+				for name, p := range targets {
+					if _, err := os.Stat(p); err == nil {
+						return fmt.Errorf("%s database %s exists; pass --force to overwrite", name, p)
+					}
+				}
+			}
+
+			ctx := context.Background()
+			var r io.ReadCloser
+			if backup.IsS3(args[0]) {
+				bucket, key, err := backup.ParseS3(args[0])
+				if err != nil {
+					return err
+				}
+				client, err := s3.client()
+				if err != nil {
+					return err
+				}
+				if r, err = client.Get(ctx, bucket, key); err != nil {
+					return fmt.Errorf("download backup: %w", err)
+				}
+			} else {
+				if r, err = os.Open(filepath.Clean(args[0])); err != nil {
+					return fmt.Errorf("open archive: %w", err)
+				}
+			}
+			defer func() { _ = r.Close() }()
+
+			m, err := backup.Restore(ctx, r, targets)
+			if err != nil {
+				return err
+			}
+			if _, ok := targets["tracker"]; ok {
+				if err := resetCounters(ctx, cfg); err != nil {
+					return err
+				}
+			}
+
+			fmt.Printf("Restored backup from %s\n\n", m.CreatedAt.Format(time.RFC3339))
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "DATABASE\tRESTORED TO")
+			for _, e := range m.Databases {
+				if p, ok := targets[e.Name]; ok {
+					fmt.Fprintf(w, "%s\t%s\n", e.Name, p)
+				}
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVarP(&configPath, "config", "c", "pario.yaml", "path to config file")
+	cmd.Flags().StringSliceVar(&only, "only", nil, "restore only these databases (tracker, audit)")
+	cmd.Flags().BoolVar(&force, "force", false, "overwrite existing databases")
+	s3.register(cmd)
+	return cmd
+}
+
+func printManifest(m *backup.Manifest) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tPATH\tSIZE")
+	for _, e := range m.Databases {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", e.Name, e.Path, e.Size)
+	}
+	_ = w.Flush()
+}
@@ -3,11 +3,18 @@ package main
 import (
 	"context"
 	"fmt"
+	"math"
 	"os"
+	"os/signal"
+	"slices"
+	"syscall"
 	"text/tabwriter"
+	"time"
 
 	"github.com/pario-ai/pario/pkg/budget"
 	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/redis"
 	"github.com/pario-ai/pario/pkg/tracker"
 	"github.com/spf13/cobra"
 )
@@ -20,11 +27,18 @@ func newBudgetCmd() *cobra.Command {
 		Short: "Manage token budgets and policies",
 	}
 
-	var apiKey string
+	var (
+		apiKey   string
+		watch    bool
+		interval time.Duration
+	)
 	statusCmd := &cobra.Command{
 		Use:   "status",
-		Short: "Show budget usage vs limits",
+		Short: "Show budget usage vs limits with a burn-down of the current period",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if watch && interval <= 0 {
+				return fmt.Errorf("--interval must be positive")
+			}
 			cfg, err := config.Load(configPath)
 			if err != nil {
 				return err
@@ -40,39 +54,435 @@ func newBudgetCmd() *cobra.Command {
 			}
 			defer func() { _ = tr.Close() }()
 
-			enforcer := budget.New(cfg.Budget.Policies, tr)
+			enforcer, err := newEnforcer(context.Background(), cfg, tr)
+			if err != nil {
+				return err
+			}
 
 			key := apiKey
 			if key == "" {
 				key = "*"
 			}
+			// A key's label-scoped policies are those matching its key_labels.
+			ctx := budget.ContextWithLabels(context.Background(), cfg.Attribution.KeyLabels[apiKey])
 
-			statuses, err := enforcer.Status(context.Background(), key)
+			if !watch {
+				return printBudgetStatus(ctx, enforcer, key)
+			}
+
+			ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				// Clear the screen and move the cursor home.
+				fmt.Print("\033[H\033[2J")
+				fmt.Printf("Budget status for %s — every %s (Ctrl-C to exit)\n\n", key, interval)
+				if err := printBudgetStatus(ctx, enforcer, key); err != nil {
+					return err
+				}
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C:
+				}
+			}
+		},
+	}
+	statusCmd.Flags().StringVar(&apiKey, "api-key", "", "filter by API key")
+	statusCmd.Flags().BoolVarP(&watch, "watch", "w", false, "refresh continuously")
+	statusCmd.Flags().DurationVar(&interval, "interval", 5*time.Second, "refresh interval for --watch")
+	registerCompletions(statusCmd, map[string]string{"api-key": "api_key"})
+
+	var (
+		decisionKey string
+		action      string
+		since       string
+		limit       int
+	)
+	decisionsCmd := &cobra.Command{
+		Use:   "decisions",
+		Short: "List recorded budget blocks and soft-limit warnings",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(configPath)
 			if err != nil {
 				return err
 			}
+			q := models.BudgetDecisionQuery{
+				APIKey: decisionKey,
+				Action: models.BudgetAction(action),
+				Limit:  limit,
+				Since:  time.Now().UTC().AddDate(0, 0, -7),
+			}
+			if q.Action != "" && !slices.Contains(models.BudgetActions, q.Action) {
+				return fmt.Errorf("invalid --action %q (use block, warn, downgrade, shed, or queue_full)", action)
+			}
+			return listBudgetDecisions(cfg, q, since)
+		},
+	}
+	decisionsCmd.Flags().StringVar(&decisionKey, "api-key", "", "filter by API key")
+	decisionsCmd.Flags().StringVar(&action, "action", "", "filter by action (block, warn, downgrade, shed, or queue_full)")
+	decisionsCmd.Flags().StringVar(&since, "since", "", "start date (YYYY-MM-DD, default: 7 days ago)")
+	decisionsCmd.Flags().IntVar(&limit, "limit", 100, "maximum decisions to show")
+	registerCompletions(decisionsCmd, map[string]string{"api-key": "api_key"})
+
+	violationsCmd := &cobra.Command{
+		Use:   "violations",
+		Short: "List requests refused by budgets: blocks, shed requests, and full queues",
+		Example: `  # Who got blocked since yesterday?
+  pario budget violations --since $(date -d yesterday +%F)`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return err
+			}
+			q := models.BudgetDecisionQuery{
+				APIKey: decisionKey,
+				Denied: true,
+				Limit:  limit,
+				Since:  time.Now().UTC().AddDate(0, 0, -7),
+			}
+			return listBudgetDecisions(cfg, q, since)
+		},
+	}
+	violationsCmd.Flags().StringVar(&decisionKey, "api-key", "", "filter by API key")
+	violationsCmd.Flags().StringVar(&since, "since", "", "start date (YYYY-MM-DD, default: 7 days ago)")
+	violationsCmd.Flags().IntVar(&limit, "limit", 100, "maximum violations to show")
+	registerCompletions(violationsCmd, map[string]string{"api-key": "api_key"})
+
+	var (
+		adj       models.BudgetAdjustment
+		adjustUSD float64
+	)
+	adjustCmd := &cobra.Command{
+		Use:   "adjust",
+		Short: "Record a manual credit or debit in the budget ledger",
+		Long: `Add tokens or dollars to the usage counted against budget policies for
+the current period. Negative amounts are credits, e.g. to forgive an
+accidental burn or grant a one-off top-up; positive amounts are debits.
 
-			if len(statuses) == 0 {
-				fmt.Println("No budget policies found for this key.")
+The adjustment applies to policies with the same scope: --api-key for a
+key's policies, including wildcard ones, or --team, --project, and --env
+for the label-scoped policy with exactly those labels. --model selects
+policies with that model filter; without it, policies for all models.`,
+		Example: `  pario budget adjust --api-key sk-batch --tokens=-500000 --reason "runaway retry loop"
+  pario budget adjust --team ml --usd=-50 --reason "quarter-end top-up"`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateAdjustScope(adj); err != nil {
+				return err
+			}
+			adj.CostUSD = adjustUSD
+			if adj.Tokens == 0 && adj.CostUSD == 0 {
+				return fmt.Errorf("set --tokens or --usd")
+			}
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return err
+			}
+			tr, err := tracker.New(cfg.DBPath)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = tr.Close() }()
+			closeCounters, err := useCounters(cfg, tr)
+			if err != nil {
+				return err
+			}
+			defer closeCounters()
+
+			recorded, err := tr.RecordAdjustment(context.Background(), adj)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Recorded adjustment %d: %s\n", recorded.ID, describeAdjustment(recorded))
+			return nil
+		},
+	}
+	adjustCmd.Flags().Int64Var(&adj.Tokens, "tokens", 0, "tokens to add to usage (negative to credit)")
+	adjustCmd.Flags().Float64Var(&adjustUSD, "usd", 0, "dollars to add to spend (negative to credit)")
+
+	var reset models.BudgetAdjustment
+	resetCmd := &cobra.Command{
+		Use:   "reset",
+		Short: "Credit back everything used this period under matching policies",
+		Long: `Record ledger credits that bring the usage of each matching policy back
+to zero for the rest of the current period. The scope flags select
+policies as for adjust; usage from new requests counts again as usual.`,
+		Example: `  pario budget reset --api-key sk-batch --reason "load test against prod"`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateAdjustScope(reset); err != nil {
+				return err
+			}
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return err
+			}
+			if !cfg.Budget.Enabled {
+				fmt.Println("Budget enforcement is disabled.")
 				return nil
 			}
+			tr, err := tracker.New(cfg.DBPath)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = tr.Close() }()
+			closeCounters, err := useCounters(cfg, tr)
+			if err != nil {
+				return err
+			}
+			defer closeCounters()
+			ctx := context.Background()
+			enforcer, err := newEnforcer(ctx, cfg, tr)
+			if err != nil {
+				return err
+			}
 
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "API KEY\tMODEL\tPERIOD\tMAX TOKENS\tUSED\tREMAINING")
-			for _, s := range statuses {
-				model := s.Policy.Model
-				if model == "" {
-					model = "(all)"
+			var statuses []models.BudgetStatus
+			if reset.APIKey != "" {
+				statuses, err = enforcer.Status(ctx, reset.APIKey)
+			} else {
+				statuses, err = enforcer.LabelStatus(ctx)
+			}
+			if err != nil {
+				return err
+			}
+			n := 0
+			for _, st := range statuses {
+				if st.Policy.Labels() != reset.Labels() || st.Policy.Model != reset.Model {
+					continue
+				}
+				if st.Used == 0 && st.UsedUSD == 0 {
+					continue
+				}
+				credit := reset
+				credit.Tokens, credit.CostUSD = -st.Used, -st.UsedUSD
+				recorded, err := tr.RecordAdjustment(ctx, credit)
+				if err != nil {
+					return err
 				}
-				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\n",
-					s.Policy.APIKey, model, s.Policy.Period, s.Policy.MaxTokens, s.Used, s.Remaining)
+				fmt.Printf("Recorded adjustment %d: %s\n", recorded.ID, describeAdjustment(recorded))
+				n++
 			}
-			return w.Flush()
+			if n == 0 {
+				fmt.Println("No usage to reset for matching policies.")
+			}
+			return nil
 		},
 	}
-	statusCmd.Flags().StringVar(&apiKey, "api-key", "", "filter by API key")
+
+	for _, c := range []struct {
+		cmd *cobra.Command
+		adj *models.BudgetAdjustment
+	}{{adjustCmd, &adj}, {resetCmd, &reset}} {
+		c.cmd.Flags().StringVar(&c.adj.APIKey, "api-key", "", "API key whose policies to adjust")
+		c.cmd.Flags().StringVar(&c.adj.Team, "team", "", "team label of the policy to adjust")
+		c.cmd.Flags().StringVar(&c.adj.Project, "project", "", "project label of the policy to adjust")
+		c.cmd.Flags().StringVar(&c.adj.Env, "env", "", "env label of the policy to adjust")
+		c.cmd.Flags().StringVar(&c.adj.Model, "model", "", "model filter of the policies to adjust (default: policies for all models)")
+		c.cmd.Flags().StringVar(&c.adj.Reason, "reason", "", "why, for the ledger")
+		registerCompletions(c.cmd, map[string]string{"api-key": "api_key", "team": "team", "project": "project", "model": "model"})
+	}
 
 	cmd.PersistentFlags().StringVarP(&configPath, "config", "c", "pario.yaml", "path to config file")
-	cmd.AddCommand(statusCmd)
+	cmd.AddCommand(statusCmd, decisionsCmd, violationsCmd, adjustCmd, resetCmd)
 	return cmd
 }
+
+// validateAdjustScope checks that a ledger entry names either an API key
+// or attribution labels.
+func validateAdjustScope(a models.BudgetAdjustment) error {
+	labeled := a.Labels() != (models.CostLabel{})
+	switch {
+	case a.APIKey == "" && !labeled:
+		return fmt.Errorf("set --api-key, or --team, --project, or --env")
+	case a.APIKey != "" && labeled:
+		return fmt.Errorf("--api-key can't be combined with --team, --project, or --env")
+	case a.APIKey == "*":
+		return fmt.Errorf("--api-key must name a key; wildcard policies are adjusted per key")
+	}
+	return nil
+}
+
+// describeAdjustment summarizes a ledger entry for output.
+func describeAdjustment(a models.BudgetAdjustment) string {
+	subject := a.APIKey
+	if subject == "" {
+		subject = models.BudgetPolicy{Team: a.Team, Project: a.Project, Env: a.Env}.Subject()
+	}
+	model := a.Model
+	if model == "" {
+		model = "(all)"
+	}
+	out := fmt.Sprintf("%s/%s", subject, model)
+	if a.Tokens != 0 {
+		out += fmt.Sprintf(" %+d tokens", a.Tokens)
+	}
+	if a.CostUSD != 0 {
+		out += fmt.Sprintf(" %+.2f USD", a.CostUSD)
+	}
+	return out
+}
+
+// newEnforcer creates the budget enforcer for cfg, with the managed
+// policies stored in tr, if it keeps any, layered over the configured ones.
+func newEnforcer(ctx context.Context, cfg *config.Config, tr tracker.Tracker, opts ...budget.Option) (*budget.Enforcer, error) {
+	opts = append([]budget.Option{budget.WithLocation(cfg.KeyLocation), budget.WithPricing(cfg.Pricing())}, opts...)
+	enforcer := budget.New(cfg.Budget.Policies, tr, opts...)
+	store, ok := tr.(tracker.PolicyStore)
+	if !ok {
+		return enforcer, nil
+	}
+	managed, err := store.ManagedPolicies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load managed budget policies: %w", err)
+	}
+	enforcer.SetManaged(managed)
+	return enforcer, nil
+}
+
+// useCounters makes tr keep budget usage counters in the Redis server set
+// in budget.counters, if any. The returned function closes the connection.
+func useCounters(cfg *config.Config, tr *tracker.SQLiteTracker) (func(), error) {
+	if cfg.Budget.Counters.Redis == "" {
+		return func() {}, nil
+	}
+	opts, err := redis.ParseURL(cfg.Budget.Counters.Redis)
+	if err != nil {
+		return nil, fmt.Errorf("budget counters: %w", err)
+	}
+	client := redis.New(opts)
+	tr.UseCounters(redis.NewCounters(client), func(apiKey string, at time.Time) []tracker.CounterPeriod {
+		return budget.CounterPeriods(at, cfg.KeyLocation(apiKey))
+	})
+	return func() { _ = client.Close() }, nil
+}
+
+// resetCounters removes the budget usage counters kept in the Redis
+// server set in budget.counters, if any, so they are seeded again from
+// the database.
+func resetCounters(ctx context.Context, cfg *config.Config) error {
+	if cfg.Budget.Counters.Redis == "" {
+		return nil
+	}
+	opts, err := redis.ParseURL(cfg.Budget.Counters.Redis)
+	if err != nil {
+		return fmt.Errorf("budget counters: %w", err)
+	}
+	client := redis.New(opts)
+	defer func() { _ = client.Close() }()
+	if err := tracker.ResetCounters(ctx, redis.NewCounters(client)); err != nil {
+		return fmt.Errorf("reset budget counters: %w", err)
+	}
+	return nil
+}
+
+// listBudgetDecisions prints the decisions matching q, starting from the
+// date since in the default team's time zone when it is set.
+func listBudgetDecisions(cfg *config.Config, q models.BudgetDecisionQuery, since string) error {
+	if since != "" {
+		t, err := time.ParseInLocation("2006-01-02", since, cfg.TeamLocation(""))
+		if err != nil {
+			return fmt.Errorf("invalid --since date (use YYYY-MM-DD): %w", err)
+		}
+		q.Since = t.UTC()
+	}
+
+	tr, err := tracker.New(cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tr.Close() }()
+
+	decisions, err := tr.Decisions(context.Background(), q)
+	if err != nil {
+		return err
+	}
+	return printBudgetDecisions(decisions)
+}
+
+// printBudgetDecisions prints recorded budget decisions, newest first.
+func printBudgetDecisions(decisions []models.BudgetDecision) error {
+	if len(decisions) == 0 {
+		fmt.Println("No budget decisions found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTION\tAPI KEY\tMODEL\tPOLICY\tUSED\tREQUEST ID")
+	for _, d := range decisions {
+		model := d.Policy.Model
+		if model == "" {
+			model = "(all)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s/%s %s/%s\t%s (%.0f%%)\t%s\n",
+			d.CreatedAt.Local().Format("2006-01-02 15:04:05"), d.Action, d.APIKey, d.Model,
+			d.Policy.Subject(), model, d.Policy.FormatLimit(), d.Policy.Period,
+			d.Policy.FormatAmount(d.Used, d.UsedUSD), d.Policy.Fraction(d.Used, d.UsedUSD)*100, defaultStr(d.RequestID, "-"))
+	}
+	return w.Flush()
+}
+
+// printBudgetStatus prints one budget status table, including every
+// label-scoped policy when key is "*". The burn-down bar fills with the
+// share of the budget used; the "|" marks how much of the period has
+// elapsed, so a fill past the marker is ahead of pace.
+func printBudgetStatus(ctx context.Context, enforcer *budget.Enforcer, key string) error {
+	statuses, err := enforcer.Status(ctx, key)
+	if err != nil {
+		return err
+	}
+	if key == "*" {
+		labeled, err := enforcer.LabelStatus(ctx)
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, labeled...)
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("No budget policies found for this key.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "API KEY\tMODEL\tPERIOD\tLIMIT\tUSED\tREMAINING\tBURN-DOWN\tUSED/ELAPSED\tEXHAUSTS")
+	for _, s := range statuses {
+		model := s.Policy.Model
+		if model == "" {
+			model = "(all)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%.0f%% / %.0f%%\t%s\n",
+			s.Policy.Subject(), model, s.Policy.Period, s.Policy.FormatLimit(),
+			s.Policy.FormatAmount(s.Used, s.UsedUSD), s.Policy.FormatAmount(s.Remaining, s.RemainingUSD),
+			burndownBar(s.UsedFraction(), s.Elapsed, 20), s.UsedFraction()*100, s.Elapsed*100, exhaustion(s))
+	}
+	return w.Flush()
+}
+
+// burndownBar renders used as a filled bar of the given width with a "|"
+// at the elapsed position.
+func burndownBar(used, elapsed float64, width int) string {
+	filled := int(math.Round(min(used, 1) * float64(width)))
+	marker := min(int(math.Round(elapsed*float64(width))), width-1)
+	bar := make([]rune, width)
+	for i := range bar {
+		bar[i] = '░'
+		if i < filled {
+			bar[i] = '█'
+		}
+	}
+	bar[marker] = '|'
+	return "[" + string(bar) + "]"
+}
+
+// exhaustion describes when a budget runs out at its current pace.
+func exhaustion(s models.BudgetStatus) string {
+	switch {
+	case s.Exhausted():
+		return "exhausted"
+	case s.ExhaustsAt.IsZero():
+		return "on pace"
+	default:
+		return s.ExhaustsAt.Local().Format("Jan 02 15:04") + " (in " + time.Until(s.ExhaustsAt).Round(time.Minute).String() + ")"
+	}
+}
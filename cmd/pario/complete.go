@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/tracker"
+	"github.com/spf13/cobra"
+)
+
+// completionLimit caps the number of values offered for one completion.
+const completionLimit = 50
+
+// completeColumn returns a flag completion function offering the distinct
+// values of a usage_records column from the tracker database named by the
+// command's --config flag.
+func completeColumn(column string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		values, err := lookupColumn(cmd, column, toComplete, completionLimit)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return values, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// lookupColumn queries distinct values of a usage_records column with the
+// given prefix, using the config named by the command's --config flag.
+func lookupColumn(cmd *cobra.Command, column, prefix string, limit int) ([]string, error) {
+	cfg := config.Default()
+	if f := cmd.Flag("config"); f != nil && f.Value.String() != "" {
+		if loaded, err := config.Load(f.Value.String()); err == nil {
+			cfg = loaded
+		}
+	}
+
+	tr, err := tracker.New(cfg.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tr.Close() }()
+
+	return tr.Distinct(context.Background(), column, prefix, limit)
+}
+
+// registerCompletions attaches database-backed completion to flags that
+// name models, API keys, sessions, teams, or projects.
+func registerCompletions(cmd *cobra.Command, flagColumns map[string]string) {
+	for flag, column := range flagColumns {
+		_ = cmd.RegisterFlagCompletionFunc(flag, completeColumn(column))
+	}
+}
+
+// expandSessionPrefix resolves a unique session ID prefix to the full ID.
+// Ambiguous or unknown prefixes are returned unchanged.
+func expandSessionPrefix(cmd *cobra.Command, prefix string) string {
+	if prefix == "" || strings.HasPrefix(prefix, "-") {
+		return prefix
+	}
+	matches, err := lookupColumn(cmd, "session_id", prefix, 2)
+	if err != nil || len(matches) != 1 {
+		return prefix
+	}
+	return matches[0]
+}
@@ -18,6 +18,9 @@ func newCostCmd() *cobra.Command {
 		team       string
 		project    string
 		since      string
+		labels     map[string]string
+		metadata   map[string]string
+		byLabel    string
 	)
 
 	cmd := &cobra.Command{
@@ -39,22 +42,38 @@ func newCostCmd() *cobra.Command {
 			}
 			defer func() { _ = tr.Close() }()
 
-			sinceTime := beginningOfMonth()
+			loc := cfg.TeamLocation(team)
+			sinceTime := beginningOfMonth(loc)
 			if since != "" {
-				t, err := time.Parse("2006-01-02", since)
+				t, err := time.ParseInLocation("2006-01-02", since, loc)
 				if err != nil {
 					return fmt.Errorf("invalid --since date (use YYYY-MM-DD): %w", err)
 				}
 				sinceTime = t
 			}
 
-			reports, err := tr.CostReport(context.Background(), sinceTime, team, project)
+			pricingMap := buildPricingMap(cfg.Pricing())
+
+			if byLabel != "" || len(labels) > 0 || len(metadata) > 0 {
+				reports, err := tr.LabelReport(context.Background(), models.LabelQuery{
+					Since:   sinceTime.UTC(),
+					GroupBy: byLabel,
+					Filters: models.MetadataFilters(labels, metadata),
+				})
+				if err != nil {
+					return err
+				}
+				markLabelLocal(reports, pricingMap)
+				fmt.Print(formatLabelCostTable(reports, byLabel))
+				return nil
+			}
+
+			reports, err := tr.CostReport(context.Background(), sinceTime.UTC(), team, project)
 			if err != nil {
 				return err
 			}
 
-			pricingMap := buildPricingMap(cfg.Attribution.Pricing)
-			applyCosts(reports, pricingMap)
+			markLocal(reports, pricingMap)
 
 			fmt.Print(formatCostTable(reports))
 			return nil
@@ -65,13 +84,19 @@ func newCostCmd() *cobra.Command {
 	cmd.Flags().StringVar(&team, "team", "", "filter by team")
 	cmd.Flags().StringVar(&project, "project", "", "filter by project")
 	cmd.Flags().StringVar(&since, "since", "", "start date (YYYY-MM-DD, default: start of month)")
+	cmd.Flags().StringToStringVar(&labels, "label", nil, "filter by X-Pario-Labels values (k=v, repeatable)")
+	cmd.Flags().StringToStringVar(&metadata, "metadata", nil, "filter by usage metadata values (k=v, repeatable)")
+	cmd.Flags().StringVar(&byLabel, "by-label", "", "group costs by the values of this label (metadata.<name> for metadata)")
+	registerCompletions(cmd, map[string]string{"team": "team", "project": "project"})
 
 	return cmd
 }
 
-func beginningOfMonth() time.Time {
-	now := time.Now().UTC()
-	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+// beginningOfMonth returns local midnight on the first day of the current
+// month in loc.
+func beginningOfMonth(loc *time.Location) time.Time {
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
 }
 
 func buildPricingMap(pricing []models.ModelPricing) map[string]models.ModelPricing {
@@ -82,13 +107,44 @@ func buildPricingMap(pricing []models.ModelPricing) map[string]models.ModelPrici
 	return m
 }
 
-func applyCosts(reports []models.CostReport, pricing map[string]models.ModelPricing) {
+// markLocal flags the rows of models served by a local engine. Costs are
+// stored when usage is recorded, so pricing changes don't alter them.
+func markLocal(reports []models.CostReport, pricing map[string]models.ModelPricing) {
 	for i := range reports {
-		if p, ok := pricing[reports[i].Model]; ok {
-			reports[i].EstimatedCost = (float64(reports[i].PromptTokens)/1000)*p.PromptCost +
-				(float64(reports[i].CompletionTokens)/1000)*p.CompletionCost
+		reports[i].Local = pricing[reports[i].Model].Local
+	}
+}
+
+// markLabelLocal is markLocal for label report rows.
+func markLabelLocal(reports []models.LabelReport, pricing map[string]models.ModelPricing) {
+	for i := range reports {
+		reports[i].Local = pricing[reports[i].Model].Local
+	}
+}
+
+func formatLabelCostTable(reports []models.LabelReport, label string) string {
+	if len(reports) == 0 {
+		return "No cost data found.\n"
+	}
+	header := strings.ToUpper(defaultStr(label, "label"))
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-25s %-25s %8s %12s %10s\n",
+		header, "MODEL", "REQUESTS", "TOKENS", "EST. COST")
+	b.WriteString(strings.Repeat("-", 84) + "\n")
+
+	var totalCost float64
+	for _, r := range reports {
+		value := defaultStr(r.Value, "(none)")
+		if label == "" {
+			value = "(all)"
 		}
+		fmt.Fprintf(&b, "%-25s %-25s %8d %12d %10s\n",
+			value, r.Model, r.RequestCount, r.TotalTokens, costCell(r.EstimatedCost, r.Local))
+		totalCost += r.EstimatedCost
 	}
+	b.WriteString(strings.Repeat("-", 84) + "\n")
+	fmt.Fprintf(&b, "%72s $%9.4f\n", "TOTAL:", totalCost)
+	return b.String()
 }
 
 func formatCostTable(reports []models.CostReport) string {
@@ -96,23 +152,33 @@ func formatCostTable(reports []models.CostReport) string {
 		return "No cost data found.\n"
 	}
 	var b strings.Builder
-	fmt.Fprintf(&b, "%-15s %-15s %-25s %8s %12s %10s\n",
-		"TEAM", "PROJECT", "MODEL", "REQUESTS", "TOKENS", "EST. COST")
-	b.WriteString(strings.Repeat("-", 89) + "\n")
+	fmt.Fprintf(&b, "%-15s %-15s %-25s %-12s %-20s %8s %12s %10s\n",
+		"TEAM", "PROJECT", "MODEL", "PROVIDER", "ROUTE", "REQUESTS", "TOKENS", "EST. COST")
+	b.WriteString(strings.Repeat("-", 123) + "\n")
 
 	var totalCost float64
 	for _, r := range reports {
-		fmt.Fprintf(&b, "%-15s %-15s %-25s %8d %12d $%9.4f\n",
+		fmt.Fprintf(&b, "%-15s %-15s %-25s %-12s %-20s %8d %12d %10s\n",
 			defaultStr(r.Team, "(none)"),
 			defaultStr(r.Project, "(none)"),
-			r.Model, r.RequestCount, r.TotalTokens, r.EstimatedCost)
+			r.Model, defaultStr(r.Provider, "-"), defaultStr(r.RouteAlias, "-"),
+			r.RequestCount, r.TotalTokens, costCell(r.EstimatedCost, r.Local))
 		totalCost += r.EstimatedCost
 	}
-	b.WriteString(strings.Repeat("-", 89) + "\n")
-	fmt.Fprintf(&b, "%77s $%9.4f\n", "TOTAL:", totalCost)
+	b.WriteString(strings.Repeat("-", 123) + "\n")
+	fmt.Fprintf(&b, "%111s $%9.4f\n", "TOTAL:", totalCost)
 	return b.String()
 }
 
+// costCell formats a cost for the EST. COST column; local models show
+// "local" instead of $0.
+func costCell(cost float64, local bool) string {
+	if local {
+		return "local"
+	}
+	return fmt.Sprintf("$%9.4f", cost)
+}
+
 func defaultStr(s, def string) string {
 	if s == "" {
 		return def
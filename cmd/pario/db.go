@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/audit"
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/dbmaint"
+	"github.com/pario-ai/pario/pkg/tracker"
+	"github.com/spf13/cobra"
+)
+
+// dbTarget is one of Pario's databases.
+type dbTarget struct {
+	name string
+	path string
+	m    dbmaint.Maintainer
+}
+
+// openDBTargets opens the tracker database, and the audit database when
+// auditing is enabled. The returned func closes them.
+func openDBTargets(configPath string) ([]dbTarget, func(), error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tr, err := tracker.New(cfg.DBPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The cache shares the tracker's database file.
+	targets := []dbTarget{{"tracker", cfg.DBPath, tr}}
+	closers := []func() error{tr.Close}
+
+	if cfg.Audit.Enabled {
+		a, err := audit.New(cfg.Audit)
+		if err != nil {
+			_ = tr.Close()
+			return nil, nil, fmt.Errorf("open audit db: %w", err)
+		}
+		targets = append(targets, dbTarget{"audit", cfg.Audit.DBPath, a})
+		closers = append(closers, a.Close)
+	}
+	return targets, func() {
+		for _, c := range closers {
+			_ = c()
+		}
+	}, nil
+}
+
+func newDBCmd() *cobra.Command {
+	var configPath string
+
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Maintain Pario's SQLite databases",
+	}
+
+	// runOp runs op on each database and prints a row per database, plus
+	// the index statistics if indexes is set.
+	runOp := func(op string, indexes bool, run func(dbmaint.Maintainer, context.Context) (dbmaint.Report, error)) error {
+		targets, closeAll, err := openDBTargets(configPath)
+		if err != nil {
+			return err
+		}
+		defer closeAll()
+
+		ctx := context.Background()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "DATABASE\tPATH\tSIZE BEFORE\tSIZE AFTER\tRECLAIMED\tDURATION")
+		var reports []dbmaint.Report
+		for _, t := range targets {
+			rep, err := run(t.m, ctx)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", op, t.name, err)
+			}
+			reports = append(reports, rep)
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n",
+				t.name, t.path, rep.SizeBefore, rep.SizeAfter, rep.Reclaimed(), rep.Duration.Round(time.Millisecond))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if indexes {
+			fmt.Println()
+			w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "DATABASE\tTABLE\tINDEX\tSTAT")
+			for i, rep := range reports {
+				for _, s := range rep.Indexes {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", targets[i].name, s.Table, defaultStr(s.Index, "(table)"), s.Stat)
+				}
+			}
+			return w.Flush()
+		}
+		return nil
+	}
+
+	var showIndexes bool
+	maintainCmd := &cobra.Command{
+		Use:   "maintain",
+		Short: "Checkpoint, analyze, and vacuum the tracker and audit databases",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runOp("maintain", showIndexes, dbmaint.Maintainer.Maintain)
+		},
+	}
+	maintainCmd.Flags().BoolVar(&showIndexes, "indexes", false, "print index statistics gathered by ANALYZE")
+
+	vacuumCmd := &cobra.Command{
+		Use:   "vacuum",
+		Short: "Checkpoint and vacuum the tracker and audit databases, returning free space to the filesystem",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runOp("vacuum", false, dbmaint.Maintainer.Vacuum)
+		},
+	}
+
+	analyzeCmd := &cobra.Command{
+		Use:   "analyze",
+		Short: "Refresh query planner statistics for the tracker and audit databases",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runOp("analyze", true, dbmaint.Maintainer.Analyze)
+		},
+	}
+
+	var jsonOut bool
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show the size of each database, table, and index",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			targets, closeAll, err := openDBTargets(configPath)
+			if err != nil {
+				return err
+			}
+			defer closeAll()
+
+			ctx := context.Background()
+			stats := make(map[string]dbmaint.Stats, len(targets))
+			for _, t := range targets {
+				s, err := t.m.DBStats(ctx)
+				if err != nil {
+					return fmt.Errorf("stats %s: %w", t.name, err)
+				}
+				stats[t.name] = s
+			}
+			if jsonOut {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(stats)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "DATABASE\tPATH\tSIZE\tFREE\tWAL")
+			for _, t := range targets {
+				s := stats[t.name]
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\n", t.name, t.path, s.Size, s.Free(), s.WALSize)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			fmt.Println()
+			w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "DATABASE\tTABLE\tINDEX\tROWS\tBYTES\tSTAT")
+			for _, t := range targets {
+				for _, tbl := range stats[t.name].Tables {
+					fmt.Fprintf(w, "%s\t%s\t\t%d\t%d\t\n", t.name, tbl.Name, tbl.Rows, tbl.Bytes)
+					for _, idx := range tbl.Indexes {
+						fmt.Fprintf(w, "%s\t%s\t%s\t\t%d\t%s\n", t.name, tbl.Name, idx.Name, idx.Bytes, defaultStr(idx.Stat, "(not analyzed)"))
+					}
+				}
+			}
+			return w.Flush()
+		},
+	}
+	statsCmd.Flags().BoolVar(&jsonOut, "json", false, "print the statistics as JSON")
+
+	cmd.PersistentFlags().StringVarP(&configPath, "config", "c", "pario.yaml", "path to config file")
+	cmd.AddCommand(maintainCmd, vacuumCmd, analyzeCmd, statsCmd)
+	return cmd
+}
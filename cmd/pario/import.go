@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/importer"
+	"github.com/pario-ai/pario/pkg/tracker"
+	"github.com/spf13/cobra"
+)
+
+func newImportCmd() *cobra.Command {
+	var configPath string
+
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Backfill historical usage from provider usage APIs",
+	}
+
+	cmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "path to pario config file")
+	cmd.AddCommand(
+		newImportSourceCmd(&configPath, "openai-usage", "OPENAI_ADMIN_KEY", func(key, baseURL string) importer.Source {
+			return &importer.OpenAI{AdminKey: key, BaseURL: baseURL}
+		}),
+		newImportSourceCmd(&configPath, "anthropic-usage", "ANTHROPIC_ADMIN_KEY", func(key, baseURL string) importer.Source {
+			return &importer.Anthropic{AdminKey: key, BaseURL: baseURL}
+		}),
+	)
+	return cmd
+}
+
+// newImportSourceCmd builds an import subcommand for one provider source.
+func newImportSourceCmd(configPath *string, use, keyEnv string, newSource func(key, baseURL string) importer.Source) *cobra.Command {
+	var (
+		since    string
+		until    string
+		adminKey string
+		baseURL  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: fmt.Sprintf("Import daily usage from the provider's organization usage API (admin key from $%s)", keyEnv),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.Default()
+			if *configPath != "" {
+				var err error
+				cfg, err = config.Load(*configPath)
+				if err != nil {
+					return err
+				}
+			}
+
+			if adminKey == "" {
+				adminKey = os.Getenv(keyEnv)
+			}
+			if adminKey == "" {
+				return fmt.Errorf("admin API key required (--admin-key or $%s)", keyEnv)
+			}
+
+			// Provider usage buckets are aligned to UTC days.
+			sinceTime, err := time.Parse("2006-01-02", since)
+			if err != nil {
+				return fmt.Errorf("invalid --since date (use YYYY-MM-DD): %w", err)
+			}
+			untilTime := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+			if until != "" {
+				untilTime, err = time.Parse("2006-01-02", until)
+				if err != nil {
+					return fmt.Errorf("invalid --until date (use YYYY-MM-DD): %w", err)
+				}
+			}
+			if !untilTime.After(sinceTime) {
+				return fmt.Errorf("--until must be after --since")
+			}
+
+			tr, err := tracker.New(cfg.DBPath)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = tr.Close() }()
+			// Re-imported usage invalidates the budget counters it touches.
+			closeCounters, err := useCounters(cfg, tr)
+			if err != nil {
+				return err
+			}
+			defer closeCounters()
+
+			ctx := context.Background()
+			src := newSource(adminKey, baseURL)
+			recs, err := src.Fetch(ctx, sinceTime, untilTime)
+			if err != nil {
+				return err
+			}
+			// Imported usage is priced at the pricing configured now.
+			pricing := buildPricingMap(cfg.Pricing())
+			for i := range recs {
+				recs[i].EstimatedCostUSD = recs[i].Cost(pricing)
+			}
+			if err := tr.ReplaceImported(ctx, src.Provider(), sinceTime, untilTime, recs); err != nil {
+				return err
+			}
+
+			var tokens int64
+			for _, r := range recs {
+				tokens += int64(r.TotalTokens)
+			}
+			fmt.Printf("Imported %d %s usage records (%d tokens) for %s to %s\n",
+				len(recs), src.Provider(), tokens, sinceTime.Format("2006-01-02"), untilTime.Format("2006-01-02"))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&since, "since", "", "start date, inclusive (YYYY-MM-DD, UTC)")
+	cmd.Flags().StringVar(&until, "until", "", "end date, exclusive (YYYY-MM-DD, UTC, default: tomorrow)")
+	cmd.Flags().StringVar(&adminKey, "admin-key", "", "provider admin API key")
+	cmd.Flags().StringVar(&baseURL, "base-url", "", "override the provider API base URL")
+	_ = cmd.MarkFlagRequired("since")
+	return cmd
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// replBlocked lists commands that don't make sense inside the REPL.
+var replBlocked = map[string]bool{
+	"proxy":       true,
+	"serve":       true,
+	"mcp":         true,
+	"interactive": true,
+}
+
+func newInteractiveCmd() *cobra.Command {
+	var configPath string
+
+	cmd := &cobra.Command{
+		Use:     "interactive",
+		Aliases: []string{"repl"},
+		Short:   "Explore usage in an interactive shell",
+		Long: "Starts a prompt that runs pario subcommands without the leading \"pario\", e.g. \"stats --sessions\".\n" +
+			"The --config given here applies to every command. Session IDs may be abbreviated to any unique prefix.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runREPL(os.Stdin, cmd.OutOrStdout(), configPath)
+		},
+	}
+
+	cmd.Flags().StringVarP(&configPath, "config", "c", "", "path to pario config file, applied to every command")
+	return cmd
+}
+
+// runREPL reads commands from in until EOF or "exit", running each against a
+// fresh command tree so flags never leak between lines.
+func runREPL(in io.Reader, out io.Writer, configPath string) error {
+	fmt.Fprintln(out, `pario interactive — type "help" for commands, "exit" to quit`)
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "pario> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+
+		args, err := splitArgs(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(out, "error: %v\n", err)
+			continue
+		}
+		if len(args) > 0 && args[0] == "pario" {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "exit", "quit":
+			return nil
+		}
+		if replBlocked[args[0]] {
+			fmt.Fprintf(out, "%q is not available in interactive mode\n", args[0])
+			continue
+		}
+
+		root := newRootCmd()
+		root.SetArgs(withConfig(root, args, configPath))
+		root.SetOut(out)
+		root.SetErr(out)
+		root.SilenceUsage = true
+		root.SilenceErrors = true
+		if err := root.Execute(); err != nil {
+			fmt.Fprintf(out, "error: %v\n", err)
+		}
+	}
+}
+
+// withConfig appends --config to args when the target command accepts it and
+// the line didn't set one.
+func withConfig(root *cobra.Command, args []string, configPath string) []string {
+	if configPath == "" {
+		return args
+	}
+	for _, a := range args {
+		if a == "-c" || a == "--config" || strings.HasPrefix(a, "--config=") {
+			return args
+		}
+	}
+	cmd, _, err := root.Find(args)
+	if err != nil || cmd.Flag("config") == nil {
+		return args
+	}
+	return append(append([]string{}, args...), "--config", configPath)
+}
+
+// splitArgs splits a command line into arguments, honoring single quotes,
+// double quotes, and backslash escapes.
+func splitArgs(line string) ([]string, error) {
+	var (
+		args    []string
+		cur     strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
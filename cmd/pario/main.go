@@ -10,6 +10,15 @@ import (
 var version = "dev"
 
 func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// newRootCmd builds the full command tree. Flag values live in closures, so
+// the interactive mode builds a fresh tree for every line.
+func newRootCmd() *cobra.Command {
 	root := &cobra.Command{
 		Use:     "pario",
 		Short:   "Pario — Kubernetes-native token cost control plane",
@@ -18,17 +27,23 @@ func main() {
 
 	root.AddCommand(
 		newProxyCmd(),
+		newServeCmd(),
 		newStatsCmd(),
 		newTopCmd(),
+		newTailCmd(),
 		newMCPCmd(),
 		newCacheCmd(),
 		newBudgetCmd(),
 		newCostCmd(),
+		newAnomaliesCmd(),
+		newRouteCmd(),
 		newAuditCmd(),
+		newDBCmd(),
+		newBackupCmd(),
+		newRestoreCmd(),
+		newPruneCmd(),
+		newImportCmd(),
+		newInteractiveCmd(),
 	)
-
-	if err := root.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
-	}
+	return root
 }
@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/pario-ai/pario/pkg/audit"
 	"github.com/pario-ai/pario/pkg/budget"
@@ -15,12 +18,16 @@ import (
 )
 
 func newMCPCmd() *cobra.Command {
-	var configPath string
+	var (
+		configPath string
+		listen     string
+	)
 
 	cmd := &cobra.Command{
 		Use:   "mcp",
-		Short: "Start Pario as an MCP server (stdio JSON-RPC)",
-		Long:  "Runs Pario as a Model Context Protocol server over stdin/stdout for use with Claude Code and other MCP clients.",
+		Short: "Start Pario as an MCP server (stdio or HTTP JSON-RPC)",
+		Long: "Runs Pario as a Model Context Protocol server over stdin/stdout for use with Claude Code and other MCP clients.\n" +
+			"With --http (or mcp.listen in config) it serves JSON-RPC over HTTP at /mcp instead, authenticated by the bearer tokens in mcp.tokens.",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg := config.Default()
 			if configPath != "" {
@@ -49,7 +56,9 @@ func newMCPCmd() *cobra.Command {
 
 			var enforcer *budget.Enforcer
 			if cfg.Budget.Enabled {
-				enforcer = budget.New(cfg.Budget.Policies, tr)
+				if enforcer, err = newEnforcer(context.Background(), cfg, tr); err != nil {
+					return err
+				}
 			}
 
 			var auditor *audit.Logger
@@ -61,16 +70,34 @@ func newMCPCmd() *cobra.Command {
 				defer func() { _ = auditor.Close() }()
 			}
 
-			srv := mcp.New(tr, cache, enforcer, auditor, cfg.Attribution.Pricing, version)
+			srv := mcp.New(tr, cache, enforcer, auditor, cfg.Pricing(), version, mcp.WithLocation(cfg.TeamLocation), mcp.WithKeyLocation(cfg.KeyLocation))
 
 			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 			defer stop()
 
+			if listen == "" {
+				listen = cfg.MCP.Listen
+			}
+			if listen != "" {
+				return serveMCPHTTP(ctx, srv, listen, cfg.MCP.Tokens, cfg.Shutdown.DrainTimeout)
+			}
 			return srv.Run(ctx, os.Stdin, os.Stdout)
 		},
 	}
 
 	cmd.Flags().StringVarP(&configPath, "config", "c", "", "path to pario config file")
+	cmd.Flags().StringVar(&listen, "http", "", "serve the HTTP transport on this address instead of stdio (overrides mcp.listen)")
 
 	return cmd
 }
+
+// serveMCPHTTP serves the MCP HTTP transport until ctx is cancelled.
+func serveMCPHTTP(ctx context.Context, srv *mcp.Server, addr string, tokens []config.MCPToken, drainTimeout time.Duration) error {
+	if len(tokens) == 0 {
+		return fmt.Errorf("mcp HTTP transport requires at least one entry in mcp.tokens")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", srv.HTTPHandler(tokens))
+	return serveHTTP(ctx, "mcp", addr, mux, nil, nil, drainTimeout)
+}
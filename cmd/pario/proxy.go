@@ -1,23 +1,18 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"log"
-	"os/signal"
-	"syscall"
 
-	"github.com/pario-ai/pario/pkg/audit"
-	"github.com/pario-ai/pario/pkg/budget"
-	cachepkg "github.com/pario-ai/pario/pkg/cache/sqlite"
 	"github.com/pario-ai/pario/pkg/config"
-	"github.com/pario-ai/pario/pkg/proxy"
-	"github.com/pario-ai/pario/pkg/tracker"
 	"github.com/spf13/cobra"
 )
 
 func newProxyCmd() *cobra.Command {
-	var configPath string
+	var (
+		configPath string
+		noPersist  bool
+	)
 
 	cmd := &cobra.Command{
 		Use:   "proxy",
@@ -28,46 +23,12 @@ func newProxyCmd() *cobra.Command {
 				return fmt.Errorf("load config: %w", err)
 			}
 
-			tr, err := tracker.New(cfg.DBPath)
-			if err != nil {
-				return fmt.Errorf("init tracker: %w", err)
-			}
-			defer func() { _ = tr.Close() }()
-
-			var cache *cachepkg.Cache
-			if cfg.Cache.Enabled {
-				cache, err = cachepkg.New(cfg.DBPath, cfg.Cache.TTL)
-				if err != nil {
-					return fmt.Errorf("init cache: %w", err)
-				}
-				defer func() { _ = cache.Close() }()
-			}
-
-			var enforcer *budget.Enforcer
-			if cfg.Budget.Enabled {
-				enforcer = budget.New(cfg.Budget.Policies, tr)
-			}
-
-			var auditor *audit.Logger
-			if cfg.Audit.Enabled {
-				auditor, err = audit.New(cfg.Audit)
-				if err != nil {
-					return fmt.Errorf("init audit logger: %w", err)
-				}
-				defer func() { _ = auditor.Close() }()
-				log.Printf("audit logging enabled: %s", cfg.Audit.DBPath)
-			}
-
-			srv := proxy.New(cfg, tr, cache, enforcer, auditor)
-
-			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-			defer stop()
-
 			log.Printf("starting pario proxy with config: %s", configPath)
-			return srv.ListenAndServe(ctx)
+			return runServer(cfg, components{proxy: true, admin: true, noPersist: noPersist, configPath: configPath})
 		},
 	}
 
 	cmd.Flags().StringVarP(&configPath, "config", "c", "pario.yaml", "path to config file")
+	cmd.Flags().BoolVar(&noPersist, "no-persist", false, "keep usage in memory instead of db_path; it is lost on exit")
 	return cmd
 }
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/audit"
+	cachepkg "github.com/pario-ai/pario/pkg/cache/sqlite"
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/dbmaint"
+	"github.com/pario-ai/pario/pkg/tracker"
+	"github.com/spf13/cobra"
+)
+
+func newPruneCmd() *cobra.Command {
+	var (
+		configPath string
+		dryRun     bool
+		noVacuum   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Apply data retention to usage records, sessions, events, cache, and audit logs",
+		Long: `Delete data past its retention period, as set in config:
+
+  usage records  retention.usage_days (0 keeps forever), rolled up first
+  sessions       retention.session_days, by last activity (0 keeps forever),
+                 archived to session.archive_dir first when it is set
+  rollups        retention.hourly_rollup_days and daily_rollup_days
+  events         upstream failures, budget decisions, and anomalies past
+                 retention.event_days (usage_days when unset)
+  cache entries  past their TTL
+  audit entries  audit.retention_days (when audit is enabled)
+
+Afterwards each database is vacuumed so the space returns to the filesystem.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return err
+			}
+
+			tr, err := tracker.New(cfg.DBPath)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = tr.Close() }()
+			closeCounters, err := useCounters(cfg, tr)
+			if err != nil {
+				return err
+			}
+			defer closeCounters()
+
+			// The cache shares the tracker's database file.
+			cache, err := cachepkg.New(cfg.DBPath, cfg.Cache.TTL)
+			if err != nil {
+				return fmt.Errorf("open cache: %w", err)
+			}
+			defer func() { _ = cache.Close() }()
+
+			type store struct {
+				name  string
+				db    string
+				prune func(context.Context) (dbmaint.PruneResult, error)
+			}
+			now := time.Now()
+			var stores []store
+			if days := cfg.Retention.UsageDays; days > 0 {
+				stores = append(stores, store{"usage", "tracker", func(ctx context.Context) (dbmaint.PruneResult, error) {
+					return tr.PruneUsage(ctx, now.AddDate(0, 0, -days), dryRun)
+				}})
+			}
+			if days := cfg.Retention.SessionDays; days > 0 {
+				stores = append(stores, store{"sessions", "tracker", func(ctx context.Context) (dbmaint.PruneResult, error) {
+					if cfg.Session.ArchiveDir != "" && !dryRun {
+						return archiveSessions(ctx, tr, cfg.Session.ArchiveDir, now.AddDate(0, 0, -days))
+					}
+					return tr.PruneSessions(ctx, now.AddDate(0, 0, -days), dryRun)
+				}})
+			}
+			for _, r := range []struct {
+				period string
+				days   int
+			}{{tracker.RollupHourly, cfg.Retention.HourlyRollupDays}, {tracker.RollupDaily, cfg.Retention.DailyRollupDays}} {
+				if r.days > 0 {
+					stores = append(stores, store{r.period + " rollups", "tracker", func(ctx context.Context) (dbmaint.PruneResult, error) {
+						return tr.PruneRollups(ctx, r.period, now.AddDate(0, 0, -r.days), dryRun)
+					}})
+				}
+			}
+			if days := cfg.Retention.EventRetentionDays(); days > 0 {
+				stores = append(stores, store{"events", "tracker", func(ctx context.Context) (dbmaint.PruneResult, error) {
+					return tr.PruneEvents(ctx, now.AddDate(0, 0, -days), dryRun)
+				}})
+			}
+			stores = append(stores, store{"cache", "tracker", func(ctx context.Context) (dbmaint.PruneResult, error) {
+				return cache.Prune(ctx, dryRun)
+			}})
+			maintainers := map[string]dbmaint.Maintainer{"tracker": tr}
+
+			if cfg.Audit.Enabled {
+				a, err := audit.New(cfg.Audit)
+				if err != nil {
+					return fmt.Errorf("open audit db: %w", err)
+				}
+				defer func() { _ = a.Close() }()
+				stores = append(stores, store{"audit", "audit", func(ctx context.Context) (dbmaint.PruneResult, error) {
+					return a.Prune(ctx, a.RetentionCutoff(), dryRun)
+				}})
+				maintainers["audit"] = a
+			}
+
+			ctx := context.Background()
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "STORE\tDATABASE\tROWS\tBYTES")
+			pruned := make(map[string]bool)
+			for _, s := range stores {
+				res, err := s.prune(ctx)
+				if err != nil {
+					return fmt.Errorf("prune %s: %w", s.name, err)
+				}
+				if res.Rows > 0 {
+					pruned[s.db] = true
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", s.name, s.db, res.Rows, res.Bytes)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			if dryRun {
+				fmt.Println("\nDry run: nothing was deleted.")
+				return nil
+			}
+			if noVacuum {
+				return nil
+			}
+
+			first := true
+			for _, name := range []string{"tracker", "audit"} {
+				m, ok := maintainers[name]
+				if !ok || !pruned[name] {
+					continue
+				}
+				rep, err := m.Maintain(ctx)
+				if err != nil {
+					return fmt.Errorf("vacuum %s: %w", name, err)
+				}
+				if first {
+					fmt.Println()
+					first = false
+				}
+				fmt.Printf("Vacuumed %s: reclaimed %d bytes in %s\n", name, rep.Reclaimed(), rep.Duration.Round(time.Millisecond))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configPath, "config", "c", "pario.yaml", "path to config file")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "report what would be deleted without deleting it")
+	cmd.Flags().BoolVar(&noVacuum, "no-vacuum", false, "skip the VACUUM that returns freed space to the filesystem")
+	return cmd
+}
+
+// archiveSessions moves sessions last active before the cutoff into a new
+// gzip-compressed JSON lines file in dir. No file is left behind when there
+// is nothing to archive.
+func archiveSessions(ctx context.Context, tr *tracker.SQLiteTracker, dir string, before time.Time) (dbmaint.PruneResult, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return dbmaint.PruneResult{}, fmt.Errorf("create session archive dir: %w", err)
+	}
+	path := filepath.Join(dir, "sessions-"+time.Now().UTC().Format("20060102T150405Z")+".jsonl.gz")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return dbmaint.PruneResult{}, fmt.Errorf("create session archive: %w", err)
+	}
+	n, err := tr.ArchiveSessions(ctx, f, before)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		// The sessions are already deleted; keep what was written.
+		err = fmt.Errorf("close session archive %s: %w", path, cerr)
+	}
+	if n == 0 {
+		_ = os.Remove(path)
+	}
+	return dbmaint.PruneResult{Rows: n}, err
+}
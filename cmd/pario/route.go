@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pario-ai/pario/pkg/budget"
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/router"
+	"github.com/pario-ai/pario/pkg/tracker"
+	"github.com/spf13/cobra"
+)
+
+func newRouteCmd() *cobra.Command {
+	var configPath string
+
+	cmd := &cobra.Command{
+		Use:   "route",
+		Short: "Inspect model routing",
+	}
+
+	var (
+		apiKey           string
+		promptTokens     int
+		completionTokens int
+	)
+	testCmd := &cobra.Command{
+		Use:   "test <model>",
+		Short: "Show the fallback chain a model resolves to, and skipped targets",
+		Long: `Resolve a model against the config's routes without sending traffic.
+
+The chain is shown in the order the proxy would try it. Targets left out,
+such as those outside their schedule, are listed with the reason. With
+--api-key and budgets enabled, a key past a policy's downgrade_at gets its
+downgrade targets first, and a key over a policy with action downgrade
+gets only them. Latency, rate-limit, cooldown, and session state
+live in a running proxy and are not applied.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return err
+			}
+			model := args[0]
+			hints := router.Hints{PromptTokens: promptTokens, CompletionTokens: completionTokens}
+
+			if apiKey != "" && cfg.Budget.Enabled {
+				tr, err := tracker.New(cfg.DBPath)
+				if err != nil {
+					return err
+				}
+				defer func() { _ = tr.Close() }()
+				enforcer, err := newEnforcer(context.Background(), cfg, tr)
+				if err != nil {
+					return err
+				}
+				ctx := budget.ContextWithLabels(context.Background(), cfg.Attribution.KeyLabels[apiKey])
+				mode, err := enforcer.WouldDowngrade(ctx, apiKey, model)
+				if err != nil {
+					return err
+				}
+				hints.Downgrade = mode != budget.NoDowngrade
+				hints.DowngradeOnly = mode == budget.OnlyDowngrade
+			}
+
+			plan, err := router.New(cfg).Plan(model, hints)
+			printRoutePlan(os.Stdout, model, plan, hints)
+			// A model that doesn't resolve is a finding, not a usage error.
+			cmd.SilenceUsage = true
+			return err
+		},
+	}
+	testCmd.Flags().StringVar(&apiKey, "api-key", "", "client API key, for budget downgrades")
+	testCmd.Flags().IntVar(&promptTokens, "prompt-tokens", 0, "estimated prompt size, for strategy cheapest")
+	testCmd.Flags().IntVar(&completionTokens, "max-tokens", 0, "expected completion size, for strategy cheapest")
+	registerCompletions(testCmd, map[string]string{"api-key": "api_key"})
+
+	cmd.PersistentFlags().StringVarP(&configPath, "config", "c", "pario.yaml", "path to config file")
+	cmd.AddCommand(testCmd)
+	return cmd
+}
+
+// printRoutePlan writes the route a model matched, its chain, and the
+// targets left out of it.
+func printRoutePlan(out io.Writer, model string, plan router.Plan, hints router.Hints) {
+	route := plan.Route
+	switch {
+	case route.Model == "" && len(plan.Routes) > 0:
+		fmt.Fprintf(out, "%s: no route matches; sent to the first provider as-is\n", model)
+	case route.Model == "":
+		fmt.Fprintf(out, "%s: no route matches\n", model)
+	case route.IsCatchAll():
+		fmt.Fprintf(out, "%s: catch-all route %q\n", model, route.Model)
+	case route.IsPattern():
+		fmt.Fprintf(out, "%s: pattern route %q\n", model, route.Model)
+	default:
+		fmt.Fprintf(out, "%s: route %q\n", model, route.Model)
+	}
+	if route.Model != "" {
+		var opts []string
+		if route.Strategy != "" {
+			opts = append(opts, "strategy "+route.Strategy)
+		}
+		if route.Sticky {
+			opts = append(opts, "sticky")
+		}
+		switch {
+		case hints.DowngradeOnly:
+			opts = append(opts, "key over budget; downgrade targets only")
+		case hints.Downgrade:
+			opts = append(opts, "key past downgrade_at")
+		}
+		if len(opts) > 0 {
+			fmt.Fprintf(out, "  %s\n", strings.Join(opts, ", "))
+		}
+	}
+
+	if len(plan.Routes) > 0 {
+		fmt.Fprintln(out)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "#\tPROVIDER\tMODEL\tCONTEXT\tNOTES")
+		for i, rt := range plan.Routes {
+			window := "-"
+			if rt.ContextWindow > 0 {
+				window = fmt.Sprintf("%d", rt.ContextWindow)
+			}
+			var notes []string
+			if rt.Downgrade {
+				notes = append(notes, "downgrade target")
+			}
+			if rt.Retry.MaxRetries > 0 {
+				notes = append(notes, fmt.Sprintf("%d retries", rt.Retry.MaxRetries))
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i+1, rt.Provider.Name, rt.Model, window, strings.Join(notes, ", "))
+		}
+		_ = w.Flush()
+	}
+
+	if len(plan.Skipped) > 0 {
+		fmt.Fprintln(out, "\nSkipped:")
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, s := range plan.Skipped {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", s.Provider, s.Model, s.Reason)
+		}
+		_ = w.Flush()
+	}
+}
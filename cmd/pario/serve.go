@@ -0,0 +1,514 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/anomaly"
+	"github.com/pario-ai/pario/pkg/audit"
+	"github.com/pario-ai/pario/pkg/budget"
+	cachepkg "github.com/pario-ai/pario/pkg/cache/sqlite"
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/dashboard"
+	"github.com/pario-ai/pario/pkg/dbmaint"
+	"github.com/pario-ai/pario/pkg/mcp"
+	"github.com/pario-ai/pario/pkg/proxy"
+	"github.com/pario-ai/pario/pkg/tracker"
+	"github.com/spf13/cobra"
+)
+
+// components selects the listeners runServer starts.
+type components struct {
+	proxy     bool
+	mcp       bool
+	admin     bool
+	dashboard bool
+	tracker   bool
+	// required marks components the user asked for explicitly; a missing
+	// listen address for one of them is an error instead of a skip.
+	required map[string]bool
+	// noPersist keeps usage in memory instead of the db_path database.
+	noPersist bool
+	// configPath is re-read on SIGHUP, and on changes with reload.watch,
+	// to reload routes and budgets.
+	configPath string
+}
+
+func newServeCmd() *cobra.Command {
+	var (
+		configPath string
+		c          components
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run the proxy, MCP-over-HTTP, admin API, and dashboard in one process",
+		Long: `Run every network-facing component in one process with shared stores:
+
+  proxy      listen           LLM API proxy
+  mcp        mcp.listen       MCP JSON-RPC over HTTP at /mcp (needs mcp.tokens)
+  admin      admin.listen     admin API at /pario/admin/ (needs admin.token)
+  dashboard  admin.listen     web dashboard at /pario/dashboard/
+  tracker    tracking.server.listen
+                              usage store for replicas with tracking.remote
+
+Components whose address is not configured are skipped. Without admin.listen
+the admin API is served on the proxy listener and the dashboard is off. Each
+component can be turned off with --<name>=false.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+			c.required = make(map[string]bool)
+			for _, name := range []string{"proxy", "mcp", "admin", "dashboard", "tracker"} {
+				c.required[name] = cmd.Flags().Changed(name)
+			}
+			log.Printf("starting pario serve with config: %s", configPath)
+			c.configPath = configPath
+			return runServer(cfg, c)
+		},
+	}
+
+	cmd.Flags().StringVarP(&configPath, "config", "c", "pario.yaml", "path to config file")
+	cmd.Flags().BoolVar(&c.proxy, "proxy", true, "serve the LLM API proxy on listen")
+	cmd.Flags().BoolVar(&c.mcp, "mcp", true, "serve MCP over HTTP on mcp.listen")
+	cmd.Flags().BoolVar(&c.admin, "admin", true, "serve the admin API on admin.listen")
+	cmd.Flags().BoolVar(&c.dashboard, "dashboard", true, "serve the dashboard on admin.listen")
+	cmd.Flags().BoolVar(&c.tracker, "tracker", true, "serve the tracker to remote replicas on tracking.server.listen")
+	cmd.Flags().BoolVar(&c.noPersist, "no-persist", false, "keep usage in memory instead of db_path; it is lost on exit")
+	return cmd
+}
+
+// runServer opens the shared stores once and serves the selected components
+// until SIGINT/SIGTERM or until any listener fails.
+func runServer(cfg *config.Config, c components) error {
+	var (
+		tr  tracker.Tracker
+		db  *tracker.SQLiteTracker
+		err error
+	)
+	switch {
+	case cfg.Tracking.Remote.URL != "":
+		remote := tracker.NewRemote(cfg.Tracking.Remote.URL, cfg.Tracking.Remote.Token, cfg.Tracking.Remote.Timeout)
+		defer func() { _ = remote.Close() }()
+		tr = remote
+		log.Printf("usage is tracked by %s", cfg.Tracking.Remote.URL)
+	case c.noPersist:
+		tr = tracker.NewMemory()
+		log.Printf("usage is kept in memory and lost on exit")
+	default:
+		if db, err = tracker.New(cfg.DBPath); err != nil {
+			return fmt.Errorf("init tracker: %w", err)
+		}
+		defer func() { _ = db.Close() }()
+		n, err := db.PriceUnpriced(context.Background(), cfg.Pricing())
+		if err != nil {
+			return fmt.Errorf("price stored usage: %w", err)
+		}
+		if n > 0 {
+			log.Printf("priced %d usage records stored before costs were recorded", n)
+		}
+		if r := cfg.Tracking.SampleRate; r > 0 && r < 1 {
+			db.UseSampling(r)
+			log.Printf("storing %g of usage records as rows", r)
+		}
+		if a := cfg.Tracking.Async; a.Enabled {
+			db.UseAsyncWrites(a.QueueSize, a.BatchSize, a.FlushInterval)
+			log.Printf("usage writes batched every %s", a.FlushInterval)
+		}
+		closeCounters, err := useCounters(cfg, db)
+		if err != nil {
+			return err
+		}
+		defer closeCounters()
+		tr = db
+	}
+
+	var cache *cachepkg.Cache
+	if cfg.Cache.Enabled {
+		cache, err = cachepkg.New(cfg.DBPath, cfg.Cache.TTL)
+		if err != nil {
+			return fmt.Errorf("init cache: %w", err)
+		}
+		defer func() { _ = cache.Close() }()
+	}
+
+	var enforcer *budget.Enforcer
+	if cfg.Budget.Enabled {
+		opts := []budget.Option{budget.WithQueue(cfg.Budget.Queue.MaxQueue, cfg.Budget.Queue.MaxWait)}
+		if cfg.Budget.ShedLowPriority {
+			opts = append(opts, budget.WithLowPriorityShedding())
+		}
+		if enforcer, err = newEnforcer(context.Background(), cfg, tr, opts...); err != nil {
+			return err
+		}
+	}
+
+	var auditor *audit.Logger
+	if cfg.Audit.Enabled {
+		auditor, err = audit.New(cfg.Audit)
+		if err != nil {
+			return fmt.Errorf("init audit logger: %w", err)
+		}
+		defer func() { _ = auditor.Close() }()
+		log.Printf("audit logging enabled: %s", cfg.Audit.DBPath)
+	}
+
+	srv := proxy.New(cfg, tr, cache, enforcer, auditor)
+
+	type listener struct {
+		name    string
+		addr    string
+		handler http.Handler
+		// proxy is set on the proxy listener, which is drained on shutdown.
+		proxy *proxy.Server
+		// tls, when set, serves the listener over HTTPS.
+		tls *tls.Config
+	}
+	var listeners []listener
+	skip := func(name, reason string) error {
+		if c.required[name] {
+			return fmt.Errorf("%s: %s", name, reason)
+		}
+		log.Printf("%s disabled: %s", name, reason)
+		return nil
+	}
+
+	if c.proxy {
+		tlsConfig, challenge, err := listenerTLS(cfg.TLS)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, listener{"proxy", cfg.Listen, srv, srv, tlsConfig})
+		if challenge != nil {
+			listeners = append(listeners, listener{"acme", cfg.TLS.ACME.HTTPListen, challenge, nil, nil})
+		}
+	}
+
+	if c.mcp {
+		switch {
+		case cfg.MCP.Listen == "":
+			err = skip("mcp", "mcp.listen is not set")
+		case len(cfg.MCP.Tokens) == 0:
+			err = skip("mcp", "mcp.tokens is empty")
+		default:
+			// A nil *cachepkg.Cache must not become a non-nil interface.
+			var stats mcp.CacheStatter
+			if cache != nil {
+				stats = cache
+			}
+			m := mcp.New(tr, stats, enforcer, auditor, cfg.Pricing(), version,
+				mcp.WithLocation(cfg.TeamLocation), mcp.WithKeyLocation(cfg.KeyLocation))
+			mux := http.NewServeMux()
+			mux.Handle("/mcp", m.HTTPHandler(cfg.MCP.Tokens))
+			listeners = append(listeners, listener{"mcp", cfg.MCP.Listen, mux, nil, nil})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.admin || c.dashboard {
+		mux := http.NewServeMux()
+		switch {
+		case cfg.Admin.Listen == "":
+			if c.dashboard {
+				err = skip("dashboard", "admin.listen is not set")
+			}
+		case cfg.Admin.Token == "":
+			err = skip("admin", "admin.token is not set")
+		default:
+			if c.admin {
+				mux.Handle("/pario/admin/", srv.AdminHandler())
+			}
+			if c.dashboard {
+				mux.Handle("/pario/dashboard/", dashboard.Handler())
+				mux.Handle("/{$}", http.RedirectHandler("/pario/dashboard/", http.StatusFound))
+			}
+			listeners = append(listeners, listener{"admin", cfg.Admin.Listen, mux, nil, nil})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.tracker {
+		switch {
+		case cfg.Tracking.Server.Listen == "":
+			err = skip("tracker", "tracking.server.listen is not set")
+		default:
+			mux := http.NewServeMux()
+			mux.Handle("/pario/tracker/", tracker.Handler(tr, cfg.Tracking.Server.Token))
+			listeners = append(listeners, listener{"tracker", cfg.Tracking.Server.Listen, mux, nil, nil})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(listeners) == 0 {
+		return errors.New("no components enabled")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Maintenance.Enabled && cfg.Maintenance.Interval > 0 {
+		// The cache shares the tracker's database file.
+		stores := make(map[string]dbmaint.Maintainer)
+		if db != nil {
+			stores["tracker"] = db
+		}
+		if auditor != nil {
+			stores["audit"] = auditor
+		}
+		go dbmaint.Loop(ctx, cfg.Maintenance.Interval, stores)
+		log.Printf("db maintenance scheduled every %s", cfg.Maintenance.Interval)
+	}
+
+	if db != nil && (cfg.Session.IdleTimeout > 0 || cfg.Retention.SessionDays > 0) {
+		go sessionLoop(ctx, cfg, db)
+		log.Printf("session expiry scheduled every %s", cfg.Session.ExpiryInterval)
+	}
+
+	if db != nil && cfg.Tracking.Rollups.Enabled {
+		go rollupLoop(ctx, cfg, db)
+		log.Printf("usage rollups scheduled every %s", cfg.Tracking.Rollups.Interval)
+	}
+
+	if db != nil && cfg.Anomaly.Enabled {
+		go anomalyLoop(ctx, cfg, db)
+		log.Printf("anomaly detection scheduled every %s", cfg.Anomaly.Interval)
+	}
+
+	if c.proxy && c.configPath != "" {
+		go reloadOnHangup(ctx, c.configPath, srv)
+		if cfg.Reload.Watch {
+			go watchConfig(ctx, c.configPath, cfg.Reload.Interval, srv)
+			log.Printf("watching %s for changes every %s", c.configPath, cfg.Reload.Interval)
+		}
+	}
+
+	if c.proxy && enforcer != nil && cfg.Budget.PolicySync > 0 {
+		go srv.SyncPolicies(ctx, cfg.Budget.PolicySync)
+	}
+
+	if c.proxy && cfg.Batch.PollInterval > 0 {
+		go srv.PollBatches(ctx, cfg.Batch.PollInterval)
+	}
+
+	// The first listener to fail stops the others.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make([]error, len(listeners))
+	var wg sync.WaitGroup
+	for i, l := range listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := serveHTTP(ctx, l.name, l.addr, l.handler, l.proxy, l.tls, cfg.Shutdown.DrainTimeout); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", l.name, err)
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// rollupLoop rolls up usage and applies the usage, event, and rollup
+// retention periods every tracking.rollups.interval until ctx is done. Failures are
+// logged and retried on the next tick.
+func rollupLoop(ctx context.Context, cfg *config.Config, tr *tracker.SQLiteTracker) {
+	ticker := time.NewTicker(cfg.Tracking.Rollups.Interval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		if err := tr.Rollup(ctx, now); err != nil {
+			log.Printf("usage rollup: %v", err)
+		}
+		if days := cfg.Retention.UsageDays; days > 0 {
+			if _, err := tr.PruneUsage(ctx, now.AddDate(0, 0, -days), false); err != nil {
+				log.Printf("prune usage: %v", err)
+			}
+		}
+		if days := cfg.Retention.EventRetentionDays(); days > 0 {
+			if _, err := tr.PruneEvents(ctx, now.AddDate(0, 0, -days), false); err != nil {
+				log.Printf("prune events: %v", err)
+			}
+		}
+		for period, days := range map[string]int{
+			tracker.RollupHourly: cfg.Retention.HourlyRollupDays,
+			tracker.RollupDaily:  cfg.Retention.DailyRollupDays,
+		} {
+			if days > 0 {
+				if _, err := tr.PruneRollups(ctx, period, now.AddDate(0, 0, -days), false); err != nil {
+					log.Printf("prune %s rollups: %v", period, err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sessionLoop ends idle sessions and archives or deletes sessions past
+// retention every session.expiry_interval until ctx is done.
+func sessionLoop(ctx context.Context, cfg *config.Config, tr *tracker.SQLiteTracker) {
+	ticker := time.NewTicker(cfg.Session.ExpiryInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		if idle := cfg.Session.IdleTimeout; idle > 0 {
+			if _, err := tr.ExpireSessions(ctx, now.Add(-idle)); err != nil {
+				log.Printf("expire sessions: %v", err)
+			}
+		}
+		if days := cfg.Retention.SessionDays; days > 0 {
+			before := now.AddDate(0, 0, -days)
+			var err error
+			if cfg.Session.ArchiveDir != "" {
+				_, err = archiveSessions(ctx, tr, cfg.Session.ArchiveDir, before)
+			} else {
+				_, err = tr.PruneSessions(ctx, before, false)
+			}
+			if err != nil {
+				log.Printf("prune sessions: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// anomalyLoop checks the current usage window for anomalies every
+// anomaly.interval until ctx is done, logging each anomaly the first time
+// it is found.
+func anomalyLoop(ctx context.Context, cfg *config.Config, tr *tracker.SQLiteTracker) {
+	a := cfg.Anomaly
+	d := anomaly.New(tr, anomaly.Thresholds{
+		Window:      a.Window,
+		Baseline:    a.BaselineWindows,
+		MinHistory:  a.MinHistory,
+		ZScore:      a.ZScore,
+		MedianRatio: a.MedianRatio,
+		MinTokens:   a.MinTokens,
+	})
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	// logged holds the end of the window of each anomaly logged, by
+	// dimension, value, metric, and window start.
+	logged := make(map[string]time.Time)
+	for {
+		now := time.Now()
+		found, err := d.Detect(ctx, now)
+		if err != nil {
+			log.Printf("anomaly detection: %v", err)
+		}
+		for k, end := range logged {
+			if end.Before(now) {
+				delete(logged, k)
+			}
+		}
+		for _, f := range found {
+			k := strings.Join([]string{f.Dimension, f.Value, f.Metric, f.WindowStart.Format(time.RFC3339)}, "\x00")
+			if _, ok := logged[k]; ok {
+				continue
+			}
+			logged[k] = f.WindowEnd
+			log.Printf("anomaly: %s %s used %s this window (baseline median %s)",
+				f.Dimension, f.Value, formatAnomalyAmount(f.Metric, f.Observed), formatAnomalyAmount(f.Metric, f.Median))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reloadOnHangup re-reads the config file on each SIGHUP and stages its
+// routes and budget policies on the proxy. An invalid file is logged and
+// the running config kept.
+func reloadOnHangup(ctx context.Context, path string, srv *proxy.Server) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			cfg, err := config.Load(path)
+			if err != nil {
+				log.Printf("config reload: %v; keeping running config", err)
+				continue
+			}
+			srv.StageConfig(cfg)
+		}
+	}
+}
+
+// watchConfig stages the config file on the proxy each time its contents
+// change. An invalid file is logged and the running config kept.
+func watchConfig(ctx context.Context, path string, interval time.Duration, srv *proxy.Server) {
+	config.Watch(ctx, path, interval, func(cfg *config.Config, err error) {
+		if err != nil {
+			log.Printf("config reload: %v; keeping running config", err)
+			return
+		}
+		srv.StageConfig(cfg)
+	})
+}
+
+// serveHTTP serves handler on addr until ctx is cancelled, then shuts down
+// gracefully, giving in-flight requests up to drainTimeout to finish. A
+// non-nil drain is the proxy behind handler; it is drained so its Realtime
+// sessions and audit writes finish too. A non-nil tlsConfig serves HTTPS.
+func serveHTTP(ctx context.Context, name, addr string, handler http.Handler, drain *proxy.Server, tlsConfig *tls.Config, drainTimeout time.Duration) error {
+	httpSrv := &http.Server{Addr: addr, Handler: handler, TLSConfig: tlsConfig}
+
+	errCh := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			log.Printf("pario %s listening on %s (TLS)", name, addr)
+			// Certificates come from tlsConfig.
+			errCh <- httpSrv.ListenAndServeTLS("", "")
+			return
+		}
+		log.Printf("pario %s listening on %s", name, addr)
+		errCh <- httpSrv.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		if drain != nil {
+			return drain.Shutdown(shutCtx, httpSrv)
+		}
+		return httpSrv.Shutdown(shutCtx)
+	case err := <-errCh:
+		return err
+	}
+}
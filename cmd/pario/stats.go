@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 	"text/tabwriter"
+	"time"
 
 	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
 	"github.com/pario-ai/pario/pkg/tracker"
 	"github.com/spf13/cobra"
 )
@@ -17,6 +19,13 @@ func newStatsCmd() *cobra.Command {
 		apiKey     string
 		sessions   bool
 		sessionID  string
+		name       string
+		tags       map[string]string
+		throughput bool
+		latency    bool
+		providers  bool
+		rollup     string
+		since      string
 	)
 
 	cmd := &cobra.Command{
@@ -36,8 +45,103 @@ func newStatsCmd() *cobra.Command {
 
 			ctx := context.Background()
 
+			// Throughput and latency distribution views
+			sinceTime := time.Now().UTC().AddDate(0, 0, -7)
+			if since != "" && (throughput || latency || providers) {
+				loc, _ := cfg.Location()
+				t, err := time.ParseInLocation("2006-01-02", since, loc)
+				if err != nil {
+					return fmt.Errorf("invalid --since date (use YYYY-MM-DD): %w", err)
+				}
+				sinceTime = t.UTC()
+			}
+			if providers {
+				stats, err := tr.ProviderReliability(ctx, sinceTime)
+				if err != nil {
+					return err
+				}
+				if len(stats) == 0 {
+					fmt.Println("No provider data found.")
+					return nil
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "PROVIDER\tSERVED\tFAILED\tERROR RATE\tRECOVERED\tFALLBACKS")
+				for _, s := range stats {
+					fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t%d\t%d\n",
+						s.Provider, s.Served, s.Failures, s.ErrorRate*100, s.Recovered, s.Fallbacks)
+				}
+				return w.Flush()
+			}
+			if latency {
+				stats, err := tr.Latency(ctx, sinceTime)
+				if err != nil {
+					return err
+				}
+				if len(stats) == 0 {
+					fmt.Println("No latency data found.")
+					return nil
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "MODEL\tPROVIDER\tREQUESTS\tMEAN MS\tP50\tP95\tP99\tMAX")
+				for _, s := range stats {
+					fmt.Fprintf(w, "%s\t%s\t%d\t%.0f\t%.0f\t%.0f\t%.0f\t%.0f\n",
+						s.Model, defaultStr(s.Provider, "(unknown)"), s.Requests, s.MeanMs, s.P50Ms, s.P95Ms, s.P99Ms, s.MaxMs)
+				}
+				return w.Flush()
+			}
+			if throughput {
+				stats, err := tr.Throughput(ctx, sinceTime)
+				if err != nil {
+					return err
+				}
+				if len(stats) == 0 {
+					fmt.Println("No throughput data found.")
+					return nil
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "MODEL\tPROVIDER\tREQUESTS\tMEAN TOK/S\tP50\tP90\tMIN\tMAX")
+				for _, s := range stats {
+					fmt.Fprintf(w, "%s\t%s\t%d\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\n",
+						s.Model, defaultStr(s.Provider, "(unknown)"), s.Requests, s.Mean, s.P50, s.P90, s.Min, s.Max)
+				}
+				return w.Flush()
+			}
+
+			// Rollup view
+			if rollup != "" {
+				sinceTime := time.Now().UTC().AddDate(0, 0, -30)
+				if since != "" {
+					t, err := time.Parse("2006-01-02", since)
+					if err != nil {
+						return fmt.Errorf("invalid --since date (use YYYY-MM-DD): %w", err)
+					}
+					sinceTime = t
+				}
+				rollups, err := tr.Rollups(ctx, rollup, apiKey, sinceTime)
+				if err != nil {
+					return err
+				}
+				if len(rollups) == 0 {
+					fmt.Println("No rollups found.")
+					return nil
+				}
+				layout := "2006-01-02 15:04"
+				if rollup == tracker.RollupDaily {
+					layout = "2006-01-02"
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "BUCKET (UTC)\tAPI KEY\tMODEL\tPROVIDER\tTEAM\tPROJECT\tREQUESTS\tPROMPT\tCOMPLETION\tTOTAL")
+				for _, r := range rollups {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\n",
+						r.Bucket.Format(layout), r.APIKey, r.Model, defaultStr(r.Provider, "-"), defaultStr(r.Team, "-"), defaultStr(r.Project, "-"),
+						r.RequestCount, r.PromptTokens, r.CompletionTokens, r.TotalTokens)
+				}
+				return w.Flush()
+			}
+
 			// Session detail view
 			if sessionID != "" {
+				sessionID = expandSessionPrefix(cmd, sessionID)
 				reqs, err := tr.SessionRequests(ctx, sessionID)
 				if err != nil {
 					return err
@@ -61,7 +165,7 @@ func newStatsCmd() *cobra.Command {
 
 			// Session list view
 			if sessions {
-				sess, err := tr.ListSessions(ctx, apiKey)
+				sess, err := tr.ListSessions(ctx, models.SessionQuery{APIKey: apiKey, Name: name, Tags: tags})
 				if err != nil {
 					return err
 				}
@@ -70,10 +174,14 @@ func newStatsCmd() *cobra.Command {
 					return nil
 				}
 				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-				fmt.Fprintln(w, "SESSION ID\tAPI KEY\tSTARTED\tLAST ACTIVITY\tREQUESTS\tTOTAL TOKENS")
+				fmt.Fprintln(w, "SESSION ID\tNAME\tAPI KEY\tSTARTED\tLAST ACTIVITY\tENDED\tREQUESTS\tTOTAL TOKENS\tTAGS")
 				for _, s := range sess {
-					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\n",
-						s.ID, s.APIKey, s.StartedAt.Format("2006-01-02T15:04:05"), s.LastActivity.Format("2006-01-02T15:04:05"), s.RequestCount, s.TotalTokens)
+					ended := "-"
+					if !s.EndedAt.IsZero() {
+						ended = s.EndedAt.Format("2006-01-02T15:04:05")
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
+						s.ID, s.Name, s.APIKey, s.StartedAt.Format("2006-01-02T15:04:05"), s.LastActivity.Format("2006-01-02T15:04:05"), ended, s.RequestCount, s.TotalTokens, s.FormatTags())
 				}
 				return w.Flush()
 			}
@@ -90,10 +198,11 @@ func newStatsCmd() *cobra.Command {
 			}
 
 			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "API KEY\tMODEL\tREQUESTS\tPROMPT\tCOMPLETION\tTOTAL")
+			fmt.Fprintln(w, "API KEY\tMODEL\tPROVIDER\tROUTE\tREQUESTS\tPROMPT\tCOMPLETION\tTOTAL\tSTREAMED\tSTREAMED TOKENS\tPARTIAL")
 			for _, s := range summaries {
-				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\n",
-					s.APIKey, s.Model, s.RequestCount, s.TotalPrompt, s.TotalCompletion, s.TotalTokens)
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+					s.APIKey, s.Model, defaultStr(s.Provider, "-"), defaultStr(s.RouteAlias, "-"), s.RequestCount, s.TotalPrompt, s.TotalCompletion, s.TotalTokens,
+					s.StreamedRequests, s.StreamedTokens, s.PartialRequests)
 			}
 			return w.Flush()
 		},
@@ -103,5 +212,13 @@ func newStatsCmd() *cobra.Command {
 	cmd.Flags().StringVar(&apiKey, "api-key", "", "filter by API key")
 	cmd.Flags().BoolVar(&sessions, "sessions", false, "list sessions")
 	cmd.Flags().StringVar(&sessionID, "session-id", "", "show detail for a specific session")
+	cmd.Flags().StringVar(&name, "name", "", "with --sessions, only sessions whose name contains this text")
+	cmd.Flags().StringToStringVar(&tags, "tag", nil, "with --sessions, only sessions with this tag (k=v, repeatable)")
+	cmd.Flags().BoolVar(&throughput, "throughput", false, "show output tokens/sec distribution per model and provider")
+	cmd.Flags().BoolVar(&latency, "latency", false, "show upstream latency percentiles per model and provider")
+	cmd.Flags().BoolVar(&providers, "providers", false, "show failed upstream attempts and fallbacks per provider")
+	cmd.Flags().StringVar(&rollup, "rollup", "", "show usage rollups: hourly or daily")
+	cmd.Flags().StringVar(&since, "since", "", "start date for --throughput, --latency, or --providers (default: last 7 days) or --rollup (UTC, default: last 30 days) (YYYY-MM-DD)")
+	registerCompletions(cmd, map[string]string{"api-key": "api_key", "session-id": "session_id"})
 	return cmd
 }
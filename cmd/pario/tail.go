@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+func newTailCmd() *cobra.Command {
+	var (
+		configPath string
+		proxyURL   string
+		token      string
+		model      string
+		team       string
+		minTokens  int
+		jsonOut    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "tail",
+		Short: "Stream completed requests from a running proxy",
+		Long: `Stream completed requests from a running proxy's admin event stream.
+
+The proxy must have admin.token set. The token is read from --token,
+$PARIO_ADMIN_TOKEN, or the config file, in that order.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			proxyURL, token, err = adminTarget(configPath, proxyURL, token)
+			if err != nil {
+				return err
+			}
+
+			q := url.Values{}
+			if model != "" {
+				q.Set("model", model)
+			}
+			if team != "" {
+				q.Set("team", team)
+			}
+			if minTokens > 0 {
+				q.Set("min_tokens", strconv.Itoa(minTokens))
+			}
+			endpoint := strings.TrimRight(proxyURL, "/") + "/pario/admin/events"
+			if len(q) > 0 {
+				endpoint += "?" + q.Encode()
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Accept", "text/event-stream")
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return fmt.Errorf("connect to %s: %w", proxyURL, err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("event stream: %s", resp.Status)
+			}
+
+			if !jsonOut {
+				fmt.Printf("%-8s  %-8s  %-24s  %8s  %9s  %-5s  %8s  %s\n",
+					"TIME", "KEY", "MODEL", "TOKENS", "COST", "CACHE", "LATENCY", "STATUS")
+			}
+			lines := bufio.NewScanner(resp.Body)
+			lines.Buffer(make([]byte, 64*1024), 1<<20)
+			for lines.Scan() {
+				data, ok := strings.CutPrefix(lines.Text(), "data: ")
+				if !ok {
+					continue
+				}
+				if jsonOut {
+					fmt.Println(data)
+					continue
+				}
+				var ev models.RequestEvent
+				if err := json.Unmarshal([]byte(data), &ev); err != nil {
+					continue
+				}
+				printEvent(ev)
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := lines.Err(); err != nil {
+				return fmt.Errorf("event stream: %w", err)
+			}
+			return fmt.Errorf("event stream closed by proxy")
+		},
+	}
+
+	cmd.Flags().StringVarP(&configPath, "config", "c", "", "path to pario config file")
+	cmd.Flags().StringVar(&proxyURL, "url", "", "proxy base URL (default derived from listen)")
+	cmd.Flags().StringVar(&token, "token", "", "admin API token")
+	cmd.Flags().StringVar(&model, "model", "", "only show requests for this model")
+	cmd.Flags().StringVar(&team, "team", "", "only show requests attributed to this team")
+	cmd.Flags().IntVar(&minTokens, "min-tokens", 0, "only show requests using at least this many tokens")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "print raw JSON events")
+	registerCompletions(cmd, map[string]string{"model": "model", "team": "team"})
+	return cmd
+}
+
+func printEvent(ev models.RequestEvent) {
+	cache := "miss"
+	if ev.Cached {
+		cache = "hit"
+	}
+	fmt.Printf("%-8s  %-8s  %-24s  %8d  %9s  %-5s  %8s  %d\n",
+		ev.Time.Local().Format("15:04:05"),
+		defaultStr(ev.KeyPrefix, "-"),
+		truncate(defaultStr(ev.Model, "-"), 24),
+		ev.TotalTokens,
+		fmt.Sprintf("$%.4f", ev.CostUSD),
+		cache,
+		(time.Duration(ev.LatencyMs) * time.Millisecond).String(),
+		ev.Status,
+	)
+}
+
+// adminTarget resolves the base URL and token of a running proxy's admin
+// API from flags, $PARIO_ADMIN_TOKEN, and the config file, in that order.
+func adminTarget(configPath, baseURL, token string) (string, string, error) {
+	cfg := config.Default()
+	if configPath != "" {
+		var err error
+		cfg, err = config.Load(configPath)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	if token == "" {
+		token = defaultStr(os.Getenv("PARIO_ADMIN_TOKEN"), cfg.Admin.Token)
+	}
+	if token == "" {
+		return "", "", fmt.Errorf("admin token required (--token, $PARIO_ADMIN_TOKEN, or admin.token)")
+	}
+	if baseURL == "" {
+		if cfg.Admin.Listen != "" {
+			// The admin listener never serves TLS.
+			baseURL = listenURL(cfg.Admin.Listen, false)
+		} else {
+			baseURL = listenURL(cfg.Listen, cfg.TLS.Enabled())
+		}
+	}
+	return baseURL, token, nil
+}
+
+// listenURL turns a listen address like ":8080" into a local base URL.
+func listenURL(listen string, tls bool) string {
+	scheme := "http://"
+	if tls {
+		scheme = "https://"
+	}
+	if strings.HasPrefix(listen, ":") {
+		return scheme + "localhost" + listen
+	}
+	return scheme + listen
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-1] + "…"
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// defaultACMECacheDir holds ACME account keys and certificates when
+// tls.acme.cache_dir is not set.
+const defaultACMECacheDir = "pario-acme"
+
+// listenerTLS returns the TLS config for the proxy listener, or nil when t
+// is not enabled. With ACME HTTP-01 it also returns the challenge handler
+// for acme.http_listen.
+func listenerTLS(t config.ListenerTLS) (*tls.Config, http.Handler, error) {
+	switch {
+	case t.CertFile != "":
+		c := &certFiles{certFile: t.CertFile, keyFile: t.KeyFile}
+		if _, err := c.getCertificate(nil); err != nil {
+			return nil, nil, err
+		}
+		return &tls.Config{GetCertificate: c.getCertificate, MinVersion: tls.VersionTLS12}, nil, nil
+	case t.ACME.Enabled():
+		dir := t.ACME.CacheDir
+		if dir == "" {
+			dir = defaultACMECacheDir
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(t.ACME.Domains...),
+			Cache:      autocert.DirCache(dir),
+			Email:      t.ACME.Email,
+		}
+		if t.ACME.DirectoryURL != "" {
+			m.Client = &acme.Client{DirectoryURL: t.ACME.DirectoryURL}
+		}
+		var challenge http.Handler
+		if t.ACME.HTTPListen != "" {
+			challenge = m.HTTPHandler(nil)
+		}
+		c := m.TLSConfig()
+		c.MinVersion = tls.VersionTLS12
+		return c, challenge, nil
+	}
+	return nil, nil, nil
+}
+
+// certFiles serves a certificate from PEM files, reloading it when either
+// file's modification time changes so rotated certificates are picked up
+// without a restart.
+type certFiles struct {
+	certFile, keyFile string
+
+	mu              sync.Mutex
+	cert            *tls.Certificate
+	certMod, keyMod time.Time
+}
+
+func (c *certFiles) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return c.stale(fmt.Errorf("tls cert_file: %w", err))
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return c.stale(fmt.Errorf("tls key_file: %w", err))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cert != nil && certInfo.ModTime().Equal(c.certMod) && keyInfo.ModTime().Equal(c.keyMod) {
+		return c.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			// Likely caught mid-rotation; retried on the next handshake.
+			log.Printf("tls: reload certificate: %v; keeping the previous one", err)
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("tls: load certificate: %w", err)
+	}
+	c.cert, c.certMod, c.keyMod = &cert, certInfo.ModTime(), keyInfo.ModTime()
+	return c.cert, nil
+}
+
+// stale returns the loaded certificate when the files can't be checked, or
+// err before any certificate has loaded.
+func (c *certFiles) stale(err error) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cert == nil {
+		return nil, err
+	}
+	return c.cert, nil
+}
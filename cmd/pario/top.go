@@ -1,18 +1,203 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/router"
 	"github.com/spf13/cobra"
 )
 
 func newTopCmd() *cobra.Command {
-	return &cobra.Command{
+	var (
+		configPath string
+		proxyURL   string
+		token      string
+		interval   time.Duration
+		once       bool
+		by         string
+		order      string
+		hours      int
+		limit      int
+	)
+
+	cmd := &cobra.Command{
 		Use:   "top",
 		Short: "Live view of token usage (like htop for tokens)",
+		Long: `Live view of a running proxy's upstream rate limits: how much of each
+provider's request and token quota is left, as last reported by its
+x-ratelimit-* or anthropic-ratelimit-* response headers, and whether it
+is being held back after a 429.
+
+Below the rate limits, the API keys, sessions, models, or teams (--by)
+with the most usage over the last --hours are ranked by estimated cost or
+tokens (--order).
+
+The proxy must have admin.token set. The token is read from --token,
+$PARIO_ADMIN_TOKEN, or the config file, in that order.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			fmt.Println("top: not yet implemented (planned for week 2)")
-			return nil
+			if !once && interval <= 0 {
+				return fmt.Errorf("--interval must be positive")
+			}
+			var err error
+			proxyURL, token, err = adminTarget(configPath, proxyURL, token)
+			if err != nil {
+				return err
+			}
+			endpoint := strings.TrimRight(proxyURL, "/") + "/pario/admin/ratelimits"
+			topParams := url.Values{"by": {by}, "order": {order}, "hours": {strconv.Itoa(hours)}, "limit": {strconv.Itoa(limit)}}
+			topEndpoint := strings.TrimRight(proxyURL, "/") + "/pario/admin/top?" + topParams.Encode()
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			for {
+				limits, err := fetchRateLimits(ctx, endpoint, token)
+				if ctx.Err() != nil {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				var top []models.TopEntry
+				if err := fetchAdmin(ctx, topEndpoint, token, &top); err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					return fmt.Errorf("top usage: %w", err)
+				}
+				if !once {
+					fmt.Print("\033[H\033[2J")
+					fmt.Printf("pario top — %s — every %s\n\n", proxyURL, interval)
+				}
+				printRateLimits(limits, time.Now())
+				fmt.Printf("\nTop %s by %s, last %dh\n\n", by, order, hours)
+				printTop(by, top)
+				if once {
+					return nil
+				}
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(interval):
+				}
+			}
 		},
 	}
+
+	cmd.Flags().StringVarP(&configPath, "config", "c", "", "path to pario config file")
+	cmd.Flags().StringVar(&proxyURL, "url", "", "proxy base URL (default derived from listen)")
+	cmd.Flags().StringVar(&token, "token", "", "admin API token")
+	cmd.Flags().DurationVarP(&interval, "interval", "n", 2*time.Second, "refresh interval")
+	cmd.Flags().BoolVar(&once, "once", false, "print one snapshot and exit")
+	cmd.Flags().StringVar(&by, "by", models.TopByKey, "rank api_key, session, model, or team")
+	cmd.Flags().StringVar(&order, "order", models.TopOrderCost, "rank by cost or tokens")
+	cmd.Flags().IntVar(&hours, "hours", 1, "usage window in hours")
+	cmd.Flags().IntVar(&limit, "limit", 10, "number of entries to rank")
+	return cmd
+}
+
+func fetchRateLimits(ctx context.Context, endpoint, token string) (map[string]router.ProviderLimits, error) {
+	var limits map[string]router.ProviderLimits
+	if err := fetchAdmin(ctx, endpoint, token, &limits); err != nil {
+		return nil, fmt.Errorf("rate limits: %w", err)
+	}
+	return limits, nil
+}
+
+// fetchAdmin GETs an admin API endpoint and decodes its JSON body into out.
+func fetchAdmin(ctx context.Context, endpoint, token string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("connect to proxy: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, e.Error.Message)
+		}
+		return errors.New(resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+func printTop(by string, entries []models.TopEntry) {
+	fmt.Printf("%-4s  %-38s  %-8s  %-12s  %s\n", "#", strings.ToUpper(by), "REQUESTS", "TOKENS", "EST. COST")
+	if len(entries) == 0 {
+		fmt.Println("(no usage in this window)")
+		return
+	}
+	for i, e := range entries {
+		value := e.Value
+		if value == "" {
+			value = "-"
+		}
+		fmt.Printf("%-4d  %-38s  %-8d  %-12d  $%.4f\n", i+1, truncate(value, 38), e.RequestCount, e.TotalTokens, e.EstimatedCost)
+	}
+}
+
+func printRateLimits(limits map[string]router.ProviderLimits, now time.Time) {
+	fmt.Printf("%-20s  %-22s  %-24s  %-10s  %s\n", "PROVIDER", "REQUESTS LEFT", "TOKENS LEFT", "SEEN", "STATUS")
+	if len(limits) == 0 {
+		fmt.Println("(no rate-limit headers seen yet)")
+		return
+	}
+	names := make([]string, 0, len(limits))
+	for name := range limits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := limits[name]
+		status := "ok"
+		if now.Before(p.LimitedUntil) {
+			status = "limited for " + p.LimitedUntil.Sub(now).Round(time.Second).String()
+		}
+		fmt.Printf("%-20s  %-22s  %-24s  %-10s  %s\n",
+			truncate(name, 20),
+			formatLimit(p.Requests, now),
+			formatLimit(p.Tokens, now),
+			now.Sub(p.UpdatedAt).Round(time.Second).String()+" ago",
+			status,
+		)
+	}
+}
+
+// formatLimit renders a bucket as "remaining/limit (pct)". A bucket past
+// its reset time is shown as refilled.
+func formatLimit(l *router.Limit, now time.Time) string {
+	switch {
+	case l == nil:
+		return "-"
+	case !l.Reset.IsZero() && !now.Before(l.Reset):
+		return "reset"
+	case l.Limit > 0:
+		return fmt.Sprintf("%d/%d (%.0f%%)", l.Remaining, l.Limit, 100*float64(l.Remaining)/float64(l.Limit))
+	}
+	return fmt.Sprintf("%d", l.Remaining)
 }
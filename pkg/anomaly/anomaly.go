@@ -0,0 +1,177 @@
+// Package anomaly flags API keys and teams whose recent usage departs from
+// their own history, so a runaway agent shows up within the hour rather
+// than on the next invoice.
+//
+// Usage is compared in fixed-width windows aligned to multiples of the
+// window width. The window in progress is checked against the windows
+// before it, by z-score against their mean and as a multiple of their
+// median, and is checked again on every run as it fills.
+package anomaly
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// Thresholds decide what counts as an anomaly.
+type Thresholds struct {
+	// Window is the width of the windows usage is compared in.
+	Window time.Duration
+	// Baseline is how many windows before the current one make up a key's
+	// or team's history.
+	Baseline int
+	// MinHistory is how many baseline windows must have usage before a key
+	// or team is checked, so new ones aren't flagged for starting up.
+	MinHistory int
+	// ZScore is how many standard deviations above the baseline mean a
+	// window must be.
+	ZScore float64
+	// MedianRatio is how many times the baseline median a window must also
+	// be, so that a quiet, steady history doesn't make small rises look
+	// extreme.
+	MedianRatio float64
+	// MinTokens skips windows that used fewer tokens, however unusual.
+	MinTokens int64
+}
+
+// Store is where usage is read from and anomalies are written to; the
+// SQLite tracker is one.
+type Store interface {
+	UsageWindows(ctx context.Context, by string, since time.Time, width time.Duration) ([]models.WindowUsage, error)
+	RecordAnomaly(ctx context.Context, a models.Anomaly) error
+}
+
+// Dimensions are what usage is grouped by for detection.
+var Dimensions = []string{models.TopByKey, models.TopByTeam}
+
+// Detector finds and records anomalies.
+type Detector struct {
+	store Store
+	th    Thresholds
+}
+
+// New creates a Detector. The cost metric is the cost stored on usage
+// records when they were recorded.
+func New(store Store, th Thresholds) *Detector {
+	if th.MinHistory < 1 {
+		th.MinHistory = 1
+	}
+	return &Detector{store: store, th: th}
+}
+
+// series holds a value's tokens and cost per window, oldest first; the
+// last window is the current one.
+type series struct {
+	tokens, cost []float64
+}
+
+// Detect checks the window holding now for every API key and team,
+// records the anomalies found, and returns them.
+func (d *Detector) Detect(ctx context.Context, now time.Time) ([]models.Anomaly, error) {
+	w := d.th.Window
+	current := now.UTC().Truncate(w)
+	since := current.Add(-time.Duration(d.th.Baseline) * w)
+
+	var found []models.Anomaly
+	for _, by := range Dimensions {
+		windows, err := d.store.UsageWindows(ctx, by, since, w)
+		if err != nil {
+			return found, fmt.Errorf("detect anomalies by %s: %w", by, err)
+		}
+		values := make(map[string]*series)
+		for _, u := range windows {
+			i := int(u.Start.Sub(since) / w)
+			if i < 0 || i > d.th.Baseline {
+				continue
+			}
+			s, ok := values[u.Value]
+			if !ok {
+				s = &series{tokens: make([]float64, d.th.Baseline+1), cost: make([]float64, d.th.Baseline+1)}
+				values[u.Value] = s
+			}
+			s.tokens[i] += float64(u.Usage.TotalTokens)
+			s.cost[i] += u.Usage.EstimatedCost
+		}
+
+		var batch []models.Anomaly
+		for value, s := range values {
+			if s.tokens[d.th.Baseline] < float64(d.th.MinTokens) {
+				continue
+			}
+			for metric, points := range map[string][]float64{
+				models.AnomalyMetricTokens: s.tokens,
+				models.AnomalyMetricCost:   s.cost,
+			} {
+				a, ok := d.check(points)
+				if !ok {
+					continue
+				}
+				a.Dimension, a.Value, a.Metric = by, value, metric
+				a.WindowStart, a.WindowEnd = current, current.Add(w)
+				a.DetectedAt = now.UTC()
+				batch = append(batch, a)
+			}
+		}
+		slices.SortFunc(batch, func(a, b models.Anomaly) int {
+			return cmp.Or(cmp.Compare(a.Value, b.Value), cmp.Compare(a.Metric, b.Metric))
+		})
+		for _, a := range batch {
+			if err := d.store.RecordAnomaly(ctx, a); err != nil {
+				return found, fmt.Errorf("record anomaly: %w", err)
+			}
+		}
+		found = append(found, batch...)
+	}
+	return found, nil
+}
+
+// check compares the last point with the ones before it and returns the
+// anomaly's figures if it stands out.
+func (d *Detector) check(points []float64) (models.Anomaly, bool) {
+	baseline, observed := points[:len(points)-1], points[len(points)-1]
+	active := 0
+	for _, v := range baseline {
+		if v > 0 {
+			active++
+		}
+	}
+	if active < d.th.MinHistory {
+		return models.Anomaly{}, false
+	}
+
+	a := models.Anomaly{Observed: observed, Median: median(baseline)}
+	for _, v := range baseline {
+		a.Mean += v
+	}
+	a.Mean /= float64(len(baseline))
+	for _, v := range baseline {
+		a.StdDev += (v - a.Mean) * (v - a.Mean)
+	}
+	a.StdDev = math.Sqrt(a.StdDev / float64(len(baseline)))
+
+	if observed < d.th.MedianRatio*a.Median || observed <= a.Mean {
+		return models.Anomaly{}, false
+	}
+	if a.StdDev == 0 {
+		// Any rise above a constant history stands out.
+		return a, true
+	}
+	a.ZScore = (observed - a.Mean) / a.StdDev
+	return a, a.ZScore >= d.th.ZScore
+}
+
+// median returns the middle value of points.
+func median(points []float64) float64 {
+	sorted := slices.Sorted(slices.Values(points))
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,114 @@
+package anomaly
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/tracker"
+)
+
+func TestDetect(t *testing.T) {
+	tr, err := tracker.New(filepath.Join(t.TempDir(), "pario.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tr.Close() })
+	ctx := context.Background()
+	now := time.Date(2026, 3, 10, 12, 30, 0, 0, time.UTC)
+	current := now.Truncate(time.Hour)
+
+	record := func(key, team string, tokens int, at time.Time) {
+		t.Helper()
+		rec := models.UsageRecord{APIKey: key, Team: team, Model: "gpt-4", PromptTokens: tokens, TotalTokens: tokens,
+			EstimatedCostUSD: float64(tokens) / 1000 * 0.01, CreatedAt: at}
+		if err := tr.Record(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for h := 1; h <= 24; h++ {
+		at := current.Add(-time.Duration(h)*time.Hour + time.Minute)
+		record("steady", "a", 1000+h%3*100, at)
+		record("runaway", "a", 1000+h%2*100, at)
+		record("small", "b", 10, at)
+	}
+	record("steady", "a", 1150, current.Add(time.Minute))
+	record("runaway", "a", 50000, current.Add(time.Minute))
+	record("new", "", 50000, current.Add(time.Minute))
+	record("small", "b", 500, current.Add(time.Minute))
+
+	d := New(tr, Thresholds{Window: time.Hour, Baseline: 24, MinHistory: 12, ZScore: 3, MedianRatio: 3, MinTokens: 1000})
+	found, err := d.Detect(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, a := range found {
+		got = append(got, a.Dimension+"/"+a.Value+"/"+a.Metric)
+	}
+	want := []string{"api_key/runaway/cost", "api_key/runaway/tokens", "team/a/cost", "team/a/tokens"}
+	if len(got) != len(want) {
+		t.Fatalf("anomalies = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("anomalies = %v, want %v", got, want)
+		}
+	}
+	if a := found[1]; a.Observed != 50000 || a.Median != 1050 || a.ZScore < 3 || !a.WindowStart.Equal(current) || !a.WindowEnd.Equal(current.Add(time.Hour)) {
+		t.Errorf("runaway tokens anomaly = %+v", a)
+	}
+	if a := found[0]; a.Observed != 0.5 {
+		t.Errorf("runaway cost = %v, want 0.5", a.Observed)
+	}
+
+	// A later run updates the window's anomaly instead of adding another.
+	record("runaway", "a", 10000, current.Add(20*time.Minute))
+	if _, err := d.Detect(ctx, now.Add(10*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := tr.Anomalies(ctx, models.AnomalyQuery{Since: current, Dimension: models.TopByKey, Value: "runaway"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("stored anomalies = %+v", stored)
+	}
+	for _, a := range stored {
+		if a.Metric == models.AnomalyMetricTokens && (a.Observed != 60000 || !a.DetectedAt.Equal(now) || !a.UpdatedAt.Equal(now.Add(10*time.Minute))) {
+			t.Errorf("updated anomaly = %+v", a)
+		}
+	}
+	if all, _ := tr.Anomalies(ctx, models.AnomalyQuery{Since: current}); len(all) != 4 {
+		t.Errorf("all anomalies = %d, want 4", len(all))
+	}
+	if old, _ := tr.Anomalies(ctx, models.AnomalyQuery{Since: current.Add(time.Hour)}); len(old) != 0 {
+		t.Errorf("anomalies of later windows = %+v", old)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	d := New(nil, Thresholds{MinHistory: 3, ZScore: 3, MedianRatio: 2})
+	tests := []struct {
+		name   string
+		points []float64
+		want   bool
+	}{
+		{"spike", []float64{10, 12, 8, 11, 9, 100}, true},
+		{"within noise", []float64{10, 30, 5, 25, 10, 35}, false},
+		{"constant then rise", []float64{10, 10, 10, 10, 25}, true},
+		{"constant then small rise", []float64{10, 10, 10, 10, 15}, false},
+		{"too little history", []float64{0, 0, 0, 10, 10, 1000}, false},
+		{"drop", []float64{100, 100, 90, 110, 0}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, ok := d.check(tt.points)
+			if ok != tt.want {
+				t.Errorf("check(%v) = %+v, %v; want %v", tt.points, a, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Package attribution validates client-supplied attribution labels before
+// they are stored, so free-form headers can't explode the number of distinct
+// grouping values in cost reports.
+package attribution
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/pario-ai/pario/pkg/config"
+)
+
+// DefaultOverflowValue replaces label values beyond a key's cardinality cap.
+const DefaultOverflowValue = "__other__"
+
+// Validator applies the configured allowlist, cardinality caps, and value
+// normalization to attribution labels. It is safe for concurrent use.
+type Validator struct {
+	cfg     config.LabelsConfig
+	allowed map[string]bool
+
+	mu   sync.Mutex
+	seen map[string]map[string]struct{}
+}
+
+// NewValidator creates a Validator from the labels configuration.
+func NewValidator(cfg config.LabelsConfig) *Validator {
+	if cfg.OverflowValue == "" {
+		cfg.OverflowValue = DefaultOverflowValue
+	}
+	v := &Validator{
+		cfg:  cfg,
+		seen: make(map[string]map[string]struct{}),
+	}
+	if len(cfg.AllowedKeys) > 0 {
+		v.allowed = make(map[string]bool, len(cfg.AllowedKeys))
+		for _, k := range cfg.AllowedKeys {
+			v.allowed[v.normalize(k)] = true
+		}
+	}
+	return v
+}
+
+// Seed registers values already stored so cardinality caps survive restarts.
+// It does nothing without a cap.
+func (v *Validator) Seed(values map[string][]string) {
+	if v.cfg.MaxValuesPerKey <= 0 {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for k, vals := range values {
+		for _, val := range vals {
+			v.admitLocked(k, val)
+		}
+	}
+}
+
+// Labels validates free-form labels: keys are normalized and checked against
+// the allowlist, at most MaxKeys keys are kept (in sorted order), and values
+// are normalized and capped per key. It returns nil if nothing survives.
+func (v *Validator) Labels(in map[string]string) map[string]string {
+	if len(in) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(in))
+	normalized := make(map[string]string, len(in))
+	for k, val := range in {
+		nk := v.normalize(k)
+		if nk == "" || (v.allowed != nil && !v.allowed[nk]) {
+			continue
+		}
+		if _, dup := normalized[nk]; !dup {
+			keys = append(keys, nk)
+		}
+		normalized[nk] = val
+	}
+	sort.Strings(keys)
+	if v.cfg.MaxKeys > 0 && len(keys) > v.cfg.MaxKeys {
+		keys = keys[:v.cfg.MaxKeys]
+	}
+
+	out := make(map[string]string, len(keys))
+	for _, k := range keys {
+		out[k] = v.Value(k, normalized[k])
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// Value normalizes a single label value and enforces the cardinality cap for
+// key, returning the overflow value once the cap is reached.
+func (v *Validator) Value(key, value string) string {
+	value = v.normalize(value)
+	if value == "" {
+		return ""
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.admitLocked(key, value) {
+		return v.cfg.OverflowValue
+	}
+	return value
+}
+
+// Normalize normalizes a value without enforcing any cardinality cap, for
+// fields such as commit SHAs that are unique by nature.
+func (v *Validator) Normalize(value string) string {
+	return v.normalize(value)
+}
+
+// admitLocked records value for key and reports whether it is within the
+// cap. Without a cap every value is admitted and nothing is recorded.
+func (v *Validator) admitLocked(key, value string) bool {
+	if v.cfg.MaxValuesPerKey <= 0 {
+		return true
+	}
+	vals, ok := v.seen[key]
+	if !ok {
+		vals = make(map[string]struct{})
+		v.seen[key] = vals
+	}
+	if _, ok := vals[value]; ok {
+		return true
+	}
+	if len(vals) >= v.cfg.MaxValuesPerKey {
+		return false
+	}
+	vals[value] = struct{}{}
+	return true
+}
+
+// normalize trims the string, drops control characters, and applies the
+// configured case folding, whitespace collapsing, and length limit.
+func (v *Validator) normalize(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+	if v.cfg.Normalize {
+		s = strings.ToLower(s)
+		s = strings.Join(strings.Fields(s), "-")
+	}
+	if v.cfg.MaxValueLength > 0 && len(s) > v.cfg.MaxValueLength {
+		s = truncate(s, v.cfg.MaxValueLength)
+	}
+	return s
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	for n > 0 && !isRuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
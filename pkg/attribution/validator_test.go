@@ -0,0 +1,108 @@
+package attribution
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pario-ai/pario/pkg/config"
+)
+
+func TestLabels(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.LabelsConfig
+		in   map[string]string
+		want map[string]string
+	}{
+		{
+			name: "no limits passes through",
+			in:   map[string]string{"Feature": "Search Box"},
+			want: map[string]string{"Feature": "Search Box"},
+		},
+		{
+			name: "normalize",
+			cfg:  config.LabelsConfig{Normalize: true},
+			in:   map[string]string{" Feature ": "  Search   Box\t"},
+			want: map[string]string{"feature": "search-box"},
+		},
+		{
+			name: "allowlist drops unknown keys",
+			cfg:  config.LabelsConfig{AllowedKeys: []string{"feature"}},
+			in:   map[string]string{"feature": "search", "user_id": "u-123"},
+			want: map[string]string{"feature": "search"},
+		},
+		{
+			name: "max keys keeps first sorted",
+			cfg:  config.LabelsConfig{MaxKeys: 2},
+			in:   map[string]string{"c": "3", "a": "1", "b": "2"},
+			want: map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			name: "max value length",
+			cfg:  config.LabelsConfig{MaxValueLength: 4},
+			in:   map[string]string{"tier": "enterprise", "x": "héé"},
+			want: map[string]string{"tier": "ente", "x": "hé"},
+		},
+		{
+			name: "control characters stripped",
+			in:   map[string]string{"tier": "pro\x00\x1b"},
+			want: map[string]string{"tier": "pro"},
+		},
+		{
+			name: "empty values dropped",
+			cfg:  config.LabelsConfig{AllowedKeys: []string{"tier"}},
+			in:   map[string]string{"other": "x"},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewValidator(tt.cfg).Labels(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Labels(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValueCardinality(t *testing.T) {
+	v := NewValidator(config.LabelsConfig{MaxValuesPerKey: 2})
+	v.Seed(map[string][]string{"team": {"eng"}})
+
+	steps := []struct {
+		key, in, want string
+	}{
+		{"team", "eng", "eng"},
+		{"team", "ml", "ml"},
+		{"team", "sales", DefaultOverflowValue},
+		{"team", "ml", "ml"},
+		{"project", "sales", "sales"},
+		{"team", "", ""},
+	}
+	for _, s := range steps {
+		if got := v.Value(s.key, s.in); got != s.want {
+			t.Errorf("Value(%q, %q) = %q, want %q", s.key, s.in, got, s.want)
+		}
+	}
+}
+
+func TestNoCapTracksNothing(t *testing.T) {
+	v := NewValidator(config.LabelsConfig{})
+	v.Seed(map[string][]string{"team": {"eng"}})
+	for _, val := range []string{"a", "b", "c"} {
+		if got := v.Value("team", val); got != val {
+			t.Errorf("Value(team, %q) = %q", val, got)
+		}
+	}
+	if len(v.seen) != 0 {
+		t.Errorf("seen = %v, want nothing tracked without a cap", v.seen)
+	}
+}
+
+func TestOverflowValue(t *testing.T) {
+	v := NewValidator(config.LabelsConfig{MaxValuesPerKey: 1, OverflowValue: "other"})
+	v.Value("k", "a")
+	if got := v.Value("k", "b"); got != "other" {
+		t.Errorf("Value = %q, want other", got)
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/pario-ai/pario/pkg/dbmaint"
 	"github.com/pario-ai/pario/pkg/models"
 	_ "modernc.org/sqlite"
 )
@@ -112,7 +114,7 @@ func (l *Logger) Log(ctx context.Context, entry models.AuditEntry) error {
 		respBody = ""
 	}
 	if l.include["metadata"] && entry.RequestHeaders != nil {
-		b, _ := json.Marshal(entry.RequestHeaders)
+		b, _ := json.Marshal(l.redactHeaders(entry.RequestHeaders))
 		headersJSON = string(b)
 	}
 
@@ -209,6 +211,57 @@ func (l *Logger) Query(ctx context.Context, opts models.AuditQueryOpts) ([]model
 	return entries, rows.Err()
 }
 
+// Get returns the full entry for a request ID, or nil if there is none.
+// The current include and redact_keys settings are applied on read, so
+// fields captured before they were tightened are not exposed.
+func (l *Logger) Get(ctx context.Context, requestID string) (*models.AuditEntry, error) {
+	entries, err := l.Query(ctx, models.AuditQueryOpts{RequestID: requestID, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	e := entries[0]
+	if !l.include["prompts"] {
+		e.RequestBody = ""
+	}
+	if !l.include["responses"] {
+		e.ResponseBody = ""
+	}
+	if l.include["metadata"] {
+		e.RequestHeaders = l.redactHeaders(e.RequestHeaders)
+	} else {
+		e.RequestHeaders = nil
+	}
+	return &e, nil
+}
+
+// sensitiveHeaders carry credentials and are masked when redact_keys is set.
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"x-api-key":           true,
+	"api-key":             true,
+	"cookie":              true,
+}
+
+// redactHeaders returns a copy of headers with credential values masked when
+// redact_keys is enabled.
+func (l *Logger) redactHeaders(headers map[string]string) map[string]string {
+	if !l.cfg.RedactKeys || headers == nil {
+		return headers
+	}
+	out := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if sensitiveHeaders[strings.ToLower(k)] {
+			v = "[REDACTED]"
+		}
+		out[k] = v
+	}
+	return out
+}
+
 // Stats returns aggregate counts grouped by model and day.
 func (l *Logger) Stats(ctx context.Context) ([]models.AuditStat, error) {
 	rows, err := l.db.QueryContext(ctx,
@@ -234,13 +287,43 @@ func (l *Logger) Stats(ctx context.Context) ([]models.AuditStat, error) {
 
 // Cleanup deletes entries older than the configured retention period.
 func (l *Logger) Cleanup(ctx context.Context) (int64, error) {
-	cutoff := time.Now().AddDate(0, 0, -l.cfg.RetentionDays)
-	res, err := l.db.ExecContext(ctx,
-		`DELETE FROM audit_log WHERE created_at < ?`, cutoff)
+	res, err := l.Prune(ctx, l.RetentionCutoff(), false)
 	if err != nil {
 		return 0, fmt.Errorf("audit cleanup: %w", err)
 	}
-	return res.RowsAffected()
+	return res.Rows, nil
+}
+
+// RetentionCutoff returns the time before which entries are past the
+// configured retention period.
+func (l *Logger) RetentionCutoff() time.Time {
+	return time.Now().AddDate(0, 0, -l.cfg.RetentionDays)
+}
+
+// Prune deletes entries created before the cutoff. With dryRun set it only
+// reports what would be deleted.
+func (l *Logger) Prune(ctx context.Context, before time.Time, dryRun bool) (dbmaint.PruneResult, error) {
+	return dbmaint.Prune(ctx, l.db, "audit_log", "created_at < ?", dryRun, before)
+}
+
+// Maintain checkpoints, analyzes, and vacuums the audit database.
+func (l *Logger) Maintain(ctx context.Context) (dbmaint.Report, error) {
+	return dbmaint.Run(ctx, l.db)
+}
+
+// Vacuum checkpoints and vacuums the audit database.
+func (l *Logger) Vacuum(ctx context.Context) (dbmaint.Report, error) {
+	return dbmaint.Vacuum(ctx, l.db)
+}
+
+// Analyze refreshes the audit database's planner statistics.
+func (l *Logger) Analyze(ctx context.Context) (dbmaint.Report, error) {
+	return dbmaint.Analyze(ctx, l.db)
+}
+
+// DBStats reports the size of the audit database and its tables.
+func (l *Logger) DBStats(ctx context.Context) (dbmaint.Stats, error) {
+	return dbmaint.ReadStats(ctx, l.db)
 }
 
 // Close stops the retention goroutine and closes the database.
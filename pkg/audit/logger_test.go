@@ -220,3 +220,79 @@ func TestNewInvalidPath(t *testing.T) {
 		t.Error("expected error for invalid path")
 	}
 }
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	cfg := tempCfg(t)
+	l := mustNew(t, cfg)
+
+	entry := sampleEntry()
+	entry.RequestHeaders = map[string]string{"Authorization": "Bearer sk-secret", "Content-Type": "application/json"}
+	if err := l.Log(ctx, entry); err != nil {
+		t.Fatalf("Log: %v", err)
+	}
+
+	got, err := l.Get(ctx, "req-001")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got == nil || got.RequestBody == "" || got.ResponseBody == "" {
+		t.Fatalf("expected full entry, got %+v", got)
+	}
+	if got.RequestHeaders["Authorization"] != "[REDACTED]" || got.RequestHeaders["Content-Type"] != "application/json" {
+		t.Errorf("unexpected headers: %v", got.RequestHeaders)
+	}
+
+	missing, err := l.Get(ctx, "req-missing")
+	if err != nil || missing != nil {
+		t.Errorf("Get(missing) = %+v, %v; want nil, nil", missing, err)
+	}
+
+	// Tightening include after the fact hides previously stored fields.
+	cfg.Include = []string{"responses"}
+	l = mustNew(t, cfg)
+	got, err = l.Get(ctx, "req-001")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.RequestBody != "" || got.RequestHeaders != nil || got.ResponseBody == "" {
+		t.Errorf("include not applied on read: %+v", got)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	l := mustNew(t, tempCfg(t))
+	ctx := context.Background()
+
+	old := sampleEntry()
+	old.RequestID = "req-old"
+	old.CreatedAt = time.Now().AddDate(0, 0, -10)
+	_ = l.Log(ctx, old)
+	_ = l.Log(ctx, sampleEntry())
+
+	cutoff := time.Now().AddDate(0, 0, -5)
+	res, err := l.Prune(ctx, cutoff, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Rows != 1 || !res.DryRun {
+		t.Errorf("dry run = %+v, want 1 row", res)
+	}
+	if entries, _ := l.Query(ctx, models.AuditQueryOpts{}); len(entries) != 2 {
+		t.Errorf("dry run deleted entries: %d left", len(entries))
+	}
+
+	if res, err = l.Prune(ctx, cutoff, false); err != nil {
+		t.Fatal(err)
+	}
+	if res.Rows != 1 || res.Bytes == 0 {
+		t.Errorf("prune = %+v, want 1 row with bytes", res)
+	}
+	entries, err := l.Query(ctx, models.AuditQueryOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected 1 entry left, got %d", len(entries))
+	}
+}
@@ -0,0 +1,286 @@
+// Package backup snapshots Pario's SQLite databases into a single tar.gz
+// archive and restores them. Snapshots use SQLite's online backup API, so
+// they are consistent even while the proxy is writing.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	sqlite "modernc.org/sqlite"
+)
+
+// manifestName is the archive entry describing its contents.
+const manifestName = "manifest.json"
+
+// Database names one SQLite file to back up or restore.
+type Database struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// Entry records one database stored in an archive.
+type Entry struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Manifest describes the contents of a backup archive.
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Databases []Entry   `json:"databases"`
+}
+
+// backuper is implemented by modernc.org/sqlite driver connections.
+type backuper interface {
+	NewBackup(dstURI string) (*sqlite.Backup, error)
+	NewRestore(srcURI string) (*sqlite.Backup, error)
+}
+
+// Create snapshots each database and writes a gzip-compressed tar archive
+// containing the snapshots and a manifest to w.
+func Create(ctx context.Context, w io.Writer, dbs []Database) (*Manifest, error) {
+	tmp, err := os.MkdirTemp("", "pario-backup-")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+
+	m := &Manifest{Version: 1, CreatedAt: time.Now().UTC()}
+	for _, d := range dbs {
+		file := d.Name + ".db"
+		dst := filepath.Join(tmp, file)
+		if err := snapshot(ctx, d.Path, dst); err != nil {
+			return nil, fmt.Errorf("snapshot %s: %w", d.Name, err)
+		}
+		fi, err := os.Stat(dst)
+		if err != nil {
+			return nil, fmt.Errorf("stat %s snapshot: %w", d.Name, err)
+		}
+		m.Databases = append(m.Databases, Entry{Name: d.Name, File: file, Path: d.Path, Size: fi.Size()})
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal manifest: %w", err)
+	}
+	if err := writeEntry(tw, manifestName, data); err != nil {
+		return nil, err
+	}
+	for _, e := range m.Databases {
+		if err := writeFile(tw, e.File, filepath.Join(tmp, e.File)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("close tar: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("close gzip: %w", err)
+	}
+	return m, nil
+}
+
+// Restore reads an archive produced by Create and copies each database into
+// the path given for its name in targets. Databases in the archive without a
+// target are skipped; a target missing from the archive is an error. The
+// restore goes through SQLite, so any existing WAL is handled correctly, but
+// the proxy should be stopped first.
+func Restore(ctx context.Context, r io.Reader, targets map[string]string) (*Manifest, error) {
+	tmp, err := os.MkdirTemp("", "pario-restore-")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+
+	m, err := extract(r, tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(m.Databases))
+	for _, e := range m.Databases {
+		found[e.Name] = true
+	}
+	for name := range targets {
+		if !found[name] {
+			return nil, fmt.Errorf("archive has no %q database", name)
+		}
+	}
+
+	for _, e := range m.Databases {
+		dst, ok := targets[e.Name]
+		if !ok {
+			continue
+		}
+		if err := restore(ctx, filepath.Join(tmp, e.File), dst); err != nil {
+			return nil, fmt.Errorf("restore %s: %w", e.Name, err)
+		}
+	}
+	return m, nil
+}
+
+// snapshot copies the database at src to dst with the online backup API.
+func snapshot(ctx context.Context, src, dst string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	return withConn(ctx, src, func(b backuper) (*sqlite.Backup, error) {
+		return b.NewBackup(dst)
+	})
+}
+
+// restore overwrites the database at dst with the contents of src.
+func restore(ctx context.Context, src, dst string) error {
+	if dir := filepath.Dir(dst); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("create %s: %w", dir, err)
+		}
+	}
+	return withConn(ctx, dst, func(b backuper) (*sqlite.Backup, error) {
+		return b.NewRestore(src)
+	})
+}
+
+func withConn(ctx context.Context, path string, start func(backuper) (*sqlite.Backup, error)) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	return conn.Raw(func(dc any) error {
+		b, ok := dc.(backuper)
+		if !ok {
+			return errors.New("sqlite driver does not support online backup")
+		}
+		bk, err := start(b)
+		if err != nil {
+			return err
+		}
+		for more := true; more; {
+			if more, err = bk.Step(-1); err != nil {
+				_ = bk.Finish()
+				return err
+			}
+		}
+		return bk.Finish()
+	})
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("write %s header: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
+
+func writeFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: name, Mode: 0o600, Size: fi.Size(), ModTime: fi.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("write %s header: %w", name, err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
+
+// extract unpacks the archive into dir and returns its manifest. Only files
+// named in the manifest are kept.
+func extract(r io.Reader, dir string) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("open archive: %w", err)
+	}
+	defer func() { _ = gz.Close() }()
+
+	var m *Manifest
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// Entries are flat; reject anything that could escape dir.
+		name := filepath.Base(hdr.Name)
+		if name != hdr.Name {
+			return nil, fmt.Errorf("unexpected archive entry %q", hdr.Name)
+		}
+
+		if name == manifestName {
+			m = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(m); err != nil {
+				return nil, fmt.Errorf("parse manifest: %w", err)
+			}
+			continue
+		}
+
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("extract %s: %w", name, err)
+		}
+	}
+
+	if m == nil {
+		return nil, errors.New("archive has no manifest")
+	}
+	for _, e := range m.Databases {
+		if filepath.Base(e.File) != e.File {
+			return nil, fmt.Errorf("unexpected manifest file %q", e.File)
+		}
+		if _, err := os.Stat(filepath.Join(dir, e.File)); err != nil {
+			return nil, fmt.Errorf("archive is missing %s", e.File)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,200 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pario-ai/pario/pkg/sigv4"
+)
+
+func seed(t *testing.T, path string, rows int) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`PRAGMA journal_mode=WAL; CREATE TABLE t (id INTEGER PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	for i := range rows {
+		if _, err := db.Exec(`INSERT INTO t (id) VALUES (?)`, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func count(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM t`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestCreateRestore(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	trackerPath := filepath.Join(dir, "pario.db")
+	auditPath := filepath.Join(dir, "audit.db")
+	trackerDB := seed(t, trackerPath, 10)
+	seed(t, auditPath, 3)
+
+	var buf bytes.Buffer
+	m, err := Create(ctx, &buf, []Database{{"tracker", trackerPath}, {"audit", auditPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Databases) != 2 || m.Databases[0].Name != "tracker" || m.Databases[0].Size == 0 {
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+	archive := buf.Bytes()
+
+	// Writes after the snapshot are rolled back by the restore.
+	if _, err := trackerDB.Exec(`DELETE FROM t`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Restore(ctx, bytes.NewReader(archive), map[string]string{"tracker": trackerPath}); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, trackerDB); n != 10 {
+		t.Errorf("tracker rows after restore = %d, want 10", n)
+	}
+
+	// Restoring into a fresh location creates the file.
+	fresh := filepath.Join(dir, "new", "audit.db")
+	if _, err := Restore(ctx, bytes.NewReader(archive), map[string]string{"audit": fresh}); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", fresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if n := count(t, db); n != 3 {
+		t.Errorf("audit rows after restore = %d, want 3", n)
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	path := filepath.Join(dir, "pario.db")
+	seed(t, path, 1)
+
+	var buf bytes.Buffer
+	if _, err := Create(ctx, &buf, []Database{{"tracker", path}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		archive []byte
+		targets map[string]string
+		wantErr string
+	}{
+		{"missing database", buf.Bytes(), map[string]string{"audit": path}, `no "audit" database`},
+		{"not an archive", []byte("nope"), map[string]string{"tracker": path}, "open archive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Restore(ctx, bytes.NewReader(tt.archive), tt.targets)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateMissingSource(t *testing.T) {
+	_, err := Create(context.Background(), io.Discard, []Database{{"tracker", filepath.Join(t.TempDir(), "missing.db")}})
+	if err == nil {
+		t.Fatal("expected error for missing database")
+	}
+}
+
+func TestParseS3(t *testing.T) {
+	tests := []struct {
+		in     string
+		bucket string
+		key    string
+		ok     bool
+	}{
+		{"s3://bkt/backups/pario.tar.gz", "bkt", "backups/pario.tar.gz", true},
+		{"s3://bkt", "", "", false},
+		{"s3:///key", "", "", false},
+		{"/tmp/pario.tar.gz", "", "", false},
+	}
+	for _, tt := range tests {
+		b, k, err := ParseS3(tt.in)
+		if (err == nil) != tt.ok || b != tt.bucket || k != tt.key {
+			t.Errorf("ParseS3(%q) = %q, %q, %v", tt.in, b, k, err)
+		}
+	}
+}
+
+func TestS3PutGet(t *testing.T) {
+	objects := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			if r.Header.Get("X-Amz-Content-Sha256") != sigv4.PayloadHash(body) {
+				http.Error(w, "bad hash", http.StatusBadRequest)
+				return
+			}
+			objects[r.URL.Path] = body
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				http.Error(w, "NoSuchKey", http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(body)
+		}
+	}))
+	defer srv.Close()
+
+	s := &S3{Endpoint: srv.URL, Credentials: sigv4.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}}
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "a.tar.gz")
+	if err := os.WriteFile(path, []byte("archive"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, "bkt", "nightly/a.tar.gz", path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objects["/bkt/nightly/a.tar.gz"]; !ok {
+		t.Fatalf("object not stored at path-style URL: %v", objects)
+	}
+
+	rc, err := s.Get(ctx, "bkt", "nightly/a.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != "archive" {
+		t.Errorf("Get = %q", got)
+	}
+
+	if _, err := s.Get(ctx, "bkt", "missing"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected 404 error, got %v", err)
+	}
+}
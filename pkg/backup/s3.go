@@ -0,0 +1,124 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/sigv4"
+)
+
+// S3 uploads and downloads archives from an S3-compatible bucket.
+type S3 struct {
+	// Region is the bucket region, e.g. "us-east-1".
+	Region string
+	// Endpoint overrides the AWS endpoint for S3-compatible stores such as
+	// MinIO or R2. When set, path-style addressing is used.
+	Endpoint    string
+	Credentials sigv4.Credentials
+	Client      *http.Client
+}
+
+// IsS3 reports whether dest is an s3:// URL.
+func IsS3(dest string) bool {
+	return strings.HasPrefix(dest, "s3://")
+}
+
+// ParseS3 splits an s3://bucket/key URL.
+func ParseS3(dest string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(dest, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("not an s3 URL: %s", dest)
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	if bucket == "" || key == "" {
+		return "", "", fmt.Errorf("s3 URL must be s3://bucket/key: %s", dest)
+	}
+	return bucket, key, nil
+}
+
+// Put uploads the file at path to bucket/key in a single request.
+func (s *S3) Put(ctx context.Context, bucket, key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return fmt.Errorf("hash archive: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(bucket, key), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/gzip")
+	resp, err := s.do(req, hex.EncodeToString(h.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// Get downloads bucket/key. The caller closes the returned body.
+func (s *S3) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(bucket, key), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req, sigv4.EmptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	sigv4.Sign(req, s.Credentials, s.region(), "s3", payloadHash, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s: %w", req.Method, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s: status %d: %s", req.Method, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (s *S3) region() string {
+	if s.Region == "" {
+		return "us-east-1"
+	}
+	return s.Region
+}
+
+func (s *S3) objectURL(bucket, key string) string {
+	escaped := (&url.URL{Path: key}).EscapedPath()
+	if s.Endpoint != "" {
+		return strings.TrimRight(s.Endpoint, "/") + "/" + bucket + "/" + escaped
+	}
+	return "https://" + bucket + ".s3." + s.region() + ".amazonaws.com/" + escaped
+}
@@ -0,0 +1,29 @@
+package budget
+
+import (
+	"context"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// carryover returns p with its limits raised by what was left unused of
+// them in the previous period, if p has carryover. used and usedUSD are
+// the usage counted against p since the start of the current period.
+func (e *Enforcer) carryover(ctx context.Context, apiKey string, p models.BudgetPolicy, since time.Time, used int64, usedUSD float64) (models.BudgetPolicy, error) {
+	if !p.Carryover {
+		return p, nil
+	}
+	prev := periodStart(p.Period, since.Add(-time.Nanosecond), e.location(apiKey))
+	total, totalUSD, err := e.usage(ctx, apiKey, p, prev)
+	if err != nil {
+		return p, err
+	}
+	if p.MaxTokens > 0 {
+		p.MaxTokens += max(p.MaxTokens-(total-used), 0)
+	}
+	if p.MaxCostUSD > 0 {
+		p.MaxCostUSD += max(p.MaxCostUSD-(totalUSD-usedUSD), 0)
+	}
+	return p, nil
+}
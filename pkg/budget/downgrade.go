@@ -0,0 +1,102 @@
+package budget
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// DowngradeMode is how a request's route should use its downgrade
+// targets.
+type DowngradeMode int
+
+const (
+	// NoDowngrade leaves the route as it is.
+	NoDowngrade DowngradeMode = iota
+	// PreferDowngrade puts downgrade targets first, for a key past a
+	// policy's downgrade_at. The other targets stay as fallbacks.
+	PreferDowngrade
+	// OnlyDowngrade keeps only downgrade targets, for a key over a policy
+	// with action downgrade.
+	OnlyDowngrade
+)
+
+// downgradableKey is the context key marking a request that can run on its
+// route's downgrade targets.
+type downgradableKey struct{}
+
+// ContextWithDowngrade marks a request as able to run on its route's
+// downgrade targets. Policies with action downgrade admit such a request
+// once exhausted, leaving it to be rerouted; others are blocked as usual.
+func ContextWithDowngrade(ctx context.Context) context.Context {
+	return context.WithValue(ctx, downgradableKey{}, true)
+}
+
+func downgradable(ctx context.Context) bool {
+	ok, _ := ctx.Value(downgradableKey{}).(bool)
+	return ok
+}
+
+// Downgrading reports how apiKey's requests for model should use their
+// route's downgrade targets: only them once a policy with action
+// downgrade is exhausted, or first once past a policy's downgrade_at. The
+// first downgrade per key, policy, and period is recorded as a budget
+// decision.
+func (e *Enforcer) Downgrading(ctx context.Context, requestID, apiKey, model string) (DowngradeMode, error) {
+	d, mode, err := e.downgrade(ctx, apiKey, model)
+	if err != nil || d == nil {
+		return NoDowngrade, err
+	}
+	d.RequestID = requestID
+	if e.firstWarning(apiKey, *d) {
+		if err := e.tracker.RecordDecision(ctx, *d); err != nil {
+			log.Printf("budget decision: %v", err)
+		}
+	}
+	return mode, nil
+}
+
+// WouldDowngrade is Downgrading without recording a decision, for
+// explaining how a request would be routed.
+func (e *Enforcer) WouldDowngrade(ctx context.Context, apiKey, model string) (DowngradeMode, error) {
+	_, mode, err := e.downgrade(ctx, apiKey, model)
+	return mode, err
+}
+
+// downgrade returns the downgrade decision and mode for the first policy
+// applicable to model with action downgrade that apiKey has exhausted or,
+// failing that, the first whose downgrade_at it is past. It returns nil if
+// there is neither.
+func (e *Enforcer) downgrade(ctx context.Context, apiKey, model string) (*models.BudgetDecision, DowngradeMode, error) {
+	var prefer *models.BudgetDecision
+	for _, p := range e.applicablePolicies(apiKey, model, labelsFrom(ctx)) {
+		if p.DowngradeAt <= 0 && p.Action != models.BudgetDowngrade {
+			continue
+		}
+		since := periodStart(p.Period, time.Now(), e.location(apiKey))
+		used, usedUSD, err := e.usage(ctx, apiKey, p, since)
+		if err != nil {
+			return nil, NoDowngrade, fmt.Errorf("budget downgrade check: %w", err)
+		}
+		if p, err = e.carryover(ctx, apiKey, p, since, used, usedUSD); err != nil {
+			return nil, NoDowngrade, fmt.Errorf("budget downgrade check: %w", err)
+		}
+		d := &models.BudgetDecision{
+			APIKey: apiKey, Model: model, Action: models.BudgetDowngrade,
+			Policy: p, Used: used, UsedUSD: usedUSD, PeriodStart: since, CreatedAt: time.Now().UTC(),
+		}
+		switch {
+		case p.Action == models.BudgetDowngrade && exhausted(p, used, usedUSD):
+			return d, OnlyDowngrade, nil
+		case prefer == nil && p.DowngradeAt > 0 && p.Fraction(used, usedUSD) >= p.DowngradeAt:
+			prefer = d
+		}
+	}
+	if prefer != nil {
+		return prefer, PreferDowngrade, nil
+	}
+	return nil, NoDowngrade, nil
+}
@@ -0,0 +1,82 @@
+package budget
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestDowngrading(t *testing.T) {
+	tr, ctx := setup(t)
+
+	_ = tr.Record(ctx, models.UsageRecord{
+		APIKey: "key1", Model: "gpt-4", TotalTokens: 700,
+		CreatedAt: time.Now().UTC(),
+	})
+
+	e := New([]models.BudgetPolicy{
+		{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily, DowngradeAt: 0.75},
+		{APIKey: "*", Model: "gpt-4o", MaxTokens: 100, Period: models.BudgetDaily},
+	}, tr)
+
+	if mode, err := e.Downgrading(ctx, "req_1", "key1", "gpt-4"); err != nil || mode != NoDowngrade {
+		t.Fatalf("under downgrade_at: Downgrading = %v, %v", mode, err)
+	}
+
+	_ = tr.Record(ctx, models.UsageRecord{
+		APIKey: "key1", Model: "gpt-4", TotalTokens: 100,
+		CreatedAt: time.Now().UTC(),
+	})
+	// WouldDowngrade leaves no decision behind, so req_2 still records one.
+	if mode, err := e.WouldDowngrade(ctx, "key1", "gpt-4"); err != nil || mode != PreferDowngrade {
+		t.Fatalf("past downgrade_at: WouldDowngrade = %v, %v", mode, err)
+	}
+	for _, id := range []string{"req_2", "req_3"} {
+		if mode, err := e.Downgrading(ctx, id, "key1", "gpt-4"); err != nil || mode != PreferDowngrade {
+			t.Fatalf("past downgrade_at: Downgrading = %v, %v", mode, err)
+		}
+	}
+	if mode, _ := e.Downgrading(ctx, "req_4", "key2", "gpt-4"); mode != NoDowngrade {
+		t.Error("other key should not be downgraded")
+	}
+	// Downgrading doesn't block, even once the limit is reached.
+	if err := e.Check(ctx, "key1", "gpt-4"); err != nil {
+		t.Errorf("check: %v", err)
+	}
+
+	decisions, err := tr.Decisions(ctx, models.BudgetDecisionQuery{Since: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != 1 || decisions[0].Action != models.BudgetDowngrade || decisions[0].RequestID != "req_2" || decisions[0].Used != 800 {
+		t.Errorf("expected one downgrade decision for req_2, got %+v", decisions)
+	}
+}
+
+func TestDowngradeAction(t *testing.T) {
+	tr, ctx := setup(t)
+	_ = tr.Record(ctx, models.UsageRecord{
+		APIKey: "key1", Model: "gpt-4", TotalTokens: 1200,
+		CreatedAt: time.Now().UTC(),
+	})
+	e := New([]models.BudgetPolicy{
+		{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily, Action: models.BudgetDowngrade},
+	}, tr)
+
+	// Only requests their route can downgrade get past the exhausted policy.
+	if err := e.Check(ctx, "key1", "gpt-4"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("without downgrade targets: err = %v, want exceeded", err)
+	}
+	down := ContextWithDowngrade(ctx)
+	if err := e.Check(down, "key1", "gpt-4"); err != nil {
+		t.Errorf("with downgrade targets: err = %v, want nil", err)
+	}
+	if mode, err := e.Downgrading(down, "req_1", "key1", "gpt-4"); err != nil || mode != OnlyDowngrade {
+		t.Errorf("Downgrading = %v, %v; want OnlyDowngrade", mode, err)
+	}
+	if mode, _ := e.WouldDowngrade(ctx, "key2", "gpt-4"); mode != NoDowngrade {
+		t.Errorf("key under its limit: WouldDowngrade = %v", mode)
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/pario-ai/pario/pkg/models"
@@ -13,97 +17,513 @@ import (
 // ErrBudgetExceeded is returned when a request exceeds the budget.
 var ErrBudgetExceeded = errors.New("budget exceeded")
 
+// ExceededError is the error Enforce and Admit return for a request a
+// policy blocks. It matches ErrBudgetExceeded with errors.Is.
+type ExceededError struct {
+	Policy models.BudgetPolicy
+	// ResetsAt is when the policy's current period ends and its usage
+	// starts again from zero.
+	ResetsAt time.Time
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%v: %s %s/%s", ErrBudgetExceeded, e.Policy.Subject(), e.Policy.FormatLimit(), e.Policy.Period)
+}
+
+// Is reports whether target is ErrBudgetExceeded.
+func (e *ExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
 // Enforcer checks token usage against budget policies.
 type Enforcer struct {
+	mu       sync.RWMutex
 	policies []models.BudgetPolicy
+	managed  []models.ManagedBudgetPolicy
 	tracker  tracker.Tracker
+	location func(apiKey string) *time.Location
+	pricing  map[string]models.ModelPricing
+
+	// warned holds the period start of the last warning or downgrade
+	// recorded per key and policy, so each is recorded once per period.
+	warnMu sync.Mutex
+	warned map[warnKey]time.Time
+
+	// queue holds requests of keys past a limit instead of rejecting them;
+	// see Admit.
+	queue   queueConfig
+	slotsMu sync.Mutex
+	slots   map[string]*keySlot
+
+	// reserved holds the tokens of admitted requests not yet recorded.
+	reserved reservations
+
+	patternMu sync.Mutex
+	patterns  map[string]*regexp.Regexp
+}
+
+// warnKey identifies a soft-limit warning or downgrade for one API key and
+// policy.
+type warnKey struct {
+	apiKey string
+	policy models.BudgetPolicy
+	action models.BudgetAction
+}
+
+// Option configures optional Enforcer behavior.
+type Option func(*Enforcer)
+
+// WithLocation sets the function used to resolve the timezone in which an API
+// key's daily and monthly periods start. The default is UTC for every key.
+func WithLocation(fn func(apiKey string) *time.Location) Option {
+	return func(e *Enforcer) {
+		if fn != nil {
+			e.location = fn
+		}
+	}
+}
+
+// WithPricing sets the model pricing used to estimate the spend of
+// in-flight reservations for policies with max_cost_usd. Recorded spend is
+// the cost stored on each usage record.
+func WithPricing(pricing []models.ModelPricing) Option {
+	return func(e *Enforcer) {
+		for _, p := range pricing {
+			e.pricing[p.Model] = p
+		}
+	}
+}
+
+// labelsKey is the context key for a request's attribution labels.
+type labelsKey struct{}
+
+// ContextWithLabels attaches a request's attribution labels to ctx, for the
+// label-scoped policies checked under it. Without them, only policies
+// scoped to API keys apply.
+func ContextWithLabels(ctx context.Context, labels models.CostLabel) context.Context {
+	return context.WithValue(ctx, labelsKey{}, labels)
+}
+
+func labelsFrom(ctx context.Context) models.CostLabel {
+	labels, _ := ctx.Value(labelsKey{}).(models.CostLabel)
+	return labels
 }
 
 // New creates an Enforcer with the given policies and tracker.
-func New(policies []models.BudgetPolicy, t tracker.Tracker) *Enforcer {
-	return &Enforcer{policies: policies, tracker: t}
+func New(policies []models.BudgetPolicy, t tracker.Tracker, opts ...Option) *Enforcer {
+	e := &Enforcer{
+		policies: policies,
+		tracker:  t,
+		location: func(string) *time.Location { return time.UTC },
+		pricing:  make(map[string]models.ModelPricing),
+		warned:   make(map[warnKey]time.Time),
+		slots:    make(map[string]*keySlot),
+		reserved: reservations{inflight: make(map[*reservation]struct{}), locks: make(map[string]*keyLock)},
+		patterns: make(map[string]*regexp.Regexp),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// SetPolicies replaces the enforced policies. Checks already in progress
+// finish against the previous set.
+func (e *Enforcer) SetPolicies(policies []models.BudgetPolicy) {
+	e.mu.Lock()
+	e.policies = policies
+	e.mu.Unlock()
+}
+
+// SetManaged replaces the managed policies layered over the configured
+// ones. While active, a managed policy replaces every configured policy
+// with the same scope.
+func (e *Enforcer) SetManaged(managed []models.ManagedBudgetPolicy) {
+	e.mu.Lock()
+	e.managed = managed
+	e.mu.Unlock()
+}
+
+// Managed returns the managed policies, expired ones included.
+func (e *Enforcer) Managed() []models.ManagedBudgetPolicy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.managed
+}
+
+// currentPolicies returns the configured policies with the active managed
+// policies layered over them.
+func (e *Enforcer) currentPolicies() []models.BudgetPolicy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if len(e.managed) == 0 {
+		return e.policies
+	}
+	now := time.Now()
+	var active []models.BudgetPolicy
+	for _, m := range e.managed {
+		if m.Active(now) {
+			active = append(active, m.BudgetPolicy)
+		}
+	}
+	result := make([]models.BudgetPolicy, 0, len(e.policies)+len(active))
+	for _, p := range e.policies {
+		if !slices.ContainsFunc(active, p.SameScope) {
+			result = append(result, p)
+		}
+	}
+	return append(result, active...)
 }
 
 // Check returns ErrBudgetExceeded if the API key has exceeded any applicable policy.
 func (e *Enforcer) Check(ctx context.Context, apiKey, model string) error {
-	for _, p := range e.applicablePolicies(apiKey, model) {
-		since := periodStart(p.Period)
-		var used int64
-		var err error
-		if p.Model != "" {
-			used, err = e.tracker.TotalByKeyAndModel(ctx, apiKey, p.Model, since)
-		} else {
-			used, err = e.tracker.TotalByKey(ctx, apiKey, since)
+	decisions, _, err := e.decide(ctx, apiKey, model)
+	if err != nil {
+		return err
+	}
+	if blocked(decisions) {
+		return ErrBudgetExceeded
+	}
+	return nil
+}
+
+// Enforce is Check for a live request. It also records the block, and the
+// first soft-limit warning per policy and period, as budget decisions.
+// Failing to record a decision doesn't change the outcome.
+func (e *Enforcer) Enforce(ctx context.Context, requestID, apiKey, model string) error {
+	decisions, _, err := e.decide(ctx, apiKey, model)
+	if err != nil {
+		return err
+	}
+	return e.record(ctx, requestID, apiKey, decisions)
+}
+
+// record stores decisions for a request and returns an ExceededError if
+// they end in a block.
+func (e *Enforcer) record(ctx context.Context, requestID, apiKey string, decisions []models.BudgetDecision) error {
+	now := time.Now().UTC()
+	for _, d := range decisions {
+		if d.Action == models.BudgetWarn && !e.firstWarning(apiKey, d) {
+			continue
+		}
+		d.RequestID = requestID
+		d.CreatedAt = now
+		if err := e.tracker.RecordDecision(ctx, d); err != nil {
+			log.Printf("budget decision: %v", err)
 		}
+	}
+	if blocked(decisions) {
+		d := decisions[len(decisions)-1]
+		return &ExceededError{Policy: d.Policy, ResetsAt: periodEnd(d.Policy.Period, d.PeriodStart, e.location(apiKey))}
+	}
+	return nil
+}
+
+// decide evaluates the policies applicable to a request, counting the
+// reservations of requests in flight as used. It returns a warn
+// decision for each policy past its soft limit and, if one is exhausted,
+// ends with a block decision for it. Unless the request is blocked it
+// also returns the status of the most restrictive policy, as Headroom
+// does but counting reservations; nil if no policy applies.
+func (e *Enforcer) decide(ctx context.Context, apiKey, model string) ([]models.BudgetDecision, *models.BudgetStatus, error) {
+	var decisions []models.BudgetDecision
+	var tightest *models.BudgetStatus
+	now := time.Now()
+	loc := e.location(apiKey)
+	for _, p := range e.applicablePolicies(apiKey, model, labelsFrom(ctx)) {
+		since := periodStart(p.Period, now, loc)
+		used, usedUSD, err := e.usage(ctx, apiKey, p, since)
 		if err != nil {
-			return fmt.Errorf("budget check: %w", err)
+			return nil, nil, fmt.Errorf("budget check: %w", err)
+		}
+		if p, err = e.carryover(ctx, apiKey, p, since, used, usedUSD); err != nil {
+			return nil, nil, fmt.Errorf("budget check: %w", err)
 		}
-		if used >= p.MaxTokens {
-			return ErrBudgetExceeded
+		reserved, reservedUSD := e.reservedFor(apiKey, p)
+		used, usedUSD = used+reserved, usedUSD+reservedUSD
+		if st := newStatus(p, used, usedUSD, since, loc, now); tightest == nil || st.UsedFraction() > tightest.UsedFraction() {
+			tightest = &st
+		}
+		d := models.BudgetDecision{APIKey: apiKey, Model: model, Policy: p, Used: used, UsedUSD: usedUSD, PeriodStart: since}
+		switch {
+		case exhausted(p, used, usedUSD) && p.Action == models.BudgetDowngrade && downgradable(ctx):
+			// Rerouted instead; Downgrading records the downgrade.
+			continue
+		case exhausted(p, used, usedUSD):
+			d.Action = models.BudgetBlock
+			return append(decisions, d), nil, nil
+		case p.WarnAt > 0 && p.Fraction(used, usedUSD) >= p.WarnAt:
+			d.Action = models.BudgetWarn
+			decisions = append(decisions, d)
 		}
 	}
-	return nil
+	return decisions, tightest, nil
 }
 
-// Status returns the budget status for an API key across all applicable policies.
+// usage returns the tokens and, for policies with max_cost_usd, the
+// estimated spend counted against p since the start of its period: the
+// recorded usage plus manual adjustments with the policy's scope.
+func (e *Enforcer) usage(ctx context.Context, apiKey string, p models.BudgetPolicy, since time.Time) (int64, float64, error) {
+	tokens, usd, err := e.recorded(ctx, apiKey, p, since)
+	if err != nil {
+		return 0, 0, err
+	}
+	key, labels := apiKey, p.Labels()
+	if p.LabelScoped() {
+		key = ""
+	}
+	adjTokens, adjUSD, err := e.tracker.AdjustmentTotal(ctx, key, labels, p.Model, since)
+	if err != nil {
+		return 0, 0, err
+	}
+	return tokens + adjTokens, usd + adjUSD, nil
+}
+
+// recorded returns the recorded usage counted against p since a given
+// time. A label-scoped policy counts the usage of every key carrying its
+// labels, and a model pattern the usage of every model it matches.
+func (e *Enforcer) recorded(ctx context.Context, apiKey string, p models.BudgetPolicy, since time.Time) (int64, float64, error) {
+	model, pattern := p.Model, e.modelPattern(p.Model)
+	if pattern != nil {
+		model = "" // usage is grouped by model and filtered by spend
+	}
+	if p.LabelScoped() {
+		rows, err := e.tracker.SpendByLabels(ctx, p.Labels(), model, since)
+		tokens, usd := e.spend(rows, pattern)
+		return tokens, usd, err
+	}
+	if p.MaxCostUSD > 0 || pattern != nil {
+		rows, err := e.tracker.SpendByKey(ctx, apiKey, model, since)
+		tokens, usd := e.spend(rows, pattern)
+		return tokens, usd, err
+	}
+	if p.Model != "" {
+		used, err := e.tracker.TotalByKeyAndModel(ctx, apiKey, p.Model, since)
+		return used, 0, err
+	}
+	used, err := e.tracker.TotalByKey(ctx, apiKey, since)
+	return used, 0, err
+}
+
+// spend totals the tokens and stored spend of usage grouped by model,
+// counting only the models pattern matches unless it is nil.
+func (e *Enforcer) spend(rows []models.CostReport, pattern *regexp.Regexp) (int64, float64) {
+	var tokens int64
+	var usd float64
+	for _, r := range rows {
+		if pattern != nil && !pattern.MatchString(r.Model) {
+			continue
+		}
+		tokens += r.TotalTokens
+		usd += r.EstimatedCost
+	}
+	return tokens, usd
+}
+
+// exhausted reports whether usage has reached any of p's limits, allowing
+// for its grace.
+func exhausted(p models.BudgetPolicy, used int64, usedUSD float64) bool {
+	grace := 1 + p.Grace
+	return (p.LimitsTokens() && float64(used) >= float64(p.MaxTokens)*grace) ||
+		(p.MaxCostUSD > 0 && usedUSD >= p.MaxCostUSD*grace)
+}
+
+// blocked reports whether decisions end in a block.
+func blocked(decisions []models.BudgetDecision) bool {
+	return len(decisions) > 0 && decisions[len(decisions)-1].Action == models.BudgetBlock
+}
+
+// firstWarning reports whether d is the first decision of its action for
+// its key and policy in the current period, and remembers it. The keys
+// sharing a label-scoped policy share its decisions.
+func (e *Enforcer) firstWarning(apiKey string, d models.BudgetDecision) bool {
+	if d.Policy.LabelScoped() {
+		apiKey = ""
+	}
+	k := warnKey{apiKey: apiKey, policy: d.Policy, action: d.Action}
+	e.warnMu.Lock()
+	defer e.warnMu.Unlock()
+	if e.warned[k].Equal(d.PeriodStart) {
+		return false
+	}
+	e.warned[k] = d.PeriodStart
+	return true
+}
+
+// Status returns the budget status for an API key across all applicable
+// policies, including label-scoped ones matching labels attached with
+// ContextWithLabels.
 func (e *Enforcer) Status(ctx context.Context, apiKey string) ([]models.BudgetStatus, error) {
-	policies := e.policiesForKey(apiKey)
-	statuses := make([]models.BudgetStatus, 0, len(policies))
+	return e.status(ctx, apiKey, e.policiesForKey(apiKey, labelsFrom(ctx)))
+}
 
-	for _, p := range policies {
-		since := periodStart(p.Period)
-		var used int64
-		var err error
-		if p.Model != "" {
-			used, err = e.tracker.TotalByKeyAndModel(ctx, apiKey, p.Model, since)
-		} else {
-			used, err = e.tracker.TotalByKey(ctx, apiKey, since)
+// LabelStatus returns the budget status of every label-scoped policy. Its
+// periods start in the default location.
+func (e *Enforcer) LabelStatus(ctx context.Context) ([]models.BudgetStatus, error) {
+	var policies []models.BudgetPolicy
+	for _, p := range e.currentPolicies() {
+		if p.LabelScoped() {
+			policies = append(policies, p)
+		}
+	}
+	return e.status(ctx, "", policies)
+}
+
+// Headroom returns the status of the most restrictive policy applicable
+// to a request for model: the one with the largest fraction of its limit
+// used. It returns nil if no policy applies.
+func (e *Enforcer) Headroom(ctx context.Context, apiKey, model string) (*models.BudgetStatus, error) {
+	statuses, err := e.status(ctx, apiKey, e.applicablePolicies(apiKey, model, labelsFrom(ctx)))
+	if err != nil {
+		return nil, err
+	}
+	var tightest *models.BudgetStatus
+	for i := range statuses {
+		if tightest == nil || statuses[i].UsedFraction() > tightest.UsedFraction() {
+			tightest = &statuses[i]
 		}
+	}
+	return tightest, nil
+}
+
+func (e *Enforcer) status(ctx context.Context, apiKey string, policies []models.BudgetPolicy) ([]models.BudgetStatus, error) {
+	statuses := make([]models.BudgetStatus, 0, len(policies))
+	now := time.Now()
+	for _, p := range policies {
+		loc := e.location(apiKey)
+		since := periodStart(p.Period, now, loc)
+		used, usedUSD, err := e.usage(ctx, apiKey, p, since)
 		if err != nil {
 			return nil, fmt.Errorf("budget status: %w", err)
 		}
-		remaining := p.MaxTokens - used
-		if remaining < 0 {
-			remaining = 0
+		if p, err = e.carryover(ctx, apiKey, p, since, used, usedUSD); err != nil {
+			return nil, fmt.Errorf("budget status: %w", err)
 		}
-		statuses = append(statuses, models.BudgetStatus{
-			Policy:    p,
-			Used:      used,
-			Remaining: remaining,
-		})
+		statuses = append(statuses, newStatus(p, used, usedUSD, since, loc, now))
 	}
 	return statuses, nil
 }
 
-// policiesForKey returns all policies matching an API key (ignoring model filter).
-func (e *Enforcer) policiesForKey(apiKey string) []models.BudgetPolicy {
+// newStatus returns p's status given its usage in the period starting at
+// since.
+func newStatus(p models.BudgetPolicy, used int64, usedUSD float64, since time.Time, loc *time.Location, now time.Time) models.BudgetStatus {
+	st := models.BudgetStatus{
+		Policy:      p,
+		Used:        used,
+		Remaining:   max(p.MaxTokens-used, 0),
+		PeriodStart: since,
+		PeriodEnd:   periodEnd(p.Period, since, loc),
+	}
+	if p.MaxCostUSD > 0 {
+		st.UsedUSD = usedUSD
+		st.RemainingUSD = max(p.MaxCostUSD-usedUSD, 0)
+	}
+	burndown(&st, now)
+	return st
+}
+
+// burndown fills in the elapsed fraction of the period and projects when the
+// budget runs out at the average rate since the period began.
+func burndown(st *models.BudgetStatus, now time.Time) {
+	length := st.PeriodEnd.Sub(st.PeriodStart)
+	elapsed := now.Sub(st.PeriodStart)
+	if length <= 0 || elapsed <= 0 {
+		return
+	}
+	st.Elapsed = min(float64(elapsed)/float64(length), 1)
+	used := st.UsedFraction()
+	if used <= 0 || used >= 1 || st.Exhausted() {
+		return
+	}
+	at := st.PeriodStart.Add(time.Duration(float64(elapsed) / used))
+	if at.Before(st.PeriodEnd) {
+		st.ExhaustsAt = at.UTC()
+	}
+}
+
+// policiesForKey returns all policies matching an API key and labels (ignoring model filter).
+func (e *Enforcer) policiesForKey(apiKey string, labels models.CostLabel) []models.BudgetPolicy {
 	var result []models.BudgetPolicy
-	for _, p := range e.policies {
-		if p.APIKey == "*" || p.APIKey == apiKey {
+	for _, p := range e.currentPolicies() {
+		if p.AppliesTo(apiKey, labels) {
 			result = append(result, p)
 		}
 	}
 	return result
 }
 
-func (e *Enforcer) applicablePolicies(apiKey, model string) []models.BudgetPolicy {
+func (e *Enforcer) applicablePolicies(apiKey, model string, labels models.CostLabel) []models.BudgetPolicy {
 	var result []models.BudgetPolicy
-	for _, p := range e.policies {
-		if p.APIKey == "*" || p.APIKey == apiKey {
-			if p.Model == "" || p.Model == model {
-				result = append(result, p)
-			}
+	for _, p := range e.policiesForKey(apiKey, labels) {
+		if e.matchesModel(p.Model, model) {
+			result = append(result, p)
 		}
 	}
 	return result
 }
 
-func periodStart(period models.BudgetPeriod) time.Time {
-	now := time.Now().UTC()
+// matchesModel reports whether a policy's model filter, a model name or
+// pattern, admits model. An empty filter admits every model.
+func (e *Enforcer) matchesModel(filter, model string) bool {
+	if filter == "" || filter == model {
+		return true
+	}
+	re := e.modelPattern(filter)
+	return re != nil && re.MatchString(model)
+}
+
+// modelPattern returns the compiled model pattern of a policy's model
+// filter, or nil if it isn't a pattern. Compiled patterns are cached. An
+// invalid pattern, which config validation rejects, matches nothing.
+func (e *Enforcer) modelPattern(filter string) *regexp.Regexp {
+	if !models.IsModelPattern(filter) {
+		return nil
+	}
+	e.patternMu.Lock()
+	defer e.patternMu.Unlock()
+	re, ok := e.patterns[filter]
+	if !ok {
+		var err error
+		if re, err = models.CompileModelPattern(filter); err != nil {
+			log.Printf("budget: invalid model pattern %q: %v", filter, err)
+			re = regexp.MustCompile(`[^\s\S]`)
+		}
+		e.patterns[filter] = re
+	}
+	return re
+}
+
+// CounterPeriods returns the daily and monthly periods containing at in
+// loc, the periods tracker usage counters are kept for.
+func CounterPeriods(at time.Time, loc *time.Location) []tracker.CounterPeriod {
+	periods := make([]tracker.CounterPeriod, 0, 2)
+	for _, p := range []models.BudgetPeriod{models.BudgetDaily, models.BudgetMonthly} {
+		start := periodStart(p, at, loc)
+		periods = append(periods, tracker.CounterPeriod{Start: start, End: periodEnd(p, start, loc)})
+	}
+	return periods
+}
+
+// periodEnd returns the start of the period after the one beginning at start.
+func periodEnd(period models.BudgetPeriod, start time.Time, loc *time.Location) time.Time {
+	start = start.In(loc)
+	switch period {
+	case models.BudgetMonthly:
+		return start.AddDate(0, 1, 0).UTC()
+	default: // daily
+		return start.AddDate(0, 0, 1).UTC()
+	}
+}
+
+// periodStart returns the start of the period containing now, computed at
+// local midnight in loc. The result is converted to UTC because usage
+// timestamps are stored in UTC.
+func periodStart(period models.BudgetPeriod, now time.Time, loc *time.Location) time.Time {
+	now = now.In(loc)
 	switch period {
 	case models.BudgetMonthly:
-		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc).UTC()
 	default: // daily
-		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc).UTC()
 	}
 }
@@ -2,11 +2,13 @@ package budget
 
 import (
 	"context"
+	"errors"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/queue"
 	"github.com/pario-ai/pario/pkg/tracker"
 )
 
@@ -180,3 +182,554 @@ func TestPerModelPolicyNotAppliedToOtherModels(t *testing.T) {
 		t.Errorf("expected no error for claude-haiku, got %v", err)
 	}
 }
+
+func TestModelPatternBudget(t *testing.T) {
+	tr, ctx := setup(t)
+	now := time.Now().UTC()
+
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "o3", PromptTokens: 300, TotalTokens: 300, CreatedAt: now})
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "o3-mini", PromptTokens: 300, TotalTokens: 300, CreatedAt: now})
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4o-mini", PromptTokens: 5000, TotalTokens: 5000, CreatedAt: now})
+
+	tests := []struct {
+		name    string
+		policy  models.BudgetPolicy
+		model   string
+		blocked bool
+	}{
+		{"glob sums matching models", models.BudgetPolicy{APIKey: "*", Model: "o3*", MaxTokens: 500, Period: models.BudgetDaily}, "o3-pro", true},
+		{"glob under limit", models.BudgetPolicy{APIKey: "*", Model: "o3*", MaxTokens: 1000, Period: models.BudgetDaily}, "o3", false},
+		{"glob skips other models", models.BudgetPolicy{APIKey: "*", Model: "o3*", MaxTokens: 500, Period: models.BudgetDaily}, "gpt-4o-mini", false},
+		{"regexp", models.BudgetPolicy{APIKey: "*", Model: "~^o[0-9]$", MaxTokens: 300, Period: models.BudgetDaily}, "o3", true},
+		{"pattern spend skips other models", models.BudgetPolicy{APIKey: "*", Model: "o3*", MaxCostUSD: 0.04, Period: models.BudgetDaily}, "o3", false},
+	}
+	pricing := WithPricing([]models.ModelPricing{{Model: "o3", PromptCost: 0.1}, {Model: "gpt-4o-mini", PromptCost: 1}})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New([]models.BudgetPolicy{tt.policy}, tr, pricing)
+			err := e.Check(ctx, "key1", tt.model)
+			if blocked := err == ErrBudgetExceeded; blocked != tt.blocked {
+				t.Errorf("blocked = %v (err %v), want %v", blocked, err, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestPeriodStartTimezone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("tzdata not available")
+	}
+	// 2026-03-31 20:00 UTC is already 2026-04-01 05:00 in Tokyo.
+	now := time.Date(2026, 3, 31, 20, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		period models.BudgetPeriod
+		loc    *time.Location
+		want   time.Time
+	}{
+		{"daily utc", models.BudgetDaily, time.UTC, time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{"monthly utc", models.BudgetMonthly, time.UTC, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"daily tokyo", models.BudgetDaily, tokyo, time.Date(2026, 3, 31, 15, 0, 0, 0, time.UTC)},
+		{"monthly tokyo", models.BudgetMonthly, tokyo, time.Date(2026, 3, 31, 15, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := periodStart(tt.period, now, tt.loc)
+			if !got.Equal(tt.want) {
+				t.Errorf("periodStart = %v, want %v", got, tt.want)
+			}
+			if got.Location() != time.UTC {
+				t.Errorf("expected UTC result, got %v", got.Location())
+			}
+		})
+	}
+}
+
+func TestWithLocation(t *testing.T) {
+	tr, ctx := setup(t)
+
+	// Usage recorded just before the current local day started in a zone far
+	// ahead of UTC must not count against the daily budget there.
+	loc := time.FixedZone("UTC+14", 14*3600)
+	localMidnight := periodStart(models.BudgetDaily, time.Now(), loc)
+	_ = tr.Record(ctx, models.UsageRecord{
+		APIKey: "key1", Model: "gpt-4",
+		PromptTokens: 500, CompletionTokens: 600, TotalTokens: 1100,
+		CreatedAt: localMidnight.Add(-time.Minute),
+	})
+
+	policies := []models.BudgetPolicy{
+		{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily},
+	}
+
+	e := New(policies, tr, WithLocation(func(string) *time.Location { return loc }))
+	if err := e.Check(ctx, "key1", ""); err != nil {
+		t.Errorf("expected no error in UTC+14, got %v", err)
+	}
+}
+
+func TestPeriodEnd(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("tzdata not available")
+	}
+	tests := []struct {
+		name   string
+		period models.BudgetPeriod
+		start  time.Time
+		loc    *time.Location
+		want   time.Time
+	}{
+		{"daily utc", models.BudgetDaily, time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC), time.UTC, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"monthly utc", models.BudgetMonthly, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), time.UTC, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		// 2026-03-08 is 23 hours long in New York.
+		{"daily dst", models.BudgetDaily, time.Date(2026, 3, 8, 5, 0, 0, 0, time.UTC), ny, time.Date(2026, 3, 9, 4, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := periodEnd(tt.period, tt.start, tt.loc); !got.Equal(tt.want) {
+				t.Errorf("periodEnd = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBurndown(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	now := start.Add(6 * time.Hour) // a quarter of the day
+
+	tests := []struct {
+		name        string
+		used        int64
+		max         int64
+		wantExhaust time.Time
+	}{
+		{"on pace", 200, 1000, time.Time{}},
+		{"sprinting", 500, 1000, start.Add(12 * time.Hour)},
+		{"exhausted", 1200, 1000, time.Time{}},
+		{"idle", 0, 1000, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := models.BudgetStatus{
+				Policy:      models.BudgetPolicy{MaxTokens: tt.max},
+				Used:        tt.used,
+				Remaining:   max(tt.max-tt.used, 0),
+				PeriodStart: start,
+				PeriodEnd:   end,
+			}
+			burndown(&st, now)
+			if st.Elapsed != 0.25 {
+				t.Errorf("Elapsed = %v, want 0.25", st.Elapsed)
+			}
+			if !st.ExhaustsAt.Equal(tt.wantExhaust) {
+				t.Errorf("ExhaustsAt = %v, want %v", st.ExhaustsAt, tt.wantExhaust)
+			}
+		})
+	}
+}
+
+func TestEnforceRecordsDecisions(t *testing.T) {
+	tr, ctx := setup(t)
+
+	_ = tr.Record(ctx, models.UsageRecord{
+		APIKey: "key1", Model: "gpt-4", TotalTokens: 850,
+		CreatedAt: time.Now().UTC(),
+	})
+
+	e := New([]models.BudgetPolicy{
+		{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily, WarnAt: 0.8},
+	}, tr)
+
+	// Check never records; the soft limit is recorded once per period.
+	if err := e.Check(ctx, "key1", "gpt-4"); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	for _, id := range []string{"req_1", "req_2"} {
+		if err := e.Enforce(ctx, id, "key1", "gpt-4"); err != nil {
+			t.Fatalf("enforce under hard limit: %v", err)
+		}
+	}
+
+	_ = tr.Record(ctx, models.UsageRecord{
+		APIKey: "key1", Model: "gpt-4", TotalTokens: 200,
+		CreatedAt: time.Now().UTC(),
+	})
+	for _, id := range []string{"req_3", "req_4"} {
+		err := e.Enforce(ctx, id, "key1", "gpt-4")
+		var exceeded *ExceededError
+		if !errors.As(err, &exceeded) || !errors.Is(err, ErrBudgetExceeded) {
+			t.Fatalf("enforce over hard limit = %v, want ErrBudgetExceeded", err)
+		}
+		if want := periodEnd(models.BudgetDaily, periodStart(models.BudgetDaily, time.Now(), time.UTC), time.UTC); !exceeded.ResetsAt.Equal(want) {
+			t.Errorf("resets at %v, want %v", exceeded.ResetsAt, want)
+		}
+	}
+
+	decisions, err := tr.Decisions(ctx, models.BudgetDecisionQuery{Since: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range decisions {
+		got = append(got, d.RequestID+":"+string(d.Action))
+	}
+	want := []string{"req_4:block", "req_3:block", "req_1:warn"}
+	if len(got) != len(want) {
+		t.Fatalf("decisions = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("decisions = %v, want %v", got, want)
+			break
+		}
+	}
+	if d := decisions[0]; d.Used != 1050 || d.Policy.MaxTokens != 1000 || d.Model != "gpt-4" {
+		t.Errorf("block snapshot = %+v", d)
+	}
+}
+
+func TestCostLimit(t *testing.T) {
+	tr, ctx := setup(t)
+	now := time.Now().UTC()
+
+	// $0.03 in tokens plus $0.04 of images.
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", PromptTokens: 1000, TotalTokens: 1000, EstimatedCostUSD: 0.03, CreatedAt: now})
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "dall-e-3", Images: 1, MediaCostUSD: 0.04, EstimatedCostUSD: 0.04, CreatedAt: now})
+
+	pricing := WithPricing([]models.ModelPricing{{Model: "gpt-4", PromptCost: 0.03}})
+	tests := []struct {
+		name    string
+		policy  models.BudgetPolicy
+		blocked bool
+	}{
+		{"under spend limit", models.BudgetPolicy{APIKey: "*", MaxCostUSD: 0.10, Period: models.BudgetDaily}, false},
+		{"over spend limit", models.BudgetPolicy{APIKey: "*", MaxCostUSD: 0.07, Period: models.BudgetDaily}, true},
+		{"model spend limit", models.BudgetPolicy{APIKey: "*", Model: "dall-e-3", MaxCostUSD: 0.05, Period: models.BudgetDaily}, false},
+		{"token limit with spend limit", models.BudgetPolicy{APIKey: "*", MaxTokens: 500, MaxCostUSD: 1, Period: models.BudgetDaily}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New([]models.BudgetPolicy{tt.policy}, tr, pricing)
+			err := e.Check(ctx, "key1", tt.policy.Model)
+			if blocked := err == ErrBudgetExceeded; blocked != tt.blocked {
+				t.Errorf("blocked = %v (err %v), want %v", blocked, err, tt.blocked)
+			}
+		})
+	}
+
+	e := New([]models.BudgetPolicy{{APIKey: "*", MaxCostUSD: 0.10, Period: models.BudgetDaily}}, tr, pricing)
+	statuses, err := e.Status(ctx, "key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := statuses[0]; st.UsedUSD < 0.0699 || st.UsedUSD > 0.0701 || st.RemainingUSD < 0.0299 || st.Exhausted() {
+		t.Errorf("status = %+v", st)
+	}
+}
+
+func TestLabelPolicy(t *testing.T) {
+	tr, ctx := setup(t)
+	now := time.Now().UTC()
+
+	// Two keys share the ml team's budget; a third belongs to another team.
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", TotalTokens: 600, Team: "ml", Env: "prod", CreatedAt: now})
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key2", Model: "gpt-4", TotalTokens: 500, Team: "ml", Env: "dev", CreatedAt: now})
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key3", Model: "gpt-4", TotalTokens: 100, Team: "web", CreatedAt: now})
+
+	ml := models.CostLabel{Team: "ml"}
+	tests := []struct {
+		name    string
+		policy  models.BudgetPolicy
+		labels  models.CostLabel
+		blocked bool
+	}{
+		{"pooled across keys", models.BudgetPolicy{Team: "ml", MaxTokens: 1000, Period: models.BudgetDaily}, ml, true},
+		{"under pooled limit", models.BudgetPolicy{Team: "ml", MaxTokens: 2000, Period: models.BudgetDaily}, ml, false},
+		{"other team", models.BudgetPolicy{Team: "ml", MaxTokens: 1000, Period: models.BudgetDaily}, models.CostLabel{Team: "web"}, false},
+		{"no labels", models.BudgetPolicy{Team: "ml", MaxTokens: 1000, Period: models.BudgetDaily}, models.CostLabel{}, false},
+		{"all labels must match", models.BudgetPolicy{Team: "ml", Env: "prod", MaxTokens: 600, Period: models.BudgetDaily}, models.CostLabel{Team: "ml", Env: "dev"}, false},
+		{"team and env", models.BudgetPolicy{Team: "ml", Env: "prod", MaxTokens: 600, Period: models.BudgetDaily}, models.CostLabel{Team: "ml", Env: "prod"}, true},
+		{"env only", models.BudgetPolicy{Env: "dev", MaxTokens: 500, Period: models.BudgetDaily}, models.CostLabel{Env: "dev"}, true},
+		{"env only, other env", models.BudgetPolicy{Env: "dev", MaxTokens: 500, Period: models.BudgetDaily}, models.CostLabel{Env: "prod"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New([]models.BudgetPolicy{tt.policy}, tr)
+			// key3 has used almost nothing itself; only the labels count.
+			err := e.Check(ContextWithLabels(ctx, tt.labels), "key3", "gpt-4")
+			if blocked := err == ErrBudgetExceeded; blocked != tt.blocked {
+				t.Errorf("blocked = %v (err %v), want %v", blocked, err, tt.blocked)
+			}
+		})
+	}
+
+	e := New([]models.BudgetPolicy{
+		{APIKey: "*", MaxTokens: 5000, Period: models.BudgetDaily},
+		{Team: "ml", MaxTokens: 2000, Period: models.BudgetDaily},
+	}, tr)
+	statuses, err := e.Status(ContextWithLabels(ctx, ml), "key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].Used != 600 || statuses[1].Used != 1100 {
+		t.Errorf("key status = %+v, want key usage 600 and team usage 1100", statuses)
+	}
+	statuses, err = e.LabelStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Policy.Team != "ml" || statuses[0].Remaining != 900 {
+		t.Errorf("label status = %+v, want the ml policy with 900 remaining", statuses)
+	}
+}
+
+func TestGrace(t *testing.T) {
+	tr, ctx := setup(t)
+	e := New([]models.BudgetPolicy{
+		{APIKey: "*", MaxTokens: 1000, Grace: 0.1, Period: models.BudgetDaily},
+	}, tr)
+
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", TotalTokens: 1050, CreatedAt: time.Now().UTC()})
+	if err := e.Check(ctx, "key1", "gpt-4"); err != nil {
+		t.Errorf("within grace: %v", err)
+	}
+	statuses, err := e.Status(ctx, "key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Remaining != 0 || statuses[0].Policy.MaxTokens != 1000 {
+		t.Errorf("status = %+v, want the limit itself used up", statuses)
+	}
+
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", TotalTokens: 50, CreatedAt: time.Now().UTC()})
+	if err := e.Check(ctx, "key1", "gpt-4"); err != ErrBudgetExceeded {
+		t.Errorf("past grace: err = %v, want ErrBudgetExceeded", err)
+	}
+}
+
+func TestCarryover(t *testing.T) {
+	tr, ctx := setup(t)
+	today := periodStart(models.BudgetDaily, time.Now(), time.UTC)
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", TotalTokens: 300, CreatedAt: today.Add(-time.Hour)})
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", TotalTokens: 1500, CreatedAt: time.Now().UTC()})
+	// key2 overspent yesterday, which carries nothing and takes nothing.
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key2", Model: "gpt-4", TotalTokens: 2000, CreatedAt: today.Add(-time.Hour)})
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key2", Model: "gpt-4", TotalTokens: 900, CreatedAt: time.Now().UTC()})
+
+	tests := []struct {
+		name      string
+		apiKey    string
+		carryover bool
+		blocked   bool
+		limit     int64
+	}{
+		{"without carryover", "key1", false, true, 1000},
+		{"unused budget carried over", "key1", true, false, 1700},
+		{"overspend not carried", "key2", true, false, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New([]models.BudgetPolicy{
+				{APIKey: "*", MaxTokens: 1000, Carryover: tt.carryover, Period: models.BudgetDaily},
+			}, tr)
+			err := e.Check(ctx, tt.apiKey, "gpt-4")
+			if blocked := err == ErrBudgetExceeded; blocked != tt.blocked {
+				t.Errorf("blocked = %v (err %v), want %v", blocked, err, tt.blocked)
+			}
+			statuses, err := e.Status(ctx, tt.apiKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(statuses) != 1 || statuses[0].Policy.MaxTokens != tt.limit {
+				t.Errorf("status = %+v, want limit %d", statuses, tt.limit)
+			}
+		})
+	}
+}
+
+func TestHeadroom(t *testing.T) {
+	tr, ctx := setup(t)
+	now := time.Now().UTC()
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", TotalTokens: 600, CreatedAt: now})
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "haiku", TotalTokens: 300, CreatedAt: now})
+
+	tests := []struct {
+		name     string
+		policies []models.BudgetPolicy
+		model    string
+		want     int // index of the policy reported, -1 for none
+	}{
+		{"no policies", nil, "gpt-4", -1},
+		{"other model only", []models.BudgetPolicy{{APIKey: "*", Model: "haiku", MaxTokens: 1000, Period: models.BudgetDaily}}, "gpt-4", -1},
+		{"single policy", []models.BudgetPolicy{{APIKey: "*", MaxTokens: 10000, Period: models.BudgetDaily}}, "gpt-4", 0},
+		{"model limit tighter", []models.BudgetPolicy{
+			{APIKey: "*", MaxTokens: 10000, Period: models.BudgetDaily},
+			{APIKey: "key1", Model: "gpt-4", MaxTokens: 1000, Period: models.BudgetDaily},
+		}, "gpt-4", 1},
+		{"overall limit tighter", []models.BudgetPolicy{
+			{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily},
+			{APIKey: "key1", Model: "gpt-4", MaxTokens: 5000, Period: models.BudgetDaily},
+		}, "gpt-4", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New(tt.policies, tr)
+			st, err := e.Headroom(ctx, "key1", tt.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Admit reports the same policy from its own check.
+			release, admitted, err := e.Admit(ctx, "req", "key1", tt.model, queue.Normal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			release()
+			if tt.want < 0 {
+				if st != nil || admitted != nil {
+					t.Errorf("Headroom = %+v, Admit headroom = %+v; want nil", st, admitted)
+				}
+				return
+			}
+			if st == nil || st.Policy != tt.policies[tt.want] {
+				t.Fatalf("Headroom = %+v, want policy %+v", st, tt.policies[tt.want])
+			}
+			if admitted == nil || admitted.Policy != st.Policy || admitted.Used != st.Used {
+				t.Errorf("Admit headroom = %+v, want %+v", admitted, st)
+			}
+		})
+	}
+
+	st, _ := New([]models.BudgetPolicy{{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily}}, tr).Headroom(ctx, "key1", "gpt-4")
+	if st.Used != 900 || st.Remaining != 100 {
+		t.Errorf("used %d, remaining %d; want 900 and 100", st.Used, st.Remaining)
+	}
+}
+
+func TestAdjustments(t *testing.T) {
+	dir := t.TempDir()
+	tr, err := tracker.New(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tr.Close() })
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", TotalTokens: 1200, Team: "ml", CreatedAt: now})
+	e := New([]models.BudgetPolicy{
+		{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily},
+		{Team: "ml", MaxTokens: 1000, Period: models.BudgetDaily},
+	}, tr)
+	mlCtx := ContextWithLabels(ctx, models.CostLabel{Team: "ml"})
+	if err := e.Check(ctx, "key1", "gpt-4"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("before credit: err = %v, want exceeded", err)
+	}
+
+	// Crediting the key frees its own policy but not the team's.
+	if _, err := tr.RecordAdjustment(ctx, models.BudgetAdjustment{APIKey: "key1", Tokens: -500}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Check(ctx, "key1", "gpt-4"); err != nil {
+		t.Errorf("after key credit: err = %v, want nil", err)
+	}
+	if err := e.Check(mlCtx, "key1", "gpt-4"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("team policy: err = %v, want exceeded", err)
+	}
+
+	if _, err := tr.RecordAdjustment(ctx, models.BudgetAdjustment{Team: "ml", Tokens: -1200}); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := e.Status(mlCtx, "key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].Used != 700 || statuses[1].Used != 0 || statuses[1].Remaining != 1000 {
+		t.Errorf("statuses = %+v, want key usage 700 and team usage 0", statuses)
+	}
+}
+
+func TestReservations(t *testing.T) {
+	tr, ctx := setup(t)
+	e := New([]models.BudgetPolicy{
+		{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily},
+		{Team: "ml", MaxTokens: 1100, Period: models.BudgetDaily},
+	}, tr)
+	reserve := ContextWithReservation(ctx, 600)
+
+	// Nothing is recorded yet, but two in-flight requests have reserved
+	// more than the key's limit.
+	releaseA, _, err := e.Admit(reserve, "a", "key1", "gpt-4", queue.Normal)
+	if err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	releaseB, _, err := e.Admit(reserve, "b", "key1", "gpt-4", queue.Normal)
+	if err != nil {
+		t.Fatalf("second request: %v", err)
+	}
+	if _, _, err := e.Admit(reserve, "c", "key1", "gpt-4", queue.Normal); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("third request: err = %v, want exceeded", err)
+	}
+	// Other keys have their own reservations.
+	releaseD, _, err := e.Admit(reserve, "d", "key2", "gpt-4", queue.Normal)
+	if err != nil {
+		t.Fatalf("other key: %v", err)
+	}
+	releaseD()
+
+	// A team policy counts the reservations of every key carrying its labels.
+	ml := ContextWithLabels(reserve, models.CostLabel{Team: "ml"})
+	releaseE, _, err := e.Admit(ml, "e", "key3", "gpt-4", queue.Normal)
+	if err != nil {
+		t.Fatalf("team request: %v", err)
+	}
+	releaseF, _, err := e.Admit(ml, "f", "key4", "gpt-4", queue.Normal)
+	if err != nil {
+		t.Fatalf("second team request: %v", err)
+	}
+	if err := e.Check(ml, "key5", "gpt-4"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("team check: err = %v, want exceeded", err)
+	}
+	releaseE()
+	releaseF()
+
+	releaseA()
+	releaseB()
+	release, _, err := e.Admit(reserve, "g", "key1", "gpt-4", queue.Normal)
+	if err != nil {
+		t.Fatalf("after release: %v", err)
+	}
+	release()
+}
+
+func TestManagedPolicies(t *testing.T) {
+	tr, ctx := setup(t)
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", TotalTokens: 500, CreatedAt: time.Now().UTC()})
+
+	configured := models.BudgetPolicy{APIKey: "*", MaxTokens: 100, Period: models.BudgetDaily}
+	raised := models.BudgetPolicy{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily}
+	tests := []struct {
+		name    string
+		managed []models.ManagedBudgetPolicy
+		blocked bool
+	}{
+		{"none", nil, true},
+		{"replaces same scope", []models.ManagedBudgetPolicy{{BudgetPolicy: raised}}, false},
+		{"active until expiry", []models.ManagedBudgetPolicy{{BudgetPolicy: raised, ExpiresAt: time.Now().Add(time.Hour)}}, false},
+		{"expired", []models.ManagedBudgetPolicy{{BudgetPolicy: raised, ExpiresAt: time.Now().Add(-time.Second)}}, true},
+		{"other scope adds", []models.ManagedBudgetPolicy{{BudgetPolicy: models.BudgetPolicy{APIKey: "*", MaxTokens: 1000, Period: models.BudgetMonthly}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New([]models.BudgetPolicy{configured}, tr)
+			e.SetManaged(tt.managed)
+			err := e.Check(ctx, "key1", "gpt-4")
+			if blocked := err == ErrBudgetExceeded; blocked != tt.blocked {
+				t.Errorf("blocked = %v (err %v), want %v", blocked, err, tt.blocked)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/queue"
+)
+
+var (
+	// ErrQueueFull is returned by Admit when a key's queue is full and
+	// holds no lower-priority request to make room.
+	ErrQueueFull = errors.New("budget queue full")
+	// ErrLowPriorityShed is returned by Admit for a low-priority request
+	// from a key past a soft limit, when low-priority shedding is on.
+	ErrLowPriorityShed = errors.New("low-priority request shed near budget limit")
+)
+
+// queuePoll is how often the request at the head of a key's queue
+// re-checks an exhausted budget.
+const queuePoll = time.Second
+
+type queueConfig struct {
+	maxQueue int
+	maxWait  time.Duration
+	shedLow  bool
+}
+
+// WithQueue makes Admit queue requests instead of rejecting them outright:
+// once a key is past a policy's soft limit its requests are admitted one
+// at a time, highest priority first, and a request that finds the budget
+// exhausted waits up to maxWait for it to free up. At most maxQueue
+// requests wait per key; when full, a newer request evicts the newest
+// waiter of a lower priority. A zero maxWait disables queueing.
+func WithQueue(maxQueue int, maxWait time.Duration) Option {
+	return func(e *Enforcer) {
+		e.queue.maxQueue, e.queue.maxWait = maxQueue, maxWait
+	}
+}
+
+// WithLowPriorityShedding rejects low-priority requests from a key once it
+// is past a policy's soft limit, leaving the rest of the budget to normal
+// and high-priority traffic.
+func WithLowPriorityShedding() Option {
+	return func(e *Enforcer) {
+		e.queue.shedLow = true
+	}
+}
+
+// keySlot serializes the requests of one key while it is past a soft
+// limit.
+type keySlot struct {
+	q       *queue.Queue
+	waiting int // requests queued or holding the slot
+}
+
+// Admit is Enforce with queueing and priorities. A key under all of its
+// soft limits, or an Enforcer without WithQueue, is checked as by Enforce
+// (after low-priority shedding, if enabled). Otherwise the request waits
+// its turn in the key's queue and, while the budget is exhausted, for the
+// budget to free up, e.g. at the start of a new period or after a reload
+// raises the limit. It returns an ExceededError if that takes longer than
+// the queue's max wait and ErrQueueFull if the request can't be queued or
+// is evicted by a higher-priority one. Tokens reserved with
+// ContextWithReservation are held from admission until release. On
+// success the caller must call release once the request's usage is
+// recorded, so the next request in the queue sees it. Admit also returns
+// the status of the most restrictive policy applicable to the request as
+// of its admission, counting requests in flight, from the same pass as
+// the check; nil if no policy applies.
+func (e *Enforcer) Admit(ctx context.Context, requestID, apiKey, model string, p queue.Priority) (release func(), headroom *models.BudgetStatus, err error) {
+	decisions, headroom, res, err := e.decideAndReserve(ctx, apiKey, model)
+	if err != nil {
+		return nil, nil, err
+	}
+	if e.queue.shedLow && p == queue.Low && len(decisions) > 0 {
+		e.unreserve(res)
+		if !blocked(decisions) {
+			decisions = denied(decisions, models.BudgetShed)
+		}
+		// An exhausted budget is reported as such.
+		if err := e.record(ctx, requestID, apiKey, decisions); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrLowPriorityShed
+	}
+	if e.queue.maxWait <= 0 || len(decisions) == 0 {
+		if err := e.record(ctx, requestID, apiKey, decisions); err != nil {
+			e.unreserve(res)
+			return nil, nil, err
+		}
+		return func() { e.unreserve(res) }, headroom, nil
+	}
+	// Reserved again once it is this request's turn.
+	e.unreserve(res)
+
+	waitCtx, cancel := context.WithTimeout(ctx, e.queue.maxWait)
+	defer cancel()
+	ks := e.joinQueue(apiKey)
+	held, err := ks.q.Acquire(waitCtx, p)
+	if err != nil {
+		e.leaveQueue(apiKey, ks)
+		switch {
+		case errors.Is(err, queue.ErrShed):
+			_ = e.record(ctx, requestID, apiKey, denied(decisions, models.BudgetQueueFull))
+			return nil, nil, ErrQueueFull
+		case ctx.Err() != nil:
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, e.record(ctx, requestID, apiKey, decisions)
+	}
+	leave := func() {
+		held()
+		e.leaveQueue(apiKey, ks)
+	}
+
+	for {
+		// Re-check: requests ahead of this one may have used up the budget.
+		decisions, headroom, res, err = e.decideAndReserve(ctx, apiKey, model)
+		if err != nil {
+			leave()
+			return nil, nil, err
+		}
+		if !blocked(decisions) {
+			break
+		}
+		select {
+		case <-time.After(queuePoll):
+			continue
+		case <-waitCtx.Done():
+		}
+		if ctx.Err() != nil {
+			leave()
+			return nil, nil, ctx.Err()
+		}
+		err = e.record(ctx, requestID, apiKey, decisions)
+		leave()
+		return nil, nil, err
+	}
+	release = func() {
+		e.unreserve(res)
+		leave()
+	}
+	if err := e.record(ctx, requestID, apiKey, decisions); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return release, headroom, nil
+}
+
+// denied ends decisions with a denial of the given action for the policy
+// of the last of them, replacing a block.
+func denied(decisions []models.BudgetDecision, action models.BudgetAction) []models.BudgetDecision {
+	if len(decisions) == 0 {
+		return decisions
+	}
+	d := decisions[len(decisions)-1]
+	d.Action = action
+	if blocked(decisions) {
+		return append(decisions[:len(decisions)-1:len(decisions)-1], d)
+	}
+	return append(decisions, d)
+}
+
+// joinQueue counts a request against apiKey's queue, creating it if
+// needed.
+func (e *Enforcer) joinQueue(apiKey string) *keySlot {
+	e.slotsMu.Lock()
+	defer e.slotsMu.Unlock()
+	ks := e.slots[apiKey]
+	if ks == nil {
+		ks = &keySlot{q: queue.New(queue.Options{MaxConcurrent: 1, MaxQueue: e.queue.maxQueue})}
+		e.slots[apiKey] = ks
+	}
+	ks.waiting++
+	return ks
+}
+
+func (e *Enforcer) leaveQueue(apiKey string, ks *keySlot) {
+	e.slotsMu.Lock()
+	defer e.slotsMu.Unlock()
+	ks.waiting--
+	if ks.waiting == 0 {
+		delete(e.slots, apiKey)
+	}
+}
@@ -0,0 +1,190 @@
+package budget
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/queue"
+)
+
+func TestAdmitWithoutQueue(t *testing.T) {
+	tr, ctx := setup(t)
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", TotalTokens: 1100, CreatedAt: time.Now().UTC()})
+
+	e := New([]models.BudgetPolicy{{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily}}, tr)
+	if _, _, err := e.Admit(ctx, "req-1", "key1", "", queue.Normal); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("err = %v, want ErrBudgetExceeded", err)
+	}
+	release, _, err := e.Admit(ctx, "req-2", "key2", "", queue.Normal)
+	if err != nil {
+		t.Fatalf("key under budget: %v", err)
+	}
+	release()
+}
+
+func TestAdmitSerializesPastSoftLimit(t *testing.T) {
+	tr, ctx := setup(t)
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", TotalTokens: 600, CreatedAt: time.Now().UTC()})
+
+	e := New([]models.BudgetPolicy{{APIKey: "*", MaxTokens: 1000, WarnAt: 0.5, Period: models.BudgetDaily}}, tr,
+		WithQueue(10, time.Minute))
+
+	first, _, err := e.Admit(ctx, "req-1", "key1", "", queue.Normal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admitted := make(chan func())
+	go func() {
+		release, _, err := e.Admit(ctx, "req-2", "key1", "", queue.Normal)
+		if err != nil {
+			t.Error(err)
+		}
+		admitted <- release
+	}()
+
+	select {
+	case <-admitted:
+		t.Fatal("second request admitted while the first held the key's slot")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Other keys are unaffected.
+	other, _, err := e.Admit(ctx, "req-3", "key2", "", queue.Normal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other()
+
+	first()
+	select {
+	case release := <-admitted:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("second request not admitted after the first released")
+	}
+}
+
+func TestAdmitWaitsForBudget(t *testing.T) {
+	tr, ctx := setup(t)
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", TotalTokens: 1100, CreatedAt: time.Now().UTC()})
+
+	e := New([]models.BudgetPolicy{{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily}}, tr,
+		WithQueue(10, 5*time.Second))
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		e.SetPolicies([]models.BudgetPolicy{{APIKey: "*", MaxTokens: 5000, Period: models.BudgetDaily}})
+	}()
+	release, _, err := e.Admit(ctx, "req-1", "key1", "", queue.Normal)
+	if err != nil {
+		t.Fatalf("expected admission once the limit was raised, got %v", err)
+	}
+	release()
+}
+
+func TestAdmitQueueLimits(t *testing.T) {
+	tr, ctx := setup(t)
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", TotalTokens: 1100, CreatedAt: time.Now().UTC()})
+
+	e := New([]models.BudgetPolicy{{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily}}, tr,
+		WithQueue(1, 300*time.Millisecond))
+
+	// Two requests fit: one polling the exhausted budget, one behind it.
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, _, err := e.Admit(ctx, "req", "key1", "", queue.Normal)
+			errs <- err
+		}()
+		time.Sleep(50 * time.Millisecond)
+	}
+	if _, _, err := e.Admit(ctx, "req-full", "key1", "", queue.Normal); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("third request: err = %v, want ErrQueueFull", err)
+	}
+	// The denial is recorded with the policy that queued the request.
+	denials, err := tr.Decisions(ctx, models.BudgetDecisionQuery{Action: models.BudgetQueueFull})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(denials) != 1 || denials[0].RequestID != "req-full" || denials[0].Policy.MaxTokens != 1000 {
+		t.Errorf("queue_full decisions = %+v, want one for req-full", denials)
+	}
+	for range 2 {
+		if err := <-errs; !errors.Is(err, ErrBudgetExceeded) {
+			t.Errorf("after max wait: err = %v, want ErrBudgetExceeded", err)
+		}
+	}
+
+	e.slotsMu.Lock()
+	defer e.slotsMu.Unlock()
+	if len(e.slots) != 0 {
+		t.Errorf("queue state leaked: %v", e.slots)
+	}
+}
+
+func TestAdmitPriorityOrder(t *testing.T) {
+	tr, ctx := setup(t)
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", TotalTokens: 600, CreatedAt: time.Now().UTC()})
+
+	e := New([]models.BudgetPolicy{{APIKey: "*", MaxTokens: 1000, WarnAt: 0.5, Period: models.BudgetDaily}}, tr,
+		WithQueue(10, time.Minute))
+
+	first, _, err := e.Admit(ctx, "req-1", "key1", "", queue.Normal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := make(chan queue.Priority, 2)
+	for _, p := range []queue.Priority{queue.Low, queue.High} {
+		go func() {
+			release, _, err := e.Admit(ctx, "req-"+p.String(), "key1", "", p)
+			order <- p
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			release()
+		}()
+		time.Sleep(50 * time.Millisecond)
+	}
+	first()
+	if got := <-order; got != queue.High {
+		t.Errorf("first admitted after release: %s, want high", got)
+	}
+	<-order
+}
+
+func TestAdmitShedsLowPriority(t *testing.T) {
+	tr, ctx := setup(t)
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "key1", Model: "gpt-4", TotalTokens: 900, CreatedAt: time.Now().UTC()})
+
+	e := New([]models.BudgetPolicy{{APIKey: "*", MaxTokens: 1000, WarnAt: 0.8, Period: models.BudgetDaily}}, tr,
+		WithLowPriorityShedding())
+
+	tests := []struct {
+		key     string
+		p       queue.Priority
+		wantErr error
+	}{
+		{"key1", queue.Low, ErrLowPriorityShed},
+		{"key1", queue.Normal, nil},
+		{"key2", queue.Low, nil}, // under its soft limit
+	}
+	for _, tt := range tests {
+		release, _, err := e.Admit(ctx, "req", tt.key, "", tt.p)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s %s: err = %v, want %v", tt.key, tt.p, err, tt.wantErr)
+		}
+		if release != nil {
+			release()
+		}
+	}
+	denials, err := tr.Decisions(ctx, models.BudgetDecisionQuery{Denied: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(denials) != 1 || denials[0].Action != models.BudgetShed || denials[0].APIKey != "key1" {
+		t.Errorf("denials = %+v, want one shed for key1", denials)
+	}
+}
@@ -0,0 +1,128 @@
+package budget
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// reservation holds the tokens an admitted request may still use, so
+// concurrent requests can't all pass the check before any usage is
+// recorded.
+type reservation struct {
+	apiKey string
+	labels models.CostLabel
+	model  string
+	tokens int64
+}
+
+// reservations tracks in-flight reservations, and serializes the check and
+// reservation of each key's requests.
+type reservations struct {
+	mu       sync.Mutex
+	inflight map[*reservation]struct{}
+	locks    map[string]*keyLock
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// reserveKey is the context key for the tokens a request reserves.
+type reserveKey struct{}
+
+// ContextWithReservation attaches the tokens a request may use, usually
+// its max_tokens, to ctx. While Admit's caller holds the request, they
+// count against its policies as if already used. Zero reserves nothing.
+func ContextWithReservation(ctx context.Context, tokens int64) context.Context {
+	return context.WithValue(ctx, reserveKey{}, tokens)
+}
+
+func reservationFrom(ctx context.Context) int64 {
+	tokens, _ := ctx.Value(reserveKey{}).(int64)
+	return tokens
+}
+
+// decideAndReserve is decide, reserving the request's tokens unless it is
+// blocked. Requests of the same key are decided one at a time so each sees
+// the reservations of those before it. It returns a nil reservation when
+// nothing was reserved.
+func (e *Enforcer) decideAndReserve(ctx context.Context, apiKey, model string) ([]models.BudgetDecision, *models.BudgetStatus, *reservation, error) {
+	tokens := reservationFrom(ctx)
+	if tokens <= 0 {
+		decisions, tightest, err := e.decide(ctx, apiKey, model)
+		return decisions, tightest, nil, err
+	}
+	unlock := e.lockKey(apiKey)
+	defer unlock()
+	decisions, tightest, err := e.decide(ctx, apiKey, model)
+	if err != nil || blocked(decisions) {
+		return decisions, tightest, nil, err
+	}
+	res := &reservation{apiKey: apiKey, labels: labelsFrom(ctx), model: model, tokens: tokens}
+	e.reserved.mu.Lock()
+	e.reserved.inflight[res] = struct{}{}
+	e.reserved.mu.Unlock()
+	return decisions, tightest, res, nil
+}
+
+// unreserve drops a reservation made by decideAndReserve.
+func (e *Enforcer) unreserve(res *reservation) {
+	if res == nil {
+		return
+	}
+	e.reserved.mu.Lock()
+	delete(e.reserved.inflight, res)
+	e.reserved.mu.Unlock()
+}
+
+// reservedFor returns the tokens, and their estimated cost at completion
+// prices, reserved by in-flight requests that count against p for apiKey.
+func (e *Enforcer) reservedFor(apiKey string, p models.BudgetPolicy) (int64, float64) {
+	e.reserved.mu.Lock()
+	defer e.reserved.mu.Unlock()
+	var tokens int64
+	var usd float64
+	for res := range e.reserved.inflight {
+		if p.LabelScoped() {
+			if !p.AppliesTo(res.apiKey, res.labels) {
+				continue
+			}
+		} else if res.apiKey != apiKey {
+			continue
+		}
+		if !e.matchesModel(p.Model, res.model) {
+			continue
+		}
+		tokens += res.tokens
+		if price, ok := e.pricing[res.model]; ok {
+			usd += price.Cost(0, res.tokens)
+		}
+	}
+	return tokens, usd
+}
+
+// lockKey locks apiKey's reservations and returns the unlock function.
+func (e *Enforcer) lockKey(apiKey string) (unlock func()) {
+	e.reserved.mu.Lock()
+	kl := e.reserved.locks[apiKey]
+	if kl == nil {
+		kl = &keyLock{}
+		e.reserved.locks[apiKey] = kl
+	}
+	kl.refs++
+	e.reserved.mu.Unlock()
+
+	kl.mu.Lock()
+	return func() {
+		kl.mu.Unlock()
+		e.reserved.mu.Lock()
+		kl.refs--
+		if kl.refs == 0 {
+			delete(e.reserved.locks, apiKey)
+		}
+		e.reserved.mu.Unlock()
+	}
+}
@@ -0,0 +1,95 @@
+package budget
+
+import (
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// Simulate replays records against hypothetical policies as if they had been
+// enforced, and reports per policy and API key how many
+// requests would have been blocked. A label-scoped policy pools the usage of
+// every key carrying its labels, as Check does. A blocked request consumes no budget, so
+// later requests in the same period see the same usage Check would have.
+// Grace and carryover apply as for Check, except that a period carries
+// nothing over unless the previous one has records in the window.
+// Records must be ordered oldest first, as returned by QuerySince. Imported
+// records are skipped since they were never proxied requests.
+// loc resolves the timezone in which a key's periods start; nil means UTC.
+func Simulate(policies []models.BudgetPolicy, records []models.UsageRecord, loc func(apiKey string) *time.Location) []models.BudgetSimulation {
+	if loc == nil {
+		loc = func(string) *time.Location { return time.UTC }
+	}
+
+	type periodKey struct {
+		apiKey string
+		start  time.Time
+	}
+
+	var results []models.BudgetSimulation
+	for _, p := range policies {
+		byKey := make(map[string]*models.BudgetSimulation)
+		used := make(map[periodKey]int64)
+		blockedPeriods := make(map[periodKey]bool)
+		var pattern *regexp.Regexp
+		if models.IsModelPattern(p.Model) {
+			var err error
+			if pattern, err = models.CompileModelPattern(p.Model); err != nil {
+				continue
+			}
+		}
+
+		for _, rec := range records {
+			labels := models.CostLabel{Team: rec.Team, Project: rec.Project, Env: rec.Env}
+			if rec.Imported || !p.AppliesTo(rec.APIKey, labels) {
+				continue
+			}
+			if p.Model != "" && p.Model != rec.Model && (pattern == nil || !pattern.MatchString(rec.Model)) {
+				continue
+			}
+			sim, ok := byKey[rec.APIKey]
+			if !ok {
+				sim = &models.BudgetSimulation{Policy: p, APIKey: rec.APIKey}
+				byKey[rec.APIKey] = sim
+			}
+			sim.Requests++
+
+			pk := periodKey{rec.APIKey, periodStart(p.Period, rec.CreatedAt, loc(rec.APIKey))}
+			if p.LabelScoped() {
+				pk.apiKey = ""
+			}
+			limit := p.MaxTokens
+			if p.Carryover {
+				prev := periodKey{pk.apiKey, periodStart(p.Period, pk.start.Add(-time.Nanosecond), loc(rec.APIKey))}
+				if prevUsed, ok := used[prev]; ok {
+					limit += max(p.MaxTokens-prevUsed, 0)
+				}
+			}
+			if float64(used[pk]) >= float64(limit)*(1+p.Grace) {
+				sim.Blocked++
+				sim.BlockedTokens += int64(rec.TotalTokens)
+				if sim.FirstBlockedAt.IsZero() {
+					sim.FirstBlockedAt = rec.CreatedAt
+				}
+				if !blockedPeriods[pk] {
+					blockedPeriods[pk] = true
+					sim.PeriodsBlocked++
+				}
+				continue
+			}
+			used[pk] += int64(rec.TotalTokens)
+		}
+
+		keys := make([]string, 0, len(byKey))
+		for k := range byKey {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			results = append(results, *byKey[k])
+		}
+	}
+	return results
+}
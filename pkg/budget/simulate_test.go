@@ -0,0 +1,119 @@
+package budget
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestSimulate(t *testing.T) {
+	day1 := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	records := []models.UsageRecord{
+		{APIKey: "k1", Model: "gpt-4", TotalTokens: 600, Team: "ml", CreatedAt: day1},
+		{APIKey: "k1", Model: "gpt-4", TotalTokens: 500, CreatedAt: day1.Add(time.Hour)},
+		{APIKey: "k1", Model: "gpt-4", TotalTokens: 100, CreatedAt: day1.Add(2 * time.Hour)},
+		{APIKey: "k1", Model: "gpt-3.5", TotalTokens: 900, CreatedAt: day1.Add(3 * time.Hour)},
+		{APIKey: "k2", Model: "gpt-4", TotalTokens: 200, Team: "ml", CreatedAt: day1},
+		{APIKey: "k1", Model: "gpt-4", TotalTokens: 300, CreatedAt: day2},
+		{APIKey: "imported:openai", Model: "gpt-4", TotalTokens: 5000, CreatedAt: day1, Imported: true},
+	}
+
+	tests := []struct {
+		name   string
+		policy models.BudgetPolicy
+		want   map[string]models.BudgetSimulation
+	}{
+		{
+			name:   "daily limit per key",
+			policy: models.BudgetPolicy{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily},
+			want: map[string]models.BudgetSimulation{
+				// 600 + 500 reaches the limit; the next two requests are blocked.
+				"k1": {Requests: 5, Blocked: 2, BlockedTokens: 1000, PeriodsBlocked: 1, FirstBlockedAt: day1.Add(2 * time.Hour)},
+				"k2": {Requests: 1},
+			},
+		},
+		{
+			name:   "grace",
+			policy: models.BudgetPolicy{APIKey: "*", MaxTokens: 1000, Grace: 0.2, Period: models.BudgetDaily},
+			want: map[string]models.BudgetSimulation{
+				// 1100 is past the limit but within the grace of 1200.
+				"k1": {Requests: 5, Blocked: 1, BlockedTokens: 900, PeriodsBlocked: 1, FirstBlockedAt: day1.Add(3 * time.Hour)},
+				"k2": {Requests: 1},
+			},
+		},
+		{
+			name:   "model scope",
+			policy: models.BudgetPolicy{APIKey: "k1", Model: "gpt-4", MaxTokens: 500, Period: models.BudgetMonthly},
+			want: map[string]models.BudgetSimulation{
+				"k1": {Requests: 4, Blocked: 3, BlockedTokens: 900, PeriodsBlocked: 1, FirstBlockedAt: day1.Add(time.Hour)},
+			},
+		},
+		{
+			name:   "model pattern",
+			policy: models.BudgetPolicy{APIKey: "k1", Model: "gpt-3*", MaxTokens: 500, Period: models.BudgetDaily},
+			want: map[string]models.BudgetSimulation{
+				"k1": {Requests: 1},
+			},
+		},
+		{
+			name:   "team pools keys",
+			policy: models.BudgetPolicy{Team: "ml", MaxTokens: 500, Period: models.BudgetDaily},
+			want: map[string]models.BudgetSimulation{
+				// k1's request uses up the team's budget, so k2's is blocked.
+				"k1": {Requests: 1},
+				"k2": {Requests: 1, Blocked: 1, BlockedTokens: 200, PeriodsBlocked: 1, FirstBlockedAt: day1},
+			},
+		},
+		{
+			name:   "never blocks",
+			policy: models.BudgetPolicy{APIKey: "k2", MaxTokens: 1000, Period: models.BudgetDaily},
+			want: map[string]models.BudgetSimulation{
+				"k2": {Requests: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Simulate([]models.BudgetPolicy{tt.policy}, records, nil)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d results, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for _, g := range got {
+				w, ok := tt.want[g.APIKey]
+				if !ok {
+					t.Errorf("unexpected key %q", g.APIKey)
+					continue
+				}
+				if g.Requests != w.Requests || g.Blocked != w.Blocked || g.BlockedTokens != w.BlockedTokens ||
+					g.PeriodsBlocked != w.PeriodsBlocked || !g.FirstBlockedAt.Equal(w.FirstBlockedAt) {
+					t.Errorf("%s: got %+v, want %+v", g.APIKey, g, w)
+				}
+			}
+		})
+	}
+}
+
+func TestSimulateTimezone(t *testing.T) {
+	// Two requests 2 hours apart straddle UTC midnight but fall on the same
+	// local day in New York.
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("tzdata not available")
+	}
+	base := time.Date(2025, 3, 10, 23, 0, 0, 0, time.UTC)
+	records := []models.UsageRecord{
+		{APIKey: "k1", TotalTokens: 100, CreatedAt: base},
+		{APIKey: "k1", TotalTokens: 100, CreatedAt: base.Add(2 * time.Hour)},
+	}
+	policy := models.BudgetPolicy{APIKey: "k1", MaxTokens: 100, Period: models.BudgetDaily}
+
+	if got := Simulate([]models.BudgetPolicy{policy}, records, nil); got[0].Blocked != 0 {
+		t.Errorf("UTC: expected no blocks, got %d", got[0].Blocked)
+	}
+	got := Simulate([]models.BudgetPolicy{policy}, records, func(string) *time.Location { return ny })
+	if got[0].Blocked != 1 {
+		t.Errorf("New York: expected 1 block, got %d", got[0].Blocked)
+	}
+}
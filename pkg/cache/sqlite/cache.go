@@ -1,6 +1,7 @@
 package sqlite
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/json"
@@ -10,6 +11,7 @@ import (
 
 	_ "modernc.org/sqlite"
 
+	"github.com/pario-ai/pario/pkg/dbmaint"
 	"github.com/pario-ai/pario/pkg/models"
 )
 
@@ -32,6 +34,11 @@ CREATE TABLE IF NOT EXISTS cache_entries (
 );
 `
 
+// expiredCond matches entries past their TTL. created_at is written with
+// nanosecond precision, which julianday rejects, so only the seconds part is
+// compared.
+const expiredCond = `(julianday('now') - julianday(substr(created_at, 1, 19))) * 86400 > ttl_seconds`
+
 // New creates a Cache with the given database path and default TTL.
 func New(dbPath string, ttl time.Duration) (*Cache, error) {
 	db, err := sql.Open("sqlite", dbPath)
@@ -56,6 +63,41 @@ func HashPrompt(model string, messages []models.ChatMessage) string {
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
+// HashRequest computes the cache key of a chat completion request: the
+// HashPrompt of its model and messages, extended with the options that
+// change what the response contains (tools, response format, seed,
+// logprobs, sampling parameters, max tokens, system prompt) when any are
+// set.
+func HashRequest(req models.ChatCompletionRequest) string {
+	opts, _ := json.Marshal(struct {
+		Tools          json.RawMessage `json:"tools,omitempty"`
+		ToolChoice     json.RawMessage `json:"tool_choice,omitempty"`
+		Functions      json.RawMessage `json:"functions,omitempty"`
+		FunctionCall   json.RawMessage `json:"function_call,omitempty"`
+		ResponseFormat json.RawMessage `json:"response_format,omitempty"`
+		Seed           *int64          `json:"seed,omitempty"`
+		Logprobs       bool            `json:"logprobs,omitempty"`
+		TopLogprobs    *int            `json:"top_logprobs,omitempty"`
+		Temperature    *float64        `json:"temperature,omitempty"`
+		TopP           *float64        `json:"top_p,omitempty"`
+		N              *int            `json:"n,omitempty"`
+		MaxTokens      *int            `json:"max_tokens,omitempty"`
+		System         json.RawMessage `json:"system,omitempty"`
+	}{
+		req.Tools, req.ToolChoice, req.Functions, req.FunctionCall, req.ResponseFormat, req.Seed, req.Logprobs, req.TopLogprobs,
+		req.Temperature, req.TopP, req.N, req.MaxTokens, req.System,
+	})
+	if string(opts) == "{}" {
+		return HashPrompt(req.Model, req.Messages)
+	}
+	h := sha256.New()
+	h.Write([]byte(req.Model))
+	data, _ := json.Marshal(req.Messages)
+	h.Write(data)
+	h.Write(opts)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
 // Get retrieves a cached response. Returns nil if not found or expired.
 func (c *Cache) Get(promptHash, model string) ([]byte, bool) {
 	var response []byte
@@ -113,7 +155,7 @@ func (c *Cache) Stats() (models.CacheStats, error) {
 func (c *Cache) Clear(expiredOnly bool) error {
 	var query string
 	if expiredOnly {
-		query = `DELETE FROM cache_entries WHERE (julianday('now') - julianday(created_at)) * 86400 > ttl_seconds`
+		query = `DELETE FROM cache_entries WHERE ` + expiredCond
 	} else {
 		query = `DELETE FROM cache_entries`
 	}
@@ -124,6 +166,32 @@ func (c *Cache) Clear(expiredOnly bool) error {
 	return nil
 }
 
+// Prune deletes expired cache entries. With dryRun set it only reports what
+// would be deleted.
+func (c *Cache) Prune(ctx context.Context, dryRun bool) (dbmaint.PruneResult, error) {
+	return dbmaint.Prune(ctx, c.db, "cache_entries", expiredCond, dryRun)
+}
+
+// Maintain checkpoints, analyzes, and vacuums the cache database.
+func (c *Cache) Maintain(ctx context.Context) (dbmaint.Report, error) {
+	return dbmaint.Run(ctx, c.db)
+}
+
+// Vacuum checkpoints and vacuums the cache database.
+func (c *Cache) Vacuum(ctx context.Context) (dbmaint.Report, error) {
+	return dbmaint.Vacuum(ctx, c.db)
+}
+
+// Analyze refreshes the cache database's planner statistics.
+func (c *Cache) Analyze(ctx context.Context) (dbmaint.Report, error) {
+	return dbmaint.Analyze(ctx, c.db)
+}
+
+// DBStats reports the size of the cache database and its tables.
+func (c *Cache) DBStats(ctx context.Context) (dbmaint.Stats, error) {
+	return dbmaint.ReadStats(ctx, c.db)
+}
+
 // Close releases the database connection.
 func (c *Cache) Close() error {
 	return c.db.Close()
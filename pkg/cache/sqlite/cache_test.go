@@ -1,6 +1,8 @@
 package sqlite
 
 import (
+	"context"
+	"encoding/json"
 	"path/filepath"
 	"testing"
 	"time"
@@ -33,6 +35,34 @@ func TestHashPrompt(t *testing.T) {
 	}
 }
 
+func TestHashRequest(t *testing.T) {
+	msgs := []models.ChatMessage{{Role: "user", Content: "hello"}}
+	seed := int64(7)
+	temp, maxTokens := 0.0, 100
+	base := models.ChatCompletionRequest{Model: "gpt-4", Messages: msgs}
+
+	if HashRequest(base) != HashPrompt("gpt-4", msgs) {
+		t.Error("request without options should hash like its prompt")
+	}
+	seen := map[string]string{HashRequest(base): "base"}
+	for name, req := range map[string]models.ChatCompletionRequest{
+		"tools":           {Model: "gpt-4", Messages: msgs, Tools: []byte(`[{"type":"function"}]`)},
+		"response_format": {Model: "gpt-4", Messages: msgs, ResponseFormat: []byte(`{"type":"json_object"}`)},
+		"seed":            {Model: "gpt-4", Messages: msgs, Seed: &seed},
+		"logprobs":        {Model: "gpt-4", Messages: msgs, Logprobs: true},
+		"parts":           {Model: "gpt-4", Messages: []models.ChatMessage{{Role: "user", Parts: []byte(`[{"type":"text","text":"hello"}]`)}}},
+		"temperature":     {Model: "gpt-4", Messages: msgs, Temperature: &temp},
+		"max_tokens":      {Model: "gpt-4", Messages: msgs, MaxTokens: &maxTokens},
+		"system":          {Model: "gpt-4", Messages: msgs, System: []byte(`"Be terse."`)},
+	} {
+		h := HashRequest(req)
+		if other, ok := seen[h]; ok {
+			t.Errorf("%s hashes like %s", name, other)
+		}
+		seen[h] = name
+	}
+}
+
 func TestPutAndGet(t *testing.T) {
 	c := newTestCache(t, time.Hour)
 	hash := HashPrompt("gpt-4", []models.ChatMessage{{Role: "user", Content: "hi"}})
@@ -109,3 +139,77 @@ func TestClear(t *testing.T) {
 		t.Errorf("expected 0 entries after clear, got %d", stats.Entries)
 	}
 }
+
+func TestPrune(t *testing.T) {
+	c := newTestCache(t, 1*time.Millisecond)
+	ctx := context.Background()
+
+	if err := c.Put("expired", "gpt-4", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.db.Exec(`UPDATE cache_entries SET created_at = ?`, time.Now().Add(-time.Minute).UTC()); err != nil {
+		t.Fatal(err)
+	}
+	c.ttl = time.Hour
+	if err := c.Put("fresh", "gpt-4", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.Prune(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Rows != 1 {
+		t.Fatalf("dry run rows = %d, want 1", res.Rows)
+	}
+	if stats, _ := c.Stats(); stats.Entries != 2 {
+		t.Errorf("dry run deleted entries: %d left", stats.Entries)
+	}
+
+	if res, err = c.Prune(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if res.Rows != 1 || res.Bytes == 0 {
+		t.Errorf("prune = %+v, want 1 row with bytes", res)
+	}
+	if _, ok := c.Get("fresh", "gpt-4"); !ok {
+		t.Error("fresh entry was pruned")
+	}
+}
+
+func TestRules(t *testing.T) {
+	zero, one, half, two := 0.0, 1.0, 0.5, 2
+	tests := []struct {
+		name string
+		req  models.ChatCompletionRequest
+		want bool
+	}{
+		{"temperature 0", models.ChatCompletionRequest{Model: "gpt-4", Temperature: &zero}, true},
+		{"temperature 0 top_p 1", models.ChatCompletionRequest{Model: "gpt-4", Temperature: &zero, TopP: &one}, true},
+		{"default temperature", models.ChatCompletionRequest{Model: "gpt-4"}, false},
+		{"temperature 1", models.ChatCompletionRequest{Model: "gpt-4", Temperature: &one}, false},
+		{"top_p", models.ChatCompletionRequest{Model: "gpt-4", Temperature: &zero, TopP: &half}, false},
+		{"several choices", models.ChatCompletionRequest{Model: "gpt-4", Temperature: &zero, N: &two}, false},
+		{"tools", models.ChatCompletionRequest{Model: "gpt-4", Temperature: &zero, Tools: json.RawMessage(`[{}]`)}, false},
+		{"functions", models.ChatCompletionRequest{Model: "gpt-4", Temperature: &zero, Functions: json.RawMessage(`[{}]`)}, false},
+		{"exempt model", models.ChatCompletionRequest{Model: "gpt-3.5-turbo", Temperature: &one}, true},
+		{"exempt pattern", models.ChatCompletionRequest{Model: "claude-haiku-4", Tools: json.RawMessage(`[{}]`)}, true},
+	}
+
+	r, err := NewRules(true, []string{"gpt-3.5-turbo", "~^claude-haiku"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := r.Allow(tt.req); got != tt.want {
+			t.Errorf("%s: Allow = %v, want %v", tt.name, got, tt.want)
+		}
+		if !(Rules{}).Allow(tt.req) {
+			t.Errorf("%s: zero Rules rejected the request", tt.name)
+		}
+	}
+
+	if _, err := NewRules(true, []string{"~("}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
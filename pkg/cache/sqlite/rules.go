@@ -0,0 +1,63 @@
+package sqlite
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// Rules decides which requests the cache serves and stores. The zero value
+// admits every request.
+type Rules struct {
+	deterministicOnly bool
+	anyRequest        []*regexp.Regexp
+}
+
+// NewRules returns Rules that, with deterministicOnly set, admit only
+// Deterministic requests, except to models matching one of anyRequest
+// (names or patterns, see models.CompileModelPattern), which are admitted
+// whatever their sampling settings.
+func NewRules(deterministicOnly bool, anyRequest []string) (Rules, error) {
+	r := Rules{deterministicOnly: deterministicOnly}
+	for _, m := range anyRequest {
+		re, err := models.CompileModelPattern(m)
+		if err != nil {
+			return Rules{}, fmt.Errorf("cache model %q: %w", m, err)
+		}
+		r.anyRequest = append(r.anyRequest, re)
+	}
+	return r, nil
+}
+
+// Allow reports whether req may be answered from the cache and its
+// response stored.
+func (r Rules) Allow(req models.ChatCompletionRequest) bool {
+	if !r.deterministicOnly || Deterministic(req) {
+		return true
+	}
+	for _, re := range r.anyRequest {
+		if re.MatchString(req.Model) {
+			return true
+		}
+	}
+	return false
+}
+
+// Deterministic reports whether req asks for a response that shouldn't
+// vary between calls: temperature 0, top_p unset or 1, at most one
+// choice, and no tools or functions the model may choose to call.
+// Providers default temperature to about 1, so a request without one
+// samples.
+func Deterministic(req models.ChatCompletionRequest) bool {
+	if req.Temperature == nil || *req.Temperature != 0 {
+		return false
+	}
+	if req.TopP != nil && *req.TopP != 1 {
+		return false
+	}
+	if req.N != nil && *req.N > 1 {
+		return false
+	}
+	return len(req.Tools) == 0 && len(req.Functions) == 0
+}
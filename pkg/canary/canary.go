@@ -0,0 +1,156 @@
+// Package canary decides whether a staged configuration is safe to promote
+// by comparing its shadow-evaluated outcomes with the live configuration's
+// on the same requests.
+package canary
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Thresholds bound how much worse a candidate may behave than the live
+// configuration before it is rolled back.
+type Thresholds struct {
+	// Duration is how long the candidate is evaluated before promotion.
+	Duration time.Duration
+	// MinRequests is the number of evaluated requests required before the
+	// candidate can be promoted or rolled back.
+	MinRequests int
+	// MaxErrorRateIncrease is the largest tolerated rise in the fraction of
+	// requests that fail to route (e.g. 0.02 = two percentage points).
+	MaxErrorRateIncrease float64
+	// MaxRejectionRateIncrease is the largest tolerated rise in the fraction
+	// of requests rejected by policy (budget 4xx).
+	MaxRejectionRateIncrease float64
+}
+
+// Outcome is how one configuration would have handled one request.
+type Outcome struct {
+	Error    bool // no route could be resolved
+	Rejected bool // blocked by a budget policy
+}
+
+// State is the lifecycle stage of a canary.
+type State string
+
+// Canary states.
+const (
+	Evaluating State = "evaluating"
+	Promoted   State = "promoted"
+	RolledBack State = "rolled_back"
+)
+
+// Counts tallies outcomes for one side of the comparison.
+type Counts struct {
+	Errors   int `json:"errors"`
+	Rejected int `json:"rejected"`
+}
+
+// Status is a snapshot of a canary.
+type Status struct {
+	State     State     `json:"state"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at,omitempty"`
+	Requests  int       `json:"requests"`
+	Baseline  Counts    `json:"baseline"`
+	Candidate Counts    `json:"candidate"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// Canary accumulates paired outcomes and reaches a verdict. It is safe for
+// concurrent use.
+type Canary struct {
+	th Thresholds
+
+	mu sync.Mutex
+	st Status
+}
+
+// New starts evaluating a candidate at now.
+func New(th Thresholds, now time.Time) *Canary {
+	if th.MinRequests < 1 {
+		th.MinRequests = 1
+	}
+	return &Canary{th: th, st: Status{State: Evaluating, StartedAt: now}}
+}
+
+// Observe records how the live and candidate configurations handled one
+// request and returns the resulting state. Once the canary has been
+// promoted or rolled back, further observations are ignored.
+func (c *Canary) Observe(baseline, candidate Outcome, now time.Time) State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.st.State != Evaluating {
+		return c.st.State
+	}
+	c.st.Requests++
+	tally(&c.st.Baseline, baseline)
+	tally(&c.st.Candidate, candidate)
+	return c.decide(now)
+}
+
+// Check re-evaluates the verdict without a new observation, so a healthy
+// canary is promoted once its window passes even if traffic stops.
+func (c *Canary) Check(now time.Time) State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.st.State != Evaluating {
+		return c.st.State
+	}
+	return c.decide(now)
+}
+
+// Abort ends an evaluating canary as rolled back with the given reason.
+func (c *Canary) Abort(reason string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.st.State == Evaluating {
+		c.end(RolledBack, reason, now)
+	}
+}
+
+// Status returns a snapshot of the canary.
+func (c *Canary) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.st
+}
+
+func tally(c *Counts, o Outcome) {
+	if o.Error {
+		c.Errors++
+	}
+	if o.Rejected {
+		c.Rejected++
+	}
+}
+
+// decide applies the thresholds. The caller holds c.mu.
+func (c *Canary) decide(now time.Time) State {
+	n := c.st.Requests
+	if n < c.th.MinRequests {
+		return Evaluating
+	}
+	rate := func(k int) float64 { return float64(k) / float64(n) }
+
+	if d := rate(c.st.Candidate.Errors) - rate(c.st.Baseline.Errors); d > c.th.MaxErrorRateIncrease {
+		c.end(RolledBack, fmt.Sprintf("routing error rate rose %.1f points over %d requests", d*100, n), now)
+		return RolledBack
+	}
+	if d := rate(c.st.Candidate.Rejected) - rate(c.st.Baseline.Rejected); d > c.th.MaxRejectionRateIncrease {
+		c.end(RolledBack, fmt.Sprintf("policy rejection rate rose %.1f points over %d requests", d*100, n), now)
+		return RolledBack
+	}
+	if now.Sub(c.st.StartedAt) >= c.th.Duration {
+		c.end(Promoted, "", now)
+		return Promoted
+	}
+	return Evaluating
+}
+
+func (c *Canary) end(s State, reason string, now time.Time) {
+	c.st.State = s
+	c.st.Reason = reason
+	c.st.EndedAt = now
+}
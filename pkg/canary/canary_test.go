@@ -0,0 +1,61 @@
+package canary
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCanary(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	th := Thresholds{Duration: time.Minute, MinRequests: 10, MaxErrorRateIncrease: 0.1, MaxRejectionRateIncrease: 0.1}
+	ok := Outcome{}
+
+	tests := []struct {
+		name      string
+		candidate func(i int) Outcome
+		elapsed   time.Duration
+		want      State
+	}{
+		{"healthy before window", func(int) Outcome { return ok }, 30 * time.Second, Evaluating},
+		{"healthy after window", func(int) Outcome { return ok }, 2 * time.Minute, Promoted},
+		{"error spike", func(i int) Outcome { return Outcome{Error: i%2 == 0} }, 0, RolledBack},
+		{"rejection spike", func(i int) Outcome { return Outcome{Rejected: i < 5} }, 0, RolledBack},
+		{"within tolerance", func(i int) Outcome { return Outcome{Rejected: i == 0} }, 2 * time.Minute, Promoted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(th, start)
+			var got State
+			for i := 0; i < 10; i++ {
+				got = c.Observe(ok, tt.candidate(i), start.Add(tt.elapsed))
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s (%+v)", got, tt.want, c.Status())
+			}
+		})
+	}
+}
+
+func TestCanaryNeedsMinRequests(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New(Thresholds{Duration: time.Minute, MinRequests: 5, MaxErrorRateIncrease: 0.5}, start)
+
+	// A spike on too few requests isn't conclusive.
+	if got := c.Observe(Outcome{}, Outcome{Error: true}, start); got != Evaluating {
+		t.Fatalf("expected evaluating below min requests, got %s", got)
+	}
+	if got := c.Check(start.Add(time.Hour)); got != Evaluating {
+		t.Fatalf("expected no promotion below min requests, got %s", got)
+	}
+
+	for i := 0; i < 4; i++ {
+		c.Observe(Outcome{Error: true}, Outcome{Error: true}, start)
+	}
+	// Errors on both sides aren't the candidate's fault.
+	if got := c.Check(start.Add(time.Hour)); got != Promoted {
+		t.Errorf("expected promotion, got %s: %+v", got, c.Status())
+	}
+	if got := c.Observe(Outcome{}, Outcome{Error: true}, start); got != Promoted {
+		t.Errorf("expected observations after a verdict to be ignored, got %s", got)
+	}
+}
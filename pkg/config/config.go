@@ -1,25 +1,310 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/pario-ai/pario/pkg/middleware"
 	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/queue"
+	"github.com/pario-ai/pario/pkg/redis"
 	"gopkg.in/yaml.v3"
 )
 
 // Config holds all Pario configuration.
 type Config struct {
-	Listen    string           `yaml:"listen"`
-	DBPath    string           `yaml:"db_path"`
-	Providers []ProviderConfig `yaml:"providers"`
-	Cache     CacheConfig      `yaml:"cache"`
-	Budget    BudgetConfig     `yaml:"budget"`
-	Session   SessionConfig    `yaml:"session"`
-	Router      RouterConfig      `yaml:"router"`
-	Attribution AttributionConfig `yaml:"attribution"`
+	Listen      string             `yaml:"listen"`
+	DBPath      string             `yaml:"db_path"`
+	Timezone    string             `yaml:"timezone"`
+	Providers   []ProviderConfig   `yaml:"providers"`
+	Cache       CacheConfig        `yaml:"cache"`
+	Budget      BudgetConfig       `yaml:"budget"`
+	Session     SessionConfig      `yaml:"session"`
+	Tracking    TrackingConfig     `yaml:"tracking"`
+	Router      RouterConfig       `yaml:"router"`
+	Attribution AttributionConfig  `yaml:"attribution"`
 	Audit       models.AuditConfig `yaml:"audit"`
+	Maintenance MaintenanceConfig  `yaml:"maintenance"`
+	MCP         MCPConfig          `yaml:"mcp"`
+	Retention   RetentionConfig    `yaml:"retention"`
+	Admin       AdminConfig        `yaml:"admin"`
+	Queue       QueueConfig        `yaml:"queue"`
+	Canary      CanaryConfig       `yaml:"canary"`
+	Anomaly     AnomalyConfig      `yaml:"anomaly"`
+	Reload      ReloadConfig       `yaml:"reload"`
+	Shutdown    ShutdownConfig     `yaml:"shutdown"`
+	Batch       BatchConfig        `yaml:"batch"`
+	Limits      LimitsConfig       `yaml:"limits"`
+	RateLimits  []RateLimit        `yaml:"rate_limits"`
+	TLS         ListenerTLS        `yaml:"tls"`
+	// Middleware runs, in order, around chat completions and messages
+	// requests. See pkg/middleware for the built-in types.
+	Middleware []middleware.Config `yaml:"middleware"`
+}
+
+// ListenerTLS serves the proxy listener over HTTPS, from certificate files
+// or from certificates obtained with ACME. The zero value serves plain HTTP.
+type ListenerTLS struct {
+	// CertFile and KeyFile are PEM files holding the server certificate
+	// chain and its private key. They are re-read when they change.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ACME obtains and renews certificates automatically instead.
+	ACME ACMEConfig `yaml:"acme"`
+}
+
+// Enabled reports whether the listener serves HTTPS.
+func (t ListenerTLS) Enabled() bool {
+	return t.CertFile != "" || t.ACME.Enabled()
+}
+
+// ACMEConfig obtains certificates from an ACME CA such as Let's Encrypt.
+// The CA validates over TLS-ALPN-01 on the proxy listener, which must
+// therefore be reachable on port 443, or over HTTP-01 on HTTPListen.
+type ACMEConfig struct {
+	// Domains lists the host names to obtain certificates for; setting it
+	// enables ACME. Handshakes for other names are refused.
+	Domains []string `yaml:"domains"`
+	// Email is the account contact for expiry and revocation notices.
+	Email string `yaml:"email"`
+	// CacheDir stores the account key and certificates across restarts
+	// (default "pario-acme").
+	CacheDir string `yaml:"cache_dir"`
+	// DirectoryURL is the CA's directory, Let's Encrypt production when
+	// empty. Point it at a staging directory while testing.
+	DirectoryURL string `yaml:"directory_url"`
+	// HTTPListen, e.g. ":80", serves HTTP-01 challenges and redirects other
+	// plain HTTP requests to HTTPS.
+	HTTPListen string `yaml:"http_listen"`
+}
+
+// Enabled reports whether ACME is configured.
+func (a ACMEConfig) Enabled() bool {
+	return len(a.Domains) > 0
+}
+
+// LimitsConfig protects the proxy from oversized or runaway clients.
+type LimitsConfig struct {
+	// MaxBodyBytes caps the size of a request body (default 32 MiB).
+	// Larger requests are rejected with 413. Zero disables the cap.
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+	// MaxInFlightPerKey caps concurrent requests, including open Realtime
+	// sessions, per client API key. Requests over the cap are rejected
+	// with 429. Zero disables the cap.
+	MaxInFlightPerKey int `yaml:"max_in_flight_per_key"`
+}
+
+// RateLimit caps the request and token rate of a client key, optionally
+// for one model. APIKey "*" applies the limit to every key separately.
+type RateLimit struct {
+	APIKey string `yaml:"api_key"`
+	// Model limits only requests for this model; empty limits all models
+	// together.
+	Model string `yaml:"model"`
+	// RPM and TPM are requests and tokens per minute. Zero leaves that
+	// dimension unlimited.
+	RPM int `yaml:"rpm"`
+	TPM int `yaml:"tpm"`
+	// Reserve is the fraction of each bucket held back for high-priority
+	// requests, so interactive traffic still gets through when batch jobs
+	// have used up the rest. Zero shares the whole limit.
+	Reserve float64 `yaml:"reserve"`
+}
+
+// Applies reports whether the limit covers requests from apiKey for model.
+func (l RateLimit) Applies(apiKey, model string) bool {
+	return (l.APIKey == "*" || l.APIKey == apiKey) && (l.Model == "" || l.Model == model)
+}
+
+// BatchConfig controls deferred attribution of Batch API jobs. Batches
+// submitted through the proxy are polled every PollInterval until they
+// finish, then their usage is recorded against the submitting key. Zero
+// disables polling; batches are then attributed only when a client fetches
+// the finished batch through the proxy.
+type BatchConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+}
+
+// ShutdownConfig controls graceful shutdown. On SIGINT/SIGTERM the proxy
+// stops admitting requests and lets in-flight ones, including long streams,
+// finish for up to DrainTimeout before the remaining connections are closed.
+type ShutdownConfig struct {
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+}
+
+// ReloadConfig controls reloading the config file without a restart,
+// besides on SIGHUP. With Watch set, the file is checked every Interval and
+// reloaded when its contents change.
+type ReloadConfig struct {
+	Watch    bool          `yaml:"watch"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// CanaryConfig controls how a reloaded routing/budget config is evaluated
+// before it takes effect. The candidate is shadow-evaluated against live
+// traffic for Duration and rolled back if it routes or admits requests
+// noticeably worse than the running config. Zero Duration applies reloads
+// immediately.
+type CanaryConfig struct {
+	Duration    time.Duration `yaml:"duration"`
+	MinRequests int           `yaml:"min_requests"`
+	// MaxErrorRateIncrease is the tolerated rise, as a fraction of requests,
+	// in requests that no route can serve.
+	MaxErrorRateIncrease float64 `yaml:"max_error_rate_increase"`
+	// MaxRejectionRateIncrease is the tolerated rise in budget rejections.
+	MaxRejectionRateIncrease float64 `yaml:"max_rejection_rate_increase"`
+}
+
+// AnomalyConfig runs the background job that flags API keys and teams
+// whose usage in the current window departs from their previous windows.
+type AnomalyConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+	// Window is the width of the compared windows, and BaselineWindows how
+	// many windows before the current one make up the history.
+	Window          time.Duration `yaml:"window"`
+	BaselineWindows int           `yaml:"baseline_windows"`
+	// MinHistory is how many baseline windows need usage before a key or
+	// team is checked.
+	MinHistory int `yaml:"min_history"`
+	// ZScore and MedianRatio are how far above the baseline mean, in
+	// standard deviations, and above the baseline median, as a multiple, a
+	// window must be. Both must be exceeded.
+	ZScore      float64 `yaml:"z_score"`
+	MedianRatio float64 `yaml:"median_ratio"`
+	// MinTokens skips windows that used fewer tokens.
+	MinTokens int64 `yaml:"min_tokens"`
+}
+
+// QueueConfig limits concurrent upstream requests and decides who waits or
+// is shed when the limit is reached. MaxConcurrent of zero disables queueing.
+type QueueConfig struct {
+	MaxConcurrent int           `yaml:"max_concurrent"`
+	MaxQueue      int           `yaml:"max_queue"`
+	ShedThreshold int           `yaml:"shed_threshold"`
+	MaxWait       time.Duration `yaml:"max_wait"`
+	// DefaultPriority applies to keys without an entry in KeyPriorities.
+	DefaultPriority string `yaml:"default_priority"`
+	// KeyPriorities maps client API keys to a priority. A key listed here
+	// may lower its priority with X-Pario-Priority but not raise it.
+	KeyPriorities map[string]string `yaml:"key_priorities"`
+}
+
+// AdminConfig secures the proxy's admin API, served under /pario/admin/.
+type AdminConfig struct {
+	// Listen serves the admin API (and, under pario serve, the dashboard)
+	// on its own address, e.g. "127.0.0.1:9092". Empty serves the admin API
+	// on the proxy listener.
+	Listen string `yaml:"listen"`
+	// Token is the bearer token admin requests must present. Empty disables
+	// the admin API.
+	Token string `yaml:"token"`
+}
+
+// TrackingConfig controls how usage records are written and rolled up.
+type TrackingConfig struct {
+	Async   AsyncWritesConfig `yaml:"async"`
+	Rollups RollupsConfig     `yaml:"rollups"`
+	// SampleRate, when below 1, stores about that share of usage records
+	// as rows and only the totals of the rest. Budgets, counters,
+	// sessions, and rollups stay exact. 0 stores every record.
+	SampleRate float64 `yaml:"sample_rate"`
+	// Remote sends usage to, and reads budgets from, a central tracker
+	// server instead of db_path, so proxy replicas share one store.
+	Remote RemoteTrackerConfig `yaml:"remote"`
+	// Server serves this process's tracker to remote replicas.
+	Server TrackerServerConfig `yaml:"server"`
+}
+
+// RemoteTrackerConfig points a proxy at a tracker server. Usage tracking
+// uses db_path unless URL is set.
+type RemoteTrackerConfig struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+	// Timeout bounds each call to the server.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// TrackerServerConfig serves the tracker to remote replicas on Listen.
+// Clients must send Token as a bearer token.
+type TrackerServerConfig struct {
+	Listen string `yaml:"listen"`
+	Token  string `yaml:"token"`
+}
+
+// RollupsConfig runs the background job that aggregates usage records
+// into hourly and daily rollups and applies retention.usage_days and the
+// rollup retention periods.
+type RollupsConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// AsyncWritesConfig queues usage records and writes them in batched
+// transactions off the request path.
+type AsyncWritesConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// QueueSize bounds the records awaiting a write; more are dropped.
+	QueueSize int `yaml:"queue_size"`
+	// BatchSize is the most records written in one transaction.
+	BatchSize int `yaml:"batch_size"`
+	// FlushInterval is how often queued records are written.
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
+// RetentionConfig sets how long usage data is kept before pario prune, or
+// the rollup job in tracking.rollups, deletes it. Zero keeps data forever. Cache entries expire by their TTL and
+// audit entries by audit.retention_days.
+type RetentionConfig struct {
+	UsageDays   int `yaml:"usage_days"`
+	SessionDays int `yaml:"session_days"`
+	// HourlyRollupDays and DailyRollupDays keep usage rollups, which
+	// outlive the records they summarize.
+	HourlyRollupDays int `yaml:"hourly_rollup_days"`
+	DailyRollupDays  int `yaml:"daily_rollup_days"`
+	// EventDays keeps upstream failures, budget decisions, and anomalies.
+	// Zero keeps them as long as usage records.
+	EventDays int `yaml:"event_days"`
+}
+
+// EventRetentionDays returns how many days upstream failures, budget
+// decisions, and anomalies are kept: EventDays, or UsageDays when unset.
+func (r RetentionConfig) EventRetentionDays() int {
+	if r.EventDays > 0 {
+		return r.EventDays
+	}
+	return r.UsageDays
+}
+
+// MCPConfig configures the MCP server's HTTP transport. The stdio transport
+// is local and needs no configuration.
+type MCPConfig struct {
+	// Listen is the HTTP transport address, e.g. ":9091". Empty disables it.
+	Listen string `yaml:"listen"`
+	// Tokens are the bearer tokens accepted by the HTTP transport.
+	Tokens []MCPToken `yaml:"tokens"`
+}
+
+// MCPToken is a bearer token and the tool scopes it grants.
+type MCPToken struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	// Scopes is any of "read" (usage and cost tools), "audit" (audit log
+	// tools), and "write" (tools that change state).
+	Scopes []string `yaml:"scopes"`
+}
+
+// MaintenanceConfig controls the scheduled SQLite maintenance job
+// (WAL checkpoint, ANALYZE, VACUUM) run by the proxy.
+type MaintenanceConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
 }
 
 // AttributionConfig controls cost attribution and pricing.
@@ -27,50 +312,483 @@ type AttributionConfig struct {
 	Enabled   bool                        `yaml:"enabled"`
 	Pricing   []models.ModelPricing       `yaml:"pricing"`
 	KeyLabels map[string]models.CostLabel `yaml:"key_labels"`
+	// TeamTimezones overrides the reporting timezone per team (IANA names).
+	TeamTimezones map[string]string `yaml:"team_timezones"`
+	// Labels validates client-supplied attribution headers.
+	Labels LabelsConfig `yaml:"labels"`
+	// MetadataHeaders maps usage metadata names to the request headers
+	// their values are taken from, e.g. feature: X-Pario-Feature.
+	MetadataHeaders map[string]string `yaml:"metadata_headers"`
+}
+
+// LabelsConfig bounds the attribution labels clients may send via
+// X-Pario-Labels and the team/project/env headers.
+type LabelsConfig struct {
+	// AllowedKeys restricts X-Pario-Labels keys; empty allows any key.
+	AllowedKeys []string `yaml:"allowed_keys"`
+	// MaxKeys caps the number of labels kept per request (0 = unlimited).
+	MaxKeys int `yaml:"max_keys"`
+	// MaxValuesPerKey caps distinct values per key; further values are
+	// recorded as OverflowValue (0 = unlimited).
+	MaxValuesPerKey int `yaml:"max_values_per_key"`
+	// MaxValueLength truncates keys and values to this many bytes (0 = unlimited).
+	MaxValueLength int `yaml:"max_value_length"`
+	// Normalize lowercases values and collapses whitespace to "-".
+	Normalize bool `yaml:"normalize"`
+	// OverflowValue replaces values beyond MaxValuesPerKey (default "__other__").
+	OverflowValue string `yaml:"overflow_value"`
 }
 
 // RouterConfig defines model routing and fallback chains.
 type RouterConfig struct {
 	Routes []RouteConfig `yaml:"routes"`
+	// RateLimitHeadroom is the fraction of a provider's rate limit (0-1)
+	// below which its targets are tried after those with more headroom.
+	// Zero only deprioritizes providers that have run out.
+	RateLimitHeadroom float64 `yaml:"ratelimit_headroom"`
+	// ContextWindows sets the context window, in tokens, of upstream models.
+	// A target's own context_window takes precedence.
+	ContextWindows map[string]int `yaml:"context_windows"`
+	// OnOverflow is the default for routes without on_overflow.
+	OnOverflow string `yaml:"on_overflow"`
+	// Cooldown demotes route targets that keep failing.
+	Cooldown CooldownConfig `yaml:"cooldown"`
+	// Unmatched is how a model no route matches is handled when there is
+	// no catch-all route: UnmatchedFirstProvider (the default) or
+	// UnmatchedReject.
+	Unmatched string `yaml:"unmatched"`
+}
+
+// Handling of models no route matches.
+const (
+	// UnmatchedFirstProvider sends the model to the first provider as-is.
+	UnmatchedFirstProvider = "first_provider"
+	// UnmatchedReject refuses the request.
+	UnmatchedReject = "reject"
+)
+
+// CooldownConfig moves a target behind the others in its chains after
+// Failures consecutive failed attempts (transport errors and 5xx), for
+// Duration. It is then tried again, and cooled down again after one more
+// failure. Zero Failures disables cooldowns.
+type CooldownConfig struct {
+	Failures int           `yaml:"failures"`
+	Duration time.Duration `yaml:"duration"`
 }
 
+// Context window overflow handling.
+const (
+	// OverflowReject refuses a request that doesn't fit the first target.
+	OverflowReject = "reject"
+	// OverflowReroute skips targets the request doesn't fit.
+	OverflowReroute = "reroute"
+	// OverflowTruncate drops the oldest messages until the request fits.
+	OverflowTruncate = "truncate"
+)
+
 // RouteConfig maps a client-facing model alias to an ordered list of targets.
+//
+// Model is either a model name or a pattern covering a model family: a glob
+// such as "gpt-4*", or "~" followed by a regular expression, such as
+// "~^claude-3.*". A route with a model name wins over patterns, which are
+// tried in order.
 type RouteConfig struct {
 	Model   string        `yaml:"model"`
 	Targets []RouteTarget `yaml:"targets"`
+	// OnOverflow decides what happens to a request too large for a target's
+	// context window: "reject" (default), "reroute", or "truncate".
+	OnOverflow string `yaml:"on_overflow"`
+	// StructuredOutput validates non-streamed chat completions against the
+	// request's response_format schema and retries once on invalid output.
+	StructuredOutput bool `yaml:"structured_output"`
+	// SchemaRetry picks the retry target: "same" (default) or "fallback",
+	// the next target in the chain.
+	SchemaRetry string `yaml:"schema_retry"`
+	// Retry retries each target on transient failures before falling
+	// through to the next one.
+	Retry RetryConfig `yaml:"retry"`
+	// Strategy orders the targets: "ordered" (default) tries them as
+	// listed, "latency" fastest first by observed latency, and "cheapest"
+	// by the estimated cost of the request from the pricing catalog.
+	Strategy string `yaml:"strategy"`
+	// Sticky pins each session, as named by X-Pario-Session, to the target
+	// that served its first request, so a conversation stays on one model.
+	Sticky bool `yaml:"sticky"`
+	// Params enforces or injects request parameters for every target.
+	Params ParamsConfig `yaml:"params"`
+}
+
+// IsPattern reports whether the route's model is a pattern rather than a
+// model name.
+func (r RouteConfig) IsPattern() bool {
+	return models.IsModelPattern(r.Model)
+}
+
+// IsCatchAll reports whether the route is the catch-all route, model "*",
+// which is matched only after every other route.
+func (r RouteConfig) IsCatchAll() bool {
+	return r.Model == "*"
+}
+
+// ModelPattern compiles the route's model pattern with
+// models.CompileModelPattern.
+func (r RouteConfig) ModelPattern() (*regexp.Regexp, error) {
+	return models.CompileModelPattern(r.Model)
+}
+
+// Route target ordering strategies.
+const (
+	StrategyOrdered  = "ordered"
+	StrategyLatency  = "latency"
+	StrategyCheapest = "cheapest"
+)
+
+// RetryConfig controls retries of a single route target.
+type RetryConfig struct {
+	// MaxRetries is how many times a target is retried after a 429, a 5xx,
+	// or a transport error. Zero disables retries.
+	MaxRetries int `yaml:"max_retries"`
+	// Backoff is the delay before the first retry (default 250ms). It
+	// doubles for each further retry up to MaxBackoff (default 5s), and
+	// each delay is jittered.
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
 }
 
 // RouteTarget identifies a specific provider and model in a fallback chain.
 type RouteTarget struct {
 	Provider string `yaml:"provider"`
 	Model    string `yaml:"model"`
+	// ContextWindow is the target model's context window in tokens,
+	// prompt and completion combined. Zero means unknown (no check).
+	ContextWindow int `yaml:"context_window"`
+	// Schedule limits the target to time windows, such as off-peak hours;
+	// outside all of them it is skipped. Empty means always.
+	Schedule []TimeWindow `yaml:"schedule"`
+	// Downgrade marks the target as the route's cheaper choice: it is
+	// moved to the front for keys past a budget policy's downgrade_at, and
+	// otherwise tried in its place in the list.
+	Downgrade bool `yaml:"downgrade"`
+	// Params overrides the route's params, field by field, for this target.
+	Params ParamsConfig `yaml:"params"`
+}
+
+// ParamsConfig enforces or injects parameters of chat completions and
+// messages requests before they are sent to a target.
+type ParamsConfig struct {
+	// MaxTokens caps max_tokens and max_completion_tokens. A request that
+	// sets neither gets max_tokens set to it.
+	MaxTokens int `yaml:"max_tokens"`
+	// MinTemperature and MaxTemperature clamp the request's temperature,
+	// when it sets one.
+	MinTemperature *float64 `yaml:"min_temperature"`
+	MaxTemperature *float64 `yaml:"max_temperature"`
+	// Set forces top-level fields to the given values. An object value is
+	// merged into the request's object, replacing the keys it names.
+	// stream_options is only set on streaming requests.
+	Set map[string]any `yaml:"set"`
+	// SystemPrefix is prepended to the request's system prompt, or becomes
+	// the system prompt if it has none.
+	SystemPrefix string `yaml:"system_prefix"`
+}
+
+// Override returns p with the fields o sets replacing p's. Set maps are
+// merged, with o's values winning.
+func (p ParamsConfig) Override(o ParamsConfig) ParamsConfig {
+	if o.MaxTokens != 0 {
+		p.MaxTokens = o.MaxTokens
+	}
+	if o.MinTemperature != nil {
+		p.MinTemperature = o.MinTemperature
+	}
+	if o.MaxTemperature != nil {
+		p.MaxTemperature = o.MaxTemperature
+	}
+	if o.SystemPrefix != "" {
+		p.SystemPrefix = o.SystemPrefix
+	}
+	if len(o.Set) > 0 {
+		set := make(map[string]any, len(p.Set)+len(o.Set))
+		for k, v := range p.Set {
+			set[k] = v
+		}
+		for k, v := range o.Set {
+			set[k] = v
+		}
+		p.Set = set
+	}
+	return p
+}
+
+// IsZero reports whether p changes nothing.
+func (p ParamsConfig) IsZero() bool {
+	return p.MaxTokens == 0 && p.MinTemperature == nil && p.MaxTemperature == nil && len(p.Set) == 0 && p.SystemPrefix == ""
+}
+
+// reservedParams are fields params.set may not change: the proxy reads or
+// rewrites them itself.
+var reservedParams = map[string]bool{"model": true, "messages": true, "stream": true}
+
+func (p ParamsConfig) validate() error {
+	if p.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens must not be negative")
+	}
+	if p.MinTemperature != nil && p.MaxTemperature != nil && *p.MinTemperature > *p.MaxTemperature {
+		return fmt.Errorf("min_temperature is above max_temperature")
+	}
+	for k := range p.Set {
+		if reservedParams[k] {
+			return fmt.Errorf("set: %q can't be set", k)
+		}
+	}
+	return nil
+}
+
+// TimeWindow is a time-of-day range, optionally on certain days only.
+type TimeWindow struct {
+	// From and To are "HH:MM" times of day; From is inclusive and To
+	// exclusive. A window whose To is not after its From spans midnight.
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	// Days limits the window to days of the week ("mon" to "sun"). A window
+	// spanning midnight belongs to the day it starts on. Empty means daily.
+	Days []string `yaml:"days"`
+	// Timezone is an IANA timezone name. Empty means the deployment
+	// timezone.
+	Timezone string `yaml:"timezone"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Contains reports whether t falls in the window. def is the timezone of
+// windows without their own. Invalid windows, which config validation
+// rejects, contain nothing.
+func (w TimeWindow) Contains(t time.Time, def *time.Location) bool {
+	loc := def
+	if w.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(w.Timezone); err != nil {
+			return false
+		}
+	}
+	from, err1 := clockMinutes(w.From)
+	to, err2 := clockMinutes(w.To)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	t = t.In(loc)
+	now := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case from < to:
+		if now < from || now >= to {
+			return false
+		}
+	case now >= from:
+	case now < to:
+		day = (day + 6) % 7 // started the day before
+	default:
+		return false
+	}
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
 }
 
-// SessionConfig controls session detection.
+func (w TimeWindow) validate() error {
+	if _, err := clockMinutes(w.From); err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+	if _, err := clockMinutes(w.To); err != nil {
+		return fmt.Errorf("to: %w", err)
+	}
+	for _, d := range w.Days {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("unknown day %q", d)
+		}
+	}
+	if w.Timezone != "" {
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			return fmt.Errorf("timezone: %w", err)
+		}
+	}
+	return nil
+}
+
+// clockMinutes parses an "HH:MM" time of day into minutes after midnight.
+func clockMinutes(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("time of day %q: want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// SessionConfig controls session detection and expiry.
 type SessionConfig struct {
 	GapTimeout time.Duration `yaml:"gap_timeout"`
+	// IdleTimeout ends sessions with no activity for this long. Zero
+	// leaves them open.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// ExpiryInterval is how often idle sessions are ended and sessions
+	// past retention.session_days are archived or deleted.
+	ExpiryInterval time.Duration `yaml:"expiry_interval"`
+	// ArchiveDir receives sessions past retention.session_days as
+	// gzip-compressed JSON lines before they are deleted. Empty deletes
+	// them outright.
+	ArchiveDir string `yaml:"archive_dir"`
 }
 
 // ProviderConfig defines an upstream LLM provider.
 // ProviderConfig defines an upstream LLM provider.
-// Type is "openai" (default) or "anthropic".
+// Type is "openai" (default), "anthropic", "bedrock", "vertex", or
+// "openai-compatible" for local engines such as Ollama, vLLM, and LM Studio.
 type ProviderConfig struct {
 	Name   string `yaml:"name"`
 	URL    string `yaml:"url"`
 	APIKey string `yaml:"api_key"`
 	Type   string `yaml:"type"`
+	// Region is the AWS region of a bedrock provider or the Google Cloud
+	// location of a vertex provider. URL defaults to that region's endpoint.
+	Region string `yaml:"region"`
+	// Project is the Google Cloud project ID of a vertex provider.
+	Project string `yaml:"project"`
+	// BasePath is the path prefix of an openai-compatible provider's API,
+	// "/v1" when empty.
+	BasePath string `yaml:"base_path"`
+	// Timeout bounds a whole buffered request, and the wait for response
+	// headers of a streamed one. ConnectTimeout bounds establishing the
+	// connection. StreamIdleTimeout bounds the gap between reads of a
+	// streamed response. Zero uses the proxy's defaults.
+	Timeout           time.Duration `yaml:"timeout"`
+	ConnectTimeout    time.Duration `yaml:"connect_timeout"`
+	StreamIdleTimeout time.Duration `yaml:"stream_idle_timeout"`
+	// Headers are added to every request sent to the provider, e.g.
+	// OpenAI-Organization or a gateway token. The provider's credentials
+	// are set after them and take precedence.
+	Headers map[string]string `yaml:"headers"`
+	// Proxy is the egress proxy for requests to the provider: an http://,
+	// https://, socks5://, or socks5h:// URL, optionally with credentials.
+	// Empty uses HTTP_PROXY, HTTPS_PROXY, and NO_PROXY.
+	Proxy string `yaml:"proxy"`
+	// TLS configures client certificates and trusted CAs for providers
+	// behind gateways that require mutual TLS.
+	TLS ProviderTLS `yaml:"tls"`
+}
+
+// ProviderTLS is the TLS client configuration for a provider. The zero
+// value uses the system roots and presents no client certificate.
+type ProviderTLS struct {
+	// CertFile and KeyFile are PEM files holding the client certificate
+	// (with any intermediates) and its private key. Set both or neither.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// CAFile is a PEM bundle of CAs trusted for the provider's server
+	// certificate, replacing the system roots.
+	CAFile string `yaml:"ca_file"`
+	// ServerName overrides the name verified against the server
+	// certificate, for gateways reached by IP or an internal alias.
+	ServerName string `yaml:"server_name"`
+}
+
+// Config loads the certificate files and returns the tls.Config for t, or
+// nil when t is the zero value.
+func (t ProviderTLS) Config() (*tls.Config, error) {
+	if t == (ProviderTLS{}) {
+		return nil, nil
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, fmt.Errorf("tls: cert_file and key_file must be set together")
+	}
+	c := &tls.Config{ServerName: t.ServerName, MinVersion: tls.VersionTLS12}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: load client certificate: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: read ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates in ca_file %s", t.CAFile)
+		}
+		c.RootCAs = pool
+	}
+	return c, nil
+}
+
+// Local reports whether p is a local openai-compatible engine. Local
+// providers need no API key and their models are priced at zero.
+func (p ProviderConfig) Local() bool {
+	return p.Type == "openai-compatible"
 }
 
 // CacheConfig controls the prompt cache.
 type CacheConfig struct {
 	Enabled bool          `yaml:"enabled"`
 	TTL     time.Duration `yaml:"ttl"`
+	// Coalesce makes concurrent identical non-streaming requests share one
+	// upstream call. It works with or without the cache enabled.
+	Coalesce bool `yaml:"coalesce"`
+	// DeterministicOnly caches only requests whose response shouldn't
+	// vary: temperature 0, top_p unset or 1, one choice, and no tools.
+	DeterministicOnly bool `yaml:"deterministic_only"`
+	// AnyRequestModels lists models, or model patterns, cached whatever
+	// their sampling settings when DeterministicOnly is set.
+	AnyRequestModels []string `yaml:"any_request_models"`
 }
 
 // BudgetConfig controls budget enforcement.
 type BudgetConfig struct {
 	Enabled  bool                  `yaml:"enabled"`
 	Policies []models.BudgetPolicy `yaml:"policies"`
+	// Queue holds requests near or over a limit instead of rejecting them.
+	Queue BudgetQueueConfig `yaml:"queue"`
+	// ShedLowPriority rejects low-priority requests from a key once it is
+	// past a policy's warn_at, keeping what is left for interactive traffic.
+	ShedLowPriority bool `yaml:"shed_low_priority"`
+	// PolicySync is how often the proxy reloads the managed policies stored
+	// in the tracker database, picking up changes made by other replicas or
+	// through MCP (default 30s). Zero disables it.
+	PolicySync time.Duration `yaml:"policy_sync"`
+	// Counters keeps running per-key usage totals outside the database, so
+	// budget checks read a counter instead of summing recorded usage.
+	Counters BudgetCountersConfig `yaml:"counters"`
+}
+
+// BudgetCountersConfig configures budget usage counters.
+type BudgetCountersConfig struct {
+	// Redis is the URL of the Redis server holding the counters, e.g.
+	// redis://:password@redis:6379/0, or rediss:// for TLS. Empty disables
+	// counters.
+	Redis string `yaml:"redis"`
+}
+
+// BudgetQueueConfig enables budget queueing. Once a key passes a policy's
+// warn_at its requests are admitted one at a time, highest priority first,
+// and a request that finds the budget exhausted waits for it to free up before
+// getting a 429.
+type BudgetQueueConfig struct {
+	// MaxWait is how long a request may wait; zero disables queueing.
+	MaxWait time.Duration `yaml:"max_wait"`
+	// MaxQueue caps the requests waiting per key (default 100); requests
+	// beyond it evict the newest waiter of a lower priority or get a 429
+	// straight away.
+	MaxQueue int `yaml:"max_queue"`
 }
 
 // Default returns a Config with sensible defaults.
@@ -83,10 +801,26 @@ func Default() *Config {
 			TTL:     time.Hour,
 		},
 		Budget: BudgetConfig{
-			Enabled: false,
+			Enabled:    false,
+			Queue:      BudgetQueueConfig{MaxQueue: 100},
+			PolicySync: 30 * time.Second,
 		},
 		Session: SessionConfig{
-			GapTimeout: 30 * time.Minute,
+			GapTimeout:     30 * time.Minute,
+			ExpiryInterval: 10 * time.Minute,
+		},
+		Tracking: TrackingConfig{
+			Async: AsyncWritesConfig{
+				QueueSize:     10000,
+				BatchSize:     500,
+				FlushInterval: time.Second,
+			},
+			Rollups: RollupsConfig{
+				Interval: time.Hour,
+			},
+			Remote: RemoteTrackerConfig{
+				Timeout: 5 * time.Second,
+			},
 		},
 		Audit: models.AuditConfig{
 			Enabled:       false,
@@ -96,6 +830,36 @@ func Default() *Config {
 			MaxBodySize:   1 << 20, // 1 MB
 			Include:       []string{"prompts", "responses", "metadata"},
 		},
+		Maintenance: MaintenanceConfig{
+			Enabled:  false,
+			Interval: 24 * time.Hour,
+		},
+		Anomaly: AnomalyConfig{
+			Interval:        5 * time.Minute,
+			Window:          time.Hour,
+			BaselineWindows: 168,
+			MinHistory:      24,
+			ZScore:          4,
+			MedianRatio:     3,
+			MinTokens:       10000,
+		},
+		Canary: CanaryConfig{
+			MinRequests:              50,
+			MaxErrorRateIncrease:     0.01,
+			MaxRejectionRateIncrease: 0.05,
+		},
+		Reload: ReloadConfig{
+			Interval: 2 * time.Second,
+		},
+		Shutdown: ShutdownConfig{
+			DrainTimeout: 30 * time.Second,
+		},
+		Batch: BatchConfig{
+			PollInterval: 5 * time.Minute,
+		},
+		Limits: LimitsConfig{
+			MaxBodyBytes: 32 << 20,
+		},
 	}
 }
 
@@ -113,5 +877,314 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("parse config: %w", err)
 	}
 
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
+
+func (c *Config) validate() error {
+	if _, err := c.Location(); err != nil {
+		return err
+	}
+	for team, tz := range c.Attribution.TeamTimezones {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return fmt.Errorf("timezone for team %q: %w", team, err)
+		}
+	}
+	l := c.Attribution.Labels
+	if l.MaxKeys < 0 || l.MaxValuesPerKey < 0 || l.MaxValueLength < 0 {
+		return fmt.Errorf("attribution.labels: limits must not be negative")
+	}
+	for name, header := range c.Attribution.MetadataHeaders {
+		if name == "" || strings.TrimSpace(header) == "" {
+			return fmt.Errorf("attribution.metadata_headers: names and headers must not be empty")
+		}
+	}
+	for _, p := range c.Providers {
+		if p.Type == "bedrock" && p.Region == "" {
+			return fmt.Errorf("provider %q: bedrock requires region", p.Name)
+		}
+		if p.Type == "vertex" && (p.Region == "" || p.Project == "") {
+			return fmt.Errorf("provider %q: vertex requires project and region", p.Name)
+		}
+		if p.Proxy != "" {
+			u, err := url.Parse(p.Proxy)
+			if err != nil {
+				return fmt.Errorf("provider %q: invalid proxy: %w", p.Name, err)
+			}
+			switch u.Scheme {
+			case "http", "https", "socks5", "socks5h":
+			default:
+				return fmt.Errorf("provider %q: proxy scheme must be http, https, socks5, or socks5h", p.Name)
+			}
+		}
+		if _, err := p.TLS.Config(); err != nil {
+			return fmt.Errorf("provider %q: %w", p.Name, err)
+		}
+		if p.Timeout < 0 || p.ConnectTimeout < 0 || p.StreamIdleTimeout < 0 {
+			return fmt.Errorf("provider %q: timeouts must not be negative", p.Name)
+		}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls: cert_file and key_file must be set together")
+	}
+	if c.TLS.CertFile != "" && c.TLS.ACME.Enabled() {
+		return fmt.Errorf("tls: set either cert_file/key_file or acme, not both")
+	}
+	if c.TLS.ACME.HTTPListen != "" && !c.TLS.ACME.Enabled() {
+		return fmt.Errorf("tls.acme: http_listen requires domains")
+	}
+	if c.Budget.Queue.MaxWait < 0 || c.Budget.Queue.MaxQueue < 0 {
+		return fmt.Errorf("budget.queue: values must not be negative")
+	}
+	if c.Budget.PolicySync < 0 {
+		return fmt.Errorf("budget.policy_sync must not be negative")
+	}
+	if c.Limits.MaxBodyBytes < 0 || c.Limits.MaxInFlightPerKey < 0 {
+		return fmt.Errorf("limits: values must not be negative")
+	}
+	for i, l := range c.RateLimits {
+		if l.APIKey == "" {
+			return fmt.Errorf("rate_limits[%d]: api_key is required (\"*\" for every key)", i)
+		}
+		if l.RPM < 0 || l.TPM < 0 || l.RPM+l.TPM == 0 {
+			return fmt.Errorf("rate_limits[%d]: set a positive rpm, tpm, or both", i)
+		}
+		if l.Reserve < 0 || l.Reserve >= 1 {
+			return fmt.Errorf("rate_limits[%d]: reserve must be at least 0 and below 1", i)
+		}
+	}
+	if a := c.Tracking.Async; a.Enabled && (a.QueueSize <= 0 || a.BatchSize <= 0 || a.FlushInterval <= 0) {
+		return fmt.Errorf("tracking.async: queue_size, batch_size, and flush_interval must be positive")
+	}
+	if r := c.Tracking.SampleRate; r < 0 || r > 1 {
+		return fmt.Errorf("tracking.sample_rate: must be between 0 and 1")
+	}
+	if r := c.Retention; r.UsageDays < 0 || r.SessionDays < 0 || r.HourlyRollupDays < 0 || r.DailyRollupDays < 0 || r.EventDays < 0 {
+		return fmt.Errorf("retention: days must not be negative")
+	}
+	if d := c.Retention.HourlyRollupDays; d == 1 {
+		// Daily rollups are rebuilt from the hours of the current day.
+		return fmt.Errorf("retention.hourly_rollup_days: must be at least 2")
+	}
+	if s := c.Session; s.IdleTimeout != 0 && s.IdleTimeout < s.GapTimeout {
+		return fmt.Errorf("session.idle_timeout: must be at least gap_timeout")
+	}
+	if s := c.Session; (s.IdleTimeout > 0 || c.Retention.SessionDays > 0) && s.ExpiryInterval <= 0 {
+		return fmt.Errorf("session.expiry_interval: must be positive")
+	}
+	if a := c.Anomaly; a.Enabled {
+		switch {
+		case a.Interval <= 0:
+			return fmt.Errorf("anomaly.interval: must be positive")
+		case a.Window < time.Minute || a.Window%time.Second != 0:
+			return fmt.Errorf("anomaly.window: must be at least a minute, in whole seconds")
+		case a.BaselineWindows < 2:
+			return fmt.Errorf("anomaly.baseline_windows: must be at least 2")
+		case a.MinHistory < 1 || a.MinHistory > a.BaselineWindows:
+			return fmt.Errorf("anomaly.min_history: must be between 1 and baseline_windows")
+		case a.ZScore <= 0 || a.MedianRatio < 1:
+			return fmt.Errorf("anomaly: z_score must be positive and median_ratio at least 1")
+		case a.MinTokens < 0:
+			return fmt.Errorf("anomaly.min_tokens: must not be negative")
+		}
+	}
+	if r := c.Tracking.Rollups; r.Enabled && r.Interval <= 0 {
+		return fmt.Errorf("tracking.rollups.interval: must be positive")
+	}
+	if r := c.Tracking.Remote; r.URL != "" && (r.Token == "" || r.Timeout <= 0) {
+		return fmt.Errorf("tracking.remote: token and a positive timeout are required with url")
+	}
+	if s := c.Tracking.Server; s.Listen != "" && s.Token == "" {
+		return fmt.Errorf("tracking.server.token: required with tracking.server.listen")
+	}
+	if c.Tracking.Remote.URL != "" && c.Tracking.Server.Listen != "" {
+		return fmt.Errorf("tracking: remote.url and server.listen are mutually exclusive")
+	}
+	if h := c.Router.RateLimitHeadroom; h < 0 || h > 1 {
+		return fmt.Errorf("router.ratelimit_headroom: must be between 0 and 1")
+	}
+	if c.Router.Cooldown.Failures < 0 || c.Router.Cooldown.Duration < 0 {
+		return fmt.Errorf("router.cooldown: values must not be negative")
+	}
+	if c.Router.Cooldown.Failures > 0 && c.Router.Cooldown.Duration == 0 {
+		return fmt.Errorf("router.cooldown: duration is required with failures")
+	}
+	if !validOverflow(c.Router.OnOverflow) {
+		return fmt.Errorf("router.on_overflow: unknown mode %q", c.Router.OnOverflow)
+	}
+	for _, m := range c.Cache.AnyRequestModels {
+		if _, err := models.CompileModelPattern(m); err != nil {
+			return fmt.Errorf("cache.any_request_models: invalid model pattern %q: %w", m, err)
+		}
+	}
+	switch c.Router.Unmatched {
+	case "", UnmatchedFirstProvider, UnmatchedReject:
+	default:
+		return fmt.Errorf("router.unmatched: unknown mode %q", c.Router.Unmatched)
+	}
+	for _, r := range c.Router.Routes {
+		if r.IsPattern() {
+			if _, err := r.ModelPattern(); err != nil {
+				return fmt.Errorf("route %q: invalid model pattern: %w", r.Model, err)
+			}
+		}
+		if !validOverflow(r.OnOverflow) {
+			return fmt.Errorf("route %q: unknown on_overflow mode %q", r.Model, r.OnOverflow)
+		}
+		switch r.SchemaRetry {
+		case "", "same", "fallback":
+		default:
+			return fmt.Errorf("route %q: unknown schema_retry %q", r.Model, r.SchemaRetry)
+		}
+		if err := r.Params.validate(); err != nil {
+			return fmt.Errorf("route %q: params: %w", r.Model, err)
+		}
+		for _, t := range r.Targets {
+			for _, w := range t.Schedule {
+				if err := w.validate(); err != nil {
+					return fmt.Errorf("route %q: target %q: schedule: %w", r.Model, t.Provider, err)
+				}
+			}
+			if err := r.Params.Override(t.Params).validate(); err != nil {
+				return fmt.Errorf("route %q: target %q: params: %w", r.Model, t.Provider, err)
+			}
+		}
+		switch r.Strategy {
+		case "", StrategyOrdered, StrategyLatency, StrategyCheapest:
+		default:
+			return fmt.Errorf("route %q: unknown strategy %q", r.Model, r.Strategy)
+		}
+		if r.Retry.MaxRetries < 0 || r.Retry.Backoff < 0 || r.Retry.MaxBackoff < 0 {
+			return fmt.Errorf("route %q: retry values must not be negative", r.Model)
+		}
+	}
+	for i, p := range c.Budget.Policies {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("budget.policies[%d]: %w", i, err)
+		}
+	}
+	if c.Budget.Counters.Redis != "" {
+		if _, err := redis.ParseURL(c.Budget.Counters.Redis); err != nil {
+			return fmt.Errorf("budget.counters: %w", err)
+		}
+	}
+	cn := c.Canary
+	if cn.Duration < 0 || cn.MinRequests < 0 || cn.MaxErrorRateIncrease < 0 || cn.MaxRejectionRateIncrease < 0 {
+		return fmt.Errorf("canary: values must not be negative")
+	}
+	if c.Reload.Watch && c.Reload.Interval <= 0 {
+		return fmt.Errorf("reload.interval must be positive")
+	}
+	if c.Shutdown.DrainTimeout <= 0 {
+		return fmt.Errorf("shutdown.drain_timeout must be positive")
+	}
+	if c.Batch.PollInterval < 0 {
+		return fmt.Errorf("batch.poll_interval must not be negative")
+	}
+	if _, err := middleware.New(c.Middleware); err != nil {
+		return err
+	}
+	q := c.Queue
+	if q.MaxConcurrent < 0 || q.MaxQueue < 0 || q.ShedThreshold < 0 || q.MaxWait < 0 {
+		return fmt.Errorf("queue: limits must not be negative")
+	}
+	if _, err := queue.ParsePriority(q.DefaultPriority); err != nil {
+		return fmt.Errorf("queue.default_priority: %w", err)
+	}
+	for key, p := range q.KeyPriorities {
+		if _, err := queue.ParsePriority(p); err != nil {
+			return fmt.Errorf("queue.key_priorities[%s]: %w", key, err)
+		}
+	}
+	for i, t := range c.MCP.Tokens {
+		if t.Token == "" {
+			return fmt.Errorf("mcp.tokens[%d]: token is required", i)
+		}
+		for _, sc := range t.Scopes {
+			switch sc {
+			case "read", "audit", "write":
+			default:
+				return fmt.Errorf("mcp.tokens[%d]: unknown scope %q", i, sc)
+			}
+		}
+	}
+	return nil
+}
+
+func validOverflow(mode string) bool {
+	switch mode {
+	case "", OverflowReject, OverflowReroute, OverflowTruncate:
+		return true
+	}
+	return false
+}
+
+// Location returns the deployment-wide reporting timezone. Daily and monthly
+// boundaries for budgets and reports are computed in this location.
+// An empty timezone means UTC.
+func (c *Config) Location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("timezone: %w", err)
+	}
+	return loc, nil
+}
+
+// TeamLocation returns the reporting timezone for a team, falling back to the
+// deployment timezone and finally UTC.
+func (c *Config) TeamLocation(team string) *time.Location {
+	if tz, ok := c.Attribution.TeamTimezones[team]; ok && team != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			return loc
+		}
+	}
+	if loc, err := c.Location(); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// KeyLocation returns the reporting timezone for an API key, resolved through
+// the team in its key_labels entry.
+func (c *Config) KeyLocation(apiKey string) *time.Location {
+	return c.TeamLocation(c.Attribution.KeyLabels[apiKey].Team)
+}
+
+// Pricing returns attribution.pricing plus a zero-cost entry, marked local,
+// for each model routed to a local provider that has no explicit price.
+func (c *Config) Pricing() []models.ModelPricing {
+	pricing := append([]models.ModelPricing(nil), c.Attribution.Pricing...)
+	seen := make(map[string]bool, len(pricing))
+	for _, p := range pricing {
+		seen[p.Model] = true
+	}
+	local := make(map[string]bool)
+	for _, p := range c.Providers {
+		if p.Local() {
+			local[p.Name] = true
+		}
+	}
+	for _, route := range c.Router.Routes {
+		for _, t := range route.Targets {
+			model := t.Model
+			if model == "" {
+				if route.IsPattern() {
+					continue // the requested model, unknown until a request
+				}
+				model = route.Model
+			}
+			if !local[t.Provider] || seen[model] {
+				continue
+			}
+			seen[model] = true
+			pricing = append(pricing, models.ModelPricing{Model: model, Local: true})
+		}
+	}
+	return pricing
+}
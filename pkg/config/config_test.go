@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
 )
 
 func TestDefault(t *testing.T) {
@@ -122,3 +124,449 @@ func TestLoadMissing(t *testing.T) {
 		t.Error("expected error for missing file")
 	}
 }
+
+func TestTimezones(t *testing.T) {
+	content := `
+timezone: America/New_York
+attribution:
+  team_timezones:
+    tokyo-team: Asia/Tokyo
+  key_labels:
+    sk-tokyo:
+      team: tokyo-team
+`
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  *time.Location
+		want string
+	}{
+		{"deployment default", cfg.TeamLocation(""), "America/New_York"},
+		{"unknown team", cfg.TeamLocation("other"), "America/New_York"},
+		{"team override", cfg.TeamLocation("tokyo-team"), "Asia/Tokyo"},
+		{"key via team label", cfg.KeyLocation("sk-tokyo"), "Asia/Tokyo"},
+		{"unlabeled key", cfg.KeyLocation("sk-other"), "America/New_York"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got.String() != tt.want {
+				t.Errorf("got %s, want %s", tt.got, tt.want)
+			}
+		})
+	}
+
+	if loc := Default().TeamLocation("any"); loc != time.UTC {
+		t.Errorf("expected UTC by default, got %s", loc)
+	}
+}
+
+func TestLoadInvalidTimezone(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("timezone: Mars/Olympus_Mons\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for invalid timezone")
+	}
+}
+
+func TestLoadProviderTLS(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		tls  string
+	}{
+		{"cert without key", "cert_file: client.pem"},
+		{"missing cert file", "cert_file: " + filepath.Join(dir, "missing.pem") + "\n      key_file: " + filepath.Join(dir, "missing-key.pem")},
+		{"ca file without certificates", "ca_file: " + filepath.Join(dir, "config.yaml")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "config.yaml")
+			data := "providers:\n  - name: gateway\n    url: https://gateway.internal\n    tls:\n      " + tt.tls + "\n"
+			if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoadMCPTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{"valid", "mcp:\n  listen: \":9091\"\n  tokens:\n    - name: ops\n      token: abc\n      scopes: [read, audit, write]\n", false},
+		{"unknown scope", "mcp:\n  tokens:\n    - name: ops\n      token: abc\n      scopes: [admin]\n", true},
+		{"empty token", "mcp:\n  tokens:\n    - name: ops\n      scopes: [read]\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadRouteStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		wantErr  bool
+	}{
+		{"default", "", false},
+		{"ordered", "ordered", false},
+		{"latency", "latency", false},
+		{"cheapest", "cheapest", false},
+		{"unknown", "random", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			data := "router:\n  routes:\n    - model: fast\n      strategy: \"" + tt.strategy + "\"\n"
+			if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadCooldown(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{"off", "failures: 0", false},
+		{"set", "failures: 3\n    duration: 30s", false},
+		{"missing duration", "failures: 3", true},
+		{"negative", "failures: -1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			data := "router:\n  cooldown:\n    " + tt.yaml + "\n"
+			if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadUnmatched(t *testing.T) {
+	tests := []struct {
+		name, mode string
+		wantErr    bool
+	}{
+		{"default", "", false},
+		{"first provider", "first_provider", false},
+		{"reject", "reject", false},
+		{"unknown", "drop", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			data := "router:\n  unmatched: \"" + tt.mode + "\"\n"
+			if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadRouteParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr bool
+	}{
+		{"valid", "max_tokens: 1024\n        min_temperature: 0\n        max_temperature: 1\n        set: {user: pario}", false},
+		{"negative max_tokens", "max_tokens: -1", true},
+		{"inverted temperature", "min_temperature: 1\n        max_temperature: 0.5", true},
+		{"reserved field", "set: {model: gpt-4o}", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			data := "router:\n  routes:\n    - model: fast\n      targets:\n        - provider: openai\n      params:\n        " + tt.params + "\n"
+			if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBudgetPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr bool
+	}{
+		{"team", "team: ml", false},
+		{"team with wildcard key", "api_key: \"*\"\n      project: search", false},
+		{"team with key", "api_key: sk-1\n      team: ml", true},
+		{"model pattern", "api_key: \"*\"\n      model: \"o3*\"", false},
+		{"invalid model pattern", "api_key: \"*\"\n      model: \"~o3(\"", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			data := "budget:\n  policies:\n    - " + tt.policy + "\n      max_tokens: 1000\n      period: daily\n"
+			if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRouteModelPattern(t *testing.T) {
+	tests := []struct {
+		pattern, model string
+		want           bool
+	}{
+		{"gpt-4*", "gpt-4o", true},
+		{"gpt-4*", "gpt-4", true},
+		{"gpt-4*", "chatgpt-4o", false},
+		{"gpt-4.?", "gpt-4.1", true},
+		{"gpt-4.?", "gpt-401", false}, // . is literal in globs
+		{"accounts/*/models/*", "accounts/fireworks/models/llama-v3", true},
+		{"~^claude-3", "claude-3-opus", true},
+		{"~sonnet", "claude-3-5-sonnet", true},
+		{"~^claude-3", "anthropic.claude-3-opus", false},
+	}
+	for _, tt := range tests {
+		r := RouteConfig{Model: tt.pattern}
+		if !r.IsPattern() {
+			t.Fatalf("%q: expected a pattern", tt.pattern)
+		}
+		re, err := r.ModelPattern()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := re.MatchString(tt.model); got != tt.want {
+			t.Errorf("%q matching %q = %v, want %v", tt.pattern, tt.model, got, tt.want)
+		}
+	}
+	if (RouteConfig{Model: "gpt-4o"}).IsPattern() {
+		t.Error("plain model name treated as a pattern")
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("router:\n  routes:\n    - model: \"~claude-(\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for invalid regular expression")
+	}
+}
+
+func TestTimeWindowContains(t *testing.T) {
+	// 2026-01-05 is a Monday.
+	at := func(day, hour, min int) time.Time { return time.Date(2026, 1, day, hour, min, 0, 0, time.UTC) }
+	tests := []struct {
+		name string
+		w    TimeWindow
+		t    time.Time
+		want bool
+	}{
+		{"inside", TimeWindow{From: "00:00", To: "06:00"}, at(5, 3, 0), true},
+		{"from inclusive", TimeWindow{From: "00:00", To: "06:00"}, at(5, 0, 0), true},
+		{"to exclusive", TimeWindow{From: "00:00", To: "06:00"}, at(5, 6, 0), false},
+		{"overnight late", TimeWindow{From: "22:00", To: "06:00"}, at(5, 23, 30), true},
+		{"overnight early", TimeWindow{From: "22:00", To: "06:00"}, at(5, 5, 59), true},
+		{"overnight outside", TimeWindow{From: "22:00", To: "06:00"}, at(5, 12, 0), false},
+		{"day matches", TimeWindow{From: "09:00", To: "17:00", Days: []string{"mon"}}, at(5, 10, 0), true},
+		{"day differs", TimeWindow{From: "09:00", To: "17:00", Days: []string{"Tue"}}, at(5, 10, 0), false},
+		// Sunday 22:00 to Monday 06:00 belongs to Sunday.
+		{"overnight day of start", TimeWindow{From: "22:00", To: "06:00", Days: []string{"sun"}}, at(5, 2, 0), true},
+		{"overnight next day", TimeWindow{From: "22:00", To: "06:00", Days: []string{"mon"}}, at(5, 2, 0), false},
+		// 03:00 UTC is 22:00 the day before in New York.
+		{"timezone", TimeWindow{From: "21:00", To: "23:00", Timezone: "America/New_York"}, at(5, 3, 0), true},
+	}
+	for _, tt := range tests {
+		if got := tt.w.Contains(tt.t, time.UTC); got != tt.want {
+			t.Errorf("%s: Contains = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  string
+		wantErr bool
+	}{
+		{"valid", `{from: "00:00", to: "06:00", days: [sat, sun], timezone: UTC}`, false},
+		{"bad time", `{from: "0:00am", to: "06:00"}`, true},
+		{"missing to", `{from: "00:00"}`, true},
+		{"bad day", `{from: "00:00", to: "06:00", days: [someday]}`, true},
+		{"bad timezone", `{from: "00:00", to: "06:00", timezone: Mars/Olympus}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			data := "router:\n  routes:\n    - model: fast\n      targets:\n        - provider: openai\n          schedule: [" + tt.window + "]\n"
+			if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPricing(t *testing.T) {
+	cfg := &Config{
+		Providers: []ProviderConfig{
+			{Name: "openai", Type: "openai"},
+			{Name: "ollama", Type: "openai-compatible"},
+		},
+		Router: RouterConfig{Routes: []RouteConfig{
+			{Model: "llama3", Targets: []RouteTarget{{Provider: "ollama"}}},
+			{Model: "chat", Targets: []RouteTarget{
+				{Provider: "ollama", Model: "qwen2.5:7b"},
+				{Provider: "openai", Model: "gpt-4o-mini"},
+			}},
+			{Model: "priced", Targets: []RouteTarget{{Provider: "ollama", Model: "gpt-4o-mini"}}},
+		}},
+	}
+	cfg.Attribution.Pricing = []models.ModelPricing{{Model: "gpt-4o-mini", PromptCost: 0.15, CompletionCost: 0.6}}
+
+	got := make(map[string]models.ModelPricing)
+	for _, p := range cfg.Pricing() {
+		got[p.Model] = p
+	}
+	if len(got) != 3 {
+		t.Fatalf("pricing = %+v", got)
+	}
+	for _, model := range []string{"llama3", "qwen2.5:7b"} {
+		if p := got[model]; !p.Local || p.PromptCost != 0 || p.CompletionCost != 0 {
+			t.Errorf("%s = %+v, want free local pricing", model, p)
+		}
+	}
+	if p := got["gpt-4o-mini"]; p.Local || p.PromptCost != 0.15 {
+		t.Errorf("explicit pricing overridden: %+v", p)
+	}
+}
+
+func TestLoadRemoteTracker(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{"remote", "tracking:\n  remote:\n    url: http://tracker:9092\n    token: abc\n", false},
+		{"server", "tracking:\n  server:\n    listen: \":9092\"\n    token: abc\n", false},
+		{"remote without token", "tracking:\n  remote:\n    url: http://tracker:9092\n", true},
+		{"server without token", "tracking:\n  server:\n    listen: \":9092\"\n", true},
+		{"both", "tracking:\n  remote:\n    url: http://tracker:9092\n    token: abc\n  server:\n    listen: \":9092\"\n    token: abc\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadSessionExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{"idle timeout", "session:\n  idle_timeout: 4h\n", false},
+		{"idle timeout under gap", "session:\n  gap_timeout: 30m\n  idle_timeout: 10m\n", true},
+		{"no interval", "session:\n  idle_timeout: 4h\n  expiry_interval: 0s\n", true},
+		{"retention without interval", "session:\n  expiry_interval: 0s\nretention:\n  session_days: 30\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadAnomaly(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{"defaults", "anomaly:\n  enabled: true\n", false},
+		{"daily windows", "anomaly:\n  enabled: true\n  window: 24h\n  baseline_windows: 28\n  min_history: 7\n", false},
+		{"disabled ignores settings", "anomaly:\n  window: 1s\n", false},
+		{"short window", "anomaly:\n  enabled: true\n  window: 30s\n", true},
+		{"history beyond baseline", "anomaly:\n  enabled: true\n  baseline_windows: 10\n  min_history: 11\n", true},
+		{"median ratio under one", "anomaly:\n  enabled: true\n  median_ratio: 0.5\n", true},
+		{"no interval", "anomaly:\n  enabled: true\n  interval: 0s\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Watch checks the config file at path every interval until ctx is done,
+// and loads it whenever its contents change. Each load is passed to fn:
+// the new config, or the error that kept it from loading. A file that
+// fails to load is retried only after it changes again. The contents are
+// compared rather than modification times, so saving an unchanged file is
+// not a reload and editors that replace the file are still seen.
+func Watch(ctx context.Context, path string, interval time.Duration, fn func(*Config, error)) {
+	last, err := os.ReadFile(path)
+	if err != nil {
+		fn(nil, fmt.Errorf("watch config: %w", err))
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			// Editors may briefly remove the file while saving it.
+			continue
+		}
+		if bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+		fn(Load(path))
+	}
+}
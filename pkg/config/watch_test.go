@@ -0,0 +1,70 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("listen: \":8080\"\n")
+
+	type load struct {
+		cfg *Config
+		err error
+	}
+	loads := make(chan load, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Watch(ctx, path, 5*time.Millisecond, func(cfg *Config, err error) { loads <- load{cfg, err} })
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	next := func() load {
+		t.Helper()
+		select {
+		case l := <-loads:
+			return l
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for reload")
+			return load{}
+		}
+	}
+
+	// Give Watch time to read the starting contents.
+	time.Sleep(20 * time.Millisecond)
+	write("listen: \":9090\"\n")
+	if l := next(); l.err != nil || l.cfg.Listen != ":9090" {
+		t.Fatalf("expected reload with :9090, got %+v", l)
+	}
+
+	write("router:\n  unmatched: drop\n")
+	if l := next(); l.err == nil {
+		t.Fatal("expected invalid config reported")
+	}
+
+	// Rewriting identical contents is not a change.
+	write("router:\n  unmatched: drop\n")
+	write("listen: \":7070\"\n")
+	if l := next(); l.err != nil || l.cfg.Listen != ":7070" {
+		t.Fatalf("expected reload with :7070, got %+v", l)
+	}
+	select {
+	case l := <-loads:
+		t.Errorf("unexpected extra reload %+v", l)
+	case <-time.After(30 * time.Millisecond):
+	}
+}
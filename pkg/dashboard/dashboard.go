@@ -0,0 +1,29 @@
+// Package dashboard serves Pario's built-in web dashboard: a single static
+// page that reads budgets, usage, and the live request feed from the admin
+// API. The page holds no data itself; every API call carries the admin token
+// the operator enters in the browser.
+package dashboard
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed index.html
+var page []byte
+
+// Handler serves the dashboard page.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+		w.Header().Set("X-Frame-Options", "DENY")
+		_, _ = w.Write(page)
+	})
+}
@@ -0,0 +1,168 @@
+// Package dbmaint runs routine SQLite maintenance (WAL checkpoint, ANALYZE,
+// VACUUM) for Pario's stores. Deletes from retention pruning leave free pages
+// behind; VACUUM returns them to the filesystem.
+package dbmaint
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// IndexStat is one row of sqlite_stat1 as produced by ANALYZE.
+type IndexStat struct {
+	Table string `json:"table"`
+	Index string `json:"index"`
+	Stat  string `json:"stat"`
+}
+
+// Report describes the outcome of a maintenance run on one database.
+type Report struct {
+	SizeBefore int64         `json:"size_before"`
+	SizeAfter  int64         `json:"size_after"`
+	FreePages  int64         `json:"free_pages"`
+	Indexes    []IndexStat   `json:"indexes"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// Reclaimed returns the number of bytes freed by the run.
+func (r Report) Reclaimed() int64 {
+	if r.SizeAfter >= r.SizeBefore {
+		return 0
+	}
+	return r.SizeBefore - r.SizeAfter
+}
+
+// Maintainer is a store that can run maintenance on its database.
+type Maintainer interface {
+	Maintain(ctx context.Context) (Report, error)
+	Vacuum(ctx context.Context) (Report, error)
+	Analyze(ctx context.Context) (Report, error)
+	DBStats(ctx context.Context) (Stats, error)
+}
+
+// Run checkpoints the WAL, refreshes planner statistics, and vacuums db.
+func Run(ctx context.Context, db *sql.DB) (Report, error) {
+	return run(ctx, db, true, true)
+}
+
+// Vacuum checkpoints the WAL and vacuums db, returning its free pages to
+// the filesystem.
+func Vacuum(ctx context.Context, db *sql.DB) (Report, error) {
+	return run(ctx, db, false, true)
+}
+
+// Analyze refreshes planner statistics for db and reports them. The file
+// keeps its size.
+func Analyze(ctx context.Context, db *sql.DB) (Report, error) {
+	return run(ctx, db, true, false)
+}
+
+func run(ctx context.Context, db *sql.DB, analyze, vacuum bool) (Report, error) {
+	start := time.Now()
+	var rep Report
+
+	before, free, err := size(ctx, db)
+	if err != nil {
+		return rep, err
+	}
+	rep.SizeBefore = before
+	rep.FreePages = free
+
+	if vacuum {
+		// wal_checkpoint is a no-op for databases not in WAL mode.
+		if _, err := db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+			return rep, fmt.Errorf("wal checkpoint: %w", err)
+		}
+	}
+	if analyze {
+		if _, err := db.ExecContext(ctx, `ANALYZE`); err != nil {
+			return rep, fmt.Errorf("analyze: %w", err)
+		}
+	}
+	if vacuum {
+		if _, err := db.ExecContext(ctx, `VACUUM`); err != nil {
+			return rep, fmt.Errorf("vacuum: %w", err)
+		}
+	}
+
+	after, _, err := size(ctx, db)
+	if err != nil {
+		return rep, err
+	}
+	rep.SizeAfter = after
+
+	rep.Indexes, err = indexStats(ctx, db)
+	if err != nil {
+		return rep, err
+	}
+	rep.Duration = time.Since(start)
+	return rep, nil
+}
+
+// size returns the database size in bytes and the number of free pages.
+func size(ctx context.Context, db *sql.DB) (bytes, freePages int64, err error) {
+	var pageCount, pageSize int64
+	if err := db.QueryRowContext(ctx, `PRAGMA page_count`).Scan(&pageCount); err != nil {
+		return 0, 0, fmt.Errorf("page count: %w", err)
+	}
+	if err := db.QueryRowContext(ctx, `PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return 0, 0, fmt.Errorf("page size: %w", err)
+	}
+	if err := db.QueryRowContext(ctx, `PRAGMA freelist_count`).Scan(&freePages); err != nil {
+		return 0, 0, fmt.Errorf("freelist count: %w", err)
+	}
+	return pageCount * pageSize, freePages, nil
+}
+
+func indexStats(ctx context.Context, db *sql.DB) ([]IndexStat, error) {
+	var exists int
+	if err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'sqlite_stat1'`,
+	).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("index stats: %w", err)
+	}
+	if exists == 0 {
+		return nil, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT tbl, COALESCE(idx, ''), stat FROM sqlite_stat1 ORDER BY tbl, idx`)
+	if err != nil {
+		return nil, fmt.Errorf("index stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []IndexStat
+	for rows.Next() {
+		var s IndexStat
+		if err := rows.Scan(&s.Table, &s.Index, &s.Stat); err != nil {
+			return nil, fmt.Errorf("scan index stat: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// Loop runs Maintain on each named store every interval until ctx is done.
+// Failures are logged and retried on the next tick.
+func Loop(ctx context.Context, interval time.Duration, stores map[string]Maintainer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for name, m := range stores {
+				rep, err := m.Maintain(ctx)
+				if err != nil {
+					log.Printf("db maintenance %s: %v", name, err)
+					continue
+				}
+				log.Printf("db maintenance %s: reclaimed %d bytes in %s", name, rep.Reclaimed(), rep.Duration.Round(time.Millisecond))
+			}
+		}
+	}
+}
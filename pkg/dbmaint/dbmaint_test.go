@@ -0,0 +1,104 @@
+package dbmaint
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestRunReclaimsSpace(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "maint.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, err := db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT); CREATE INDEX idx_t_v ON t(v)`); err != nil {
+		t.Fatal(err)
+	}
+	pad := strings.Repeat("x", 1000)
+	for i := range 500 {
+		if _, err := db.Exec(`INSERT INTO t (id, v) VALUES (?, ?)`, i, pad); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`DELETE FROM t WHERE id >= 10`); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := Run(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.FreePages == 0 {
+		t.Error("expected free pages before vacuum")
+	}
+	if rep.Reclaimed() <= 0 {
+		t.Errorf("expected space reclaimed, before=%d after=%d", rep.SizeBefore, rep.SizeAfter)
+	}
+	found := false
+	for _, s := range rep.Indexes {
+		if s.Index == "idx_t_v" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected index stats for idx_t_v, got %+v", rep.Indexes)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "prune.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, err := db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	pad := strings.Repeat("x", 1000)
+	for i := range 100 {
+		if _, err := db.Exec(`INSERT INTO t (id, v) VALUES (?, ?)`, i, pad); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		dryRun   bool
+		wantRows int64
+		wantLeft int
+	}{
+		{"dry run", true, 40, 100},
+		{"delete", false, 40, 60},
+		{"nothing left", false, 0, 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Prune(ctx, db, "t", "id < ?", tt.dryRun, 40)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Rows != tt.wantRows {
+				t.Errorf("Rows = %d, want %d", res.Rows, tt.wantRows)
+			}
+			if tt.wantRows > 0 && res.Bytes < tt.wantRows*1000 {
+				t.Errorf("Bytes = %d, want at least %d", res.Bytes, tt.wantRows*1000)
+			}
+			var left int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM t`).Scan(&left); err != nil {
+				t.Fatal(err)
+			}
+			if left != tt.wantLeft {
+				t.Errorf("rows left = %d, want %d", left, tt.wantLeft)
+			}
+		})
+	}
+}
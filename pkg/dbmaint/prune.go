@@ -0,0 +1,70 @@
+package dbmaint
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// PruneResult reports the rows a retention pass removed from one table, or
+// would remove on a dry run.
+type PruneResult struct {
+	Rows int64 `json:"rows"`
+	// Bytes estimates the space the rows occupy, including their share of
+	// the table's indexes. It is freed for reuse immediately and returned to
+	// the filesystem by the next VACUUM.
+	Bytes  int64 `json:"bytes"`
+	DryRun bool  `json:"dry_run"`
+}
+
+// Prune deletes rows from table matching where (a SQL condition using args).
+// With dryRun set it only counts them. The table name must be a trusted
+// constant.
+func Prune(ctx context.Context, db *sql.DB, table, where string, dryRun bool, args ...any) (PruneResult, error) {
+	res := PruneResult{DryRun: dryRun}
+
+	if err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM `+table+` WHERE `+where, args...,
+	).Scan(&res.Rows); err != nil {
+		return res, fmt.Errorf("count %s: %w", table, err)
+	}
+	if res.Rows == 0 {
+		return res, nil
+	}
+
+	var err error
+	if res.Bytes, err = estimateBytes(ctx, db, table, res.Rows); err != nil {
+		return res, err
+	}
+	if dryRun {
+		return res, nil
+	}
+
+	r, err := db.ExecContext(ctx, `DELETE FROM `+table+` WHERE `+where, args...)
+	if err != nil {
+		return res, fmt.Errorf("prune %s: %w", table, err)
+	}
+	if res.Rows, err = r.RowsAffected(); err != nil {
+		return res, fmt.Errorf("prune %s: %w", table, err)
+	}
+	return res, nil
+}
+
+// estimateBytes prorates the pages used by table and its indexes over the
+// share of rows being removed.
+func estimateBytes(ctx context.Context, db *sql.DB, table string, rows int64) (int64, error) {
+	var total int64
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table).Scan(&total); err != nil {
+		return 0, fmt.Errorf("count %s: %w", table, err)
+	}
+	var size sql.NullInt64
+	if err := db.QueryRowContext(ctx,
+		`SELECT SUM(pgsize) FROM dbstat WHERE name IN (SELECT name FROM sqlite_master WHERE tbl_name = ?)`, table,
+	).Scan(&size); err != nil {
+		return 0, fmt.Errorf("size %s: %w", table, err)
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	return size.Int64 * rows / total, nil
+}
@@ -0,0 +1,133 @@
+package dbmaint
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Stats describes the size of a database and of each of its tables.
+type Stats struct {
+	// Size is the main file's size in bytes, of which FreePages pages of
+	// PageSize bytes are free and would be reclaimed by a VACUUM.
+	Size      int64 `json:"size"`
+	PageSize  int64 `json:"page_size"`
+	FreePages int64 `json:"free_pages"`
+	// WALSize is the bytes of write-ahead log not yet checkpointed into
+	// the main file. It is 0 outside WAL mode.
+	WALSize int64        `json:"wal_size"`
+	Tables  []TableStats `json:"tables"`
+}
+
+// Free returns the bytes a VACUUM would reclaim.
+func (s Stats) Free() int64 {
+	return s.FreePages * s.PageSize
+}
+
+// TableStats describes one table and its indexes.
+type TableStats struct {
+	Name    string       `json:"name"`
+	Rows    int64        `json:"rows"`
+	Bytes   int64        `json:"bytes"`
+	Indexes []IndexStats `json:"indexes"`
+}
+
+// IndexStats describes one index. Stat is its sqlite_stat1 row from the
+// last ANALYZE, empty if the index has not been analyzed since it was
+// created; the planner then guesses at its selectivity.
+type IndexStats struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+	Stat  string `json:"stat"`
+}
+
+// Analyzed reports whether the index has statistics.
+func (s IndexStats) Analyzed() bool {
+	return s.Stat != ""
+}
+
+// ReadStats reports the size of db and of each table and index in it, from
+// SQLite's dbstat page counts. It counts every table's rows, so it reads the
+// whole database.
+func ReadStats(ctx context.Context, db *sql.DB) (Stats, error) {
+	var s Stats
+	var err error
+	if s.Size, s.FreePages, err = size(ctx, db); err != nil {
+		return s, err
+	}
+	if err := db.QueryRowContext(ctx, `PRAGMA page_size`).Scan(&s.PageSize); err != nil {
+		return s, fmt.Errorf("page size: %w", err)
+	}
+	// wal_checkpoint(PASSIVE) reports the frames in the log without
+	// blocking writers. Outside WAL mode it reports -1.
+	var busy, frames, checkpointed int64
+	if err := db.QueryRowContext(ctx, `PRAGMA wal_checkpoint(PASSIVE)`).Scan(&busy, &frames, &checkpointed); err != nil {
+		return s, fmt.Errorf("wal size: %w", err)
+	}
+	if frames > 0 {
+		s.WALSize = frames * s.PageSize
+	}
+
+	bytes := make(map[string]int64)
+	rows, err := db.QueryContext(ctx, `SELECT name, SUM(pgsize) FROM dbstat GROUP BY name`)
+	if err != nil {
+		return s, fmt.Errorf("object sizes: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		var n int64
+		if err := rows.Scan(&name, &n); err != nil {
+			rows.Close()
+			return s, fmt.Errorf("scan object size: %w", err)
+		}
+		bytes[name] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return s, fmt.Errorf("object sizes: %w", err)
+	}
+
+	stats := make(map[string]string)
+	analyzed, err := indexStats(ctx, db)
+	if err != nil {
+		return s, err
+	}
+	for _, st := range analyzed {
+		stats[st.Index] = st.Stat
+	}
+
+	rows, err = db.QueryContext(ctx,
+		`SELECT m.name, COALESCE(i.name, '') FROM sqlite_master m
+		 LEFT JOIN sqlite_master i ON i.type = 'index' AND i.tbl_name = m.name
+		 WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'
+		 ORDER BY m.name, i.name`)
+	if err != nil {
+		return s, fmt.Errorf("list tables: %w", err)
+	}
+	for rows.Next() {
+		var table, index string
+		if err := rows.Scan(&table, &index); err != nil {
+			rows.Close()
+			return s, fmt.Errorf("scan table: %w", err)
+		}
+		if n := len(s.Tables); n == 0 || s.Tables[n-1].Name != table {
+			s.Tables = append(s.Tables, TableStats{Name: table, Bytes: bytes[table]})
+		}
+		if index != "" {
+			t := &s.Tables[len(s.Tables)-1]
+			t.Indexes = append(t.Indexes, IndexStats{Name: index, Bytes: bytes[index], Stat: stats[index]})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return s, fmt.Errorf("list tables: %w", err)
+	}
+
+	for i := range s.Tables {
+		t := &s.Tables[i]
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM "`+t.Name+`"`).Scan(&t.Rows); err != nil {
+			return s, fmt.Errorf("count %s: %w", t.Name, err)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,75 @@
+package dbmaint
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestStatsVacuumAnalyze(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "stats.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, err := db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT); CREATE INDEX idx_t_v ON t(v); CREATE TABLE empty (id INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	pad := strings.Repeat("x", 1000)
+	for i := range 200 {
+		if _, err := db.Exec(`INSERT INTO t (id, v) VALUES (?, ?)`, i, pad); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`DELETE FROM t WHERE id >= 50`); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := ReadStats(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Tables) != 2 || s.Tables[0].Name != "empty" || s.Tables[1].Name != "t" {
+		t.Fatalf("tables = %+v", s.Tables)
+	}
+	tbl := s.Tables[1]
+	if tbl.Rows != 50 || tbl.Bytes < 50*1000 || len(tbl.Indexes) != 1 || tbl.Indexes[0].Name != "idx_t_v" || tbl.Indexes[0].Bytes == 0 {
+		t.Errorf("table t = %+v", tbl)
+	}
+	if tbl.Indexes[0].Analyzed() {
+		t.Error("index analyzed before ANALYZE")
+	}
+	if s.Free() == 0 || s.Size < s.Free() {
+		t.Errorf("size = %d, free = %d; want free pages after the delete", s.Size, s.Free())
+	}
+
+	// Analyze gathers statistics and leaves the free pages.
+	rep, err := Analyze(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Reclaimed() != 0 || len(rep.Indexes) == 0 {
+		t.Errorf("analyze = %+v", rep)
+	}
+	if s, _ = ReadStats(ctx, db); !s.Tables[1].Indexes[0].Analyzed() {
+		t.Errorf("index not analyzed after ANALYZE: %+v", s.Tables[1].Indexes[0])
+	}
+
+	// Vacuum returns them.
+	rep, err = Vacuum(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Reclaimed() <= 0 {
+		t.Errorf("vacuum reclaimed nothing: %+v", rep)
+	}
+	if s, _ = ReadStats(ctx, db); s.Free() != 0 {
+		t.Errorf("free after vacuum = %d", s.Free())
+	}
+}
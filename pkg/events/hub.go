@@ -0,0 +1,84 @@
+// Package events fans out live events, such as completed proxy requests
+// and stored usage records, to subscribers like the admin event streams.
+package events
+
+import "sync"
+
+// Hub broadcasts events of type T to subscribers. Publishing never blocks: a
+// subscriber whose buffer is full misses the event and its drop count grows.
+type Hub[T any] struct {
+	mu   sync.RWMutex
+	subs map[*Subscription[T]]struct{}
+}
+
+// Subscription receives events from a Hub until it is closed.
+type Subscription[T any] struct {
+	C <-chan T
+
+	hub     *Hub[T]
+	ch      chan T
+	once    sync.Once
+	mu      sync.Mutex
+	dropped int64
+}
+
+// NewHub creates an empty Hub.
+func NewHub[T any]() *Hub[T] {
+	return &Hub[T]{subs: make(map[*Subscription[T]]struct{})}
+}
+
+// Subscribe registers a subscriber with room for buffer pending events.
+func (h *Hub[T]) Subscribe(buffer int) *Subscription[T] {
+	ch := make(chan T, buffer)
+	sub := &Subscription[T]{C: ch, hub: h, ch: ch}
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+// Active reports whether anyone is subscribed, so publishers can skip
+// building events nobody will read.
+func (h *Hub[T]) Active() bool {
+	if h == nil {
+		return false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs) > 0
+}
+
+// Publish delivers ev to every subscriber with buffer space.
+func (h *Hub[T]) Publish(ev T) {
+	if h == nil {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subs {
+		select {
+		case sub.ch <- ev:
+		default:
+			sub.mu.Lock()
+			sub.dropped++
+			sub.mu.Unlock()
+		}
+	}
+}
+
+// Dropped returns the number of events missed because the buffer was full.
+func (s *Subscription[T]) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close unsubscribes and closes C. It is safe to call more than once.
+func (s *Subscription[T]) Close() {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		delete(s.hub.subs, s)
+		s.hub.mu.Unlock()
+		close(s.ch)
+	})
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestHub(t *testing.T) {
+	h := NewHub[models.RequestEvent]()
+	if h.Active() {
+		t.Fatal("new hub should have no subscribers")
+	}
+
+	a := h.Subscribe(1)
+	b := h.Subscribe(4)
+	if !h.Active() {
+		t.Fatal("expected active hub")
+	}
+
+	h.Publish(models.RequestEvent{RequestID: "r1"})
+	h.Publish(models.RequestEvent{RequestID: "r2"})
+
+	if ev := <-a.C; ev.RequestID != "r1" {
+		t.Errorf("a got %q, want r1", ev.RequestID)
+	}
+	if a.Dropped() != 1 {
+		t.Errorf("a dropped = %d, want 1", a.Dropped())
+	}
+	for _, want := range []string{"r1", "r2"} {
+		if ev := <-b.C; ev.RequestID != want {
+			t.Errorf("b got %q, want %s", ev.RequestID, want)
+		}
+	}
+
+	a.Close()
+	a.Close()
+	if _, ok := <-a.C; ok {
+		t.Error("expected closed channel")
+	}
+	b.Close()
+	if h.Active() {
+		t.Error("expected no subscribers after close")
+	}
+	h.Publish(models.RequestEvent{RequestID: "r3"})
+}
+
+func TestNilHub(t *testing.T) {
+	var h *Hub[models.RequestEvent]
+	if h.Active() {
+		t.Error("nil hub should be inactive")
+	}
+	h.Publish(models.RequestEvent{})
+}
@@ -0,0 +1,197 @@
+// Package importer backfills usage from provider organization usage APIs so
+// reports cover the period before Pario was deployed.
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// Source fetches historical usage from a provider, one record per model per
+// daily bucket.
+type Source interface {
+	// Provider returns the provider name stored on imported records.
+	Provider() string
+	// Fetch returns usage records for buckets starting in [since, until).
+	Fetch(ctx context.Context, since, until time.Time) ([]models.UsageRecord, error)
+}
+
+// APIKey is the api_key value stored on imported records, since usage
+// exports aggregate across keys.
+func APIKey(provider string) string {
+	return "imported:" + provider
+}
+
+// OpenAI reads the OpenAI organization completions usage API. It requires an
+// admin API key.
+type OpenAI struct {
+	BaseURL  string
+	AdminKey string
+	Client   *http.Client
+}
+
+// Provider implements Source.
+func (o *OpenAI) Provider() string { return "openai" }
+
+type openAIPage struct {
+	Data []struct {
+		StartTime int64 `json:"start_time"`
+		Results   []struct {
+			Model             string `json:"model"`
+			InputTokens       int    `json:"input_tokens"`
+			InputCachedTokens int    `json:"input_cached_tokens"`
+			OutputTokens      int    `json:"output_tokens"`
+		} `json:"results"`
+	} `json:"data"`
+	HasMore  bool   `json:"has_more"`
+	NextPage string `json:"next_page"`
+}
+
+// Fetch implements Source.
+func (o *OpenAI) Fetch(ctx context.Context, since, until time.Time) ([]models.UsageRecord, error) {
+	base := o.BaseURL
+	if base == "" {
+		base = "https://api.openai.com"
+	}
+	q := url.Values{}
+	q.Set("start_time", fmt.Sprint(since.Unix()))
+	q.Set("end_time", fmt.Sprint(until.Unix()))
+	q.Set("bucket_width", "1d")
+	q.Set("group_by", "model")
+	q.Set("limit", "31")
+
+	var recs []models.UsageRecord
+	for {
+		var page openAIPage
+		header := http.Header{"Authorization": {"Bearer " + o.AdminKey}}
+		if err := getJSON(ctx, o.Client, base+"/v1/organization/usage/completions?"+q.Encode(), header, &page); err != nil {
+			return nil, fmt.Errorf("openai usage: %w", err)
+		}
+		for _, b := range page.Data {
+			for _, r := range b.Results {
+				recs = append(recs, models.UsageRecord{
+					APIKey:           APIKey(o.Provider()),
+					Model:            r.Model,
+					PromptTokens:     r.InputTokens,
+					CompletionTokens: r.OutputTokens,
+					TotalTokens:      r.InputTokens + r.OutputTokens,
+					CacheReadTokens:  r.InputCachedTokens,
+					CreatedAt:        time.Unix(b.StartTime, 0).UTC(),
+				})
+			}
+		}
+		if !page.HasMore || page.NextPage == "" {
+			return recs, nil
+		}
+		q.Set("page", page.NextPage)
+	}
+}
+
+// Anthropic reads the Anthropic Admin API messages usage report. It requires
+// an admin API key.
+type Anthropic struct {
+	BaseURL  string
+	AdminKey string
+	Client   *http.Client
+}
+
+// Provider implements Source.
+func (a *Anthropic) Provider() string { return "anthropic" }
+
+type anthropicPage struct {
+	Data []struct {
+		StartingAt time.Time `json:"starting_at"`
+		Results    []struct {
+			Model                string `json:"model"`
+			UncachedInputTokens  int    `json:"uncached_input_tokens"`
+			CacheReadInputTokens int    `json:"cache_read_input_tokens"`
+			CacheCreation        struct {
+				Ephemeral1h int `json:"ephemeral_1h_input_tokens"`
+				Ephemeral5m int `json:"ephemeral_5m_input_tokens"`
+			} `json:"cache_creation"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"results"`
+	} `json:"data"`
+	HasMore  bool   `json:"has_more"`
+	NextPage string `json:"next_page"`
+}
+
+// Fetch implements Source.
+func (a *Anthropic) Fetch(ctx context.Context, since, until time.Time) ([]models.UsageRecord, error) {
+	base := a.BaseURL
+	if base == "" {
+		base = "https://api.anthropic.com"
+	}
+	q := url.Values{}
+	q.Set("starting_at", since.UTC().Format(time.RFC3339))
+	q.Set("ending_at", until.UTC().Format(time.RFC3339))
+	q.Set("bucket_width", "1d")
+	q.Set("group_by[]", "model")
+	q.Set("limit", "31")
+
+	var recs []models.UsageRecord
+	for {
+		var page anthropicPage
+		header := http.Header{
+			"X-Api-Key":         {a.AdminKey},
+			"Anthropic-Version": {"2023-06-01"},
+		}
+		if err := getJSON(ctx, a.Client, base+"/v1/organizations/usage_report/messages?"+q.Encode(), header, &page); err != nil {
+			return nil, fmt.Errorf("anthropic usage: %w", err)
+		}
+		for _, b := range page.Data {
+			for _, r := range b.Results {
+				prompt := r.UncachedInputTokens + r.CacheReadInputTokens + r.CacheCreation.Ephemeral1h + r.CacheCreation.Ephemeral5m
+				recs = append(recs, models.UsageRecord{
+					APIKey:              APIKey(a.Provider()),
+					Model:               r.Model,
+					PromptTokens:        prompt,
+					CompletionTokens:    r.OutputTokens,
+					TotalTokens:         prompt + r.OutputTokens,
+					CacheReadTokens:     r.CacheReadInputTokens,
+					CacheCreationTokens: r.CacheCreation.Ephemeral1h + r.CacheCreation.Ephemeral5m,
+					CreatedAt:           b.StartingAt.UTC(),
+				})
+			}
+		}
+		if !page.HasMore || page.NextPage == "" {
+			return recs, nil
+		}
+		q.Set("page", page.NextPage)
+	}
+}
+
+// getJSON issues a GET request and decodes a JSON response into v.
+func getJSON(ctx context.Context, client *http.Client, rawURL string, header http.Header, v any) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	for k, vals := range header {
+		req.Header[k] = vals
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
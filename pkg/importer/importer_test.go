@@ -0,0 +1,89 @@
+package importer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOpenAIFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/organization/usage/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-admin" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if r.URL.Query().Get("page") == "" {
+			_, _ = w.Write([]byte(`{"data":[{"start_time":1735689600,"results":[
+				{"model":"gpt-4o","input_tokens":100,"output_tokens":20},
+				{"model":"gpt-4o-mini","input_tokens":50,"output_tokens":5}]}],
+				"has_more":true,"next_page":"p2"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":[{"start_time":1735776000,"results":[
+			{"model":"gpt-4o","input_tokens":10,"output_tokens":2}]}],"has_more":false}`))
+	}))
+	defer srv.Close()
+
+	src := &OpenAI{BaseURL: srv.URL, AdminKey: "sk-admin"}
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	recs, err := src.Fetch(context.Background(), since, since.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(recs))
+	}
+	if recs[0].Model != "gpt-4o" || recs[0].TotalTokens != 120 || !recs[0].CreatedAt.Equal(since) {
+		t.Errorf("unexpected first record: %+v", recs[0])
+	}
+	if recs[2].APIKey != "imported:openai" || !recs[2].CreatedAt.Equal(since.AddDate(0, 0, 1)) {
+		t.Errorf("unexpected last record: %+v", recs[2])
+	}
+}
+
+func TestAnthropicFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/organizations/usage_report/messages" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("x-api-key"); got != "sk-ant-admin" {
+			t.Errorf("x-api-key = %q", got)
+		}
+		_, _ = w.Write([]byte(`{"data":[{"starting_at":"2025-01-01T00:00:00Z","ending_at":"2025-01-02T00:00:00Z","results":[
+			{"model":"claude-sonnet-4-20250514","uncached_input_tokens":100,"cache_read_input_tokens":40,
+			 "cache_creation":{"ephemeral_1h_input_tokens":5,"ephemeral_5m_input_tokens":5},"output_tokens":30}]}],
+			"has_more":false}`))
+	}))
+	defer srv.Close()
+
+	src := &Anthropic{BaseURL: srv.URL, AdminKey: "sk-ant-admin"}
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	recs, err := src.Fetch(context.Background(), since, since.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(recs))
+	}
+	r := recs[0]
+	if r.PromptTokens != 150 || r.CompletionTokens != 30 || r.TotalTokens != 180 || !r.CreatedAt.Equal(since) ||
+		r.CacheReadTokens != 40 || r.CacheCreationTokens != 10 {
+		t.Errorf("unexpected record: %+v", r)
+	}
+}
+
+func TestFetchError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	src := &OpenAI{BaseURL: srv.URL, AdminKey: "bad"}
+	if _, err := src.Fetch(context.Background(), time.Now().AddDate(0, 0, -1), time.Now()); err == nil {
+		t.Fatal("expected error for 403 response")
+	}
+}
@@ -0,0 +1,75 @@
+// Package jsonbody edits top-level fields of JSON request bodies in place.
+//
+// Request bodies are forwarded as received. Decoding into a map and
+// re-encoding would reorder keys, drop duplicates, and re-escape strings,
+// which changes what the provider sees (and breaks provider-side prompt
+// caching keyed on exact bytes). Edits instead splice a single field's
+// value into the original bytes.
+package jsonbody
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// FieldSpan returns the byte range of the value of key in the top-level
+// JSON object body. found is false when the object has no such key. With
+// duplicate keys, the last one wins, as in encoding/json.
+func FieldSpan(body []byte, key string) (start, end int, found bool, err error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	tok, err := dec.Token()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return 0, 0, false, errors.New("body is not a JSON object")
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, 0, false, err
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return 0, 0, false, err
+		}
+		if k, _ := tok.(string); k == key {
+			end = int(dec.InputOffset())
+			start, found = end-len(v), true
+		}
+	}
+	return start, end, found, nil
+}
+
+// SetField sets the top-level field key of the JSON object body to the
+// encoded value, replacing it in place or adding it first.
+func SetField(body []byte, key string, value []byte) ([]byte, error) {
+	start, end, found, err := FieldSpan(body, key)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	if found {
+		out = make([]byte, 0, len(body)-(end-start)+len(value))
+		out = append(out, body[:start]...)
+		out = append(out, value...)
+		return append(out, body[end:]...), nil
+	}
+
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	open := bytes.IndexByte(body, '{') + 1
+	rest := body[open:]
+	out = make([]byte, 0, len(body)+len(keyJSON)+len(value)+2)
+	out = append(out, body[:open]...)
+	out = append(out, keyJSON...)
+	out = append(out, ':')
+	out = append(out, value...)
+	if t := bytes.TrimSpace(rest); len(t) > 0 && t[0] != '}' {
+		out = append(out, ',')
+	}
+	return append(out, rest...), nil
+}
@@ -0,0 +1,34 @@
+package jsonbody
+
+import "testing"
+
+func TestSetField(t *testing.T) {
+	tests := []struct {
+		name, body, want string
+	}{
+		{"replace", `{"model":"a","messages":[]}`, `{"model":"b","messages":[]}`},
+		{"keeps order and spacing", `{ "seed": 7,  "model" : "a" , "z":1}`, `{ "seed": 7,  "model" : "b" , "z":1}`},
+		{"keeps escapes", `{"content":"<b>é</b>","model":"a"}`, `{"content":"<b>é</b>","model":"b"}`},
+		{"nested model untouched", `{"tools":[{"model":"x"}],"model":"a"}`, `{"tools":[{"model":"x"}],"model":"b"}`},
+		{"last duplicate", `{"model":"a","model":"c"}`, `{"model":"a","model":"b"}`},
+		{"insert", `{"messages":[]}`, `{"model":"b","messages":[]}`},
+		{"insert empty", ` { } `, ` {"model":"b" } `},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SetField([]byte(tt.body), "model", []byte(`"b"`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	for _, body := range []string{`[]`, `"x"`, `{"model":`, ``} {
+		if _, err := SetField([]byte(body), "model", []byte(`"b"`)); err == nil {
+			t.Errorf("SetField(%q): expected error", body)
+		}
+	}
+}
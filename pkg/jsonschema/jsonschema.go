@@ -0,0 +1,325 @@
+// Package jsonschema validates decoded JSON values against the subset of
+// JSON Schema used for LLM structured outputs: type, enum, const,
+// properties, required, additionalProperties, items, min/max bounds,
+// pattern, anyOf/oneOf/allOf, and local $ref into $defs or definitions.
+// Unknown keywords are ignored.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ValidationError reports where a value failed validation.
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Validate checks v, as produced by json.Unmarshal into an any, against
+// schema. It returns a *ValidationError for the first violation found.
+func Validate(schema map[string]any, v any) error {
+	return (&validator{root: schema}).validate(schema, v, "$")
+}
+
+// ValidateJSON decodes data and validates it against schema.
+func ValidateJSON(schema map[string]any, data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return &ValidationError{Path: "$", Message: "not valid JSON: " + err.Error()}
+	}
+	return Validate(schema, v)
+}
+
+type validator struct {
+	root  map[string]any
+	depth int
+}
+
+// maxDepth bounds $ref recursion on self-referential schemas.
+const maxDepth = 64
+
+func fail(path, format string, args ...any) error {
+	return &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)}
+}
+
+func (vd *validator) validate(s map[string]any, v any, path string) error {
+	vd.depth++
+	defer func() { vd.depth-- }()
+	if vd.depth > maxDepth {
+		return fail(path, "schema nesting too deep")
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := vd.resolve(ref)
+		if err != nil {
+			return fail(path, "%v", err)
+		}
+		if err := vd.validate(target, v, path); err != nil {
+			return err
+		}
+	}
+
+	if t, ok := s["type"]; ok {
+		if err := checkType(t, v, path); err != nil {
+			return err
+		}
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fail(path, "value not in enum")
+		}
+	}
+	if c, ok := s["const"]; ok && !reflect.DeepEqual(c, v) {
+		return fail(path, "value does not match const")
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		if err := vd.object(s, val, path); err != nil {
+			return err
+		}
+	case []any:
+		if err := vd.array(s, val, path); err != nil {
+			return err
+		}
+	case string:
+		if err := checkString(s, val, path); err != nil {
+			return err
+		}
+	case float64:
+		if err := checkNumber(s, val, path); err != nil {
+			return err
+		}
+	}
+
+	if all, ok := s["allOf"].([]any); ok {
+		for _, sub := range all {
+			if m, ok := sub.(map[string]any); ok {
+				if err := vd.validate(m, v, path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]any); ok && vd.matches(anyOf, v, path) == 0 {
+		return fail(path, "value matches none of anyOf")
+	}
+	if oneOf, ok := s["oneOf"].([]any); ok {
+		if n := vd.matches(oneOf, v, path); n != 1 {
+			return fail(path, "value matches %d of oneOf, want exactly 1", n)
+		}
+	}
+	return nil
+}
+
+func (vd *validator) matches(schemas []any, v any, path string) int {
+	n := 0
+	for _, sub := range schemas {
+		if m, ok := sub.(map[string]any); ok && vd.validate(m, v, path) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (vd *validator) resolve(ref string) (map[string]any, error) {
+	if ref == "#" {
+		return vd.root, nil
+	}
+	rest, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	var cur any = vd.root
+	for _, part := range strings.Split(rest, "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		cur = m[part]
+	}
+	m, ok := cur.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+	return m, nil
+}
+
+func checkType(t any, v any, path string) error {
+	var types []string
+	switch tt := t.(type) {
+	case string:
+		types = []string{tt}
+	case []any:
+		for _, x := range tt {
+			if s, ok := x.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+	for _, want := range types {
+		if typeMatches(want, v) {
+			return nil
+		}
+	}
+	return fail(path, "expected %s, got %s", strings.Join(types, " or "), typeName(v))
+}
+
+func typeMatches(want string, v any) bool {
+	switch want {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return false
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func (vd *validator) object(s map[string]any, obj map[string]any, path string) error {
+	if req, ok := s["required"].([]any); ok {
+		for _, r := range req {
+			if name, ok := r.(string); ok {
+				if _, present := obj[name]; !present {
+					return fail(path, "missing required property %q", name)
+				}
+			}
+		}
+	}
+	props, _ := s["properties"].(map[string]any)
+	// Check in a stable order so the reported error is deterministic.
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := path + "." + k
+		if ps, ok := props[k].(map[string]any); ok {
+			if err := vd.validate(ps, obj[k], child); err != nil {
+				return err
+			}
+			continue
+		}
+		switch ap := s["additionalProperties"].(type) {
+		case bool:
+			if !ap {
+				return fail(path, "unexpected property %q", k)
+			}
+		case map[string]any:
+			if err := vd.validate(ap, obj[k], child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (vd *validator) array(s map[string]any, arr []any, path string) error {
+	if n, ok := number(s["minItems"]); ok && float64(len(arr)) < n {
+		return fail(path, "expected at least %v items, got %d", n, len(arr))
+	}
+	if n, ok := number(s["maxItems"]); ok && float64(len(arr)) > n {
+		return fail(path, "expected at most %v items, got %d", n, len(arr))
+	}
+	if items, ok := s["items"].(map[string]any); ok {
+		for i, item := range arr {
+			if err := vd.validate(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkString(s map[string]any, str string, path string) error {
+	n := float64(len([]rune(str)))
+	if min, ok := number(s["minLength"]); ok && n < min {
+		return fail(path, "string shorter than %v", min)
+	}
+	if max, ok := number(s["maxLength"]); ok && n > max {
+		return fail(path, "string longer than %v", max)
+	}
+	if p, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fail(path, "invalid pattern %q", p)
+		}
+		if !re.MatchString(str) {
+			return fail(path, "string does not match pattern %q", p)
+		}
+	}
+	return nil
+}
+
+func checkNumber(s map[string]any, f float64, path string) error {
+	if min, ok := number(s["minimum"]); ok && f < min {
+		return fail(path, "%v is less than minimum %v", f, min)
+	}
+	if max, ok := number(s["maximum"]); ok && f > max {
+		return fail(path, "%v is greater than maximum %v", f, max)
+	}
+	if min, ok := number(s["exclusiveMinimum"]); ok && f <= min {
+		return fail(path, "%v is not greater than %v", f, min)
+	}
+	if max, ok := number(s["exclusiveMaximum"]); ok && f >= max {
+		return fail(path, "%v is not less than %v", f, max)
+	}
+	return nil
+}
+
+func number(v any) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
@@ -0,0 +1,76 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const personSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"age": {"type": "integer", "minimum": 0},
+		"role": {"enum": ["admin", "user"]},
+		"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+		"manager": {"anyOf": [{"$ref": "#/$defs/ref"}, {"type": "null"}]}
+	},
+	"required": ["name", "age"],
+	"additionalProperties": false,
+	"$defs": {"ref": {"type": "object", "required": ["id"]}}
+}`
+
+func TestValidate(t *testing.T) {
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(personSchema), &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{"valid", `{"name":"a","age":3,"role":"admin","tags":["x"],"manager":{"id":1}}`, ""},
+		{"null manager", `{"name":"a","age":3,"manager":null}`, ""},
+		{"missing required", `{"name":"a"}`, `missing required property "age"`},
+		{"wrong type", `{"name":"a","age":"3"}`, "$.age: expected integer, got string"},
+		{"not integer", `{"name":"a","age":3.5}`, "expected integer"},
+		{"below minimum", `{"name":"a","age":-1}`, "less than minimum"},
+		{"empty string", `{"name":"","age":1}`, "shorter than"},
+		{"enum", `{"name":"a","age":1,"role":"root"}`, "not in enum"},
+		{"extra property", `{"name":"a","age":1,"x":1}`, `unexpected property "x"`},
+		{"bad item", `{"name":"a","age":1,"tags":[1]}`, "$.tags[0]: expected string"},
+		{"too many items", `{"name":"a","age":1,"tags":["a","b","c"]}`, "at most"},
+		{"ref", `{"name":"a","age":1,"manager":{}}`, "matches none of anyOf"},
+		{"not json", `{"name":`, "not valid JSON"},
+		{"not object", `[1]`, "expected object, got array"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateJSON(schema, []byte(tt.doc))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOneOf(t *testing.T) {
+	schema := map[string]any{"oneOf": []any{
+		map[string]any{"type": "number"},
+		map[string]any{"type": "integer"},
+	}}
+	if err := Validate(schema, 1.5); err != nil {
+		t.Errorf("1.5 matches only number: %v", err)
+	}
+	if err := Validate(schema, 2.0); err == nil {
+		t.Error("2 matches both branches; expected oneOf failure")
+	}
+}
@@ -2,7 +2,9 @@ package mcp
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/pario-ai/pario/pkg/models"
 )
@@ -13,16 +15,23 @@ func formatSummary(rows []models.UsageSummary) string {
 		return "No usage data found."
 	}
 	var b strings.Builder
-	fmt.Fprintf(&b, "%-20s %-25s %8s %10s %10s %10s\n",
-		"API Key", "Model", "Requests", "Prompt", "Completion", "Total")
-	b.WriteString(strings.Repeat("-", 87) + "\n")
+	fmt.Fprintf(&b, "%-20s %-25s %-12s %-20s %8s %10s %10s %10s %8s\n",
+		"API Key", "Model", "Provider", "Route", "Requests", "Prompt", "Completion", "Total", "Streamed")
+	b.WriteString(strings.Repeat("-", 130) + "\n")
 	for _, r := range rows {
 		key := r.APIKey
 		if len(key) > 20 {
 			key = key[:8] + "..." + key[len(key)-8:]
 		}
-		fmt.Fprintf(&b, "%-20s %-25s %8d %10d %10d %10d\n",
-			key, r.Model, r.RequestCount, r.TotalPrompt, r.TotalCompletion, r.TotalTokens)
+		provider, route := r.Provider, r.RouteAlias
+		if provider == "" {
+			provider = "-"
+		}
+		if route == "" {
+			route = "-"
+		}
+		fmt.Fprintf(&b, "%-20s %-25s %-12s %-20s %8d %10d %10d %10d %8d\n",
+			key, r.Model, provider, route, r.RequestCount, r.TotalPrompt, r.TotalCompletion, r.TotalTokens, r.StreamedRequests)
 	}
 	return b.String()
 }
@@ -33,19 +42,19 @@ func formatSessions(sessions []models.Session) string {
 		return "No sessions found."
 	}
 	var b strings.Builder
-	fmt.Fprintf(&b, "%-38s %-20s %-20s %-20s %8s %10s\n",
-		"Session ID", "API Key", "Started", "Last Activity", "Requests", "Tokens")
-	b.WriteString(strings.Repeat("-", 120) + "\n")
+	fmt.Fprintf(&b, "%-38s %-24s %-20s %-20s %-20s %8s %10s  %s\n",
+		"Session ID", "Name", "API Key", "Started", "Last Activity", "Requests", "Tokens", "Tags")
+	b.WriteString(strings.Repeat("-", 150) + "\n")
 	for _, s := range sessions {
 		key := s.APIKey
 		if len(key) > 20 {
 			key = key[:8] + "..." + key[len(key)-8:]
 		}
-		fmt.Fprintf(&b,"%-38s %-20s %-20s %-20s %8d %10d\n",
-			s.ID, key,
+		fmt.Fprintf(&b,"%-38s %-24s %-20s %-20s %-20s %8d %10d  %s\n",
+			s.ID, s.Name, key,
 			s.StartedAt.Format("2006-01-02 15:04:05"),
 			s.LastActivity.Format("2006-01-02 15:04:05"),
-			s.RequestCount, s.TotalTokens)
+			s.RequestCount, s.TotalTokens, s.FormatTags())
 	}
 	return b.String()
 }
@@ -68,6 +77,98 @@ func formatSessionRequests(reqs []models.SessionRequest) string {
 	return b.String()
 }
 
+// formatBudgetSimulation formats budget what-if results as a text table.
+func formatBudgetSimulation(results []models.BudgetSimulation, days int) string {
+	if len(results) == 0 {
+		return fmt.Sprintf("No matching usage in the last %d days.", days)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Simulated against the last %d days of usage.\n\n", days)
+	fmt.Fprintf(&b, "%-32s %-20s %8s %8s %7s %14s %8s %-20s\n",
+		"Policy", "API Key", "Requests", "Blocked", "Block%", "Blocked Tokens", "Periods", "First Blocked")
+	b.WriteString(strings.Repeat("-", 124) + "\n")
+	for _, r := range results {
+		model := r.Policy.Model
+		if model == "" {
+			model = "(all)"
+		}
+		policy := fmt.Sprintf("%s/%s %d/%s", r.Policy.Subject(), model, r.Policy.MaxTokens, r.Policy.Period)
+		key := r.APIKey
+		if len(key) > 20 {
+			key = key[:8] + "..." + key[len(key)-8:]
+		}
+		pct := float64(0)
+		if r.Requests > 0 {
+			pct = float64(r.Blocked) / float64(r.Requests) * 100
+		}
+		first := "-"
+		if !r.FirstBlockedAt.IsZero() {
+			first = r.FirstBlockedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(&b, "%-32s %-20s %8d %8d %6.1f%% %14d %8d %-20s\n",
+			policy, key, r.Requests, r.Blocked, pct, r.BlockedTokens, r.PeriodsBlocked, first)
+	}
+	return b.String()
+}
+
+// formatBudgetDecisions formats budget decisions as a text table.
+func formatBudgetDecisions(decisions []models.BudgetDecision) string {
+	if len(decisions) == 0 {
+		return "No budget decisions found."
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-20s %-10s %-20s %-20s %-32s %12s %6s\n",
+		"Time", "Action", "API Key", "Model", "Policy", "Used", "Usage%")
+	b.WriteString(strings.Repeat("-", 126) + "\n")
+	for _, d := range decisions {
+		model := d.Policy.Model
+		if model == "" {
+			model = "(all)"
+		}
+		policy := fmt.Sprintf("%s/%s %s/%s", d.Policy.Subject(), model, d.Policy.FormatLimit(), d.Policy.Period)
+		key := d.APIKey
+		if len(key) > 20 {
+			key = key[:8] + "..." + key[len(key)-8:]
+		}
+		pct := d.Policy.Fraction(d.Used, d.UsedUSD) * 100
+		fmt.Fprintf(&b, "%-20s %-10s %-20s %-20s %-32s %12s %5.1f%%\n",
+			d.CreatedAt.Format("2006-01-02 15:04:05"), d.Action, key, d.Model, policy, d.Policy.FormatAmount(d.Used, d.UsedUSD), pct)
+	}
+	return b.String()
+}
+
+// formatManagedPolicies formats managed budget policies as a text table,
+// marking those expired at now.
+func formatManagedPolicies(policies []models.ManagedBudgetPolicy, now time.Time) string {
+	if len(policies) == 0 {
+		return "No managed budget policies found."
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%6s %-20s %-20s %-8s %16s %-20s\n",
+		"ID", "API Key", "Model", "Period", "Limit", "Expires")
+	b.WriteString(strings.Repeat("-", 95) + "\n")
+	for _, p := range policies {
+		key := p.Subject()
+		if len(key) > 20 {
+			key = key[:8] + "..." + key[len(key)-8:]
+		}
+		model := p.Model
+		if model == "" {
+			model = "(all)"
+		}
+		expires := "never"
+		if !p.ExpiresAt.IsZero() {
+			expires = p.ExpiresAt.Format("2006-01-02 15:04:05")
+			if !p.Active(now) {
+				expires += " (expired)"
+			}
+		}
+		fmt.Fprintf(&b, "%6d %-20s %-20s %-8s %16s %-20s\n",
+			p.ID, key, model, p.Period, p.FormatLimit(), expires)
+	}
+	return b.String()
+}
+
 // formatBudgetStatus formats budget statuses as a text table.
 func formatBudgetStatus(statuses []models.BudgetStatus) string {
 	if len(statuses) == 0 {
@@ -75,10 +176,10 @@ func formatBudgetStatus(statuses []models.BudgetStatus) string {
 	}
 	var b strings.Builder
 	fmt.Fprintf(&b, "%-20s %-20s %-8s %12s %12s %12s %6s\n",
-		"API Key", "Model", "Period", "Max Tokens", "Used", "Remaining", "Usage%")
+		"API Key", "Model", "Period", "Limit", "Used", "Remaining", "Usage%")
 	b.WriteString(strings.Repeat("-", 94) + "\n")
 	for _, s := range statuses {
-		key := s.Policy.APIKey
+		key := s.Policy.Subject()
 		if len(key) > 20 {
 			key = key[:8] + "..." + key[len(key)-8:]
 		}
@@ -86,12 +187,9 @@ func formatBudgetStatus(statuses []models.BudgetStatus) string {
 		if model == "" {
 			model = "(all)"
 		}
-		pct := float64(0)
-		if s.Policy.MaxTokens > 0 {
-			pct = float64(s.Used) / float64(s.Policy.MaxTokens) * 100
-		}
-		fmt.Fprintf(&b, "%-20s %-20s %-8s %12d %12d %12d %5.1f%%\n",
-			key, model, s.Policy.Period, s.Policy.MaxTokens, s.Used, s.Remaining, pct)
+		fmt.Fprintf(&b, "%-20s %-20s %-8s %12s %12s %12s %5.1f%%\n",
+			key, model, s.Policy.Period, s.Policy.FormatLimit(), s.Policy.FormatAmount(s.Used, s.UsedUSD),
+			s.Policy.FormatAmount(s.Remaining, s.RemainingUSD), s.UsedFraction()*100)
 	}
 	return b.String()
 }
@@ -102,9 +200,9 @@ func formatCostReport(reports []models.CostReport) string {
 		return "No cost data found."
 	}
 	var b strings.Builder
-	fmt.Fprintf(&b, "%-15s %-15s %-25s %8s %12s %10s\n",
-		"TEAM", "PROJECT", "MODEL", "REQUESTS", "TOKENS", "EST. COST")
-	b.WriteString(strings.Repeat("-", 89) + "\n")
+	fmt.Fprintf(&b, "%-15s %-15s %-25s %-12s %-20s %8s %12s %10s\n",
+		"TEAM", "PROJECT", "MODEL", "PROVIDER", "ROUTE", "REQUESTS", "TOKENS", "EST. COST")
+	b.WriteString(strings.Repeat("-", 123) + "\n")
 	var totalCost float64
 	for _, r := range reports {
 		team := r.Team
@@ -115,15 +213,61 @@ func formatCostReport(reports []models.CostReport) string {
 		if project == "" {
 			project = "(none)"
 		}
-		fmt.Fprintf(&b, "%-15s %-15s %-25s %8d %12d $%9.4f\n",
-			team, project, r.Model, r.RequestCount, r.TotalTokens, r.EstimatedCost)
+		provider, route := r.Provider, r.RouteAlias
+		if provider == "" {
+			provider = "-"
+		}
+		if route == "" {
+			route = "-"
+		}
+		fmt.Fprintf(&b, "%-15s %-15s %-25s %-12s %-20s %8d %12d %10s\n",
+			team, project, r.Model, provider, route, r.RequestCount, r.TotalTokens, costCell(r.EstimatedCost, r.Local))
 		totalCost += r.EstimatedCost
 	}
-	b.WriteString(strings.Repeat("-", 89) + "\n")
-	fmt.Fprintf(&b, "%77s $%9.4f\n", "TOTAL:", totalCost)
+	b.WriteString(strings.Repeat("-", 123) + "\n")
+	fmt.Fprintf(&b, "%111s $%9.4f\n", "TOTAL:", totalCost)
 	return b.String()
 }
 
+// formatLabelReport formats label-grouped cost reports as a text table.
+func formatLabelReport(reports []models.LabelReport) string {
+	if len(reports) == 0 {
+		return "No cost data found."
+	}
+	header := "LABEL"
+	if reports[0].Label != "" {
+		header = strings.ToUpper(reports[0].Label)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-25s %-25s %8s %12s %10s\n",
+		header, "MODEL", "REQUESTS", "TOKENS", "EST. COST")
+	b.WriteString(strings.Repeat("-", 84) + "\n")
+	var totalCost float64
+	for _, r := range reports {
+		value := r.Value
+		if r.Label == "" {
+			value = "(all)"
+		} else if value == "" {
+			value = "(none)"
+		}
+		fmt.Fprintf(&b, "%-25s %-25s %8d %12d %10s\n",
+			value, r.Model, r.RequestCount, r.TotalTokens, costCell(r.EstimatedCost, r.Local))
+		totalCost += r.EstimatedCost
+	}
+	b.WriteString(strings.Repeat("-", 84) + "\n")
+	fmt.Fprintf(&b, "%72s $%9.4f\n", "TOTAL:", totalCost)
+	return b.String()
+}
+
+// costCell formats a cost for the EST. COST column; models served by local
+// engines show "local" instead of $0.
+func costCell(cost float64, local bool) string {
+	if local {
+		return "local"
+	}
+	return fmt.Sprintf("$%9.4f", cost)
+}
+
 // formatAuditEntries formats audit entries as a text table.
 func formatAuditEntries(entries []models.AuditEntry) string {
 	if len(entries) == 0 {
@@ -142,6 +286,109 @@ func formatAuditEntries(entries []models.AuditEntry) string {
 	return b.String()
 }
 
+// formatThroughput formats throughput distributions as a text table.
+func formatThroughput(stats []models.ThroughputStat) string {
+	if len(stats) == 0 {
+		return "No throughput data found."
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-25s %-12s %8s %10s %8s %8s %8s %8s\n",
+		"Model", "Provider", "Requests", "Mean t/s", "P50", "P90", "Min", "Max")
+	b.WriteString(strings.Repeat("-", 96) + "\n")
+	for _, s := range stats {
+		provider := s.Provider
+		if provider == "" {
+			provider = "(unknown)"
+		}
+		fmt.Fprintf(&b, "%-25s %-12s %8d %10.1f %8.1f %8.1f %8.1f %8.1f\n",
+			s.Model, provider, s.Requests, s.Mean, s.P50, s.P90, s.Min, s.Max)
+	}
+	return b.String()
+}
+
+// formatLatency formats latency distributions as a text table.
+func formatLatency(stats []models.LatencyStat) string {
+	if len(stats) == 0 {
+		return "No latency data found."
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-25s %-12s %8s %10s %8s %8s %8s %8s\n",
+		"Model", "Provider", "Requests", "Mean ms", "P50", "P95", "P99", "Max")
+	b.WriteString(strings.Repeat("-", 96) + "\n")
+	for _, s := range stats {
+		provider := s.Provider
+		if provider == "" {
+			provider = "(unknown)"
+		}
+		fmt.Fprintf(&b, "%-25s %-12s %8d %10.0f %8.0f %8.0f %8.0f %8.0f\n",
+			s.Model, provider, s.Requests, s.MeanMs, s.P50Ms, s.P95Ms, s.P99Ms, s.MaxMs)
+	}
+	return b.String()
+}
+
+// formatProviders formats provider reliability as a text table.
+func formatProviders(stats []models.ProviderReliability) string {
+	if len(stats) == 0 {
+		return "No provider data found."
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-20s %8s %8s %10s %10s %10s\n",
+		"Provider", "Served", "Failed", "Error %", "Recovered", "Fallbacks")
+	b.WriteString(strings.Repeat("-", 71) + "\n")
+	for _, s := range stats {
+		fmt.Fprintf(&b, "%-20s %8d %8d %9.1f%% %10d %10d\n",
+			s.Provider, s.Served, s.Failures, s.ErrorRate*100, s.Recovered, s.Fallbacks)
+	}
+	return b.String()
+}
+
+// formatTop formats a top-N ranking as a text table.
+func formatTop(by string, entries []models.TopEntry) string {
+	if len(entries) == 0 {
+		return "No usage found."
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%4s %-38s %8s %12s %12s %12s\n",
+		"#", by, "Requests", "Prompt", "Completion", "Est. Cost")
+	b.WriteString(strings.Repeat("-", 91) + "\n")
+	for i, e := range entries {
+		value := e.Value
+		if value == "" {
+			value = "(none)"
+		}
+		fmt.Fprintf(&b, "%4d %-38s %8d %12d %12d %12s\n",
+			i+1, value, e.RequestCount, e.PromptTokens, e.CompletionTokens, fmt.Sprintf("$%.4f", e.EstimatedCost))
+	}
+	return b.String()
+}
+
+// formatAnomalies formats detected usage anomalies as a table.
+func formatAnomalies(anomalies []models.Anomaly) string {
+	if len(anomalies) == 0 {
+		return "No anomalies found."
+	}
+	amount := func(metric string, v float64) string {
+		if metric == models.AnomalyMetricCost {
+			return fmt.Sprintf("$%.2f", v)
+		}
+		return fmt.Sprintf("%.0f", v)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-16s %-7s %-30s %-6s %12s %12s %7s\n",
+		"Window", "By", "Value", "Metric", "Observed", "Median", "Z")
+	b.WriteString(strings.Repeat("-", 96) + "\n")
+	for _, a := range anomalies {
+		z := "-"
+		if a.ZScore != 0 {
+			z = fmt.Sprintf("%.1f", a.ZScore)
+		}
+		fmt.Fprintf(&b, "%-16s %-7s %-30s %-6s %12s %12s %7s\n",
+			a.WindowStart.Format("2006-01-02 15:04"), a.Dimension, a.Value, a.Metric,
+			amount(a.Metric, a.Observed), amount(a.Metric, a.Median), z)
+	}
+	return b.String()
+}
+
 // formatCacheStats formats cache stats as text.
 func formatCacheStats(stats models.CacheStats) string {
 	total := stats.Hits + stats.Misses
@@ -156,3 +403,36 @@ func formatCacheStats(stats models.CacheStats) string {
 		"  Hit Rate: %.1f%%\n",
 		stats.Entries, stats.Hits, stats.Misses, hitRate)
 }
+
+// formatAuditEntry formats a single audit entry with its bodies and headers.
+func formatAuditEntry(e models.AuditEntry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Request ID:  %s\n", e.RequestID)
+	fmt.Fprintf(&b, "Model:       %s\n", e.Model)
+	fmt.Fprintf(&b, "Provider:    %s\n", e.Provider)
+	fmt.Fprintf(&b, "API Key:     %s...\n", e.APIKeyPrefix)
+	fmt.Fprintf(&b, "Session:     %s\n", e.SessionID)
+	fmt.Fprintf(&b, "Status:      %d\n", e.StatusCode)
+	fmt.Fprintf(&b, "Latency:     %dms\n", e.LatencyMs)
+	fmt.Fprintf(&b, "Tokens:      %d prompt / %d completion / %d total\n",
+		e.PromptTokens, e.CompletionTokens, e.TotalTokens)
+	fmt.Fprintf(&b, "Time:        %s\n", e.CreatedAt.Format("2006-01-02 15:04:05"))
+	if len(e.RequestHeaders) > 0 {
+		keys := make([]string, 0, len(e.RequestHeaders))
+		for k := range e.RequestHeaders {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteString("\n--- Request Headers ---\n")
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s: %s\n", k, e.RequestHeaders[k])
+		}
+	}
+	if e.RequestBody != "" {
+		fmt.Fprintf(&b, "\n--- Request Body ---\n%s\n", e.RequestBody)
+	}
+	if e.ResponseBody != "" {
+		fmt.Fprintf(&b, "\n--- Response Body ---\n%s\n", e.ResponseBody)
+	}
+	return b.String()
+}
@@ -0,0 +1,131 @@
+package mcp
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pario-ai/pario/pkg/config"
+)
+
+// Scope is a tool permission granted to an HTTP bearer token.
+type Scope string
+
+// Tool scopes.
+const (
+	// ScopeRead covers usage, cost, budget, and cache reporting tools.
+	ScopeRead Scope = "read"
+	// ScopeAudit covers tools that expose stored prompts and responses.
+	ScopeAudit Scope = "audit"
+	// ScopeWrite covers tools that change state.
+	ScopeWrite Scope = "write"
+)
+
+// toolScopes lists tools that need more than ScopeRead.
+var toolScopes = map[string]Scope{
+	"pario_audit_search":      ScopeAudit,
+	"pario_audit_get":         ScopeAudit,
+	"pario_budget_policy_set": ScopeWrite,
+}
+
+// toolScope returns the scope required to list and call a tool.
+func toolScope(name string) Scope {
+	if sc, ok := toolScopes[name]; ok {
+		return sc
+	}
+	return ScopeRead
+}
+
+// principal is the authenticated caller of an HTTP request.
+type principal struct {
+	name   string
+	scopes map[Scope]bool
+}
+
+type principalKey struct{}
+
+// allowed reports whether the caller in ctx may use a tool. Calls without a
+// principal come from the local stdio transport and are always allowed.
+func allowed(ctx context.Context, tool string) bool {
+	p, ok := ctx.Value(principalKey{}).(*principal)
+	if !ok {
+		return true
+	}
+	return p.scopes[toolScope(tool)]
+}
+
+// maxHTTPBody caps a single JSON-RPC request body.
+const maxHTTPBody = 1 << 20
+
+// HTTPHandler returns an http.Handler serving JSON-RPC requests over HTTP
+// POST. Every request must carry "Authorization: Bearer <token>" for one of
+// tokens; the token's scopes decide which tools it can list and call.
+func (s *Server) HTTPHandler(tokens []config.MCPToken) http.Handler {
+	principals := make([]struct {
+		token []byte
+		p     *principal
+	}, len(tokens))
+	for i, t := range tokens {
+		p := &principal{name: t.Name, scopes: make(map[Scope]bool, len(t.Scopes))}
+		for _, sc := range t.Scopes {
+			p.scopes[Scope(sc)] = true
+		}
+		principals[i].token = []byte(t.Token)
+		principals[i].p = p
+	}
+
+	authenticate := func(r *http.Request) *principal {
+		raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || raw == "" {
+			return nil
+		}
+		var found *principal
+		for _, c := range principals {
+			if subtle.ConstantTimeCompare([]byte(raw), c.token) == 1 {
+				found = c.p
+			}
+		}
+		return found
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p := authenticate(r)
+		if p == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pario-mcp"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxHTTPBody))
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		var req Request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.writeResponse(w, Response{
+				JSONRPC: "2.0",
+				Error:   &RPCError{Code: CodeParseError, Message: "parse error"},
+			})
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey{}, p)
+		resp := s.dispatch(ctx, &req)
+		if resp == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		s.writeResponse(w, *resp)
+	})
+}
@@ -0,0 +1,141 @@
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pario-ai/pario/pkg/config"
+)
+
+func TestHTTPAuth(t *testing.T) {
+	srv := New(&fakeTracker{}, nil, nil, nil, nil, "test")
+	h := srv.HTTPHandler([]config.MCPToken{
+		{Name: "dashboards", Token: "tok-read", Scopes: []string{"read"}},
+		{Name: "oncall", Token: "tok-ops", Scopes: []string{"read", "audit", "write"}},
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		body       string
+		wantStatus int
+		wantBody   []string
+		notWant    string
+	}{
+		{
+			name:       "missing token",
+			method:     http.MethodPost,
+			body:       `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong token",
+			method:     http.MethodPost,
+			token:      "tok-nope",
+			body:       `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "GET not allowed",
+			method:     http.MethodGet,
+			token:      "tok-read",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "read token lists read tools only",
+			method:     http.MethodPost,
+			token:      "tok-read",
+			body:       `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{"pario_cost_report"},
+			notWant:    "pario_audit_get",
+		},
+		{
+			name:       "read token does not list write tools",
+			method:     http.MethodPost,
+			token:      "tok-read",
+			body:       `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{"pario_budget_policies"},
+			notWant:    "pario_budget_policy_set",
+		},
+		{
+			name:       "read token cannot call write tools",
+			method:     http.MethodPost,
+			token:      "tok-read",
+			body:       `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"pario_budget_policy_set","arguments":{"id":1,"delete":true}}}`,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`forbidden: pario_budget_policy_set requires the \"write\" scope`, `"isError":true`},
+		},
+		{
+			name:       "read token cannot call audit tools",
+			method:     http.MethodPost,
+			token:      "tok-read",
+			body:       `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"pario_audit_get","arguments":{"request_id":"x"}}}`,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`forbidden: pario_audit_get requires the \"audit\" scope`, `"isError":true`},
+		},
+		{
+			name:       "audit token can call audit tools",
+			method:     http.MethodPost,
+			token:      "tok-ops",
+			body:       `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"pario_audit_get","arguments":{"request_id":"x"}}}`,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{"Audit logging is not configured."},
+		},
+		{
+			name:       "notification",
+			method:     http.MethodPost,
+			token:      "tok-read",
+			body:       `{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "parse error",
+			method:     http.MethodPost,
+			token:      "tok-read",
+			body:       `{not json`,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`"code":-32700`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/mcp", strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("body missing %q: %s", want, w.Body.String())
+				}
+			}
+			if tt.notWant != "" && strings.Contains(w.Body.String(), tt.notWant) {
+				t.Errorf("body contains %q: %s", tt.notWant, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestStdioAllowsAllTools(t *testing.T) {
+	srv := New(&fakeTracker{}, nil, nil, nil, nil, "test")
+	resp := sendAndReceive(t, srv, Request{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(`1`),
+		Method:  "tools/list",
+	})
+	data, _ := json.Marshal(resp.Result)
+	if !strings.Contains(string(data), "pario_audit_get") {
+		t.Errorf("stdio tools/list should include audit tools: %s", data)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"time"
 
 	"github.com/pario-ai/pario/pkg/audit"
 	"github.com/pario-ai/pario/pkg/budget"
@@ -27,18 +28,49 @@ type Server struct {
 	auditor  *audit.Logger
 	pricing  []models.ModelPricing
 	version  string
+	location func(team string) *time.Location
+	keyLoc   func(apiKey string) *time.Location
+}
+
+// Option configures optional Server behavior.
+type Option func(*Server)
+
+// WithLocation sets the function used to resolve the reporting timezone for a
+// team. An empty team asks for the deployment timezone. The default is UTC.
+func WithLocation(fn func(team string) *time.Location) Option {
+	return func(s *Server) {
+		if fn != nil {
+			s.location = fn
+		}
+	}
+}
+
+// WithKeyLocation sets the function used to resolve the timezone in which an
+// API key's budget periods start, for budget simulations. The default is UTC.
+func WithKeyLocation(fn func(apiKey string) *time.Location) Option {
+	return func(s *Server) {
+		if fn != nil {
+			s.keyLoc = fn
+		}
+	}
 }
 
 // New creates a new MCP Server.
-func New(t tracker.Tracker, cache CacheStatter, enforcer *budget.Enforcer, auditor *audit.Logger, pricing []models.ModelPricing, version string) *Server {
-	return &Server{
+func New(t tracker.Tracker, cache CacheStatter, enforcer *budget.Enforcer, auditor *audit.Logger, pricing []models.ModelPricing, version string, opts ...Option) *Server {
+	s := &Server{
 		tracker:  t,
 		cache:    cache,
 		enforcer: enforcer,
 		auditor:  auditor,
 		pricing:  pricing,
 		version:  version,
+		location: func(string) *time.Location { return time.UTC },
+		keyLoc:   func(string) *time.Location { return time.UTC },
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Run reads JSON-RPC requests from r line-by-line and writes responses to w.
@@ -85,7 +117,7 @@ func (s *Server) dispatch(ctx context.Context, req *Request) *Response {
 	case "notifications/initialized":
 		return nil // notification, no response
 	case "tools/list":
-		return s.handleToolsList(req)
+		return s.handleToolsList(ctx, req)
 	case "tools/call":
 		return s.handleToolsCall(ctx, req)
 	default:
@@ -109,11 +141,17 @@ func (s *Server) handleInitialize(req *Request) *Response {
 	}
 }
 
-func (s *Server) handleToolsList(req *Request) *Response {
+func (s *Server) handleToolsList(ctx context.Context, req *Request) *Response {
+	tools := make([]ToolDefinition, 0, len(allTools))
+	for _, t := range allTools {
+		if allowed(ctx, t.Name) {
+			tools = append(tools, t)
+		}
+	}
 	return &Response{
 		JSONRPC: "2.0",
 		ID:      req.ID,
-		Result:  ToolsListResult{Tools: allTools},
+		Result:  ToolsListResult{Tools: tools},
 	}
 }
 
@@ -139,6 +177,17 @@ func (s *Server) handleToolsCall(ctx context.Context, req *Request) *Response {
 		}
 	}
 
+	if !allowed(ctx, params.Name) {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Result: ToolCallResult{
+				Content: []ContentBlock{{Type: "text", Text: fmt.Sprintf("forbidden: %s requires the %q scope", params.Name, toolScope(params.Name))}},
+				IsError: true,
+			},
+		}
+	}
+
 	result := handler(ctx, s, params.Arguments)
 	return &Response{
 		JSONRPC: "2.0",
@@ -4,47 +4,103 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/pario-ai/pario/pkg/audit"
+	"github.com/pario-ai/pario/pkg/budget"
 	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/tracker"
 )
 
 // fakeTracker implements tracker.Tracker for testing.
 type fakeTracker struct {
-	summaries   []models.UsageSummary
-	sessions    []models.Session
-	requests    []models.SessionRequest
-	costReports []models.CostReport
+	summaries    []models.UsageSummary
+	sessions     []models.Session
+	requests     []models.SessionRequest
+	costReports  []models.CostReport
+	throughput   []models.ThroughputStat
+	latency      []models.LatencyStat
+	reliability  []models.ProviderReliability
+	top          []models.TopEntry
+	topQuery     models.TopQuery
+	labelReports []models.LabelReport
+	records      []models.UsageRecord
+	decisions    []models.BudgetDecision
+	// decisionQuery is the last query passed to Decisions.
+	decisionQuery models.BudgetDecisionQuery
 }
 
-func (f *fakeTracker) Record(_ context.Context, _ models.UsageRecord) error              { return nil }
+func (f *fakeTracker) Record(_ context.Context, _ models.UsageRecord) error { return nil }
 func (f *fakeTracker) QueryByKey(_ context.Context, _ string, _ time.Time) ([]models.UsageRecord, error) {
 	return nil, nil
 }
+func (f *fakeTracker) QuerySince(_ context.Context, _ time.Time) ([]models.UsageRecord, error) {
+	return f.records, nil
+}
 func (f *fakeTracker) TotalByKey(_ context.Context, _ string, _ time.Time) (int64, error) {
 	return 0, nil
 }
 func (f *fakeTracker) TotalByKeyAndModel(_ context.Context, _, _ string, _ time.Time) (int64, error) {
 	return 0, nil
 }
+func (f *fakeTracker) SpendByKey(_ context.Context, _, _ string, _ time.Time) ([]models.CostReport, error) {
+	return nil, nil
+}
+func (f *fakeTracker) SpendByLabels(_ context.Context, _ models.CostLabel, _ string, _ time.Time) ([]models.CostReport, error) {
+	return nil, nil
+}
+func (f *fakeTracker) AdjustmentTotal(_ context.Context, _ string, _ models.CostLabel, _ string, _ time.Time) (int64, float64, error) {
+	return 0, 0, nil
+}
 func (f *fakeTracker) Summary(_ context.Context, _ string) ([]models.UsageSummary, error) {
 	return f.summaries, nil
 }
 func (f *fakeTracker) ResolveSession(_ context.Context, _, _ string, _ time.Duration) (string, error) {
 	return "", nil
 }
-func (f *fakeTracker) ListSessions(_ context.Context, _ string) ([]models.Session, error) {
+func (f *fakeTracker) ListSessions(_ context.Context, _ models.SessionQuery) ([]models.Session, error) {
 	return f.sessions, nil
 }
+func (f *fakeTracker) UpdateSession(_ context.Context, _, _ string, _ map[string]string) error {
+	return nil
+}
 func (f *fakeTracker) SessionRequests(_ context.Context, _ string) ([]models.SessionRequest, error) {
 	return f.requests, nil
 }
 func (f *fakeTracker) CostReport(_ context.Context, _ time.Time, _, _ string) ([]models.CostReport, error) {
 	return f.costReports, nil
 }
-func (f *fakeTracker) Close() error { return nil }
+func (f *fakeTracker) LabelReport(_ context.Context, _ models.LabelQuery) ([]models.LabelReport, error) {
+	return f.labelReports, nil
+}
+func (f *fakeTracker) Throughput(_ context.Context, _ time.Time) ([]models.ThroughputStat, error) {
+	return f.throughput, nil
+}
+func (f *fakeTracker) Latency(_ context.Context, _ time.Time) ([]models.LatencyStat, error) {
+	return f.latency, nil
+}
+func (f *fakeTracker) Top(_ context.Context, q models.TopQuery) ([]models.TopEntry, error) {
+	f.topQuery = q
+	return f.top, nil
+}
+func (f *fakeTracker) RecordFailure(_ context.Context, _ models.UpstreamFailure) error { return nil }
+func (f *fakeTracker) ProviderReliability(_ context.Context, _ time.Time) ([]models.ProviderReliability, error) {
+	return f.reliability, nil
+}
+func (f *fakeTracker) RecordDecision(_ context.Context, _ models.BudgetDecision) error { return nil }
+func (f *fakeTracker) Decisions(_ context.Context, q models.BudgetDecisionQuery) ([]models.BudgetDecision, error) {
+	f.decisionQuery = q
+	return f.decisions, nil
+}
+func (f *fakeTracker) RecordBatch(_ context.Context, _ models.BatchJob) error { return nil }
+func (f *fakeTracker) PendingBatches(_ context.Context) ([]models.BatchJob, error) {
+	return nil, nil
+}
+func (f *fakeTracker) FinishBatch(_ context.Context, _, _ string, _ time.Time) error { return nil }
+func (f *fakeTracker) Close() error                                                  { return nil }
 
 // fakeCache implements CacheStatter for testing.
 type fakeCache struct {
@@ -113,15 +169,15 @@ func TestToolsList(t *testing.T) {
 	var result ToolsListResult
 	json.Unmarshal(data, &result)
 
-	if len(result.Tools) != 7 {
-		t.Errorf("got %d tools, want 7", len(result.Tools))
+	if len(result.Tools) != 18 {
+		t.Errorf("got %d tools, want 18", len(result.Tools))
 	}
 
 	names := make(map[string]bool)
 	for _, tool := range result.Tools {
 		names[tool.Name] = true
 	}
-	for _, want := range []string{"pario_stats", "pario_sessions", "pario_session_detail", "pario_budget", "pario_cache_stats", "pario_cost_report", "pario_audit_search"} {
+	for _, want := range []string{"pario_stats", "pario_sessions", "pario_session_detail", "pario_budget", "pario_cache_stats", "pario_cost_report", "pario_audit_search", "pario_throughput", "pario_latency", "pario_top"} {
 		if !names[want] {
 			t.Errorf("missing tool: %s", want)
 		}
@@ -305,3 +361,431 @@ func TestUnknownMethod(t *testing.T) {
 		t.Errorf("error code = %d, want %d", resp.Error.Code, CodeMethodNotFound)
 	}
 }
+
+func TestToolCallThroughput(t *testing.T) {
+	tr := &fakeTracker{
+		throughput: []models.ThroughputStat{
+			{Model: "gpt-4o", Provider: "openai", Requests: 3, Mean: 82.5, P50: 80, P90: 95, Min: 70, Max: 97.5},
+		},
+	}
+	srv := New(tr, nil, nil, nil, nil, "test")
+
+	params, _ := json.Marshal(ToolCallParams{Name: "pario_throughput"})
+	resp := sendAndReceive(t, srv, Request{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(`10`),
+		Method:  "tools/call",
+		Params:  params,
+	})
+
+	data, _ := json.Marshal(resp.Result)
+	var result ToolCallResult
+	json.Unmarshal(data, &result)
+
+	text := result.Content[0].Text
+	if !strings.Contains(text, "gpt-4o") || !strings.Contains(text, "82.5") {
+		t.Errorf("unexpected throughput output: %s", text)
+	}
+}
+
+func TestToolCallLatency(t *testing.T) {
+	tr := &fakeTracker{
+		latency: []models.LatencyStat{
+			{Model: "gpt-4o", Provider: "openai", Requests: 3, MeanMs: 820, P50Ms: 800, P95Ms: 1450, P99Ms: 1490, MaxMs: 1500},
+		},
+	}
+	srv := New(tr, nil, nil, nil, nil, "test")
+
+	params, _ := json.Marshal(ToolCallParams{Name: "pario_latency"})
+	resp := sendAndReceive(t, srv, Request{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(`10`),
+		Method:  "tools/call",
+		Params:  params,
+	})
+
+	data, _ := json.Marshal(resp.Result)
+	var result ToolCallResult
+	json.Unmarshal(data, &result)
+
+	text := result.Content[0].Text
+	if !strings.Contains(text, "gpt-4o") || !strings.Contains(text, "1450") {
+		t.Errorf("unexpected latency output: %s", text)
+	}
+}
+
+func TestToolCallProviders(t *testing.T) {
+	tr := &fakeTracker{
+		reliability: []models.ProviderReliability{
+			{Provider: "openai", Served: 97, Failures: 3, ErrorRate: 0.03, Recovered: 2},
+			{Provider: "azure", Served: 2, Fallbacks: 2},
+		},
+	}
+	srv := New(tr, nil, nil, nil, nil, "test")
+
+	params, _ := json.Marshal(ToolCallParams{Name: "pario_providers"})
+	resp := sendAndReceive(t, srv, Request{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(`10`),
+		Method:  "tools/call",
+		Params:  params,
+	})
+
+	data, _ := json.Marshal(resp.Result)
+	var result ToolCallResult
+	json.Unmarshal(data, &result)
+
+	text := result.Content[0].Text
+	if !strings.Contains(text, "openai") || !strings.Contains(text, "3.0%") || !strings.Contains(text, "azure") {
+		t.Errorf("unexpected providers output: %s", text)
+	}
+}
+
+func TestToolCallBudgetDecisions(t *testing.T) {
+	tr := &fakeTracker{
+		decisions: []models.BudgetDecision{{
+			APIKey: "sk-batch", Model: "gpt-4", Action: models.BudgetBlock, Used: 1200,
+			Policy:    models.BudgetPolicy{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily},
+			CreatedAt: time.Now().UTC(),
+		}},
+	}
+	srv := New(tr, nil, nil, nil, nil, "test")
+
+	params, _ := json.Marshal(ToolCallParams{Name: "pario_budget_decisions", Arguments: json.RawMessage(`{"action":"block"}`)})
+	resp := sendAndReceive(t, srv, Request{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(`10`),
+		Method:  "tools/call",
+		Params:  params,
+	})
+
+	data, _ := json.Marshal(resp.Result)
+	var result ToolCallResult
+	json.Unmarshal(data, &result)
+
+	text := result.Content[0].Text
+	if result.IsError || !strings.Contains(text, "sk-batch") || !strings.Contains(text, "120.0%") {
+		t.Errorf("unexpected decisions output: %s", text)
+	}
+}
+
+func TestToolCallBudgetViolations(t *testing.T) {
+	tr := &fakeTracker{
+		decisions: []models.BudgetDecision{{
+			APIKey: "sk-batch", Model: "gpt-4", Action: models.BudgetQueueFull, Used: 900,
+			Policy:    models.BudgetPolicy{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily},
+			CreatedAt: time.Now().UTC(),
+		}},
+	}
+	srv := New(tr, nil, nil, nil, nil, "test")
+
+	params, _ := json.Marshal(ToolCallParams{Name: "pario_budget_violations", Arguments: json.RawMessage(`{"api_key":"sk-batch"}`)})
+	resp := sendAndReceive(t, srv, Request{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(`11`),
+		Method:  "tools/call",
+		Params:  params,
+	})
+
+	data, _ := json.Marshal(resp.Result)
+	var result ToolCallResult
+	json.Unmarshal(data, &result)
+
+	if !tr.decisionQuery.Denied || tr.decisionQuery.APIKey != "sk-batch" {
+		t.Errorf("query = %+v, want denials for sk-batch", tr.decisionQuery)
+	}
+	if text := result.Content[0].Text; result.IsError || !strings.Contains(text, "queue_full") {
+		t.Errorf("unexpected violations output: %s", text)
+	}
+}
+
+func TestToolCallBudgetPolicies(t *testing.T) {
+	tr, err := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tr.Close() }()
+	enforcer := budget.New(nil, tr)
+	srv := New(tr, nil, enforcer, nil, nil, "test")
+
+	call := func(name, args string) ToolCallResult {
+		t.Helper()
+		params, _ := json.Marshal(ToolCallParams{Name: name, Arguments: json.RawMessage(args)})
+		resp := sendAndReceive(t, srv, Request{JSONRPC: "2.0", ID: json.RawMessage(`1`), Method: "tools/call", Params: params})
+		data, _ := json.Marshal(resp.Result)
+		var result ToolCallResult
+		json.Unmarshal(data, &result)
+		return result
+	}
+
+	if r := call("pario_budget_policy_set", `{"api_key":"*","max_tokens":1000,"period":"weekly"}`); !r.IsError {
+		t.Errorf("invalid period accepted: %s", r.Content[0].Text)
+	}
+	if r := call("pario_budget_policy_set", `{"api_key":"sk-batch","max_tokens":1000,"period":"daily"}`); r.IsError {
+		t.Fatalf("create: %s", r.Content[0].Text)
+	}
+	if n := len(enforcer.Managed()); n != 1 {
+		t.Errorf("enforcer has %d managed policies, want 1", n)
+	}
+	r := call("pario_budget_policies", `{}`)
+	if text := r.Content[0].Text; r.IsError || !strings.Contains(text, "sk-batch") || !strings.Contains(text, "never") {
+		t.Errorf("unexpected policies output: %s", text)
+	}
+
+	if r := call("pario_budget_policy_set", `{"id":1,"delete":true}`); r.IsError {
+		t.Fatalf("delete: %s", r.Content[0].Text)
+	}
+	if r := call("pario_budget_policy_set", `{"id":1,"delete":true}`); !r.IsError {
+		t.Error("deleting a missing policy succeeded")
+	}
+	if n := len(enforcer.Managed()); n != 0 {
+		t.Errorf("enforcer has %d managed policies after delete, want 0", n)
+	}
+}
+
+func TestToolCallAnomalies(t *testing.T) {
+	tr, err := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tr.Close() }()
+	start := time.Now().UTC().Truncate(time.Hour)
+	for _, a := range []models.Anomaly{
+		{Dimension: models.TopByKey, Value: "sk-runaway", Metric: models.AnomalyMetricTokens, Observed: 50000, Median: 1000, ZScore: 12.5},
+		{Dimension: models.TopByTeam, Value: "ml", Metric: models.AnomalyMetricCost, Observed: 42, Median: 3},
+	} {
+		a.WindowStart, a.WindowEnd, a.DetectedAt = start, start.Add(time.Hour), time.Now()
+		if err := tr.RecordAnomaly(context.Background(), a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := New(tr, nil, nil, nil, nil, "test")
+
+	call := func(args string) ToolCallResult {
+		t.Helper()
+		params, _ := json.Marshal(ToolCallParams{Name: "pario_anomalies", Arguments: json.RawMessage(args)})
+		resp := sendAndReceive(t, srv, Request{JSONRPC: "2.0", ID: json.RawMessage(`1`), Method: "tools/call", Params: params})
+		data, _ := json.Marshal(resp.Result)
+		var result ToolCallResult
+		json.Unmarshal(data, &result)
+		return result
+	}
+
+	r := call(`{}`)
+	if text := r.Content[0].Text; r.IsError || !strings.Contains(text, "sk-runaway") || !strings.Contains(text, "12.5") || !strings.Contains(text, "$42.00") {
+		t.Errorf("unexpected anomalies output: %s", text)
+	}
+	r = call(`{"by":"team"}`)
+	if text := r.Content[0].Text; r.IsError || strings.Contains(text, "sk-runaway") || !strings.Contains(text, "ml") {
+		t.Errorf("unexpected team anomalies output: %s", text)
+	}
+	if r := call(`{"by":"model"}`); !r.IsError {
+		t.Error("invalid by accepted")
+	}
+
+	// Other trackers don't store anomalies.
+	srv = New(&fakeTracker{}, nil, nil, nil, nil, "test")
+	if r := call(`{}`); !r.IsError {
+		t.Error("anomalies without the SQLite tracker succeeded")
+	}
+}
+
+func TestToolCallCostReportByLabel(t *testing.T) {
+	tr := &fakeTracker{
+		labelReports: []models.LabelReport{
+			{Label: "tier", Value: "enterprise", Model: "gpt-4", RequestCount: 2, PromptTokens: 1000, CompletionTokens: 1000, TotalTokens: 2000, EstimatedCost: 0.09},
+		},
+	}
+	pricing := []models.ModelPricing{{Model: "gpt-4", PromptCost: 0.03, CompletionCost: 0.06}}
+	srv := New(tr, nil, nil, nil, pricing, "test")
+
+	params, _ := json.Marshal(ToolCallParams{
+		Name:      "pario_cost_report",
+		Arguments: json.RawMessage(`{"group_by_label":"tier"}`),
+	})
+	resp := sendAndReceive(t, srv, Request{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(`11`),
+		Method:  "tools/call",
+		Params:  params,
+	})
+
+	data, _ := json.Marshal(resp.Result)
+	var result ToolCallResult
+	json.Unmarshal(data, &result)
+
+	text := result.Content[0].Text
+	if !strings.Contains(text, "TIER") || !strings.Contains(text, "enterprise") || !strings.Contains(text, "0.0900") {
+		t.Errorf("unexpected label cost output: %s", text)
+	}
+}
+
+func TestToolCallBudgetSimulate(t *testing.T) {
+	now := time.Now().UTC()
+	tr := &fakeTracker{
+		records: []models.UsageRecord{
+			{APIKey: "sk-heavy", Model: "gpt-4", TotalTokens: 800, CreatedAt: now.Add(-2 * time.Minute)},
+			{APIKey: "sk-heavy", Model: "gpt-4", TotalTokens: 800, CreatedAt: now.Add(-time.Minute)},
+			{APIKey: "sk-light", Model: "gpt-4", TotalTokens: 100, CreatedAt: now.Add(-time.Minute)},
+		},
+	}
+	srv := New(tr, nil, nil, nil, nil, "test")
+
+	tests := []struct {
+		name    string
+		args    string
+		want    []string
+		isError bool
+	}{
+		{
+			name: "blocks heavy key",
+			args: `{"policies":[{"api_key":"*","max_tokens":500,"period":"monthly"}],"days":7}`,
+			want: []string{"last 7 days", "sk-heavy", "50.0%", "sk-light"},
+		},
+		{
+			name:    "missing policies",
+			args:    `{}`,
+			isError: true,
+		},
+		{
+			name:    "invalid period",
+			args:    `{"policies":[{"api_key":"*","max_tokens":500,"period":"weekly"}]}`,
+			isError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, _ := json.Marshal(ToolCallParams{Name: "pario_budget_simulate", Arguments: json.RawMessage(tt.args)})
+			resp := sendAndReceive(t, srv, Request{
+				JSONRPC: "2.0",
+				ID:      json.RawMessage(`12`),
+				Method:  "tools/call",
+				Params:  params,
+			})
+
+			data, _ := json.Marshal(resp.Result)
+			var result ToolCallResult
+			json.Unmarshal(data, &result)
+
+			if result.IsError != tt.isError {
+				t.Fatalf("IsError = %v, want %v: %s", result.IsError, tt.isError, result.Content[0].Text)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(result.Content[0].Text, w) {
+					t.Errorf("output missing %q:\n%s", w, result.Content[0].Text)
+				}
+			}
+		})
+	}
+}
+
+func TestToolCallAuditGet(t *testing.T) {
+	auditor, err := audit.New(models.AuditConfig{
+		DBPath:     filepath.Join(t.TempDir(), "audit.db"),
+		RedactKeys: true,
+		Include:    []string{"prompts", "responses", "metadata"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = auditor.Close() }()
+	err = auditor.Log(context.Background(), models.AuditEntry{
+		RequestID:      "req_abc",
+		APIKeyPrefix:   "sk-test-",
+		Model:          "gpt-4",
+		Provider:       "openai",
+		RequestBody:    `{"messages":[{"role":"user","content":"why is this slow?"}]}`,
+		ResponseBody:   `{"choices":[]}`,
+		RequestHeaders: map[string]string{"Authorization": "Bearer sk-secret"},
+		StatusCode:     502,
+		CreatedAt:      time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(&fakeTracker{}, nil, nil, auditor, nil, "test")
+
+	tests := []struct {
+		name    string
+		args    string
+		want    []string
+		notWant string
+		isError bool
+	}{
+		{
+			name:    "found",
+			args:    `{"request_id":"req_abc"}`,
+			want:    []string{"req_abc", "Status:      502", "why is this slow?", "Authorization: [REDACTED]"},
+			notWant: "sk-secret",
+		},
+		{name: "not found", args: `{"request_id":"req_nope"}`, want: []string{"No audit entry found"}},
+		{name: "missing id", args: `{}`, isError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, _ := json.Marshal(ToolCallParams{Name: "pario_audit_get", Arguments: json.RawMessage(tt.args)})
+			resp := sendAndReceive(t, srv, Request{
+				JSONRPC: "2.0",
+				ID:      json.RawMessage(`13`),
+				Method:  "tools/call",
+				Params:  params,
+			})
+
+			data, _ := json.Marshal(resp.Result)
+			var result ToolCallResult
+			json.Unmarshal(data, &result)
+
+			text := result.Content[0].Text
+			if result.IsError != tt.isError {
+				t.Fatalf("IsError = %v, want %v: %s", result.IsError, tt.isError, text)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(text, w) {
+					t.Errorf("output missing %q:\n%s", w, text)
+				}
+			}
+			if tt.notWant != "" && strings.Contains(text, tt.notWant) {
+				t.Errorf("output leaks %q:\n%s", tt.notWant, text)
+			}
+		})
+	}
+}
+
+func TestToolCallTop(t *testing.T) {
+	tr := &fakeTracker{
+		top: []models.TopEntry{
+			{Value: "sk-runaway", RequestCount: 900, PromptTokens: 800000, CompletionTokens: 90000, TotalTokens: 890000, EstimatedCost: 41.5},
+		},
+	}
+	srv := New(tr, nil, nil, nil, []models.ModelPricing{{Model: "gpt-4o", PromptCost: 0.005}}, "test")
+
+	params, _ := json.Marshal(ToolCallParams{Name: "pario_top", Arguments: json.RawMessage(`{"by":"api_key","order":"cost","hours":6}`)})
+	resp := sendAndReceive(t, srv, Request{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(`11`),
+		Method:  "tools/call",
+		Params:  params,
+	})
+
+	data, _ := json.Marshal(resp.Result)
+	var result ToolCallResult
+	json.Unmarshal(data, &result)
+
+	text := result.Content[0].Text
+	if !strings.Contains(text, "sk-runaway") || !strings.Contains(text, "$41.5000") {
+		t.Errorf("unexpected top output: %s", text)
+	}
+	if q := tr.topQuery; q.By != models.TopByKey || q.OrderBy != models.TopOrderCost ||
+		time.Since(q.Since) < 6*time.Hour-time.Minute {
+		t.Errorf("top query = %+v", q)
+	}
+
+	params, _ = json.Marshal(ToolCallParams{Name: "pario_top", Arguments: json.RawMessage(`{"by":"region"}`)})
+	resp = sendAndReceive(t, srv, Request{JSONRPC: "2.0", ID: json.RawMessage(`12`), Method: "tools/call", Params: params})
+	data, _ = json.Marshal(resp.Result)
+	result = ToolCallResult{}
+	json.Unmarshal(data, &result)
+	if !result.IsError {
+		t.Errorf("unknown dimension: want an error result, got %+v", result)
+	}
+}
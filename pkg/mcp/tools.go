@@ -1,10 +1,14 @@
 package mcp
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"fmt"
+	"slices"
 	"time"
 
+	"github.com/pario-ai/pario/pkg/budget"
 	"github.com/pario-ai/pario/pkg/models"
 )
 
@@ -23,13 +27,24 @@ type toolHandler func(ctx context.Context, s *Server, args json.RawMessage) Tool
 
 // toolHandlers maps tool names to their handlers.
 var toolHandlers = map[string]toolHandler{
-	"pario_stats":          handleStats,
-	"pario_sessions":       handleSessions,
-	"pario_session_detail": handleSessionDetail,
-	"pario_budget":         handleBudget,
-	"pario_cache_stats":    handleCacheStats,
-	"pario_cost_report":    handleCostReport,
-	"pario_audit_search":   handleAuditSearch,
+	"pario_stats":             handleStats,
+	"pario_sessions":          handleSessions,
+	"pario_session_detail":    handleSessionDetail,
+	"pario_budget":            handleBudget,
+	"pario_cache_stats":       handleCacheStats,
+	"pario_cost_report":       handleCostReport,
+	"pario_audit_search":      handleAuditSearch,
+	"pario_throughput":        handleThroughput,
+	"pario_latency":           handleLatency,
+	"pario_providers":         handleProviders,
+	"pario_top":               handleTop,
+	"pario_anomalies":         handleAnomalies,
+	"pario_budget_simulate":   handleBudgetSimulate,
+	"pario_audit_get":         handleAuditGet,
+	"pario_budget_decisions":  handleBudgetDecisions,
+	"pario_budget_violations": handleBudgetViolations,
+	"pario_budget_policies":   handleBudgetPolicies,
+	"pario_budget_policy_set": handleBudgetPolicySet,
 }
 
 // allTools is the list of tool definitions exposed via tools/list.
@@ -49,7 +64,7 @@ var allTools = []ToolDefinition{
 	},
 	{
 		Name:        "pario_sessions",
-		Description: "List all tracked sessions, optionally filtered by API key.",
+		Description: "List all tracked sessions, optionally filtered by API key, name, or tags.",
 		InputSchema: map[string]any{
 			"type": "object",
 			"properties": map[string]any{
@@ -57,6 +72,15 @@ var allTools = []ToolDefinition{
 					"type":        "string",
 					"description": "Filter by API key (optional, omit for all keys)",
 				},
+				"name": map[string]any{
+					"type":        "string",
+					"description": "Filter by sessions whose name contains this text (optional)",
+				},
+				"tags": map[string]any{
+					"type":                 "object",
+					"description":          "Filter by session tag key/value pairs (optional)",
+					"additionalProperties": map[string]any{"type": "string"},
+				},
 			},
 		},
 	},
@@ -105,6 +129,20 @@ var allTools = []ToolDefinition{
 					"type":        "string",
 					"description": "Start date in YYYY-MM-DD format (optional, defaults to start of month)",
 				},
+				"labels": map[string]any{
+					"type":                 "object",
+					"description":          "Filter by X-Pario-Labels key/value pairs (optional)",
+					"additionalProperties": map[string]any{"type": "string"},
+				},
+				"metadata": map[string]any{
+					"type":                 "object",
+					"description":          "Filter by usage metadata captured from attribution.metadata_headers (optional)",
+					"additionalProperties": map[string]any{"type": "string"},
+				},
+				"group_by_label": map[string]any{
+					"type":        "string",
+					"description": "Group costs by the values of this label, or of metadata.<name>, instead of team/project (optional)",
+				},
 			},
 		},
 	},
@@ -141,6 +179,263 @@ var allTools = []ToolDefinition{
 			},
 		},
 	},
+	{
+		Name:        "pario_audit_get",
+		Description: "Fetch one audit entry by request ID, including the stored request/response bodies, headers, and metadata. Redaction settings are applied.",
+		InputSchema: map[string]any{
+			"type":     "object",
+			"required": []string{"request_id"},
+			"properties": map[string]any{
+				"request_id": map[string]any{
+					"type":        "string",
+					"description": "The request ID (X-Request-ID, or X-Pario-Request-ID when the client sent none)",
+				},
+			},
+		},
+	},
+	{
+		Name:        "pario_throughput",
+		Description: "Show output tokens/sec distributions (mean, p50, p90, min, max) per model and provider.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"since": map[string]any{
+					"type":        "string",
+					"description": "Start date in YYYY-MM-DD format (optional, defaults to the last 7 days)",
+				},
+			},
+		},
+	},
+	{
+		Name:        "pario_latency",
+		Description: "Show upstream latency percentiles (mean, p50, p95, p99, max in ms) per model and provider.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"since": map[string]any{
+					"type":        "string",
+					"description": "Start date in YYYY-MM-DD format (optional, defaults to the last 7 days)",
+				},
+			},
+		},
+	},
+	{
+		Name:        "pario_providers",
+		Description: "Show provider reliability: requests served, failed upstream attempts, error rate, failures recovered by a fallback route, and requests served as a fallback.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"since": map[string]any{
+					"type":        "string",
+					"description": "Start date in YYYY-MM-DD format (optional, defaults to the last 7 days)",
+				},
+			},
+		},
+	},
+	{
+		Name:        "pario_top",
+		Description: "Rank API keys, sessions, models, or teams by tokens or estimated cost over the last N hours.",
+		InputSchema: map[string]any{
+			"type":     "object",
+			"required": []string{"by"},
+			"properties": map[string]any{
+				"by": map[string]any{
+					"type":        "string",
+					"enum":        []string{models.TopByKey, models.TopBySession, models.TopByModel, models.TopByTeam},
+					"description": "What to rank",
+				},
+				"order": map[string]any{
+					"type":        "string",
+					"enum":        []string{models.TopOrderTokens, models.TopOrderCost},
+					"description": "Rank by total tokens or estimated cost (optional, defaults to tokens)",
+				},
+				"hours": map[string]any{
+					"type":        "integer",
+					"description": "Window in hours (optional, defaults to 24)",
+				},
+				"limit": map[string]any{
+					"type":        "integer",
+					"description": "Number of entries (optional, defaults to 10)",
+				},
+			},
+		},
+	},
+	{
+		Name:        "pario_anomalies",
+		Description: "List usage windows in which an API key's or team's tokens or estimated cost stood out from its own history, as found by the anomaly detection job.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"by": map[string]any{
+					"type":        "string",
+					"enum":        []string{models.TopByKey, models.TopByTeam},
+					"description": "Only anomalies of API keys or of teams (optional)",
+				},
+				"value": map[string]any{
+					"type":        "string",
+					"description": "Only anomalies of this API key or team (optional)",
+				},
+				"hours": map[string]any{
+					"type":        "integer",
+					"description": "Windows that ended within this many hours (optional, defaults to 24)",
+				},
+				"limit": map[string]any{
+					"type":        "integer",
+					"description": "Maximum anomalies to return (optional, defaults to 100)",
+				},
+			},
+		},
+	},
+	{
+		Name:        "pario_budget_simulate",
+		Description: "Evaluate hypothetical budget policies against the last N days of recorded usage and report how often, and for which API keys, they would have blocked requests.",
+		InputSchema: map[string]any{
+			"type":     "object",
+			"required": []string{"policies"},
+			"properties": map[string]any{
+				"policies": map[string]any{
+					"type":        "array",
+					"description": "Policies to simulate",
+					"items": map[string]any{
+						"type":     "object",
+						"required": []string{"api_key", "max_tokens", "period"},
+						"properties": map[string]any{
+							"api_key": map[string]any{
+								"type":        "string",
+								"description": "API key the policy applies to, or \"*\" for every key",
+							},
+							"model": map[string]any{
+								"type":        "string",
+								"description": "Restrict the policy to one model, or to a model pattern such as \"o3*\" (optional)",
+							},
+							"max_tokens": map[string]any{
+								"type":        "integer",
+								"description": "Token limit per period",
+							},
+							"period": map[string]any{
+								"type":        "string",
+								"enum":        []string{"daily", "monthly"},
+								"description": "Budget period",
+							},
+						},
+					},
+				},
+				"days": map[string]any{
+					"type":        "integer",
+					"description": "Days of recorded usage to replay (optional, defaults to 30)",
+				},
+			},
+		},
+	},
+	{
+		Name:        "pario_budget_decisions",
+		Description: "List recorded budget blocks and soft-limit warnings with the policy and usage that triggered them, newest first.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"api_key": map[string]any{
+					"type":        "string",
+					"description": "Filter by API key (optional)",
+				},
+				"action": map[string]any{
+					"type":        "string",
+					"enum":        []string{"block", "warn", "downgrade", "shed", "queue_full"},
+					"description": "Filter by action (optional)",
+				},
+				"since": map[string]any{
+					"type":        "string",
+					"description": "Start date in YYYY-MM-DD format (optional, defaults to 7 days ago)",
+				},
+				"limit": map[string]any{
+					"type":        "integer",
+					"description": "Maximum decisions to return (optional, defaults to 100)",
+				},
+			},
+		},
+	},
+	{
+		Name:        "pario_budget_violations",
+		Description: "List requests refused by budgets (blocks, low-priority sheds, and full budget queues) with the key, model, and policy, newest first.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"api_key": map[string]any{
+					"type":        "string",
+					"description": "Filter by API key (optional)",
+				},
+				"since": map[string]any{
+					"type":        "string",
+					"description": "Start date in YYYY-MM-DD format (optional, defaults to 7 days ago)",
+				},
+				"limit": map[string]any{
+					"type":        "integer",
+					"description": "Maximum violations to return (optional, defaults to 100)",
+				},
+			},
+		},
+	},
+	{
+		Name:        "pario_budget_policies",
+		Description: "List the managed budget policies stored in the tracker database, which replace configured policies with the same scope while active.",
+		InputSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{},
+		},
+	},
+	{
+		Name:        "pario_budget_policy_set",
+		Description: "Create a managed budget policy, replace the one with the given id, or delete it with delete set. Managed policies are stored in the tracker database and survive restarts.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"id": map[string]any{
+					"type":        "integer",
+					"description": "ID of the policy to replace or delete (omit to create one)",
+				},
+				"delete": map[string]any{
+					"type":        "boolean",
+					"description": "Delete the policy with the given id",
+				},
+				"api_key": map[string]any{
+					"type":        "string",
+					"description": "API key the policy applies to, or \"*\" for every key",
+				},
+				"team": map[string]any{
+					"type":        "string",
+					"description": "Attribution team the policy applies to (instead of api_key)",
+				},
+				"project": map[string]any{
+					"type":        "string",
+					"description": "Attribution project the policy applies to (instead of api_key)",
+				},
+				"env": map[string]any{
+					"type":        "string",
+					"description": "Attribution environment the policy applies to (instead of api_key)",
+				},
+				"model": map[string]any{
+					"type":        "string",
+					"description": "Restrict the policy to one model or model pattern (optional)",
+				},
+				"max_tokens": map[string]any{
+					"type":        "integer",
+					"description": "Token limit per period",
+				},
+				"max_cost_usd": map[string]any{
+					"type":        "number",
+					"description": "Estimated spend limit in USD per period",
+				},
+				"period": map[string]any{
+					"type":        "string",
+					"enum":        []string{"daily", "monthly"},
+					"description": "Budget period",
+				},
+				"expires_at": map[string]any{
+					"type":        "string",
+					"description": "RFC 3339 time the policy ends (optional, defaults to never)",
+				},
+			},
+		},
+	},
 }
 
 func textResult(text string) ToolCallResult {
@@ -169,11 +464,11 @@ func handleStats(ctx context.Context, s *Server, rawArgs json.RawMessage) ToolCa
 }
 
 func handleSessions(ctx context.Context, s *Server, rawArgs json.RawMessage) ToolCallResult {
-	var args apiKeyArgs
+	var args models.SessionQuery
 	if len(rawArgs) > 0 {
 		_ = json.Unmarshal(rawArgs, &args)
 	}
-	sessions, err := s.tracker.ListSessions(ctx, args.APIKey)
+	sessions, err := s.tracker.ListSessions(ctx, args)
 	if err != nil {
 		return errorResult("Error fetching sessions: " + err.Error())
 	}
@@ -207,13 +502,23 @@ func handleBudget(ctx context.Context, s *Server, rawArgs json.RawMessage) ToolC
 	if err != nil {
 		return errorResult("Error fetching budget status: " + err.Error())
 	}
+	if args.APIKey == "" {
+		labeled, err := s.enforcer.LabelStatus(ctx)
+		if err != nil {
+			return errorResult("Error fetching budget status: " + err.Error())
+		}
+		statuses = append(statuses, labeled...)
+	}
 	return textResult(formatBudgetStatus(statuses))
 }
 
 type costReportArgs struct {
-	Team    string `json:"team"`
-	Project string `json:"project"`
-	Since   string `json:"since"`
+	Team         string            `json:"team"`
+	Project      string            `json:"project"`
+	Since        string            `json:"since"`
+	Labels       map[string]string `json:"labels"`
+	Metadata     map[string]string `json:"metadata"`
+	GroupByLabel string            `json:"group_by_label"`
 }
 
 func handleCostReport(ctx context.Context, s *Server, rawArgs json.RawMessage) ToolCallResult {
@@ -222,37 +527,51 @@ func handleCostReport(ctx context.Context, s *Server, rawArgs json.RawMessage) T
 		_ = json.Unmarshal(rawArgs, &args)
 	}
 
-	since := beginningOfMonth()
+	loc := s.location(args.Team)
+	since := beginningOfMonth(loc)
 	if args.Since != "" {
-		t, err := time.Parse("2006-01-02", args.Since)
+		t, err := time.ParseInLocation("2006-01-02", args.Since, loc)
 		if err != nil {
 			return errorResult("Invalid since date (use YYYY-MM-DD): " + err.Error())
 		}
 		since = t
 	}
 
-	reports, err := s.tracker.CostReport(ctx, since, args.Team, args.Project)
+	pricingMap := make(map[string]models.ModelPricing, len(s.pricing))
+	for _, p := range s.pricing {
+		pricingMap[p.Model] = p
+	}
+
+	if args.GroupByLabel != "" || len(args.Labels) > 0 || len(args.Metadata) > 0 {
+		reports, err := s.tracker.LabelReport(ctx, models.LabelQuery{
+			Since:   since.UTC(),
+			GroupBy: args.GroupByLabel,
+			Filters: models.MetadataFilters(args.Labels, args.Metadata),
+		})
+		if err != nil {
+			return errorResult("Error fetching cost report: " + err.Error())
+		}
+		for i := range reports {
+			reports[i].Local = pricingMap[reports[i].Model].Local
+		}
+		return textResult(formatLabelReport(reports))
+	}
+
+	reports, err := s.tracker.CostReport(ctx, since.UTC(), args.Team, args.Project)
 	if err != nil {
 		return errorResult("Error fetching cost report: " + err.Error())
 	}
 
-	pricingMap := make(map[string]struct{ prompt, completion float64 }, len(s.pricing))
-	for _, p := range s.pricing {
-		pricingMap[p.Model] = struct{ prompt, completion float64 }{p.PromptCost, p.CompletionCost}
-	}
 	for i := range reports {
-		if p, ok := pricingMap[reports[i].Model]; ok {
-			reports[i].EstimatedCost = (float64(reports[i].PromptTokens)/1000)*p.prompt +
-				(float64(reports[i].CompletionTokens)/1000)*p.completion
-		}
+		reports[i].Local = pricingMap[reports[i].Model].Local
 	}
 
 	return textResult(formatCostReport(reports))
 }
 
-func beginningOfMonth() time.Time {
-	now := time.Now().UTC()
-	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+func beginningOfMonth(loc *time.Location) time.Time {
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
 }
 
 type auditSearchArgs struct {
@@ -292,6 +611,32 @@ func handleAuditSearch(ctx context.Context, s *Server, rawArgs json.RawMessage)
 	return textResult(formatAuditEntries(entries))
 }
 
+type auditGetArgs struct {
+	RequestID string `json:"request_id"`
+}
+
+func handleAuditGet(ctx context.Context, s *Server, rawArgs json.RawMessage) ToolCallResult {
+	if s.auditor == nil {
+		return textResult("Audit logging is not configured.")
+	}
+	var args auditGetArgs
+	if len(rawArgs) > 0 {
+		_ = json.Unmarshal(rawArgs, &args)
+	}
+	if args.RequestID == "" {
+		return errorResult("request_id is required")
+	}
+
+	entry, err := s.auditor.Get(ctx, args.RequestID)
+	if err != nil {
+		return errorResult("Error fetching audit entry: " + err.Error())
+	}
+	if entry == nil {
+		return textResult("No audit entry found for request ID " + args.RequestID + ".")
+	}
+	return textResult(formatAuditEntry(*entry))
+}
+
 func handleCacheStats(_ context.Context, s *Server, _ json.RawMessage) ToolCallResult {
 	if s.cache == nil {
 		return textResult("Cache is not configured.")
@@ -302,3 +647,313 @@ func handleCacheStats(_ context.Context, s *Server, _ json.RawMessage) ToolCallR
 	}
 	return textResult(formatCacheStats(stats))
 }
+
+type throughputArgs struct {
+	Since string `json:"since"`
+}
+
+func handleThroughput(ctx context.Context, s *Server, rawArgs json.RawMessage) ToolCallResult {
+	var args throughputArgs
+	if len(rawArgs) > 0 {
+		_ = json.Unmarshal(rawArgs, &args)
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -7)
+	if args.Since != "" {
+		t, err := time.ParseInLocation("2006-01-02", args.Since, s.location(""))
+		if err != nil {
+			return errorResult("Invalid since date (use YYYY-MM-DD): " + err.Error())
+		}
+		since = t.UTC()
+	}
+
+	stats, err := s.tracker.Throughput(ctx, since)
+	if err != nil {
+		return errorResult("Error fetching throughput: " + err.Error())
+	}
+	return textResult(formatThroughput(stats))
+}
+
+func handleLatency(ctx context.Context, s *Server, rawArgs json.RawMessage) ToolCallResult {
+	var args throughputArgs
+	if len(rawArgs) > 0 {
+		_ = json.Unmarshal(rawArgs, &args)
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -7)
+	if args.Since != "" {
+		t, err := time.ParseInLocation("2006-01-02", args.Since, s.location(""))
+		if err != nil {
+			return errorResult("Invalid since date (use YYYY-MM-DD): " + err.Error())
+		}
+		since = t.UTC()
+	}
+
+	stats, err := s.tracker.Latency(ctx, since)
+	if err != nil {
+		return errorResult("Error fetching latency: " + err.Error())
+	}
+	return textResult(formatLatency(stats))
+}
+
+func handleProviders(ctx context.Context, s *Server, rawArgs json.RawMessage) ToolCallResult {
+	var args throughputArgs
+	if len(rawArgs) > 0 {
+		_ = json.Unmarshal(rawArgs, &args)
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -7)
+	if args.Since != "" {
+		t, err := time.ParseInLocation("2006-01-02", args.Since, s.location(""))
+		if err != nil {
+			return errorResult("Invalid since date (use YYYY-MM-DD): " + err.Error())
+		}
+		since = t.UTC()
+	}
+
+	stats, err := s.tracker.ProviderReliability(ctx, since)
+	if err != nil {
+		return errorResult("Error fetching provider reliability: " + err.Error())
+	}
+	return textResult(formatProviders(stats))
+}
+
+type topArgs struct {
+	By    string `json:"by"`
+	Order string `json:"order"`
+	Hours int    `json:"hours"`
+	Limit int    `json:"limit"`
+}
+
+func handleTop(ctx context.Context, s *Server, rawArgs json.RawMessage) ToolCallResult {
+	var args topArgs
+	if len(rawArgs) > 0 {
+		_ = json.Unmarshal(rawArgs, &args)
+	}
+	if args.Hours < 0 {
+		return errorResult("hours must be positive")
+	}
+
+	q := models.TopQuery{
+		By:      args.By,
+		Since:   time.Now().Add(-time.Duration(cmp.Or(args.Hours, 24)) * time.Hour).UTC(),
+		OrderBy: args.Order,
+		Limit:   args.Limit,
+	}
+	if err := q.Validate(); err != nil {
+		return errorResult(err.Error())
+	}
+	entries, err := s.tracker.Top(ctx, q)
+	if err != nil {
+		return errorResult("Error fetching top usage: " + err.Error())
+	}
+	return textResult(formatTop(q.By, entries))
+}
+
+// anomalyStore stores detected usage anomalies; the SQLite tracker is one.
+type anomalyStore interface {
+	Anomalies(ctx context.Context, q models.AnomalyQuery) ([]models.Anomaly, error)
+}
+
+type anomaliesArgs struct {
+	By    string `json:"by"`
+	Value string `json:"value"`
+	Hours int    `json:"hours"`
+	Limit int    `json:"limit"`
+}
+
+func handleAnomalies(ctx context.Context, s *Server, rawArgs json.RawMessage) ToolCallResult {
+	store, ok := s.tracker.(anomalyStore)
+	if !ok {
+		return errorResult("Anomalies need the SQLite tracker.")
+	}
+	var args anomaliesArgs
+	if len(rawArgs) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return errorResult("Invalid arguments: " + err.Error())
+		}
+	}
+	if args.By != "" && args.By != models.TopByKey && args.By != models.TopByTeam {
+		return errorResult(fmt.Sprintf("invalid by %q (use api_key or team)", args.By))
+	}
+	if args.Hours < 0 {
+		return errorResult("hours must be positive")
+	}
+
+	anomalies, err := store.Anomalies(ctx, models.AnomalyQuery{
+		Since:     time.Now().Add(-time.Duration(cmp.Or(args.Hours, 24)) * time.Hour).UTC(),
+		Dimension: args.By,
+		Value:     args.Value,
+		Limit:     args.Limit,
+	})
+	if err != nil {
+		return errorResult("Error fetching anomalies: " + err.Error())
+	}
+	return textResult(formatAnomalies(anomalies))
+}
+
+type budgetSimulateArgs struct {
+	Policies []models.BudgetPolicy `json:"policies"`
+	Days     int                   `json:"days"`
+}
+
+func handleBudgetSimulate(ctx context.Context, s *Server, rawArgs json.RawMessage) ToolCallResult {
+	var args budgetSimulateArgs
+	if len(rawArgs) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return errorResult("Invalid arguments: " + err.Error())
+		}
+	}
+	if len(args.Policies) == 0 {
+		return errorResult("policies is required")
+	}
+	for _, p := range args.Policies {
+		if p.APIKey == "" || p.MaxTokens <= 0 {
+			return errorResult("each policy needs api_key and a positive max_tokens")
+		}
+		if p.Period != models.BudgetDaily && p.Period != models.BudgetMonthly {
+			return errorResult(fmt.Sprintf("invalid period %q (use daily or monthly)", p.Period))
+		}
+		if models.IsModelPattern(p.Model) {
+			if _, err := models.CompileModelPattern(p.Model); err != nil {
+				return errorResult(fmt.Sprintf("invalid model pattern %q: %v", p.Model, err))
+			}
+		}
+	}
+	if args.Days <= 0 {
+		args.Days = 30
+	}
+
+	records, err := s.tracker.QuerySince(ctx, time.Now().UTC().AddDate(0, 0, -args.Days))
+	if err != nil {
+		return errorResult("Error fetching usage: " + err.Error())
+	}
+	return textResult(formatBudgetSimulation(budget.Simulate(args.Policies, records, s.keyLoc), args.Days))
+}
+
+type budgetDecisionsArgs struct {
+	APIKey string `json:"api_key"`
+	Action string `json:"action"`
+	Since  string `json:"since"`
+	Limit  int    `json:"limit"`
+}
+
+func handleBudgetDecisions(ctx context.Context, s *Server, rawArgs json.RawMessage) ToolCallResult {
+	return budgetDecisions(ctx, s, rawArgs, false)
+}
+
+func handleBudgetViolations(ctx context.Context, s *Server, rawArgs json.RawMessage) ToolCallResult {
+	return budgetDecisions(ctx, s, rawArgs, true)
+}
+
+// budgetDecisions lists stored budget decisions, only denials when denied
+// is set.
+func budgetDecisions(ctx context.Context, s *Server, rawArgs json.RawMessage, denied bool) ToolCallResult {
+	var args budgetDecisionsArgs
+	if len(rawArgs) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return errorResult("Invalid arguments: " + err.Error())
+		}
+	}
+	action := models.BudgetAction(args.Action)
+	if action != "" && !slices.Contains(models.BudgetActions, action) {
+		return errorResult(fmt.Sprintf("invalid action %q (use block, warn, downgrade, shed, or queue_full)", args.Action))
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -7)
+	if args.Since != "" {
+		t, err := time.ParseInLocation("2006-01-02", args.Since, s.location(""))
+		if err != nil {
+			return errorResult("Invalid since date (use YYYY-MM-DD): " + err.Error())
+		}
+		since = t.UTC()
+	}
+
+	decisions, err := s.tracker.Decisions(ctx, models.BudgetDecisionQuery{
+		Since:  since,
+		APIKey: args.APIKey,
+		Action: action,
+		Denied: denied,
+		Limit:  args.Limit,
+	})
+	if err != nil {
+		return errorResult("Error fetching budget decisions: " + err.Error())
+	}
+	return textResult(formatBudgetDecisions(decisions))
+}
+
+// policyStore stores managed budget policies; the SQLite tracker is one.
+type policyStore interface {
+	ManagedPolicies(ctx context.Context) ([]models.ManagedBudgetPolicy, error)
+	CreatePolicy(ctx context.Context, p models.ManagedBudgetPolicy) (models.ManagedBudgetPolicy, error)
+	UpdatePolicy(ctx context.Context, p models.ManagedBudgetPolicy) (models.ManagedBudgetPolicy, error)
+	DeletePolicy(ctx context.Context, id int64) error
+}
+
+func handleBudgetPolicies(ctx context.Context, s *Server, _ json.RawMessage) ToolCallResult {
+	store, ok := s.tracker.(policyStore)
+	if !ok {
+		return errorResult("Budget policies need the SQLite tracker.")
+	}
+	policies, err := store.ManagedPolicies(ctx)
+	if err != nil {
+		return errorResult("Error fetching budget policies: " + err.Error())
+	}
+	return textResult(formatManagedPolicies(policies, time.Now()))
+}
+
+type budgetPolicySetArgs struct {
+	models.ManagedBudgetPolicy
+	Delete bool `json:"delete"`
+}
+
+func handleBudgetPolicySet(ctx context.Context, s *Server, rawArgs json.RawMessage) ToolCallResult {
+	store, ok := s.tracker.(policyStore)
+	if !ok {
+		return errorResult("Budget policies need the SQLite tracker.")
+	}
+	var args budgetPolicySetArgs
+	if len(rawArgs) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return errorResult("Invalid arguments: " + err.Error())
+		}
+	}
+	p := args.ManagedBudgetPolicy
+
+	var msg string
+	switch {
+	case args.Delete:
+		if p.ID == 0 {
+			return errorResult("id is required to delete a policy")
+		}
+		if err := store.DeletePolicy(ctx, p.ID); err != nil {
+			return errorResult("Error deleting budget policy: " + err.Error())
+		}
+		msg = fmt.Sprintf("Deleted budget policy %d.", p.ID)
+	default:
+		if err := p.ValidateAt(time.Now()); err != nil {
+			return errorResult("Invalid budget policy: " + err.Error())
+		}
+		var err error
+		verb := "Created"
+		if p.ID == 0 {
+			p, err = store.CreatePolicy(ctx, p)
+		} else {
+			p, err = store.UpdatePolicy(ctx, p)
+			verb = "Updated"
+		}
+		if err != nil {
+			return errorResult("Error saving budget policy: " + err.Error())
+		}
+		msg = fmt.Sprintf("%s budget policy %d: %s %s/%s.", verb, p.ID, p.Subject(), p.FormatLimit(), p.Period)
+	}
+
+	// A proxy sharing the database picks the change up on its next policy
+	// sync; an enforcer shared with this server applies it now.
+	if s.enforcer != nil {
+		if managed, err := store.ManagedPolicies(ctx); err == nil {
+			s.enforcer.SetManaged(managed)
+		}
+	}
+	return textResult(msg)
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/pario-ai/pario/pkg/jsonbody"
+)
+
+func init() {
+	Register("headers", newHeaders)
+	Register("system_prompt", newSystemPrompt)
+}
+
+// headers stamps fixed headers on upstream requests and client responses.
+type headers struct {
+	Request  map[string]string `yaml:"request"`
+	Response map[string]string `yaml:"response"`
+}
+
+func newHeaders(cfg Config) (Middleware, error) {
+	h := &headers{}
+	if err := cfg.Decode(h); err != nil {
+		return nil, err
+	}
+	if len(h.Request) == 0 && len(h.Response) == 0 {
+		return nil, errors.New("request or response headers required")
+	}
+	return h, nil
+}
+
+func (h *headers) BeforeRoute(_ context.Context, req *Request) error {
+	for k, v := range h.Request {
+		req.Header.Set(k, v)
+	}
+	return nil
+}
+
+func (h *headers) AfterResponse(_ context.Context, _ *Request, resp *Response) error {
+	for k, v := range h.Response {
+		resp.Header.Set(k, v)
+	}
+	return nil
+}
+
+// systemPrompt prepends text to the system prompt of requests for Models,
+// or of all requests when Models is empty. Chat requests get a new first
+// system message; Messages requests get the text ahead of their system
+// field.
+type systemPrompt struct {
+	Text   string   `yaml:"text"`
+	Models []string `yaml:"models"`
+}
+
+func newSystemPrompt(cfg Config) (Middleware, error) {
+	p := &systemPrompt{}
+	if err := cfg.Decode(p); err != nil {
+		return nil, err
+	}
+	if p.Text == "" {
+		return nil, errors.New("text is required")
+	}
+	return p, nil
+}
+
+func (p *systemPrompt) BeforeRoute(_ context.Context, req *Request) error {
+	if len(p.Models) > 0 && !slices.Contains(p.Models, req.Model) {
+		return nil
+	}
+	var body []byte
+	var err error
+	switch req.Endpoint {
+	case "chat":
+		body, err = p.prefixChat(req.Body)
+	case "messages":
+		body, err = p.prefixMessages(req.Body)
+	default:
+		return nil
+	}
+	if err != nil {
+		return &RejectError{StatusCode: http.StatusBadRequest, Message: "invalid request body"}
+	}
+	req.Body = body
+	return nil
+}
+
+func (p *systemPrompt) AfterResponse(context.Context, *Request, *Response) error { return nil }
+
+func (p *systemPrompt) prefixChat(body []byte) ([]byte, error) {
+	start, end, found, err := jsonbody.FieldSpan(body, "messages")
+	if err != nil {
+		return nil, err
+	}
+	if !found || body[start] != '[' {
+		return nil, errors.New("messages is not an array")
+	}
+	msg, err := json.Marshal(map[string]string{"role": "system", "content": p.Text})
+	if err != nil {
+		return nil, err
+	}
+	rest := body[start+1 : end]
+	msgs := append([]byte{'['}, msg...)
+	if t := bytes.TrimSpace(rest); len(t) > 0 && t[0] != ']' {
+		msgs = append(msgs, ',')
+	}
+	return jsonbody.SetField(body, "messages", append(msgs, rest...))
+}
+
+func (p *systemPrompt) prefixMessages(body []byte) ([]byte, error) {
+	start, end, found, err := jsonbody.FieldSpan(body, "system")
+	if err != nil {
+		return nil, err
+	}
+	text := p.Text
+	if found {
+		switch body[start] {
+		case '"':
+			var existing string
+			if err := json.Unmarshal(body[start:end], &existing); err != nil {
+				return nil, err
+			}
+			text += "\n\n" + existing
+		case '[':
+			block, err := json.Marshal(map[string]string{"type": "text", "text": p.Text})
+			if err != nil {
+				return nil, err
+			}
+			rest := body[start+1 : end]
+			blocks := append([]byte{'['}, block...)
+			if t := bytes.TrimSpace(rest); len(t) > 0 && t[0] != ']' {
+				blocks = append(blocks, ',')
+			}
+			return jsonbody.SetField(body, "system", append(blocks, rest...))
+		}
+	}
+	system, err := json.Marshal(text)
+	if err != nil {
+		return nil, err
+	}
+	return jsonbody.SetField(body, "system", system)
+}
@@ -0,0 +1,194 @@
+// Package middleware provides ordered hooks around proxied chat requests.
+// BeforeRoute hooks see the parsed request before the cache, budget, and
+// router and may rewrite its body or add upstream headers; AfterResponse
+// hooks see the response before it is returned to the client. Hooks are
+// configured in YAML by type; Go code can add types with Register.
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Request is a proxied request as seen by middleware.
+type Request struct {
+	// Endpoint is "chat" or "messages".
+	Endpoint string
+	APIKey   string
+	Model    string
+	// Body is the JSON request body. A hook that changes it must keep it a
+	// valid request for the endpoint; the proxy parses it again.
+	Body []byte
+	// Header holds headers added to every upstream request. Provider
+	// credentials are set after them and can't be overridden.
+	Header http.Header
+}
+
+// Response is an upstream response as seen by middleware.
+type Response struct {
+	// Provider and Model name the route that served the response. Both
+	// are empty for cache hits.
+	Provider   string
+	Model      string
+	StatusCode int
+	// Header holds the headers returned to the client.
+	Header http.Header
+	// Body is the response body. It is nil for streamed responses, whose
+	// AfterResponse hooks run once the upstream headers arrive, before the
+	// stream is relayed.
+	Body     []byte
+	Streamed bool
+	Cached   bool
+}
+
+// Middleware intercepts proxied requests.
+type Middleware interface {
+	// BeforeRoute runs before the request is checked against the cache
+	// and budgets and routed. Returning an error rejects the request.
+	BeforeRoute(ctx context.Context, req *Request) error
+	// AfterResponse runs once the upstream response is available. Errors
+	// are logged; the response is still returned.
+	AfterResponse(ctx context.Context, req *Request, resp *Response) error
+}
+
+// Funcs adapts a pair of functions to Middleware. Nil functions do
+// nothing.
+type Funcs struct {
+	Before func(ctx context.Context, req *Request) error
+	After  func(ctx context.Context, req *Request, resp *Response) error
+}
+
+// BeforeRoute implements Middleware.
+func (f Funcs) BeforeRoute(ctx context.Context, req *Request) error {
+	if f.Before == nil {
+		return nil
+	}
+	return f.Before(ctx, req)
+}
+
+// AfterResponse implements Middleware.
+func (f Funcs) AfterResponse(ctx context.Context, req *Request, resp *Response) error {
+	if f.After == nil {
+		return nil
+	}
+	return f.After(ctx, req, resp)
+}
+
+// RejectError is returned by BeforeRoute to reject a request with a
+// specific status. Other errors reject it with 500.
+type RejectError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *RejectError) Error() string { return e.Message }
+
+// Chain runs middleware in order: BeforeRoute hooks first to last and
+// AfterResponse hooks last to first, so the first middleware wraps the
+// others.
+type Chain []Middleware
+
+// BeforeRoute runs each BeforeRoute hook, stopping at the first error.
+func (c Chain) BeforeRoute(ctx context.Context, req *Request) error {
+	for _, m := range c {
+		if err := m.BeforeRoute(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AfterResponse runs each AfterResponse hook in reverse order, stopping at
+// the first error.
+func (c Chain) AfterResponse(ctx context.Context, req *Request, resp *Response) error {
+	for i := len(c) - 1; i >= 0; i-- {
+		if err := c[i].AfterResponse(ctx, req, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Config configures one middleware. Type selects a registered factory;
+// the other YAML keys are the type's options.
+type Config struct {
+	Type string `yaml:"type"`
+	node *yaml.Node
+}
+
+// UnmarshalYAML keeps the whole mapping so the factory can decode its
+// options.
+func (c *Config) UnmarshalYAML(n *yaml.Node) error {
+	var t struct {
+		Type string `yaml:"type"`
+	}
+	if err := n.Decode(&t); err != nil {
+		return err
+	}
+	c.Type, c.node = t.Type, n
+	return nil
+}
+
+// Decode decodes the middleware's options into v, a pointer to a struct
+// with yaml tags.
+func (c Config) Decode(v any) error {
+	if c.node == nil {
+		return nil
+	}
+	return c.node.Decode(v)
+}
+
+// Factory builds a middleware from its config.
+type Factory func(cfg Config) (Middleware, error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{}
+)
+
+// Register makes a middleware type available to config. It panics if the
+// type is already registered.
+func Register(typ string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := factories[typ]; dup {
+		panic("middleware: type registered twice: " + typ)
+	}
+	factories[typ] = f
+}
+
+// Types returns the registered middleware types, sorted.
+func Types() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	types := make([]string, 0, len(factories))
+	for t := range factories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// New builds a chain from configs, in order.
+func New(cfgs []Config) (Chain, error) {
+	chain := make(Chain, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		mu.RLock()
+		f, ok := factories[cfg.Type]
+		mu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("middleware[%d]: unknown type %q", i, cfg.Type)
+		}
+		m, err := f(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("middleware[%d] (%s): %w", i, cfg.Type, err)
+		}
+		chain = append(chain, m)
+	}
+	return chain, nil
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	mw := func(name string) Middleware {
+		return Funcs{
+			Before: func(context.Context, *Request) error {
+				calls = append(calls, "before "+name)
+				return nil
+			},
+			After: func(context.Context, *Request, *Response) error {
+				calls = append(calls, "after "+name)
+				return nil
+			},
+		}
+	}
+	c := Chain{mw("a"), mw("b")}
+	if err := c.BeforeRoute(context.Background(), &Request{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AfterResponse(context.Background(), &Request{}, &Response{}); err != nil {
+		t.Fatal(err)
+	}
+	want := "before a,before b,after b,after a"
+	if got := strings.Join(calls, ","); got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+}
+
+func TestChainStopsOnError(t *testing.T) {
+	reject := &RejectError{StatusCode: http.StatusForbidden, Message: "no"}
+	ran := false
+	c := Chain{
+		Funcs{Before: func(context.Context, *Request) error { return reject }},
+		Funcs{Before: func(context.Context, *Request) error { ran = true; return nil }},
+	}
+	err := c.BeforeRoute(context.Background(), &Request{})
+	var rej *RejectError
+	if !errors.As(err, &rej) || rej.StatusCode != http.StatusForbidden {
+		t.Errorf("err = %v, want the RejectError", err)
+	}
+	if ran {
+		t.Error("later middleware ran after an error")
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"headers", "- type: headers\n  request: {X-Org: acme}", ""},
+		{"system prompt", "- type: system_prompt\n  text: Be brief.\n  models: [gpt-4]", ""},
+		{"unknown type", "- type: nope", `middleware[0]: unknown type "nope"`},
+		{"headers without headers", "- type: headers", "request or response headers required"},
+		{"prompt without text", "- {type: headers, response: {X-A: b}}\n- type: system_prompt", "middleware[1] (system_prompt): text is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfgs []Config
+			if err := yaml.Unmarshal([]byte(tt.yaml), &cfgs); err != nil {
+				t.Fatal(err)
+			}
+			_, err := New(cfgs)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSystemPrompt(t *testing.T) {
+	p := &systemPrompt{Text: "Be brief."}
+	tests := []struct {
+		name     string
+		endpoint string
+		model    string
+		body     string
+		want     string
+	}{
+		{
+			"chat",
+			"chat", "gpt-4",
+			`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`,
+			`{"model":"gpt-4","messages":[{"content":"Be brief.","role":"system"},{"role":"user","content":"hi"}]}`,
+		},
+		{
+			"chat without messages",
+			"chat", "gpt-4",
+			`{"model":"gpt-4","messages":[]}`,
+			`{"model":"gpt-4","messages":[{"content":"Be brief.","role":"system"}]}`,
+		},
+		{
+			"messages string system",
+			"messages", "claude",
+			`{"model":"claude","system":"Be nice.","messages":[]}`,
+			`{"model":"claude","system":"Be brief.\n\nBe nice.","messages":[]}`,
+		},
+		{
+			"messages block system",
+			"messages", "claude",
+			`{"model":"claude","system":[{"type":"text","text":"Be nice."}]}`,
+			`{"model":"claude","system":[{"text":"Be brief.","type":"text"},{"type":"text","text":"Be nice."}]}`,
+		},
+		{
+			"messages without system",
+			"messages", "claude",
+			`{"model":"claude","messages":[]}`,
+			`{"system":"Be brief.","model":"claude","messages":[]}`,
+		},
+		{
+			"other endpoint",
+			"embeddings", "gpt-4",
+			`{"model":"gpt-4"}`,
+			`{"model":"gpt-4"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{Endpoint: tt.endpoint, Model: tt.model, Body: []byte(tt.body)}
+			if err := p.BeforeRoute(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			if string(req.Body) != tt.want {
+				t.Errorf("body = %s\nwant   %s", req.Body, tt.want)
+			}
+		})
+	}
+
+	scoped := &systemPrompt{Text: "Be brief.", Models: []string{"gpt-4"}}
+	req := &Request{Endpoint: "chat", Model: "gpt-3.5", Body: []byte(`{"messages":[]}`)}
+	if err := scoped.BeforeRoute(context.Background(), req); err != nil || string(req.Body) != `{"messages":[]}` {
+		t.Errorf("model-scoped prompt changed another model's request: %s", req.Body)
+	}
+
+	req = &Request{Endpoint: "chat", Model: "gpt-4", Body: []byte(`{"messages":"hi"}`)}
+	var rej *RejectError
+	if err := p.BeforeRoute(context.Background(), req); !errors.As(err, &rej) || rej.StatusCode != http.StatusBadRequest {
+		t.Errorf("err = %v, want 400 RejectError", err)
+	}
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Metrics an anomaly is detected on.
+const (
+	AnomalyMetricTokens = "tokens"
+	AnomalyMetricCost   = "cost"
+)
+
+// WindowUsage is a dimension value's usage of one model in one
+// fixed-width window.
+type WindowUsage struct {
+	Value string    `json:"value"`
+	Start time.Time `json:"start"`
+	// Usage holds the window's unpriced token counts; its EstimatedCost is
+	// the media cost.
+	Usage CostReport `json:"usage"`
+}
+
+// Anomaly is a window in which an API key's or team's usage departed from
+// its own history.
+type Anomaly struct {
+	ID int64 `json:"id"`
+	// Dimension is TopByKey or TopByTeam, and Value the key or team.
+	Dimension   string    `json:"dimension"`
+	Value       string    `json:"value"`
+	Metric      string    `json:"metric"`
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	// Observed is the window's usage so far, in tokens or dollars.
+	Observed float64 `json:"observed"`
+	// Median, Mean, and StdDev describe the baseline windows before it.
+	Median float64 `json:"median"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	// ZScore is how many standard deviations Observed is above Mean, or
+	// zero when the baseline doesn't vary.
+	ZScore     float64   `json:"z_score"`
+	DetectedAt time.Time `json:"detected_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// AnomalyQuery filters stored anomalies.
+type AnomalyQuery struct {
+	// Since selects anomalies whose window ends after it.
+	Since     time.Time `json:"since"`
+	Dimension string    `json:"dimension,omitempty"`
+	Value     string    `json:"value,omitempty"`
+	Limit     int       `json:"limit,omitempty"`
+}
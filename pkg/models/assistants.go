@@ -0,0 +1,39 @@
+package models
+
+// AssistantRun is the subset of an OpenAI Assistants API run object that
+// Pario reads for tracking. Usage is only set once the run reaches a
+// terminal status.
+type AssistantRun struct {
+	ID          string `json:"id"`
+	Object      string `json:"object"`
+	ThreadID    string `json:"thread_id"`
+	AssistantID string `json:"assistant_id"`
+	Status      string `json:"status"`
+	Model       string `json:"model"`
+	StartedAt   int64  `json:"started_at,omitempty"`
+	CompletedAt int64  `json:"completed_at,omitempty"`
+	FailedAt    int64  `json:"failed_at,omitempty"`
+	CancelledAt int64  `json:"cancelled_at,omitempty"`
+	Usage       *Usage `json:"usage,omitempty"`
+}
+
+// Terminal reports whether the run has finished and its usage is final.
+func (r AssistantRun) Terminal() bool {
+	switch r.Status {
+	case "completed", "failed", "cancelled", "expired", "incomplete":
+		return true
+	}
+	return false
+}
+
+// EndedAt returns the Unix time the run finished, or 0 if unknown.
+func (r AssistantRun) EndedAt() int64 {
+	switch {
+	case r.CompletedAt > 0:
+		return r.CompletedAt
+	case r.FailedAt > 0:
+		return r.FailedAt
+	default:
+		return r.CancelledAt
+	}
+}
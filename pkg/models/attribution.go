@@ -1,5 +1,10 @@
 package models
 
+import (
+	"maps"
+	"time"
+)
+
 // CostLabel holds attribution labels for a request.
 type CostLabel struct {
 	Team    string `json:"team,omitempty" yaml:"team"`
@@ -12,16 +17,168 @@ type ModelPricing struct {
 	Model          string  `json:"model" yaml:"model"`
 	PromptCost     float64 `json:"prompt_cost_per_1k" yaml:"prompt_cost_per_1k"`
 	CompletionCost float64 `json:"completion_cost_per_1k" yaml:"completion_cost_per_1k"`
+	// Local marks a model served by a local engine, whose tokens are free.
+	Local bool `json:"local,omitempty" yaml:"local"`
+	// Images prices generated images by size and quality.
+	Images []ImagePrice `json:"images,omitempty" yaml:"images"`
+	// AudioMinuteCost prices transcribed or translated audio per minute.
+	AudioMinuteCost float64 `json:"audio_cost_per_minute,omitempty" yaml:"audio_cost_per_minute"`
+	// CharacterCost prices text-to-speech input per 1K characters.
+	CharacterCost float64 `json:"character_cost_per_1k,omitempty" yaml:"character_cost_per_1k"`
+	// CacheReadCost and CacheCreationCost price prompt tokens read from
+	// and written to the provider's prompt cache per 1K, and
+	// ReasoningCost completion tokens spent on reasoning. Zero prices them
+	// like other prompt or completion tokens.
+	CacheReadCost     float64 `json:"cache_read_cost_per_1k,omitempty" yaml:"cache_read_cost_per_1k"`
+	CacheCreationCost float64 `json:"cache_creation_cost_per_1k,omitempty" yaml:"cache_creation_cost_per_1k"`
+	ReasoningCost     float64 `json:"reasoning_cost_per_1k,omitempty" yaml:"reasoning_cost_per_1k"`
+}
+
+// TokenCounts breaks down token usage for pricing. CacheRead and
+// CacheCreation are part of Prompt, and Reasoning is part of Completion.
+type TokenCounts struct {
+	Prompt, Completion                  int64
+	CacheRead, CacheCreation, Reasoning int64
+}
+
+// ImagePrice is the cost of one generated image. An empty Size or Quality
+// matches any value.
+type ImagePrice struct {
+	Size    string  `json:"size,omitempty" yaml:"size"`
+	Quality string  `json:"quality,omitempty" yaml:"quality"`
+	Cost    float64 `json:"cost" yaml:"cost"`
+}
+
+// ImageCost returns the price of one image of the given size and quality.
+// An exact match wins over entries that leave size or quality empty.
+func (p ModelPricing) ImageCost(size, quality string) (float64, bool) {
+	best, found := -1, false
+	var cost float64
+	for _, ip := range p.Images {
+		if (ip.Size != "" && ip.Size != size) || (ip.Quality != "" && ip.Quality != quality) {
+			continue
+		}
+		score := 0
+		if ip.Size != "" {
+			score += 2
+		}
+		if ip.Quality != "" {
+			score++
+		}
+		if score > best {
+			best, cost, found = score, ip.Cost, true
+		}
+	}
+	return cost, found
+}
+
+// Cost returns the estimated cost of the given token counts.
+func (p ModelPricing) Cost(promptTokens, completionTokens int64) float64 {
+	return p.TokenCost(TokenCounts{Prompt: promptTokens, Completion: completionTokens})
+}
+
+// TokenCost returns the estimated cost of c, pricing cached and reasoning
+// tokens at their own rates where set.
+func (p ModelPricing) TokenCost(c TokenCounts) float64 {
+	per1k := func(tokens int64, cost float64) float64 { return float64(tokens) / 1000 * cost }
+	or := func(cost, fallback float64) float64 {
+		if cost == 0 {
+			return fallback
+		}
+		return cost
+	}
+	return per1k(c.Prompt-c.CacheRead-c.CacheCreation, p.PromptCost) +
+		per1k(c.CacheRead, or(p.CacheReadCost, p.PromptCost)) +
+		per1k(c.CacheCreation, or(p.CacheCreationCost, p.PromptCost)) +
+		per1k(c.Completion-c.Reasoning, p.CompletionCost) +
+		per1k(c.Reasoning, or(p.ReasoningCost, p.CompletionCost))
 }
 
-// CostReport is an aggregated cost row grouped by team, project, and model.
+// LabelQuery selects usage by free-form labels. Filters must all match.
+// GroupBy names the label whose values form the report rows; when empty,
+// rows are grouped by model only. Keys of the form "metadata.<name>" select
+// usage metadata rather than labels.
+type LabelQuery struct {
+	Since   time.Time
+	GroupBy string
+	Filters map[string]string
+}
+
+// MetadataPrefix marks LabelQuery keys that select usage metadata rather
+// than labels.
+const MetadataPrefix = "metadata."
+
+// MetadataFilters returns LabelQuery filters matching labels and the
+// usage metadata in metadata.
+func MetadataFilters(labels, metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return labels
+	}
+	filters := maps.Clone(labels)
+	if filters == nil {
+		filters = make(map[string]string, len(metadata))
+	}
+	for k, v := range metadata {
+		filters[MetadataPrefix+k] = v
+	}
+	return filters
+}
+
+// LabelReport is an aggregated usage row grouped by a label value and model.
+// EstimatedCost sums the costs stored on its records when they were
+// recorded.
+type LabelReport struct {
+	Label            string `json:"label"`
+	Value            string `json:"value"`
+	Model            string `json:"model"`
+	RequestCount     int    `json:"request_count"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+	// CacheReadTokens, CacheCreationTokens, and ReasoningTokens are
+	// priced apart from the rest of the prompt and completion tokens.
+	CacheReadTokens     int64   `json:"cache_read_tokens,omitempty"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens,omitempty"`
+	ReasoningTokens     int64   `json:"reasoning_tokens,omitempty"`
+	EstimatedCost       float64 `json:"estimated_cost"`
+	// Local is set when the model is served by a local engine, so its zero
+	// cost means free rather than unpriced.
+	Local bool `json:"local,omitempty"`
+}
+
+// CostReport is an aggregated cost row grouped by team, project, model,
+// provider, and route alias. EstimatedCost sums the costs stored on its
+// records when they were recorded.
 type CostReport struct {
-	Team             string  `json:"team"`
-	Project          string  `json:"project"`
-	Model            string  `json:"model"`
-	RequestCount     int     `json:"request_count"`
-	PromptTokens     int64   `json:"prompt_tokens"`
-	CompletionTokens int64   `json:"completion_tokens"`
-	TotalTokens      int64   `json:"total_tokens"`
-	EstimatedCost    float64 `json:"estimated_cost"`
+	Team    string `json:"team"`
+	Project string `json:"project"`
+	Model   string `json:"model"`
+	// Provider and RouteAlias split a model's cost by the vendor that
+	// served it and the route it was requested through, so fallback
+	// traffic lands on the right invoice. Spend rows leave them empty.
+	Provider         string `json:"provider,omitempty"`
+	RouteAlias       string `json:"route_alias,omitempty"`
+	RequestCount     int    `json:"request_count"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+	// CacheReadTokens, CacheCreationTokens, and ReasoningTokens are
+	// priced apart from the rest of the prompt and completion tokens.
+	CacheReadTokens     int64   `json:"cache_read_tokens,omitempty"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens,omitempty"`
+	ReasoningTokens     int64   `json:"reasoning_tokens,omitempty"`
+	EstimatedCost       float64 `json:"estimated_cost"`
+	// Local is set when the model is served by a local engine, so its zero
+	// cost means free rather than unpriced.
+	Local bool `json:"local,omitempty"`
+}
+
+// Tokens returns the row's token counts for pricing.
+func (r LabelReport) Tokens() TokenCounts {
+	return TokenCounts{r.PromptTokens, r.CompletionTokens, r.CacheReadTokens, r.CacheCreationTokens, r.ReasoningTokens}
+}
+
+// Tokens returns the row's token counts for pricing.
+func (r CostReport) Tokens() TokenCounts {
+	return TokenCounts{r.PromptTokens, r.CompletionTokens, r.CacheReadTokens, r.CacheCreationTokens, r.ReasoningTokens}
 }
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Batch is the subset of an OpenAI Batch API object that Pario reads for
+// tracking. Model and Usage are only reported by newer API versions; when
+// they are missing, usage is read from the batch's output file.
+type Batch struct {
+	ID           string      `json:"id"`
+	Object       string      `json:"object"`
+	Endpoint     string      `json:"endpoint"`
+	Status       string      `json:"status"`
+	Model        string      `json:"model,omitempty"`
+	OutputFileID string      `json:"output_file_id,omitempty"`
+	Usage        *BatchUsage `json:"usage,omitempty"`
+}
+
+// BatchUsage is the aggregate token usage of a batch.
+type BatchUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// Terminal reports whether the batch has finished and its usage is final.
+func (b Batch) Terminal() bool {
+	switch b.Status {
+	case "completed", "failed", "expired", "cancelled":
+		return true
+	}
+	return false
+}
+
+// BatchJob is a batch submitted through Pario. It keeps the attribution of
+// the request that created the batch so the batch's usage can be recorded
+// against the submitter once it finishes, hours later.
+type BatchJob struct {
+	ID         string            `json:"id"`
+	Provider   string            `json:"provider"`
+	APIKey     string            `json:"api_key"`
+	Endpoint   string            `json:"endpoint"`
+	Team       string            `json:"team,omitempty"`
+	Project    string            `json:"project,omitempty"`
+	Env        string            `json:"env,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Pipeline   string            `json:"pipeline,omitempty"`
+	Branch     string            `json:"branch,omitempty"`
+	Commit     string            `json:"commit,omitempty"`
+	Status     string            `json:"status"`
+	CreatedAt  time.Time         `json:"created_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+}
@@ -1,5 +1,11 @@
 package models
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 // BudgetPeriod defines the time window for a budget policy.
 type BudgetPeriod string
 
@@ -8,12 +14,270 @@ const (
 	BudgetMonthly BudgetPeriod = "monthly"
 )
 
-// BudgetPolicy defines max tokens per API key per period.
+// BudgetPolicy defines max tokens, max spend in USD, or both, per API key
+// per period. A policy with Team, Project, or Env set is label-scoped
+// instead: it applies to requests carrying all of those labels and counts
+// their usage across every key.
 type BudgetPolicy struct {
 	APIKey    string       `json:"api_key" yaml:"api_key"`
+	Team      string       `json:"team,omitempty" yaml:"team,omitempty"`
+	Project   string       `json:"project,omitempty" yaml:"project,omitempty"`
+	Env       string       `json:"env,omitempty" yaml:"env,omitempty"`
 	Model     string       `json:"model,omitempty" yaml:"model,omitempty"`
 	MaxTokens int64        `json:"max_tokens" yaml:"max_tokens"`
 	Period    BudgetPeriod `json:"period" yaml:"period"`
+	// MaxCostUSD limits estimated spend, from token pricing plus per-unit
+	// media costs such as images. Zero means no spend limit.
+	MaxCostUSD float64 `json:"max_cost_usd,omitempty" yaml:"max_cost_usd,omitempty"`
+	// WarnAt is a soft limit as a fraction of MaxTokens. Crossing it is
+	// recorded as a warning decision but doesn't block. Zero disables it.
+	WarnAt float64 `json:"warn_at,omitempty" yaml:"warn_at,omitempty"`
+	// DowngradeAt is a fraction of the limits past which requests prefer
+	// the downgrade targets of their route for the rest of the period.
+	// Zero disables it.
+	DowngradeAt float64 `json:"downgrade_at,omitempty" yaml:"downgrade_at,omitempty"`
+	// Action is what happens to requests once the policy is exhausted:
+	// BudgetBlock, the default, rejects them, and BudgetDowngrade sends
+	// them to their route's downgrade targets only.
+	Action BudgetAction `json:"action,omitempty" yaml:"action,omitempty"`
+	// Grace lets usage run past the limits by this fraction of them before
+	// the policy blocks, e.g. 0.05 for a 5% overshoot. Soft limits and
+	// remaining budget are still measured against the limits themselves.
+	Grace float64 `json:"grace,omitempty" yaml:"grace,omitempty"`
+	// Carryover raises the limits of each period by what was left unused
+	// of them in the period before. Unused carryover doesn't carry again.
+	Carryover bool `json:"carryover,omitempty" yaml:"carryover,omitempty"`
+	// Message replaces the error message of requests the policy blocks,
+	// and HelpURL is added to their error, e.g. a page on requesting more.
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+	HelpURL string `json:"help_url,omitempty" yaml:"help_url,omitempty"`
+}
+
+// Labels returns the attribution labels the policy is scoped to.
+func (p BudgetPolicy) Labels() CostLabel {
+	return CostLabel{Team: p.Team, Project: p.Project, Env: p.Env}
+}
+
+// LabelScoped reports whether the policy is scoped to attribution labels
+// rather than API keys.
+func (p BudgetPolicy) LabelScoped() bool {
+	return p.Team != "" || p.Project != "" || p.Env != ""
+}
+
+// AppliesTo reports whether the policy covers a request from apiKey
+// carrying labels, ignoring its model filter. A label-scoped policy
+// matches on labels alone.
+func (p BudgetPolicy) AppliesTo(apiKey string, labels CostLabel) bool {
+	if p.LabelScoped() {
+		return (p.Team == "" || p.Team == labels.Team) &&
+			(p.Project == "" || p.Project == labels.Project) &&
+			(p.Env == "" || p.Env == labels.Env)
+	}
+	return p.APIKey == "*" || p.APIKey == apiKey
+}
+
+// Subject describes who the policy applies to: its API key, or its labels
+// as "team=x,env=y".
+func (p BudgetPolicy) Subject() string {
+	if !p.LabelScoped() {
+		return p.APIKey
+	}
+	var parts []string
+	for _, l := range [][2]string{{"team", p.Team}, {"project", p.Project}, {"env", p.Env}} {
+		if l[1] != "" {
+			parts = append(parts, l[0]+"="+l[1])
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// SameScope reports whether p and q limit the same usage: the same key or
+// labels, model filter, and period.
+func (p BudgetPolicy) SameScope(q BudgetPolicy) bool {
+	return p.APIKey == q.APIKey && p.Labels() == q.Labels() && p.Model == q.Model && p.Period == q.Period
+}
+
+// Validate checks the policy's thresholds, limits, grace, action, scope,
+// and model pattern.
+func (p BudgetPolicy) Validate() error {
+	if p.WarnAt < 0 || p.WarnAt >= 1 {
+		return fmt.Errorf("warn_at must be in [0, 1)")
+	}
+	if p.DowngradeAt < 0 || p.DowngradeAt >= 1 {
+		return fmt.Errorf("downgrade_at must be in [0, 1)")
+	}
+	if p.Grace < 0 || p.Grace >= 1 {
+		return fmt.Errorf("grace must be in [0, 1)")
+	}
+	if p.MaxCostUSD < 0 {
+		return fmt.Errorf("max_cost_usd must not be negative")
+	}
+	if p.Action != "" && p.Action != BudgetBlock && p.Action != BudgetDowngrade {
+		return fmt.Errorf("action must be block or downgrade")
+	}
+	if IsModelPattern(p.Model) {
+		if _, err := CompileModelPattern(p.Model); err != nil {
+			return fmt.Errorf("invalid model pattern: %w", err)
+		}
+	}
+	if p.LabelScoped() && p.APIKey != "" && p.APIKey != "*" {
+		return fmt.Errorf("api_key can't be combined with team, project, or env")
+	}
+	return nil
+}
+
+// LimitsTokens reports whether the policy has a token limit. A policy with
+// only max_cost_usd doesn't; one with neither limit allows no tokens.
+func (p BudgetPolicy) LimitsTokens() bool {
+	return p.MaxTokens > 0 || p.MaxCostUSD <= 0
+}
+
+// Fraction returns usage as a fraction of the policy's limits, the larger
+// of the token and spend fractions.
+func (p BudgetPolicy) Fraction(tokens int64, usd float64) float64 {
+	var f float64
+	if p.MaxTokens > 0 {
+		f = float64(tokens) / float64(p.MaxTokens)
+	}
+	if p.MaxCostUSD > 0 {
+		f = max(f, usd/p.MaxCostUSD)
+	}
+	return f
+}
+
+// FormatAmount formats an amount measured against the policy: tokens,
+// dollars, or both, matching the limits the policy sets.
+func (p BudgetPolicy) FormatAmount(tokens int64, usd float64) string {
+	switch {
+	case p.MaxCostUSD <= 0:
+		return fmt.Sprintf("%d", tokens)
+	case p.MaxTokens <= 0:
+		return fmt.Sprintf("$%.2f", usd)
+	default:
+		return fmt.Sprintf("%d/$%.2f", tokens, usd)
+	}
+}
+
+// FormatLimit formats the policy's limits with FormatAmount.
+func (p BudgetPolicy) FormatLimit() string {
+	return p.FormatAmount(p.MaxTokens, p.MaxCostUSD)
+}
+
+// ManagedBudgetPolicy is a budget policy created at runtime through the
+// admin API and persisted in the tracker database. While active, it
+// replaces any configured policy with the same scope.
+type ManagedBudgetPolicy struct {
+	ID int64 `json:"id"`
+	BudgetPolicy
+	// ExpiresAt ends the policy, e.g. a temporary limit increase, after
+	// which a configured policy it replaced applies again. Zero means never.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Active reports whether the policy is in force at now.
+func (m ManagedBudgetPolicy) Active(now time.Time) bool {
+	return m.ExpiresAt.IsZero() || now.Before(m.ExpiresAt)
+}
+
+// ValidateAt checks a managed policy as config validation checks a
+// configured one, and additionally requires a scope, a period, and an
+// expiry after now.
+func (m ManagedBudgetPolicy) ValidateAt(now time.Time) error {
+	if m.APIKey == "" && !m.LabelScoped() {
+		return fmt.Errorf("api_key, team, project, or env is required")
+	}
+	if m.Period != BudgetDaily && m.Period != BudgetMonthly {
+		return fmt.Errorf("period must be daily or monthly")
+	}
+	if m.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens must not be negative")
+	}
+	if !m.ExpiresAt.IsZero() && !m.ExpiresAt.After(now) {
+		return fmt.Errorf("expires_at must be in the future")
+	}
+	return m.Validate()
+}
+
+// BudgetAdjustment is a manual entry in the budget ledger, e.g. forgiving
+// an accidental burn or granting a one-off top-up. Its amounts are added to
+// the usage counted against policies with the same scope, for the period
+// it was made in: negative amounts are credits, positive ones debits.
+type BudgetAdjustment struct {
+	ID int64 `json:"id"`
+	// APIKey scopes the adjustment to one key's policies, including
+	// wildcard ones. Otherwise Team, Project, and Env scope it to the
+	// label-scoped policy with exactly those labels.
+	APIKey  string `json:"api_key,omitempty"`
+	Team    string `json:"team,omitempty"`
+	Project string `json:"project,omitempty"`
+	Env     string `json:"env,omitempty"`
+	// Model matches the policy's model filter exactly; empty matches
+	// policies for all models.
+	Model     string    `json:"model,omitempty"`
+	Tokens    int64     `json:"tokens"`
+	CostUSD   float64   `json:"cost_usd"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Labels returns the attribution labels the adjustment is scoped to.
+func (a BudgetAdjustment) Labels() CostLabel {
+	return CostLabel{Team: a.Team, Project: a.Project, Env: a.Env}
+}
+
+// BudgetAction is what the enforcer did about a request.
+type BudgetAction string
+
+const (
+	BudgetBlock     BudgetAction = "block"
+	BudgetWarn      BudgetAction = "warn"
+	BudgetDowngrade BudgetAction = "downgrade"
+	// BudgetShed and BudgetQueueFull refuse a request before the budget is
+	// exhausted: a low-priority request shed past a soft limit, or one the
+	// key's full budget queue couldn't take.
+	BudgetShed      BudgetAction = "shed"
+	BudgetQueueFull BudgetAction = "queue_full"
+)
+
+// BudgetActions lists every BudgetAction.
+var BudgetActions = []BudgetAction{BudgetBlock, BudgetWarn, BudgetDowngrade, BudgetShed, BudgetQueueFull}
+
+// Denied reports whether the action refused the request.
+func (a BudgetAction) Denied() bool {
+	return a == BudgetBlock || a == BudgetShed || a == BudgetQueueFull
+}
+
+// BudgetDecision records a budget block, soft-limit warning, downgrade, or
+// other denial:
+// which policy applied to which key, and the usage it saw at the time.
+type BudgetDecision struct {
+	ID        int64        `json:"id"`
+	RequestID string       `json:"request_id,omitempty"`
+	APIKey    string       `json:"api_key"`
+	Model     string       `json:"model"`
+	Action    BudgetAction `json:"action"`
+	Policy    BudgetPolicy `json:"policy"`
+	// Used is the tokens counted against Policy in the period beginning at
+	// PeriodStart when the decision was made.
+	Used int64 `json:"used"`
+	// UsedUSD is the estimated spend counted against a policy with
+	// MaxCostUSD.
+	UsedUSD     float64   `json:"used_usd,omitempty"`
+	PeriodStart time.Time `json:"period_start"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// BudgetDecisionQuery filters stored budget decisions. Zero fields match
+// everything; Limit of zero returns the 100 most recent.
+type BudgetDecisionQuery struct {
+	Since  time.Time
+	APIKey string
+	Action BudgetAction
+	// Denied matches only actions that refused the request.
+	Denied bool
+	Limit  int
 }
 
 // BudgetStatus shows current usage against a policy.
@@ -21,4 +285,38 @@ type BudgetStatus struct {
 	Policy    BudgetPolicy `json:"policy"`
 	Used      int64        `json:"used"`
 	Remaining int64        `json:"remaining"`
+	// UsedUSD and RemainingUSD are set for policies with MaxCostUSD.
+	UsedUSD      float64 `json:"used_usd,omitempty"`
+	RemainingUSD float64 `json:"remaining_usd,omitempty"`
+	// PeriodStart and PeriodEnd bound the current budget period.
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	// Elapsed is the fraction of the period that has passed, from 0 to 1.
+	Elapsed float64 `json:"elapsed"`
+	// ExhaustsAt projects when the budget runs out if usage continues at
+	// the period's average rate so far. It is zero when the budget lasts
+	// the period or is already exhausted.
+	ExhaustsAt time.Time `json:"exhausts_at,omitempty"`
+}
+
+// UsedFraction returns usage as a fraction of the policy limit.
+func (s BudgetStatus) UsedFraction() float64 {
+	return s.Policy.Fraction(s.Used, s.UsedUSD)
+}
+
+// Exhausted reports whether any of the policy's limits is used up.
+func (s BudgetStatus) Exhausted() bool {
+	return (s.Policy.LimitsTokens() && s.Remaining == 0) || (s.Policy.MaxCostUSD > 0 && s.RemainingUSD == 0)
+}
+
+// BudgetSimulation reports how a hypothetical policy would have affected one
+// API key had it been enforced over a window of recorded usage.
+type BudgetSimulation struct {
+	Policy         BudgetPolicy `json:"policy"`
+	APIKey         string       `json:"api_key"`
+	Requests       int64        `json:"requests"`
+	Blocked        int64        `json:"blocked"`
+	BlockedTokens  int64        `json:"blocked_tokens"`
+	PeriodsBlocked int          `json:"periods_blocked"`
+	FirstBlockedAt time.Time    `json:"first_blocked_at,omitempty"`
 }
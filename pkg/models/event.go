@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// RequestEvent summarizes one completed proxy request for live feeds such as
+// pario tail.
+type RequestEvent struct {
+	RequestID        string    `json:"request_id"`
+	Time             time.Time `json:"time"`
+	Path             string    `json:"path"`
+	KeyPrefix        string    `json:"key_prefix"`
+	Model            string    `json:"model"`
+	Provider         string    `json:"provider,omitempty"`
+	Team             string    `json:"team,omitempty"`
+	Project          string    `json:"project,omitempty"`
+	Env              string    `json:"env,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	// CostUSD is estimated from attribution.pricing; zero when the model has
+	// no pricing entry.
+	CostUSD   float64 `json:"cost_usd"`
+	Cached    bool    `json:"cached"`
+	LatencyMs int64   `json:"latency_ms"`
+	Status    int     `json:"status"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+)
+
+// IsModelPattern reports whether model is a pattern rather than a model
+// name: a glob containing * or ?, or a regular expression prefixed with ~.
+func IsModelPattern(model string) bool {
+	return strings.HasPrefix(model, "~") || strings.ContainsAny(model, "*?")
+}
+
+// CompileModelPattern compiles a model pattern. A glob matches whole model
+// names, with * matching any run of characters and ? any one character; a
+// regular expression matches anywhere unless anchored.
+func CompileModelPattern(pattern string) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(pattern, "~"); ok {
+		return regexp.Compile(expr)
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
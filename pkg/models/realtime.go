@@ -0,0 +1,40 @@
+package models
+
+// RealtimeServerEvent is the subset of an OpenAI Realtime API server event
+// that Pario reads for tracking.
+type RealtimeServerEvent struct {
+	Type     string            `json:"type"`
+	Session  *RealtimeSession  `json:"session,omitempty"`
+	Response *RealtimeResponse `json:"response,omitempty"`
+}
+
+// RealtimeSession identifies a Realtime API session.
+type RealtimeSession struct {
+	ID    string `json:"id"`
+	Model string `json:"model"`
+}
+
+// RealtimeResponse is a Realtime API response, carried by response.created
+// and response.done events. Usage is only present on response.done.
+type RealtimeResponse struct {
+	ID     string         `json:"id"`
+	Status string         `json:"status"`
+	Usage  *RealtimeUsage `json:"usage,omitempty"`
+}
+
+// RealtimeUsage holds token counts for one Realtime API response, split
+// between text and audio.
+type RealtimeUsage struct {
+	TotalTokens        int                  `json:"total_tokens"`
+	InputTokens        int                  `json:"input_tokens"`
+	OutputTokens       int                  `json:"output_tokens"`
+	InputTokenDetails  RealtimeTokenDetails `json:"input_token_details"`
+	OutputTokenDetails RealtimeTokenDetails `json:"output_token_details"`
+}
+
+// RealtimeTokenDetails breaks a token count down by modality.
+type RealtimeTokenDetails struct {
+	TextTokens   int `json:"text_tokens"`
+	AudioTokens  int `json:"audio_tokens"`
+	CachedTokens int `json:"cached_tokens,omitempty"`
+}
@@ -1,20 +1,82 @@
 package models
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+)
 
 // ChatMessage represents a single message in a chat conversation.
 type ChatMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Parts holds array content (text, image, and audio parts) verbatim.
+	// Content is empty when Parts is set.
+	Parts      json.RawMessage `json:"-"`
+	Name       string          `json:"name,omitempty"`
+	ToolCalls  json.RawMessage `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+// UnmarshalJSON accepts content as a string, an array of parts, or null.
+func (m *ChatMessage) UnmarshalJSON(b []byte) error {
+	type plain ChatMessage
+	var v struct {
+		plain
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*m = ChatMessage(v.plain)
+	switch c := bytes.TrimSpace(v.Content); {
+	case len(c) == 0 || string(c) == "null":
+	case c[0] == '"':
+		return json.Unmarshal(c, &m.Content)
+	default:
+		m.Parts = c
+	}
+	return nil
+}
+
+// MarshalJSON writes Parts as the content when set.
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	type plain ChatMessage
+	if m.Parts == nil {
+		return json.Marshal(plain(m))
+	}
+	return json.Marshal(struct {
+		plain
+		Content json.RawMessage `json:"content"`
+	}{plain(m), m.Parts})
 }
 
 // ChatCompletionRequest is an OpenAI-compatible chat completion request.
+// The proxy forwards request bodies as received, rewriting only targeted
+// fields, so fields not modeled here still reach the provider.
 type ChatCompletionRequest struct {
 	Model       string        `json:"model"`
 	Messages    []ChatMessage `json:"messages"`
 	Temperature *float64      `json:"temperature,omitempty"`
+	TopP        *float64      `json:"top_p,omitempty"`
+	N           *int          `json:"n,omitempty"`
 	MaxTokens   *int          `json:"max_tokens,omitempty"`
 	Stream      bool          `json:"stream,omitempty"`
+
+	// Options that change what the response contains. They are kept
+	// verbatim and distinguish otherwise identical requests in the cache.
+	Tools          json.RawMessage `json:"tools,omitempty"`
+	ToolChoice     json.RawMessage `json:"tool_choice,omitempty"`
+	Functions      json.RawMessage `json:"functions,omitempty"`
+	FunctionCall   json.RawMessage `json:"function_call,omitempty"`
+	ResponseFormat json.RawMessage `json:"response_format,omitempty"`
+	Seed           *int64          `json:"seed,omitempty"`
+	Logprobs       bool            `json:"logprobs,omitempty"`
+	TopLogprobs    *int            `json:"top_logprobs,omitempty"`
+
+	// System is the top-level system prompt of an Anthropic Messages
+	// request cached as a chat completion. OpenAI requests carry theirs in
+	// Messages, so it never appears in JSON.
+	System json.RawMessage `json:"-"`
 }
 
 // ChatCompletionResponse is an OpenAI-compatible chat completion response.
@@ -34,13 +96,72 @@ type Choice struct {
 	FinishReason string      `json:"finish_reason"`
 }
 
+// EmbeddingRequest is the part of an OpenAI /v1/embeddings request Pario
+// reads; the rest is forwarded unchanged.
+type EmbeddingRequest struct {
+	Model string `json:"model"`
+}
+
+// EmbeddingResponse is the part of an OpenAI /v1/embeddings response Pario
+// reads. Embeddings only consume prompt tokens.
+type EmbeddingResponse struct {
+	Model string `json:"model"`
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// ImageRequest is the part of an OpenAI /v1/images/generations request
+// Pario reads.
+type ImageRequest struct {
+	Model   string `json:"model"`
+	N       int    `json:"n,omitempty"`
+	Size    string `json:"size,omitempty"`
+	Quality string `json:"quality,omitempty"`
+}
+
+// ImageResponse is the part of an OpenAI image generation response Pario
+// reads. Token-billed image models such as gpt-image-1 also report usage.
+type ImageResponse struct {
+	Data  []json.RawMessage `json:"data"`
+	Usage *struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage,omitempty"`
+}
+
+// SpeechRequest is the part of an OpenAI /v1/audio/speech request Pario
+// reads.
+type SpeechRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+// TranscriptionResponse is the part of an OpenAI transcription or
+// translation response Pario reads. Duration comes with verbose_json;
+// Usage reports either seconds of audio ("duration") or tokens ("tokens").
+type TranscriptionResponse struct {
+	Duration float64 `json:"duration,omitempty"`
+	Usage    *struct {
+		Type         string  `json:"type"`
+		Seconds      float64 `json:"seconds,omitempty"`
+		InputTokens  int     `json:"input_tokens,omitempty"`
+		OutputTokens int     `json:"output_tokens,omitempty"`
+		TotalTokens  int     `json:"total_tokens,omitempty"`
+	} `json:"usage,omitempty"`
+}
+
 // AnthropicRequest is an Anthropic /v1/messages request.
 type AnthropicRequest struct {
-	Model     string        `json:"model"`
-	Messages  []ChatMessage `json:"messages"`
-	System    string        `json:"system,omitempty"`
-	MaxTokens int           `json:"max_tokens"`
-	Stream    bool          `json:"stream,omitempty"`
+	Model    string        `json:"model"`
+	Messages []ChatMessage `json:"messages"`
+	// System is a string or an array of text blocks.
+	System      json.RawMessage `json:"system,omitempty"`
+	MaxTokens   int             `json:"max_tokens"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	TopP        *float64        `json:"top_p,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+	Tools       json.RawMessage `json:"tools,omitempty"`
+	ToolChoice  json.RawMessage `json:"tool_choice,omitempty"`
 }
 
 // AnthropicContent represents a content block in an Anthropic response.
@@ -49,10 +170,13 @@ type AnthropicContent struct {
 	Text string `json:"text,omitempty"`
 }
 
-// AnthropicUsage holds token counts from an Anthropic response.
+// AnthropicUsage holds token counts from an Anthropic response. Input
+// tokens exclude those read from or written to the prompt cache.
 type AnthropicUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
 }
 
 // AnthropicResponse is an Anthropic /v1/messages response.
@@ -89,11 +213,20 @@ type AnthropicStreamEvent struct {
 	Usage   *AnthropicUsage  `json:"usage,omitempty"`
 }
 
-// ToUsage converts AnthropicUsage to the standard Usage type.
+// ToUsage converts AnthropicUsage to the standard Usage type. As with
+// OpenAI, prompt tokens include the cached ones.
 func (u *AnthropicUsage) ToUsage() *Usage {
-	return &Usage{
-		PromptTokens:     u.InputTokens,
+	prompt := u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens
+	usage := &Usage{
+		PromptTokens:     prompt,
 		CompletionTokens: u.OutputTokens,
-		TotalTokens:      u.InputTokens + u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+	}
+	if u.CacheReadInputTokens+u.CacheCreationInputTokens > 0 {
+		usage.PromptTokensDetails = &PromptTokensDetails{
+			CachedTokens:        u.CacheReadInputTokens,
+			CacheCreationTokens: u.CacheCreationInputTokens,
+		}
 	}
+	return usage
 }
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Dimensions a top-N query ranks by.
+const (
+	TopByKey     = "api_key"
+	TopBySession = "session"
+	TopByModel   = "model"
+	TopByTeam    = "team"
+)
+
+// Orders of a top-N query.
+const (
+	TopOrderTokens = "tokens"
+	TopOrderCost   = "cost"
+)
+
+// DefaultTopLimit is how many entries a top-N query returns when its
+// Limit is unset.
+const DefaultTopLimit = 10
+
+// TopQuery asks for the API keys, sessions, models, or teams with the most
+// usage since a given time.
+type TopQuery struct {
+	// By is one of the TopBy dimensions.
+	By    string    `json:"by"`
+	Since time.Time `json:"since"`
+	// OrderBy ranks by total tokens (the default) or estimated cost.
+	OrderBy string `json:"order_by,omitempty"`
+	Limit   int    `json:"limit,omitempty"`
+}
+
+// Validate rejects a query with an unknown dimension or order.
+func (q TopQuery) Validate() error {
+	switch q.By {
+	case TopByKey, TopBySession, TopByModel, TopByTeam:
+	default:
+		return fmt.Errorf("unknown top dimension %q (want api_key, session, model, or team)", q.By)
+	}
+	if q.OrderBy != "" && q.OrderBy != TopOrderTokens && q.OrderBy != TopOrderCost {
+		return fmt.Errorf("unknown top order %q (want tokens or cost)", q.OrderBy)
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("top limit must not be negative")
+	}
+	return nil
+}
+
+// TopEntry is one ranked value of a top-N query, with its usage summed
+// across models.
+type TopEntry struct {
+	Value            string  `json:"value"`
+	RequestCount     int     `json:"request_count"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	EstimatedCost    float64 `json:"estimated_cost"`
+}
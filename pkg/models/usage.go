@@ -1,37 +1,191 @@
 package models
 
-import "time"
+import (
+	"slices"
+	"strings"
+	"time"
+)
 
 // Usage represents token usage from an LLM response.
 type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens            int                      `json:"prompt_tokens"`
+	CompletionTokens        int                      `json:"completion_tokens"`
+	TotalTokens             int                      `json:"total_tokens"`
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+}
+
+// PromptTokensDetails breaks down prompt tokens. CachedTokens were read
+// from the provider's prompt cache. CacheCreationTokens were written to
+// it; OpenAI doesn't report them, they come from Anthropic responses.
+type PromptTokensDetails struct {
+	CachedTokens        int `json:"cached_tokens"`
+	CacheCreationTokens int `json:"cache_creation_tokens,omitempty"`
+}
+
+// CompletionTokensDetails breaks down completion tokens. ReasoningTokens
+// were spent on reasoning the response doesn't include.
+type CompletionTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// CacheReadTokens returns the prompt tokens read from the prompt cache.
+func (u *Usage) CacheReadTokens() int {
+	if u == nil || u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.CachedTokens
+}
+
+// CacheCreationTokens returns the prompt tokens written to the prompt
+// cache.
+func (u *Usage) CacheCreationTokens() int {
+	if u == nil || u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.CacheCreationTokens
+}
+
+// ReasoningTokens returns the completion tokens spent on reasoning.
+func (u *Usage) ReasoningTokens() int {
+	if u == nil || u.CompletionTokensDetails == nil {
+		return 0
+	}
+	return u.CompletionTokensDetails.ReasoningTokens
 }
 
 // UsageRecord tracks per-request token usage.
 type UsageRecord struct {
-	ID               int64     `json:"id"`
-	APIKey           string    `json:"api_key"`
-	Model            string    `json:"model"`
-	SessionID        string    `json:"session_id,omitempty"`
-	PromptTokens     int       `json:"prompt_tokens"`
-	CompletionTokens int       `json:"completion_tokens"`
-	TotalTokens      int       `json:"total_tokens"`
-	Team             string    `json:"team,omitempty"`
-	Project          string    `json:"project,omitempty"`
-	Env              string    `json:"env,omitempty"`
-	CreatedAt        time.Time `json:"created_at"`
+	ID int64 `json:"id"`
+	// RequestID and Attempt identify the upstream attempt that produced the
+	// usage. Together they form an idempotency key: a second record for the
+	// same attempt is ignored.
+	RequestID        string `json:"request_id,omitempty"`
+	Attempt          int    `json:"attempt,omitempty"`
+	APIKey           string `json:"api_key"`
+	Model            string `json:"model"`
+	SessionID        string `json:"session_id,omitempty"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	TotalTokens      int    `json:"total_tokens"`
+	Team             string `json:"team,omitempty"`
+	Project          string `json:"project,omitempty"`
+	Env              string `json:"env,omitempty"`
+	Streamed         bool   `json:"streamed"`
+	Provider         string `json:"provider,omitempty"`
+	// RouteAlias is the client-facing model of the route that served the
+	// request, empty when no configured route matched. With fallbacks,
+	// Model and Provider are what actually served it.
+	RouteAlias string `json:"route_alias,omitempty"`
+	// LatencyMs is the wall time of the upstream call, including the full
+	// stream for streamed responses. UpstreamStatus is the HTTP status the
+	// provider answered with; zero on records from before it was stored.
+	LatencyMs          int64   `json:"latency_ms,omitempty"`
+	UpstreamStatus     int     `json:"upstream_status,omitempty"`
+	OutputTokensPerSec float64 `json:"output_tokens_per_sec,omitempty"`
+	// Labels holds free-form attribution labels from the X-Pario-Labels header.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Metadata holds the values of the request headers named in
+	// attribution.metadata_headers, keyed by their configured names.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// InputAudioTokens and OutputAudioTokens are the audio share of
+	// PromptTokens and CompletionTokens, reported by the Realtime API.
+	InputAudioTokens  int `json:"input_audio_tokens,omitempty"`
+	OutputAudioTokens int `json:"output_audio_tokens,omitempty"`
+	// CacheReadTokens and CacheCreationTokens are the share of
+	// PromptTokens read from and written to the provider's prompt cache,
+	// and ReasoningTokens the share of CompletionTokens spent on
+	// reasoning. Each can be priced separately.
+	CacheReadTokens     int `json:"cache_read_tokens,omitempty"`
+	CacheCreationTokens int `json:"cache_creation_tokens,omitempty"`
+	ReasoningTokens     int `json:"reasoning_tokens,omitempty"`
+	// RetryReason is set on records for attempts the proxy made on its own
+	// after an earlier attempt succeeded but was rejected, e.g. "schema"
+	// for a structured output that failed validation.
+	RetryReason string `json:"retry_reason,omitempty"`
+	// Pipeline, Branch, and Commit attribute usage to a CI job or developer
+	// build, from the X-Pario-Pipeline, X-Pario-Branch, and X-Pario-Commit
+	// headers.
+	Pipeline string `json:"pipeline,omitempty"`
+	Branch   string `json:"branch,omitempty"`
+	Commit   string `json:"commit,omitempty"`
+	// Endpoint is the API the usage came from: "chat", "messages",
+	// "embeddings", "images", "transcriptions", "translations", "speech",
+	// "realtime", "assistants", "batch", or one of the metered passthrough
+	// endpoints: "completions", "responses", "moderations", "fine_tuning".
+	// Empty on older records.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Images is the number of images generated, AudioSeconds the duration
+	// of transcribed audio, and Characters the length of text-to-speech
+	// input. MediaCostUSD is the cost of usage priced per unit rather than
+	// per token, such as these; it is part of EstimatedCostUSD.
+	Images       int     `json:"images,omitempty"`
+	AudioSeconds float64 `json:"audio_seconds,omitempty"`
+	Characters   int     `json:"characters,omitempty"`
+	MediaCostUSD float64 `json:"media_cost_usd,omitempty"`
+	// Partial marks a stream that ended early, e.g. because the client
+	// disconnected. Its token counts are what the provider reported before
+	// then, with unreported ones estimated from the request and the
+	// content relayed.
+	Partial bool `json:"partial,omitempty"`
+	// EstimatedCostUSD is the record's token and media cost at the pricing
+	// in effect when it was recorded. Reports and spend budgets sum it, so
+	// later price changes don't rewrite past cost.
+	EstimatedCostUSD float64 `json:"estimated_cost_usd,omitempty"`
+	// Imported marks records backfilled from a provider usage export rather
+	// than observed by the proxy. Each one aggregates a time bucket.
+	Imported  bool      `json:"imported,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // Session groups related requests into a conversation.
 type Session struct {
-	ID            string    `json:"id"`
-	APIKey        string    `json:"api_key"`
-	StartedAt     time.Time `json:"started_at"`
-	LastActivity  time.Time `json:"last_activity"`
-	RequestCount  int       `json:"request_count"`
-	TotalTokens   int       `json:"total_tokens"`
+	ID           string    `json:"id"`
+	APIKey       string    `json:"api_key"`
+	StartedAt    time.Time `json:"started_at"`
+	LastActivity time.Time `json:"last_activity"`
+	RequestCount int       `json:"request_count"`
+	TotalTokens  int       `json:"total_tokens"`
+	// EndedAt is set once the session was closed for inactivity.
+	EndedAt time.Time `json:"ended_at,omitzero"`
+	// Name and Tags are set by clients to tell sessions apart.
+	Name string            `json:"name,omitempty"`
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// FormatTags returns the session's tags as "k=v,k2=v2", sorted by key, the
+// form X-Pario-Session-Tags takes.
+func (s Session) FormatTags() string {
+	pairs := make([]string, 0, len(s.Tags))
+	for k, v := range s.Tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// SessionQuery selects sessions. Empty fields match every session; Name
+// matches sessions whose name contains it, and every tag must match.
+type SessionQuery struct {
+	APIKey string            `json:"api_key,omitempty"`
+	Name   string            `json:"name,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+}
+
+// Match reports whether s is selected by q.
+func (q SessionQuery) Match(s Session) bool {
+	if q.APIKey != "" && s.APIKey != q.APIKey {
+		return false
+	}
+	if q.Name != "" && !strings.Contains(s.Name, q.Name) {
+		return false
+	}
+	for k, v := range q.Tags {
+		if s.Tags[k] != v {
+			return false
+		}
+	}
+	return true
 }
 
 // SessionRequest represents a single request within a session, with context growth info.
@@ -46,10 +200,128 @@ type SessionRequest struct {
 
 // UsageSummary aggregates usage across requests.
 type UsageSummary struct {
-	APIKey           string `json:"api_key"`
-	Model            string `json:"model"`
-	RequestCount     int    `json:"request_count"`
-	TotalPrompt      int    `json:"total_prompt"`
-	TotalCompletion  int    `json:"total_completion"`
-	TotalTokens      int    `json:"total_tokens"`
+	APIKey string `json:"api_key"`
+	Model  string `json:"model"`
+	// Provider and RouteAlias split a model's usage by the vendor that
+	// served it and the route it was requested through.
+	Provider        string `json:"provider,omitempty"`
+	RouteAlias      string `json:"route_alias,omitempty"`
+	RequestCount    int    `json:"request_count"`
+	TotalPrompt     int    `json:"total_prompt"`
+	TotalCompletion int    `json:"total_completion"`
+	TotalTokens     int    `json:"total_tokens"`
+	// StreamedRequests and StreamedTokens count the SSE-streamed subset.
+	// Streamed responses bypass the prompt cache, so the remainder is the
+	// cacheable share of traffic.
+	StreamedRequests int `json:"streamed_requests"`
+	StreamedTokens   int `json:"streamed_tokens"`
+	// PartialRequests counts streams that ended early, such as aborted
+	// agent runs; their tokens are partly estimated.
+	PartialRequests int `json:"partial_requests"`
+}
+
+// ThroughputStat summarizes the output tokens/sec distribution for a model
+// served by a provider.
+type ThroughputStat struct {
+	Model    string  `json:"model"`
+	Provider string  `json:"provider"`
+	Requests int     `json:"requests"`
+	Mean     float64 `json:"mean"`
+	P50      float64 `json:"p50"`
+	P90      float64 `json:"p90"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+}
+
+// LatencyStat summarizes the upstream latency distribution, in
+// milliseconds, for a model served by a provider.
+type LatencyStat struct {
+	Model    string  `json:"model"`
+	Provider string  `json:"provider"`
+	Requests int     `json:"requests"`
+	MeanMs   float64 `json:"mean_ms"`
+	P50Ms    float64 `json:"p50_ms"`
+	P95Ms    float64 `json:"p95_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+	MaxMs    float64 `json:"max_ms"`
+}
+
+// UpstreamFailure is an upstream attempt that failed to connect or
+// returned a status that moves a request on to its next route, after the
+// route's own retries. It is recorded whether or not a later route then
+// served the request.
+type UpstreamFailure struct {
+	ID        int64  `json:"id"`
+	RequestID string `json:"request_id,omitempty"`
+	APIKey    string `json:"api_key"`
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	// Attempt is the 1-based index of the route among those tried.
+	Attempt int `json:"attempt"`
+	// StatusCode is the upstream status, or zero when there was no
+	// response; Error then says why.
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	LatencyMs  int64     `json:"latency_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ProviderReliability summarizes how often a provider's upstream attempts
+// failed and how often fallback routes covered for it or for others.
+type ProviderReliability struct {
+	Provider string `json:"provider"`
+	// Served counts the requests the provider answered and Failures its
+	// failed attempts.
+	Served   int `json:"served"`
+	Failures int `json:"failures"`
+	// ErrorRate is Failures over all attempts, Served plus Failures.
+	ErrorRate float64 `json:"error_rate"`
+	// Recovered counts failures whose request a later route then served.
+	Recovered int `json:"recovered"`
+	// Fallbacks counts the requests the provider served after an earlier
+	// route failed.
+	Fallbacks int `json:"fallbacks"`
+}
+
+// UsageRollup aggregates the usage records of one hourly or daily bucket
+// with the same key, model, provider, attribution labels, and endpoint.
+// Rollups outlive the records they summarize.
+type UsageRollup struct {
+	Period           string    `json:"period"`
+	Bucket           time.Time `json:"bucket"`
+	APIKey           string    `json:"api_key"`
+	Model            string    `json:"model"`
+	Provider         string    `json:"provider,omitempty"`
+	Team             string    `json:"team,omitempty"`
+	Project          string    `json:"project,omitempty"`
+	Env              string    `json:"env,omitempty"`
+	Endpoint         string    `json:"endpoint,omitempty"`
+	RequestCount     int       `json:"request_count"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	TotalTokens      int64     `json:"total_tokens"`
+	MediaCostUSD     float64   `json:"media_cost_usd,omitempty"`
+	EstimatedCostUSD float64   `json:"estimated_cost_usd,omitempty"`
+}
+
+// Cost returns the record's media cost plus the cost of its tokens at
+// pricing, keyed by model. Unpriced models cost only their media.
+func (r UsageRecord) Cost(pricing map[string]ModelPricing) float64 {
+	cost := r.MediaCostUSD
+	if p, ok := pricing[r.Model]; ok {
+		cost += p.TokenCost(r.Tokens())
+	}
+	return cost
+}
+
+// Tokens returns the record's token counts for pricing.
+func (r UsageRecord) Tokens() TokenCounts {
+	return TokenCounts{
+		Prompt:        int64(r.PromptTokens),
+		Completion:    int64(r.CompletionTokens),
+		CacheRead:     int64(r.CacheReadTokens),
+		CacheCreation: int64(r.CacheCreationTokens),
+		Reasoning:     int64(r.ReasoningTokens),
+	}
 }
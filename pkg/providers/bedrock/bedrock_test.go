@@ -0,0 +1,137 @@
+package bedrock
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pario-ai/pario/pkg/sigv4"
+)
+
+func TestTranslateRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		version string
+	}{
+		{"default version", `{"model":"claude","stream":true,"max_tokens":10,"messages":[]}`, AnthropicVersion},
+		{"client version", `{"model":"claude","anthropic_version":"custom","messages":[]}`, "custom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := TranslateRequest([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := got["model"]; ok {
+				t.Error("model was not removed")
+			}
+			if _, ok := got["stream"]; ok {
+				t.Error("stream was not removed")
+			}
+			if got["anthropic_version"] != tt.version {
+				t.Errorf("anthropic_version = %v, want %q", got["anthropic_version"], tt.version)
+			}
+		})
+	}
+
+	if _, err := TranslateRequest([]byte(`not json`)); err == nil {
+		t.Error("expected error for invalid body")
+	}
+}
+
+func TestNewRequest(t *testing.T) {
+	creds := sigv4.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	tests := []struct {
+		stream bool
+		path   string
+		accept string
+	}{
+		{false, "/model/anthropic.claude-3-haiku-20240307-v1%3A0/invoke", "application/json"},
+		{true, "/model/anthropic.claude-3-haiku-20240307-v1%3A0/invoke-with-response-stream", "application/vnd.amazon.eventstream"},
+	}
+	for _, tt := range tests {
+		req, err := NewRequest(context.Background(), Endpoint("us-west-2"), "us-west-2",
+			"anthropic.claude-3-haiku-20240307-v1:0", []byte(`{}`), tt.stream, creds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.URL.Host != "bedrock-runtime.us-west-2.amazonaws.com" {
+			t.Errorf("host = %q", req.URL.Host)
+		}
+		if got := req.URL.EscapedPath(); got != tt.path {
+			t.Errorf("path = %q, want %q", got, tt.path)
+		}
+		if got := req.Header.Get("Accept"); got != tt.accept {
+			t.Errorf("Accept = %q, want %q", got, tt.accept)
+		}
+		if auth := req.Header.Get("Authorization"); !strings.Contains(auth, "/us-west-2/bedrock/aws4_request") {
+			t.Errorf("Authorization = %q", auth)
+		}
+	}
+}
+
+// encodeMessage builds one event-stream message with string headers.
+func encodeMessage(headers map[string]string, payload []byte) []byte {
+	var hb bytes.Buffer
+	for k, v := range headers {
+		hb.WriteByte(byte(len(k)))
+		hb.WriteString(k)
+		hb.WriteByte(7)
+		binary.Write(&hb, binary.BigEndian, uint16(len(v)))
+		hb.WriteString(v)
+	}
+	total := 12 + hb.Len() + len(payload) + 4
+	var msg bytes.Buffer
+	binary.Write(&msg, binary.BigEndian, uint32(total))
+	binary.Write(&msg, binary.BigEndian, uint32(hb.Len()))
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	msg.Write(hb.Bytes())
+	msg.Write(payload)
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	return msg.Bytes()
+}
+
+func chunk(event string) []byte {
+	payload, _ := json.Marshal(map[string]string{"bytes": base64.StdEncoding.EncodeToString([]byte(event))})
+	return encodeMessage(map[string]string{":message-type": "event", ":event-type": "chunk"}, payload)
+}
+
+func TestSSEReader(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(chunk(`{"type":"message_start","message":{"usage":{"input_tokens":12}}}`))
+	stream.Write(chunk(`{"type":"message_delta","usage":{"output_tokens":3}}`))
+	stream.Write(encodeMessage(map[string]string{":message-type": "exception", ":exception-type": "throttlingException"},
+		[]byte(`{"message":"slow down"}`)))
+
+	out, err := io.ReadAll(NewSSEReader(io.NopCloser(&stream)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":12}}}\n\n" +
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":3}}\n\n" +
+		"event: error\ndata: {\"error\":{\"message\":\"slow down\",\"type\":\"throttlingException\"},\"type\":\"error\"}\n\n"
+	if string(out) != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestSSEReaderChecksum(t *testing.T) {
+	msg := chunk(`{"type":"ping"}`)
+	msg[len(msg)-1] ^= 0xff
+
+	_, err := io.ReadAll(NewSSEReader(io.NopCloser(bytes.NewReader(msg))))
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("err = %v, want checksum mismatch", err)
+	}
+}
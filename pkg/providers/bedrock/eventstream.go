@@ -0,0 +1,182 @@
+package bedrock
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// maxMessageSize bounds a single event-stream message.
+const maxMessageSize = 16 << 20
+
+// message is one decoded event-stream message.
+type message struct {
+	headers map[string]string
+	payload []byte
+}
+
+// readMessage decodes the next message of an AWS event stream:
+//
+//	total length (4) | headers length (4) | prelude CRC (4) |
+//	headers | payload | message CRC (4)
+//
+// Only string header values are kept; other types are skipped.
+func readMessage(r io.Reader) (message, error) {
+	var prelude [12]byte
+	if _, err := io.ReadFull(r, prelude[:]); err != nil {
+		return message{}, err
+	}
+	total := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return message{}, errors.New("event stream: prelude checksum mismatch")
+	}
+	if total < 16 || total > maxMessageSize || headersLen > total-16 {
+		return message{}, fmt.Errorf("event stream: invalid message length %d", total)
+	}
+
+	rest := make([]byte, total-12)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return message{}, fmt.Errorf("event stream: %w", io.ErrUnexpectedEOF)
+	}
+	body, sum := rest[:len(rest)-4], binary.BigEndian.Uint32(rest[len(rest)-4:])
+	crc := crc32.NewIEEE()
+	crc.Write(prelude[:])
+	crc.Write(body)
+	if crc.Sum32() != sum {
+		return message{}, errors.New("event stream: message checksum mismatch")
+	}
+
+	headers, err := parseHeaders(body[:headersLen])
+	if err != nil {
+		return message{}, err
+	}
+	return message{headers: headers, payload: body[headersLen:]}, nil
+}
+
+// headerValueSizes gives the size of fixed-width header value types.
+var headerValueSizes = map[byte]int{0: 0, 1: 0, 2: 1, 3: 2, 4: 4, 5: 8, 8: 8, 9: 16}
+
+func parseHeaders(b []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	for len(b) > 0 {
+		n := int(b[0])
+		if len(b) < 1+n+1 {
+			return nil, errors.New("event stream: truncated header")
+		}
+		name := string(b[1 : 1+n])
+		typ := b[1+n]
+		b = b[2+n:]
+		switch typ {
+		case 6, 7: // byte array, string
+			if len(b) < 2 {
+				return nil, errors.New("event stream: truncated header")
+			}
+			l := int(binary.BigEndian.Uint16(b))
+			if len(b) < 2+l {
+				return nil, errors.New("event stream: truncated header")
+			}
+			if typ == 7 {
+				headers[name] = string(b[2 : 2+l])
+			}
+			b = b[2+l:]
+		default:
+			size, ok := headerValueSizes[typ]
+			if !ok || len(b) < size {
+				return nil, fmt.Errorf("event stream: bad header type %d", typ)
+			}
+			b = b[size:]
+		}
+	}
+	return headers, nil
+}
+
+// sseReader converts a Bedrock response event stream into Anthropic SSE.
+type sseReader struct {
+	src io.ReadCloser
+	buf bytes.Buffer
+	err error
+}
+
+// NewSSEReader wraps the body of an invoke-with-response-stream response so
+// it reads as the text/event-stream the Anthropic API would have sent. Each
+// chunk's decoded bytes become one event named after its "type"; Bedrock
+// exceptions become Anthropic error events.
+func NewSSEReader(body io.ReadCloser) io.ReadCloser {
+	return &sseReader{src: body}
+}
+
+func (s *sseReader) Read(p []byte) (int, error) {
+	for s.buf.Len() == 0 && s.err == nil {
+		s.err = s.next()
+	}
+	if s.buf.Len() > 0 {
+		return s.buf.Read(p)
+	}
+	return 0, s.err
+}
+
+func (s *sseReader) Close() error {
+	return s.src.Close()
+}
+
+// next decodes one message into buf.
+func (s *sseReader) next() error {
+	msg, err := readMessage(s.src)
+	if err != nil {
+		return err
+	}
+	switch msg.headers[":message-type"] {
+	case "event":
+		if msg.headers[":event-type"] != "chunk" {
+			return nil
+		}
+		var chunk struct {
+			Bytes string `json:"bytes"`
+		}
+		if err := json.Unmarshal(msg.payload, &chunk); err != nil {
+			return fmt.Errorf("event stream: decode chunk: %w", err)
+		}
+		data, err := base64.StdEncoding.DecodeString(chunk.Bytes)
+		if err != nil {
+			return fmt.Errorf("event stream: decode chunk: %w", err)
+		}
+		var evt struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal(data, &evt)
+		s.writeEvent(evt.Type, data)
+	case "exception", "error":
+		kind := msg.headers[":exception-type"]
+		if kind == "" {
+			kind = msg.headers[":error-code"]
+		}
+		var body struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(msg.payload, &body)
+		if body.Message == "" {
+			body.Message = msg.headers[":error-message"]
+		}
+		data, _ := json.Marshal(map[string]any{
+			"type":  "error",
+			"error": map[string]string{"type": kind, "message": body.Message},
+		})
+		s.writeEvent("error", data)
+	}
+	return nil
+}
+
+func (s *sseReader) writeEvent(name string, data []byte) {
+	if name != "" {
+		fmt.Fprintf(&s.buf, "event: %s\n", name)
+	}
+	s.buf.WriteString("data: ")
+	s.buf.Write(data)
+	s.buf.WriteString("\n\n")
+}
@@ -0,0 +1,267 @@
+package vertex
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope is the OAuth scope requested for Vertex AI calls.
+const Scope = "https://www.googleapis.com/auth/cloud-platform"
+
+const (
+	defaultTokenURL = "https://oauth2.googleapis.com/token"
+	metadataHost    = "metadata.google.internal"
+	// refreshEarly renews a token this long before it expires.
+	refreshEarly = time.Minute
+)
+
+// TokenSource returns OAuth access tokens from Application Default
+// Credentials, caching each token until shortly before it expires. It is
+// safe for concurrent use.
+type TokenSource struct {
+	mu     sync.Mutex
+	fetch  func(ctx context.Context) (token string, ttl time.Duration, err error)
+	token  string
+	expiry time.Time
+}
+
+// DefaultTokenSource returns a TokenSource that locates Application Default
+// Credentials on first use, in the usual order: the file named by
+// GOOGLE_APPLICATION_CREDENTIALS, gcloud's application default credentials
+// file, then the GCE/GKE metadata server.
+func DefaultTokenSource() *TokenSource {
+	ts := &TokenSource{}
+	var (
+		once  sync.Once
+		fetch func(context.Context) (string, time.Duration, error)
+		err   error
+	)
+	ts.fetch = func(ctx context.Context) (string, time.Duration, error) {
+		once.Do(func() { fetch, err = findDefault() })
+		if err != nil {
+			return "", 0, err
+		}
+		return fetch(ctx)
+	}
+	return ts
+}
+
+// CredentialsFile returns a TokenSource for a service account or authorized
+// user credentials file, as written by gcloud or the Cloud console.
+func CredentialsFile(path string) (*TokenSource, error) {
+	fetch, err := fromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenSource{fetch: fetch}, nil
+}
+
+// Token returns a valid access token, fetching a new one when needed.
+func (ts *TokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.token != "" && time.Now().Before(ts.expiry) {
+		return ts.token, nil
+	}
+	tok, ttl, err := ts.fetch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("vertex credentials: %w", err)
+	}
+	ts.token = tok
+	ts.expiry = time.Now().Add(ttl - refreshEarly)
+	return tok, nil
+}
+
+func findDefault() (func(context.Context) (string, time.Duration, error), error) {
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		return fromFile(path)
+	}
+	if path := wellKnownFile(); path != "" {
+		if _, err := os.Stat(path); err == nil {
+			return fromFile(path)
+		}
+	}
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = metadataHost
+	}
+	return func(ctx context.Context) (string, time.Duration, error) {
+		return metadataToken(ctx, host)
+	}, nil
+}
+
+// wellKnownFile returns where gcloud stores application default credentials.
+func wellKnownFile() string {
+	if dir := os.Getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return filepath.Join(dir, "application_default_credentials.json")
+	}
+	if dir := os.Getenv("APPDATA"); dir != "" {
+		return filepath.Join(dir, "gcloud", "application_default_credentials.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+}
+
+// credentialsFile is the subset of a Google credentials file Pario reads.
+type credentialsFile struct {
+	Type string `json:"type"`
+
+	// service_account
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+
+	// authorized_user
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func fromFile(path string) (func(context.Context) (string, time.Duration, error), error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read credentials: %w", err)
+	}
+	var f credentialsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse credentials %s: %w", path, err)
+	}
+	tokenURL := f.TokenURI
+	if tokenURL == "" {
+		tokenURL = defaultTokenURL
+	}
+
+	switch f.Type {
+	case "service_account":
+		key, err := parseKey(f.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("credentials %s: %w", path, err)
+		}
+		return func(ctx context.Context) (string, time.Duration, error) {
+			assertion, err := signJWT(key, f.PrivateKeyID, f.ClientEmail, tokenURL, time.Now())
+			if err != nil {
+				return "", 0, err
+			}
+			return exchange(ctx, tokenURL, url.Values{
+				"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+				"assertion":  {assertion},
+			})
+		}, nil
+	case "authorized_user":
+		return func(ctx context.Context) (string, time.Duration, error) {
+			return exchange(ctx, tokenURL, url.Values{
+				"grant_type":    {"refresh_token"},
+				"client_id":     {f.ClientID},
+				"client_secret": {f.ClientSecret},
+				"refresh_token": {f.RefreshToken},
+			})
+		}, nil
+	default:
+		return nil, fmt.Errorf("credentials %s: unsupported type %q", path, f.Type)
+	}
+}
+
+func parseKey(pemKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, errors.New("private_key is not PEM encoded")
+	}
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rk, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("private_key is not an RSA key")
+		}
+		return rk, nil
+	}
+	k, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse private_key: %w", err)
+	}
+	return k, nil
+}
+
+// signJWT builds the RS256-signed assertion for the JWT bearer grant.
+func signJWT(key *rsa.PrivateKey, keyID, email, aud string, now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   email,
+		"scope": Scope,
+		"aud":   aud,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("sign assertion: %w", err)
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// tokenResponse is an OAuth token endpoint or metadata server response.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func exchange(ctx context.Context, tokenURL string, form url.Values) (string, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doToken(req)
+}
+
+func metadataToken(ctx context.Context, host string) (string, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return doToken(req)
+}
+
+func doToken(req *http.Request) (string, time.Duration, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("fetch token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", 0, fmt.Errorf("read token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("fetch token: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var tr tokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil || tr.AccessToken == "" {
+		return "", 0, fmt.Errorf("fetch token: invalid response")
+	}
+	return tr.AccessToken, time.Duration(tr.ExpiresIn) * time.Second, nil
+}
@@ -0,0 +1,157 @@
+package vertex
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeCredentials(t *testing.T, v map[string]string) string {
+	t.Helper()
+	data, _ := json.Marshal(v)
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestServiceAccountToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.PostForm.Get("grant_type"); got != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("grant_type = %q", got)
+		}
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		if len(parts) != 3 {
+			t.Fatalf("assertion has %d parts", len(parts))
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+			t.Errorf("signature: %v", err)
+		}
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var c map[string]any
+		json.Unmarshal(claims, &c)
+		if c["iss"] != "svc@proj.iam.gserviceaccount.com" || c["scope"] != Scope {
+			t.Errorf("claims = %s", claims)
+		}
+		w.Write([]byte(`{"access_token":"ya29.token","expires_in":3600,"token_type":"Bearer"}`))
+	}))
+	defer srv.Close()
+
+	path := writeCredentials(t, map[string]string{
+		"type":           "service_account",
+		"client_email":   "svc@proj.iam.gserviceaccount.com",
+		"private_key":    string(pemKey),
+		"private_key_id": "kid",
+		"token_uri":      srv.URL,
+	})
+	ts, err := CredentialsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		tok, err := ts.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok != "ya29.token" {
+			t.Errorf("token = %q", tok)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("token endpoint called %d times, want 1 (cached)", calls)
+	}
+}
+
+func TestDefaultTokenSource(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, tokenURL string)
+	}{
+		{"credentials env", func(t *testing.T, tokenURL string) {
+			t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", writeCredentials(t, map[string]string{
+				"type": "authorized_user", "client_id": "id", "client_secret": "secret",
+				"refresh_token": "refresh", "token_uri": tokenURL,
+			}))
+		}},
+		{"metadata server", func(t *testing.T, tokenURL string) {
+			t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+			t.Setenv("CLOUDSDK_CONFIG", t.TempDir())
+			t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(tokenURL, "http://"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPost:
+					r.ParseForm()
+					if r.PostForm.Get("refresh_token") != "refresh" {
+						t.Errorf("form = %v", r.PostForm)
+					}
+				case http.MethodGet:
+					if r.Header.Get("Metadata-Flavor") != "Google" {
+						t.Error("missing Metadata-Flavor header")
+					}
+				}
+				w.Write([]byte(`{"access_token":"tok","expires_in":3600}`))
+			}))
+			defer srv.Close()
+			tt.setup(t, srv.URL)
+
+			tok, err := DefaultTokenSource().Token(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok != "tok" {
+				t.Errorf("token = %q", tok)
+			}
+		})
+	}
+}
+
+func TestTokenError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	ts, err := CredentialsFile(writeCredentials(t, map[string]string{
+		"type": "authorized_user", "refresh_token": "r", "token_uri": srv.URL,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Token(context.Background()); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("err = %v", err)
+	}
+	if _, err := CredentialsFile(writeCredentials(t, map[string]string{"type": "external_account"})); err == nil {
+		t.Error("expected error for unsupported credentials type")
+	}
+}
@@ -0,0 +1,67 @@
+// Package vertex adapts requests to Google Cloud Vertex AI. Claude models
+// are called through the Anthropic publisher's rawPredict endpoints with
+// the Vertex request envelope; Gemini and other models through Vertex's
+// OpenAI-compatible chat completions endpoint. Calls authenticate with
+// OAuth access tokens from Application Default Credentials.
+package vertex
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// AnthropicVersion is the anthropic_version Vertex requires in the body of
+// Claude requests.
+const AnthropicVersion = "vertex-2023-10-16"
+
+// Endpoint returns the Vertex AI base URL for region. The "global" region
+// has no regional host.
+func Endpoint(region string) string {
+	if region == "global" {
+		return "https://aiplatform.googleapis.com"
+	}
+	return "https://" + region + "-aiplatform.googleapis.com"
+}
+
+// locationPath is the resource path of a project location.
+func locationPath(project, region string) string {
+	return "/v1/projects/" + url.PathEscape(project) + "/locations/" + url.PathEscape(region)
+}
+
+// MessagesURL returns the rawPredict URL for a Claude model, or the
+// streamRawPredict URL when stream is set.
+func MessagesURL(baseURL, project, region, model string, stream bool) string {
+	method := "rawPredict"
+	if stream {
+		method = "streamRawPredict"
+	}
+	return strings.TrimSuffix(baseURL, "/") + locationPath(project, region) +
+		"/publishers/anthropic/models/" + url.PathEscape(model) + ":" + method
+}
+
+// ChatURL returns the OpenAI-compatible chat completions URL. Models are
+// named with their publisher, e.g. "google/gemini-2.0-flash".
+func ChatURL(baseURL, project, region string) string {
+	return strings.TrimSuffix(baseURL, "/") + locationPath(project, region) + "/endpoints/openapi/chat/completions"
+}
+
+// TranslateMessages converts an Anthropic Messages request body to the
+// Vertex envelope: the model moves into the URL and anthropic_version is
+// set unless the client sent one. stream stays in the body.
+func TranslateMessages(body []byte) ([]byte, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("vertex: parse request: %w", err)
+	}
+	delete(raw, "model")
+	if _, ok := raw["anthropic_version"]; !ok {
+		raw["anthropic_version"] = json.RawMessage(`"` + AnthropicVersion + `"`)
+	}
+	out, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("vertex: encode request: %w", err)
+	}
+	return out, nil
+}
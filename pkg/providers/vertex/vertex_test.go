@@ -0,0 +1,61 @@
+package vertex
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestURLs(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"regional endpoint", Endpoint("us-east5"), "https://us-east5-aiplatform.googleapis.com"},
+		{"global endpoint", Endpoint("global"), "https://aiplatform.googleapis.com"},
+		{"raw predict", MessagesURL("https://x/", "proj", "us-east5", "claude-3-5-haiku@20241022", false),
+			"https://x/v1/projects/proj/locations/us-east5/publishers/anthropic/models/claude-3-5-haiku@20241022:rawPredict"},
+		{"stream raw predict", MessagesURL("https://x", "proj", "us-east5", "claude-3-5-haiku@20241022", true),
+			"https://x/v1/projects/proj/locations/us-east5/publishers/anthropic/models/claude-3-5-haiku@20241022:streamRawPredict"},
+		{"chat", ChatURL("https://x", "proj", "us-central1"),
+			"https://x/v1/projects/proj/locations/us-central1/endpoints/openapi/chat/completions"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestTranslateMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		version string
+	}{
+		{"default version", `{"model":"claude","stream":true,"max_tokens":10,"messages":[]}`, AnthropicVersion},
+		{"client version", `{"model":"claude","anthropic_version":"custom","messages":[]}`, "custom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := TranslateMessages([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := got["model"]; ok {
+				t.Error("model was not removed")
+			}
+			if got["anthropic_version"] != tt.version {
+				t.Errorf("anthropic_version = %v, want %q", got["anthropic_version"], tt.version)
+			}
+		})
+	}
+
+	if _, err := TranslateMessages([]byte(`not json`)); err == nil {
+		t.Error("expected error for invalid body")
+	}
+}
@@ -0,0 +1,460 @@
+package proxy
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/audit"
+	"github.com/pario-ai/pario/pkg/budget"
+	"github.com/pario-ai/pario/pkg/events"
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/tracker"
+)
+
+// adminPrefix is the path prefix of the admin API. Requests under it are
+// never forwarded upstream.
+const adminPrefix = "/pario/admin/"
+
+// eventKeepalive is how often an idle event stream sends an SSE comment so
+// intermediaries keep the connection open.
+const eventKeepalive = 15 * time.Second
+
+// requestInfoKey is the context key for the per-request requestInfo.
+type requestInfoKey struct{}
+
+// requestInfo collects what handlers learn about a request so ServeHTTP can
+// publish a RequestEvent once the response is written.
+type requestInfo struct {
+	model    string
+	provider string
+	team     string
+	project  string
+	env      string
+	tokens   models.TokenCounts
+	total    int
+	cost     float64
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// noteModel records the client-requested model for the event feed. Usage
+// records later replace it with the model that served the request.
+func noteModel(r *http.Request, model string) {
+	if info := requestInfoFrom(r.Context()); info != nil {
+		info.model = model
+	}
+}
+
+// noteUsage adds a usage record to the request's event. Fallback attempts
+// that returned partial usage are summed.
+func noteUsage(r *http.Request, rec models.UsageRecord) {
+	info := requestInfoFrom(r.Context())
+	if info == nil {
+		return
+	}
+	info.model = rec.Model
+	info.provider = rec.Provider
+	info.team, info.project, info.env = rec.Team, rec.Project, rec.Env
+	t := rec.Tokens()
+	info.tokens.Prompt += t.Prompt
+	info.tokens.Completion += t.Completion
+	info.tokens.CacheRead += t.CacheRead
+	info.tokens.CacheCreation += t.CacheCreation
+	info.tokens.Reasoning += t.Reasoning
+	info.total += rec.TotalTokens
+	info.cost += rec.EstimatedCostUSD
+}
+
+// statusWriter records the response status while passing writes and
+// flushes through.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// publishEvent builds the RequestEvent for a finished request.
+func (s *Server) publishEvent(r *http.Request, id string, info *requestInfo, w *statusWriter, latency time.Duration) {
+	key := extractAPIKey(r)
+	_, prefix := audit.HashAPIKey(key)
+	ev := models.RequestEvent{
+		RequestID:        id,
+		Time:             time.Now().UTC(),
+		Path:             r.URL.Path,
+		KeyPrefix:        prefix,
+		Model:            info.model,
+		Provider:         info.provider,
+		Team:             info.team,
+		Project:          info.project,
+		Env:              info.env,
+		PromptTokens:     int(info.tokens.Prompt),
+		CompletionTokens: int(info.tokens.Completion),
+		TotalTokens:      info.total,
+		Cached:           w.Header().Get("X-Pario-Cache") == "hit" || w.Header().Get("X-Pario-Cache") == "coalesced",
+		LatencyMs:        latency.Milliseconds(),
+		Status:           w.status,
+	}
+	if ev.Status == 0 {
+		ev.Status = http.StatusOK
+	}
+	if ev.Team == "" && key != "" {
+		ev.Team, ev.Project, ev.Env = s.resolveLabels(r, key)
+	}
+	ev.CostUSD = info.cost
+	s.events.Publish(ev)
+}
+
+// AdminHandler returns the admin API, rooted at /pario/admin/. Every request
+// must carry the admin token; the API is disabled unless admin.token is set.
+func (s *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(adminPrefix, func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusNotFound, "unknown admin endpoint")
+	})
+	mux.HandleFunc(adminPrefix+"events", s.handleEvents)
+	mux.HandleFunc(adminPrefix+"budgets", s.handleBudgets)
+	mux.HandleFunc(adminPrefix+"policies", s.handlePolicies)
+	mux.HandleFunc(adminPrefix+"policies/", s.handlePolicy)
+	mux.HandleFunc(adminPrefix+"usage", s.handleUsage)
+	mux.HandleFunc(adminPrefix+"usage/stream", s.handleUsageStream)
+	mux.HandleFunc(adminPrefix+"top", s.handleTop)
+	mux.HandleFunc(adminPrefix+"sessions", s.handleSessions)
+	mux.HandleFunc(adminPrefix+"sessions/", s.handleSession)
+	mux.HandleFunc(adminPrefix+"queue", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.queue.Stats())
+	})
+	mux.HandleFunc(adminPrefix+"canary", func(w http.ResponseWriter, r *http.Request) {
+		st, ok := s.CanaryStatus()
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "no config canary has run")
+			return
+		}
+		writeJSON(w, st)
+	})
+	mux.HandleFunc(adminPrefix+"drain", s.handleDrain)
+	mux.HandleFunc(adminPrefix+"ratelimits", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.router.RateLimits())
+	})
+	mux.HandleFunc(adminPrefix+"latency", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.router.Latencies())
+	})
+	mux.HandleFunc(adminPrefix+"cooldowns", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.router.Cooldowns())
+	})
+	mux.HandleFunc(adminPrefix+"writes", func(w http.ResponseWriter, r *http.Request) {
+		var stats tracker.AsyncStats
+		if st, ok := s.tracker.(*tracker.SQLiteTracker); ok {
+			stats = st.AsyncStats()
+		}
+		writeJSON(w, stats)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := s.cfg.Admin.Token
+		if token == "" {
+			writeJSONError(w, http.StatusNotFound, "admin API disabled")
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// maxBudgetKeys bounds how many recently active keys the budgets endpoint
+// reports on when no api_key is given.
+const maxBudgetKeys = 50
+
+// budgetRow is a budget status for one API key, identified by prefix. Rows
+// of label-scoped policies have no key.
+type budgetRow struct {
+	KeyPrefix string `json:"key_prefix"`
+	models.BudgetStatus
+}
+
+// handleBudgets reports budget status and burn-down for the api_key query
+// parameter, or for the most recently active keys and every label-scoped
+// policy.
+func (s *Server) handleBudgets(w http.ResponseWriter, r *http.Request) {
+	rows := []budgetRow{}
+	if s.enforcer == nil {
+		writeJSON(w, rows)
+		return
+	}
+
+	keys := []string{r.URL.Query().Get("api_key")}
+	listed := keys[0] != ""
+	if !listed {
+		st, ok := s.tracker.(*tracker.SQLiteTracker)
+		if !ok {
+			writeJSONError(w, http.StatusBadRequest, "api_key is required")
+			return
+		}
+		var err error
+		if keys, err = st.Distinct(r.Context(), "api_key", "", maxBudgetKeys); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "budget status failed")
+			return
+		}
+	}
+
+	for _, key := range keys {
+		ctx := r.Context()
+		if listed {
+			ctx = budget.ContextWithLabels(ctx, s.cfg.Attribution.KeyLabels[key])
+		}
+		statuses, err := s.enforcer.Status(ctx, key)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "budget status failed")
+			return
+		}
+		_, prefix := audit.HashAPIKey(key)
+		for _, st := range statuses {
+			rows = append(rows, budgetRow{KeyPrefix: prefix, BudgetStatus: st})
+		}
+	}
+	if !listed {
+		// Label-scoped policies span keys, so they are listed once.
+		statuses, err := s.enforcer.LabelStatus(r.Context())
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "budget status failed")
+			return
+		}
+		for _, st := range statuses {
+			rows = append(rows, budgetRow{BudgetStatus: st})
+		}
+	}
+	writeJSON(w, rows)
+}
+
+// handleUsage reports usage and estimated cost by team, project, and model
+// over the last hours (default 24).
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	hours := 24
+	if v := r.URL.Query().Get("hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "hours must be a positive integer")
+			return
+		}
+		hours = n
+	}
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour).UTC()
+	reports, err := s.tracker.CostReport(r.Context(), since, "", "")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "usage report failed")
+		return
+	}
+	if reports == nil {
+		reports = []models.CostReport{}
+	}
+	for i := range reports {
+		reports[i].Local = s.pricing[reports[i].Model].Local
+	}
+	writeJSON(w, reports)
+}
+
+// maxTopLimit bounds the limit of the top endpoint.
+const maxTopLimit = 1000
+
+// handleTop ranks API keys, sessions, models, or teams (by) by tokens or
+// estimated cost (order) over the last hours (default 24), returning the
+// top limit (default 10).
+func (s *Server) handleTop(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := models.TopQuery{
+		By:      cmp.Or(params.Get("by"), models.TopByKey),
+		OrderBy: params.Get("order"),
+	}
+	hours := 24
+	if v := params.Get("hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "hours must be a positive integer")
+			return
+		}
+		hours = n
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxTopLimit {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxTopLimit))
+			return
+		}
+		q.Limit = n
+	}
+	if err := q.Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q.Since = time.Now().Add(-time.Duration(hours) * time.Hour).UTC()
+
+	entries, err := s.tracker.Top(r.Context(), q)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "top query failed")
+		return
+	}
+	writeJSON(w, append([]models.TopEntry{}, entries...))
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// eventFilter selects events for a stream from query parameters.
+type eventFilter struct {
+	model     string
+	team      string
+	minTokens int
+}
+
+func (f eventFilter) match(model, team string, totalTokens int) bool {
+	if f.model != "" && model != f.model {
+		return false
+	}
+	if f.team != "" && team != f.team {
+		return false
+	}
+	return totalTokens >= f.minTokens
+}
+
+// handleEvents streams completed requests as server-sent events. Query
+// parameters model, team, and min_tokens filter the stream.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	f, ok := parseEventFilter(w, r)
+	if !ok {
+		return
+	}
+	sub := s.events.Subscribe(256)
+	defer sub.Close()
+	streamEvents(w, r, sub, func(ev models.RequestEvent) (any, bool) {
+		return ev, f.match(ev.Model, ev.Team, ev.TotalTokens)
+	})
+}
+
+// usageSubscriber is a tracker that publishes usage records as they are
+// stored; the SQLite and in-memory trackers are.
+type usageSubscriber interface {
+	SubscribeUsage(buffer int) *events.Subscription[models.UsageRecord]
+}
+
+// handleUsageStream streams usage records as server-sent events once the
+// tracker has stored them, with API keys cut to their prefix. It takes the
+// same filters as handleEvents.
+func (s *Server) handleUsageStream(w http.ResponseWriter, r *http.Request) {
+	us, ok := s.tracker.(usageSubscriber)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, "usage stream needs a local tracker")
+		return
+	}
+	f, ok := parseEventFilter(w, r)
+	if !ok {
+		return
+	}
+	sub := us.SubscribeUsage(256)
+	defer sub.Close()
+	streamEvents(w, r, sub, func(rec models.UsageRecord) (any, bool) {
+		_, rec.APIKey = audit.HashAPIKey(rec.APIKey)
+		return rec, f.match(rec.Model, rec.Team, rec.TotalTokens)
+	})
+}
+
+// parseEventFilter reads a stream's filter from the query parameters,
+// writing an error and returning false if they are invalid.
+func parseEventFilter(w http.ResponseWriter, r *http.Request) (eventFilter, bool) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return eventFilter{}, false
+	}
+	q := r.URL.Query()
+	f := eventFilter{model: q.Get("model"), team: q.Get("team")}
+	if v := q.Get("min_tokens"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSONError(w, http.StatusBadRequest, "min_tokens must be a non-negative integer")
+			return eventFilter{}, false
+		}
+		f.minTokens = n
+	}
+	return f, true
+}
+
+// streamEvents writes the events of sub that convert selects as
+// server-sent events until the client goes away, with keepalive comments
+// while idle.
+func streamEvents[T any](w http.ResponseWriter, r *http.Request, sub *events.Subscription[T], convert func(T) (any, bool)) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepalive := time.NewTicker(eventKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case ev, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			v, ok := convert(ev)
+			if !ok {
+				continue
+			}
+			data, err := json.Marshal(v)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
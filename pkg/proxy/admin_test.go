@@ -0,0 +1,277 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pario-ai/pario/pkg/budget"
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestAdminAuth(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	tests := []struct {
+		name     string
+		token    string
+		header   string
+		path     string
+		wantCode int
+	}{
+		{"disabled", "", "Bearer x", "/pario/admin/events", http.StatusNotFound},
+		{"missing token", "secret", "", "/pario/admin/events", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer nope", "/pario/admin/events", http.StatusUnauthorized},
+		{"unknown endpoint", "secret", "Bearer secret", "/pario/admin/nope", http.StatusNotFound},
+		{"bad filter", "secret", "Bearer secret", "/pario/admin/events?min_tokens=-1", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := setupProxy(t, upstream)
+			srv.cfg.Admin.Token = tt.token
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Admin.Token = "secret"
+	srv.pricing["gpt-4"] = models.ModelPricing{Model: "gpt-4", PromptCost: 0.03, CompletionCost: 0.06}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/pario/admin/events?min_tokens=1", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || lines.Text() != ": connected" {
+		t.Fatalf("expected connected comment, got %q", lines.Text())
+	}
+
+	// The second request is a cache hit with no tokens and is filtered out
+	// by min_tokens.
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+	for range 2 {
+		chat, _ := http.NewRequest(http.MethodPost, ts.URL+"/v1/chat/completions", strings.NewReader(body))
+		chat.Header.Set("Authorization", "Bearer sk-client-key")
+		chat.Header.Set("X-Pario-Team", "search")
+		r, err := http.DefaultClient.Do(chat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+	}
+
+	var ev models.RequestEvent
+	for lines.Scan() {
+		data, ok := strings.CutPrefix(lines.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+	if ev.Model != "gpt-4" || ev.TotalTokens != 15 || ev.Status != http.StatusOK || ev.Cached {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+	if ev.KeyPrefix != "sk-clien" || ev.Team != "search" || ev.Provider != "test" || ev.RequestID == "" {
+		t.Errorf("unexpected event attribution: %+v", ev)
+	}
+	if want := 10.0/1000*0.03 + 5.0/1000*0.06; ev.CostUSD != want {
+		t.Errorf("cost = %v, want %v", ev.CostUSD, want)
+	}
+}
+
+func TestUsageStream(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Admin.Token = "secret"
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/pario/admin/usage/stream?team=search", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || lines.Text() != ": connected" {
+		t.Fatalf("expected connected comment, got %q", lines.Text())
+	}
+
+	// The first request's team is filtered out.
+	for _, team := range []string{"ads", "search"} {
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi from ` + team + `"}]}`
+		chat, _ := http.NewRequest(http.MethodPost, ts.URL+"/v1/chat/completions", strings.NewReader(body))
+		chat.Header.Set("Authorization", "Bearer sk-client-key")
+		chat.Header.Set("X-Pario-Team", team)
+		r, err := http.DefaultClient.Do(chat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+	}
+
+	var rec models.UsageRecord
+	for lines.Scan() {
+		data, ok := strings.CutPrefix(lines.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal([]byte(data), &rec); err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+	if rec.ID == 0 || rec.Model != "gpt-4" || rec.Team != "search" || rec.TotalTokens != 15 {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+	if rec.APIKey != "sk-clien" {
+		t.Errorf("api key = %q, want prefix only", rec.APIKey)
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	ev := models.RequestEvent{Model: "gpt-4", Team: "search", TotalTokens: 100}
+	tests := []struct {
+		name string
+		f    eventFilter
+		want bool
+	}{
+		{"empty", eventFilter{}, true},
+		{"model match", eventFilter{model: "gpt-4"}, true},
+		{"model mismatch", eventFilter{model: "gpt-3.5"}, false},
+		{"team mismatch", eventFilter{team: "ads"}, false},
+		{"min tokens met", eventFilter{minTokens: 100}, true},
+		{"min tokens not met", eventFilter{minTokens: 101}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.f.match(ev.Model, ev.Team, ev.TotalTokens); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminBudgetsAndUsage(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Admin.Token = "secret"
+	srv.pricing["gpt-4"] = models.ModelPricing{Model: "gpt-4", PromptCost: 1, CompletionCost: 2}
+	srv.enforcer = budget.New([]models.BudgetPolicy{{APIKey: "*", MaxTokens: 100, Period: models.BudgetDaily}}, srv.tracker)
+
+	chat := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`))
+	chat.Header.Set("Authorization", "Bearer sk-client-key")
+	chat.Header.Set("X-Pario-Team", "search")
+	srv.ServeHTTP(httptest.NewRecorder(), chat)
+
+	get := func(path string, v any) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", path, w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var budgets []budgetRow
+	get("/pario/admin/budgets", &budgets)
+	if len(budgets) != 1 || budgets[0].KeyPrefix != "sk-clien" || budgets[0].Used != 15 || budgets[0].PeriodEnd.IsZero() {
+		t.Errorf("unexpected budgets: %+v", budgets)
+	}
+
+	var usage []models.CostReport
+	get("/pario/admin/usage?hours=1", &usage)
+	if len(usage) != 1 || usage[0].Team != "search" || usage[0].TotalTokens != 15 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+	if want := 10.0/1000 + 5.0/1000*2; usage[0].EstimatedCost != want {
+		t.Errorf("cost = %v, want %v", usage[0].EstimatedCost, want)
+	}
+	// A price change leaves recorded usage at the price it was recorded at.
+	srv.pricing["gpt-4"] = models.ModelPricing{Model: "gpt-4", PromptCost: 10, CompletionCost: 20}
+	var repriced []models.CostReport
+	get("/pario/admin/usage?hours=1", &repriced)
+	if len(repriced) != 1 || repriced[0].EstimatedCost != usage[0].EstimatedCost {
+		t.Errorf("cost after price change = %+v, want %v", repriced, usage[0].EstimatedCost)
+	}
+
+	var top []models.TopEntry
+	get("/pario/admin/top?by=team&order=cost&hours=1", &top)
+	if len(top) != 1 || top[0].Value != "search" || top[0].EstimatedCost != usage[0].EstimatedCost {
+		t.Errorf("unexpected top: %+v", top)
+	}
+	for _, q := range []string{"by=region", "order=latency", "limit=0", "hours=x"} {
+		req := httptest.NewRequest(http.MethodGet, "/pario/admin/top?"+q, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("top?%s: status %d, want 400", q, w.Code)
+		}
+	}
+}
+
+func TestAdminListenSeparate(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Admin = config.AdminConfig{Token: "secret", Listen: "127.0.0.1:0"}
+	srv = New(srv.cfg, srv.tracker, srv.cache, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/pario/admin/usage", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("proxy listener status = %d, want 404", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	srv.AdminHandler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("admin handler status = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,284 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// maxAssistantsBody caps how much of a JSON Assistants response is buffered
+// for inspection. Larger responses (e.g. big message lists) are relayed
+// without tracking; run objects are far smaller.
+const maxAssistantsBody = 4 << 20
+
+// handleAssistants proxies the OpenAI Assistants and Threads APIs. Requests
+// are relayed to the first OpenAI-compatible provider unchanged; threads and
+// assistants live on that provider, so there is no fallback. Run objects in
+// responses (single runs, run lists, and streamed run events) are tracked
+// once they reach a terminal status. Each run is recorded under its run ID,
+// so polling the same run repeatedly stores it once.
+func (s *Server) handleAssistants(w http.ResponseWriter, r *http.Request) {
+	clientKey := extractAPIKey(r)
+	if clientKey == "" {
+		writeJSONError(w, http.StatusUnauthorized, "missing API key")
+		return
+	}
+
+	provider, ok := s.statefulProvider()
+	if !ok {
+		writeJSONError(w, http.StatusServiceUnavailable, "no OpenAI-compatible provider configured")
+		return
+	}
+	target, err := url.Parse(provider.URL)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "invalid provider URL")
+		return
+	}
+
+	if (s.enforcer != nil || s.rateLimits.Enabled()) && startsRun(r) {
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var req struct {
+			Model string `json:"model"`
+		}
+		_ = json.Unmarshal(body, &req)
+		if !s.checkBudget(w, r, clientKey, req.Model) {
+			return
+		}
+	}
+
+	rp := s.providerProxy(provider, target)
+	rp.ModifyResponse = func(resp *http.Response) error {
+		if resp.StatusCode != http.StatusOK {
+			return nil
+		}
+		t := &runTracker{s: s, r: r, clientKey: clientKey, provider: provider.Name}
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+			resp.Body = &sseReader{ReadCloser: resp.Body, onData: t.onEvent}
+			return nil
+		}
+		if resp.ContentLength > maxAssistantsBody {
+			return nil
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxAssistantsBody+1))
+		_ = resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if len(body) <= maxAssistantsBody {
+			t.inspectJSON(body)
+		}
+		return nil
+	}
+	rp.ServeHTTP(w, r)
+}
+
+// providerProxy returns a reverse proxy that relays requests to provider
+// unchanged apart from the credentials, over the provider's transport. The
+// client's Accept-Encoding is dropped so the transport negotiates and
+// decodes compression itself, leaving response bodies readable for usage
+// tracking.
+func (s *Server) providerProxy(provider config.ProviderConfig, target *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Transport: s.observing(provider, clientFor(provider).stream.Transport),
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = strings.TrimRight(target.Path, "/") + req.URL.Path
+			req.Host = target.Host
+			setProviderHeaders(req, provider)
+			req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+			req.Header.Del("x-api-key")
+			req.Header.Del("Accept-Encoding")
+		},
+	}
+}
+
+// observing wraps rt so the router sees the rate-limit headers of relayed
+// responses, which don't pass through the fallback loop.
+func (s *Server) observing(provider config.ProviderConfig, rt http.RoundTripper) http.RoundTripper {
+	return observingTransport{RoundTripper: rt, s: s, provider: provider.Name}
+}
+
+type observingTransport struct {
+	http.RoundTripper
+	s        *Server
+	provider string
+}
+
+func (t observingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err == nil {
+		t.s.router.Observe(t.provider, resp.StatusCode, resp.Header)
+	}
+	return resp, err
+}
+
+// statefulProvider returns the provider that serves the stateful OpenAI
+// APIs (Assistants, Files, and Batch). Objects created through one live on
+// it, so they must all go to the same provider.
+func (s *Server) statefulProvider() (config.ProviderConfig, bool) {
+	for _, p := range s.cfg.Providers {
+		if p.Type != "anthropic" && p.Type != "bedrock" && p.Type != "vertex" && !p.Local() {
+			return p, true
+		}
+	}
+	return config.ProviderConfig{}, false
+}
+
+// startsRun reports whether r creates a run or resumes one that is waiting
+// on tool outputs, i.e. whether it will consume tokens.
+func startsRun(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 3 && parts[1] == "threads" && parts[2] == "runs":
+		// /v1/threads/runs
+		return true
+	case len(parts) == 4 && parts[1] == "threads" && parts[3] == "runs":
+		// /v1/threads/{thread_id}/runs
+		return true
+	case len(parts) == 6 && parts[1] == "threads" && parts[3] == "runs" && parts[5] == "submit_tool_outputs":
+		// /v1/threads/{thread_id}/runs/{run_id}/submit_tool_outputs
+		return true
+	}
+	return false
+}
+
+// runTracker records usage for terminal runs seen in one response.
+type runTracker struct {
+	s         *Server
+	r         *http.Request
+	clientKey string
+	provider  string
+	streamed  bool
+	sessionID *string // resolved lazily, on the first recorded run
+}
+
+// inspectJSON records a run object or each run in a run list.
+func (t *runTracker) inspectJSON(body []byte) {
+	var obj struct {
+		Object string                `json:"object"`
+		Data   []models.AssistantRun `json:"data"`
+	}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return
+	}
+	switch obj.Object {
+	case "thread.run":
+		var run models.AssistantRun
+		if err := json.Unmarshal(body, &run); err == nil {
+			t.record(run)
+		}
+	case "list":
+		for _, run := range obj.Data {
+			if run.Object == "thread.run" {
+				t.record(run)
+			}
+		}
+	}
+}
+
+func (t *runTracker) record(run models.AssistantRun) {
+	if !run.Terminal() || run.Usage == nil || run.ID == "" {
+		return
+	}
+	if t.sessionID == nil {
+		sid := t.s.resolveSessionID(t.r, t.clientKey)
+		t.sessionID = &sid
+	}
+	noteModel(t.r, run.Model)
+	rec := models.UsageRecord{
+		RequestID:           run.ID,
+		Attempt:             1,
+		APIKey:              t.clientKey,
+		Model:               run.Model,
+		SessionID:           *t.sessionID,
+		Provider:            t.provider,
+		PromptTokens:        run.Usage.PromptTokens,
+		CompletionTokens:    run.Usage.CompletionTokens,
+		TotalTokens:         run.Usage.TotalTokens,
+		CacheReadTokens:     run.Usage.CacheReadTokens(),
+		CacheCreationTokens: run.Usage.CacheCreationTokens(),
+		ReasoningTokens:     run.Usage.ReasoningTokens(),
+		Streamed:            t.streamed,
+	}
+	if end := run.EndedAt(); run.StartedAt > 0 && end >= run.StartedAt {
+		rec.LatencyMs = (end - run.StartedAt) * 1000
+	}
+	t.s.recordUsage(t.r, rec)
+}
+
+// sseReader relays an SSE stream while handing each data line, with the
+// event it belongs to, to onData.
+type sseReader struct {
+	io.ReadCloser
+	onData  func(event, data string)
+	pending []byte
+	event   string
+}
+
+func (s *sseReader) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	if n > 0 {
+		s.scan(p[:n])
+	}
+	return n, err
+}
+
+// scan splits relayed bytes into SSE lines. Only an incomplete trailing line
+// is held between reads.
+func (s *sseReader) scan(b []byte) {
+	s.pending = append(s.pending, b...)
+	consumed := 0
+	for {
+		i := bytes.IndexByte(s.pending[consumed:], '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimRight(string(s.pending[consumed:consumed+i]), "\r")
+		consumed += i + 1
+		s.line(line)
+	}
+	s.pending = s.pending[consumed:]
+	if len(s.pending) > maxAssistantsBody {
+		s.pending = s.pending[:0]
+	}
+}
+
+func (s *sseReader) line(line string) {
+	switch {
+	case strings.HasPrefix(line, "event: "):
+		s.event = strings.TrimPrefix(line, "event: ")
+	case strings.HasPrefix(line, "data: "):
+		s.onData(s.event, strings.TrimPrefix(line, "data: "))
+	case line == "":
+		s.event = ""
+	}
+}
+
+// onEvent records the run in a terminal thread.run.* event of a streamed
+// run, whose data is the final run object.
+func (t *runTracker) onEvent(event, data string) {
+	if !strings.HasPrefix(event, "thread.run.") {
+		return
+	}
+	var run models.AssistantRun
+	if err := json.Unmarshal([]byte(data), &run); err == nil && run.Object == "thread.run" {
+		t.streamed = true
+		t.record(run)
+	}
+}
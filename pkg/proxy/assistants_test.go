@@ -0,0 +1,255 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/budget"
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/tracker"
+)
+
+const completedRun = `{"id":"run_1","object":"thread.run","thread_id":"thread_1","status":"completed","model":"gpt-4o","started_at":100,"completed_at":103,"usage":{"prompt_tokens":40,"completion_tokens":10,"total_tokens":50}}`
+
+func TestAssistantsRunTracking(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-provider" {
+			t.Error("expected provider API key in upstream request")
+		}
+		switch r.URL.Path {
+		case "/v1/threads/thread_1/runs/run_1":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, completedRun)
+		case "/v1/threads/thread_1/runs/run_2":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id":"run_2","object":"thread.run","status":"in_progress","model":"gpt-4o"}`)
+		case "/v1/threads/thread_1/runs":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"object":"list","data":[%s,{"id":"run_3","object":"thread.run","status":"failed","model":"gpt-4o","usage":{"prompt_tokens":5,"completion_tokens":0,"total_tokens":5}}]}`, completedRun)
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+
+	paths := []string{
+		"/v1/threads/thread_1/runs/run_2", // still running: not tracked
+		"/v1/threads/thread_1/runs/run_1",
+		"/v1/threads/thread_1/runs/run_1", // polled again: deduplicated
+		"/v1/threads/thread_1/runs",       // list repeats run_1, adds run_3
+	}
+	for _, p := range paths {
+		req := httptest.NewRequest(http.MethodGet, p, nil)
+		req.Header.Set("Authorization", "Bearer client-key")
+		req.Header.Set("X-Pario-Team", "search")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", p, w.Code)
+		}
+	}
+
+	recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(recs))
+	}
+	byID := make(map[string]models.UsageRecord)
+	for _, r := range recs {
+		byID[r.RequestID] = r
+	}
+	r1, ok := byID["run_1"]
+	if !ok {
+		t.Fatalf("expected record for run_1, got %+v", recs)
+	}
+	if r1.TotalTokens != 50 || r1.Model != "gpt-4o" || r1.Team != "search" || r1.LatencyMs != 3000 {
+		t.Errorf("unexpected run_1 record: %+v", r1)
+	}
+	if _, ok := byID["run_3"]; !ok {
+		t.Error("expected failed run_3 to be recorded")
+	}
+}
+
+// writeMaybeGzip writes body as JSON, gzip-compressed if the request
+// accepts it.
+func writeMaybeGzip(w http.ResponseWriter, r *http.Request, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+		return
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	w.WriteHeader(status)
+	gz := gzip.NewWriter(w)
+	fmt.Fprint(gz, body)
+	_ = gz.Close()
+}
+
+func TestAssistantsGzipUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeMaybeGzip(w, r, http.StatusOK, completedRun)
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	req := httptest.NewRequest(http.MethodGet, "/v1/threads/thread_1/runs/run_1", nil)
+	req.Header.Set("Authorization", "Bearer client-key")
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if w.Body.String() != completedRun {
+		t.Errorf("body = %q, want the decoded run", w.Body.String())
+	}
+
+	recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].TotalTokens != 50 {
+		t.Errorf("expected the run's usage to be recorded, got %+v", recs)
+	}
+}
+
+func TestAssistantsStreamedRun(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: thread.run.created\ndata: {\"id\":\"run_1\",\"object\":\"thread.run\",\"status\":\"queued\"}\n\n")
+		fmt.Fprint(w, "event: thread.message.delta\ndata: {\"id\":\"msg_1\",\"object\":\"thread.message.delta\"}\n\n")
+		fmt.Fprintf(w, "event: thread.run.completed\ndata: %s\n\nevent: done\ndata: [DONE]\n\n", completedRun)
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/threads/thread_1/runs", strings.NewReader(`{"assistant_id":"asst_1","stream":true}`))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "thread.run.completed") {
+		t.Error("expected stream relayed to client")
+	}
+
+	recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].RequestID != "run_1" || !recs[0].Streamed {
+		t.Fatalf("expected one streamed run_1 record, got %+v", recs)
+	}
+}
+
+func TestAssistantsBudget(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"object":"list","data":[]}`)
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	tr, err := tracker.New(filepath.Join(dir, "tracker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tr.Close() }()
+	_ = tr.Record(context.Background(), models.UsageRecord{
+		APIKey: "client-key", Model: "gpt-4o", TotalTokens: 1100, CreatedAt: time.Now().UTC(),
+	})
+	enforcer := budget.New([]models.BudgetPolicy{
+		{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily},
+	}, tr)
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{Name: "test", URL: upstream.URL, APIKey: "sk-provider"}},
+		Session:   config.SessionConfig{GapTimeout: 30 * time.Minute},
+	}
+	srv := New(cfg, tr, nil, enforcer, nil)
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodPost, "/v1/threads/thread_1/runs", http.StatusTooManyRequests},
+		{http.MethodPost, "/v1/threads/runs", http.StatusTooManyRequests},
+		{http.MethodPost, "/v1/threads/thread_1/runs/run_1/submit_tool_outputs", http.StatusTooManyRequests},
+		{http.MethodGet, "/v1/threads/thread_1/runs", http.StatusOK},
+		{http.MethodPost, "/v1/threads/thread_1/messages", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{}`))
+			req.Header.Set("Authorization", "Bearer client-key")
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestUpstreamRateLimitHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ratelimit-limit-requests", "500")
+		w.Header().Set("x-ratelimit-remaining-requests", "42")
+		w.Header().Set("x-ratelimit-reset-requests", "1m")
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			fmt.Fprint(w, `{"id":"c","model":"gpt-4","choices":[],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name, method, path, body string
+	}{
+		{"chat completions", http.MethodPost, "/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`},
+		{"assistants", http.MethodGet, "/v1/threads/thread_1", ""},
+		{"passthrough", http.MethodPost, "/v1/moderations", `{"input":"hi"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := setupProxy(t, upstream)
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer client-key")
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("x-ratelimit-remaining-requests"); got != "42" {
+				t.Errorf("relayed x-ratelimit-remaining-requests = %q, want 42", got)
+			}
+			var observed *int64
+			for _, p := range srv.router.RateLimits() {
+				if p.Requests != nil {
+					observed = &p.Requests.Remaining
+				}
+			}
+			if observed == nil || *observed != 42 {
+				t.Errorf("router didn't record the provider's remaining requests")
+			}
+		})
+	}
+}
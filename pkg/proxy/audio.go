@@ -0,0 +1,317 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pario-ai/pario/pkg/audit"
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// handleTranscription proxies OpenAI transcription and translation
+// requests with budget enforcement. Audio duration is read from the
+// response and priced from the model's per-minute audio pricing; usage is
+// recorded under the "transcriptions" or "translations" endpoint.
+func (s *Server) handleTranscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	clientKey := extractAPIKey(r)
+	if clientKey == "" {
+		writeJSONError(w, http.StatusUnauthorized, "missing API key")
+		return
+	}
+
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	model, err := formModel(contentType, body)
+	if err != nil || model == "" {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	noteModel(r, model)
+
+	s.shadow(r, clientKey, model)
+	if !s.checkBudget(w, r, clientKey, model) {
+		return
+	}
+
+	release, ok := s.admit(w, r, clientKey)
+	if !ok {
+		return
+	}
+	defer release()
+
+	routes, err := s.router.Resolve(model)
+	if err == nil {
+		routes = openAIRoutes(routes)
+	}
+	if err != nil || len(routes) == 0 {
+		writeRouteError(w, err)
+		return
+	}
+
+	endpoint := endpointName(r.URL.Path)
+	reqStart := time.Now()
+	result, usedRoute, attempt, upstreamLatency := s.forwardOpenAI(r, routes, "/audio/"+endpoint, contentType, formPayload(contentType, body))
+	setRouteHeaders(w, usedRoute)
+	if result == nil {
+		writeJSONError(w, http.StatusBadGateway, "all upstream providers failed")
+		return
+	}
+
+	var rec *models.UsageRecord
+	if result.statusCode == http.StatusOK {
+		rec = &models.UsageRecord{
+			APIKey:     clientKey,
+			Model:      usedRoute.Model,
+			Provider:   usedRoute.Provider.Name,
+			RouteAlias: usedRoute.Alias,
+			Attempt:    attempt,
+			LatencyMs:  upstreamLatency.Milliseconds(),
+			Endpoint:   endpoint,
+		}
+		// text, srt, and vtt responses carry no usage; the request is
+		// still recorded.
+		var trResp models.TranscriptionResponse
+		if err := json.Unmarshal(result.body, &trResp); err == nil {
+			rec.AudioSeconds = trResp.Duration
+			if u := trResp.Usage; u != nil {
+				if u.Type == "duration" && u.Seconds > 0 {
+					rec.AudioSeconds = u.Seconds
+				}
+				rec.PromptTokens, rec.CompletionTokens, rec.TotalTokens = u.InputTokens, u.OutputTokens, u.TotalTokens
+			}
+		}
+		rec.MediaCostUSD = rec.AudioSeconds / 60 * s.pricing[usedRoute.Model].AudioMinuteCost
+		s.recordUsage(r, *rec)
+	}
+
+	if s.auditor != nil {
+		// The request body is audio; only the response text is logged.
+		keyHash, keyPrefix := audit.HashAPIKey(clientKey)
+		entry := models.AuditEntry{
+			RequestID:    auditRequestID(r),
+			APIKeyHash:   keyHash,
+			APIKeyPrefix: keyPrefix,
+			Model:        model,
+			Provider:     "openai",
+			ResponseBody: string(result.body),
+			StatusCode:   result.statusCode,
+			LatencyMs:    time.Since(reqStart).Milliseconds(),
+			CreatedAt:    time.Now().UTC(),
+		}
+		if rec != nil {
+			entry.PromptTokens = rec.PromptTokens
+			entry.CompletionTokens = rec.CompletionTokens
+			entry.TotalTokens = rec.TotalTokens
+		}
+		s.logAudit(entry)
+	}
+
+	writeUpstreamResult(w, result)
+}
+
+// handleSpeech proxies OpenAI text-to-speech requests with budget
+// enforcement. The input's character count is priced from the model's
+// per-1K-character pricing and recorded under the "speech" endpoint.
+func (s *Server) handleSpeech(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	clientKey := extractAPIKey(r)
+	if clientKey == "" {
+		writeJSONError(w, http.StatusUnauthorized, "missing API key")
+		return
+	}
+
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.SpeechRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.Model == "" {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	noteModel(r, req.Model)
+
+	s.shadow(r, clientKey, req.Model)
+	if !s.checkBudget(w, r, clientKey, req.Model) {
+		return
+	}
+
+	release, ok := s.admit(w, r, clientKey)
+	if !ok {
+		return
+	}
+	defer release()
+
+	routes, err := s.router.Resolve(req.Model)
+	if err == nil {
+		routes = openAIRoutes(routes)
+	}
+	if err != nil || len(routes) == 0 {
+		writeRouteError(w, err)
+		return
+	}
+
+	reqStart := time.Now()
+	result, usedRoute, attempt, upstreamLatency := s.forwardOpenAI(r, routes, "/audio/speech", "application/json", jsonPayload(body))
+	setRouteHeaders(w, usedRoute)
+	if result == nil {
+		writeJSONError(w, http.StatusBadGateway, "all upstream providers failed")
+		return
+	}
+
+	if result.statusCode == http.StatusOK {
+		chars := utf8.RuneCountInString(req.Input)
+		s.recordUsage(r, models.UsageRecord{
+			APIKey:       clientKey,
+			Model:        usedRoute.Model,
+			Provider:     usedRoute.Provider.Name,
+			RouteAlias:   usedRoute.Alias,
+			Attempt:      attempt,
+			LatencyMs:    upstreamLatency.Milliseconds(),
+			Endpoint:     "speech",
+			Characters:   chars,
+			MediaCostUSD: float64(chars) / 1000 * s.pricing[usedRoute.Model].CharacterCost,
+		})
+	}
+
+	if s.auditor != nil {
+		// The response body is audio; only the request is logged, plus
+		// upstream errors.
+		keyHash, keyPrefix := audit.HashAPIKey(clientKey)
+		entry := models.AuditEntry{
+			RequestID:    auditRequestID(r),
+			APIKeyHash:   keyHash,
+			APIKeyPrefix: keyPrefix,
+			Model:        req.Model,
+			Provider:     "openai",
+			RequestBody:  string(body),
+			StatusCode:   result.statusCode,
+			LatencyMs:    time.Since(reqStart).Milliseconds(),
+			CreatedAt:    time.Now().UTC(),
+		}
+		if result.statusCode != http.StatusOK {
+			entry.ResponseBody = string(result.body)
+		}
+		s.logAudit(entry)
+	}
+
+	writeUpstreamResult(w, result)
+}
+
+// writeUpstreamResult relays a buffered upstream response to the client.
+func writeUpstreamResult(w http.ResponseWriter, result *upstreamResult) {
+	for k, vals := range result.header {
+		for _, v := range vals {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(result.statusCode)
+	w.Write(result.body)
+}
+
+// formModel returns the model field of a multipart/form-data body.
+func formModel(contentType string, body []byte) (string, error) {
+	boundary, err := formBoundary(contentType)
+	if err != nil {
+		return "", err
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if part.FormName() == "model" && part.FileName() == "" {
+			v, err := io.ReadAll(part)
+			return strings.TrimSpace(string(v)), err
+		}
+	}
+}
+
+// formPayload returns a forwardOpenAI payload that sets the model field of
+// a multipart/form-data body. The boundary is kept so the original
+// Content-Type stays valid; the body is sent unchanged if it can't be
+// rewritten.
+func formPayload(contentType string, body []byte) func(model string) []byte {
+	return func(model string) []byte {
+		out, err := rewriteFormModel(contentType, body, model)
+		if err != nil {
+			return body
+		}
+		return out
+	}
+}
+
+func rewriteFormModel(contentType string, body []byte, model string) ([]byte, error) {
+	boundary, err := formBoundary(contentType)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		pw, err := mw.CreatePart(part.Header)
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "model" && part.FileName() == "" {
+			_, err = io.WriteString(pw, model)
+		} else {
+			_, err = io.Copy(pw, part)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func formBoundary(contentType string) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", err
+	}
+	if mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return "", errors.New("not a multipart/form-data body")
+	}
+	return params["boundary"], nil
+}
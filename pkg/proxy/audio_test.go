@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestAudio(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/audio/transcriptions":
+			model, err := formModel(r.Header.Get("Content-Type"), mustRead(t, r.Body))
+			if err != nil || model != "whisper-1" {
+				t.Errorf("model = %q, err = %v", model, err)
+			}
+			w.Write([]byte(`{"text":"hello","duration":90}`))
+		case "/v1/audio/speech":
+			w.Header().Set("Content-Type", "audio/mpeg")
+			w.Write([]byte("ID3audio"))
+		default:
+			t.Errorf("path = %q", r.URL.Path)
+		}
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.pricing["whisper-1"] = models.ModelPricing{Model: "whisper-1", AudioMinuteCost: 0.006}
+	srv.pricing["tts-1"] = models.ModelPricing{Model: "tts-1", CharacterCost: 0.015}
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	mw.WriteField("model", "whisper-1")
+	mw.WriteField("response_format", "verbose_json")
+	fw, _ := mw.CreateFormFile("file", "clip.mp3")
+	fw.Write([]byte("ID3audio"))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/audio/transcriptions", &form)
+	req.Header.Set("Authorization", "Bearer client-key")
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("transcription status = %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/audio/speech", strings.NewReader(`{"model":"tts-1","input":"`+strings.Repeat("é", 2000)+`","voice":"alloy"}`))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "ID3audio" {
+		t.Fatalf("speech status = %d: %q", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "audio/mpeg" {
+		t.Errorf("speech content type = %q", ct)
+	}
+
+	recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(recs))
+	}
+	for _, r := range recs {
+		switch r.Endpoint {
+		case "transcriptions":
+			if r.AudioSeconds != 90 || r.MediaCostUSD < 0.00899 || r.MediaCostUSD > 0.00901 {
+				t.Errorf("transcription record = %+v", r)
+			}
+		case "speech":
+			if r.Characters != 2000 || r.MediaCostUSD < 0.02999 || r.MediaCostUSD > 0.03001 {
+				t.Errorf("speech record = %+v", r)
+			}
+		default:
+			t.Errorf("record = %+v", r)
+		}
+	}
+}
+
+func TestRewriteFormModel(t *testing.T) {
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	mw.WriteField("model", "whisper-alias")
+	fw, _ := mw.CreateFormFile("file", "clip.wav")
+	fw.Write([]byte("RIFFdata"))
+	mw.Close()
+
+	out, err := rewriteFormModel(mw.FormDataContentType(), form.Bytes(), "whisper-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model, err := formModel(mw.FormDataContentType(), out); err != nil || model != "whisper-1" {
+		t.Errorf("model = %q, err = %v", model, err)
+	}
+	if !bytes.Contains(out, []byte("RIFFdata")) {
+		t.Error("file part not preserved")
+	}
+}
+
+func mustRead(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,333 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// maxBatchOutputLine caps the size of one line of a batch output file.
+// Lines are single responses, so this only trips on malformed files.
+const maxBatchOutputLine = 16 << 20
+
+// handleBatches proxies the OpenAI Batch and Files APIs to the stateful
+// provider; batch input files must live where the batch runs. Creating a
+// batch is checked against budgets and recorded as a batch job carrying
+// the request's attribution. The batch's usage is recorded against that
+// job once it finishes, either when a client fetches the finished batch or
+// when PollBatches finds it.
+func (s *Server) handleBatches(w http.ResponseWriter, r *http.Request) {
+	clientKey := extractAPIKey(r)
+	if clientKey == "" {
+		writeJSONError(w, http.StatusUnauthorized, "missing API key")
+		return
+	}
+
+	provider, ok := s.statefulProvider()
+	if !ok {
+		writeJSONError(w, http.StatusServiceUnavailable, "no OpenAI-compatible provider configured")
+		return
+	}
+	target, err := url.Parse(provider.URL)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "invalid provider URL")
+		return
+	}
+
+	// The batch's model is only known from its input file, so creation is
+	// checked against policies that apply to all models.
+	creates := r.Method == http.MethodPost && strings.TrimRight(r.URL.Path, "/") == "/v1/batches"
+	if creates && !s.checkBudget(w, r, clientKey, "") {
+		return
+	}
+
+	rp := s.providerProxy(provider, target)
+	if strings.HasPrefix(r.URL.Path, "/v1/batches") {
+		rp.ModifyResponse = func(resp *http.Response) error {
+			if resp.StatusCode != http.StatusOK || resp.ContentLength > maxAssistantsBody {
+				return nil
+			}
+			body, err := io.ReadAll(io.LimitReader(resp.Body, maxAssistantsBody+1))
+			_ = resp.Body.Close()
+			if err != nil {
+				return err
+			}
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			if len(body) <= maxAssistantsBody {
+				s.inspectBatches(r, clientKey, provider.Name, body, creates)
+			}
+			return nil
+		}
+	}
+	rp.ServeHTTP(w, r)
+}
+
+// inspectBatches records a newly created batch, or attributes finished
+// batches in a fetched batch or batch list.
+func (s *Server) inspectBatches(r *http.Request, clientKey, provider string, body []byte, created bool) {
+	var obj struct {
+		Object string         `json:"object"`
+		Data   []models.Batch `json:"data"`
+	}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return
+	}
+	var batches []models.Batch
+	switch obj.Object {
+	case "batch":
+		var b models.Batch
+		if err := json.Unmarshal(body, &b); err == nil {
+			batches = append(batches, b)
+		}
+	case "list":
+		batches = obj.Data
+	}
+
+	if created {
+		for _, b := range batches {
+			if err := s.tracker.RecordBatch(r.Context(), s.batchJob(r, clientKey, provider, b)); err != nil {
+				log.Printf("batch record error: %v", err)
+			}
+		}
+		return
+	}
+
+	var finished []models.Batch
+	for _, b := range batches {
+		if b.Terminal() {
+			finished = append(finished, b)
+		}
+	}
+	if len(finished) == 0 {
+		return
+	}
+	jobs, err := s.tracker.PendingBatches(r.Context())
+	if err != nil {
+		log.Printf("batch lookup error: %v", err)
+		return
+	}
+	pending := make(map[string]models.BatchJob, len(jobs))
+	for _, j := range jobs {
+		pending[j.ID] = j
+	}
+	// Reading the output file can take a while; don't hold up the client.
+	ctx := context.WithoutCancel(r.Context())
+	for _, b := range finished {
+		job, ok := pending[b.ID]
+		if !ok {
+			continue
+		}
+		s.writes.Add(1)
+		go func() {
+			defer s.writes.Done()
+			s.attributeBatch(ctx, job, b)
+		}()
+	}
+}
+
+// batchJob returns the job for a batch created by r, with r's attribution.
+func (s *Server) batchJob(r *http.Request, clientKey, provider string, b models.Batch) models.BatchJob {
+	job := models.BatchJob{
+		ID:        b.ID,
+		Provider:  provider,
+		APIKey:    clientKey,
+		Endpoint:  b.Endpoint,
+		Labels:    s.labels.Labels(parseLabels(r.Header.Get("X-Pario-Labels"))),
+		Metadata:  s.resolveMetadata(r),
+		Status:    b.Status,
+		CreatedAt: time.Now().UTC(),
+	}
+	job.Team, job.Project, job.Env = s.resolveLabels(r, clientKey)
+	job.Pipeline, job.Branch, job.Commit = s.resolveBuild(r)
+	return job
+}
+
+// PollBatches checks pending batch jobs every interval until ctx is
+// cancelled, recording the usage of those that have finished.
+func (s *Server) PollBatches(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.pollBatches(ctx)
+		}
+	}
+}
+
+func (s *Server) pollBatches(ctx context.Context) {
+	jobs, err := s.tracker.PendingBatches(ctx)
+	if err != nil {
+		log.Printf("batch poll error: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		provider, ok := s.providerNamed(job.Provider)
+		if !ok {
+			continue
+		}
+		resp, err := getUpstream(ctx, provider, "/v1/batches/"+url.PathEscape(job.ID))
+		if err != nil {
+			log.Printf("batch poll %s: %v", job.ID, err)
+			continue
+		}
+		var b models.Batch
+		err = json.NewDecoder(resp.Body).Decode(&b)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || err != nil {
+			log.Printf("batch poll %s: status %d", job.ID, resp.StatusCode)
+			continue
+		}
+		if b.Terminal() {
+			s.attributeBatch(ctx, job, b)
+		}
+	}
+}
+
+// attributeBatch records a finished batch's usage against the job that
+// submitted it and marks the job finished. Usage comes from the batch
+// object or, when it doesn't report any, from the batch's output file.
+// The record is keyed by the batch ID, so attributing a batch twice stores
+// it once.
+func (s *Server) attributeBatch(ctx context.Context, job models.BatchJob, b models.Batch) {
+	usage, model := b.Usage, b.Model
+	if usage == nil && b.OutputFileID != "" {
+		provider, ok := s.providerNamed(job.Provider)
+		if !ok {
+			log.Printf("batch %s: provider %q is no longer configured", job.ID, job.Provider)
+			return
+		}
+		u, m, err := batchOutputUsage(ctx, provider, b.OutputFileID)
+		if err != nil {
+			// Left pending so the next poll tries again.
+			log.Printf("batch %s output: %v", job.ID, err)
+			return
+		}
+		usage = &u
+		if model == "" {
+			model = m
+		}
+	}
+
+	if usage != nil && usage.TotalTokens+usage.InputTokens+usage.OutputTokens > 0 {
+		total := usage.TotalTokens
+		if total == 0 {
+			total = usage.InputTokens + usage.OutputTokens
+		}
+		rec := models.UsageRecord{
+			RequestID:        b.ID,
+			Attempt:          1,
+			APIKey:           job.APIKey,
+			Model:            model,
+			Provider:         job.Provider,
+			PromptTokens:     usage.InputTokens,
+			CompletionTokens: usage.OutputTokens,
+			TotalTokens:      total,
+			Team:             job.Team,
+			Project:          job.Project,
+			Env:              job.Env,
+			Labels:           job.Labels,
+			Metadata:         job.Metadata,
+			Pipeline:         job.Pipeline,
+			Branch:           job.Branch,
+			Commit:           job.Commit,
+			Endpoint:         "batch",
+			CreatedAt:        time.Now().UTC(),
+		}
+		rec.EstimatedCostUSD = rec.Cost(s.pricing)
+		if err := s.tracker.Record(ctx, rec); err != nil {
+			log.Printf("batch usage record error: %v", err)
+			return
+		}
+	}
+	if err := s.tracker.FinishBatch(ctx, job.ID, b.Status, time.Now().UTC()); err != nil {
+		log.Printf("batch finish error: %v", err)
+	}
+}
+
+// batchOutputUsage totals the usage of the responses in a batch output
+// file and returns the model they report.
+func batchOutputUsage(ctx context.Context, provider config.ProviderConfig, fileID string) (models.BatchUsage, string, error) {
+	var total models.BatchUsage
+	resp, err := getUpstream(ctx, provider, "/v1/files/"+url.PathEscape(fileID)+"/content")
+	if err != nil {
+		return total, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return total, "", fmt.Errorf("fetch output file: status %d", resp.StatusCode)
+	}
+
+	var model string
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 0, 64<<10), maxBatchOutputLine)
+	for sc.Scan() {
+		var line struct {
+			Response *struct {
+				Body struct {
+					Model string `json:"model"`
+					Usage *struct {
+						PromptTokens     int `json:"prompt_tokens"`
+						CompletionTokens int `json:"completion_tokens"`
+						InputTokens      int `json:"input_tokens"`
+						OutputTokens     int `json:"output_tokens"`
+						TotalTokens      int `json:"total_tokens"`
+					} `json:"usage"`
+				} `json:"body"`
+			} `json:"response"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil || line.Response == nil {
+			continue
+		}
+		body := line.Response.Body
+		if model == "" {
+			model = body.Model
+		}
+		if u := body.Usage; u != nil {
+			// Chat completions and embeddings report prompt/completion
+			// tokens; the Responses API reports input/output tokens.
+			total.InputTokens += u.PromptTokens + u.InputTokens
+			total.OutputTokens += u.CompletionTokens + u.OutputTokens
+			total.TotalTokens += u.TotalTokens
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return total, "", fmt.Errorf("read output file: %w", err)
+	}
+	return total, model, nil
+}
+
+// providerNamed returns the configured provider with the given name.
+func (s *Server) providerNamed(name string) (config.ProviderConfig, bool) {
+	for _, p := range s.cfg.Providers {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return config.ProviderConfig{}, false
+}
+
+// getUpstream sends an authenticated GET for path to provider. The caller
+// closes the response body.
+func getUpstream(ctx context.Context, provider config.ProviderConfig, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(provider.URL, "/")+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	setProviderHeaders(req, provider)
+	req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+	return clientFor(provider).doStream(req)
+}
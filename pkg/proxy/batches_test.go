@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchAttribution(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-provider" {
+			t.Error("expected provider API key in upstream request")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/files":
+			fmt.Fprint(w, `{"id":"file-in","object":"file","purpose":"batch"}`)
+		case "POST /v1/batches":
+			id := "batch_1"
+			if strings.Contains(r.Header.Get("X-Pario-Team"), "ml") {
+				id = "batch_2"
+			}
+			fmt.Fprintf(w, `{"id":%q,"object":"batch","endpoint":"/v1/chat/completions","status":"validating"}`, id)
+		case "GET /v1/batches/batch_1":
+			// Older API versions report no usage; it comes from the output file.
+			fmt.Fprint(w, `{"id":"batch_1","object":"batch","status":"completed","output_file_id":"file-out"}`)
+		case "GET /v1/batches/batch_2":
+			fmt.Fprint(w, `{"id":"batch_2","object":"batch","status":"completed","model":"gpt-4o-mini","usage":{"input_tokens":300,"output_tokens":30,"total_tokens":330}}`)
+		case "GET /v1/files/file-out/content":
+			fmt.Fprintln(w, `{"custom_id":"a","response":{"status_code":200,"body":{"model":"gpt-4o","usage":{"prompt_tokens":100,"completion_tokens":20,"total_tokens":120}}}}`)
+			fmt.Fprintln(w, `{"custom_id":"b","response":{"status_code":200,"body":{"model":"gpt-4o","usage":{"prompt_tokens":50,"completion_tokens":5,"total_tokens":55}}}}`)
+			fmt.Fprintln(w, `{"custom_id":"c","response":null,"error":{"code":"invalid"}}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	ctx := context.Background()
+
+	send := func(method, path, team string) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"input_file_id":"file-in","endpoint":"/v1/chat/completions","completion_window":"24h"}`))
+		req.Header.Set("Authorization", "Bearer client-key")
+		if team != "" {
+			req.Header.Set("X-Pario-Team", team)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: status = %d", method, path, w.Code)
+		}
+	}
+	send(http.MethodPost, "/v1/files", "")
+	send(http.MethodPost, "/v1/batches", "search")
+	send(http.MethodPost, "/v1/batches", "ml")
+
+	jobs, err := srv.tracker.PendingBatches(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].Team != "search" || jobs[1].Team != "ml" {
+		t.Fatalf("pending jobs = %+v", jobs)
+	}
+
+	// batch_2 is attributed when the client fetches it, batch_1 by the poller.
+	send(http.MethodGet, "/v1/batches/batch_2", "")
+	srv.writes.Wait()
+	srv.pollBatches(ctx)
+	srv.pollBatches(ctx)
+
+	if jobs, _ := srv.tracker.PendingBatches(ctx); len(jobs) != 0 {
+		t.Errorf("still pending: %+v", jobs)
+	}
+	recs, err := srv.tracker.QueryByKey(ctx, "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(recs))
+	}
+	want := map[string]struct {
+		team, model               string
+		prompt, completion, total int
+	}{
+		"batch_1": {"search", "gpt-4o", 150, 25, 175},
+		"batch_2": {"ml", "gpt-4o-mini", 300, 30, 330},
+	}
+	for _, r := range recs {
+		w, ok := want[r.RequestID]
+		if !ok || r.Team != w.team || r.Model != w.model || r.Endpoint != "batch" ||
+			r.PromptTokens != w.prompt || r.CompletionTokens != w.completion || r.TotalTokens != w.total {
+			t.Errorf("record = %+v", r)
+		}
+	}
+}
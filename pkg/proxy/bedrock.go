@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pario-ai/pario/pkg/providers/bedrock"
+	"github.com/pario-ai/pario/pkg/router"
+	"github.com/pario-ai/pario/pkg/sigv4"
+)
+
+// isBedrock reports whether route's provider is AWS Bedrock.
+func isBedrock(route router.Route) bool {
+	return route.Provider.Type == "bedrock"
+}
+
+// withoutBedrock drops Bedrock routes, which only serve Messages requests.
+func withoutBedrock(routes []router.Route) []router.Route {
+	kept := routes[:0:0]
+	for _, r := range routes {
+		if !isBedrock(r) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// doMessagesRequest sends an Anthropic Messages request to route's provider,
+// translating it to InvokeModel for Bedrock and rawPredict for Vertex.
+func doMessagesRequest(ctx context.Context, route router.Route, headers map[string]string, body []byte) (*upstreamResult, error) {
+	if isVertex(route) {
+		target, vheaders, payload, err := vertexMessages(ctx, route, headers, body, false)
+		if err != nil {
+			return nil, err
+		}
+		return doUpstreamRequest(ctx, route.Provider, target, "", "application/json", vheaders, payload)
+	}
+	if !isBedrock(route) {
+		return doUpstreamRequest(ctx, route.Provider, route.Provider.URL, "/v1/messages", "application/json", headers, body)
+	}
+	resp, err := doBedrockRequest(ctx, route, body, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	return &upstreamResult{statusCode: resp.StatusCode, body: respBody, header: resp.Header}, nil
+}
+
+// doMessagesStreamRequest is doMessagesRequest for streaming requests. A
+// successful Bedrock response body is converted to Anthropic SSE; Vertex
+// streams Anthropic SSE natively.
+func doMessagesStreamRequest(ctx context.Context, route router.Route, headers map[string]string, body []byte) (*http.Response, error) {
+	if isVertex(route) {
+		target, vheaders, payload, err := vertexMessages(ctx, route, headers, body, true)
+		if err != nil {
+			return nil, err
+		}
+		return doUpstreamStreamRequest(ctx, route.Provider, target, "", "application/json", vheaders, payload)
+	}
+	if !isBedrock(route) {
+		return doUpstreamStreamRequest(ctx, route.Provider, route.Provider.URL, "/v1/messages", "application/json", headers, body)
+	}
+	resp, err := doBedrockRequest(ctx, route, body, true)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		resp.Body = bedrock.NewSSEReader(resp.Body)
+		resp.Header.Set("Content-Type", "text/event-stream")
+		resp.Header.Del("Content-Length")
+	}
+	return resp, nil
+}
+
+// doBedrockRequest signs and sends an InvokeModel request with credentials
+// from the AWS environment variables.
+func doBedrockRequest(ctx context.Context, route router.Route, body []byte, stream bool) (*http.Response, error) {
+	creds, err := sigv4.FromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("bedrock credentials: %w", err)
+	}
+	payload, err := bedrock.TranslateRequest(body)
+	if err != nil {
+		return nil, err
+	}
+	base := route.Provider.URL
+	if base == "" {
+		base = bedrock.Endpoint(route.Provider.Region)
+	}
+	req, err := bedrock.NewRequest(ctx, base, route.Provider.Region, route.Model, payload, stream, creds)
+	if err != nil {
+		return nil, err
+	}
+	// Headers outside the signature are allowed; signed ones must not change.
+	signed := req.Header.Clone()
+	setUpstreamHeaders(req)
+	setProviderHeaders(req, route.Provider)
+	for k, v := range signed {
+		req.Header[k] = v
+	}
+	if stream {
+		return clientFor(route.Provider).doStream(req)
+	}
+	return clientFor(route.Provider).buffered.Do(req)
+}
+
+// defaultModel returns the model a response reported, falling back to the
+// route's model for providers such as Bedrock whose responses may omit it.
+func defaultModel(model string, route router.Route) string {
+	if model == "" {
+		return route.Model
+	}
+	return model
+}
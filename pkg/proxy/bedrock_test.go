@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBedrockMessages(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	const model = "anthropic.claude-3-haiku-20240307-v1:0"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.EscapedPath(); got != "/model/anthropic.claude-3-haiku-20240307-v1%3A0/invoke" {
+			t.Errorf("path = %q", got)
+		}
+		if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") {
+			t.Errorf("Authorization = %q", auth)
+		}
+		var body map[string]any
+		b, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := body["model"]; ok || body["anthropic_version"] != "bedrock-2023-05-31" {
+			t.Errorf("untranslated body: %s", b)
+		}
+		// Bedrock responses may omit the model.
+		w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"hi"}],"usage":{"input_tokens":12,"output_tokens":8}}`))
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Providers[0].Type = "bedrock"
+	srv.cfg.Providers[0].Region = "us-east-1"
+
+	body := `{"model":"` + model + `","messages":[{"role":"user","content":"hi"}],"max_tokens":64}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	req.Header.Set("x-api-key", "client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].Model != model || recs[0].TotalTokens != 20 {
+		t.Errorf("records = %+v", recs)
+	}
+}
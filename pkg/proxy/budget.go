@@ -0,0 +1,200 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/budget"
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// checkBudget enforces rate limits and budget policies for a request,
+// writing the error response and returning false when it must not proceed.
+func (s *Server) checkBudget(w http.ResponseWriter, r *http.Request, clientKey, model string) bool {
+	if !s.checkRateLimit(w, r, clientKey, model) {
+		return false
+	}
+	if s.enforcer == nil {
+		return true
+	}
+	release, headroom, err := s.enforcer.Admit(s.budgetContext(r, clientKey), requestIDFrom(r.Context()), clientKey, model, s.priority(r, clientKey))
+	if err != nil {
+		switch {
+		case errors.Is(err, budget.ErrBudgetExceeded):
+			writeBudgetExceeded(w, err)
+		case errors.Is(err, budget.ErrQueueFull):
+			writeError(w, http.StatusTooManyRequests, errorDetail{
+				Message: "token budget exceeded: budget queue full", Reason: reasonBudgetQueueFull})
+		case errors.Is(err, budget.ErrLowPriorityShed):
+			writeError(w, http.StatusTooManyRequests, errorDetail{
+				Message: "token budget nearly exhausted: low-priority request shed", Reason: reasonLowPriorityShed})
+		case r.Context().Err() != nil:
+			// The client went away while queued; nothing useful to write.
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "budget check failed")
+		}
+		return false
+	}
+	if holder, ok := r.Context().Value(budgetSlotKey{}).(*func()); ok {
+		*holder = release
+	} else {
+		release()
+	}
+	if h := headroomFrom(r.Context()); h != nil {
+		h.status = headroom
+	}
+	return true
+}
+
+// headroomKey is the context key for the request's *budgetHeadroom.
+type headroomKey struct{}
+
+// budgetHeadroom carries a request's remaining budget from its check to
+// its response: the status of the most restrictive policy at admission,
+// and the usage recorded for the request since.
+type budgetHeadroom struct {
+	status *models.BudgetStatus
+	tokens int64
+	usd    float64
+}
+
+func headroomFrom(ctx context.Context) *budgetHeadroom {
+	h, _ := ctx.Value(headroomKey{}).(*budgetHeadroom)
+	return h
+}
+
+// noteSpend adds a usage record to the request's budget headroom.
+func (s *Server) noteSpend(r *http.Request, rec models.UsageRecord) {
+	h := headroomFrom(r.Context())
+	if h == nil {
+		return
+	}
+	h.tokens += int64(rec.TotalTokens)
+	h.usd += rec.EstimatedCostUSD
+}
+
+// headroomWriter sets the remaining-budget headers when the response
+// starts, so they count the usage recorded for the request by then: all
+// of it for a buffered response, none for a stream.
+type headroomWriter struct {
+	http.ResponseWriter
+	h    *budgetHeadroom
+	sent bool
+}
+
+func (w *headroomWriter) WriteHeader(code int) {
+	w.setHeaders()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *headroomWriter) Write(b []byte) (int, error) {
+	w.setHeaders()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *headroomWriter) Flush() {
+	w.setHeaders()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *headroomWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *headroomWriter) setHeaders() {
+	if w.sent {
+		return
+	}
+	w.sent = true
+	if w.h.status != nil {
+		setBudgetHeaders(w.Header(), *w.h.status, w.h.tokens, w.h.usd)
+	}
+}
+
+// setBudgetHeaders tells the client how much of its most restrictive
+// budget policy is left after the request's usage, so agents can throttle
+// themselves before a 429. Spend limits are reported in USD when they are
+// closer than the token limit.
+func setBudgetHeaders(h http.Header, st models.BudgetStatus, tokens int64, usd float64) {
+	p := st.Policy
+	st.Used += tokens
+	st.Remaining = max(p.MaxTokens-st.Used, 0)
+	if p.MaxCostUSD > 0 {
+		st.UsedUSD += usd
+		st.RemainingUSD = max(p.MaxCostUSD-st.UsedUSD, 0)
+	}
+	if p.MaxCostUSD > 0 && (!p.LimitsTokens() || st.UsedUSD/p.MaxCostUSD > float64(st.Used)/float64(p.MaxTokens)) {
+		usd := func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) }
+		h.Set("X-Pario-Budget-Unit", "usd")
+		h.Set("X-Pario-Budget-Limit", usd(p.MaxCostUSD))
+		h.Set("X-Pario-Budget-Used", usd(st.UsedUSD))
+		h.Set("X-Pario-Budget-Remaining", usd(st.RemainingUSD))
+	} else {
+		h.Set("X-Pario-Budget-Unit", "tokens")
+		h.Set("X-Pario-Budget-Limit", strconv.FormatInt(p.MaxTokens, 10))
+		h.Set("X-Pario-Budget-Used", strconv.FormatInt(st.Used, 10))
+		h.Set("X-Pario-Budget-Remaining", strconv.FormatInt(st.Remaining, 10))
+	}
+	h.Set("X-Pario-Budget-Reset", strconv.Itoa(max(1, int(math.Ceil(time.Until(st.PeriodEnd).Seconds())))))
+}
+
+// writeBudgetExceeded writes the 429 for a request over a budget policy,
+// using the policy's message and help_url when set. Retry-After gives the
+// seconds until the policy's period resets.
+func writeBudgetExceeded(w http.ResponseWriter, err error) {
+	d := errorDetail{Message: "token budget exceeded", Reason: reasonBudgetExceeded}
+	var exceeded *budget.ExceededError
+	if errors.As(err, &exceeded) {
+		if exceeded.Policy.Message != "" {
+			d.Message = exceeded.Policy.Message
+		}
+		d.HelpURL = exceeded.Policy.HelpURL
+		if !exceeded.ResetsAt.IsZero() {
+			secs := max(1, int(math.Ceil(time.Until(exceeded.ResetsAt).Seconds())))
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+		}
+	}
+	writeError(w, http.StatusTooManyRequests, d)
+}
+
+// budgetContext returns the request's context with its attribution labels
+// attached, for label-scoped budget policies.
+func (s *Server) budgetContext(r *http.Request, clientKey string) context.Context {
+	team, project, env := s.resolveLabels(r, clientKey)
+	return budget.ContextWithLabels(r.Context(), models.CostLabel{Team: team, Project: project, Env: env})
+}
+
+// withBudgetHints returns r with what the budget check needs to know from
+// a chat completions or messages request: its max_tokens, reserved so
+// concurrent requests of a key can't all pass the check before any of
+// them is recorded, and whether model's route can downgrade it.
+func (s *Server) withBudgetHints(r *http.Request, model string, body []byte) *http.Request {
+	ctx := r.Context()
+	if n := requestHints(body).CompletionTokens; n > 0 {
+		ctx = budget.ContextWithReservation(ctx, int64(n))
+	}
+	if s.router.Downgradable(model) {
+		ctx = budget.ContextWithDowngrade(ctx)
+	}
+	return r.WithContext(ctx)
+}
+
+// budgetSlotKey is the context key for the release of the request's place
+// in its key's budget queue. ServeHTTP releases it once the handler, and so
+// usage recording, is done.
+type budgetSlotKey struct{}
+
+// releaseBudgetSlot gives up the request's place in its key's budget queue
+// early.
+func releaseBudgetSlot(r *http.Request) {
+	if holder, ok := r.Context().Value(budgetSlotKey{}).(*func()); ok {
+		(*holder)()
+		*holder = func() {}
+	}
+}
@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/budget"
+	"github.com/pario-ai/pario/pkg/canary"
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/router"
+)
+
+// stagedConfig is a reloaded config under canary evaluation.
+type stagedConfig struct {
+	cfg      *config.Config
+	router   *router.Router
+	enforcer *budget.Enforcer
+	canary   *canary.Canary
+	settled  bool // guarded by Server.canaryMu
+}
+
+// StageConfig applies the routes, providers, and budget policies of a
+// reloaded config. With canary.duration set, the new config is first
+// shadow-evaluated against live requests and only promoted if it doesn't
+// fail to route or reject noticeably more of them; otherwise it is
+// discarded with an alert. Staging a config supersedes any canary still
+// running. Other settings (listeners, stores, queue limits) need a restart.
+func (s *Server) StageConfig(cfg *config.Config) {
+	if s.enforcer == nil && cfg.Budget.Enabled {
+		log.Printf("config reload: budget.enabled changed; budget enforcement starts after a restart")
+	}
+
+	s.canaryMu.Lock()
+	if prev := s.staged; prev != nil && !prev.settled {
+		prev.settled = true
+		prev.canary.Abort("superseded by a newer config", time.Now())
+	}
+	if cfg.Canary.Duration <= 0 {
+		s.staged = nil
+		s.canaryMu.Unlock()
+		s.promote(cfg)
+		log.Printf("config reload: applied routing and budget changes")
+		return
+	}
+
+	st := &stagedConfig{
+		cfg:    cfg,
+		router: router.New(cfg),
+		canary: canary.New(canary.Thresholds{
+			Duration:                 cfg.Canary.Duration,
+			MinRequests:              cfg.Canary.MinRequests,
+			MaxErrorRateIncrease:     cfg.Canary.MaxErrorRateIncrease,
+			MaxRejectionRateIncrease: cfg.Canary.MaxRejectionRateIncrease,
+		}, time.Now()),
+	}
+	if s.enforcer != nil {
+		st.enforcer = budget.New(budgetPolicies(cfg), s.tracker, budget.WithLocation(cfg.KeyLocation), budget.WithPricing(cfg.Pricing()))
+		st.enforcer.SetManaged(s.enforcer.Managed())
+	}
+	s.staged = st
+	s.canaryMu.Unlock()
+
+	log.Printf("config reload: canary started for %s", cfg.Canary.Duration)
+	time.AfterFunc(cfg.Canary.Duration, func() {
+		s.settle(st, st.canary.Check(time.Now()))
+	})
+}
+
+// CanaryStatus returns the state of the most recent canary, if any.
+func (s *Server) CanaryStatus() (canary.Status, bool) {
+	s.canaryMu.Lock()
+	defer s.canaryMu.Unlock()
+	if s.staged == nil {
+		return canary.Status{}, false
+	}
+	return s.staged.canary.Status(), true
+}
+
+// shadow evaluates a request against both the live and the staged config
+// in the background. It does nothing when no canary is running.
+func (s *Server) shadow(r *http.Request, clientKey, model string) {
+	s.canaryMu.Lock()
+	st := s.staged
+	running := st != nil && !st.settled
+	s.canaryMu.Unlock()
+	if !running {
+		return
+	}
+
+	// The request may finish first, so keep only its labels.
+	labeled := context.WithoutCancel(s.budgetContext(r, clientKey))
+	go func() {
+		ctx, cancel := context.WithTimeout(labeled, 5*time.Second)
+		defer cancel()
+		live := evaluate(ctx, s.router, s.enforcer, clientKey, model)
+		cand := evaluate(ctx, st.router, st.enforcer, clientKey, model)
+		s.settle(st, st.canary.Observe(live, cand, time.Now()))
+	}()
+}
+
+// evaluate reports how a router and enforcer would treat a request,
+// without sending it anywhere.
+func evaluate(ctx context.Context, rt *router.Router, e *budget.Enforcer, clientKey, model string) canary.Outcome {
+	var o canary.Outcome
+	if _, err := rt.Resolve(model); err != nil {
+		o.Error = true
+	}
+	if e != nil {
+		if err := e.Check(ctx, clientKey, model); errors.Is(err, budget.ErrBudgetExceeded) {
+			o.Rejected = true
+		}
+	}
+	return o
+}
+
+// settle acts on a canary verdict once.
+func (s *Server) settle(st *stagedConfig, state canary.State) {
+	if state == canary.Evaluating {
+		return
+	}
+	s.canaryMu.Lock()
+	if st.settled {
+		s.canaryMu.Unlock()
+		return
+	}
+	st.settled = true
+	s.canaryMu.Unlock()
+
+	switch state {
+	case canary.Promoted:
+		s.promote(st.cfg)
+		log.Printf("config reload: canary passed, applied routing and budget changes")
+	case canary.RolledBack:
+		log.Printf("ALERT config reload: canary rolled back, keeping previous config: %s", st.canary.Status().Reason)
+	}
+}
+
+// promote makes cfg's routes and budget policies live.
+func (s *Server) promote(cfg *config.Config) {
+	s.router.Update(cfg)
+	if s.enforcer != nil {
+		s.enforcer.SetPolicies(budgetPolicies(cfg))
+	}
+}
+
+func budgetPolicies(cfg *config.Config) []models.BudgetPolicy {
+	if !cfg.Budget.Enabled {
+		return nil
+	}
+	return cfg.Budget.Policies
+}
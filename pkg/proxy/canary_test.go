@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/canary"
+	"github.com/pario-ai/pario/pkg/config"
+)
+
+// reloadedConfig returns a copy of srv's config whose gpt-4 route targets
+// the given provider.
+func reloadedConfig(srv *Server, provider string, cn config.CanaryConfig) *config.Config {
+	cfg := *srv.cfg
+	cfg.Router.Routes = []config.RouteConfig{{
+		Model:   "gpt-4",
+		Targets: []config.RouteTarget{{Provider: provider, Model: "gpt-4o"}},
+	}}
+	cfg.Canary = cn
+	return &cfg
+}
+
+func waitCanary(t *testing.T, srv *Server, want canary.State) canary.Status {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if st, ok := srv.CanaryStatus(); ok && st.State == want {
+			return st
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	st, _ := srv.CanaryStatus()
+	t.Fatalf("canary did not reach %s: %+v", want, st)
+	return st
+}
+
+func routedModel(t *testing.T, srv *Server) string {
+	t.Helper()
+	routes, err := srv.router.Resolve("gpt-4")
+	if err != nil {
+		return ""
+	}
+	return routes[0].Model
+}
+
+func sendChat(srv *Server, content string) {
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"` + content + `"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestStageConfigImmediate(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+	srv := setupProxy(t, upstream)
+
+	srv.StageConfig(reloadedConfig(srv, "test", config.CanaryConfig{}))
+	if got := routedModel(t, srv); got != "gpt-4o" {
+		t.Errorf("expected reload applied immediately, got model %q", got)
+	}
+	if _, ok := srv.CanaryStatus(); ok {
+		t.Error("expected no canary without canary.duration")
+	}
+}
+
+func TestCanaryRollback(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+	srv := setupProxy(t, upstream)
+
+	// The reloaded route names a provider that doesn't exist.
+	srv.StageConfig(reloadedConfig(srv, "typo", config.CanaryConfig{Duration: time.Hour, MinRequests: 2}))
+	sendChat(srv, "one")
+	sendChat(srv, "two")
+
+	st := waitCanary(t, srv, canary.RolledBack)
+	if st.Candidate.Errors == 0 || !strings.Contains(st.Reason, "routing error") {
+		t.Errorf("unexpected rollback status: %+v", st)
+	}
+	if got := routedModel(t, srv); got != "gpt-4" {
+		t.Errorf("expected live config kept, got model %q", got)
+	}
+}
+
+func TestCanaryPromote(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+	srv := setupProxy(t, upstream)
+
+	srv.StageConfig(reloadedConfig(srv, "test", config.CanaryConfig{Duration: 50 * time.Millisecond, MinRequests: 1}))
+	if got := routedModel(t, srv); got != "gpt-4" {
+		t.Fatalf("expected live config during canary, got model %q", got)
+	}
+	sendChat(srv, "hi")
+
+	waitCanary(t, srv, canary.Promoted)
+	if got := routedModel(t, srv); got != "gpt-4o" {
+		t.Errorf("expected promoted route, got model %q", got)
+	}
+}
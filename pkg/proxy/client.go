@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+)
+
+// Upstream timeouts for providers that don't configure their own. They are
+// generous: long generations from reasoning models can take minutes.
+const (
+	defaultUpstreamTimeout   = 10 * time.Minute
+	defaultConnectTimeout    = 10 * time.Second
+	defaultStreamIdleTimeout = 2 * time.Minute
+)
+
+// upstreamTimeouts returns p's timeouts with defaults filled in.
+func upstreamTimeouts(p config.ProviderConfig) (timeout, connect, idle time.Duration) {
+	timeout, connect, idle = p.Timeout, p.ConnectTimeout, p.StreamIdleTimeout
+	if timeout == 0 {
+		timeout = defaultUpstreamTimeout
+	}
+	if connect == 0 {
+		connect = defaultConnectTimeout
+	}
+	if idle == 0 {
+		idle = defaultStreamIdleTimeout
+	}
+	return timeout, connect, idle
+}
+
+// providerClient holds the HTTP clients for one provider. Both share a
+// transport, and so its connection pool.
+type providerClient struct {
+	// buffered is bounded by the provider's total timeout.
+	buffered *http.Client
+	// stream only bounds the wait for response headers; the body is bounded
+	// by idle between reads.
+	stream *http.Client
+	idle   time.Duration
+}
+
+// clientKey identifies the settings a providerClient is built from, so a
+// reloaded provider with new timeouts gets new clients.
+type clientKey struct {
+	name                   string
+	timeout, connect, idle time.Duration
+	proxy                  string
+	tls                    config.ProviderTLS
+}
+
+var (
+	clientsMu sync.Mutex
+	clients   = map[clientKey]*providerClient{}
+)
+
+// clientFor returns the HTTP clients for provider p.
+func clientFor(p config.ProviderConfig) *providerClient {
+	timeout, connect, idle := upstreamTimeouts(p)
+	key := clientKey{name: p.Name, timeout: timeout, connect: connect, idle: idle, proxy: p.Proxy, tls: p.TLS}
+
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if c, ok := clients[key]; ok {
+		return c
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{Timeout: connect, KeepAlive: 30 * time.Second}).DialContext
+	t.TLSHandshakeTimeout = connect
+	t.ResponseHeaderTimeout = timeout
+	if p.Proxy != "" {
+		// Validated at config load; the environment's proxy applies otherwise.
+		if u, err := url.Parse(p.Proxy); err == nil {
+			t.Proxy = http.ProxyURL(u)
+		}
+	}
+	// Also validated at config load, so an error here means a certificate
+	// file changed since; fail the provider's requests rather than silently
+	// dropping the client certificate.
+	if tc, err := p.TLS.Config(); err != nil {
+		t.DialTLSContext = func(context.Context, string, string) (net.Conn, error) {
+			return nil, fmt.Errorf("provider %s: %w", p.Name, err)
+		}
+	} else if tc != nil {
+		t.TLSClientConfig = tc
+	}
+	rt := errorTransport{RoundTripper: t, provider: p.Name}
+	c := &providerClient{
+		buffered: &http.Client{Transport: rt, Timeout: timeout},
+		stream:   &http.Client{Transport: rt},
+		idle:     idle,
+	}
+	clients[key] = c
+	return c
+}
+
+// doStream sends a streaming request. The response body fails once no data
+// arrives for the client's idle timeout.
+func (c *providerClient) doStream(req *http.Request) (*http.Response, error) {
+	resp, err := c.stream.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = newIdleTimeoutBody(resp.Body, c.idle)
+	return resp, nil
+}
+
+// errStreamIdle is returned by reads of a stream that went idle.
+var errStreamIdle = errors.New("upstream stream idle timeout")
+
+// idleTimeoutBody closes a response body once no read completes for idle.
+type idleTimeoutBody struct {
+	io.ReadCloser
+	idle  time.Duration
+	timer *time.Timer
+
+	mu      sync.Mutex
+	expired bool
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, idle time.Duration) *idleTimeoutBody {
+	b := &idleTimeoutBody{ReadCloser: body, idle: idle}
+	b.timer = time.AfterFunc(idle, b.expire)
+	return b
+}
+
+func (b *idleTimeoutBody) expire() {
+	b.mu.Lock()
+	b.expired = true
+	b.mu.Unlock()
+	_ = b.ReadCloser.Close()
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.idle)
+	}
+	if err != nil && err != io.EOF {
+		b.mu.Lock()
+		expired := b.expired
+		b.mu.Unlock()
+		if expired {
+			return n, errStreamIdle
+		}
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/tracker"
+)
+
+func TestProviderTimeoutFallsThrough(t *testing.T) {
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer hung.Close()
+	defer close(release)
+	healthy := newUpstream()
+	defer healthy.Close()
+
+	dir := t.TempDir()
+	tr, _ := tracker.New(filepath.Join(dir, "tracker.db"))
+	defer func() { _ = tr.Close() }()
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "hung", URL: hung.URL, APIKey: "sk-hung", Timeout: 50 * time.Millisecond},
+			{Name: "healthy", URL: healthy.URL, APIKey: "sk-healthy"},
+		},
+		Router: config.RouterConfig{Routes: []config.RouteConfig{{
+			Model: "gpt-4",
+			Targets: []config.RouteTarget{
+				{Provider: "hung", Model: "gpt-4"},
+				{Provider: "healthy", Model: "gpt-4"},
+			},
+		}}},
+	}
+	srv := New(cfg, tr, nil, nil, nil)
+
+	start := time.Now()
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from the fallback, got %d: %s", w.Code, w.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("request took %v; the hung provider wasn't timed out", elapsed)
+	}
+}
+
+func TestStreamIdleTimeout(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"1\",\"model\":\"gpt-4\",\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	dir := t.TempDir()
+	tr, _ := tracker.New(filepath.Join(dir, "tracker.db"))
+	defer func() { _ = tr.Close() }()
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "test", URL: upstream.URL, APIKey: "sk-provider", StreamIdleTimeout: 50 * time.Millisecond},
+		},
+	}
+	srv := New(cfg, tr, nil, nil, nil)
+
+	start := time.Now()
+	body := `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("stream took %v; the idle timeout didn't end it", elapsed)
+	}
+	if !strings.Contains(w.Body.String(), `"Hi"`) {
+		t.Errorf("expected the chunk sent before the stall to be relayed, got %q", w.Body.String())
+	}
+}
+
+func TestUpstreamTimeoutDefaults(t *testing.T) {
+	timeout, connect, idle := upstreamTimeouts(config.ProviderConfig{ConnectTimeout: time.Second})
+	if timeout != defaultUpstreamTimeout || connect != time.Second || idle != defaultStreamIdleTimeout {
+		t.Errorf("got %v, %v, %v", timeout, connect, idle)
+	}
+	a := clientFor(config.ProviderConfig{Name: "p", Timeout: time.Second})
+	if b := clientFor(config.ProviderConfig{Name: "p", Timeout: time.Second}); a != b {
+		t.Error("same settings should share a client")
+	}
+	if c := clientFor(config.ProviderConfig{Name: "p", Timeout: 2 * time.Second}); a == c {
+		t.Error("changed timeouts should get a new client")
+	}
+}
+
+func TestProviderHeaders(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		writeChatResponse(w)
+	}))
+	defer upstream.Close()
+
+	tr, _ := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	defer func() { _ = tr.Close() }()
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{
+			Name:   "gateway",
+			URL:    upstream.URL,
+			APIKey: "sk-provider",
+			Headers: map[string]string{
+				"OpenAI-Organization": "org-acme",
+				"X-Gateway-Token":     "gw-secret",
+				"Authorization":       "Bearer not-the-key",
+			},
+		}},
+	}
+	srv := New(cfg, tr, nil, nil, nil)
+
+	for _, path := range []string{"/v1/chat/completions", "/v1/moderations"} {
+		got = nil
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		srv.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got.Get("OpenAI-Organization") != "org-acme" || got.Get("X-Gateway-Token") != "gw-secret" {
+			t.Errorf("%s: provider headers missing upstream: %v", path, got)
+		}
+		if got.Get("Authorization") != "Bearer sk-provider" {
+			t.Errorf("%s: Authorization = %q, provider credentials must win", path, got.Get("Authorization"))
+		}
+	}
+}
+
+// writePEM writes blocks of the given type to a new file in dir.
+func writePEM(t *testing.T, dir, name, typ string, der ...[]byte) string {
+	t.Helper()
+	var out []byte
+	for _, b := range der {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b})...)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, out, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newClientCert returns a CA and a client certificate it signed.
+func newClientCert(t *testing.T) (ca *x509.Certificate, certDER, keyDER []byte) {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ = x509.ParseCertificate(caDER)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "pario"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err = x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ = x509.MarshalECPrivateKey(key)
+	return ca, certDER, keyDER
+}
+
+func TestProviderMTLS(t *testing.T) {
+	ca, certDER, keyDER := newClientCert(t)
+	plain := newUpstream()
+	plain.Close()
+	upstream := httptest.NewUnstartedServer(plain.Config.Handler)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	upstream.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	serverCA := writePEM(t, dir, "server-ca.pem", "CERTIFICATE", upstream.Certificate().Raw)
+	certFile := writePEM(t, dir, "client.pem", "CERTIFICATE", certDER)
+	keyFile := writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyDER)
+
+	tests := []struct {
+		name string
+		tls  config.ProviderTLS
+		want int
+	}{
+		{"client certificate", config.ProviderTLS{CertFile: certFile, KeyFile: keyFile, CAFile: serverCA}, http.StatusOK},
+		{"no client certificate", config.ProviderTLS{CAFile: serverCA}, http.StatusBadGateway},
+		{"untrusted server", config.ProviderTLS{CertFile: certFile, KeyFile: keyFile}, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, _ := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+			defer func() { _ = tr.Close() }()
+			cfg := &config.Config{
+				Providers: []config.ProviderConfig{{Name: "gateway-" + tt.name, URL: upstream.URL, APIKey: "sk", TLS: tt.tls}},
+			}
+			srv := New(cfg, tr, nil, nil, nil)
+
+			body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer client-key")
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
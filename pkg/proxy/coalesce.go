@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+
+	"github.com/pario-ai/pario/pkg/middleware"
+)
+
+// coalescer dedupes concurrent identical non-streaming requests: the first
+// one goes upstream and the rest wait for its response instead of paying
+// for the same completion again.
+type coalescer struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is one upstream call that identical requests wait on.
+type flight struct {
+	done chan struct{}
+	// body is the leader's successful response, or nil if it failed.
+	body []byte
+}
+
+// join returns the flight in progress for key, or starts one with the
+// caller as its leader.
+func (c *coalescer) join(key string) (f *flight, leader bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.flights[key]; ok {
+		return f, false
+	}
+	if c.flights == nil {
+		c.flights = make(map[string]*flight)
+	}
+	f = &flight{done: make(chan struct{})}
+	c.flights[key] = f
+	return f, true
+}
+
+// land ends the flight for key, handing body to its waiters.
+func (c *coalescer) land(key string, f *flight, body []byte) {
+	c.mu.Lock()
+	delete(c.flights, key)
+	c.mu.Unlock()
+	f.body = body
+	close(f.done)
+}
+
+// coalesce joins the request to an identical one from the same client key
+// already in flight: same endpoint and byte-for-byte the same reqBody. The
+// cache key is too loose for this, since it ignores max_tokens, sampling
+// parameters, and the system prompt. If there is one it waits for it and
+// writes its response with X-Pario-Cache: coalesced, returning handled.
+// Otherwise the request leads the flight: it must go upstream itself and
+// call done with its response body once it succeeds, or nil if it fails, in
+// which case one of the waiters takes over. With coalescing off, done is a
+// no-op. Callers check rate limits and budgets first, since a waiter's
+// response isn't recorded as usage.
+func (s *Server) coalesce(w http.ResponseWriter, r *http.Request, clientKey, endpoint string, reqBody []byte) (done func(body []byte), handled bool) {
+	if !s.cfg.Cache.Coalesce {
+		return func([]byte) {}, false
+	}
+	sum := sha256.Sum256(reqBody)
+	key := clientKey + "\x00" + endpoint + "\x00" + hex.EncodeToString(sum[:])
+	for {
+		f, leader := s.coalescer.join(key)
+		if leader {
+			return func(body []byte) { s.coalescer.land(key, f, body) }, false
+		}
+		select {
+		case <-f.done:
+		case <-r.Context().Done():
+			// The client went away while waiting; nothing useful to write.
+			return nil, true
+		}
+		if f.body != nil {
+			s.writeResponse(w, r, &middleware.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {"application/json"}, "X-Pario-Cache": {"coalesced"}},
+				Body:       f.body,
+				Cached:     true,
+			})
+			return nil, true
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/budget"
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestCoalesce(t *testing.T) {
+	tests := []struct {
+		name      string
+		coalesce  bool
+		vary      bool // give each request its own max_tokens
+		wantCalls int32
+	}{
+		{"coalescing", true, false, 1},
+		{"disabled", false, false, 3},
+		{"different max_tokens", true, true, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			arrived := make(chan struct{}, 3)
+			release := make(chan struct{})
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				arrived <- struct{}{}
+				<-release
+				writeChatResponse(w)
+			}))
+			defer upstream.Close()
+
+			srv := setupProxy(t, upstream)
+			srv.cfg.Cache.Coalesce = tt.coalesce
+
+			var wg sync.WaitGroup
+			results := make([]*httptest.ResponseRecorder, 3)
+			send := func(i int) {
+				defer wg.Done()
+				maxTokens := 100
+				if tt.vary {
+					maxTokens += i
+				}
+				body := fmt.Sprintf(`{"model":"gpt-4","max_tokens":%d,"messages":[{"role":"user","content":"same prompt"}]}`, maxTokens)
+				req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+				req.Header.Set("Authorization", "Bearer client-key")
+				results[i] = httptest.NewRecorder()
+				srv.ServeHTTP(results[i], req)
+			}
+			wg.Add(3)
+			go send(0)
+			<-arrived // the first request is upstream
+			go send(1)
+			go send(2)
+			time.Sleep(100 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+			coalesced := 0
+			for i, w := range results {
+				if w.Code != http.StatusOK {
+					t.Errorf("request %d: status %d", i, w.Code)
+				}
+				if w.Header().Get("X-Pario-Cache") == "coalesced" {
+					coalesced++
+				}
+			}
+			if want := 3 - int(tt.wantCalls); coalesced != want {
+				t.Errorf("%d coalesced responses, want %d", coalesced, want)
+			}
+			if !tt.coalesce || tt.vary {
+				return
+			}
+			recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recs) != 1 {
+				t.Errorf("%d usage records, want the leader's only", len(recs))
+			}
+		})
+	}
+}
+
+func TestCoalesceFailedLeader(t *testing.T) {
+	var calls atomic.Int32
+	arrived := make(chan struct{}, 2)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		arrived <- struct{}{}
+		if n == 1 {
+			<-release
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeChatResponse(w)
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Cache.Coalesce = true
+
+	send := func() int {
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"same prompt"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w.Code
+	}
+	leader := make(chan int)
+	go func() { leader <- send() }()
+	<-arrived
+	follower := make(chan int)
+	go func() { follower <- send() }()
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	if code := <-leader; code != http.StatusBadRequest {
+		t.Errorf("leader status %d, want 400", code)
+	}
+	if code := <-follower; code != http.StatusOK {
+		t.Errorf("follower status %d, want 200 from its own upstream call", code)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want 2", got)
+	}
+}
+
+func TestCoalesceChecksFirst(t *testing.T) {
+	var calls atomic.Int32
+	arrived := make(chan struct{}, 2)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		arrived <- struct{}{}
+		<-release
+		writeChatResponse(w)
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Cache.Coalesce = true
+	_ = srv.tracker.Record(context.Background(), models.UsageRecord{
+		APIKey: "spent-key", Model: "gpt-4", TotalTokens: 100, CreatedAt: time.Now().UTC(),
+	})
+	srv.enforcer = budget.New([]models.BudgetPolicy{
+		{APIKey: "spent-key", MaxTokens: 100, Period: models.BudgetDaily},
+	}, srv.tracker)
+
+	send := func(key string) int {
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"same prompt"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w.Code
+	}
+	leader := make(chan int)
+	go func() { leader <- send("client-key") }()
+	<-arrived
+
+	// An exhausted key is refused rather than handed the leader's response.
+	if code := send("spent-key"); code != http.StatusTooManyRequests {
+		t.Errorf("spent key status %d, want 429", code)
+	}
+	// Another key doesn't join the flight.
+	other := make(chan int)
+	go func() { other <- send("other-key") }()
+	select {
+	case <-arrived:
+	case <-time.After(5 * time.Second):
+		t.Fatal("other key's request never went upstream")
+	}
+	close(release)
+
+	if code := <-leader; code != http.StatusOK {
+		t.Errorf("leader status %d, want 200", code)
+	}
+	if code := <-other; code != http.StatusOK {
+		t.Errorf("other key status %d, want 200", code)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want 2", got)
+	}
+}
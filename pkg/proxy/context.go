@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/jsonbody"
+	"github.com/pario-ai/pario/pkg/router"
+)
+
+// Prompt size is estimated from the JSON byte length rather than with a
+// tokenizer: roughly four bytes per token, plus a small per-message
+// overhead. Counting raw JSON overestimates slightly, which errs toward
+// treating borderline requests as too large.
+const (
+	bytesPerToken         = 4
+	messageOverheadTokens = 4
+)
+
+// prompt is a request body split into the parts that count toward the
+// context window. The body is kept so only messages change when it is
+// re-encoded after truncation.
+type prompt struct {
+	body      []byte
+	raw       map[string]json.RawMessage
+	messages  []json.RawMessage
+	fixed     int // tokens outside messages (system prompt, tools)
+	maxTokens int
+}
+
+func parsePrompt(body []byte) (*prompt, error) {
+	p := &prompt{body: body}
+	if err := json.Unmarshal(body, &p.raw); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(p.raw["messages"], &p.messages); err != nil {
+		return nil, err
+	}
+	for _, k := range []string{"system", "tools", "functions"} {
+		p.fixed += len(p.raw[k]) / bytesPerToken
+	}
+	for _, k := range []string{"max_tokens", "max_completion_tokens"} {
+		var n int
+		if json.Unmarshal(p.raw[k], &n) == nil && n > p.maxTokens {
+			p.maxTokens = n
+		}
+	}
+	return p, nil
+}
+
+func messageTokens(m json.RawMessage) int {
+	return len(m)/bytesPerToken + messageOverheadTokens
+}
+
+// tokens estimates the context the request needs: prompt plus the
+// completion it asks for.
+func (p *prompt) tokens() int {
+	return p.promptTokens() + p.maxTokens
+}
+
+// completionFor is the completion the request asks of rt, after rt's
+// params cap max_tokens or set it on a request without one.
+func (p *prompt) completionFor(rt router.Route) int {
+	if limit := rt.Params.MaxTokens; limit > 0 && (p.maxTokens == 0 || p.maxTokens > limit) {
+		return limit
+	}
+	return p.maxTokens
+}
+
+// tokensFor is tokens for the request as sent to rt.
+func (p *prompt) tokensFor(rt router.Route) int {
+	return p.promptTokens() + p.completionFor(rt)
+}
+
+// promptTokens estimates the prompt alone.
+func (p *prompt) promptTokens() int {
+	n := p.fixed
+	for _, m := range p.messages {
+		n += messageTokens(m)
+	}
+	return n
+}
+
+func messageRole(m json.RawMessage) string {
+	var v struct {
+		Role string `json:"role"`
+	}
+	_ = json.Unmarshal(m, &v)
+	return v.Role
+}
+
+// truncate drops the oldest conversation turns until the request fits
+// window, keeping system messages and the final message. After each drop,
+// leading non-user turns (an orphaned assistant reply or tool result) go
+// too, so the history still starts with a user message. It returns the
+// number of messages dropped, or false if the request can't fit.
+func (p *prompt) truncate(window int) (int, bool) {
+	dropped := 0
+	for p.tokens() > window {
+		first := -1
+		for i, m := range p.messages[:len(p.messages)-1] {
+			if r := messageRole(m); r != "system" && r != "developer" {
+				first = i
+				break
+			}
+		}
+		if first < 0 {
+			return dropped, false
+		}
+		p.messages = append(p.messages[:first], p.messages[first+1:]...)
+		dropped++
+		for first < len(p.messages)-1 && messageRole(p.messages[first]) != "user" {
+			p.messages = append(p.messages[:first], p.messages[first+1:]...)
+			dropped++
+		}
+	}
+	return dropped, true
+}
+
+func (p *prompt) encode() ([]byte, error) {
+	msgs := []byte{'['}
+	for i, m := range p.messages {
+		if i > 0 {
+			msgs = append(msgs, ',')
+		}
+		msgs = append(msgs, m...)
+	}
+	return jsonbody.SetField(p.body, "messages", append(msgs, ']'))
+}
+
+// requestHints estimates the prompt and completion of a chat completions or
+// messages request, for routes that order targets by cost.
+func requestHints(body []byte) router.Hints {
+	p, err := parsePrompt(body)
+	if err != nil {
+		return router.Hints{}
+	}
+	return router.Hints{PromptTokens: p.promptTokens(), CompletionTokens: p.maxTokens}
+}
+
+// fitContext applies the route's on_overflow mode to a request that is
+// estimated not to fit one or more targets' context windows. It returns
+// the routes to try and the body to send, or writes a 400 and returns
+// false. Targets the request can't fit are never tried.
+func (s *Server) fitContext(w http.ResponseWriter, routes []router.Route, body []byte) ([]router.Route, []byte, bool) {
+	p, err := parsePrompt(body)
+	if err != nil || len(routes) == 0 {
+		return routes, body, true
+	}
+	fits := func(rt router.Route) bool { return rt.ContextWindow == 0 || p.tokensFor(rt) <= rt.ContextWindow }
+
+	var kept []router.Route
+	largest, smallest := routes[0], routes[0]
+	for _, rt := range routes {
+		if fits(rt) {
+			kept = append(kept, rt)
+		}
+		if rt.ContextWindow > largest.ContextWindow {
+			largest = rt
+		}
+		if rt.ContextWindow > 0 && (smallest.ContextWindow == 0 || rt.ContextWindow < smallest.ContextWindow) {
+			smallest = rt
+		}
+	}
+	if len(kept) == len(routes) {
+		return routes, body, true
+	}
+
+	switch routes[0].OnOverflow {
+	case config.OverflowReroute:
+		if len(kept) > 0 {
+			log.Printf("context: ~%d tokens, skipping %d target(s) with smaller windows", p.tokens(), len(routes)-len(kept))
+			return kept, body, true
+		}
+	case config.OverflowTruncate:
+		p.maxTokens = p.completionFor(smallest)
+		if dropped, ok := p.truncate(smallest.ContextWindow); ok {
+			if out, err := p.encode(); err == nil {
+				w.Header().Set("X-Pario-Context-Truncated", strconv.Itoa(dropped))
+				return routes, out, true
+			}
+		}
+	default:
+		if fits(routes[0]) {
+			return kept, body, true
+		}
+		largest = routes[0]
+	}
+
+	writeJSONError(w, http.StatusBadRequest, fmt.Sprintf(
+		"request needs about %d tokens including max_tokens, more than the %d-token context window of %s",
+		p.tokensFor(largest), largest.ContextWindow, largest.Model))
+	return nil, nil, false
+}
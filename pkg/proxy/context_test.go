@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/jsonbody"
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/router"
+)
+
+// chatBody builds a request whose messages are each about 100 tokens.
+func chatBody(roles ...string) []byte {
+	req := map[string]any{"model": "m", "max_tokens": 100}
+	var msgs []map[string]string
+	for _, r := range roles {
+		msgs = append(msgs, map[string]string{"role": r, "content": strings.Repeat("x", 380)})
+	}
+	req["messages"] = msgs
+	b, _ := json.Marshal(req)
+	return b
+}
+
+func TestPromptTruncate(t *testing.T) {
+	p, err := parsePrompt(chatBody("system", "user", "assistant", "user", "assistant", "user"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := p.tokens()
+	if full < 700 || full > 800 {
+		t.Fatalf("unexpected estimate %d", full)
+	}
+
+	dropped, ok := p.truncate(full - 150)
+	if !ok {
+		t.Fatal("expected truncation to fit")
+	}
+	// Dropping the first user turn orphans the assistant reply, so both go.
+	if dropped != 2 {
+		t.Errorf("expected 2 dropped, got %d", dropped)
+	}
+	var roles []string
+	for _, m := range p.messages {
+		roles = append(roles, messageRole(m))
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,user" {
+		t.Errorf("unexpected remaining roles %s", got)
+	}
+
+	if _, ok := p.truncate(200); ok {
+		t.Error("expected system message and last turn to be kept even when too large")
+	}
+}
+
+func TestHints(t *testing.T) {
+	got := requestHints(chatBody("user", "assistant"))
+	if got.PromptTokens < 200 || got.PromptTokens > 250 || got.CompletionTokens != 100 {
+		t.Errorf("unexpected size %+v", got)
+	}
+	if got := requestHints([]byte(`not json`)); got != (router.Hints{}) {
+		t.Errorf("expected unknown size for invalid body, got %+v", got)
+	}
+}
+
+func TestFitContext(t *testing.T) {
+	small := router.Route{Model: "small", ContextWindow: 300}
+	large := router.Route{Model: "large", ContextWindow: 10000}
+	body := chatBody("user", "assistant", "user", "assistant", "user")
+
+	tests := []struct {
+		name      string
+		mode      string
+		routes    []router.Route
+		wantOK    bool
+		wantFirst string
+		truncated bool
+	}{
+		{"fits", config.OverflowReject, []router.Route{large, small}, true, "large", false},
+		{"reject", config.OverflowReject, []router.Route{small, large}, false, "", false},
+		{"reject drops small fallback", config.OverflowReject, []router.Route{large, small}, true, "large", false},
+		{"reroute", config.OverflowReroute, []router.Route{small, large}, true, "large", false},
+		{"reroute nothing fits", config.OverflowReroute, []router.Route{small}, false, "", false},
+		{"truncate", config.OverflowTruncate, []router.Route{small, large}, true, "small", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes := make([]router.Route, len(tt.routes))
+			for i, rt := range tt.routes {
+				rt.OnOverflow = tt.mode
+				routes[i] = rt
+			}
+			w := httptest.NewRecorder()
+			got, out, ok := (&Server{}).fitContext(w, routes, body)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v (%s)", ok, tt.wantOK, w.Body.String())
+			}
+			if !ok {
+				if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "context window") {
+					t.Errorf("expected 400 context window error, got %d %s", w.Code, w.Body.String())
+				}
+				return
+			}
+			if got[0].Model != tt.wantFirst {
+				t.Errorf("first route = %s, want %s", got[0].Model, tt.wantFirst)
+			}
+			if truncated := w.Header().Get("X-Pario-Context-Truncated") != ""; truncated != tt.truncated {
+				t.Errorf("truncated = %v, want %v", truncated, tt.truncated)
+			}
+			if tt.truncated && len(out) >= len(body) {
+				t.Error("expected a smaller body after truncation")
+			}
+		})
+	}
+}
+
+func TestFitContextParamsCap(t *testing.T) {
+	body, err := jsonbody.SetField(chatBody("user"), "max_tokens", []byte("100000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := router.Route{Model: "small", ContextWindow: 2000, OnOverflow: config.OverflowReject}
+
+	if _, _, ok := (&Server{}).fitContext(httptest.NewRecorder(), []router.Route{route}, body); ok {
+		t.Error("expected uncapped max_tokens to overflow")
+	}
+	route.Params.MaxTokens = 500
+	if _, _, ok := (&Server{}).fitContext(httptest.NewRecorder(), []router.Route{route}, body); !ok {
+		t.Error("expected the route's max_tokens cap to make the request fit")
+	}
+}
+
+func TestContextWindowRejectsBeforeUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req models.ChatCompletionRequest
+		_ = json.Unmarshal(body, &req)
+		if len(req.Messages) != 1 {
+			t.Errorf("expected truncated history upstream, got %d messages", len(req.Messages))
+		}
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{Model: "gpt-4", Usage: &models.Usage{TotalTokens: 1}})
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Router.ContextWindows = map[string]int{"gpt-4": 300}
+
+	body := chatBody("user", "assistant", "user")
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(strings.Replace(string(body), `"m"`, `"gpt-4"`, 1)))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send(); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 by default, got %d", w.Code)
+	}
+
+	srv.cfg.Router.OnOverflow = config.OverflowTruncate
+	w := send()
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 after truncation, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-Pario-Context-Truncated") != "2" {
+		t.Errorf("expected 2 messages truncated, got %q", w.Header().Get("X-Pario-Context-Truncated"))
+	}
+}
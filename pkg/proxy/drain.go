@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// drainState tracks in-flight proxy requests so a shutting-down or drained
+// proxy can stop admitting new ones and wait for the rest to finish.
+type drainState struct {
+	mu       sync.Mutex
+	draining bool
+	since    time.Time
+	active   int
+	// idle is closed once draining and no requests are in flight.
+	idle chan struct{}
+}
+
+// DrainStatus reports the drain state on the admin API.
+type DrainStatus struct {
+	Draining bool      `json:"draining"`
+	Since    time.Time `json:"since,omitzero"`
+	Active   int       `json:"active"`
+}
+
+// enter admits a request, returning false once draining has started.
+func (d *drainState) enter() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return false
+	}
+	d.active++
+	return true
+}
+
+// leave marks an admitted request finished.
+func (d *drainState) leave() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active--
+	if d.draining && d.active == 0 {
+		close(d.idle)
+	}
+}
+
+// start begins draining, reporting false if it had already begun.
+func (d *drainState) start() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return false
+	}
+	d.draining = true
+	d.since = time.Now().UTC()
+	d.idle = make(chan struct{})
+	if d.active == 0 {
+		close(d.idle)
+	}
+	return true
+}
+
+func (d *drainState) status() DrainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return DrainStatus{Draining: d.draining, Since: d.since, Active: d.active}
+}
+
+// StartDrain stops admitting new proxy requests. Requests already in flight,
+// including SSE streams and Realtime sessions, run to completion; new ones
+// get 503 with Connection: close so load balancers move on. The admin API
+// keeps working.
+func (s *Server) StartDrain() {
+	if s.drain.start() {
+		log.Printf("draining: no longer accepting proxy requests")
+	}
+}
+
+// Drain starts draining and blocks until every in-flight request and the
+// usage and audit writes they queued have finished, or ctx is done.
+func (s *Server) Drain(ctx context.Context) error {
+	s.StartDrain()
+	s.drain.mu.Lock()
+	idle := s.drain.idle
+	s.drain.mu.Unlock()
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		s.writes.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rejectDraining answers a request that arrived after draining started.
+func rejectDraining(w http.ResponseWriter) {
+	w.Header().Set("Connection", "close")
+	w.Header().Set("Retry-After", "1")
+	writeJSONError(w, http.StatusServiceUnavailable, "proxy is draining")
+}
+
+// logAudit writes an audit entry in the background. Drain waits for
+// outstanding writes before the process exits.
+func (s *Server) logAudit(entry models.AuditEntry) {
+	s.writes.Add(1)
+	go func() {
+		defer s.writes.Done()
+		if err := s.auditor.Log(context.Background(), entry); err != nil {
+			log.Printf("audit log error: %v", err)
+		}
+	}()
+}
+
+// handleDrain reports the drain state; POST starts draining.
+func (s *Server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		s.StartDrain()
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "use GET or POST")
+		return
+	}
+	writeJSON(w, s.drain.status())
+}
+
+// Shutdown gracefully stops srv, which serves s. It drains s first, so
+// hijacked Realtime connections and background writes that
+// http.Server.Shutdown doesn't track are waited for too. Connections still
+// open when ctx is done are closed.
+func (s *Server) Shutdown(ctx context.Context, srv *http.Server) error {
+	s.StartDrain()
+	err := srv.Shutdown(ctx)
+	if err == nil {
+		err = s.Drain(ctx)
+	}
+	if err != nil {
+		log.Printf("drain deadline exceeded; closing remaining connections")
+		_ = srv.Close()
+	}
+	return err
+}
+
+// maxQueuedFailures bounds the upstream failures awaiting a write.
+const maxQueuedFailures = 1000
+
+// failureQueue holds upstream failures awaiting a write, so failover
+// doesn't wait on the tracker. While any are queued, one goroutine writes
+// them in order.
+type failureQueue struct {
+	mu      sync.Mutex
+	pending []models.UpstreamFailure
+	running bool
+	dropped int64
+}
+
+// recordFailure queues f for a background write, or drops it if
+// maxQueuedFailures are already waiting, as during a provider outage on a
+// slow tracker. Drain waits for queued failures before the process exits.
+func (s *Server) recordFailure(f models.UpstreamFailure) {
+	q := &s.failures
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) >= maxQueuedFailures {
+		q.dropped++
+		if q.dropped == 1 || q.dropped%1000 == 0 {
+			log.Printf("upstream failure queue full: %d failures dropped", q.dropped)
+		}
+		return
+	}
+	q.pending = append(q.pending, f)
+	s.writes.Add(1)
+	if !q.running {
+		q.running = true
+		go s.writeFailures()
+	}
+}
+
+// writeFailures writes queued upstream failures until none are left.
+func (s *Server) writeFailures() {
+	q := &s.failures
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		f := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		if err := s.tracker.RecordFailure(context.Background(), f); err != nil {
+			log.Printf("upstream failure record error: %v", err)
+		}
+		s.writes.Done()
+	}
+}
@@ -0,0 +1,248 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/tracker"
+)
+
+func TestDrainEndpoint(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Admin.Token = "secret"
+
+	admin := func(method string) DrainStatus {
+		t.Helper()
+		req := httptest.NewRequest(method, "/pario/admin/drain", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s drain: status = %d", method, w.Code)
+		}
+		var st DrainStatus
+		if err := json.NewDecoder(w.Body).Decode(&st); err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+
+	if st := admin(http.MethodGet); st.Draining {
+		t.Fatalf("draining before request: %+v", st)
+	}
+	if st := admin(http.MethodPost); !st.Draining || st.Since.IsZero() {
+		t.Fatalf("drain not started: %+v", st)
+	}
+
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status while draining = %d, want 503", w.Code)
+	}
+	if w.Header().Get("Connection") != "close" {
+		t.Errorf("Connection = %q, want close", w.Header().Get("Connection"))
+	}
+}
+
+func TestDrainWaitsForInFlight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte(`{"id":"x","model":"gpt-4","choices":[],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+
+	served := make(chan int)
+	go func() {
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		served <- w.Code
+	}()
+	<-started
+
+	drained := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		drained <- srv.Drain(ctx)
+	}()
+
+	select {
+	case err := <-drained:
+		t.Fatalf("drain returned with a request in flight: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if code := <-served; code != http.StatusOK {
+		t.Errorf("in-flight request status = %d, want 200", code)
+	}
+	if err := <-drained; err != nil {
+		t.Errorf("drain: %v", err)
+	}
+}
+
+func TestDrainDeadline(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	if !srv.drain.enter() {
+		t.Fatal("request rejected before draining")
+	}
+	defer srv.drain.leave()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := srv.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("drain = %v, want deadline exceeded", err)
+	}
+}
+
+func TestShutdownCompletesStream(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"id\":\"1\",\"model\":\"gpt-4\",\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("data: {\"id\":\"1\",\"model\":\"gpt-4\",\"choices\":[{\"delta\":{\"content\":\"lo\"}}],\"usage\":{\"prompt_tokens\":1,\"completion_tokens\":2,\"total_tokens\":3}}\n\ndata: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	front := httptest.NewServer(srv)
+	defer front.Close()
+
+	body := `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	req, _ := http.NewRequest(http.MethodPost, front.URL+"/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	first := make([]byte, 16)
+	if _, err := resp.Body.Read(first); err != nil {
+		t.Fatal(err)
+	}
+
+	shutdown := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- srv.Shutdown(ctx, front.Config)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for !srv.drain.status().Draining {
+		if time.Now().After(deadline) {
+			t.Fatal("shutdown didn't start draining")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// New requests are turned away while the stream runs on.
+	late := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	late.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, late)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Connection") != "close" {
+		t.Errorf("request during shutdown: status %d, Connection %q; want 503 and close", w.Code, w.Header().Get("Connection"))
+	}
+
+	close(release)
+	rest, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("stream cut off during shutdown: %v", err)
+	}
+	if !strings.Contains(string(rest), "[DONE]") {
+		t.Errorf("stream didn't run to completion: %q", rest)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+}
+
+// blockingFailures is a tracker whose failure writes wait for release.
+type blockingFailures struct {
+	tracker.Tracker
+	release  chan struct{}
+	recorded chan models.UpstreamFailure
+}
+
+func (b *blockingFailures) RecordFailure(ctx context.Context, f models.UpstreamFailure) error {
+	<-b.release
+	b.recorded <- f
+	return nil
+}
+
+func TestFailuresRecordedInBackground(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer primary.Close()
+	fallback := newUpstream()
+	defer fallback.Close()
+
+	tr := &blockingFailures{Tracker: tracker.NewMemory(), release: make(chan struct{}), recorded: make(chan models.UpstreamFailure, 1)}
+	cfg := &config.Config{
+		Listen: ":0",
+		Providers: []config.ProviderConfig{
+			{Name: "primary", URL: primary.URL, APIKey: "sk-1"},
+			{Name: "fallback", URL: fallback.URL, APIKey: "sk-2"},
+		},
+		Router: config.RouterConfig{Routes: []config.RouteConfig{{
+			Model:   "gpt-4",
+			Targets: []config.RouteTarget{{Provider: "primary", Model: "gpt-4"}, {Provider: "fallback", Model: "gpt-4"}},
+		}}},
+		Session: config.SessionConfig{GapTimeout: 30 * time.Minute},
+	}
+	srv := New(cfg, tr, nil, nil, nil)
+
+	// The fallback answers while the primary's failure is still being
+	// written.
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from fallback, got %d: %s", w.Code, w.Body.String())
+	}
+
+	drained := make(chan error)
+	go func() { drained <- srv.Drain(context.Background()) }()
+	select {
+	case <-drained:
+		t.Fatal("Drain returned before the failure was written")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(tr.release)
+	if f := <-tr.recorded; f.Provider != "primary" || f.StatusCode != http.StatusBadGateway {
+		t.Errorf("recorded failure = %+v", f)
+	}
+	if err := <-drained; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+)
+
+// upstreamProxy returns the egress proxy for requests to target on
+// provider: the provider's proxy setting, else HTTP_PROXY, HTTPS_PROXY, and
+// NO_PROXY from the environment. Nil means connect directly.
+func upstreamProxy(provider config.ProviderConfig, target *url.URL) (*url.URL, error) {
+	if provider.Proxy != "" {
+		return url.Parse(provider.Proxy)
+	}
+	u := *target
+	switch u.Scheme {
+	case "wss":
+		u.Scheme = "https"
+	case "ws":
+		u.Scheme = "http"
+	}
+	return http.ProxyFromEnvironment(&http.Request{URL: &u})
+}
+
+// dialVia opens a TCP connection to addr (host:port), tunnelled through
+// proxyURL when it is set. HTTP(S) proxies are asked to CONNECT; SOCKS5
+// proxies get a CONNECT command, with socks5h resolving addr at the proxy.
+func dialVia(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	var d net.Dialer
+	if proxyURL == nil {
+		return d.DialContext(ctx, "tcp", addr)
+	}
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := map[string]string{"http": "80", "https": "443", "socks5": "1080", "socks5h": "1080"}[proxyURL.Scheme]
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("dial proxy: %w", err)
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	switch proxyURL.Scheme {
+	case "https":
+		tc := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("proxy TLS handshake: %w", err)
+		}
+		conn = tc
+		fallthrough
+	case "http":
+		err = httpConnect(conn, proxyURL, addr)
+	case "socks5", "socks5h":
+		err = socks5Connect(ctx, conn, proxyURL, addr)
+	default:
+		err = fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// httpConnect asks an HTTP proxy on conn to tunnel to addr.
+func httpConnect(conn net.Conn, proxyURL *url.URL, addr string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := proxyURL.User; u != nil {
+		pass, _ := u.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+pass)))
+	}
+	if err := req.Write(conn); err != nil {
+		return fmt.Errorf("proxy CONNECT: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return fmt.Errorf("proxy CONNECT: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy CONNECT: %s", resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return errors.New("proxy CONNECT: unexpected data after response")
+	}
+	return nil
+}
+
+// socks5Connect performs a SOCKS5 (RFC 1928) CONNECT to addr on conn, with
+// username/password authentication (RFC 1929) when proxyURL has a user.
+func socks5Connect(ctx context.Context, conn net.Conn, proxyURL *url.URL, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+
+	method := byte(0x00) // no authentication
+	if proxyURL.User != nil {
+		method = 0x02 // username/password
+	}
+	if _, err := conn.Write([]byte{0x05, 0x01, method}); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	if reply[0] != 0x05 || reply[1] != method {
+		return errors.New("socks5: proxy refused the authentication method")
+	}
+	if method == 0x02 {
+		user := proxyURL.User.Username()
+		pass, _ := proxyURL.User.Password()
+		if len(user) > 255 || len(pass) > 255 {
+			return errors.New("socks5: credentials too long")
+		}
+		auth := append([]byte{0x01, byte(len(user))}, user...)
+		auth = append(append(auth, byte(len(pass))), pass...)
+		if _, err := conn.Write(auth); err != nil {
+			return fmt.Errorf("socks5: %w", err)
+		}
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return fmt.Errorf("socks5: %w", err)
+		}
+		if reply[1] != 0x00 {
+			return errors.New("socks5: authentication failed")
+		}
+	}
+
+	req := []byte{0x05, 0x01, 0x00}
+	ip := net.ParseIP(host)
+	if ip == nil && proxyURL.Scheme == "socks5" {
+		// Plain socks5 resolves names locally; socks5h leaves it to the proxy.
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return fmt.Errorf("socks5: resolve %s: %w", host, err)
+		}
+		ip = ips[0]
+	}
+	switch {
+	case ip.To4() != nil:
+		req = append(append(req, 0x01), ip.To4()...)
+	case ip != nil:
+		req = append(append(req, 0x04), ip.To16()...)
+	default:
+		if len(host) > 255 {
+			return errors.New("socks5: host name too long")
+		}
+		req = append(append(req, 0x03, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+
+	// Reply: VER REP RSV ATYP BND.ADDR BND.PORT
+	var head [4]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	if head[1] != 0x00 {
+		return fmt.Errorf("socks5: connect failed with code %d", head[1])
+	}
+	var skip int
+	switch head[3] {
+	case 0x01:
+		skip = net.IPv4len
+	case 0x04:
+		skip = net.IPv6len
+	case 0x03:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return fmt.Errorf("socks5: %w", err)
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("socks5: unknown address type %d", head[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, skip+2)); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	return nil
+}
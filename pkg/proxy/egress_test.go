@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/tracker"
+)
+
+// pipe relays between a and b until either side closes.
+func pipe(a, b net.Conn) {
+	go func() { _, _ = io.Copy(a, b); _ = a.Close() }()
+	_, _ = io.Copy(b, a)
+	_ = b.Close()
+}
+
+// serveProxy accepts connections on a new listener and hands each to handle.
+func serveProxy(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(c)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// getVia sends GET / over conn to the HTTP server at addr.
+func getVia(t *testing.T, conn net.Conn, addr string) string {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/", nil)
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestDialViaHTTPConnect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "through the tunnel")
+	}))
+	defer target.Close()
+	targetAddr := strings.TrimPrefix(target.URL, "http://")
+
+	var auth string
+	proxyAddr := serveProxy(t, func(c net.Conn) {
+		req, err := http.ReadRequest(bufio.NewReader(c))
+		if err != nil || req.Method != http.MethodConnect {
+			_ = c.Close()
+			return
+		}
+		auth = req.Header.Get("Proxy-Authorization")
+		up, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			io.WriteString(c, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+			_ = c.Close()
+			return
+		}
+		io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n")
+		pipe(c, up)
+	})
+
+	proxyURL, _ := url.Parse("http://user:pass@" + proxyAddr)
+	conn, err := dialVia(context.Background(), proxyURL, targetAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got := getVia(t, conn, targetAddr); got != "through the tunnel" {
+		t.Errorf("body = %q", got)
+	}
+	if auth != "Basic dXNlcjpwYXNz" {
+		t.Errorf("Proxy-Authorization = %q", auth)
+	}
+}
+
+func TestDialViaSOCKS5(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "through socks")
+	}))
+	defer target.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(target.URL, "http://"))
+
+	var requested string
+	proxyAddr := serveProxy(t, func(c net.Conn) {
+		buf := make([]byte, 512)
+		// Greeting: expect username/password.
+		if _, err := io.ReadFull(c, buf[:3]); err != nil || buf[2] != 0x02 {
+			_ = c.Close()
+			return
+		}
+		c.Write([]byte{0x05, 0x02})
+		// RFC 1929 auth.
+		io.ReadFull(c, buf[:2])
+		user := make([]byte, buf[1])
+		io.ReadFull(c, user)
+		io.ReadFull(c, buf[:1])
+		pass := make([]byte, buf[0])
+		io.ReadFull(c, pass)
+		if string(user) != "u" || string(pass) != "p" {
+			c.Write([]byte{0x01, 0x01})
+			_ = c.Close()
+			return
+		}
+		c.Write([]byte{0x01, 0x00})
+		// CONNECT with a domain name.
+		io.ReadFull(c, buf[:5])
+		host := make([]byte, buf[4])
+		io.ReadFull(c, host)
+		io.ReadFull(c, buf[:2])
+		p := binary.BigEndian.Uint16(buf[:2])
+		requested = net.JoinHostPort(string(host), strconv.Itoa(int(p)))
+		up, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(p))))
+		if err != nil {
+			c.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+			_ = c.Close()
+			return
+		}
+		c.Write([]byte{0x05, 0x00, 0x00, 0x01, 127, 0, 0, 1, 0, 0})
+		pipe(c, up)
+	})
+
+	proxyURL, _ := url.Parse("socks5h://u:p@" + proxyAddr)
+	addr := net.JoinHostPort("localhost", port)
+	conn, err := dialVia(context.Background(), proxyURL, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if requested != addr {
+		t.Errorf("socks5h should pass the host name to the proxy: got %q", requested)
+	}
+	if got := getVia(t, conn, addr); got != "through socks" {
+		t.Errorf("body = %q", got)
+	}
+
+	bad, _ := url.Parse("socks5h://u:wrong@" + proxyAddr)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := dialVia(ctx, bad, addr); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("bad credentials: err = %v", err)
+	}
+}
+
+func TestProviderProxy(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	var proxied atomic.Int32
+	forward := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute upstream URL.
+		if r.URL.Host != strings.TrimPrefix(upstream.URL, "http://") {
+			http.Error(w, "unexpected target "+r.URL.String(), http.StatusBadGateway)
+			return
+		}
+		proxied.Add(1)
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer forward.Close()
+
+	tr, _ := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	defer func() { _ = tr.Close() }()
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{Name: "egress", URL: upstream.URL, APIKey: "sk", Proxy: forward.URL}},
+	}
+	srv := New(cfg, tr, nil, nil, nil)
+
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if proxied.Load() != 1 {
+		t.Errorf("request didn't go through the provider's proxy")
+	}
+}
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/audit"
+	"github.com/pario-ai/pario/pkg/budget"
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/router"
+)
+
+// resolveFor resolves the routes of a chat completions or messages request.
+// A key past a budget policy's downgrade_at gets the route's downgrade
+// targets first, and one over a policy with action downgrade gets only
+// them. The response is marked with X-Pario-Downgraded when one leads the
+// chain.
+func (s *Server) resolveFor(w http.ResponseWriter, r *http.Request, clientKey, model string, body []byte) ([]router.Route, error) {
+	hints := requestHints(body)
+	hints.Session = stickySession(r, clientKey)
+	if s.enforcer != nil {
+		mode, err := s.enforcer.Downgrading(s.budgetContext(r, clientKey), requestIDFrom(r.Context()), clientKey, model)
+		if err != nil {
+			log.Printf("budget downgrade check: %v", err)
+		}
+		hints.Downgrade = mode != budget.NoDowngrade
+		hints.DowngradeOnly = mode == budget.OnlyDowngrade
+	}
+	routes, err := s.router.ResolveFor(model, hints)
+	if err == nil && hints.Downgrade && len(routes) > 0 && routes[0].Downgrade {
+		w.Header().Set("X-Pario-Downgraded", "budget")
+	}
+	return routes, err
+}
+
+// setRouteHeaders tells the client which provider and upstream model
+// produced the response. It does nothing without a route, e.g. when every
+// target failed.
+func setRouteHeaders(w http.ResponseWriter, route router.Route) {
+	if route.Provider.Name == "" {
+		return
+	}
+	w.Header().Set("X-Pario-Provider", route.Provider.Name)
+	w.Header().Set("X-Pario-Model", route.Model)
+}
+
+// served notes that route answered r with a 2xx after d: it feeds the
+// target's latency average, ends its failure streak and, on sticky routes,
+// pins r's session to it.
+func (s *Server) served(r *http.Request, route router.Route, d time.Duration) {
+	s.router.Succeeded(route.Provider.Name, route.Model)
+	s.router.ObserveLatency(route.Provider.Name, route.Model, d)
+	s.router.Pin(stickySession(r, extractAPIKey(r)), route)
+}
+
+// failed notes that route's attempt at r, started at start, failed with
+// err or a retryable status and r moves on to the next route: it starts
+// or extends the target's failure streak and queues the attempt's record.
+func (s *Server) failed(r *http.Request, route router.Route, attempt, status int, err error, start time.Time) {
+	s.router.Failed(route.Provider.Name, route.Model)
+	f := models.UpstreamFailure{
+		RequestID:  requestIDFrom(r.Context()),
+		APIKey:     extractAPIKey(r),
+		Provider:   route.Provider.Name,
+		Model:      route.Model,
+		Endpoint:   endpointName(r.URL.Path),
+		Attempt:    attempt,
+		StatusCode: status,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err != nil {
+		f.Error = err.Error()
+	}
+	if !start.IsZero() {
+		f.LatencyMs = time.Since(start).Milliseconds()
+	}
+	s.recordFailure(f)
+}
+
+// stickySession returns the key sticky routes pin r's session under: the
+// client key and X-Pario-Session, or "" without the header.
+func stickySession(r *http.Request, clientKey string) string {
+	sid := r.Header.Get("X-Pario-Session")
+	if sid == "" {
+		return ""
+	}
+	return clientKey + "\x00" + sid
+}
+
+// handleEmbeddings proxies OpenAI embeddings requests through the router
+// with budget enforcement, recording prompt tokens under the "embeddings"
+// endpoint.
+func (s *Server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	clientKey := extractAPIKey(r)
+	if clientKey == "" {
+		writeJSONError(w, http.StatusUnauthorized, "missing API key")
+		return
+	}
+
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.EmbeddingRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.Model == "" {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	noteModel(r, req.Model)
+
+	s.shadow(r, clientKey, req.Model)
+	if !s.checkBudget(w, r, clientKey, req.Model) {
+		return
+	}
+
+	release, ok := s.admit(w, r, clientKey)
+	if !ok {
+		return
+	}
+	defer release()
+
+	routes, err := s.router.Resolve(req.Model)
+	if err == nil {
+		routes = openAIRoutes(routes)
+	}
+	if err != nil || len(routes) == 0 {
+		writeRouteError(w, err)
+		return
+	}
+
+	reqStart := time.Now()
+	result, usedRoute, attempt, upstreamLatency := s.forwardOpenAI(r, routes, "/embeddings", "application/json", jsonPayload(body))
+	setRouteHeaders(w, usedRoute)
+
+	if result == nil {
+		writeJSONError(w, http.StatusBadGateway, "all upstream providers failed")
+		return
+	}
+
+	var usage *models.Usage
+	if result.statusCode == http.StatusOK {
+		var embResp models.EmbeddingResponse
+		if err := json.Unmarshal(result.body, &embResp); err == nil && embResp.Usage != nil {
+			usage = embResp.Usage
+			if usage.TotalTokens == 0 {
+				usage.TotalTokens = usage.PromptTokens
+			}
+			s.recordUsage(r, models.UsageRecord{
+				APIKey:       clientKey,
+				Model:        defaultModel(embResp.Model, usedRoute),
+				Provider:     usedRoute.Provider.Name,
+				RouteAlias:   usedRoute.Alias,
+				Attempt:      attempt,
+				PromptTokens: usage.PromptTokens,
+				TotalTokens:  usage.TotalTokens,
+				LatencyMs:    upstreamLatency.Milliseconds(),
+				Endpoint:     "embeddings",
+			})
+		}
+	}
+
+	if s.auditor != nil {
+		keyHash, keyPrefix := audit.HashAPIKey(clientKey)
+		entry := models.AuditEntry{
+			RequestID:    auditRequestID(r),
+			APIKeyHash:   keyHash,
+			APIKeyPrefix: keyPrefix,
+			Model:        req.Model,
+			Provider:     "openai",
+			RequestBody:  string(body),
+			ResponseBody: string(result.body),
+			StatusCode:   result.statusCode,
+			LatencyMs:    time.Since(reqStart).Milliseconds(),
+			CreatedAt:    time.Now().UTC(),
+		}
+		if usage != nil {
+			entry.PromptTokens = usage.PromptTokens
+			entry.TotalTokens = usage.TotalTokens
+		}
+		s.logAudit(entry)
+	}
+
+	writeUpstreamResult(w, result)
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/budget"
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/tracker"
+)
+
+func TestEmbeddings(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer sk-provider" {
+			t.Error("expected provider API key in upstream request")
+		}
+		w.Write([]byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"model":"text-embedding-3-small","usage":{"prompt_tokens":8,"total_tokens":8}}`))
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+
+	body := `{"model":"text-embedding-3-small","input":"hello world"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("got %d records, want 1", len(recs))
+	}
+	if r := recs[0]; r.Endpoint != "embeddings" || r.PromptTokens != 8 || r.TotalTokens != 8 || r.Model != "text-embedding-3-small" {
+		t.Errorf("record = %+v", r)
+	}
+}
+
+func TestEmbeddingsBudgetExceeded(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("upstream should not be called")
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	_ = srv.tracker.Record(context.Background(), models.UsageRecord{
+		APIKey: "client-key", Model: "text-embedding-3-small",
+		PromptTokens: 2000, TotalTokens: 2000, CreatedAt: time.Now().UTC(),
+	})
+	srv.enforcer = budget.New([]models.BudgetPolicy{{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily}}, srv.tracker)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(`{"model":"text-embedding-3-small","input":"hi"}`))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", w.Code)
+	}
+}
+
+func TestBudgetQueueReleasesSlot(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	tr, _ := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	defer func() { _ = tr.Close() }()
+	_ = tr.Record(context.Background(), models.UsageRecord{
+		APIKey: "client-key", Model: "gpt-4", TotalTokens: 600, CreatedAt: time.Now().UTC(),
+	})
+	enforcer := budget.New([]models.BudgetPolicy{
+		{APIKey: "*", MaxTokens: 1000, WarnAt: 0.5, Period: models.BudgetDaily},
+	}, tr, budget.WithQueue(10, 2*time.Second))
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{Name: "test", URL: upstream.URL, APIKey: "sk-provider"}},
+	}
+	srv := New(cfg, tr, nil, enforcer, nil)
+
+	// Past warn_at, requests for the key are serialized. Each must give up
+	// its slot when done, or the next one waits out max_wait and gets 429.
+	for i := range 3 {
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		start := time.Now()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d: %s", i, w.Code, w.Body.String())
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("request %d waited %s for the previous request's slot", i, d)
+		}
+	}
+}
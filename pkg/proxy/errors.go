@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pario-ai/pario/pkg/router"
+)
+
+// maxErrorBody caps how much of an upstream error body is read to
+// normalize it; longer bodies are relayed untouched.
+const maxErrorBody = 1 << 20
+
+// errorEnvelope is the error body clients get, whether Pario or a provider
+// failed. It keeps message and type where both the OpenAI and Anthropic
+// SDKs look for them.
+type errorEnvelope struct {
+	Type  string      `json:"type"` // always "error", as in Anthropic errors
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	// Code and Param are the provider's, verbatim.
+	Code  json.RawMessage `json:"code,omitempty"`
+	Param json.RawMessage `json:"param,omitempty"`
+	// Provider names the provider that returned the error; it is empty for
+	// errors Pario raised itself.
+	Provider       string `json:"provider,omitempty"`
+	UpstreamStatus int    `json:"upstream_status,omitempty"`
+	RequestID      string `json:"request_id,omitempty"`
+	// Reason is a stable code for errors Pario raised itself, such as
+	// budget_exceeded, so clients need not match on the message.
+	Reason string `json:"reason,omitempty"`
+	// HelpURL points at a page explaining the error, when configured.
+	HelpURL string `json:"help_url,omitempty"`
+	// Raw is the provider's original body: JSON as-is, anything else as a
+	// string.
+	Raw json.RawMessage `json:"raw,omitempty"`
+}
+
+// Reasons for errors Pario raises itself.
+const (
+	reasonBudgetExceeded    = "budget_exceeded"
+	reasonBudgetQueueFull   = "budget_queue_full"
+	reasonLowPriorityShed   = "budget_low_priority_shed"
+	reasonRateLimitExceeded = "rate_limit_exceeded"
+)
+
+// writeJSONError writes an error Pario raised itself.
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	writeError(w, code, errorDetail{Message: message})
+}
+
+// writeError writes an error Pario raised itself, filling in d's type,
+// code, and request ID.
+func writeError(w http.ResponseWriter, code int, d errorDetail) {
+	d.Type = "pario_error"
+	d.Code = json.RawMessage(strconv.Itoa(code))
+	d.RequestID = w.Header().Get("X-Pario-Request-ID")
+	body, _ := json.Marshal(errorEnvelope{Type: "error", Error: d})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// writeRouteError writes the error for a request that couldn't be routed:
+// 404 for a model router.unmatched rejects, and 502 otherwise, including
+// when no resolved target serves the endpoint.
+func writeRouteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, router.ErrUnmatched) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSONError(w, http.StatusBadGateway, "no providers available")
+}
+
+// normalizeError translates a provider's error body into an errorEnvelope.
+// It understands the OpenAI, Anthropic, and Gemini formats and falls back
+// to the body's text, or the status text if there is none.
+func normalizeError(provider string, status int, body []byte, requestID string) []byte {
+	d := errorDetail{Provider: provider, UpstreamStatus: status, RequestID: requestID}
+	trimmed := bytes.TrimSpace(body)
+	if json.Valid(trimmed) && len(trimmed) > 0 {
+		d.Raw = trimmed
+		parseProviderError(trimmed, &d)
+	} else if len(trimmed) > 0 {
+		d.Raw, _ = json.Marshal(string(trimmed))
+		d.Message = string(trimmed)
+	}
+	if d.Message == "" {
+		d.Message = http.StatusText(status)
+	}
+	if d.Type == "" {
+		d.Type = "upstream_error"
+	}
+	out, _ := json.Marshal(errorEnvelope{Type: "error", Error: d})
+	return out
+}
+
+// parseProviderError fills in d from a JSON error body.
+func parseProviderError(body []byte, d *errorDetail) {
+	// Gemini may wrap the error in an array.
+	if body[0] == '[' {
+		var list []json.RawMessage
+		if json.Unmarshal(body, &list) != nil || len(list) == 0 {
+			return
+		}
+		body = list[0]
+	}
+	var v struct {
+		Error json.RawMessage `json:"error"`
+		// Bedrock and other AWS APIs put the message at the top level.
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &v) != nil {
+		return
+	}
+	d.Message = v.Message
+	var e struct {
+		Message string          `json:"message"`
+		Type    string          `json:"type"`
+		Status  string          `json:"status"` // Gemini
+		Code    json.RawMessage `json:"code"`
+		Param   json.RawMessage `json:"param"`
+	}
+	if len(v.Error) == 0 {
+		return
+	}
+	if json.Unmarshal(v.Error, &e) != nil {
+		// Some APIs send the error as a bare string.
+		var msg string
+		if json.Unmarshal(v.Error, &msg) == nil {
+			d.Message = msg
+		}
+		return
+	}
+	d.Message = e.Message
+	d.Type = e.Type
+	if d.Type == "" {
+		d.Type = strings.ToLower(e.Status)
+	}
+	if string(e.Code) != "null" {
+		d.Code = e.Code
+	}
+	if string(e.Param) != "null" {
+		d.Param = e.Param
+	}
+}
+
+// errorTransport rewrites provider error responses into the errorEnvelope
+// format, so clients see one error schema whichever provider failed.
+// Compressed bodies, which the transport only leaves encoded when the
+// request asked for an encoding itself, are relayed untouched.
+type errorTransport struct {
+	http.RoundTripper
+	provider string
+}
+
+func (t errorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil || resp.StatusCode < 400 || resp.ContentLength > maxErrorBody || resp.Header.Get("Content-Encoding") != "" {
+		return resp, err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody+1))
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxErrorBody {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	}
+	body = normalizeError(t.provider, resp.StatusCode, body, requestIDFrom(req.Context()))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Del("Content-Encoding")
+	return resp, nil
+}
@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeError(t *testing.T) {
+	tests := []struct {
+		name, body        string
+		status            int
+		wantMsg, wantType string
+		wantCode          string
+	}{
+		{
+			name:     "openai",
+			status:   429,
+			body:     `{"error":{"message":"Rate limit reached","type":"requests","param":null,"code":"rate_limit_exceeded"}}`,
+			wantMsg:  "Rate limit reached",
+			wantType: "requests",
+			wantCode: `"rate_limit_exceeded"`,
+		},
+		{
+			name:     "anthropic",
+			status:   529,
+			body:     `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			wantMsg:  "Overloaded",
+			wantType: "overloaded_error",
+		},
+		{
+			name:     "gemini",
+			status:   400,
+			body:     `[{"error":{"code":400,"message":"API key not valid","status":"INVALID_ARGUMENT"}}]`,
+			wantMsg:  "API key not valid",
+			wantType: "invalid_argument",
+			wantCode: `400`,
+		},
+		{
+			name:     "bedrock",
+			status:   403,
+			body:     `{"message":"The security token included in the request is invalid."}`,
+			wantMsg:  "The security token included in the request is invalid.",
+			wantType: "upstream_error",
+		},
+		{
+			name:     "plain text",
+			status:   502,
+			body:     "Bad Gateway\n",
+			wantMsg:  "Bad Gateway",
+			wantType: "upstream_error",
+		},
+		{
+			name:     "empty",
+			status:   503,
+			wantMsg:  "Service Unavailable",
+			wantType: "upstream_error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var env errorEnvelope
+			if err := json.Unmarshal(normalizeError("prov", tt.status, []byte(tt.body), "req_1"), &env); err != nil {
+				t.Fatal(err)
+			}
+			e := env.Error
+			if env.Type != "error" || e.Message != tt.wantMsg || e.Type != tt.wantType || string(e.Code) != tt.wantCode {
+				t.Errorf("got type %q, error %+v", env.Type, e)
+			}
+			if e.Provider != "prov" || e.UpstreamStatus != tt.status || e.RequestID != "req_1" {
+				t.Errorf("missing provider, status, or request ID: %+v", e)
+			}
+			if tt.body != "" && len(e.Raw) == 0 {
+				t.Error("raw body lost")
+			}
+		})
+	}
+}
+
+func TestUpstreamErrorEnvelope(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: field required"}}`)
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	for _, stream := range []bool{false, true} {
+		body := fmt.Sprintf(`{"model":"claude-sonnet-4-20250514","stream":%t,"messages":[{"role":"user","content":"hi"}]}`, stream)
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("stream=%t: status %d, want the upstream 400", stream, w.Code)
+		}
+		var env struct {
+			Type  string `json:"type"`
+			Error struct {
+				errorDetail
+				Raw struct {
+					Error struct {
+						Message string `json:"message"`
+					} `json:"error"`
+				} `json:"raw"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("stream=%t: %v: %s", stream, err, w.Body.String())
+		}
+		e := env.Error
+		if env.Type != "error" || e.Type != "invalid_request_error" || e.Message != "max_tokens: field required" {
+			t.Errorf("stream=%t: unexpected envelope %s", stream, w.Body.String())
+		}
+		if e.Provider != "test" || e.UpstreamStatus != http.StatusBadRequest {
+			t.Errorf("stream=%t: provider %q, upstream status %d", stream, e.Provider, e.UpstreamStatus)
+		}
+		if e.RequestID == "" || e.RequestID != w.Header().Get("X-Pario-Request-ID") {
+			t.Errorf("stream=%t: request_id %q doesn't match X-Pario-Request-ID %q", stream, e.RequestID, w.Header().Get("X-Pario-Request-ID"))
+		}
+		if e.Raw.Error.Message != "max_tokens: field required" {
+			t.Errorf("stream=%t: raw body not preserved: %s", stream, w.Body.String())
+		}
+	}
+}
+
+func TestUpstreamErrorCompressed(t *testing.T) {
+	const body = `{"error":{"type":"invalid_request_error","message":"bad"}}`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeMaybeGzip(w, r, http.StatusBadRequest, body)
+	}))
+	defer upstream.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, upstream.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := errorTransport{RoundTripper: http.DefaultTransport, provider: "test"}.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want the upstream's gzip", resp.Header.Get("Content-Encoding"))
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != body {
+		t.Errorf("body = %q, want the upstream's error untouched", got)
+	}
+}
+
+func TestParioErrorEnvelope(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+	srv := setupProxy(t, upstream)
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	var env errorEnvelope
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Type != "error" || env.Error.Type != "pario_error" || env.Error.Provider != "" || string(env.Error.Code) != "401" {
+		t.Errorf("unexpected envelope %s", w.Body.String())
+	}
+	if env.Error.RequestID == "" || env.Error.RequestID != w.Header().Get("X-Pario-Request-ID") {
+		t.Errorf("request_id %q doesn't match X-Pario-Request-ID", env.Error.RequestID)
+	}
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/audit"
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// handleImages proxies OpenAI image generation requests with budget
+// enforcement. Each generated image is priced from the model's images
+// pricing by size and quality and recorded as media cost under the
+// "images" endpoint.
+func (s *Server) handleImages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	clientKey := extractAPIKey(r)
+	if clientKey == "" {
+		writeJSONError(w, http.StatusUnauthorized, "missing API key")
+		return
+	}
+
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ImageRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Model == "" {
+		// OpenAI's default image model.
+		req.Model = "dall-e-2"
+	}
+	noteModel(r, req.Model)
+
+	s.shadow(r, clientKey, req.Model)
+	if !s.checkBudget(w, r, clientKey, req.Model) {
+		return
+	}
+
+	release, ok := s.admit(w, r, clientKey)
+	if !ok {
+		return
+	}
+	defer release()
+
+	routes, err := s.router.Resolve(req.Model)
+	if err == nil {
+		routes = openAIRoutes(routes)
+	}
+	if err != nil || len(routes) == 0 {
+		writeRouteError(w, err)
+		return
+	}
+
+	reqStart := time.Now()
+	result, usedRoute, attempt, upstreamLatency := s.forwardOpenAI(r, routes, "/images/generations", "application/json", jsonPayload(body))
+	setRouteHeaders(w, usedRoute)
+	if result == nil {
+		writeJSONError(w, http.StatusBadGateway, "all upstream providers failed")
+		return
+	}
+
+	var rec *models.UsageRecord
+	if result.statusCode == http.StatusOK {
+		var imgResp models.ImageResponse
+		if err := json.Unmarshal(result.body, &imgResp); err == nil {
+			rec = &models.UsageRecord{
+				APIKey:     clientKey,
+				Model:      usedRoute.Model,
+				Provider:   usedRoute.Provider.Name,
+				RouteAlias: usedRoute.Alias,
+				Attempt:    attempt,
+				LatencyMs:  upstreamLatency.Milliseconds(),
+				Endpoint:   "images",
+				Images:     len(imgResp.Data),
+			}
+			if u := imgResp.Usage; u != nil {
+				rec.PromptTokens, rec.CompletionTokens, rec.TotalTokens = u.InputTokens, u.OutputTokens, u.TotalTokens
+			}
+			if price, ok := s.pricing[usedRoute.Model].ImageCost(req.Size, req.Quality); ok {
+				rec.MediaCostUSD = float64(rec.Images) * price
+			}
+			s.recordUsage(r, *rec)
+		}
+	}
+
+	if s.auditor != nil {
+		keyHash, keyPrefix := audit.HashAPIKey(clientKey)
+		entry := models.AuditEntry{
+			RequestID:    auditRequestID(r),
+			APIKeyHash:   keyHash,
+			APIKeyPrefix: keyPrefix,
+			Model:        req.Model,
+			Provider:     "openai",
+			RequestBody:  string(body),
+			ResponseBody: string(result.body),
+			StatusCode:   result.statusCode,
+			LatencyMs:    time.Since(reqStart).Milliseconds(),
+			CreatedAt:    time.Now().UTC(),
+		}
+		if rec != nil {
+			entry.PromptTokens = rec.PromptTokens
+			entry.CompletionTokens = rec.CompletionTokens
+			entry.TotalTokens = rec.TotalTokens
+		}
+		s.logAudit(entry)
+	}
+
+	writeUpstreamResult(w, result)
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/budget"
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestImages(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/images/generations" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		var req models.ImageRequest
+		b, _ := io.ReadAll(r.Body)
+		json.Unmarshal(b, &req)
+		data := make([]string, req.N)
+		for i := range data {
+			data[i] = `{"url":"https://example.com/img.png"}`
+		}
+		w.Write([]byte(`{"created":1,"data":[` + strings.Join(data, ",") + `]}`))
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	price := models.ModelPricing{Model: "dall-e-3", Images: []models.ImagePrice{
+		{Cost: 0.04},
+		{Size: "1024x1024", Quality: "hd", Cost: 0.08},
+		{Size: "1792x1024", Cost: 0.12},
+	}}
+	srv.pricing[price.Model] = price
+
+	tests := []struct {
+		body string
+		cost float64
+	}{
+		{`{"model":"dall-e-3","prompt":"a cat","n":1}`, 0.04},
+		{`{"model":"dall-e-3","prompt":"a cat","n":2,"size":"1024x1024","quality":"hd"}`, 0.16},
+		{`{"model":"dall-e-3","prompt":"a cat","n":1,"size":"1792x1024","quality":"hd"}`, 0.12},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v1/images/generations", strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != len(tests) {
+		t.Fatalf("got %d records, want %d", len(recs), len(tests))
+	}
+	var total float64
+	for _, r := range recs {
+		if r.Endpoint != "images" || r.Model != "dall-e-3" {
+			t.Errorf("record = %+v", r)
+		}
+		total += r.MediaCostUSD
+	}
+	if total < 0.3199 || total > 0.3201 {
+		t.Errorf("total media cost = %v, want 0.32", total)
+	}
+
+	// Spend now exceeds a $0.30 daily limit.
+	srv.enforcer = budget.New([]models.BudgetPolicy{{APIKey: "*", MaxCostUSD: 0.30, Period: models.BudgetDaily}}, srv.tracker)
+	req := httptest.NewRequest(http.MethodPost, "/v1/images/generations", strings.NewReader(tests[0].body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", w.Code)
+	}
+}
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// readBody reads and closes the request body. When the body is over
+// limits.max_body_bytes it writes a 413; on other read errors a 400.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			writeBodyTooLarge(w, tooBig.Limit)
+			return nil, false
+		}
+		writeJSONError(w, http.StatusBadRequest, "failed to read request body")
+		return nil, false
+	}
+	return body, true
+}
+
+func writeBodyTooLarge(w http.ResponseWriter, limit int64) {
+	writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", limit))
+}
+
+// limitBody enforces limits.max_body_bytes on r. Requests that declare a
+// larger Content-Length are rejected up front; otherwise the body is capped
+// so that reading past the limit fails. It returns false after writing a
+// 413.
+func (s *Server) limitBody(w http.ResponseWriter, r *http.Request) bool {
+	max := s.cfg.Limits.MaxBodyBytes
+	if max <= 0 {
+		return true
+	}
+	if r.ContentLength > max {
+		writeBodyTooLarge(w, max)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, max)
+	return true
+}
+
+// keyLimiter counts in-flight requests per client key.
+type keyLimiter struct {
+	max int
+
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+func newKeyLimiter(max int) *keyLimiter {
+	return &keyLimiter{max: max, inFlight: make(map[string]int)}
+}
+
+// acquire takes a slot for key, reporting false when the key is at its
+// limit. Every successful acquire must be paired with a release.
+func (l *keyLimiter) acquire(key string) bool {
+	if l.max <= 0 || key == "" {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[key] >= l.max {
+		return false
+	}
+	l.inFlight[key]++
+	return true
+}
+
+func (l *keyLimiter) release(key string) {
+	if l.max <= 0 || key == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[key]--; l.inFlight[key] <= 0 {
+		delete(l.inFlight, key)
+	}
+}
+
+// admitKey applies limits.max_in_flight_per_key to r. It returns false
+// after writing a 429; otherwise the caller must call the returned release.
+func (s *Server) admitKey(w http.ResponseWriter, r *http.Request) (release func(), ok bool) {
+	key := extractAPIKey(r)
+	if key == "" {
+		key = realtimeProtocolKey(r)
+	}
+	if !s.keyLimits.acquire(key) {
+		w.Header().Set("Retry-After", "1")
+		writeJSONError(w, http.StatusTooManyRequests, fmt.Sprintf("too many concurrent requests for this API key (limit %d)", s.keyLimits.max))
+		return nil, false
+	}
+	return func() { s.keyLimits.release(key) }, true
+}
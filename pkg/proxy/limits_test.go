@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/tracker"
+)
+
+func newLimitedProxy(t *testing.T, upstream *httptest.Server, limits config.LimitsConfig) *Server {
+	t.Helper()
+	tr, err := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tr.Close() })
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{Name: "test", URL: upstream.URL, APIKey: "sk-provider"}},
+		Limits:    limits,
+	}
+	return New(cfg, tr, nil, nil, nil)
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+	srv := newLimitedProxy(t, upstream, config.LimitsConfig{MaxBodyBytes: 100})
+
+	small := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+	big := `{"model":"gpt-4","messages":[{"role":"user","content":"` + strings.Repeat("x", 200) + `"}]}`
+	tests := []struct {
+		name   string
+		body   io.Reader
+		length int64
+		want   int
+	}{
+		{"within limit", strings.NewReader(small), int64(len(small)), http.StatusOK},
+		{"declared too large", strings.NewReader(big), int64(len(big)), http.StatusRequestEntityTooLarge},
+		// Chunked bodies have no declared length and are cut off while read.
+		{"undeclared too large", io.MultiReader(strings.NewReader(big)), -1, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", tt.body)
+			req.ContentLength = tt.length
+			req.Header.Set("Authorization", "Bearer client-key")
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMaxInFlightPerKey(t *testing.T) {
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hold the first request open upstream.
+		if calls.Add(1) == 1 {
+			close(arrived)
+			<-release
+		}
+		writeChatResponse(w)
+	}))
+	defer upstream.Close()
+	srv := newLimitedProxy(t, upstream, config.LimitsConfig{MaxInFlightPerKey: 1})
+
+	send := func(key string) *httptest.ResponseRecorder {
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- send("key-a") }()
+	<-arrived
+
+	if w := send("key-a"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second concurrent request for key-a: status %d, want 429", w.Code)
+	} else if w.Header().Get("Retry-After") == "" {
+		t.Error("429 should carry Retry-After")
+	}
+	if w := send("key-b"); w.Code != http.StatusOK {
+		t.Errorf("key-b should not be limited by key-a: status %d", w.Code)
+	}
+
+	close(release)
+	if w := <-done; w.Code != http.StatusOK {
+		t.Fatalf("held request: status %d", w.Code)
+	}
+	if w := send("key-a"); w.Code != http.StatusOK {
+		t.Errorf("key-a after release: status %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	upstream := newUpstream() // 15 tokens per response
+	defer upstream.Close()
+	tr, err := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tr.Close() }()
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{Name: "test", URL: upstream.URL, APIKey: "sk-provider"}},
+		RateLimits: []config.RateLimit{
+			{APIKey: "tpm-key", TPM: 10},
+			{APIKey: "rpm-key", Model: "gpt-4", RPM: 1},
+		},
+	}
+	srv := New(cfg, tr, nil, nil, nil)
+
+	send := func(key, model string) *httptest.ResponseRecorder {
+		body := `{"model":"` + model + `","messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name, key, model string
+		want             int
+		wantMsg          string
+	}{
+		{"first request within TPM", "tpm-key", "gpt-4", http.StatusOK, ""},
+		{"response overdrew TPM", "tpm-key", "gpt-4", http.StatusTooManyRequests, "tokens per minute"},
+		{"first request within RPM", "rpm-key", "gpt-4", http.StatusOK, ""},
+		{"RPM exhausted", "rpm-key", "gpt-4", http.StatusTooManyRequests, "requests per minute"},
+		{"RPM limit is per model", "rpm-key", "gpt-4o", http.StatusOK, ""},
+		{"unlimited key", "other-key", "gpt-4", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		w := send(tt.key, tt.model)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+			continue
+		}
+		if tt.want == http.StatusTooManyRequests {
+			if !strings.Contains(w.Body.String(), tt.wantMsg) {
+				t.Errorf("%s: body %s, want %q", tt.name, w.Body.String(), tt.wantMsg)
+			}
+			if w.Header().Get("Retry-After") == "" {
+				t.Errorf("%s: missing Retry-After", tt.name)
+			}
+		}
+	}
+}
+
+func TestRateLimitReserve(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+	tr, err := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tr.Close() }()
+	cfg := &config.Config{
+		Providers:  []config.ProviderConfig{{Name: "test", URL: upstream.URL, APIKey: "sk-provider"}},
+		RateLimits: []config.RateLimit{{APIKey: "*", RPM: 2, Reserve: 0.5}},
+	}
+	srv := New(cfg, tr, nil, nil, nil)
+
+	for i, tt := range []struct {
+		priority string
+		want     int
+	}{
+		{"normal", http.StatusOK},
+		{"low", http.StatusTooManyRequests}, // the last request is reserved
+		{"high", http.StatusOK},
+		{"high", http.StatusTooManyRequests},
+	} {
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		req.Header.Set("X-Pario-Priority", tt.priority)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("request %d (%s): status %d, want %d", i+1, tt.priority, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/pario-ai/pario/pkg/middleware"
+)
+
+// middlewareKey is the context key for the request's middleware state.
+type middlewareKey struct{}
+
+// beforeRoute runs the middleware chain's BeforeRoute hooks on a parsed
+// request. When a hook rewrites the body, parse re-parses it. It returns r
+// carrying the middleware state, which later hooks and upstream requests
+// read, and the body to forward; or it writes the error response and
+// returns false.
+func (s *Server) beforeRoute(w http.ResponseWriter, r *http.Request, endpoint, clientKey, model string, body []byte, parse func([]byte) error) (*http.Request, []byte, bool) {
+	if len(s.hooks) == 0 {
+		return r, body, true
+	}
+	mreq := &middleware.Request{
+		Endpoint: endpoint,
+		APIKey:   clientKey,
+		Model:    model,
+		Body:     body,
+		Header:   http.Header{},
+	}
+	if err := s.hooks.BeforeRoute(r.Context(), mreq); err != nil {
+		var rej *middleware.RejectError
+		if errors.As(err, &rej) {
+			writeJSONError(w, rej.StatusCode, rej.Message)
+			return nil, nil, false
+		}
+		log.Printf("middleware error: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "middleware failed")
+		return nil, nil, false
+	}
+	if string(mreq.Body) != string(body) {
+		if err := parse(mreq.Body); err != nil {
+			log.Printf("middleware produced an invalid body: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "middleware failed")
+			return nil, nil, false
+		}
+	}
+	return r.WithContext(context.WithValue(r.Context(), middlewareKey{}, mreq)), mreq.Body, true
+}
+
+// afterResponse runs the middleware chain's AfterResponse hooks.
+func (s *Server) afterResponse(r *http.Request, resp *middleware.Response) {
+	mreq, ok := r.Context().Value(middlewareKey{}).(*middleware.Request)
+	if !ok {
+		return
+	}
+	if err := s.hooks.AfterResponse(r.Context(), mreq, resp); err != nil {
+		log.Printf("middleware error: %v", err)
+	}
+}
+
+// writeResponse runs the AfterResponse hooks on a buffered response and
+// writes it to the client.
+func (s *Server) writeResponse(w http.ResponseWriter, r *http.Request, resp *middleware.Response) {
+	s.afterResponse(r, resp)
+	for k, vals := range resp.Header {
+		for _, v := range vals {
+			w.Header().Add(k, v)
+		}
+	}
+	if w.Header().Get("Content-Length") != "" {
+		// A hook may have rewritten the body.
+		w.Header().Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(resp.Body)
+}
+
+// setUpstreamHeaders adds the headers middleware set for upstream requests.
+// Callers set provider credentials afterwards so they always win.
+func setUpstreamHeaders(req *http.Request) {
+	mreq, ok := req.Context().Value(middlewareKey{}).(*middleware.Request)
+	if !ok {
+		return
+	}
+	for k, vals := range mreq.Header {
+		req.Header[k] = vals
+	}
+}
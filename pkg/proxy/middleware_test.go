@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pario-ai/pario/pkg/middleware"
+	"github.com/pario-ai/pario/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	var upstreamBody []byte
+	var upstreamHeader http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamBody, _ = io.ReadAll(r.Body)
+		upstreamHeader = r.Header.Clone()
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{
+			ID:    "chatcmpl-1",
+			Model: "gpt-4",
+			Usage: &models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		})
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	var cfgs []middleware.Config
+	err := yaml.Unmarshal([]byte(`
+- type: headers
+  request:
+    X-Org: acme
+    Authorization: Bearer stolen
+  response:
+    X-Served-By: pario
+- type: system_prompt
+  text: Be concise.
+`), &cfgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks, err := middleware.New(cfgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen []*middleware.Response
+	srv.hooks = append(hooks, middleware.Funcs{
+		Before: func(_ context.Context, req *middleware.Request) error {
+			if req.APIKey == "blocked-key" {
+				return &middleware.RejectError{StatusCode: http.StatusForbidden, Message: "key blocked"}
+			}
+			return nil
+		},
+		After: func(_ context.Context, _ *middleware.Request, resp *middleware.Response) error {
+			seen = append(seen, resp)
+			return nil
+		},
+	})
+
+	send := func(key string) *httptest.ResponseRecorder {
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("client-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := upstreamHeader.Get("X-Org"); got != "acme" {
+		t.Errorf("upstream X-Org = %q, want acme", got)
+	}
+	if got := upstreamHeader.Get("Authorization"); got != "Bearer sk-provider" {
+		t.Errorf("upstream Authorization = %q, middleware must not override credentials", got)
+	}
+	var sent struct {
+		Messages []models.ChatMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(upstreamBody, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent.Messages) != 2 || sent.Messages[0].Role != "system" || sent.Messages[0].Content != "Be concise." {
+		t.Errorf("upstream messages = %+v, want system prompt first", sent.Messages)
+	}
+	if got := w.Header().Get("X-Served-By"); got != "pario" {
+		t.Errorf("X-Served-By = %q, want pario", got)
+	}
+	if len(seen) != 1 || seen[0].Provider != "test" || seen[0].Cached {
+		t.Fatalf("after hooks saw %+v, want one upstream response from test", seen)
+	}
+
+	// The rewritten request is what gets cached, so the repeat hits.
+	w = send("client-key")
+	if w.Header().Get("X-Pario-Cache") != "hit" || w.Header().Get("X-Served-By") != "pario" {
+		t.Errorf("second request headers = %v, want a cache hit stamped by middleware", w.Header())
+	}
+	if len(seen) != 2 || !seen[1].Cached {
+		t.Errorf("after hooks should see the cache hit")
+	}
+
+	w = send("blocked-key")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("blocked key: expected 403, got %d", w.Code)
+	}
+}
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/router"
+)
+
+// modelsTTL is how long a provider's model list is reused. SDKs list models
+// on startup, so without it every client start would fan out to each
+// provider.
+const modelsTTL = 5 * time.Minute
+
+// modelObject is an entry of an OpenAI model list.
+type modelObject struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// modelLists caches the models each provider reports, keyed by provider
+// name.
+type modelLists struct {
+	mu    sync.Mutex
+	lists map[string]cachedModels
+}
+
+type cachedModels struct {
+	ids     []string
+	fetched time.Time
+}
+
+// handleModels serves GET /v1/models and /v1/models/{id} in OpenAI format.
+// The list is the union of the configured route aliases, owned by "pario",
+// and each provider's models, owned by the provider. Providers that can't
+// list models (Bedrock, Vertex, or one that fails) contribute the models
+// routes target on them.
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if extractAPIKey(r) == "" {
+		writeJSONError(w, http.StatusUnauthorized, "missing API key")
+		return
+	}
+
+	list := s.listModels(r.Context())
+	if id := strings.TrimPrefix(r.URL.Path, "/v1/models/"); id != r.URL.Path && id != "" {
+		for _, m := range list {
+			if m.ID == id {
+				writeJSON(w, m)
+				return
+			}
+		}
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("model %q not found", id))
+		return
+	}
+	writeJSON(w, struct {
+		Object string        `json:"object"`
+		Data   []modelObject `json:"data"`
+	}{"list", list})
+}
+
+// listModels returns route aliases first, then each provider's models in
+// provider order. A model ID appears once, under its first owner.
+func (s *Server) listModels(ctx context.Context) []modelObject {
+	cfg := s.router.Config()
+	now := time.Now().Unix()
+	seen := make(map[string]bool)
+	var list []modelObject
+	add := func(id, owner string) {
+		if id == "" || seen[id] {
+			return
+		}
+		seen[id] = true
+		list = append(list, modelObject{ID: id, Object: "model", Created: now, OwnedBy: owner})
+	}
+
+	targets := make(map[string][]string)
+	for _, rt := range cfg.Router.Routes {
+		// A pattern is not a model clients can ask for by name.
+		if !rt.IsPattern() {
+			add(rt.Model, "pario")
+		}
+		for _, t := range rt.Targets {
+			model := t.Model
+			if model == "" {
+				if rt.IsPattern() {
+					continue
+				}
+				model = rt.Model
+			}
+			targets[t.Provider] = append(targets[t.Provider], model)
+		}
+	}
+
+	fetched := make([][]string, len(cfg.Providers))
+	var wg sync.WaitGroup
+	for i, p := range cfg.Providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fetched[i] = s.providerModels(ctx, p)
+		}()
+	}
+	wg.Wait()
+
+	for i, p := range cfg.Providers {
+		// Copy: fetched lists are shared with the cache.
+		ids := append(append([]string(nil), fetched[i]...), targets[p.Name]...)
+		sort.Strings(ids)
+		for _, id := range ids {
+			add(id, p.Name)
+		}
+	}
+	return list
+}
+
+// providerModels returns the models p reports, from cache when fresh. A
+// failed fetch is logged and the previous list, if any, kept for another
+// modelsTTL.
+func (s *Server) providerModels(ctx context.Context, p config.ProviderConfig) []string {
+	s.modelLists.mu.Lock()
+	cached, ok := s.modelLists.lists[p.Name]
+	s.modelLists.mu.Unlock()
+	if ok && time.Since(cached.fetched) < modelsTTL {
+		return cached.ids
+	}
+
+	ids, err := fetchModels(ctx, p)
+	if err != nil {
+		log.Printf("list models for %s: %v", p.Name, err)
+		ids = cached.ids
+	}
+	s.modelLists.mu.Lock()
+	if s.modelLists.lists == nil {
+		s.modelLists.lists = make(map[string]cachedModels)
+	}
+	s.modelLists.lists[p.Name] = cachedModels{ids: ids, fetched: time.Now()}
+	s.modelLists.mu.Unlock()
+	return ids
+}
+
+// fetchModels lists the model IDs p serves. Bedrock and Vertex providers
+// have no OpenAI-style listing and return none.
+func fetchModels(ctx context.Context, p config.ProviderConfig) ([]string, error) {
+	var path string
+	header := make(http.Header)
+	switch p.Type {
+	case "bedrock", "vertex":
+		return nil, nil
+	case "anthropic":
+		path = "/v1/models?limit=1000"
+		header.Set("x-api-key", p.APIKey)
+		header.Set("anthropic-version", "2023-06-01")
+	default:
+		path = apiPath(router.Route{Provider: p}, "/models")
+		if p.APIKey != "" {
+			header.Set("Authorization", "Bearer "+p.APIKey)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(p.URL, "/")+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	setProviderHeaders(req, p)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := clientFor(p).buffered.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream returned %s", resp.Status)
+	}
+
+	var body struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode model list: %w", err)
+	}
+	ids := make([]string, 0, len(body.Data))
+	for _, m := range body.Data {
+		ids = append(ids, m.ID)
+	}
+	return ids, nil
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/tracker"
+)
+
+func TestModels(t *testing.T) {
+	var openaiCalls atomic.Int32
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.Header.Get("Authorization") != "Bearer sk-openai" {
+			t.Errorf("openai: unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		openaiCalls.Add(1)
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"gpt-4o","object":"model"},{"id":"gpt-4o-mini","object":"model"}]}`)
+	}))
+	defer openai.Close()
+	anthropic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "sk-ant" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("anthropic: missing credentials %v", r.Header)
+		}
+		fmt.Fprint(w, `{"data":[{"id":"claude-sonnet-4-5","type":"model"}],"has_more":false}`)
+	}))
+	defer anthropic.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	tr, _ := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	defer func() { _ = tr.Close() }()
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "openai", URL: openai.URL, APIKey: "sk-openai"},
+			{Name: "anthropic", Type: "anthropic", URL: anthropic.URL, APIKey: "sk-ant"},
+			{Name: "local", Type: "openai-compatible", URL: down.URL},
+		},
+		Router: config.RouterConfig{Routes: []config.RouteConfig{
+			{Model: "fast", Targets: []config.RouteTarget{{Provider: "openai", Model: "gpt-4o-mini"}, {Provider: "local", Model: "llama3"}}},
+			{Model: "smart", Targets: []config.RouteTarget{{Provider: "anthropic", Model: "claude-sonnet-4-5"}}},
+			// Patterns aren't listed.
+			{Model: "claude-*", Targets: []config.RouteTarget{{Provider: "anthropic"}}},
+		}},
+	}
+	srv := New(cfg, tr, nil, nil, nil)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/v1/models")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var list struct {
+		Object string        `json:"object"`
+		Data   []modelObject `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range list.Data {
+		got = append(got, m.ID+"@"+m.OwnedBy)
+	}
+	want := []string{"fast@pario", "smart@pario", "gpt-4o@openai", "gpt-4o-mini@openai", "claude-sonnet-4-5@anthropic", "llama3@local"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("models = %v, want %v", got, want)
+	}
+
+	get("/v1/models")
+	if n := openaiCalls.Load(); n != 1 {
+		t.Errorf("provider listed %d times, want 1 (cached)", n)
+	}
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/v1/models/fast", http.StatusOK},
+		{"/v1/models/gpt-4o", http.StatusOK},
+		{"/v1/models/unknown", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := get(tt.path); w.Code != tt.code {
+			t.Errorf("%s: status %d, want %d", tt.path, w.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"sort"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/jsonbody"
+	"github.com/pario-ai/pario/pkg/router"
+)
+
+// routeBody returns the body to send to route: the request with the
+// route's params applied and its model rewritten. messagesAPI selects the
+// Anthropic messages format over chat completions.
+func routeBody(body []byte, route router.Route, messagesAPI bool) []byte {
+	return rewriteModel(applyParams(body, route.Params, messagesAPI), route.Model)
+}
+
+// applyParams enforces p on a chat completions or messages request body.
+// Like rewriteModel, it splices each changed field into the original bytes.
+// A field that can't be changed is logged and left as it was.
+func applyParams(body []byte, p config.ParamsConfig, messagesAPI bool) []byte {
+	if p.IsZero() {
+		return body
+	}
+	var req map[string]json.RawMessage
+	if json.Unmarshal(body, &req) != nil {
+		return body
+	}
+	set := func(key string, value any) {
+		v, err := marshalText(value)
+		if err == nil {
+			var out []byte
+			if out, err = jsonbody.SetField(body, key, v); err == nil {
+				body = out
+				return
+			}
+		}
+		log.Printf("params: set %s: %v", key, err)
+	}
+
+	if p.MaxTokens > 0 {
+		capped := false
+		for _, k := range []string{"max_tokens", "max_completion_tokens"} {
+			var n int
+			if _, ok := req[k]; !ok {
+				continue
+			}
+			capped = true
+			if json.Unmarshal(req[k], &n) == nil && n > p.MaxTokens {
+				set(k, p.MaxTokens)
+			}
+		}
+		if !capped {
+			set("max_tokens", p.MaxTokens)
+		}
+	}
+
+	var temp float64
+	if t := req["temperature"]; t != nil && string(t) != "null" && json.Unmarshal(t, &temp) == nil {
+		clamped := temp
+		if p.MinTemperature != nil && clamped < *p.MinTemperature {
+			clamped = *p.MinTemperature
+		}
+		if p.MaxTemperature != nil && clamped > *p.MaxTemperature {
+			clamped = *p.MaxTemperature
+		}
+		if clamped != temp {
+			set("temperature", clamped)
+		}
+	}
+
+	var stream bool
+	_ = json.Unmarshal(req["stream"], &stream)
+	for _, k := range sortedKeys(p.Set) {
+		if k == "stream_options" && !stream {
+			continue
+		}
+		v := p.Set[k]
+		if obj, ok := v.(map[string]any); ok {
+			// Merge into the request's object, so keys the client or the
+			// proxy set, such as include_usage, survive.
+			if start, end, found, err := jsonbody.FieldSpan(body, k); err == nil && found && body[start] == '{' {
+				merged := append([]byte(nil), body[start:end]...)
+				for _, key := range sortedKeys(obj) {
+					ov, err := marshalText(obj[key])
+					if err != nil {
+						continue
+					}
+					if m, err := jsonbody.SetField(merged, key, ov); err == nil {
+						merged = m
+					}
+				}
+				if out, err := jsonbody.SetField(body, k, merged); err == nil {
+					body = out
+				}
+				continue
+			}
+		}
+		set(k, v)
+	}
+
+	if p.SystemPrefix != "" {
+		if messagesAPI {
+			body = prefixAnthropicSystem(body, req["system"], p.SystemPrefix)
+		} else {
+			body = prefixOpenAISystem(body, req["messages"], p.SystemPrefix)
+		}
+	}
+	return body
+}
+
+// marshalText encodes v like json.Marshal but without escaping <, >, and
+// &, so prompt text reaches the provider as written.
+func marshalText(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// joinArray encodes items as a JSON array without re-encoding them, which
+// would compact and re-escape the client's bytes.
+func joinArray(items []json.RawMessage) []byte {
+	out := []byte{'['}
+	for i, it := range items {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, it...)
+	}
+	return append(out, ']')
+}
+
+// prefixContent prepends prefix to a message's content: a string gets it
+// as a leading paragraph, and an array of parts a leading text part.
+func prefixContent(content json.RawMessage, prefix string) ([]byte, bool) {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		out, err := marshalText(prefix + "\n\n" + text)
+		return out, err == nil
+	}
+	var parts []json.RawMessage
+	if json.Unmarshal(content, &parts) != nil {
+		return nil, false
+	}
+	part, err := marshalText(map[string]string{"type": "text", "text": prefix})
+	if err != nil {
+		return nil, false
+	}
+	return joinArray(append([]json.RawMessage{part}, parts...)), true
+}
+
+// prefixAnthropicSystem prepends prefix to a messages request's top-level
+// system prompt, or sets it as the system prompt.
+func prefixAnthropicSystem(body []byte, system json.RawMessage, prefix string) []byte {
+	var value []byte
+	var err error
+	ok := true
+	if len(system) == 0 || string(system) == "null" {
+		value, err = marshalText(prefix)
+		ok = err == nil
+	} else {
+		value, ok = prefixContent(system, prefix)
+	}
+	if !ok {
+		return body
+	}
+	if out, err := jsonbody.SetField(body, "system", value); err == nil {
+		return out
+	}
+	return body
+}
+
+// prefixOpenAISystem prepends prefix to a chat completions request's
+// leading system or developer message, or adds a system message before
+// the others.
+func prefixOpenAISystem(body []byte, messages json.RawMessage, prefix string) []byte {
+	var msgs []json.RawMessage
+	if json.Unmarshal(messages, &msgs) != nil {
+		return body
+	}
+	if len(msgs) > 0 && (messageRole(msgs[0]) == "system" || messageRole(msgs[0]) == "developer") {
+		var m struct {
+			Content json.RawMessage `json:"content"`
+		}
+		_ = json.Unmarshal(msgs[0], &m)
+		content, ok := prefixContent(m.Content, prefix)
+		if !ok {
+			return body
+		}
+		first, err := jsonbody.SetField(msgs[0], "content", content)
+		if err != nil {
+			return body
+		}
+		msgs[0] = first
+	} else {
+		sys, err := marshalText(map[string]string{"role": "system", "content": prefix})
+		if err != nil {
+			return body
+		}
+		msgs = append([]json.RawMessage{sys}, msgs...)
+	}
+	if out, err := jsonbody.SetField(body, "messages", joinArray(msgs)); err == nil {
+		return out
+	}
+	return body
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/tracker"
+)
+
+func TestApplyParams(t *testing.T) {
+	lo, hi := 0.2, 1.0
+	tests := []struct {
+		name        string
+		params      config.ParamsConfig
+		messagesAPI bool
+		body        string
+		want        string
+	}{
+		{
+			name: "no params",
+			body: `{"model":"m", "max_tokens": 9000}`,
+			want: `{"model":"m", "max_tokens": 9000}`,
+		},
+		{
+			name:   "cap max_tokens",
+			params: config.ParamsConfig{MaxTokens: 1024},
+			body:   `{"model":"m","max_tokens":9000,"max_completion_tokens":512}`,
+			want:   `{"model":"m","max_tokens":1024,"max_completion_tokens":512}`,
+		},
+		{
+			name:   "inject max_tokens",
+			params: config.ParamsConfig{MaxTokens: 1024},
+			body:   `{"model":"m","messages":[]}`,
+			want:   `{"max_tokens":1024,"model":"m","messages":[]}`,
+		},
+		{
+			name:   "clamp temperature",
+			params: config.ParamsConfig{MinTemperature: &lo, MaxTemperature: &hi},
+			body:   `{"model":"m","temperature":1.7}`,
+			want:   `{"model":"m","temperature":1}`,
+		},
+		{
+			name:   "temperature in range or unset",
+			params: config.ParamsConfig{MinTemperature: &lo, MaxTemperature: &hi},
+			body:   `{"model":"m","temperature":null}`,
+			want:   `{"model":"m","temperature":null}`,
+		},
+		{
+			name:   "set merges stream_options",
+			params: config.ParamsConfig{Set: map[string]any{"stream_options": map[string]any{"continuous_usage_stats": true}, "user": "pario"}},
+			body:   `{"model":"m","stream":true,"stream_options":{"include_usage":true}}`,
+			want:   `{"user":"pario","model":"m","stream":true,"stream_options":{"continuous_usage_stats":true,"include_usage":true}}`,
+		},
+		{
+			name:   "stream_options skipped without stream",
+			params: config.ParamsConfig{Set: map[string]any{"stream_options": map[string]any{"include_usage": true}}},
+			body:   `{"model":"m"}`,
+			want:   `{"model":"m"}`,
+		},
+		{
+			name:   "system prefix on system message",
+			params: config.ParamsConfig{SystemPrefix: "Be brief."},
+			body:   `{"model":"m","messages":[{"role":"system","content":"You help <users>."},{"role":"user","content":"hi"}]}`,
+			want:   `{"model":"m","messages":[{"role":"system","content":"Be brief.\n\nYou help <users>."},{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name:   "system prefix added as message",
+			params: config.ParamsConfig{SystemPrefix: "Be brief."},
+			body:   `{"model":"m","messages":[{"role":"user", "content":"<b>hi</b>"}]}`,
+			want:   `{"model":"m","messages":[{"content":"Be brief.","role":"system"},{"role":"user", "content":"<b>hi</b>"}]}`,
+		},
+		{
+			name:        "system prefix on anthropic blocks",
+			params:      config.ParamsConfig{SystemPrefix: "Be brief."},
+			messagesAPI: true,
+			body:        `{"model":"m","system":[{"type":"text","text":"You help."}],"messages":[]}`,
+			want:        `{"model":"m","system":[{"text":"Be brief.","type":"text"},{"type":"text","text":"You help."}],"messages":[]}`,
+		},
+		{
+			name:        "system prefix sets anthropic system",
+			params:      config.ParamsConfig{SystemPrefix: "Be brief."},
+			messagesAPI: true,
+			body:        `{"model":"m","messages":[]}`,
+			want:        `{"system":"Be brief.","model":"m","messages":[]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(applyParams([]byte(tt.body), tt.params, tt.messagesAPI))
+			if got != tt.want {
+				t.Errorf("applyParams =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParamsOverride(t *testing.T) {
+	route := config.ParamsConfig{MaxTokens: 4096, SystemPrefix: "route", Set: map[string]any{"user": "a", "seed": 1}}
+	got := route.Override(config.ParamsConfig{MaxTokens: 1024, Set: map[string]any{"user": "b"}})
+	if got.MaxTokens != 1024 || got.SystemPrefix != "route" || got.Set["user"] != "b" || got.Set["seed"] != 1 {
+		t.Errorf("unexpected override %+v", got)
+	}
+	if route.Set["user"] != "a" {
+		t.Error("override modified the route's params")
+	}
+}
+
+func TestRouteParamsSentUpstream(t *testing.T) {
+	var got map[string]json.RawMessage
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &got)
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{Model: "gpt-4o-mini", Usage: &models.Usage{TotalTokens: 2}})
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{Name: "openai", URL: upstream.URL, APIKey: "sk-1"}},
+		Router: config.RouterConfig{Routes: []config.RouteConfig{{
+			Model:  "agent",
+			Params: config.ParamsConfig{MaxTokens: 4096, SystemPrefix: "Be brief."},
+			Targets: []config.RouteTarget{
+				{Provider: "openai", Model: "gpt-4o-mini", Params: config.ParamsConfig{MaxTokens: 1024}},
+			},
+		}}},
+	}
+	tr, err := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tr.Close() }()
+	srv := New(cfg, tr, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"agent","max_tokens":100000,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if string(got["max_tokens"]) != "1024" {
+		t.Errorf("max_tokens upstream = %s, want the target's cap 1024", got["max_tokens"])
+	}
+	if !strings.Contains(string(got["messages"]), `"Be brief."`) {
+		t.Errorf("expected system prefix from the route, got %s", got["messages"])
+	}
+}
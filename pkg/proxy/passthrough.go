@@ -0,0 +1,279 @@
+package proxy
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/audit"
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// handlePassthrough relays requests no other handler serves to the first
+// configured provider. Responses of metered endpoints (see meteredEndpoint)
+// are inspected for usage; everything else is relayed blind.
+func (s *Server) handlePassthrough(w http.ResponseWriter, r *http.Request) {
+	if len(s.cfg.Providers) == 0 {
+		writeJSONError(w, http.StatusServiceUnavailable, "no providers configured")
+		return
+	}
+
+	provider := s.cfg.Providers[0]
+	target, err := url.Parse(provider.URL)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "invalid provider URL")
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Transport: s.observing(provider, clientFor(provider).stream.Transport),
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.Host = target.Host
+			setProviderHeaders(req, provider)
+			req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+			// Let the transport negotiate compression so metered
+			// responses arrive decoded.
+			req.Header.Del("Accept-Encoding")
+		},
+	}
+
+	endpoint := meteredEndpoint(r.URL.Path)
+	clientKey := extractAPIKey(r)
+	if endpoint == "" || clientKey == "" {
+		proxy.ServeHTTP(w, r)
+		return
+	}
+
+	var reqBody []byte
+	var req struct {
+		Model string `json:"model"`
+	}
+	if r.Method == http.MethodPost {
+		var ok bool
+		if reqBody, ok = readBody(w, r); !ok {
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(reqBody))
+		_ = json.Unmarshal(reqBody, &req)
+		noteModel(r, req.Model)
+		if endpoint != "moderations" && !s.checkBudget(w, r, clientKey, req.Model) {
+			return
+		}
+	}
+
+	t := &meteredTracker{s: s, r: r, clientKey: clientKey, provider: provider.Name, endpoint: endpoint, start: time.Now()}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+			if resp.StatusCode == http.StatusOK {
+				resp.Body = &sseReader{ReadCloser: resp.Body, onData: t.onEvent}
+			}
+			return nil
+		}
+		if resp.ContentLength > maxAssistantsBody {
+			return nil
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxAssistantsBody+1))
+		_ = resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if len(body) > maxAssistantsBody {
+			return nil
+		}
+		usage := models.Usage{}
+		if resp.StatusCode == http.StatusOK {
+			usage = t.inspectJSON(body)
+		}
+		if s.auditor != nil && r.Method == http.MethodPost {
+			keyHash, keyPrefix := audit.HashAPIKey(clientKey)
+			s.logAudit(models.AuditEntry{
+				RequestID:        auditRequestID(r),
+				APIKeyHash:       keyHash,
+				APIKeyPrefix:     keyPrefix,
+				Model:            req.Model,
+				Provider:         provider.Name,
+				RequestBody:      string(reqBody),
+				ResponseBody:     string(body),
+				StatusCode:       resp.StatusCode,
+				PromptTokens:     usage.PromptTokens,
+				CompletionTokens: usage.CompletionTokens,
+				TotalTokens:      usage.TotalTokens,
+				LatencyMs:        time.Since(t.start).Milliseconds(),
+				CreatedAt:        time.Now().UTC(),
+			})
+		}
+		return nil
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// meteredEndpoint returns the usage endpoint of a passthrough path whose
+// responses report usage: legacy completions, the Responses API,
+// moderations, and fine-tuning jobs. Other paths return "".
+func meteredEndpoint(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "v1" {
+		return ""
+	}
+	switch {
+	case len(parts) == 2 && (parts[1] == "completions" || parts[1] == "moderations"):
+		return parts[1]
+	case parts[1] == "responses" && len(parts) <= 3:
+		// /v1/responses and /v1/responses/{id}
+		return "responses"
+	case parts[1] == "fine_tuning" && len(parts) >= 3 && len(parts) <= 4 && parts[2] == "jobs":
+		// /v1/fine_tuning/jobs and /v1/fine_tuning/jobs/{id}
+		return "fine_tuning"
+	}
+	return ""
+}
+
+// meteredObject holds the fields of a passthrough response that carry
+// usage. Lists of fine-tuning jobs put the jobs in Data; Responses API
+// stream events wrap the response in Response.
+type meteredObject struct {
+	ID            string          `json:"id"`
+	Object        string          `json:"object"`
+	Model         string          `json:"model"`
+	Status        string          `json:"status"`
+	Usage         *meteredUsage   `json:"usage"`
+	TrainedTokens int             `json:"trained_tokens"`
+	Data          []meteredObject `json:"data"`
+	Response      *meteredObject  `json:"response"`
+}
+
+// meteredUsage accepts both the Chat Completions and the Responses API
+// names for token counts.
+type meteredUsage struct {
+	PromptTokens            int                             `json:"prompt_tokens"`
+	CompletionTokens        int                             `json:"completion_tokens"`
+	InputTokens             int                             `json:"input_tokens"`
+	OutputTokens            int                             `json:"output_tokens"`
+	TotalTokens             int                             `json:"total_tokens"`
+	PromptTokensDetails     *models.PromptTokensDetails     `json:"prompt_tokens_details"`
+	InputTokensDetails      *models.PromptTokensDetails     `json:"input_tokens_details"`
+	CompletionTokensDetails *models.CompletionTokensDetails `json:"completion_tokens_details"`
+	OutputTokensDetails     *models.CompletionTokensDetails `json:"output_tokens_details"`
+}
+
+func (u *meteredUsage) usage() models.Usage {
+	out := models.Usage{
+		PromptTokens:            u.PromptTokens + u.InputTokens,
+		CompletionTokens:        u.CompletionTokens + u.OutputTokens,
+		TotalTokens:             u.TotalTokens,
+		PromptTokensDetails:     cmp.Or(u.PromptTokensDetails, u.InputTokensDetails),
+		CompletionTokensDetails: cmp.Or(u.CompletionTokensDetails, u.OutputTokensDetails),
+	}
+	if out.TotalTokens == 0 {
+		out.TotalTokens = out.PromptTokens + out.CompletionTokens
+	}
+	return out
+}
+
+// meteredTracker records usage seen in the responses of one passthrough
+// request.
+type meteredTracker struct {
+	s         *Server
+	r         *http.Request
+	clientKey string
+	provider  string
+	endpoint  string
+	start     time.Time
+	streamed  bool
+}
+
+// inspectJSON records the usage in a response body and returns it.
+func (t *meteredTracker) inspectJSON(body []byte) models.Usage {
+	var obj meteredObject
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return models.Usage{}
+	}
+	if t.endpoint == "fine_tuning" && obj.Object == "list" {
+		var total models.Usage
+		for _, job := range obj.Data {
+			total.TotalTokens += t.record(job).TotalTokens
+		}
+		return total
+	}
+	return t.record(obj)
+}
+
+// onEvent records the usage in a streamed response: the final chunk of a
+// completions stream or the terminal event of a Responses API stream.
+func (t *meteredTracker) onEvent(_, data string) {
+	if data == "[DONE]" {
+		return
+	}
+	var obj meteredObject
+	if err := json.Unmarshal([]byte(data), &obj); err != nil {
+		return
+	}
+	t.streamed = true
+	if obj.Response != nil {
+		obj = *obj.Response
+	}
+	t.record(obj)
+}
+
+// record stores the usage of obj, if it is final, and returns it.
+func (t *meteredTracker) record(obj meteredObject) models.Usage {
+	rec := models.UsageRecord{
+		APIKey:   t.clientKey,
+		Model:    obj.Model,
+		Provider: t.provider,
+		Endpoint: t.endpoint,
+		Streamed: t.streamed,
+	}
+	switch t.endpoint {
+	case "completions":
+		if obj.Usage == nil {
+			return models.Usage{}
+		}
+	case "responses":
+		// Polling a response returns it again; its ID deduplicates.
+		if obj.Object != "response" || obj.Usage == nil || obj.Status == "in_progress" || obj.Status == "queued" {
+			return models.Usage{}
+		}
+		rec.RequestID, rec.Attempt = obj.ID, 1
+	case "moderations":
+		// Free, but counted as requests.
+		if obj.Model == "" {
+			return models.Usage{}
+		}
+	case "fine_tuning":
+		// Training tokens are billed once the job succeeds. They aren't
+		// prompt or completion tokens, so only the total is set.
+		if obj.Object != "fine_tuning.job" || obj.Status != "succeeded" || obj.TrainedTokens <= 0 {
+			return models.Usage{}
+		}
+		rec.RequestID, rec.Attempt = obj.ID, 1
+		rec.TotalTokens = obj.TrainedTokens
+		t.s.recordUsage(t.r, rec)
+		return models.Usage{TotalTokens: obj.TrainedTokens}
+	}
+
+	var u models.Usage
+	if obj.Usage != nil {
+		u = obj.Usage.usage()
+	}
+	rec.PromptTokens, rec.CompletionTokens, rec.TotalTokens = u.PromptTokens, u.CompletionTokens, u.TotalTokens
+	rec.CacheReadTokens, rec.CacheCreationTokens, rec.ReasoningTokens = u.CacheReadTokens(), u.CacheCreationTokens(), u.ReasoningTokens()
+	if t.r.Method == http.MethodPost {
+		rec.LatencyMs = time.Since(t.start).Milliseconds()
+	}
+	if t.endpoint != "moderations" {
+		rec.SessionID = t.s.resolveSessionID(t.r, t.clientKey)
+	}
+	noteModel(t.r, obj.Model)
+	t.s.recordUsage(t.r, rec)
+	return u
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestMeteredEndpoint(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"/v1/completions", "completions"},
+		{"/v1/responses", "responses"},
+		{"/v1/responses/resp_1", "responses"},
+		{"/v1/responses/resp_1/input_items", ""},
+		{"/v1/moderations", "moderations"},
+		{"/v1/fine_tuning/jobs", "fine_tuning"},
+		{"/v1/fine_tuning/jobs/ftjob_1", "fine_tuning"},
+		{"/v1/fine_tuning/jobs/ftjob_1/events", ""},
+		{"/v1/models", ""},
+		{"/v1/files", ""},
+	}
+	for _, tt := range tests {
+		if got := meteredEndpoint(tt.path); got != tt.want {
+			t.Errorf("meteredEndpoint(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPassthroughTracking(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/completions":
+			writeMaybeGzip(w, r, http.StatusOK, `{"id":"cmpl-1","object":"text_completion","model":"gpt-3.5-turbo-instruct","usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`)
+		case "/v1/responses":
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: response.created\ndata: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_1\",\"object\":\"response\",\"status\":\"in_progress\",\"model\":\"gpt-4o\"}}\n\n")
+			fmt.Fprint(w, "event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"object\":\"response\",\"status\":\"completed\",\"model\":\"gpt-4o\",\"usage\":{\"input_tokens\":20,\"output_tokens\":4,\"total_tokens\":24}}}\n\n")
+		case "/v1/responses/resp_1":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id":"resp_1","object":"response","status":"completed","model":"gpt-4o","usage":{"input_tokens":20,"output_tokens":4,"total_tokens":24}}`)
+		case "/v1/moderations":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id":"modr-1","model":"omni-moderation-latest","results":[]}`)
+		case "/v1/fine_tuning/jobs":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"object":"list","data":[{"id":"ftjob_1","object":"fine_tuning.job","model":"gpt-4o-mini","status":"succeeded","trained_tokens":1000},{"id":"ftjob_2","object":"fine_tuning.job","model":"gpt-4o-mini","status":"running","trained_tokens":null}]}`)
+		case "/v1/fine_tuning/jobs/ftjob_1":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id":"ftjob_1","object":"fine_tuning.job","model":"gpt-4o-mini","status":"succeeded","trained_tokens":1000}`)
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+
+	requests := []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/v1/completions", `{"model":"gpt-3.5-turbo-instruct","prompt":"hi"}`},
+		{http.MethodPost, "/v1/responses", `{"model":"gpt-4o","input":"hi","stream":true}`},
+		{http.MethodGet, "/v1/responses/resp_1", ""}, // fetched again: deduplicated
+		{http.MethodPost, "/v1/moderations", `{"input":"hi"}`},
+		{http.MethodGet, "/v1/fine_tuning/jobs", ""},
+		{http.MethodGet, "/v1/fine_tuning/jobs/ftjob_1", ""}, // deduplicated
+	}
+	for _, rq := range requests {
+		req := httptest.NewRequest(rq.method, rq.path, strings.NewReader(rq.body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: expected 200, got %d", rq.method, rq.path, w.Code)
+		}
+		// The relayed body is intact.
+		if !strings.Contains(w.Body.String(), `"model"`) {
+			t.Errorf("%s: body not relayed: %s", rq.path, w.Body.String())
+		}
+	}
+
+	recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	byEndpoint := make(map[string][]models.UsageRecord)
+	for _, r := range recs {
+		byEndpoint[r.Endpoint] = append(byEndpoint[r.Endpoint], r)
+	}
+	tests := []struct {
+		endpoint      string
+		model         string
+		prompt, compl int
+		total         int
+		streamed      bool
+	}{
+		{"completions", "gpt-3.5-turbo-instruct", 5, 7, 12, false},
+		{"responses", "gpt-4o", 20, 4, 24, true},
+		{"moderations", "omni-moderation-latest", 0, 0, 0, false},
+		{"fine_tuning", "gpt-4o-mini", 0, 0, 1000, false},
+	}
+	for _, tt := range tests {
+		got := byEndpoint[tt.endpoint]
+		if len(got) != 1 {
+			t.Errorf("%s: expected 1 record, got %d: %+v", tt.endpoint, len(got), got)
+			continue
+		}
+		r := got[0]
+		if r.Model != tt.model || r.PromptTokens != tt.prompt || r.CompletionTokens != tt.compl ||
+			r.TotalTokens != tt.total || r.Streamed != tt.streamed || r.Provider != "test" {
+			t.Errorf("%s: unexpected record %+v", tt.endpoint, r)
+		}
+	}
+}
+
+func TestPassthroughUnmeteredUntracked(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"vs_1","object":"vector_store","usage_bytes":9}]}`)
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	req := httptest.NewRequest(http.MethodGet, "/v1/vector_stores", nil)
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 0 {
+		t.Errorf("expected no records, got %+v", recs)
+	}
+}
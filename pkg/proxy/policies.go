@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/tracker"
+)
+
+// handlePolicies lists managed budget policies (GET) or creates one (POST).
+func (s *Server) handlePolicies(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.policyStore(w)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		policies, err := store.ManagedPolicies(r.Context())
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "list budget policies failed")
+			return
+		}
+		writeJSON(w, append([]models.ManagedBudgetPolicy{}, policies...))
+	case http.MethodPost:
+		p, ok := decodePolicy(w, r)
+		if !ok {
+			return
+		}
+		p, err := store.CreatePolicy(r.Context(), p)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "create budget policy failed")
+			return
+		}
+		s.reloadManaged(r.Context(), store)
+		log.Printf("budget policy %d created: %s %s/%s", p.ID, p.Subject(), p.FormatLimit(), p.Period)
+		w.Header().Set("Location", adminPrefix+"policies/"+strconv.FormatInt(p.ID, 10))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(p)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "use GET or POST")
+	}
+}
+
+// handlePolicy reads (GET), replaces (PUT), or deletes (DELETE) one managed
+// budget policy, addressed as policies/{id}.
+func (s *Server) handlePolicy(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.policyStore(w)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, adminPrefix+"policies/"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "unknown budget policy")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		policies, err := store.ManagedPolicies(r.Context())
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "get budget policy failed")
+			return
+		}
+		for _, p := range policies {
+			if p.ID == id {
+				writeJSON(w, p)
+				return
+			}
+		}
+		writeJSONError(w, http.StatusNotFound, "unknown budget policy")
+	case http.MethodPut:
+		p, ok := decodePolicy(w, r)
+		if !ok {
+			return
+		}
+		p.ID = id
+		p, err := store.UpdatePolicy(r.Context(), p)
+		if errors.Is(err, tracker.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "unknown budget policy")
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "update budget policy failed")
+			return
+		}
+		s.reloadManaged(r.Context(), store)
+		log.Printf("budget policy %d updated: %s %s/%s", p.ID, p.Subject(), p.FormatLimit(), p.Period)
+		writeJSON(w, p)
+	case http.MethodDelete:
+		err := store.DeletePolicy(r.Context(), id)
+		if errors.Is(err, tracker.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "unknown budget policy")
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "delete budget policy failed")
+			return
+		}
+		s.reloadManaged(r.Context(), store)
+		log.Printf("budget policy %d deleted", id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "use GET, PUT, or DELETE")
+	}
+}
+
+// policyStore returns the tracker that stores managed budget policies,
+// writing the error response when there is none.
+func (s *Server) policyStore(w http.ResponseWriter) (tracker.PolicyStore, bool) {
+	if s.enforcer == nil {
+		writeJSONError(w, http.StatusNotFound, "budget enforcement is disabled")
+		return nil, false
+	}
+	store, ok := s.tracker.(tracker.PolicyStore)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, "budget policies need the SQLite or remote tracker")
+		return nil, false
+	}
+	return store, true
+}
+
+// decodePolicy reads and validates a managed budget policy from the request
+// body, writing the error response when it is invalid.
+func decodePolicy(w http.ResponseWriter, r *http.Request) (models.ManagedBudgetPolicy, bool) {
+	var p models.ManagedBudgetPolicy
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid budget policy: "+err.Error())
+		return p, false
+	}
+	if err := p.ValidateAt(time.Now()); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid budget policy: "+err.Error())
+		return p, false
+	}
+	return p, true
+}
+
+// SyncPolicies reloads the managed budget policies from the tracker every
+// interval until ctx is cancelled, picking up changes made by other
+// replicas sharing its database or tracker server, or through the MCP
+// server.
+func (s *Server) SyncPolicies(ctx context.Context, interval time.Duration) {
+	store, ok := s.tracker.(tracker.PolicyStore)
+	if !ok || s.enforcer == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reloadManaged(ctx, store)
+		}
+	}
+}
+
+// reloadManaged applies the stored managed policies to the live enforcer
+// and to a staged one under canary evaluation.
+func (s *Server) reloadManaged(ctx context.Context, store tracker.PolicyStore) {
+	managed, err := store.ManagedPolicies(ctx)
+	if err != nil {
+		log.Printf("reload budget policies: %v", err)
+		return
+	}
+	s.enforcer.SetManaged(managed)
+	s.canaryMu.Lock()
+	if st := s.staged; st != nil && st.enforcer != nil {
+		st.enforcer.SetManaged(managed)
+	}
+	s.canaryMu.Unlock()
+}
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/budget"
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/tracker"
+)
+
+func TestAdminPolicies(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Admin.Token = "secret"
+	srv.enforcer = budget.New([]models.BudgetPolicy{{APIKey: "*", MaxTokens: 10, Period: models.BudgetDaily}}, srv.tracker)
+
+	// Each request is distinct, so none is served from the cache.
+	n := 0
+	chat := func() int {
+		t.Helper()
+		n++
+		body := fmt.Sprintf(`{"model":"gpt-4","messages":[{"role":"user","content":"hi %d"}]}`, n)
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer sk-client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w.Code
+	}
+	admin := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	// The first request uses 15 tokens, past the configured limit of 10.
+	chat()
+	if code := chat(); code != http.StatusTooManyRequests {
+		t.Fatalf("over configured limit: status %d, want 429", code)
+	}
+
+	for _, body := range []string{
+		`{"max_tokens":1000,"period":"daily"}`,
+		`{"api_key":"*","max_tokens":1000,"period":"weekly"}`,
+		`{"api_key":"*","max_tokens":1000,"period":"daily","expires_at":"2020-01-01T00:00:00Z"}`,
+		`{"api_key":"sk-1","team":"ml","max_tokens":1000,"period":"daily"}`,
+	} {
+		if w := admin(http.MethodPost, "/pario/admin/policies", body); w.Code != http.StatusBadRequest {
+			t.Errorf("POST %s: status %d, want 400", body, w.Code)
+		}
+	}
+
+	// A temporary increase replaces the configured policy of the same scope.
+	expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	w := admin(http.MethodPost, "/pario/admin/policies", `{"api_key":"*","max_tokens":1000,"period":"daily","expires_at":"`+expires+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST: status %d: %s", w.Code, w.Body.String())
+	}
+	var created models.ManagedBudgetPolicy
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == 0 || created.MaxTokens != 1000 || created.ExpiresAt.IsZero() {
+		t.Fatalf("created %+v", created)
+	}
+	path := w.Header().Get("Location")
+	if code := chat(); code != http.StatusOK {
+		t.Errorf("after increase: status %d, want 200", code)
+	}
+
+	if w := admin(http.MethodPut, path, `{"api_key":"*","max_tokens":20,"period":"daily"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT: status %d: %s", w.Code, w.Body.String())
+	}
+	if code := chat(); code != http.StatusTooManyRequests {
+		t.Errorf("after lowering: status %d, want 429", code)
+	}
+	if w := admin(http.MethodPut, "/pario/admin/policies/999", `{"api_key":"*","max_tokens":20,"period":"daily"}`); w.Code != http.StatusNotFound {
+		t.Errorf("PUT unknown: status %d, want 404", w.Code)
+	}
+
+	var listed []models.ManagedBudgetPolicy
+	if err := json.Unmarshal(admin(http.MethodGet, "/pario/admin/policies", "").Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].MaxTokens != 20 || !listed[0].ExpiresAt.IsZero() {
+		t.Errorf("listed %+v", listed)
+	}
+
+	if w := admin(http.MethodDelete, path, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: status %d", w.Code)
+	}
+	if w := admin(http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET deleted: status %d, want 404", w.Code)
+	}
+	if got := srv.enforcer.Managed(); len(got) != 0 {
+		t.Errorf("enforcer still has %+v", got)
+	}
+}
+
+func TestSyncPolicies(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.enforcer = budget.New(nil, srv.tracker)
+	store := srv.tracker.(*tracker.SQLiteTracker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		srv.SyncPolicies(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Another replica, or the MCP server, writes to the shared database.
+	if _, err := store.CreatePolicy(context.Background(), models.ManagedBudgetPolicy{
+		BudgetPolicy: models.BudgetPolicy{APIKey: "*", MaxTokens: 10, Period: models.BudgetDaily},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.enforcer.Managed()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("stored policy was not synced")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
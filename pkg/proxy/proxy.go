@@ -4,22 +4,29 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/pario-ai/pario/pkg/attribution"
 	"github.com/pario-ai/pario/pkg/audit"
 	"github.com/pario-ai/pario/pkg/budget"
 	cachepkg "github.com/pario-ai/pario/pkg/cache/sqlite"
 	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/events"
+	"github.com/pario-ai/pario/pkg/jsonbody"
+	"github.com/pario-ai/pario/pkg/middleware"
 	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/queue"
+	"github.com/pario-ai/pario/pkg/ratelimit"
 	"github.com/pario-ai/pario/pkg/router"
 	"github.com/pario-ai/pario/pkg/tracker"
 )
@@ -32,7 +39,30 @@ type Server struct {
 	enforcer *budget.Enforcer
 	auditor  *audit.Logger
 	router   *router.Router
+	labels   *attribution.Validator
+	events   *events.Hub[models.RequestEvent]
+	pricing  map[string]models.ModelPricing
+	queue    *queue.Queue
+	hooks    middleware.Chain
 	mux      *http.ServeMux
+	// keyLimits caps in-flight requests per client key.
+	keyLimits  *keyLimiter
+	rateLimits *ratelimit.Limiter
+	// modelLists caches provider model lists for /v1/models.
+	modelLists modelLists
+	// coalescer dedupes concurrent identical requests (cache.coalesce).
+	coalescer coalescer
+	// cacheRules picks the requests the cache serves (cache.deterministic_only).
+	cacheRules cachepkg.Rules
+
+	canaryMu sync.Mutex
+	staged   *stagedConfig
+
+	drain drainState
+	// writes tracks background audit and failure writes so Drain can
+	// flush them.
+	writes   sync.WaitGroup
+	failures failureQueue
 }
 
 // New creates a proxy Server wired with all dependencies.
@@ -44,20 +74,144 @@ func New(cfg *config.Config, t tracker.Tracker, c *cachepkg.Cache, e *budget.Enf
 		enforcer: e,
 		auditor:  a,
 		router:   router.New(cfg),
-		mux:      http.NewServeMux(),
+		labels:   attribution.NewValidator(cfg.Attribution.Labels),
+		events:   events.NewHub[models.RequestEvent](),
+		pricing:  make(map[string]models.ModelPricing),
+		queue: queue.New(queue.Options{
+			MaxConcurrent: cfg.Queue.MaxConcurrent,
+			MaxQueue:      cfg.Queue.MaxQueue,
+			ShedThreshold: cfg.Queue.ShedThreshold,
+			MaxWait:       cfg.Queue.MaxWait,
+		}),
+		mux:        http.NewServeMux(),
+		keyLimits:  newKeyLimiter(cfg.Limits.MaxInFlightPerKey),
+		rateLimits: ratelimit.New(cfg.RateLimits),
+	}
+	for _, p := range cfg.Pricing() {
+		s.pricing[p.Model] = p
+	}
+	// Patterns are checked by config validation.
+	s.cacheRules, _ = cachepkg.NewRules(cfg.Cache.DeterministicOnly, cfg.Cache.AnyRequestModels)
+	hooks, err := middleware.New(cfg.Middleware)
+	if err != nil {
+		log.Printf("middleware config error: %v", err)
+	}
+	s.hooks = hooks
+	if st, ok := t.(*tracker.SQLiteTracker); ok && cfg.Attribution.Labels.MaxValuesPerKey > 0 {
+		keys := make([]string, len(cfg.Attribution.Labels.AllowedKeys))
+		for i, k := range cfg.Attribution.Labels.AllowedKeys {
+			keys[i] = s.labels.Normalize(k)
+		}
+		values, err := st.LabelValues(context.Background(), keys, cfg.Attribution.Labels.MaxValuesPerKey)
+		if err != nil {
+			log.Printf("label seed error: %v", err)
+		}
+		s.labels.Seed(values)
 	}
 	s.mux.HandleFunc("/v1/chat/completions", s.handleChatCompletions)
+	s.mux.HandleFunc("/v1/embeddings", s.handleEmbeddings)
+	s.mux.HandleFunc("/v1/images/generations", s.handleImages)
+	s.mux.HandleFunc("/v1/audio/transcriptions", s.handleTranscription)
+	s.mux.HandleFunc("/v1/audio/translations", s.handleTranscription)
+	s.mux.HandleFunc("/v1/audio/speech", s.handleSpeech)
 	s.mux.HandleFunc("/v1/messages", s.handleMessages)
+	s.mux.HandleFunc("/v1/realtime", s.handleRealtime)
+	s.mux.HandleFunc("/v1/models", s.handleModels)
+	s.mux.HandleFunc("/v1/models/", s.handleModels)
+	for _, p := range []string{"/v1/assistants", "/v1/assistants/", "/v1/threads", "/v1/threads/"} {
+		s.mux.HandleFunc(p, s.handleAssistants)
+	}
+	for _, p := range []string{"/v1/batches", "/v1/batches/", "/v1/files", "/v1/files/"} {
+		s.mux.HandleFunc(p, s.handleBatches)
+	}
+	if cfg.Admin.Listen == "" {
+		s.mux.Handle(adminPrefix, s.AdminHandler())
+	} else {
+		s.mux.HandleFunc(adminPrefix, func(w http.ResponseWriter, r *http.Request) {
+			writeJSONError(w, http.StatusNotFound, "admin API is served on admin.listen")
+		})
+	}
 	s.mux.HandleFunc("/", s.handlePassthrough)
 	return s
 }
 
-// ServeHTTP implements http.Handler.
+// requestIDKey is the context key for the proxy-assigned request ID.
+type requestIDKey struct{}
+
+// ServeHTTP implements http.Handler. Every request is assigned an ID, returned
+// in X-Pario-Request-ID, that keys its usage records. While anyone is
+// watching the admin event stream, each finished request is published to it.
+// Once draining, proxy requests are turned away; the admin API stays up.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.mux.ServeHTTP(w, r)
+	id := newRequestID()
+	w.Header().Set("X-Pario-Request-ID", id)
+	ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+	if s.rateLimits.Enabled() {
+		ctx = context.WithValue(ctx, reservationKey{}, &ratelimit.Reservation{})
+	}
+	if s.enforcer != nil {
+		release := func() {}
+		ctx = context.WithValue(ctx, budgetSlotKey{}, &release)
+		defer func() { release() }()
+		h := &budgetHeadroom{}
+		ctx = context.WithValue(ctx, headroomKey{}, h)
+		w = &headroomWriter{ResponseWriter: w, h: h}
+	}
+
+	admin := strings.HasPrefix(r.URL.Path, adminPrefix)
+	if !admin {
+		if !s.drain.enter() {
+			rejectDraining(w)
+			return
+		}
+		defer s.drain.leave()
+		if !s.limitBody(w, r) {
+			return
+		}
+		release, ok := s.admitKey(w, r)
+		if !ok {
+			return
+		}
+		defer release()
+	}
+
+	if admin || !s.events.Active() {
+		s.mux.ServeHTTP(w, r.WithContext(ctx))
+		return
+	}
+
+	info := &requestInfo{}
+	r = r.WithContext(context.WithValue(ctx, requestInfoKey{}, info))
+	sw := &statusWriter{ResponseWriter: w}
+	start := time.Now()
+	s.mux.ServeHTTP(sw, r)
+	s.publishEvent(r, id, info, sw, time.Since(start))
+}
+
+// newRequestID returns a random request ID like req_3f9a0c1d2e4b5a69.
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "req_" + hex.EncodeToString(b)
+}
+
+// requestIDFrom returns the request ID assigned by ServeHTTP, if any.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
 }
 
-// ListenAndServe starts the proxy server with graceful shutdown support.
+// auditRequestID returns the client's X-Request-ID, falling back to the
+// proxy-assigned ID so every audit entry can be looked up.
+func auditRequestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); id != "" {
+		return id
+	}
+	return requestIDFrom(r.Context())
+}
+
+// ListenAndServe starts the proxy server. When ctx is cancelled it drains
+// for up to shutdown.drain_timeout before closing remaining connections.
 func (s *Server) ListenAndServe(ctx context.Context) error {
 	srv := &http.Server{
 		Addr:    s.cfg.Listen,
@@ -72,9 +226,9 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 
 	select {
 	case <-ctx.Done():
-		shutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		shutCtx, cancel := context.WithTimeout(context.Background(), s.cfg.Shutdown.DrainTimeout)
 		defer cancel()
-		return srv.Shutdown(shutCtx)
+		return s.Shutdown(shutCtx, srv)
 	case err := <-errCh:
 		return err
 	}
@@ -87,8 +241,9 @@ type upstreamResult struct {
 	header     http.Header
 }
 
-// doUpstreamRequest sends a request to an upstream provider and returns the result.
-func doUpstreamRequest(ctx context.Context, providerURL, path, contentType string, headers map[string]string, body []byte) (*upstreamResult, error) {
+// doUpstreamRequest sends a request to an upstream provider at providerURL
+// and returns the result, using provider's client.
+func doUpstreamRequest(ctx context.Context, provider config.ProviderConfig, providerURL, path, contentType string, headers map[string]string, body []byte) (*upstreamResult, error) {
 	target, err := url.Parse(providerURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid provider URL: %w", err)
@@ -99,11 +254,13 @@ func doUpstreamRequest(ctx context.Context, providerURL, path, contentType strin
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", contentType)
+	setUpstreamHeaders(req)
+	setProviderHeaders(req, provider)
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := clientFor(provider).buffered.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -129,41 +286,44 @@ func isRetryable(err error, statusCode int) bool {
 	return statusCode >= 500
 }
 
-// rewriteModel replaces the "model" field in a JSON body with the given model name.
+// rewriteModel replaces the "model" field in a JSON body with the given
+// model name, leaving the rest of the body byte-for-byte intact.
 func rewriteModel(body []byte, model string) []byte {
-	var raw map[string]json.RawMessage
-	if err := json.Unmarshal(body, &raw); err != nil {
-		return body
-	}
 	modelJSON, err := json.Marshal(model)
 	if err != nil {
 		return body
 	}
-	raw["model"] = modelJSON
-	out, err := json.Marshal(raw)
+	out, err := jsonbody.SetField(body, "model", modelJSON)
 	if err != nil {
 		return body
 	}
 	return out
 }
 
-// resolveSessionID resolves a session ID for the given client key.
+// resolveSessionID resolves a session ID for the given client key, and
+// names and tags the session from X-Pario-Session-Name and
+// X-Pario-Session-Tags when they are sent.
 func (s *Server) resolveSessionID(r *http.Request, clientKey string) string {
-	if st, ok := s.tracker.(*tracker.SQLiteTracker); ok {
-		explicitSession := r.Header.Get("X-Pario-Session")
-		sid, err := st.ResolveSession(r.Context(), clientKey, explicitSession, s.cfg.Session.GapTimeout)
-		if err != nil {
-			log.Printf("session resolve error: %v", err)
-			return ""
+	explicitSession := r.Header.Get("X-Pario-Session")
+	sid, err := s.tracker.ResolveSession(r.Context(), clientKey, explicitSession, s.cfg.Session.GapTimeout)
+	if err != nil {
+		log.Printf("session resolve error: %v", err)
+		return ""
+	}
+	name := strings.TrimSpace(r.Header.Get("X-Pario-Session-Name"))
+	tags := parseLabels(r.Header.Get("X-Pario-Session-Tags"))
+	if name != "" || len(tags) > 0 {
+		if err := s.tracker.UpdateSession(r.Context(), sid, name, tags); err != nil {
+			log.Printf("session update error: %v", err)
 		}
-		return sid
 	}
-	return ""
+	return sid
 }
 
-// doUpstreamStreamRequest sends a request to an upstream provider and returns the raw response.
+// doUpstreamStreamRequest sends a request to an upstream provider at providerURL
+// and returns the raw response, using provider's streaming client.
 // The caller owns resp.Body and must close it.
-func doUpstreamStreamRequest(ctx context.Context, providerURL, path, contentType string, headers map[string]string, body []byte) (*http.Response, error) {
+func doUpstreamStreamRequest(ctx context.Context, provider config.ProviderConfig, providerURL, path, contentType string, headers map[string]string, body []byte) (*http.Response, error) {
 	target, err := url.Parse(providerURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid provider URL: %w", err)
@@ -174,11 +334,13 @@ func doUpstreamStreamRequest(ctx context.Context, providerURL, path, contentType
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", contentType)
+	setUpstreamHeaders(req)
+	setProviderHeaders(req, provider)
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
 
-	return http.DefaultClient.Do(req)
+	return clientFor(provider).doStream(req)
 }
 
 // streamResult holds accumulated data from an SSE stream.
@@ -186,10 +348,15 @@ type streamResult struct {
 	usage *models.Usage
 	model string
 	body  strings.Builder
+	// output counts the bytes of generated content relayed, to estimate
+	// completion tokens when the stream ends before reporting usage.
+	output int
 }
 
-// streamSSEResponse relays an SSE stream from resp to w, extracting usage data.
-func streamSSEResponse(w http.ResponseWriter, resp *http.Response, format string) (*streamResult, error) {
+// streamSSEResponse relays an SSE stream from resp to w, extracting usage
+// data. With hideUsage, an OpenAI stream's final usage-only chunk is read
+// but not relayed.
+func streamSSEResponse(w http.ResponseWriter, resp *http.Response, format string, hideUsage bool) (*streamResult, error) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		return nil, fmt.Errorf("response writer does not support flushing")
@@ -205,9 +372,23 @@ func streamSSEResponse(w http.ResponseWriter, resp *http.Response, format string
 
 	result := &streamResult{}
 	scanner := bufio.NewScanner(resp.Body)
+	skipBlank := false
 
 	for scanner.Scan() {
 		line := scanner.Text()
+		if hideUsage && format == "openai" && isUsageChunk(line) {
+			var chunk models.ChatCompletionChunk
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err == nil {
+				result.usage = chunk.Usage
+			}
+			skipBlank = true
+			continue
+		}
+		if skipBlank && line == "" {
+			skipBlank = false
+			continue
+		}
+		skipBlank = false
 		result.body.WriteString(line)
 		result.body.WriteString("\n")
 
@@ -238,6 +419,9 @@ func streamSSEResponse(w http.ResponseWriter, resp *http.Response, format string
 				if chunk.Usage != nil {
 					result.usage = chunk.Usage
 				}
+				for _, c := range chunk.Choices {
+					result.output += len(c.Delta.Content) + len(c.Delta.ToolCalls)
+				}
 			}
 		case "anthropic":
 			var evt models.AnthropicStreamEvent
@@ -257,6 +441,15 @@ func streamSSEResponse(w http.ResponseWriter, resp *http.Response, format string
 							result.usage = msg.Usage.ToUsage()
 						}
 					}
+				case "content_block_delta":
+					var delta struct {
+						Text        string `json:"text"`
+						PartialJSON string `json:"partial_json"`
+						Thinking    string `json:"thinking"`
+					}
+					if err := json.Unmarshal(evt.Delta, &delta); err == nil {
+						result.output += len(delta.Text) + len(delta.PartialJSON) + len(delta.Thinking)
+					}
 				case "message_delta":
 					// Extract output tokens from delta usage
 					if evt.Usage != nil {
@@ -280,28 +473,109 @@ func streamSSEResponse(w http.ResponseWriter, resp *http.Response, format string
 	return result, nil
 }
 
+// partialUsage completes the usage of a stream that ended early. A prompt
+// count the provider reported before then is kept, otherwise it is
+// estimated from the request body. The completion count is the larger of
+// the reported one (Anthropic reports a token or so up front) and an
+// estimate from the content relayed. It returns nil if nothing was
+// reported or relayed.
+func partialUsage(result *streamResult, body []byte) *models.Usage {
+	if result.usage == nil && result.output == 0 {
+		return nil
+	}
+	var u models.Usage
+	if result.usage != nil {
+		u = *result.usage
+	}
+	if u.PromptTokens == 0 {
+		if p, err := parsePrompt(body); err == nil {
+			u.PromptTokens = p.promptTokens()
+		}
+	}
+	u.CompletionTokens = max(u.CompletionTokens, (result.output+bytesPerToken-1)/bytesPerToken)
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	return &u
+}
+
+// isUsageChunk reports whether an SSE line is the usage-only chunk an
+// OpenAI stream ends with when stream_options.include_usage is set: no
+// choices and a non-null usage.
+func isUsageChunk(line string) bool {
+	data, ok := strings.CutPrefix(line, "data: ")
+	if !ok || data == "[DONE]" {
+		return false
+	}
+	var chunk struct {
+		Choices []json.RawMessage `json:"choices"`
+		Usage   json.RawMessage   `json:"usage"`
+	}
+	if json.Unmarshal([]byte(data), &chunk) != nil {
+		return false
+	}
+	return len(chunk.Choices) == 0 && len(chunk.Usage) > 0 && string(chunk.Usage) != "null"
+}
+
+// includeStreamUsage sets stream_options.include_usage on an OpenAI
+// streaming request so the stream ends with a usage chunk; most SDKs leave
+// it unset, and such streams report no usage at all. Other stream_options
+// are kept. It reports whether the body was changed, i.e. whether the
+// client didn't ask for usage and the usage chunk should be kept from it.
+func includeStreamUsage(body []byte) ([]byte, bool) {
+	var req struct {
+		StreamOptions map[string]json.RawMessage `json:"stream_options"`
+	}
+	if json.Unmarshal(body, &req) != nil {
+		return body, false
+	}
+	var include bool
+	if json.Unmarshal(req.StreamOptions["include_usage"], &include) == nil && include {
+		return body, false
+	}
+	opts := []byte(`{"include_usage":true}`)
+	if start, end, found, err := jsonbody.FieldSpan(body, "stream_options"); err == nil && found && body[start] == '{' {
+		if o, err := jsonbody.SetField(body[start:end], "include_usage", []byte("true")); err == nil {
+			opts = o
+		}
+	}
+	out, err := jsonbody.SetField(body, "stream_options", opts)
+	if err != nil {
+		return body, false
+	}
+	return out, true
+}
+
 // handleStreamingOpenAI handles streaming OpenAI chat completion requests.
 func (s *Server) handleStreamingOpenAI(w http.ResponseWriter, r *http.Request, clientKey string, body []byte, routes []router.Route, reqStart time.Time) {
+	upstreamBody, injected := includeStreamUsage(body)
 	var resp *http.Response
 	var usedRoute router.Route
-	for _, route := range routes {
-		reqBody := rewriteModel(body, route.Model)
-		headers := map[string]string{
-			"Authorization": "Bearer " + route.Provider.APIKey,
-		}
-
-		res, err := doUpstreamStreamRequest(r.Context(), route.Provider.URL, "/v1/chat/completions", "application/json", headers, reqBody)
+	var attemptStart time.Time
+	var attempt int
+	for i, route := range routes {
+		reqBody := routeBody(upstreamBody, route, false)
+
+		res, err := withStreamRetries(r.Context(), route, func() (*http.Response, error) {
+			attemptStart = time.Now()
+			return doChatStreamRequest(r.Context(), route, reqBody)
+		})
 		if err != nil {
+			s.failed(r, route, i+1, 0, err, attemptStart)
 			log.Printf("upstream %s failed: %v, trying next", route.Provider.Name, err)
 			continue
 		}
+		s.router.Observe(route.Provider.Name, res.StatusCode, res.Header)
 		if res.StatusCode >= 500 {
 			res.Body.Close()
+			s.failed(r, route, i+1, res.StatusCode, nil, attemptStart)
 			log.Printf("upstream %s returned %d, trying next", route.Provider.Name, res.StatusCode)
 			continue
 		}
+		if res.StatusCode < 300 {
+			s.served(r, route, time.Since(attemptStart))
+		}
 		resp = res
 		usedRoute = route
+		attempt = i + 1
 		break
 	}
 
@@ -310,33 +584,50 @@ func (s *Server) handleStreamingOpenAI(w http.ResponseWriter, r *http.Request, c
 		return
 	}
 	defer resp.Body.Close()
-	_ = usedRoute // used for future provider attribution
 
 	sessionID := s.resolveSessionID(r, clientKey)
 	if sessionID != "" {
 		w.Header().Set("X-Pario-Session", sessionID)
 	}
-
-	result, err := streamSSEResponse(w, resp, "openai")
+	setRouteHeaders(w, usedRoute)
+
+	s.afterResponse(r, &middleware.Response{
+		Provider:   usedRoute.Provider.Name,
+		Model:      usedRoute.Model,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Streamed:   true,
+	})
+	result, err := streamSSEResponse(w, resp, "openai", injected)
+	partial := err != nil && result != nil
 	if err != nil {
 		log.Printf("streaming error: %v", err)
 	}
+	if partial {
+		// The client went away or the stream broke off; the provider
+		// still bills what it generated.
+		result.usage = partialUsage(result, body)
+	}
 
 	// Record usage
 	if result != nil && result.usage != nil {
-		team, project, env := s.resolveLabels(r, clientKey)
-		modelName := result.model
-		_ = s.tracker.Record(r.Context(), models.UsageRecord{
-			APIKey:           clientKey,
-			Model:            modelName,
-			SessionID:        sessionID,
-			PromptTokens:     result.usage.PromptTokens,
-			CompletionTokens: result.usage.CompletionTokens,
-			TotalTokens:      result.usage.TotalTokens,
-			Team:             team,
-			Project:          project,
-			Env:              env,
-			CreatedAt:        time.Now().UTC(),
+		s.recordUsage(r, models.UsageRecord{
+			APIKey:              clientKey,
+			Model:               result.model,
+			SessionID:           sessionID,
+			Provider:            usedRoute.Provider.Name,
+			RouteAlias:          usedRoute.Alias,
+			Attempt:             attempt,
+			PromptTokens:        result.usage.PromptTokens,
+			CompletionTokens:    result.usage.CompletionTokens,
+			TotalTokens:         result.usage.TotalTokens,
+			CacheReadTokens:     result.usage.CacheReadTokens(),
+			CacheCreationTokens: result.usage.CacheCreationTokens(),
+			ReasoningTokens:     result.usage.ReasoningTokens(),
+			Streamed:            true,
+			Partial:             partial,
+			LatencyMs:           time.Since(attemptStart).Milliseconds(),
+			UpstreamStatus:      resp.StatusCode,
 		})
 	}
 
@@ -349,7 +640,7 @@ func (s *Server) handleStreamingOpenAI(w http.ResponseWriter, r *http.Request, c
 			respBody = respBody[:8192]
 		}
 		entry := models.AuditEntry{
-			RequestID:    r.Header.Get("X-Request-ID"),
+			RequestID:    auditRequestID(r),
 			APIKeyHash:   keyHash,
 			APIKeyPrefix: keyPrefix,
 			Model:        result.model,
@@ -366,11 +657,7 @@ func (s *Server) handleStreamingOpenAI(w http.ResponseWriter, r *http.Request, c
 			entry.CompletionTokens = result.usage.CompletionTokens
 			entry.TotalTokens = result.usage.TotalTokens
 		}
-		go func() {
-			if err := s.auditor.Log(context.Background(), entry); err != nil {
-				log.Printf("audit log error: %v", err)
-			}
-		}()
+		s.logAudit(entry)
 	}
 }
 
@@ -379,8 +666,10 @@ func (s *Server) handleStreamingAnthropic(w http.ResponseWriter, r *http.Request
 	anthropicVersion := r.Header.Get("anthropic-version")
 	var resp *http.Response
 	var usedRoute router.Route
-	for _, route := range routes {
-		reqBody := rewriteModel(body, route.Model)
+	var attemptStart time.Time
+	var attempt int
+	for i, route := range routes {
+		reqBody := routeBody(body, route, true)
 		headers := map[string]string{
 			"x-api-key": route.Provider.APIKey,
 		}
@@ -388,18 +677,28 @@ func (s *Server) handleStreamingAnthropic(w http.ResponseWriter, r *http.Request
 			headers["anthropic-version"] = anthropicVersion
 		}
 
-		res, err := doUpstreamStreamRequest(r.Context(), route.Provider.URL, "/v1/messages", "application/json", headers, reqBody)
+		res, err := withStreamRetries(r.Context(), route, func() (*http.Response, error) {
+			attemptStart = time.Now()
+			return doMessagesStreamRequest(r.Context(), route, headers, reqBody)
+		})
 		if err != nil {
+			s.failed(r, route, i+1, 0, err, attemptStart)
 			log.Printf("upstream %s failed: %v, trying next", route.Provider.Name, err)
 			continue
 		}
+		s.router.Observe(route.Provider.Name, res.StatusCode, res.Header)
 		if res.StatusCode >= 500 {
 			res.Body.Close()
+			s.failed(r, route, i+1, res.StatusCode, nil, attemptStart)
 			log.Printf("upstream %s returned %d, trying next", route.Provider.Name, res.StatusCode)
 			continue
 		}
+		if res.StatusCode < 300 {
+			s.served(r, route, time.Since(attemptStart))
+		}
 		resp = res
 		usedRoute = route
+		attempt = i + 1
 		break
 	}
 
@@ -408,32 +707,50 @@ func (s *Server) handleStreamingAnthropic(w http.ResponseWriter, r *http.Request
 		return
 	}
 	defer resp.Body.Close()
-	_ = usedRoute
 
 	sessionID := s.resolveSessionID(r, clientKey)
 	if sessionID != "" {
 		w.Header().Set("X-Pario-Session", sessionID)
 	}
-
-	result, err := streamSSEResponse(w, resp, "anthropic")
+	setRouteHeaders(w, usedRoute)
+
+	s.afterResponse(r, &middleware.Response{
+		Provider:   usedRoute.Provider.Name,
+		Model:      usedRoute.Model,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Streamed:   true,
+	})
+	result, err := streamSSEResponse(w, resp, "anthropic", false)
+	partial := err != nil && result != nil
 	if err != nil {
 		log.Printf("streaming error: %v", err)
 	}
+	if partial {
+		// The client went away or the stream broke off; the provider
+		// still bills what it generated.
+		result.usage = partialUsage(result, body)
+	}
 
 	// Record usage
 	if result != nil && result.usage != nil {
-		team, project, env := s.resolveLabels(r, clientKey)
-		_ = s.tracker.Record(r.Context(), models.UsageRecord{
-			APIKey:           clientKey,
-			Model:            result.model,
-			SessionID:        sessionID,
-			PromptTokens:     result.usage.PromptTokens,
-			CompletionTokens: result.usage.CompletionTokens,
-			TotalTokens:      result.usage.TotalTokens,
-			Team:             team,
-			Project:          project,
-			Env:              env,
-			CreatedAt:        time.Now().UTC(),
+		s.recordUsage(r, models.UsageRecord{
+			APIKey:              clientKey,
+			Model:               defaultModel(result.model, usedRoute),
+			SessionID:           sessionID,
+			Provider:            usedRoute.Provider.Name,
+			RouteAlias:          usedRoute.Alias,
+			Attempt:             attempt,
+			PromptTokens:        result.usage.PromptTokens,
+			CompletionTokens:    result.usage.CompletionTokens,
+			TotalTokens:         result.usage.TotalTokens,
+			CacheReadTokens:     result.usage.CacheReadTokens(),
+			CacheCreationTokens: result.usage.CacheCreationTokens(),
+			ReasoningTokens:     result.usage.ReasoningTokens(),
+			Streamed:            true,
+			Partial:             partial,
+			LatencyMs:           time.Since(attemptStart).Milliseconds(),
+			UpstreamStatus:      resp.StatusCode,
 		})
 	}
 
@@ -446,7 +763,7 @@ func (s *Server) handleStreamingAnthropic(w http.ResponseWriter, r *http.Request
 			respBody = respBody[:8192]
 		}
 		entry := models.AuditEntry{
-			RequestID:    r.Header.Get("X-Request-ID"),
+			RequestID:    auditRequestID(r),
 			APIKeyHash:   keyHash,
 			APIKeyPrefix: keyPrefix,
 			Model:        result.model,
@@ -463,11 +780,7 @@ func (s *Server) handleStreamingAnthropic(w http.ResponseWriter, r *http.Request
 			entry.CompletionTokens = result.usage.CompletionTokens
 			entry.TotalTokens = result.usage.TotalTokens
 		}
-		go func() {
-			if err := s.auditor.Log(context.Background(), entry); err != nil {
-				log.Printf("audit log error: %v", err)
-			}
-		}()
+		s.logAudit(entry)
 	}
 }
 
@@ -483,46 +796,75 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, "failed to read request body")
+	body, ok := readBody(w, r)
+	if !ok {
 		return
 	}
-	r.Body.Close()
 
 	var req models.ChatCompletionRequest
 	if err := json.Unmarshal(body, &req); err != nil {
 		writeJSONError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	r, body, ok = s.beforeRoute(w, r, "chat", clientKey, req.Model, body, func(b []byte) error {
+		req = models.ChatCompletionRequest{}
+		return json.Unmarshal(b, &req)
+	})
+	if !ok {
+		return
+	}
+	noteModel(r, req.Model)
 
 	// Cache check
-	if s.cache != nil && !req.Stream {
-		hash := cachepkg.HashPrompt(req.Model, req.Messages)
+	useCache := s.cache != nil && !req.Stream && s.cacheRules.Allow(req)
+	if useCache {
+		hash := cachepkg.HashRequest(req)
 		if cached, ok := s.cache.Get(hash, req.Model); ok {
-			w.Header().Set("Content-Type", "application/json")
-			w.Header().Set("X-Pario-Cache", "hit")
-			w.Write(cached)
+			s.writeResponse(w, r, &middleware.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {"application/json"}, "X-Pario-Cache": {"hit"}},
+				Body:       cached,
+				Cached:     true,
+			})
 			return
 		}
 	}
 
-	// Budget check
-	if s.enforcer != nil {
-		if err := s.enforcer.Check(r.Context(), clientKey, req.Model); err != nil {
-			if errors.Is(err, budget.ErrBudgetExceeded) {
-				writeJSONError(w, http.StatusTooManyRequests, "token budget exceeded")
-				return
-			}
-			writeJSONError(w, http.StatusInternalServerError, "budget check failed")
+	s.shadow(r, clientKey, req.Model)
+
+	// Rate limit and budget check
+	r = s.withBudgetHints(r, req.Model, body)
+	if !s.checkBudget(w, r, clientKey, req.Model) {
+		return
+	}
+
+	// Identical requests of the key already in flight share one upstream
+	// call. Waiters have passed the rate limit and budget checks too.
+	var shared []byte
+	if !req.Stream {
+		done, handled := s.coalesce(w, r, clientKey, "chat", body)
+		if handled {
 			return
 		}
+		defer func() { done(shared) }()
+	}
+
+	release, ok := s.admit(w, r, clientKey)
+	if !ok {
+		return
 	}
+	defer release()
 
 	// Resolve routes
-	routes, err := s.router.Resolve(req.Model)
-	if err != nil {
-		writeJSONError(w, http.StatusBadGateway, "no providers available")
+	routes, err := s.resolveFor(w, r, clientKey, req.Model, body)
+	if err == nil {
+		routes = withoutBedrock(routes)
+	}
+	if err != nil || len(routes) == 0 {
+		writeRouteError(w, err)
+		return
+	}
+	if routes, body, ok = s.fitContext(w, routes, body); !ok {
 		return
 	}
 
@@ -536,23 +878,36 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 
 	// Fallback loop
 	var result *upstreamResult
-	for _, route := range routes {
-		reqBody := rewriteModel(body, route.Model)
-		headers := map[string]string{
-			"Authorization": "Bearer " + route.Provider.APIKey,
-		}
-
-		res, err := doUpstreamRequest(r.Context(), route.Provider.URL, "/v1/chat/completions", "application/json", headers, reqBody)
+	var usedRoute router.Route
+	var upstreamLatency time.Duration
+	var attempt int
+	for i, route := range routes {
+		reqBody := routeBody(body, route, false)
+
+		var attemptStart time.Time
+		res, err := withRetries(r.Context(), route, func() (*upstreamResult, error) {
+			attemptStart = time.Now()
+			return doChatRequest(r.Context(), route, reqBody)
+		})
 		if isRetryable(err, 0) {
+			s.failed(r, route, i+1, 0, err, attemptStart)
 			log.Printf("upstream %s failed: %v, trying next", route.Provider.Name, err)
 			continue
 		}
+		s.router.Observe(route.Provider.Name, res.statusCode, res.header)
 		if res != nil && isRetryable(nil, res.statusCode) {
+			s.failed(r, route, i+1, res.statusCode, nil, attemptStart)
 			log.Printf("upstream %s returned %d, trying next", route.Provider.Name, res.statusCode)
 			result = res
 			continue
 		}
 		result = res
+		usedRoute = route
+		attempt = i + 1
+		upstreamLatency = time.Since(attemptStart)
+		if res.statusCode < 300 {
+			s.served(r, route, upstreamLatency)
+		}
 		break
 	}
 
@@ -567,29 +922,44 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("X-Pario-Session", sessionID)
 	}
 
+	var retryReason string
+	if retry := s.retryInvalidSchema(w, r, clientKey, sessionID, body, routes, usedRoute, attempt, result, upstreamLatency); retry != nil {
+		result, usedRoute, attempt, upstreamLatency = retry.result, retry.route, retry.attempt, retry.latency
+		retryReason = schemaRetryReason
+	}
+	setRouteHeaders(w, usedRoute)
+
 	// Parse response for usage tracking
 	var usage *models.Usage
 	if result.statusCode == http.StatusOK {
 		var chatResp models.ChatCompletionResponse
 		if err := json.Unmarshal(result.body, &chatResp); err == nil && chatResp.Usage != nil {
 			usage = chatResp.Usage
-			team, project, env := s.resolveLabels(r, clientKey)
-			_ = s.tracker.Record(r.Context(), models.UsageRecord{
-				APIKey:           clientKey,
-				Model:            chatResp.Model,
-				SessionID:        sessionID,
-				PromptTokens:     chatResp.Usage.PromptTokens,
-				CompletionTokens: chatResp.Usage.CompletionTokens,
-				TotalTokens:      chatResp.Usage.TotalTokens,
-				Team:             team,
-				Project:          project,
-				Env:              env,
-				CreatedAt:        time.Now().UTC(),
+			s.recordUsage(r, models.UsageRecord{
+				APIKey:              clientKey,
+				Model:               chatResp.Model,
+				SessionID:           sessionID,
+				Provider:            usedRoute.Provider.Name,
+				RouteAlias:          usedRoute.Alias,
+				Attempt:             attempt,
+				PromptTokens:        chatResp.Usage.PromptTokens,
+				CompletionTokens:    chatResp.Usage.CompletionTokens,
+				TotalTokens:         chatResp.Usage.TotalTokens,
+				CacheReadTokens:     chatResp.Usage.CacheReadTokens(),
+				CacheCreationTokens: chatResp.Usage.CacheCreationTokens(),
+				ReasoningTokens:     chatResp.Usage.ReasoningTokens(),
+				LatencyMs:           upstreamLatency.Milliseconds(),
+				UpstreamStatus:      result.statusCode,
+				RetryReason:         retryReason,
 			})
 
-			if s.cache != nil {
-				hash := cachepkg.HashPrompt(req.Model, req.Messages)
-				_ = s.cache.Put(hash, req.Model, result.body)
+			// Never cache or share structured output that failed validation.
+			if w.Header().Get("X-Pario-Schema") != "invalid" {
+				shared = result.body
+				if useCache {
+					hash := cachepkg.HashRequest(req)
+					_ = s.cache.Put(hash, req.Model, result.body)
+				}
 			}
 		}
 	}
@@ -599,7 +969,7 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		latency := time.Since(reqStart).Milliseconds()
 		keyHash, keyPrefix := audit.HashAPIKey(clientKey)
 		entry := models.AuditEntry{
-			RequestID:    r.Header.Get("X-Request-ID"),
+			RequestID:    auditRequestID(r),
 			APIKeyHash:   keyHash,
 			APIKeyPrefix: keyPrefix,
 			Model:        req.Model,
@@ -616,22 +986,50 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 			entry.CompletionTokens = usage.CompletionTokens
 			entry.TotalTokens = usage.TotalTokens
 		}
-		go func() {
-			if err := s.auditor.Log(context.Background(), entry); err != nil {
-				log.Printf("audit log error: %v", err)
-			}
-		}()
+		s.logAudit(entry)
 	}
 
 	// Forward response headers and body
-	for k, vals := range result.header {
-		for _, v := range vals {
-			w.Header().Add(k, v)
-		}
+	header := result.header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("X-Pario-Cache", cacheStatus(s.cache != nil && !req.Stream, useCache))
+	s.writeResponse(w, r, &middleware.Response{
+		Provider:   usedRoute.Provider.Name,
+		Model:      usedRoute.Model,
+		StatusCode: result.statusCode,
+		Header:     header,
+		Body:       result.body,
+	})
+}
+
+// cacheStatus is the X-Pario-Cache value of a response not served from
+// the cache. enabled reports whether the cache handles requests like this
+// one; "bypass" means the cache rules skipped it.
+func cacheStatus(enabled, used bool) string {
+	if enabled && !used {
+		return "bypass"
 	}
-	w.Header().Set("X-Pario-Cache", "miss")
-	w.WriteHeader(result.statusCode)
-	w.Write(result.body)
+	return "miss"
+}
+
+// anthropicCacheRequest returns the chat completion request a Messages
+// request is cached as.
+func anthropicCacheRequest(req models.AnthropicRequest) models.ChatCompletionRequest {
+	cr := models.ChatCompletionRequest{
+		Model:       req.Model,
+		Messages:    req.Messages,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Tools:       req.Tools,
+		ToolChoice:  req.ToolChoice,
+		System:      req.System,
+	}
+	if req.MaxTokens > 0 {
+		cr.MaxTokens = &req.MaxTokens
+	}
+	return cr
 }
 
 func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
@@ -646,46 +1044,73 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, "failed to read request body")
+	body, ok := readBody(w, r)
+	if !ok {
 		return
 	}
-	r.Body.Close()
 
 	var req models.AnthropicRequest
 	if err := json.Unmarshal(body, &req); err != nil {
 		writeJSONError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	r, body, ok = s.beforeRoute(w, r, "messages", clientKey, req.Model, body, func(b []byte) error {
+		req = models.AnthropicRequest{}
+		return json.Unmarshal(b, &req)
+	})
+	if !ok {
+		return
+	}
+	noteModel(r, req.Model)
 
 	// Cache check
-	if s.cache != nil && !req.Stream {
-		hash := cachepkg.HashPrompt(req.Model, req.Messages)
+	cacheReq := anthropicCacheRequest(req)
+	useCache := s.cache != nil && !req.Stream && s.cacheRules.Allow(cacheReq)
+	if useCache {
+		hash := cachepkg.HashRequest(cacheReq)
 		if cached, ok := s.cache.Get(hash, req.Model); ok {
-			w.Header().Set("Content-Type", "application/json")
-			w.Header().Set("X-Pario-Cache", "hit")
-			w.Write(cached)
+			s.writeResponse(w, r, &middleware.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {"application/json"}, "X-Pario-Cache": {"hit"}},
+				Body:       cached,
+				Cached:     true,
+			})
 			return
 		}
 	}
 
-	// Budget check
-	if s.enforcer != nil {
-		if err := s.enforcer.Check(r.Context(), clientKey, req.Model); err != nil {
-			if errors.Is(err, budget.ErrBudgetExceeded) {
-				writeJSONError(w, http.StatusTooManyRequests, "token budget exceeded")
-				return
-			}
-			writeJSONError(w, http.StatusInternalServerError, "budget check failed")
+	s.shadow(r, clientKey, req.Model)
+
+	// Rate limit and budget check
+	r = s.withBudgetHints(r, req.Model, body)
+	if !s.checkBudget(w, r, clientKey, req.Model) {
+		return
+	}
+
+	// Identical requests of the key already in flight share one upstream
+	// call. Waiters have passed the rate limit and budget checks too.
+	var shared []byte
+	if !req.Stream {
+		done, handled := s.coalesce(w, r, clientKey, "messages", body)
+		if handled {
 			return
 		}
+		defer func() { done(shared) }()
+	}
+
+	release, ok := s.admit(w, r, clientKey)
+	if !ok {
+		return
 	}
+	defer release()
 
 	// Resolve routes
-	routes, err := s.router.Resolve(req.Model)
+	routes, err := s.resolveFor(w, r, clientKey, req.Model, body)
 	if err != nil {
-		writeJSONError(w, http.StatusBadGateway, "no providers available")
+		writeRouteError(w, err)
+		return
+	}
+	if routes, body, ok = s.fitContext(w, routes, body); !ok {
 		return
 	}
 
@@ -700,8 +1125,11 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
 	// Fallback loop
 	anthropicVersion := r.Header.Get("anthropic-version")
 	var result *upstreamResult
-	for _, route := range routes {
-		reqBody := rewriteModel(body, route.Model)
+	var usedRoute router.Route
+	var upstreamLatency time.Duration
+	var attempt int
+	for i, route := range routes {
+		reqBody := routeBody(body, route, true)
 		headers := map[string]string{
 			"x-api-key": route.Provider.APIKey,
 		}
@@ -709,17 +1137,30 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
 			headers["anthropic-version"] = anthropicVersion
 		}
 
-		res, err := doUpstreamRequest(r.Context(), route.Provider.URL, "/v1/messages", "application/json", headers, reqBody)
+		var attemptStart time.Time
+		res, err := withRetries(r.Context(), route, func() (*upstreamResult, error) {
+			attemptStart = time.Now()
+			return doMessagesRequest(r.Context(), route, headers, reqBody)
+		})
 		if isRetryable(err, 0) {
+			s.failed(r, route, i+1, 0, err, attemptStart)
 			log.Printf("upstream %s failed: %v, trying next", route.Provider.Name, err)
 			continue
 		}
+		s.router.Observe(route.Provider.Name, res.statusCode, res.header)
 		if res != nil && isRetryable(nil, res.statusCode) {
+			s.failed(r, route, i+1, res.statusCode, nil, attemptStart)
 			log.Printf("upstream %s returned %d, trying next", route.Provider.Name, res.statusCode)
 			result = res
 			continue
 		}
 		result = res
+		usedRoute = route
+		attempt = i + 1
+		upstreamLatency = time.Since(attemptStart)
+		if res.statusCode < 300 {
+			s.served(r, route, upstreamLatency)
+		}
 		break
 	}
 
@@ -733,6 +1174,7 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
 	if sessionID != "" {
 		w.Header().Set("X-Pario-Session", sessionID)
 	}
+	setRouteHeaders(w, usedRoute)
 
 	// Parse response for usage tracking
 	var usage *models.Usage
@@ -740,22 +1182,26 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
 		var anthResp models.AnthropicResponse
 		if err := json.Unmarshal(result.body, &anthResp); err == nil && anthResp.Usage != nil {
 			usage = anthResp.Usage.ToUsage()
-			team, project, env := s.resolveLabels(r, clientKey)
-			_ = s.tracker.Record(r.Context(), models.UsageRecord{
-				APIKey:           clientKey,
-				Model:            anthResp.Model,
-				SessionID:        sessionID,
-				PromptTokens:     usage.PromptTokens,
-				CompletionTokens: usage.CompletionTokens,
-				TotalTokens:      usage.TotalTokens,
-				Team:             team,
-				Project:          project,
-				Env:              env,
-				CreatedAt:        time.Now().UTC(),
+			s.recordUsage(r, models.UsageRecord{
+				APIKey:              clientKey,
+				Model:               defaultModel(anthResp.Model, usedRoute),
+				SessionID:           sessionID,
+				Provider:            usedRoute.Provider.Name,
+				RouteAlias:          usedRoute.Alias,
+				Attempt:             attempt,
+				PromptTokens:        usage.PromptTokens,
+				CompletionTokens:    usage.CompletionTokens,
+				TotalTokens:         usage.TotalTokens,
+				CacheReadTokens:     usage.CacheReadTokens(),
+				CacheCreationTokens: usage.CacheCreationTokens(),
+				ReasoningTokens:     usage.ReasoningTokens(),
+				LatencyMs:           upstreamLatency.Milliseconds(),
+				UpstreamStatus:      result.statusCode,
 			})
 
-			if s.cache != nil {
-				hash := cachepkg.HashPrompt(req.Model, req.Messages)
+			shared = result.body
+			if useCache {
+				hash := cachepkg.HashRequest(cacheReq)
 				_ = s.cache.Put(hash, req.Model, result.body)
 			}
 		}
@@ -766,7 +1212,7 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
 		latency := time.Since(reqStart).Milliseconds()
 		keyHash, keyPrefix := audit.HashAPIKey(clientKey)
 		entry := models.AuditEntry{
-			RequestID:    r.Header.Get("X-Request-ID"),
+			RequestID:    auditRequestID(r),
 			APIKeyHash:   keyHash,
 			APIKeyPrefix: keyPrefix,
 			Model:        req.Model,
@@ -783,53 +1229,86 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
 			entry.CompletionTokens = usage.CompletionTokens
 			entry.TotalTokens = usage.TotalTokens
 		}
-		go func() {
-			if err := s.auditor.Log(context.Background(), entry); err != nil {
-				log.Printf("audit log error: %v", err)
-			}
-		}()
+		s.logAudit(entry)
 	}
 
 	// Forward response headers and body
-	for k, vals := range result.header {
-		for _, v := range vals {
-			w.Header().Add(k, v)
-		}
-	}
-	w.Header().Set("X-Pario-Cache", "miss")
-	w.WriteHeader(result.statusCode)
-	w.Write(result.body)
+	header := result.header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("X-Pario-Cache", cacheStatus(s.cache != nil && !req.Stream, useCache))
+	s.writeResponse(w, r, &middleware.Response{
+		Provider:   usedRoute.Provider.Name,
+		Model:      usedRoute.Model,
+		StatusCode: result.statusCode,
+		Header:     header,
+		Body:       result.body,
+	})
 }
 
-func (s *Server) handlePassthrough(w http.ResponseWriter, r *http.Request) {
-	if len(s.cfg.Providers) == 0 {
-		writeJSONError(w, http.StatusServiceUnavailable, "no providers configured")
-		return
-	}
-
-	provider := s.cfg.Providers[0]
-	target, err := url.Parse(provider.URL)
-	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, "invalid provider URL")
-		return
+// recordUsage fills in the request ID (unless the caller set one),
+// attribution labels, derived throughput, cost, and the timestamp, then
+// stores the record. Callers set Attempt to the 1-based index of the upstream
+// attempt whose response carried the usage. Tracking errors never fail
+// the request.
+func (s *Server) recordUsage(r *http.Request, rec models.UsageRecord) {
+	if rec.RequestID == "" {
+		rec.RequestID = requestIDFrom(r.Context())
+	}
+	rec.Team, rec.Project, rec.Env = s.resolveLabels(r, rec.APIKey)
+	rec.Labels = s.labels.Labels(parseLabels(r.Header.Get("X-Pario-Labels")))
+	rec.Metadata = s.resolveMetadata(r)
+	rec.Pipeline, rec.Branch, rec.Commit = s.resolveBuild(r)
+	if rec.Endpoint == "" {
+		rec.Endpoint = endpointName(r.URL.Path)
+	}
+	if rec.UpstreamStatus == 0 {
+		// Usage is only recorded from successful responses unless the
+		// handler says otherwise.
+		rec.UpstreamStatus = http.StatusOK
+	}
+	if rec.LatencyMs > 0 {
+		rec.OutputTokensPerSec = float64(rec.CompletionTokens) / (float64(rec.LatencyMs) / 1000)
+	}
+	rec.EstimatedCostUSD = rec.Cost(s.pricing)
+	rec.CreatedAt = time.Now().UTC()
+	if res, ok := r.Context().Value(reservationKey{}).(*ratelimit.Reservation); ok {
+		res.Spend(rec.TotalTokens)
+	}
+	noteUsage(r, rec)
+	s.noteSpend(r, rec)
+	// Record even if the client has gone away: the usage was still billed.
+	if err := s.tracker.Record(context.WithoutCancel(r.Context()), rec); err != nil {
+		log.Printf("usage record error: %v", err)
 	}
+}
 
-	proxy := &httputil.ReverseProxy{
-		Director: func(req *http.Request) {
-			req.URL.Scheme = target.Scheme
-			req.URL.Host = target.Host
-			req.Host = target.Host
-			req.Header.Set("Authorization", "Bearer "+provider.APIKey)
-		},
+// endpointName returns the usage endpoint dimension for a request path.
+func endpointName(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/v1/chat/"):
+		return "chat"
+	case strings.HasPrefix(path, "/v1/assistants"), strings.HasPrefix(path, "/v1/threads"):
+		return "assistants"
+	case strings.HasPrefix(path, "/v1/audio/"):
+		return strings.TrimPrefix(path, "/v1/audio/")
+	}
+	name, _, _ := strings.Cut(strings.TrimPrefix(path, "/v1/"), "/")
+	switch name {
+	case "messages", "embeddings", "images", "realtime":
+		return name
 	}
-	proxy.ServeHTTP(w, r)
+	return ""
 }
 
 // resolveLabels extracts attribution labels from headers, falling back to config key_labels.
+// Header values are client-supplied and go through the label validator;
+// key_labels come from config and are used as-is.
 func (s *Server) resolveLabels(r *http.Request, clientKey string) (team, project, env string) {
-	team = r.Header.Get("X-Pario-Team")
-	project = r.Header.Get("X-Pario-Project")
-	env = r.Header.Get("X-Pario-Env")
+	team = s.labels.Value("team", r.Header.Get("X-Pario-Team"))
+	project = s.labels.Value("project", r.Header.Get("X-Pario-Project"))
+	env = s.labels.Value("env", r.Header.Get("X-Pario-Env"))
 
 	if team == "" && project == "" && env == "" {
 		if labels, ok := s.cfg.Attribution.KeyLabels[clientKey]; ok {
@@ -841,6 +1320,55 @@ func (s *Server) resolveLabels(r *http.Request, clientKey string) (team, project
 	return team, project, env
 }
 
+// resolveBuild extracts CI/developer build attribution from the
+// X-Pario-Pipeline, X-Pario-Branch, and X-Pario-Commit headers. Commits are
+// unique by nature, so they are normalized but exempt from cardinality caps.
+func (s *Server) resolveBuild(r *http.Request) (pipeline, branch, commit string) {
+	pipeline = s.labels.Value("pipeline", r.Header.Get("X-Pario-Pipeline"))
+	branch = s.labels.Value("branch", r.Header.Get("X-Pario-Branch"))
+	commit = s.labels.Normalize(r.Header.Get("X-Pario-Commit"))
+	return pipeline, branch, commit
+}
+
+// resolveMetadata reads the headers named in attribution.metadata_headers.
+// Values such as trace IDs are unique by nature, so they are normalized but
+// exempt from cardinality caps. It returns nil if none of the headers is set.
+func (s *Server) resolveMetadata(r *http.Request) map[string]string {
+	var md map[string]string
+	for name, header := range s.cfg.Attribution.MetadataHeaders {
+		v := s.labels.Normalize(r.Header.Get(header))
+		if v == "" {
+			continue
+		}
+		if md == nil {
+			md = make(map[string]string)
+		}
+		md[name] = v
+	}
+	return md
+}
+
+// parseLabels parses an X-Pario-Labels header of the form "k=v,k2=v2".
+// Entries without a key are ignored; a later duplicate key wins.
+func parseLabels(header string) map[string]string {
+	if header == "" {
+		return nil
+	}
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		labels[k] = strings.TrimSpace(v)
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
 func extractAPIKey(r *http.Request) string {
 	auth := r.Header.Get("Authorization")
 	if strings.HasPrefix(auth, "Bearer ") {
@@ -851,9 +1379,3 @@ func extractAPIKey(r *http.Request) string {
 	}
 	return ""
 }
-
-func writeJSONError(w http.ResponseWriter, code int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	fmt.Fprintf(w, `{"error":{"message":%q,"type":"pario_error","code":%d}}`, message, code)
-}
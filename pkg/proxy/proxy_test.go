@@ -4,13 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/pario-ai/pario/pkg/attribution"
 	"github.com/pario-ai/pario/pkg/budget"
 	cachepkg "github.com/pario-ai/pario/pkg/cache/sqlite"
 	"github.com/pario-ai/pario/pkg/config"
@@ -143,7 +146,8 @@ func TestBudgetExceeded(t *testing.T) {
 	})
 
 	enforcer := budget.New([]models.BudgetPolicy{
-		{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily},
+		{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily,
+			Message: "Daily quota used up; ask #ml-platform for more.", HelpURL: "https://wiki.example.com/quotas"},
 	}, tr)
 
 	cfg := &config.Config{
@@ -161,7 +165,282 @@ func TestBudgetExceeded(t *testing.T) {
 	srv.ServeHTTP(w, req)
 
 	if w.Code != http.StatusTooManyRequests {
-		t.Errorf("expected 429, got %d", w.Code)
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	// The daily period resets at the next UTC midnight.
+	secs, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || secs < 1 || secs > 24*60*60 {
+		t.Errorf("Retry-After = %q, want seconds until midnight", w.Header().Get("Retry-After"))
+	}
+	var env errorEnvelope
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Error.Reason != "budget_exceeded" {
+		t.Errorf("reason = %q, want budget_exceeded", env.Error.Reason)
+	}
+	if env.Error.Message != "Daily quota used up; ask #ml-platform for more." {
+		t.Errorf("message = %q, want the policy's message", env.Error.Message)
+	}
+	if env.Error.HelpURL != "https://wiki.example.com/quotas" {
+		t.Errorf("help_url = %q", env.Error.HelpURL)
+	}
+}
+
+func TestTeamBudgetExceeded(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	tr, _ := tracker.New(filepath.Join(dir, "tracker.db"))
+	defer func() { _ = tr.Close() }()
+
+	// Another key used up the team's budget.
+	_ = tr.Record(context.Background(), models.UsageRecord{
+		APIKey: "other-key", Model: "gpt-4", TotalTokens: 1100, Team: "ml",
+		CreatedAt: time.Now().UTC(),
+	})
+
+	enforcer := budget.New([]models.BudgetPolicy{
+		{Team: "ml", MaxTokens: 1000, Period: models.BudgetDaily},
+	}, tr)
+
+	cfg := &config.Config{
+		Listen:    ":0",
+		Providers: []config.ProviderConfig{{Name: "test", URL: upstream.URL, APIKey: "sk-provider"}},
+		Session:   config.SessionConfig{GapTimeout: 30 * time.Minute},
+	}
+
+	srv := New(cfg, tr, nil, enforcer, nil)
+
+	for _, team := range []string{"ml", "web"} {
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		req.Header.Set("X-Pario-Team", team)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		if blocked := w.Code == http.StatusTooManyRequests; blocked != (team == "ml") {
+			t.Errorf("team %s: got %d", team, w.Code)
+		}
+	}
+}
+
+func TestBudgetHeaders(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	tr, _ := tracker.New(filepath.Join(dir, "tracker.db"))
+	defer func() { _ = tr.Close() }()
+	_ = tr.Record(context.Background(), models.UsageRecord{
+		APIKey: "client-key", Model: "gpt-4", TotalTokens: 400, CreatedAt: time.Now().UTC(),
+	})
+
+	// The per-model policy has the larger fraction used.
+	enforcer := budget.New([]models.BudgetPolicy{
+		{APIKey: "*", MaxTokens: 100000, Period: models.BudgetDaily},
+		{APIKey: "client-key", Model: "gpt-4", MaxTokens: 1000, Period: models.BudgetDaily},
+	}, tr)
+	cfg := &config.Config{
+		Listen:    ":0",
+		Providers: []config.ProviderConfig{{Name: "test", URL: upstream.URL, APIKey: "sk-provider"}},
+		Session:   config.SessionConfig{GapTimeout: 30 * time.Minute},
+	}
+	srv := New(cfg, tr, nil, enforcer, nil)
+
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	// Used includes the request's own 15 tokens.
+	want := map[string]string{
+		"X-Pario-Budget-Unit":      "tokens",
+		"X-Pario-Budget-Limit":     "1000",
+		"X-Pario-Budget-Used":      "415",
+		"X-Pario-Budget-Remaining": "585",
+	}
+	for h, v := range want {
+		if got := w.Header().Get(h); got != v {
+			t.Errorf("%s = %q, want %q", h, got, v)
+		}
+	}
+	if reset, err := strconv.Atoi(w.Header().Get("X-Pario-Budget-Reset")); err != nil || reset < 1 {
+		t.Errorf("X-Pario-Budget-Reset = %q", w.Header().Get("X-Pario-Budget-Reset"))
+	}
+}
+
+func TestBudgetReservations(t *testing.T) {
+	arrived := make(chan struct{}, 3)
+	unblock := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-unblock
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{Model: "gpt-4", Usage: &models.Usage{TotalTokens: 10}})
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	tr, _ := tracker.New(filepath.Join(dir, "tracker.db"))
+	defer func() { _ = tr.Close() }()
+	enforcer := budget.New([]models.BudgetPolicy{
+		{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily},
+	}, tr)
+	cfg := &config.Config{
+		Listen:    ":0",
+		Providers: []config.ProviderConfig{{Name: "test", URL: upstream.URL, APIKey: "sk-provider"}},
+		Session:   config.SessionConfig{GapTimeout: 30 * time.Minute},
+	}
+	srv := New(cfg, tr, nil, enforcer, nil)
+
+	send := func(i int) int {
+		body := fmt.Sprintf(`{"model":"gpt-4","max_tokens":600,"messages":[{"role":"user","content":"request %d"}]}`, i)
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Two requests in flight reserve 1200 tokens between them, so a third
+	// is refused although nothing has been recorded.
+	codes := make(chan int, 2)
+	for i := range 2 {
+		go func() { codes <- send(i) }()
+		<-arrived
+	}
+	if code := send(2); code != http.StatusTooManyRequests {
+		t.Errorf("third request: got %d, want 429", code)
+	}
+	close(unblock)
+	for range 2 {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("in-flight request: got %d, want 200", code)
+		}
+	}
+
+	// Once they finish, only their recorded usage counts.
+	if code := send(3); code != http.StatusOK {
+		t.Errorf("after release: got %d, want 200", code)
+	}
+}
+
+func TestBudgetDowngrade(t *testing.T) {
+	var upstreamModels []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		upstreamModels = append(upstreamModels, req.Model)
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{Model: req.Model, Usage: &models.Usage{TotalTokens: 2}})
+	}))
+	defer upstream.Close()
+
+	tr, _ := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	defer func() { _ = tr.Close() }()
+	enforcer := budget.New([]models.BudgetPolicy{
+		{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily, DowngradeAt: 0.8},
+	}, tr)
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{Name: "test", URL: upstream.URL, APIKey: "sk-provider"}},
+		Router: config.RouterConfig{Routes: []config.RouteConfig{{
+			Model: "smart",
+			Targets: []config.RouteTarget{
+				{Provider: "test", Model: "big"},
+				{Provider: "test", Model: "small", Downgrade: true},
+			},
+		}}},
+	}
+	srv := New(cfg, tr, nil, enforcer, nil)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"smart","messages":[]}`))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return w
+	}
+
+	if w := send(); w.Header().Get("X-Pario-Downgraded") != "" {
+		t.Error("request under downgrade_at marked downgraded")
+	}
+	_ = tr.Record(context.Background(), models.UsageRecord{
+		APIKey: "client-key", Model: "big", TotalTokens: 900, CreatedAt: time.Now().UTC(),
+	})
+	if w := send(); w.Header().Get("X-Pario-Downgraded") != "budget" {
+		t.Errorf("X-Pario-Downgraded = %q, want budget", w.Header().Get("X-Pario-Downgraded"))
+	}
+	if len(upstreamModels) != 2 || upstreamModels[0] != "big" || upstreamModels[1] != "small" {
+		t.Errorf("upstream models = %v, want [big small]", upstreamModels)
+	}
+}
+
+func TestBudgetDowngradeAction(t *testing.T) {
+	var upstreamModels []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		upstreamModels = append(upstreamModels, req.Model)
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{Model: req.Model, Usage: &models.Usage{TotalTokens: 2}})
+	}))
+	defer upstream.Close()
+
+	tr, _ := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	defer func() { _ = tr.Close() }()
+	enforcer := budget.New([]models.BudgetPolicy{
+		{APIKey: "*", MaxTokens: 1000, Period: models.BudgetDaily, Action: models.BudgetDowngrade},
+	}, tr)
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{Name: "test", URL: upstream.URL, APIKey: "sk-provider"}},
+		Router: config.RouterConfig{Routes: []config.RouteConfig{
+			{
+				Model: "smart",
+				Targets: []config.RouteTarget{
+					{Provider: "test", Model: "big"},
+					{Provider: "test", Model: "small", Downgrade: true},
+				},
+			},
+			{Model: "plain", Targets: []config.RouteTarget{{Provider: "test", Model: "big"}}},
+		}},
+	}
+	srv := New(cfg, tr, nil, enforcer, nil)
+
+	send := func(model string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"`+model+`","messages":[]}`))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	_ = tr.Record(context.Background(), models.UsageRecord{
+		APIKey: "client-key", Model: "big", TotalTokens: 1200, CreatedAt: time.Now().UTC(),
+	})
+	w := send("smart")
+	if w.Code != http.StatusOK {
+		t.Fatalf("route with downgrade target: got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("X-Pario-Downgraded"); got != "budget" {
+		t.Errorf("X-Pario-Downgraded = %q, want budget", got)
+	}
+	if len(upstreamModels) != 1 || upstreamModels[0] != "small" {
+		t.Errorf("upstream models = %v, want [small]", upstreamModels)
+	}
+
+	if w := send("plain"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("route without downgrade target: got %d, want 429", w.Code)
 	}
 }
 
@@ -286,6 +565,66 @@ func TestAnthropicMessages(t *testing.T) {
 	}
 }
 
+func TestCacheAndReasoningTokens(t *testing.T) {
+	tests := []struct {
+		name                           string
+		anthropic                      bool
+		body                           string
+		prompt, cacheRead, cacheCreate int
+		reasoning                      int
+	}{
+		{
+			name:      "anthropic",
+			anthropic: true,
+			body: `{"id":"msg_1","type":"message","model":"claude-sonnet-4-20250514","content":[{"type":"text","text":"hi"}],
+				"usage":{"input_tokens":12,"output_tokens":8,"cache_read_input_tokens":100,"cache_creation_input_tokens":20}}`,
+			prompt: 132, cacheRead: 100, cacheCreate: 20,
+		},
+		{
+			name: "openai",
+			body: `{"id":"c1","model":"o3","choices":[{"message":{"role":"assistant","content":"hi"}}],
+				"usage":{"prompt_tokens":132,"completion_tokens":8,"total_tokens":140,
+				"prompt_tokens_details":{"cached_tokens":100},"completion_tokens_details":{"reasoning_tokens":5}}}`,
+			prompt: 132, cacheRead: 100, reasoning: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer upstream.Close()
+
+			path, body := "/v1/chat/completions", `{"model":"o3","messages":[{"role":"user","content":"hi"}]}`
+			srv := setupProxy(t, upstream)
+			if tt.anthropic {
+				path, body = "/v1/messages", `{"model":"claude-sonnet-4-20250514","messages":[{"role":"user","content":"hi"}],"max_tokens":64}`
+				srv = setupAnthropicProxy(t, upstream)
+			}
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer client-key")
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute).UTC())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recs) != 1 {
+				t.Fatalf("expected 1 record, got %d", len(recs))
+			}
+			r := recs[0]
+			if r.PromptTokens != tt.prompt || r.CompletionTokens != 8 || r.TotalTokens != tt.prompt+8 ||
+				r.CacheReadTokens != tt.cacheRead || r.CacheCreationTokens != tt.cacheCreate || r.ReasoningTokens != tt.reasoning {
+				t.Errorf("record = %+v", r)
+			}
+		})
+	}
+}
+
 func TestAnthropicXAPIKeyAuth(t *testing.T) {
 	upstream := newAnthropicUpstream()
 	defer upstream.Close()
@@ -432,11 +771,274 @@ func TestFallbackOn5xx(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
 	}
+	if got := w.Header().Get("X-Pario-Provider"); got != "fallback" {
+		t.Errorf("X-Pario-Provider = %q, want fallback", got)
+	}
+	if got := w.Header().Get("X-Pario-Model"); got != "gpt-4o-mini" {
+		t.Errorf("X-Pario-Model = %q, want gpt-4o-mini", got)
+	}
 	if callCount != 2 {
 		t.Errorf("expected 2 upstream calls (1 fail + 1 success), got %d", callCount)
 	}
 }
 
+func TestRateLimitHeadersReorderRoutes(t *testing.T) {
+	var primaryCalls, fallbackCalls int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls++
+		w.Header().Set("x-ratelimit-remaining-requests", "0")
+		w.Header().Set("x-ratelimit-reset-requests", "1m")
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{Model: "gpt-4", Usage: &models.Usage{TotalTokens: 2}})
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackCalls++
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{Model: "gpt-4o-mini", Usage: &models.Usage{TotalTokens: 2}})
+	}))
+	defer fallback.Close()
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "primary", URL: primary.URL, APIKey: "sk-1"},
+			{Name: "fallback", URL: fallback.URL, APIKey: "sk-2"},
+		},
+		Router: config.RouterConfig{Routes: []config.RouteConfig{{
+			Model: "gpt-4",
+			Targets: []config.RouteTarget{
+				{Provider: "primary", Model: "gpt-4"},
+				{Provider: "fallback", Model: "gpt-4o-mini"},
+			},
+		}}},
+	}
+	tr, err := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tr.Close() }()
+	srv := New(cfg, tr, nil, nil, nil)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[]}`))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+	if primaryCalls != 1 || fallbackCalls != 1 {
+		t.Errorf("expected second request to skip exhausted primary, got primary=%d fallback=%d", primaryCalls, fallbackCalls)
+	}
+}
+
+func TestLatencyStrategyReordersRoutes(t *testing.T) {
+	var primaryCalls, fallbackCalls int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls++
+		time.Sleep(50 * time.Millisecond)
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{Model: "gpt-4", Usage: &models.Usage{TotalTokens: 2}})
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackCalls++
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{Model: "gpt-4o-mini", Usage: &models.Usage{TotalTokens: 2}})
+	}))
+	defer fallback.Close()
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "primary", URL: primary.URL, APIKey: "sk-1"},
+			{Name: "fallback", URL: fallback.URL, APIKey: "sk-2"},
+		},
+		Router: config.RouterConfig{Routes: []config.RouteConfig{{
+			Model:    "gpt-4",
+			Strategy: config.StrategyLatency,
+			Targets: []config.RouteTarget{
+				{Provider: "primary", Model: "gpt-4"},
+				{Provider: "fallback", Model: "gpt-4o-mini"},
+			},
+		}}},
+	}
+	tr, err := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tr.Close() }()
+	srv := New(cfg, tr, nil, nil, nil)
+
+	// The first request measures primary, the second the unmeasured
+	// fallback; the third goes to the faster of the two.
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[]}`))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+	if primaryCalls != 1 || fallbackCalls != 2 {
+		t.Errorf("expected faster fallback preferred, got primary=%d fallback=%d", primaryCalls, fallbackCalls)
+	}
+	if got := srv.router.Latencies(); len(got) != 2 {
+		t.Errorf("expected latency for both targets, got %+v", got)
+	}
+}
+
+func TestCooldownSkipsFailingTarget(t *testing.T) {
+	var primaryCalls, fallbackCalls int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackCalls++
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{Model: "gpt-4o-mini", Usage: &models.Usage{TotalTokens: 2}})
+	}))
+	defer fallback.Close()
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "primary", URL: primary.URL, APIKey: "sk-1"},
+			{Name: "fallback", URL: fallback.URL, APIKey: "sk-2"},
+		},
+		Router: config.RouterConfig{
+			Cooldown: config.CooldownConfig{Failures: 2, Duration: time.Minute},
+			Routes: []config.RouteConfig{{
+				Model: "gpt-4",
+				Targets: []config.RouteTarget{
+					{Provider: "primary", Model: "gpt-4"},
+					{Provider: "fallback", Model: "gpt-4o-mini"},
+				},
+			}},
+		},
+	}
+	tr, err := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tr.Close() }()
+	srv := New(cfg, tr, nil, nil, nil)
+
+	// Two failures cool primary down, so the third request skips it.
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[]}`))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+	if primaryCalls != 2 || fallbackCalls != 3 {
+		t.Errorf("expected cooling target skipped, got primary=%d fallback=%d", primaryCalls, fallbackCalls)
+	}
+	if got := srv.router.Cooldowns(); len(got) != 1 || got[0].Provider != "primary" || got[0].CoolingUntil.IsZero() {
+		t.Errorf("expected primary cooling down, got %+v", got)
+	}
+}
+
+func TestUnmatchedModelRejected(t *testing.T) {
+	var calls int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{Model: "gpt-4o-mini", Usage: &models.Usage{TotalTokens: 2}})
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{Name: "openai", URL: upstream.URL, APIKey: "sk-1"}},
+		Router: config.RouterConfig{
+			Unmatched: config.UnmatchedReject,
+			Routes: []config.RouteConfig{{
+				Model:   "fast",
+				Targets: []config.RouteTarget{{Provider: "openai", Model: "gpt-4o-mini"}},
+			}},
+		},
+	}
+	tr, err := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tr.Close() }()
+	srv := New(cfg, tr, nil, nil, nil)
+
+	for _, tt := range []struct {
+		model string
+		want  int
+	}{{"fast", http.StatusOK}, {"gtp-4o", http.StatusNotFound}} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"`+tt.model+`","messages":[]}`))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.model, tt.want, w.Code, w.Body.String())
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected only the routed model sent upstream, got %d calls", calls)
+	}
+}
+
+func TestStickySession(t *testing.T) {
+	var primaryCalls, fallbackCalls int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls++
+		if primaryCalls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{Model: "gpt-4", Usage: &models.Usage{TotalTokens: 2}})
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackCalls++
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{Model: "gpt-4o-mini", Usage: &models.Usage{TotalTokens: 2}})
+	}))
+	defer fallback.Close()
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "primary", URL: primary.URL, APIKey: "sk-1"},
+			{Name: "fallback", URL: fallback.URL, APIKey: "sk-2"},
+		},
+		Router: config.RouterConfig{Routes: []config.RouteConfig{{
+			Model:  "gpt-4",
+			Sticky: true,
+			Targets: []config.RouteTarget{
+				{Provider: "primary", Model: "gpt-4"},
+				{Provider: "fallback", Model: "gpt-4o-mini"},
+			},
+		}}},
+	}
+	tr, err := tracker.New(filepath.Join(t.TempDir(), "tracker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tr.Close() }()
+	srv := New(cfg, tr, nil, nil, nil)
+
+	send := func(session string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[]}`))
+		req.Header.Set("Authorization", "Bearer client-key")
+		req.Header.Set("X-Pario-Session", session)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+	}
+
+	send("conv-1") // primary fails; fallback serves and the session is pinned to it
+	send("conv-1") // stays on fallback although primary is back
+	send("conv-2") // a new session starts on primary
+	if primaryCalls != 2 || fallbackCalls != 2 {
+		t.Errorf("got primary=%d fallback=%d, want 2 and 2", primaryCalls, fallbackCalls)
+	}
+}
+
 func TestNoFallbackOn4xx(t *testing.T) {
 	callCount := 0
 	upstream1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -593,6 +1195,54 @@ func TestModelRewriteInBody(t *testing.T) {
 	}
 }
 
+func TestRequestFidelity(t *testing.T) {
+	var received []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received = append(received, string(b))
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{
+			ID:      "chatcmpl-fid",
+			Choices: []models.Choice{{Message: models.ChatMessage{Role: "assistant", Content: "ok"}, FinishReason: "stop"}},
+			Usage:   &models.Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7},
+		})
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+
+	// Array content, tool calls, and unmodeled fields must reach the
+	// provider byte for byte.
+	body := `{"model":"gpt-4o", "messages":[{"role":"user","content":[{"type":"text","text":"<what's this?>"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}}]},` +
+		`{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{\"q\":1}"}}]},` +
+		`{"role":"tool","tool_call_id":"call_1","content":"42"}],` +
+		`"tools":[{"type":"function","function":{"name":"lookup","parameters":{"type":"object"}}}],"tool_choice":"auto","parallel_tool_calls":false,"seed":7,"logprobs":true,"top_logprobs":2}`
+	withoutTools := `{"model":"gpt-4o", "messages":[{"role":"user","content":[{"type":"text","text":"<what's this?>"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}}]},` +
+		`{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{\"q\":1}"}}]},` +
+		`{"role":"tool","tool_call_id":"call_1","content":"42"}]}`
+
+	for _, b := range []string{body, body, withoutTools} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(b))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	// The repeated request is served from cache; dropping the tools is a
+	// different request.
+	if len(received) != 2 {
+		t.Fatalf("upstream received %d requests, want 2", len(received))
+	}
+	if received[0] != body {
+		t.Errorf("upstream body changed:\n got %s\nwant %s", received[0], body)
+	}
+	if received[1] != withoutTools {
+		t.Errorf("upstream body changed:\n got %s\nwant %s", received[1], withoutTools)
+	}
+}
+
 func TestTransportErrorFallback(t *testing.T) {
 	// upstream1 is a closed server (transport error)
 	upstream1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
@@ -755,6 +1405,9 @@ func TestStreamingChatCompletions(t *testing.T) {
 			if s.TotalTokens != 15 {
 				t.Errorf("expected 15 total tokens tracked, got %d", s.TotalTokens)
 			}
+			if s.StreamedRequests != 1 {
+				t.Errorf("expected request flagged as streamed, got %d", s.StreamedRequests)
+			}
 		}
 	}
 	if !found {
@@ -762,6 +1415,118 @@ func TestStreamingChatCompletions(t *testing.T) {
 	}
 }
 
+func TestIncludeStreamUsage(t *testing.T) {
+	tests := []struct {
+		body, want string
+		injected   bool
+	}{
+		{`{"model":"m","stream":true}`, `{"stream_options":{"include_usage":true},"model":"m","stream":true}`, true},
+		{`{"stream":true,"stream_options":null}`, `{"stream":true,"stream_options":{"include_usage":true}}`, true},
+		{`{"stream":true,"stream_options":{"include_obfuscation":false}}`, `{"stream":true,"stream_options":{"include_usage":true,"include_obfuscation":false}}`, true},
+		{`{"stream":true,"stream_options":{"include_usage":false}}`, `{"stream":true,"stream_options":{"include_usage":true}}`, true},
+		{`{"stream":true,"stream_options":{"include_usage":true}}`, `{"stream":true,"stream_options":{"include_usage":true}}`, false},
+	}
+	for _, tt := range tests {
+		got, injected := includeStreamUsage([]byte(tt.body))
+		if string(got) != tt.want || injected != tt.injected {
+			t.Errorf("includeStreamUsage(%s) = %s, %v; want %s, %v", tt.body, got, injected, tt.want, tt.injected)
+		}
+	}
+}
+
+func TestStreamUsageInjected(t *testing.T) {
+	const (
+		chunk      = `data: {"id":"c1","model":"gpt-4","choices":[{"index":0,"delta":{"content":"Hi"}}],"usage":null}` + "\n\n"
+		usageChunk = `data: {"id":"c1","model":"gpt-4","choices":[],"usage":{"prompt_tokens":8,"completion_tokens":1,"total_tokens":9}}` + "\n\n"
+		done       = "data: [DONE]\n\n"
+	)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			StreamOptions struct {
+				IncludeUsage bool `json:"include_usage"`
+			} `json:"stream_options"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, chunk)
+		if req.StreamOptions.IncludeUsage {
+			fmt.Fprint(w, usageChunk)
+		}
+		fmt.Fprint(w, done)
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	tests := []struct {
+		name, body, want string
+	}{
+		{"client did not ask", `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"stream":true}`, chunk + done},
+		{"client asked", `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"stream":true,"stream_options":{"include_usage":true}}`, chunk + usageChunk + done},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.name)
+			w := &flusherRecorder{ResponseRecorder: httptest.NewRecorder()}
+			srv.ServeHTTP(w, req)
+
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("client received:\n%s\nwant:\n%s", got, tt.want)
+			}
+			total, err := srv.tracker.TotalByKey(context.Background(), tt.name, time.Now().Add(-time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 9 {
+				t.Errorf("tracked %d tokens, want 9", total)
+			}
+		})
+	}
+}
+
+func TestUsageRecordsProviderAndLatency(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		resp := models.ChatCompletionResponse{
+			ID:    "chatcmpl-123",
+			Model: "gpt-4",
+			Usage: &models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(recs))
+	}
+	if recs[0].Provider != "test" {
+		t.Errorf("expected provider test, got %q", recs[0].Provider)
+	}
+	if recs[0].LatencyMs < 20 {
+		t.Errorf("expected latency >= 20ms, got %d", recs[0].LatencyMs)
+	}
+	want := 5 / (float64(recs[0].LatencyMs) / 1000)
+	if recs[0].OutputTokensPerSec != want {
+		t.Errorf("expected %.2f tok/s, got %.2f", want, recs[0].OutputTokensPerSec)
+	}
+}
+
 func TestStreamingMessages(t *testing.T) {
 	upstream := newStreamingAnthropicUpstream()
 	defer upstream.Close()
@@ -867,6 +1632,9 @@ func TestStreamingFallback(t *testing.T) {
 	if !strings.Contains(w.Body.String(), "data: [DONE]") {
 		t.Error("expected SSE stream from fallback")
 	}
+	if got := w.Header().Get("X-Pario-Provider"); got != "fallback" {
+		t.Errorf("X-Pario-Provider = %q, want fallback", got)
+	}
 }
 
 func TestStreamingSkipsCache(t *testing.T) {
@@ -912,3 +1680,567 @@ func TestStreamingSkipsCache(t *testing.T) {
 		t.Error("second request should still stream, not be cached")
 	}
 }
+
+func TestDeterministicOnlyCache(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+	anthropic := newAnthropicUpstream()
+	defer anthropic.Close()
+
+	dir := t.TempDir()
+	tr, _ := tracker.New(filepath.Join(dir, "tracker.db"))
+	defer func() { _ = tr.Close() }()
+
+	c, _ := cachepkg.New(filepath.Join(dir, "cache.db"), time.Hour)
+	defer func() { _ = c.Close() }()
+
+	cfg := &config.Config{
+		Listen: ":0",
+		Providers: []config.ProviderConfig{
+			{Name: "openai", URL: upstream.URL, APIKey: "sk-provider"},
+			{Name: "anthropic", URL: anthropic.URL, APIKey: "sk-ant"},
+		},
+		Router: config.RouterConfig{Routes: []config.RouteConfig{
+			{Model: "claude-*", Targets: []config.RouteTarget{{Provider: "anthropic"}}},
+		}},
+		Session: config.SessionConfig{GapTimeout: 30 * time.Minute},
+		Cache:   config.CacheConfig{Enabled: true, DeterministicOnly: true, AnyRequestModels: []string{"gpt-3.5-*"}},
+	}
+	srv := New(cfg, tr, c, nil, nil)
+
+	tests := []struct {
+		name, path, body string
+		want             string // X-Pario-Cache of the second request
+	}{
+		{"temperature 0", "/v1/chat/completions", `{"model":"gpt-4","temperature":0,"messages":[{"role":"user","content":"a"}]}`, "hit"},
+		{"default temperature", "/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"b"}]}`, "bypass"},
+		{"temperature 1", "/v1/chat/completions", `{"model":"gpt-4","temperature":1,"messages":[{"role":"user","content":"c"}]}`, "bypass"},
+		{"top_p", "/v1/chat/completions", `{"model":"gpt-4","temperature":0,"top_p":0.5,"messages":[{"role":"user","content":"d"}]}`, "bypass"},
+		{"tools", "/v1/chat/completions", `{"model":"gpt-4","temperature":0,"tools":[{"type":"function","function":{"name":"f"}}],"messages":[{"role":"user","content":"e"}]}`, "bypass"},
+		{"exempt model", "/v1/chat/completions", `{"model":"gpt-3.5-turbo","temperature":1,"messages":[{"role":"user","content":"f"}]}`, "hit"},
+		{"messages temperature 0", "/v1/messages", `{"model":"claude-sonnet-4-20250514","max_tokens":100,"temperature":0,"messages":[{"role":"user","content":"g"}]}`, "hit"},
+		{"messages default temperature", "/v1/messages", `{"model":"claude-sonnet-4-20250514","max_tokens":100,"messages":[{"role":"user","content":"h"}]}`, "bypass"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for range 2 {
+				req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+				req.Header.Set("Authorization", "Bearer client-key")
+				w := httptest.NewRecorder()
+				srv.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+				}
+				got = append(got, w.Header().Get("X-Pario-Cache"))
+			}
+			if got[1] != tt.want {
+				t.Errorf("X-Pario-Cache = %v, want %q on the second request", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessagesCacheKey(t *testing.T) {
+	anthropic := newAnthropicUpstream()
+	defer anthropic.Close()
+
+	dir := t.TempDir()
+	tr, _ := tracker.New(filepath.Join(dir, "tracker.db"))
+	defer func() { _ = tr.Close() }()
+
+	c, _ := cachepkg.New(filepath.Join(dir, "cache.db"), time.Hour)
+	defer func() { _ = c.Close() }()
+
+	cfg := &config.Config{
+		Listen:    ":0",
+		Providers: []config.ProviderConfig{{Name: "anthropic", URL: anthropic.URL, APIKey: "sk-ant"}},
+		Session:   config.SessionConfig{GapTimeout: 30 * time.Minute},
+		Cache:     config.CacheConfig{Enabled: true},
+	}
+	srv := New(cfg, tr, c, nil, nil)
+
+	steps := []struct {
+		name, body string
+		want       string
+	}{
+		{"first", `{"model":"claude-sonnet-4-20250514","max_tokens":100,"system":"Be terse.","messages":[{"role":"user","content":"hi"}]}`, "miss"},
+		{"other system", `{"model":"claude-sonnet-4-20250514","max_tokens":100,"system":"Be verbose.","messages":[{"role":"user","content":"hi"}]}`, "miss"},
+		{"other max_tokens", `{"model":"claude-sonnet-4-20250514","max_tokens":200,"system":"Be terse.","messages":[{"role":"user","content":"hi"}]}`, "miss"},
+		{"repeat", `{"model":"claude-sonnet-4-20250514","max_tokens":100,"system":"Be terse.","messages":[{"role":"user","content":"hi"}]}`, "hit"},
+	}
+	for _, st := range steps {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(st.body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", st.name, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("X-Pario-Cache"); got != st.want {
+			t.Errorf("%s: X-Pario-Cache = %q, want %q", st.name, got, st.want)
+		}
+	}
+}
+
+func TestPartialUsageOnDisconnect(t *testing.T) {
+	tests := []struct {
+		name, path, body string
+		events           []string
+		wantPrompt       int
+		wantCompletion   int
+	}{
+		{
+			name: "messages reports input tokens up front",
+			path: "/v1/messages",
+			body: `{"model":"claude-sonnet-4-20250514","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"hi"}]}`,
+			events: []string{
+				`event: message_start` + "\n" + `data: {"type":"message_start","message":{"model":"claude-sonnet-4-20250514","usage":{"input_tokens":25,"output_tokens":1}}}`,
+				`event: content_block_delta` + "\n" + `data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello world!"}}`,
+			},
+			wantPrompt:     25,
+			wantCompletion: 3, // 12 bytes relayed beat the 1 reported
+		},
+		{
+			name: "chat completions estimates both",
+			path: "/v1/chat/completions",
+			body: `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`,
+			events: []string{
+				`data: {"id":"1","model":"gpt-4","choices":[{"index":0,"delta":{"content":"Hello world!"}}]}`,
+			},
+			wantPrompt:     messageTokens(json.RawMessage(`{"role":"user","content":"hi"}`)),
+			wantCompletion: 3, // 12 bytes
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for _, e := range tt.events {
+					fmt.Fprintf(w, "%s\n\n", e)
+				}
+				w.(http.Flusher).Flush()
+				<-r.Context().Done() // generating until the proxy gives up
+			}))
+			defer upstream.Close()
+
+			srv := setupProxy(t, upstream)
+			front := httptest.NewServer(srv)
+			defer front.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			req, _ := http.NewRequestWithContext(ctx, http.MethodPost, front.URL+tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer client-key")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := resp.Body.Read(make([]byte, 16)); err != nil {
+				t.Fatal(err)
+			}
+			cancel()
+			resp.Body.Close()
+
+			var recs []models.UsageRecord
+			deadline := time.Now().Add(2 * time.Second)
+			for len(recs) == 0 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+				recs, _ = srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+			}
+			if len(recs) != 1 {
+				t.Fatalf("expected one record for the aborted stream, got %d", len(recs))
+			}
+			rec := recs[0]
+			if !rec.Partial || !rec.Streamed {
+				t.Errorf("record not flagged partial: %+v", rec)
+			}
+			if rec.PromptTokens != tt.wantPrompt || rec.CompletionTokens != tt.wantCompletion ||
+				rec.TotalTokens != tt.wantPrompt+tt.wantCompletion {
+				t.Errorf("tokens = %d+%d=%d, want %d+%d", rec.PromptTokens, rec.CompletionTokens, rec.TotalTokens,
+					tt.wantPrompt, tt.wantCompletion)
+			}
+		})
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		header string
+		want   map[string]string
+	}{
+		{"", nil},
+		{"tier=enterprise", map[string]string{"tier": "enterprise"}},
+		{"tier=free, flag = new-ui ,exp=", map[string]string{"tier": "free", "flag": "new-ui", "exp": ""}},
+		{"=orphan,,tier=a,tier=b", map[string]string{"tier": "b"}},
+		{",,", nil},
+	}
+	for _, tt := range tests {
+		got := parseLabels(tt.header)
+		if len(got) != len(tt.want) {
+			t.Errorf("parseLabels(%q) = %v, want %v", tt.header, got, tt.want)
+			continue
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("parseLabels(%q)[%q] = %q, want %q", tt.header, k, got[k], v)
+			}
+		}
+	}
+}
+
+func TestLabelsHeaderRecorded(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	req.Header.Set("X-Pario-Labels", "tier=enterprise,experiment=b")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	reports, err := srv.tracker.LabelReport(context.Background(), models.LabelQuery{
+		Since:   time.Now().Add(-time.Minute).UTC(),
+		GroupBy: "experiment",
+		Filters: map[string]string{"tier": "enterprise"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].Value != "b" || reports[0].TotalTokens != 15 {
+		t.Errorf("unexpected label report: %+v", reports)
+	}
+}
+
+func TestMetadataHeadersRecorded(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Attribution.MetadataHeaders = map[string]string{"feature": "X-Pario-Feature", "trace_id": "X-Trace-Id"}
+
+	for _, feature := range []string{"checkout", "search"} {
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi from ` + feature + `"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		req.Header.Set("X-Pario-Feature", feature)
+		req.Header.Set("X-Trace-Id", "4bf92f3577b34da6")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+	}
+
+	recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[0].Metadata["trace_id"] != "4bf92f3577b34da6" {
+		t.Fatalf("unexpected records: %+v", recs)
+	}
+
+	reports, err := srv.tracker.LabelReport(context.Background(), models.LabelQuery{
+		Since:   time.Now().Add(-time.Minute).UTC(),
+		GroupBy: "metadata.feature",
+		Filters: models.MetadataFilters(nil, map[string]string{"feature": "search"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].Value != "search" || reports[0].TotalTokens != 15 {
+		t.Errorf("unexpected metadata report: %+v", reports)
+	}
+}
+
+func TestBuildHeadersRecorded(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	req.Header.Set("X-Pario-Pipeline", "review-bot")
+	req.Header.Set("X-Pario-Branch", "feature/retries")
+	req.Header.Set("X-Pario-Commit", "9fceb02")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("got %d records, want 1", len(recs))
+	}
+	if rec := recs[0]; rec.Pipeline != "review-bot" || rec.Branch != "feature/retries" || rec.Commit != "9fceb02" {
+		t.Errorf("build attribution = %q/%q/%q", rec.Pipeline, rec.Branch, rec.Commit)
+	}
+}
+
+func TestLabelsValidated(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.labels = attribution.NewValidator(config.LabelsConfig{
+		AllowedKeys:     []string{"tier"},
+		MaxValuesPerKey: 1,
+		Normalize:       true,
+	})
+
+	send := func(team, labels string) {
+		body := fmt.Sprintf(`{"model":"gpt-4","messages":[{"role":"user","content":%q}]}`, team)
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		req.Header.Set("X-Pario-Team", team)
+		req.Header.Set("X-Pario-Labels", labels)
+		srv.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	send(" Platform ", "Tier=Enterprise,user_id=u-1")
+	send("search", "tier=free")
+
+	records, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute).UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	teams := map[string]bool{}
+	tiers := map[string]bool{}
+	for _, rec := range records {
+		teams[rec.Team] = true
+		tiers[rec.Labels["tier"]] = true
+		if _, ok := rec.Labels["user_id"]; ok {
+			t.Errorf("disallowed key recorded: %v", rec.Labels)
+		}
+	}
+	if !teams["platform"] || !teams[attribution.DefaultOverflowValue] {
+		t.Errorf("teams = %v", teams)
+	}
+	if !tiers["enterprise"] || !tiers[attribution.DefaultOverflowValue] {
+		t.Errorf("tiers = %v", tiers)
+	}
+}
+
+func TestFallbackAccounting(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		upstream func() *httptest.Server
+		partial  string
+	}{
+		{
+			name:     "openai",
+			path:     "/v1/chat/completions",
+			body:     `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`,
+			upstream: newUpstream,
+			partial:  `{"model":"gpt-4","usage":{"prompt_tokens":10,"completion_tokens":3,"total_tokens":13}`,
+		},
+		{
+			name:     "openai streaming",
+			path:     "/v1/chat/completions",
+			body:     `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"stream":true}`,
+			upstream: newStreamingOpenAIUpstream,
+			partial:  "data: {\"model\":\"gpt-4\",\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":3,\"total_tokens\":13}}\n\n",
+		},
+		{
+			name:     "anthropic",
+			path:     "/v1/messages",
+			body:     `{"model":"gpt-4","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`,
+			upstream: newAnthropicUpstream,
+			partial:  `{"model":"gpt-4","usage":{"input_tokens":10,"output_tokens":3}`,
+		},
+		{
+			name:     "anthropic streaming",
+			path:     "/v1/messages",
+			body:     `{"model":"gpt-4","max_tokens":100,"messages":[{"role":"user","content":"hi"}],"stream":true}`,
+			upstream: newStreamingAnthropicUpstream,
+			partial:  "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"model\":\"gpt-4\",\"usage\":{\"input_tokens\":10}}}\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The primary fails with a 5xx after writing a partial body that
+			// already carries usage; only the fallback's usage may be recorded.
+			primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+				w.Write([]byte(tt.partial))
+			}))
+			defer primary.Close()
+			fallback := tt.upstream()
+			defer fallback.Close()
+
+			dir := t.TempDir()
+			tr, err := tracker.New(filepath.Join(dir, "tracker.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = tr.Close() }()
+
+			cfg := &config.Config{
+				Listen: ":0",
+				Providers: []config.ProviderConfig{
+					{Name: "primary", URL: primary.URL, APIKey: "sk-1"},
+					{Name: "fallback", URL: fallback.URL, APIKey: "sk-2"},
+				},
+				Router: config.RouterConfig{
+					Routes: []config.RouteConfig{{
+						Model: "gpt-4",
+						Targets: []config.RouteTarget{
+							{Provider: "primary", Model: "gpt-4"},
+							{Provider: "fallback", Model: "gpt-4"},
+						},
+					}},
+				},
+				Session: config.SessionConfig{GapTimeout: 30 * time.Minute},
+			}
+			srv := New(cfg, tr, nil, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer client-key")
+			w := &flusherRecorder{ResponseRecorder: httptest.NewRecorder()}
+			srv.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200 from fallback, got %d: %s", w.Code, w.Body.String())
+			}
+			records, err := tr.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute).UTC())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("expected 1 usage record, got %d: %+v", len(records), records)
+			}
+			rec := records[0]
+			if rec.Provider != "fallback" || rec.Attempt != 2 {
+				t.Errorf("record attributed to %q attempt %d, want fallback attempt 2", rec.Provider, rec.Attempt)
+			}
+			if rec.UpstreamStatus != http.StatusOK {
+				t.Errorf("record upstream status %d, want 200", rec.UpstreamStatus)
+			}
+			if rec.RouteAlias != "gpt-4" {
+				t.Errorf("record route alias %q, want gpt-4", rec.RouteAlias)
+			}
+			if id := w.Header().Get("X-Pario-Request-ID"); id == "" || rec.RequestID != id {
+				t.Errorf("record request ID %q, response header %q", rec.RequestID, id)
+			}
+
+			// The primary's failed attempt is recorded, and counted as
+			// recovered by the fallback.
+			srv.writes.Wait()
+			stats, err := tr.ProviderReliability(context.Background(), time.Now().Add(-time.Minute).UTC())
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []models.ProviderReliability{
+				{Provider: "fallback", Served: 1, Fallbacks: 1},
+				{Provider: "primary", Failures: 1, ErrorRate: 1, Recovered: 1},
+			}
+			if len(stats) != 2 || stats[0] != want[0] || stats[1] != want[1] {
+				t.Errorf("provider reliability = %+v, want %+v", stats, want)
+			}
+		})
+	}
+}
+
+func TestAuditRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"client header wins", "client-req-1", "client-req-1"},
+		{"falls back to proxy ID", "", "req_0123456789abcdef"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+			r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, "req_0123456789abcdef"))
+			if got := auditRequestID(r); got != tt.want {
+				t.Errorf("auditRequestID = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalProvider(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/chat/completions" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Authorization = %q, want none", auth)
+		}
+		w.Write([]byte(`{"id":"c1","object":"chat.completion","model":"llama3","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`))
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Providers[0] = config.ProviderConfig{Name: "test", URL: upstream.URL, Type: "openai-compatible", BasePath: "api/v1/"}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"model":"llama3","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStreamedUsageRecordedOnce(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(tr *tracker.SQLiteTracker)
+	}{
+		{"stored", func(*tracker.SQLiteTracker) {}},
+		{"left out by sampling", func(tr *tracker.SQLiteTracker) { tr.UseSampling(1e-9) }},
+		{"queued", func(tr *tracker.SQLiteTracker) { tr.UseAsyncWrites(10, 10, time.Hour) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newStreamingOpenAIUpstream()
+			defer upstream.Close()
+
+			srv := setupProxy(t, upstream)
+			tr := srv.tracker.(*tracker.SQLiteTracker)
+			tt.setup(tr)
+
+			body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"stream":true}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer client-key")
+			w := &flusherRecorder{ResponseRecorder: httptest.NewRecorder()}
+			srv.ServeHTTP(w, req)
+			id := w.Header().Get("X-Pario-Request-ID")
+			if w.Code != http.StatusOK || id == "" {
+				t.Fatalf("status %d, request ID %q", w.Code, id)
+			}
+
+			// A second code path reports the same attempt's usage.
+			again := req.WithContext(context.WithValue(context.Background(), requestIDKey{}, id))
+			srv.recordUsage(again, models.UsageRecord{APIKey: "client-key", Model: "gpt-4", Attempt: 1,
+				PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, Streamed: true})
+
+			ctx := context.Background()
+			since := time.Now().Add(-time.Minute)
+			spend, err := tr.SpendByKey(ctx, "client-key", "", since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(spend) != 1 || spend[0].RequestCount != 1 || spend[0].TotalTokens != 15 {
+				t.Errorf("spend = %+v, want one request of 15 tokens", spend)
+			}
+			if err := tr.Close(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/pario-ai/pario/pkg/queue"
+)
+
+// admit waits for upstream capacity at the request's priority. When the
+// request is shed or times out it writes a 503 and returns false; otherwise
+// the caller must call release once the upstream exchange is done.
+func (s *Server) admit(w http.ResponseWriter, r *http.Request, clientKey string) (release func(), ok bool) {
+	p := s.priority(r, clientKey)
+	release, err := s.queue.Acquire(r.Context(), p)
+	if err == nil {
+		return release, true
+	}
+	switch {
+	case errors.Is(err, queue.ErrShed), errors.Is(err, queue.ErrTimeout):
+		w.Header().Set("Retry-After", "1")
+		writeJSONError(w, http.StatusServiceUnavailable, "proxy overloaded: "+err.Error())
+	default:
+		// The client went away while queued; nothing useful to write.
+		log.Printf("queue wait abandoned (%s priority): %v", p, err)
+	}
+	return nil, false
+}
+
+// priority resolves a request's priority from the X-Pario-Priority header,
+// the key's configured priority, and queue.default_priority. A key with a
+// configured priority may use the header to lower it but not to raise it.
+func (s *Server) priority(r *http.Request, clientKey string) queue.Priority {
+	base, _ := queue.ParsePriority(s.cfg.Queue.DefaultPriority)
+	configured, hasKey := s.cfg.Queue.KeyPriorities[clientKey]
+	if hasKey {
+		base, _ = queue.ParsePriority(configured)
+	}
+
+	h := r.Header.Get("X-Pario-Priority")
+	if h == "" {
+		return base
+	}
+	p, err := queue.ParsePriority(h)
+	if err != nil {
+		return base
+	}
+	if hasKey && p > base {
+		return base
+	}
+	return p
+}
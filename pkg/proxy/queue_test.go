@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/queue"
+)
+
+func TestPriority(t *testing.T) {
+	srv := &Server{cfg: &config.Config{Queue: config.QueueConfig{
+		DefaultPriority: "normal",
+		KeyPriorities:   map[string]string{"batch-key": "low", "ui-key": "high"},
+	}}}
+
+	tests := []struct {
+		key, header string
+		want        queue.Priority
+	}{
+		{"other", "", queue.Normal},
+		{"other", "high", queue.High},
+		{"other", "bogus", queue.Normal},
+		{"batch-key", "", queue.Low},
+		{"batch-key", "high", queue.Low}, // configured keys can't raise
+		{"ui-key", "low", queue.Low},     // but can lower
+		{"ui-key", "", queue.High},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		if tt.header != "" {
+			req.Header.Set("X-Pario-Priority", tt.header)
+		}
+		if got := srv.priority(req, tt.key); got != tt.want {
+			t.Errorf("priority(%q, %q) = %v, want %v", tt.key, tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestQueueSheds503(t *testing.T) {
+	block := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+		fmt.Fprint(w, `{"id":"chatcmpl-1","model":"gpt-4","usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`)
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.queue = queue.New(queue.Options{MaxConcurrent: 1, ShedThreshold: 1, MaxWait: time.Second})
+
+	send := func(priority string) *httptest.ResponseRecorder {
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"` + priority + `"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		req.Header.Set("X-Pario-Priority", priority)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	first := make(chan int)
+	go func() { first <- send("high").Code }()
+	queued := make(chan int)
+	waitFor := func(cond func(queue.Stats) bool) {
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond(srv.queue.Stats()) {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for queue state")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitFor(func(st queue.Stats) bool { return st.Active == 1 })
+	go func() { queued <- send("normal").Code }()
+	waitFor(func(st queue.Stats) bool { return st.Queued["normal"] == 1 })
+
+	w := send("low")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected low priority shed with 503, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After on shed response")
+	}
+
+	close(block)
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("expected 200 for in-flight request, got %d", code)
+	}
+	if code := <-queued; code != http.StatusOK {
+		t.Errorf("expected 200 for queued request, got %d", code)
+	}
+}
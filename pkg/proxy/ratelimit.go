@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/pario-ai/pario/pkg/ratelimit"
+)
+
+// reservationKey is the context key for the request's rate-limit
+// reservation, filled in by checkRateLimit and charged by recordUsage.
+type reservationKey struct{}
+
+// checkRateLimit applies rate_limits to a request for model at its
+// priority. When a limit is exhausted it writes a 429 with Retry-After and
+// returns false.
+func (s *Server) checkRateLimit(w http.ResponseWriter, r *http.Request, clientKey, model string) bool {
+	res, denial := s.rateLimits.Allow(clientKey, model, s.priority(r, clientKey))
+	if denial != nil {
+		secs := max(1, int(math.Ceil(denial.RetryAfter.Seconds())))
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		unit := "requests"
+		if denial.TPM {
+			unit = "tokens"
+		}
+		writeError(w, http.StatusTooManyRequests, errorDetail{
+			Message: fmt.Sprintf("rate limit exceeded: %s per minute", unit), Reason: reasonRateLimitExceeded})
+		return false
+	}
+	if holder, ok := r.Context().Value(reservationKey{}).(*ratelimit.Reservation); ok {
+		*holder = res
+	}
+	return true
+}
@@ -0,0 +1,479 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/router"
+)
+
+const (
+	// realtimeDialTimeout bounds the upstream TCP/TLS connect and WebSocket
+	// handshake unless the provider sets connect_timeout. The relayed
+	// session itself has no deadline.
+	realtimeDialTimeout = 30 * time.Second
+	// maxRealtimeMessage caps how much of a single text message is buffered
+	// for usage inspection. Larger messages are still relayed.
+	maxRealtimeMessage = 4 << 20
+	// insecureKeyProtocol prefixes the subprotocol browsers use to pass an API
+	// key, since they can't set headers on a WebSocket handshake.
+	insecureKeyProtocol = "openai-insecure-api-key."
+)
+
+// handleRealtime proxies the OpenAI Realtime API. The WebSocket handshake is
+// forwarded with the provider's key; after the upgrade, frames are relayed
+// unchanged in both directions while server events are read for usage.
+// Budgets are checked once, when the session starts.
+func (s *Server) handleRealtime(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		writeJSONError(w, http.StatusBadRequest, "expected a WebSocket upgrade")
+		return
+	}
+
+	clientKey := extractAPIKey(r)
+	if clientKey == "" {
+		clientKey = realtimeProtocolKey(r)
+	}
+	if clientKey == "" {
+		writeJSONError(w, http.StatusUnauthorized, "missing API key")
+		return
+	}
+
+	model := r.URL.Query().Get("model")
+	noteModel(r, model)
+
+	s.shadow(r, clientKey, model)
+	if !s.checkBudget(w, r, clientKey, model) {
+		return
+	}
+	// A session can last hours; don't hold up the key's budget queue.
+	releaseBudgetSlot(r)
+
+	routes, err := s.router.Resolve(model)
+	if err != nil {
+		writeRouteError(w, err)
+		return
+	}
+
+	var (
+		upstream net.Conn
+		upBuf    *bufio.Reader
+		resp     *http.Response
+		used     router.Route
+	)
+	for i, route := range routes {
+		if route.Provider.Type == "anthropic" || isBedrock(route) || isVertex(route) || route.Provider.Local() {
+			continue
+		}
+		start := time.Now()
+		conn, br, res, err := dialRealtime(r, route)
+		if err != nil {
+			s.failed(r, route, i+1, 0, err, start)
+			log.Printf("realtime upstream %s failed: %v, trying next", route.Provider.Name, err)
+			continue
+		}
+		s.router.Observe(route.Provider.Name, res.StatusCode, res.Header)
+		if res.StatusCode != http.StatusSwitchingProtocols {
+			body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+			_ = conn.Close()
+			if isRetryable(nil, res.StatusCode) {
+				s.failed(r, route, i+1, res.StatusCode, nil, start)
+				log.Printf("realtime upstream %s returned %d, trying next", route.Provider.Name, res.StatusCode)
+				continue
+			}
+			// Relay the provider's rejection (bad model, auth, rate limit).
+			for k, vals := range res.Header {
+				for _, v := range vals {
+					w.Header().Add(k, v)
+				}
+			}
+			w.WriteHeader(res.StatusCode)
+			_, _ = w.Write(body)
+			return
+		}
+		s.router.Succeeded(route.Provider.Name, route.Model)
+		upstream, upBuf, resp, used = conn, br, res, route
+		break
+	}
+	if upstream == nil {
+		writeJSONError(w, http.StatusBadGateway, "all upstream providers failed")
+		return
+	}
+	defer func() { _ = upstream.Close() }()
+
+	sessionID := s.resolveSessionID(r, clientKey)
+
+	client, clientBuf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "connection does not support WebSocket upgrade")
+		return
+	}
+	defer func() { _ = client.Close() }()
+
+	// Complete the client's handshake with the upstream's accept headers.
+	var hs bytes.Buffer
+	hs.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	_ = resp.Header.Write(&hs)
+	fmt.Fprintf(&hs, "X-Pario-Request-ID: %s\r\n", requestIDFrom(r.Context()))
+	fmt.Fprintf(&hs, "X-Pario-Provider: %s\r\nX-Pario-Model: %s\r\n", used.Provider.Name, used.Model)
+	if sessionID != "" {
+		fmt.Fprintf(&hs, "X-Pario-Session: %s\r\n", sessionID)
+	}
+	hs.WriteString("\r\n")
+	if _, err := client.Write(hs.Bytes()); err != nil {
+		return
+	}
+
+	rt := &realtimeSession{
+		s:         s,
+		r:         r,
+		clientKey: clientKey,
+		model:     used.Model,
+		provider:  used.Provider.Name,
+		sessionID: sessionID,
+	}
+
+	var once sync.Once
+	closeBoth := func() {
+		once.Do(func() {
+			_ = client.Close()
+			_ = upstream.Close()
+		})
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer closeBoth()
+		_, _ = io.Copy(upstream, clientBuf)
+	}()
+	rt.relayServer(upBuf, client)
+	closeBoth()
+	<-done
+}
+
+// realtimeProtocolKey extracts an API key passed as a WebSocket subprotocol.
+func realtimeProtocolKey(r *http.Request) string {
+	for _, p := range websocketProtocols(r) {
+		if key, ok := strings.CutPrefix(p, insecureKeyProtocol); ok {
+			return key
+		}
+	}
+	return ""
+}
+
+func websocketProtocols(r *http.Request) []string {
+	var out []string
+	for _, h := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(h, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+// dialRealtime opens a connection to the route's provider and performs the
+// WebSocket handshake, reusing the client's key and version so the
+// provider's accept header is valid for the client. Compression extensions
+// are not offered so frames can be inspected.
+func dialRealtime(r *http.Request, route router.Route) (net.Conn, *bufio.Reader, *http.Response, error) {
+	target, err := url.Parse(route.Provider.URL)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid provider URL: %w", err)
+	}
+
+	host := target.Host
+	useTLS := target.Scheme == "https" || target.Scheme == "wss"
+	if target.Port() == "" {
+		if useTLS {
+			host = net.JoinHostPort(target.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(target.Hostname(), "80")
+		}
+	}
+
+	dialTimeout := realtimeDialTimeout
+	if route.Provider.ConnectTimeout > 0 {
+		dialTimeout = route.Provider.ConnectTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), dialTimeout)
+	defer cancel()
+
+	proxyURL, err := upstreamProxy(route.Provider, target)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid proxy: %w", err)
+	}
+	conn, err := dialVia(ctx, proxyURL, host)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if useTLS {
+		cfg, err := route.Provider.TLS.Config()
+		if err != nil {
+			_ = conn.Close()
+			return nil, nil, nil, err
+		}
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = target.Hostname()
+		}
+		cfg.NextProtos = []string{"http/1.1"}
+		tc := tls.Client(conn, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, nil, nil, err
+		}
+		conn = tc
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+
+	q := r.URL.Query()
+	q.Set("model", route.Model)
+	u := url.URL{Path: strings.TrimRight(target.Path, "/") + "/v1/realtime", RawQuery: q.Encode()}
+
+	req, err := http.NewRequest(http.MethodGet, u.RequestURI(), nil)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, nil, err
+	}
+	req.Host = target.Host
+	setProviderHeaders(req, route.Provider)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", r.Header.Get("Sec-WebSocket-Key"))
+	req.Header.Set("Sec-WebSocket-Version", r.Header.Get("Sec-WebSocket-Version"))
+	req.Header.Set("Authorization", "Bearer "+route.Provider.APIKey)
+	if beta := r.Header.Get("OpenAI-Beta"); beta != "" {
+		req.Header.Set("OpenAI-Beta", beta)
+	}
+	var protocols []string
+	for _, p := range websocketProtocols(r) {
+		if !strings.HasPrefix(p, insecureKeyProtocol) {
+			protocols = append(protocols, p)
+		}
+	}
+	if len(protocols) > 0 {
+		req.Header.Set("Sec-WebSocket-Protocol", strings.Join(protocols, ", "))
+	}
+
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, nil, nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, br, resp, nil
+}
+
+// realtimeSession tracks usage for one relayed Realtime connection.
+type realtimeSession struct {
+	s         *Server
+	r         *http.Request
+	clientKey string
+	model     string
+	provider  string
+	sessionID string
+
+	started map[string]time.Time // response ID -> response.created time
+
+	msg      []byte // text message being reassembled
+	inText   bool
+	overflow bool
+}
+
+// relayServer copies frames from the upstream to the client until either
+// side fails, inspecting complete text messages for usage.
+func (rt *realtimeSession) relayServer(up *bufio.Reader, client io.Writer) {
+	for {
+		f, err := readFrame(up)
+		if err != nil {
+			return
+		}
+		rt.collect(f)
+		if _, err := (&net.Buffers{f.header, f.payload}).WriteTo(client); err != nil {
+			return
+		}
+	}
+}
+
+// collect accumulates text message fragments and inspects each complete
+// message. It runs before the frame is forwarded, so usage is stored by the
+// time the client sees response.done.
+func (rt *realtimeSession) collect(f wsFrame) {
+	switch f.opcode {
+	case opText:
+		rt.msg, rt.inText, rt.overflow = rt.msg[:0], true, false
+	case opContinuation:
+		if !rt.inText {
+			return
+		}
+	default:
+		return
+	}
+	if len(rt.msg)+len(f.payload) > maxRealtimeMessage {
+		rt.overflow = true
+	}
+	if !rt.overflow {
+		rt.msg = append(rt.msg, f.unmasked()...)
+	}
+	if f.fin {
+		if !rt.overflow {
+			rt.inspect(rt.msg)
+		}
+		rt.inText = false
+	}
+}
+
+// inspect records usage from a complete server event.
+func (rt *realtimeSession) inspect(msg []byte) {
+	// Skip the bulk of traffic (audio deltas) without decoding it.
+	if !bytes.Contains(msg, []byte(`"session.created"`)) && !bytes.Contains(msg, []byte(`"response.`)) {
+		return
+	}
+	var ev models.RealtimeServerEvent
+	if err := json.Unmarshal(msg, &ev); err != nil {
+		return
+	}
+
+	switch ev.Type {
+	case "session.created":
+		if ev.Session != nil && ev.Session.Model != "" {
+			rt.model = ev.Session.Model
+		}
+	case "response.created":
+		if ev.Response != nil {
+			if rt.started == nil {
+				rt.started = make(map[string]time.Time)
+			}
+			rt.started[ev.Response.ID] = time.Now()
+		}
+	case "response.done":
+		if ev.Response == nil || ev.Response.Usage == nil {
+			return
+		}
+		u := ev.Response.Usage
+		rec := models.UsageRecord{
+			// Each response is its own record; the response ID keeps
+			// them distinct under the (request_id, attempt) key.
+			RequestID:         requestIDFrom(rt.r.Context()) + "/" + ev.Response.ID,
+			Attempt:           1,
+			APIKey:            rt.clientKey,
+			Model:             rt.model,
+			SessionID:         rt.sessionID,
+			Provider:          rt.provider,
+			PromptTokens:      u.InputTokens,
+			CompletionTokens:  u.OutputTokens,
+			TotalTokens:       u.TotalTokens,
+			InputAudioTokens:  u.InputTokenDetails.AudioTokens,
+			OutputAudioTokens: u.OutputTokenDetails.AudioTokens,
+			CacheReadTokens:   u.InputTokenDetails.CachedTokens,
+			Streamed:          true,
+		}
+		if start, ok := rt.started[ev.Response.ID]; ok {
+			rec.LatencyMs = time.Since(start).Milliseconds()
+			delete(rt.started, ev.Response.ID)
+		}
+		rt.s.recordUsage(rt.r, rec)
+	}
+}
+
+// WebSocket opcodes (RFC 6455 section 5.2).
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+)
+
+// maxFrameSize rejects frames that could exhaust memory; Realtime frames
+// are far smaller.
+const maxFrameSize = 64 << 20
+
+// wsFrame is one WebSocket frame as read off the wire.
+type wsFrame struct {
+	fin     bool
+	opcode  byte
+	mask    []byte
+	header  []byte // raw header bytes, including any mask key
+	payload []byte // payload as sent (still masked if mask is set)
+}
+
+// unmasked returns the payload with any client mask removed.
+func (f wsFrame) unmasked() []byte {
+	if f.mask == nil {
+		return f.payload
+	}
+	out := make([]byte, len(f.payload))
+	for i, b := range f.payload {
+		out[i] = b ^ f.mask[i%4]
+	}
+	return out
+}
+
+// readFrame reads one WebSocket frame from r.
+func readFrame(r *bufio.Reader) (wsFrame, error) {
+	var f wsFrame
+	head := make([]byte, 2, 14)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return f, err
+	}
+	f.fin = head[0]&0x80 != 0
+	f.opcode = head[0] & 0x0f
+	masked := head[1]&0x80 != 0
+
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return f, err
+		}
+		head = append(head, ext...)
+		n = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return f, err
+		}
+		head = append(head, ext...)
+		n = binary.BigEndian.Uint64(ext)
+	}
+	if n > maxFrameSize {
+		return f, fmt.Errorf("websocket frame of %d bytes exceeds limit", n)
+	}
+	if masked {
+		f.mask = make([]byte, 4)
+		if _, err := io.ReadFull(r, f.mask); err != nil {
+			return f, err
+		}
+		head = append(head, f.mask...)
+	}
+	f.header = head
+	f.payload = make([]byte, n)
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return f, err
+	}
+	return f, nil
+}
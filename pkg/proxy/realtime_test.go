@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestFrame writes a single WebSocket frame, masking it when mask is set.
+func writeTestFrame(w io.Writer, fin bool, opcode byte, payload []byte, mask bool) error {
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	head := []byte{b0, 0}
+	switch n := len(payload); {
+	case n < 126:
+		head[1] = byte(n)
+	case n <= 0xffff:
+		head[1] = 126
+		head = binary.BigEndian.AppendUint16(head, uint16(n))
+	default:
+		head[1] = 127
+		head = binary.BigEndian.AppendUint64(head, uint64(n))
+	}
+	data := payload
+	if mask {
+		key := []byte{1, 2, 3, 4}
+		head[1] |= 0x80
+		head = append(head, key...)
+		data = make([]byte, len(payload))
+		for i, c := range payload {
+			data[i] = c ^ key[i%4]
+		}
+	}
+	_, err := w.Write(append(head, data...))
+	return err
+}
+
+func wsAccept(key string) string {
+	h := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// newRealtimeUpstream accepts one WebSocket session, sends a scripted set of
+// server events, and reports the first client message on got.
+func newRealtimeUpstream(t *testing.T, got chan<- string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-provider" {
+			t.Error("expected provider API key in upstream handshake")
+		}
+		if r.URL.Query().Get("model") != "gpt-4o-realtime" {
+			t.Errorf("expected model query, got %q", r.URL.RawQuery)
+		}
+		if p := r.Header.Get("Sec-WebSocket-Protocol"); strings.Contains(p, insecureKeyProtocol) {
+			t.Errorf("client key leaked upstream in protocol %q", p)
+		}
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+			wsAccept(r.Header.Get("Sec-WebSocket-Key")))
+
+		_ = writeTestFrame(conn, true, opText, []byte(`{"type":"session.created","session":{"id":"sess_1","model":"gpt-4o-realtime"}}`), false)
+		_ = writeTestFrame(conn, true, opText, []byte(`{"type":"response.created","response":{"id":"resp_1"}}`), false)
+		done := `{"type":"response.done","response":{"id":"resp_1","status":"completed","usage":{"total_tokens":300,"input_tokens":120,"output_tokens":180,"input_token_details":{"text_tokens":20,"audio_tokens":100},"output_token_details":{"text_tokens":30,"audio_tokens":150}}}}`
+		// Split across a continuation frame to exercise reassembly.
+		_ = writeTestFrame(conn, false, opText, []byte(done[:40]), false)
+		_ = writeTestFrame(conn, true, opContinuation, []byte(done[40:]), false)
+
+		f, err := readFrame(buf.Reader)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		got <- string(f.unmasked())
+	}))
+}
+
+func dialTestRealtime(t *testing.T, addr string, header string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "GET /v1/realtime?model=gpt-4o-realtime HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n%s\r\n", addr, header)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, br, resp
+}
+
+func TestRealtimeRelayAndUsage(t *testing.T) {
+	got := make(chan string, 1)
+	upstream := newRealtimeUpstream(t, got)
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	front := httptest.NewServer(srv)
+	defer front.Close()
+
+	conn, br, resp := dialTestRealtime(t, front.Listener.Addr().String(),
+		"Sec-WebSocket-Protocol: realtime, openai-insecure-api-key.client-key\r\n")
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAccept("dGhlIHNhbXBsZSBub25jZQ==") {
+		t.Error("expected upstream accept header relayed")
+	}
+	if resp.Header.Get("X-Pario-Session") == "" {
+		t.Error("expected X-Pario-Session header")
+	}
+
+	// session.created, response.created, and the two fragments of response.done.
+	for i := 0; i < 4; i++ {
+		if _, err := readFrame(br); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+	}
+	if err := writeTestFrame(conn, true, opText, []byte(`{"type":"response.create"}`), true); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-got:
+		if msg != `{"type":"response.create"}` {
+			t.Errorf("unexpected client message upstream: %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("client frame was not relayed")
+	}
+
+	// Usage is recorded as the upstream frame is relayed, before the client
+	// reads it, so it's already stored.
+	recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(recs))
+	}
+	r := recs[0]
+	if r.Model != "gpt-4o-realtime" || r.Provider != "test" || !r.Streamed {
+		t.Errorf("unexpected record: %+v", r)
+	}
+	if r.PromptTokens != 120 || r.CompletionTokens != 180 || r.TotalTokens != 300 {
+		t.Errorf("unexpected token counts: %+v", r)
+	}
+	if r.InputAudioTokens != 100 || r.OutputAudioTokens != 150 {
+		t.Errorf("expected audio tokens 100/150, got %d/%d", r.InputAudioTokens, r.OutputAudioTokens)
+	}
+	if !strings.HasSuffix(r.RequestID, "/resp_1") {
+		t.Errorf("expected request ID scoped to response, got %q", r.RequestID)
+	}
+}
+
+func TestRealtimeRejections(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("upstream should not be contacted")
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"not an upgrade", map[string]string{"Authorization": "Bearer client-key"}, http.StatusBadRequest},
+		{"missing key", map[string]string{"Upgrade": "websocket"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/realtime?model=gpt-4o-realtime", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/router"
+)
+
+// Retry backoff defaults for routes that set max_retries without delays.
+const (
+	defaultRetryBackoff    = 250 * time.Millisecond
+	defaultRetryMaxBackoff = 5 * time.Second
+)
+
+// retryableStatus reports whether a response status is worth retrying on
+// the same target: rate limits and server errors.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryDelay returns the jittered delay before retry n (1-based) of route.
+// A Retry-After header asking for no more than the maximum backoff is
+// honoured instead.
+func retryDelay(route router.Route, n int, header http.Header) time.Duration {
+	base, ceiling := route.Retry.Backoff, route.Retry.MaxBackoff
+	if base == 0 {
+		base = defaultRetryBackoff
+	}
+	if ceiling == 0 {
+		ceiling = defaultRetryMaxBackoff
+	}
+	if secs, err := strconv.Atoi(header.Get("Retry-After")); err == nil && secs >= 0 {
+		if d := time.Duration(secs) * time.Second; d <= ceiling {
+			return d
+		}
+	}
+	d := base << (n - 1)
+	if d > ceiling || d <= 0 {
+		d = ceiling
+	}
+	// Spread retries over [d/2, d) so clients that failed together don't
+	// retry together.
+	return d/2 + rand.N(d/2+1)
+}
+
+// sleepCtx waits for d, returning false if ctx ends first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// withRetries sends a buffered request to route with do, retrying it per
+// the route's retry policy while it fails with a transport error, a 429,
+// or a 5xx. It returns the last result.
+func withRetries(ctx context.Context, route router.Route, do func() (*upstreamResult, error)) (*upstreamResult, error) {
+	for n := 1; ; n++ {
+		res, err := do()
+		if n > route.Retry.MaxRetries || (err == nil && !retryableStatus(res.statusCode)) {
+			return res, err
+		}
+		var header http.Header
+		status := 0
+		if res != nil {
+			header, status = res.header, res.statusCode
+		}
+		logRetry(route, n, err, status)
+		if !sleepCtx(ctx, retryDelay(route, n, header)) {
+			return res, err
+		}
+	}
+}
+
+// withStreamRetries is withRetries for streaming requests. Responses that
+// are retried are closed.
+func withStreamRetries(ctx context.Context, route router.Route, do func() (*http.Response, error)) (*http.Response, error) {
+	for n := 1; ; n++ {
+		resp, err := do()
+		if n > route.Retry.MaxRetries || (err == nil && !retryableStatus(resp.StatusCode)) {
+			return resp, err
+		}
+		var header http.Header
+		status := 0
+		if resp != nil {
+			header, status = resp.Header, resp.StatusCode
+			resp.Body.Close()
+		}
+		logRetry(route, n, err, status)
+		if !sleepCtx(ctx, retryDelay(route, n, header)) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func logRetry(route router.Route, n int, err error, status int) {
+	if err != nil {
+		log.Printf("upstream %s failed: %v, retry %d/%d", route.Provider.Name, err, n, route.Retry.MaxRetries)
+		return
+	}
+	log.Printf("upstream %s returned %d, retry %d/%d", route.Provider.Name, status, n, route.Retry.MaxRetries)
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/router"
+	"github.com/pario-ai/pario/pkg/tracker"
+)
+
+func TestRetrySameTargetBeforeFallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int32
+		status       int
+		maxRetries   int
+		wantPrimary  int32
+		wantFallback int32
+	}{
+		{"transient 503 retried", 1, http.StatusServiceUnavailable, 2, 2, 0},
+		{"429 retried", 2, http.StatusTooManyRequests, 2, 3, 0},
+		{"retries exhausted fall through", 5, http.StatusServiceUnavailable, 2, 3, 1},
+		{"no retries configured", 1, http.StatusServiceUnavailable, 0, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var primaryCalls, fallbackCalls atomic.Int32
+			primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if primaryCalls.Add(1) <= tt.failures {
+					w.WriteHeader(tt.status)
+					return
+				}
+				writeChatResponse(w)
+			}))
+			defer primary.Close()
+			fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fallbackCalls.Add(1)
+				writeChatResponse(w)
+			}))
+			defer fallback.Close()
+
+			dir := t.TempDir()
+			tr, _ := tracker.New(filepath.Join(dir, "tracker.db"))
+			defer func() { _ = tr.Close() }()
+			cfg := &config.Config{
+				Providers: []config.ProviderConfig{
+					{Name: "primary", URL: primary.URL, APIKey: "sk-1"},
+					{Name: "fallback", URL: fallback.URL, APIKey: "sk-2"},
+				},
+				Router: config.RouterConfig{Routes: []config.RouteConfig{{
+					Model: "gpt-4",
+					Targets: []config.RouteTarget{
+						{Provider: "primary", Model: "gpt-4"},
+						{Provider: "fallback", Model: "gpt-4o-mini"},
+					},
+					Retry: config.RetryConfig{MaxRetries: tt.maxRetries, Backoff: time.Millisecond},
+				}}},
+			}
+			srv := New(cfg, tr, nil, nil, nil)
+
+			for _, stream := range []bool{false, true} {
+				primaryCalls.Store(0)
+				fallbackCalls.Store(0)
+				body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+				if stream {
+					body = `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+				}
+				req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+				req.Header.Set("Authorization", "Bearer client-key")
+				w := httptest.NewRecorder()
+				srv.ServeHTTP(w, req)
+
+				if got := primaryCalls.Load(); got != tt.wantPrimary {
+					t.Errorf("stream=%v: primary called %d times, want %d", stream, got, tt.wantPrimary)
+				}
+				if got := fallbackCalls.Load(); got != tt.wantFallback {
+					t.Errorf("stream=%v: fallback called %d times, want %d", stream, got, tt.wantFallback)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	route := router.Route{Retry: config.RetryConfig{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}}
+	for n, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: time.Second} {
+		d := retryDelay(route, n, nil)
+		if d < want/2 || d > want {
+			t.Errorf("retry %d: delay %v not in [%v, %v]", n, d, want/2, want)
+		}
+	}
+	if d := retryDelay(route, 1, http.Header{"Retry-After": {"1"}}); d != time.Second {
+		t.Errorf("Retry-After within max_backoff: delay %v, want 1s", d)
+	}
+	if d := retryDelay(route, 1, http.Header{"Retry-After": {"30"}}); d > 100*time.Millisecond {
+		t.Errorf("Retry-After beyond max_backoff should be ignored, got %v", d)
+	}
+}
+
+func writeChatResponse(w http.ResponseWriter) {
+	json.NewEncoder(w).Encode(models.ChatCompletionResponse{
+		ID:    "chatcmpl-1",
+		Model: "gpt-4",
+		Usage: &models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	})
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/tracker"
+)
+
+// handleSessions lists sessions, filtered by the api_key, name, and
+// repeated tag=k=v query parameters.
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	params := r.URL.Query()
+	q := models.SessionQuery{APIKey: params.Get("api_key"), Name: params.Get("name")}
+	for _, tag := range params["tag"] {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok || k == "" {
+			writeJSONError(w, http.StatusBadRequest, "tag must be key=value")
+			return
+		}
+		if q.Tags == nil {
+			q.Tags = make(map[string]string)
+		}
+		q.Tags[k] = v
+	}
+	sessions, err := s.tracker.ListSessions(r.Context(), q)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "list sessions failed")
+		return
+	}
+	writeJSON(w, append([]models.Session{}, sessions...))
+}
+
+// sessionUpdate is the body of a session update. An empty name keeps the
+// current one; tags are merged into the session's tags.
+type sessionUpdate struct {
+	Name string            `json:"name"`
+	Tags map[string]string `json:"tags"`
+}
+
+// handleSession names and tags one session (PATCH), addressed as
+// sessions/{id}.
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		writeJSONError(w, http.StatusMethodNotAllowed, "use PATCH")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, adminPrefix+"sessions/")
+	var u sessionUpdate
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid session update: "+err.Error())
+		return
+	}
+	err := s.tracker.UpdateSession(r.Context(), id, strings.TrimSpace(u.Name), u.Tags)
+	if errors.Is(err, tracker.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, "unknown session")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "update session failed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
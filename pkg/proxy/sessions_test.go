@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestSessionNameAndTags(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Admin.Token = "secret"
+
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	req.Header.Set("X-Pario-Session", "run-42")
+	req.Header.Set("X-Pario-Session-Name", "nightly eval")
+	req.Header.Set("X-Pario-Session-Tags", "agent=planner, suite=smoke")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("chat: status %d", w.Code)
+	}
+
+	admin := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+	list := func(query string) []models.Session {
+		t.Helper()
+		w := admin(http.MethodGet, "/pario/admin/sessions"+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET sessions%s: status %d", query, w.Code)
+		}
+		var sessions []models.Session
+		if err := json.Unmarshal(w.Body.Bytes(), &sessions); err != nil {
+			t.Fatal(err)
+		}
+		return sessions
+	}
+
+	got := list("?name=eval&tag=agent=planner")
+	if len(got) != 1 || got[0].ID != "run-42" || got[0].Name != "nightly eval" || got[0].Tags["suite"] != "smoke" {
+		t.Fatalf("sessions = %+v", got)
+	}
+
+	if w := admin(http.MethodPatch, "/pario/admin/sessions/run-42", `{"name":"nightly eval (retry)","tags":{"suite":"full"}}`); w.Code != http.StatusNoContent {
+		t.Fatalf("PATCH session: status %d: %s", w.Code, w.Body)
+	}
+	got = list("?tag=suite=full")
+	if len(got) != 1 || got[0].Name != "nightly eval (retry)" || got[0].Tags["agent"] != "planner" {
+		t.Errorf("sessions after PATCH = %+v", got)
+	}
+	if got := list("?tag=suite=smoke"); len(got) != 0 {
+		t.Errorf("sessions tagged suite=smoke = %+v", got)
+	}
+
+	if w := admin(http.MethodPatch, "/pario/admin/sessions/nope", `{"name":"x"}`); w.Code != http.StatusNotFound {
+		t.Errorf("PATCH missing session: status %d, want 404", w.Code)
+	}
+	if w := admin(http.MethodGet, "/pario/admin/sessions?tag=bad", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("bad tag filter: status %d, want 400", w.Code)
+	}
+}
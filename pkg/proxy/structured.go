@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/jsonschema"
+	"github.com/pario-ai/pario/pkg/models"
+	"github.com/pario-ai/pario/pkg/router"
+)
+
+// schemaRetryReason marks usage records for retries of invalid structured
+// output.
+const schemaRetryReason = "schema"
+
+// responseSchema returns the JSON schema a chat completion request asks
+// for in response_format. A json_object format yields a schema that only
+// requires an object. It returns nil when no structured output is requested.
+func responseSchema(body []byte) map[string]any {
+	var req struct {
+		ResponseFormat *struct {
+			Type       string `json:"type"`
+			JSONSchema struct {
+				Schema map[string]any `json:"schema"`
+			} `json:"json_schema"`
+		} `json:"response_format"`
+	}
+	if json.Unmarshal(body, &req) != nil || req.ResponseFormat == nil {
+		return nil
+	}
+	switch req.ResponseFormat.Type {
+	case "json_schema":
+		if req.ResponseFormat.JSONSchema.Schema != nil {
+			return req.ResponseFormat.JSONSchema.Schema
+		}
+		return map[string]any{}
+	case "json_object":
+		return map[string]any{"type": "object"}
+	}
+	return nil
+}
+
+// validateCompletion checks the first choice of a chat completion against
+// schema.
+func validateCompletion(schema map[string]any, respBody []byte) error {
+	var resp models.ChatCompletionResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return err
+	}
+	if len(resp.Choices) == 0 {
+		return &jsonschema.ValidationError{Path: "$", Message: "response has no choices"}
+	}
+	return jsonschema.ValidateJSON(schema, []byte(resp.Choices[0].Message.Content))
+}
+
+// schemaRetry is the outcome of retrying an invalid structured output.
+type schemaRetry struct {
+	result  *upstreamResult
+	route   router.Route
+	attempt int
+	latency time.Duration
+}
+
+// retryInvalidSchema validates a successful chat completion on a
+// structured_output route. When the output doesn't match the requested
+// schema, it records the discarded attempt's usage and retries once, on the
+// same target or the next one per schema_retry. It returns nil when no
+// retry was made or the retry failed, in which case the original response
+// stands. X-Pario-Schema reports the verdict to the client.
+func (s *Server) retryInvalidSchema(w http.ResponseWriter, r *http.Request, clientKey, sessionID string, body []byte,
+	routes []router.Route, used router.Route, attempt int, first *upstreamResult, latency time.Duration) *schemaRetry {
+	if !used.Structured || first.statusCode != http.StatusOK {
+		return nil
+	}
+	schema := responseSchema(body)
+	if schema == nil {
+		return nil
+	}
+	err := validateCompletion(schema, first.body)
+	if err == nil {
+		w.Header().Set("X-Pario-Schema", "valid")
+		return nil
+	}
+	log.Printf("structured output from %s failed validation (%v), retrying", used.Provider.Name, err)
+
+	// The invalid completion was still paid for.
+	var resp models.ChatCompletionResponse
+	if json.Unmarshal(first.body, &resp) == nil && resp.Usage != nil {
+		s.recordUsage(r, models.UsageRecord{
+			APIKey:              clientKey,
+			Model:               resp.Model,
+			SessionID:           sessionID,
+			Provider:            used.Provider.Name,
+			Attempt:             attempt,
+			PromptTokens:        resp.Usage.PromptTokens,
+			CompletionTokens:    resp.Usage.CompletionTokens,
+			TotalTokens:         resp.Usage.TotalTokens,
+			CacheReadTokens:     resp.Usage.CacheReadTokens(),
+			CacheCreationTokens: resp.Usage.CacheCreationTokens(),
+			ReasoningTokens:     resp.Usage.ReasoningTokens(),
+			LatencyMs:           latency.Milliseconds(),
+		})
+	}
+
+	target := used
+	// attempt is the 1-based index of used in routes.
+	if used.SchemaRetry == "fallback" && attempt < len(routes) {
+		target = routes[attempt]
+	}
+
+	start := time.Now()
+	res, err := doChatRequest(r.Context(), target, routeBody(body, target, false))
+	if err != nil || res.statusCode != http.StatusOK {
+		log.Printf("structured output retry on %s failed", target.Provider.Name)
+		w.Header().Set("X-Pario-Schema", "invalid")
+		return nil
+	}
+	s.router.Observe(target.Provider.Name, res.statusCode, res.header)
+
+	verdict := "retried"
+	if validateCompletion(schema, res.body) != nil {
+		verdict = "invalid"
+	}
+	w.Header().Set("X-Pario-Schema", verdict)
+	return &schemaRetry{result: res, route: target, attempt: attempt + 1, latency: time.Since(start)}
+}
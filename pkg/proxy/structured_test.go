@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestResponseSchema(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{`{"model":"m"}`, false},
+		{`{"response_format":{"type":"text"}}`, false},
+		{`{"response_format":{"type":"json_object"}}`, true},
+		{`{"response_format":{"type":"json_schema","json_schema":{"name":"x","schema":{"type":"object"}}}}`, true},
+	}
+	for _, tt := range tests {
+		if got := responseSchema([]byte(tt.body)) != nil; got != tt.want {
+			t.Errorf("responseSchema(%s) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestStructuredOutputRetry(t *testing.T) {
+	outputs := []string{`{"answer": 42}`, `{"answer": "forty-two"}`}
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out := outputs[calls%len(outputs)]
+		calls++
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{
+			Model:   "gpt-4o",
+			Choices: []models.Choice{{Message: models.ChatMessage{Role: "assistant", Content: out}}},
+			Usage:   &models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		})
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Router.Routes = []config.RouteConfig{{
+		Model:            "extract",
+		StructuredOutput: true,
+		Targets:          []config.RouteTarget{{Provider: "test", Model: "gpt-4o"}},
+	}}
+
+	body := `{"model":"extract","messages":[{"role":"user","content":"hi"}],"response_format":{"type":"json_schema","json_schema":{"name":"a","schema":{"type":"object","properties":{"answer":{"type":"string"}},"required":["answer"]}}}}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if calls != 2 {
+		t.Errorf("expected one retry, got %d upstream calls", calls)
+	}
+	if got := w.Header().Get("X-Pario-Schema"); got != "retried" {
+		t.Errorf("expected X-Pario-Schema retried, got %q", got)
+	}
+	if !strings.Contains(w.Body.String(), "forty-two") {
+		t.Error("expected the valid retry response")
+	}
+
+	recs, err := srv.tracker.QueryByKey(context.Background(), "client-key", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("expected invalid attempt and retry recorded, got %d", len(recs))
+	}
+	var retries int
+	for _, rec := range recs {
+		if rec.RetryReason == schemaRetryReason {
+			retries++
+			if rec.Attempt != 2 {
+				t.Errorf("expected retry as attempt 2, got %d", rec.Attempt)
+			}
+		}
+	}
+	if retries != 1 {
+		t.Errorf("expected 1 record marked as schema retry, got %d", retries)
+	}
+}
+
+func TestStructuredOutputValidNoRetry(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{
+			Model:   "gpt-4o",
+			Choices: []models.Choice{{Message: models.ChatMessage{Content: `{"ok":true}`}}},
+			Usage:   &models.Usage{TotalTokens: 3},
+		})
+	}))
+	defer upstream.Close()
+
+	srv := setupProxy(t, upstream)
+	srv.cfg.Router.Routes = []config.RouteConfig{{
+		Model: "extract", StructuredOutput: true,
+		Targets: []config.RouteTarget{{Provider: "test"}},
+	}}
+
+	body := `{"model":"extract","messages":[],"response_format":{"type":"json_object"}}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if calls != 1 || w.Header().Get("X-Pario-Schema") != "valid" {
+		t.Errorf("expected a single validated call, got %d calls and %q", calls, w.Header().Get("X-Pario-Schema"))
+	}
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/providers/vertex"
+	"github.com/pario-ai/pario/pkg/router"
+)
+
+// openAIHeaders returns the headers for an OpenAI API call to route's
+// provider. Providers without an API key, such as local engines, get no
+// Authorization header.
+func openAIHeaders(ctx context.Context, route router.Route) (map[string]string, error) {
+	if isVertex(route) {
+		return vertexHeaders(ctx, route)
+	}
+	if route.Provider.APIKey == "" {
+		return map[string]string{}, nil
+	}
+	return map[string]string{"Authorization": "Bearer " + route.Provider.APIKey}, nil
+}
+
+// setProviderHeaders adds provider's static headers to req. Callers set
+// credentials afterwards so they can't be overridden.
+func setProviderHeaders(req *http.Request, provider config.ProviderConfig) {
+	for k, v := range provider.Headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// apiPath returns the path of an OpenAI API endpoint, such as
+// "/chat/completions", on route's provider. openai-compatible providers
+// may serve the API under a custom base_path.
+func apiPath(route router.Route, endpoint string) string {
+	if route.Provider.Local() && route.Provider.BasePath != "" {
+		return "/" + strings.Trim(route.Provider.BasePath, "/") + endpoint
+	}
+	return "/v1" + endpoint
+}
+
+// chatURL returns the URL and path for chat completions on route's
+// provider; Vertex uses its OpenAI-compatible endpoint.
+func chatURL(route router.Route) (string, string) {
+	if isVertex(route) {
+		p := route.Provider
+		return vertex.ChatURL(vertexBase(route), p.Project, p.Region), ""
+	}
+	return route.Provider.URL, apiPath(route, "/chat/completions")
+}
+
+// doChatRequest sends an OpenAI chat completions request to route's provider.
+func doChatRequest(ctx context.Context, route router.Route, body []byte) (*upstreamResult, error) {
+	headers, err := openAIHeaders(ctx, route)
+	if err != nil {
+		return nil, err
+	}
+	base, path := chatURL(route)
+	return doUpstreamRequest(ctx, route.Provider, base, path, "application/json", headers, body)
+}
+
+// doChatStreamRequest is doChatRequest for streaming requests.
+func doChatStreamRequest(ctx context.Context, route router.Route, body []byte) (*http.Response, error) {
+	headers, err := openAIHeaders(ctx, route)
+	if err != nil {
+		return nil, err
+	}
+	base, path := chatURL(route)
+	return doUpstreamStreamRequest(ctx, route.Provider, base, path, "application/json", headers, body)
+}
+
+// servesOpenAI reports whether route's provider serves OpenAI API endpoints
+// beyond chat completions, such as embeddings.
+func servesOpenAI(route router.Route) bool {
+	switch route.Provider.Type {
+	case "anthropic", "bedrock", "vertex":
+		return false
+	}
+	return true
+}
+
+// openAIRoutes keeps the routes whose providers serve OpenAI API endpoints.
+func openAIRoutes(routes []router.Route) []router.Route {
+	kept := routes[:0:0]
+	for _, r := range routes {
+		if servesOpenAI(r) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// doOpenAIRequest sends a request to an OpenAI API endpoint, such as
+// "/embeddings", on route's provider.
+func doOpenAIRequest(ctx context.Context, route router.Route, endpoint, contentType string, body []byte) (*upstreamResult, error) {
+	headers, err := openAIHeaders(ctx, route)
+	if err != nil {
+		return nil, err
+	}
+	return doUpstreamRequest(ctx, route.Provider, route.Provider.URL, apiPath(route, endpoint), contentType, headers, body)
+}
+
+// forwardOpenAI sends a request to an OpenAI API endpoint, trying each route
+// in order, with the route's retries, until one doesn't fail with a
+// retryable error. payload builds the
+// body for a route's model. It returns the last result, the route and
+// 1-based attempt that produced it, and the attempt's latency; the result
+// is nil when every route failed to connect.
+func (s *Server) forwardOpenAI(r *http.Request, routes []router.Route, endpoint, contentType string, payload func(model string) []byte) (*upstreamResult, router.Route, int, time.Duration) {
+	var result *upstreamResult
+	for i, route := range routes {
+		var attemptStart time.Time
+		body := payload(route.Model)
+		res, err := withRetries(r.Context(), route, func() (*upstreamResult, error) {
+			attemptStart = time.Now()
+			return doOpenAIRequest(r.Context(), route, endpoint, contentType, body)
+		})
+		if isRetryable(err, 0) {
+			s.failed(r, route, i+1, 0, err, attemptStart)
+			log.Printf("upstream %s failed: %v, trying next", route.Provider.Name, err)
+			continue
+		}
+		s.router.Observe(route.Provider.Name, res.statusCode, res.header)
+		if isRetryable(nil, res.statusCode) {
+			s.failed(r, route, i+1, res.statusCode, nil, attemptStart)
+			log.Printf("upstream %s returned %d, trying next", route.Provider.Name, res.statusCode)
+			result = res
+			continue
+		}
+		if res.statusCode < 300 {
+			s.router.Succeeded(route.Provider.Name, route.Model)
+		}
+		return res, route, i + 1, time.Since(attemptStart)
+	}
+	return result, router.Route{}, 0, 0
+}
+
+// jsonPayload returns a forwardOpenAI payload that sets the model in a JSON
+// request body.
+func jsonPayload(body []byte) func(model string) []byte {
+	return func(model string) []byte { return rewriteModel(body, model) }
+}
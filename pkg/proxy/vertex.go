@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"context"
+
+	"github.com/pario-ai/pario/pkg/providers/vertex"
+	"github.com/pario-ai/pario/pkg/router"
+)
+
+// vertexTokens supplies access tokens for vertex providers without a static
+// api_key. Credentials are located on first use.
+var vertexTokens = vertex.DefaultTokenSource()
+
+// isVertex reports whether route's provider is Google Cloud Vertex AI.
+func isVertex(route router.Route) bool {
+	return route.Provider.Type == "vertex"
+}
+
+// vertexBase returns the Vertex AI base URL for route, preferring an
+// explicitly configured URL.
+func vertexBase(route router.Route) string {
+	if route.Provider.URL != "" {
+		return route.Provider.URL
+	}
+	return vertex.Endpoint(route.Provider.Region)
+}
+
+// vertexHeaders returns the bearer authorization for a Vertex call. A
+// configured api_key is used as a static access token; otherwise one is
+// obtained from Application Default Credentials.
+func vertexHeaders(ctx context.Context, route router.Route) (map[string]string, error) {
+	token := route.Provider.APIKey
+	if token == "" {
+		var err error
+		if token, err = vertexTokens.Token(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]string{"Authorization": "Bearer " + token}, nil
+}
+
+// vertexMessages prepares a Claude Messages request for Vertex, returning
+// the rawPredict URL, headers, and translated body.
+func vertexMessages(ctx context.Context, route router.Route, headers map[string]string, body []byte, stream bool) (string, map[string]string, []byte, error) {
+	payload, err := vertex.TranslateMessages(body)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	auth, err := vertexHeaders(ctx, route)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if beta, ok := headers["anthropic-beta"]; ok {
+		auth["anthropic-beta"] = beta
+	}
+	p := route.Provider
+	return vertex.MessagesURL(vertexBase(route), p.Project, p.Region, route.Model, stream), auth, payload, nil
+}
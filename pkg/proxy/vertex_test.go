@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVertexRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		header   string
+		body     string
+		path     string
+		response string
+	}{
+		{
+			name:     "claude messages",
+			endpoint: "/v1/messages",
+			header:   "x-api-key",
+			body:     `{"model":"claude-3-5-haiku@20241022","messages":[{"role":"user","content":"hi"}],"max_tokens":64}`,
+			path:     "/v1/projects/proj/locations/us-east5/publishers/anthropic/models/claude-3-5-haiku@20241022:rawPredict",
+			response: `{"id":"msg_1","type":"message","role":"assistant","model":"claude-3-5-haiku-20241022","content":[{"type":"text","text":"hi"}],"usage":{"input_tokens":12,"output_tokens":8}}`,
+		},
+		{
+			name:     "gemini chat",
+			endpoint: "/v1/chat/completions",
+			header:   "Authorization",
+			body:     `{"model":"google/gemini-2.0-flash","messages":[{"role":"user","content":"hi"}]}`,
+			path:     "/v1/projects/proj/locations/us-east5/endpoints/openapi/chat/completions",
+			response: `{"id":"c1","object":"chat.completion","model":"google/gemini-2.0-flash","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":8,"total_tokens":20}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.path {
+					t.Errorf("path = %q, want %q", r.URL.Path, tt.path)
+				}
+				if got := r.Header.Get("Authorization"); got != "Bearer sk-provider" {
+					t.Errorf("Authorization = %q", got)
+				}
+				if r.Header.Get("x-api-key") != "" {
+					t.Error("x-api-key forwarded to Vertex")
+				}
+				if tt.endpoint == "/v1/messages" {
+					var body map[string]any
+					b, _ := io.ReadAll(r.Body)
+					if err := json.Unmarshal(b, &body); err != nil {
+						t.Fatal(err)
+					}
+					if _, ok := body["model"]; ok || body["anthropic_version"] != "vertex-2023-10-16" {
+						t.Errorf("untranslated body: %s", b)
+					}
+				}
+				w.Write([]byte(tt.response))
+			}))
+			defer upstream.Close()
+
+			srv := setupProxy(t, upstream)
+			srv.cfg.Providers[0].Type = "vertex"
+			srv.cfg.Providers[0].Region = "us-east5"
+			srv.cfg.Providers[0].Project = "proj"
+
+			req := httptest.NewRequest(http.MethodPost, tt.endpoint, strings.NewReader(tt.body))
+			if tt.header == "x-api-key" {
+				req.Header.Set("x-api-key", "client-key")
+			} else {
+				req.Header.Set("Authorization", "Bearer client-key")
+			}
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
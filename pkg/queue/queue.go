@@ -0,0 +1,245 @@
+// Package queue provides priority-aware admission control for upstream
+// requests. When the number of in-flight requests reaches a limit, callers
+// wait in per-priority FIFO queues; when the queue itself is full, the
+// lowest-priority waiters are shed first.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority orders requests competing for upstream capacity.
+type Priority int
+
+// Priorities, lowest first.
+const (
+	Low Priority = iota
+	Normal
+	High
+
+	numPriorities = 3
+)
+
+// String returns the priority's config and header name.
+func (p Priority) String() string {
+	switch p {
+	case Low:
+		return "low"
+	case High:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// ParsePriority parses "low", "normal", or "high" (case-insensitive).
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "low", "batch":
+		return Low, nil
+	case "normal", "":
+		return Normal, nil
+	case "high", "interactive":
+		return High, nil
+	}
+	return Normal, fmt.Errorf("unknown priority %q", s)
+}
+
+var (
+	// ErrShed is returned when a request is rejected or evicted because the
+	// queue is full or past its load-shedding threshold.
+	ErrShed = errors.New("request shed under load")
+	// ErrTimeout is returned when a request waits longer than MaxWait.
+	ErrTimeout = errors.New("timed out waiting for capacity")
+)
+
+// Options configures a Queue. A zero MaxConcurrent disables admission
+// control entirely.
+type Options struct {
+	// MaxConcurrent is the number of requests allowed in flight at once.
+	MaxConcurrent int
+	// MaxQueue is the number of requests allowed to wait. Zero means
+	// unbounded.
+	MaxQueue int
+	// ShedThreshold is the queue depth at which low-priority requests are
+	// rejected instead of queued. Zero disables early shedding.
+	ShedThreshold int
+	// MaxWait bounds how long a request may wait. Zero means no limit
+	// beyond the caller's context.
+	MaxWait time.Duration
+}
+
+// Stats is a point-in-time view of the queue.
+type Stats struct {
+	Active int            `json:"active"`
+	Queued map[string]int `json:"queued"`
+	Shed   int64          `json:"shed"`
+}
+
+type waiter struct {
+	priority Priority
+	ready    chan error // buffered; receives nil when admitted
+}
+
+// Queue admits requests up to a concurrency limit. A nil *Queue admits
+// everything.
+type Queue struct {
+	opts Options
+
+	mu      sync.Mutex
+	active  int
+	waiting [numPriorities][]*waiter
+	queued  int
+	shed    int64
+}
+
+// New creates a Queue. It returns nil when opts.MaxConcurrent is zero.
+func New(opts Options) *Queue {
+	if opts.MaxConcurrent <= 0 {
+		return nil
+	}
+	return &Queue{opts: opts}
+}
+
+// Acquire blocks until the request may proceed, then returns a release
+// function that must be called exactly once when the request finishes.
+// It returns ErrShed, ErrTimeout, or the context's error when the request
+// is not admitted.
+func (q *Queue) Acquire(ctx context.Context, p Priority) (func(), error) {
+	if q == nil {
+		return func() {}, nil
+	}
+	if p < Low || p > High {
+		p = Normal
+	}
+
+	q.mu.Lock()
+	if q.active < q.opts.MaxConcurrent && q.queued == 0 {
+		q.active++
+		q.mu.Unlock()
+		return q.releaser(), nil
+	}
+	if p == Low && q.opts.ShedThreshold > 0 && q.queued >= q.opts.ShedThreshold {
+		q.shed++
+		q.mu.Unlock()
+		return nil, ErrShed
+	}
+	if q.opts.MaxQueue > 0 && q.queued >= q.opts.MaxQueue && !q.evictBelow(p) {
+		q.shed++
+		q.mu.Unlock()
+		return nil, ErrShed
+	}
+	w := &waiter{priority: p, ready: make(chan error, 1)}
+	q.waiting[p] = append(q.waiting[p], w)
+	q.queued++
+	q.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if q.opts.MaxWait > 0 {
+		t := time.NewTimer(q.opts.MaxWait)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	var err error
+	select {
+	case err = <-w.ready:
+		if err != nil {
+			return nil, err
+		}
+		return q.releaser(), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = ErrTimeout
+	}
+
+	q.mu.Lock()
+	removed := q.remove(w)
+	q.mu.Unlock()
+	if !removed {
+		// Admitted or shed concurrently with giving up.
+		if e := <-w.ready; e == nil {
+			q.releaser()()
+		}
+	}
+	return nil, err
+}
+
+// evictBelow sheds the newest waiter with the lowest priority below p.
+// The caller holds q.mu.
+func (q *Queue) evictBelow(p Priority) bool {
+	for lvl := Low; lvl < p; lvl++ {
+		if n := len(q.waiting[lvl]); n > 0 {
+			w := q.waiting[lvl][n-1]
+			q.waiting[lvl] = q.waiting[lvl][:n-1]
+			q.queued--
+			q.shed++
+			w.ready <- ErrShed
+			return true
+		}
+	}
+	return false
+}
+
+// remove drops w from its queue if it is still waiting. The caller holds q.mu.
+func (q *Queue) remove(w *waiter) bool {
+	list := q.waiting[w.priority]
+	for i, x := range list {
+		if x == w {
+			q.waiting[w.priority] = append(list[:i], list[i+1:]...)
+			q.queued--
+			return true
+		}
+	}
+	return false
+}
+
+func (q *Queue) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.active--
+			q.dispatch()
+		})
+	}
+}
+
+// dispatch admits waiters, highest priority first, while capacity remains.
+// The caller holds q.mu.
+func (q *Queue) dispatch() {
+	for q.active < q.opts.MaxConcurrent && q.queued > 0 {
+		for lvl := High; lvl >= Low; lvl-- {
+			if len(q.waiting[lvl]) == 0 {
+				continue
+			}
+			w := q.waiting[lvl][0]
+			q.waiting[lvl] = q.waiting[lvl][1:]
+			q.queued--
+			q.active++
+			w.ready <- nil
+			break
+		}
+	}
+}
+
+// Stats returns the current queue state.
+func (q *Queue) Stats() Stats {
+	if q == nil {
+		return Stats{Queued: map[string]int{}}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	st := Stats{Active: q.active, Queued: make(map[string]int, numPriorities), Shed: q.shed}
+	for lvl := Low; lvl <= High; lvl++ {
+		st.Queued[lvl.String()] = len(q.waiting[lvl])
+	}
+	return st
+}
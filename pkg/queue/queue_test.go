@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitQueued polls until n requests are waiting.
+func waitQueued(t *testing.T, q *Queue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		q.mu.Lock()
+		got := q.queued
+		q.mu.Unlock()
+		if got == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d queued", n)
+}
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Priority
+		err  bool
+	}{
+		{"", Normal, false},
+		{"low", Low, false},
+		{"Batch", Low, false},
+		{"HIGH", High, false},
+		{"interactive", High, false},
+		{"urgent", Normal, true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePriority(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParsePriority(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestNilQueueAdmitsAll(t *testing.T) {
+	q := New(Options{})
+	if q != nil {
+		t.Fatal("expected nil queue when MaxConcurrent is zero")
+	}
+	release, err := q.Acquire(context.Background(), Low)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
+
+func TestPriorityOrder(t *testing.T) {
+	q := New(Options{MaxConcurrent: 1})
+	hold, err := q.Acquire(context.Background(), Normal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan Priority, 3)
+	for i, p := range []Priority{Low, Normal, High} {
+		go func() {
+			release, err := q.Acquire(context.Background(), p)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- p
+			release()
+		}()
+		waitQueued(t, q, i+1)
+	}
+
+	hold()
+	for _, want := range []Priority{High, Normal, Low} {
+		if got := <-order; got != want {
+			t.Errorf("admitted %v, want %v", got, want)
+		}
+	}
+	if st := q.Stats(); st.Active != 0 {
+		t.Errorf("expected no active requests, got %d", st.Active)
+	}
+}
+
+func TestShedding(t *testing.T) {
+	q := New(Options{MaxConcurrent: 1, MaxQueue: 2, ShedThreshold: 1})
+	hold, _ := q.Acquire(context.Background(), Normal)
+	defer hold()
+
+	results := make(chan error, 2)
+	go func() { _, err := q.Acquire(context.Background(), Low); results <- err }()
+	waitQueued(t, q, 1)
+
+	// Past the shed threshold, new low-priority requests are rejected outright.
+	if _, err := q.Acquire(context.Background(), Low); !errors.Is(err, ErrShed) {
+		t.Errorf("expected ErrShed for low priority past threshold, got %v", err)
+	}
+
+	go func() { _, err := q.Acquire(context.Background(), Normal); results <- err }()
+	waitQueued(t, q, 2)
+
+	// Queue full: a high-priority request evicts the queued low one.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	go func() { _, _ = q.Acquire(ctx, High) }()
+	if err := <-results; !errors.Is(err, ErrShed) {
+		t.Errorf("expected queued low request to be shed, got %v", err)
+	}
+
+	// Full of equal-or-higher priority waiters: a normal request is shed.
+	waitQueued(t, q, 2)
+	if _, err := q.Acquire(context.Background(), Normal); !errors.Is(err, ErrShed) {
+		t.Errorf("expected ErrShed when queue is full, got %v", err)
+	}
+	if st := q.Stats(); st.Shed != 3 {
+		t.Errorf("expected 3 shed, got %d", st.Shed)
+	}
+}
+
+func TestMaxWait(t *testing.T) {
+	q := New(Options{MaxConcurrent: 1, MaxWait: 10 * time.Millisecond})
+	hold, _ := q.Acquire(context.Background(), Normal)
+
+	if _, err := q.Acquire(context.Background(), High); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	hold()
+
+	release, err := q.Acquire(context.Background(), Low)
+	if err != nil {
+		t.Fatalf("expected capacity after release, got %v", err)
+	}
+	release()
+	release() // idempotent
+	if st := q.Stats(); st.Active != 0 || st.Queued["high"] != 0 {
+		t.Errorf("unexpected stats after timeout: %+v", st)
+	}
+}
@@ -0,0 +1,160 @@
+// Package ratelimit enforces requests-per-minute and tokens-per-minute
+// limits per client key with token buckets. Budgets cap spend over days or
+// months; rate limits smooth out bursts that would exhaust upstream quotas.
+//
+// A request takes one token from each applicable RPM bucket up front. Its
+// token count is only known once the response arrives, so TPM buckets are
+// charged afterwards and may go into debt; a key in debt is refused until
+// the bucket refills. A limit's reserve is only available to high-priority
+// requests: the rest are refused once the bucket drops to it.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/queue"
+)
+
+// Limiter holds the buckets for a set of limits.
+type Limiter struct {
+	limits []config.RateLimit
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+}
+
+// bucketKey identifies one limit's bucket for one client key. A limit with
+// api_key "*" gives every client key its own bucket.
+type bucketKey struct {
+	limit  int
+	apiKey string
+	tpm    bool
+}
+
+// bucket is a token bucket refilled continuously at rate per second up to
+// capacity. Its level may go negative when charged after the fact.
+type bucket struct {
+	level    float64
+	capacity float64
+	rate     float64
+	last     time.Time
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.level = math.Min(b.capacity, b.level+b.rate*now.Sub(b.last).Seconds())
+	b.last = now
+}
+
+// wait returns how long until the bucket holds a whole token above floor.
+func (b *bucket) wait(floor float64) time.Duration {
+	if b.level >= floor+1 {
+		return 0
+	}
+	return time.Duration((floor + 1 - b.level) / b.rate * float64(time.Second))
+}
+
+// New returns a Limiter enforcing limits.
+func New(limits []config.RateLimit) *Limiter {
+	return &Limiter{limits: limits, now: time.Now, buckets: make(map[bucketKey]*bucket)}
+}
+
+// Enabled reports whether any limits are configured.
+func (l *Limiter) Enabled() bool {
+	return l != nil && len(l.limits) > 0
+}
+
+// Reservation is an admitted request's claim on its TPM buckets.
+type Reservation struct {
+	l       *Limiter
+	buckets []*bucket
+}
+
+// Spend charges tokens to the TPM buckets of the request's limits.
+func (r Reservation) Spend(tokens int) {
+	if r.l == nil || tokens <= 0 {
+		return
+	}
+	r.l.mu.Lock()
+	defer r.l.mu.Unlock()
+	now := r.l.now()
+	for _, b := range r.buckets {
+		b.refill(now)
+		b.level -= float64(tokens)
+	}
+}
+
+// Denial describes why a request was refused.
+type Denial struct {
+	// Limit is the limit that refused the request.
+	Limit config.RateLimit
+	// TPM is true when the tokens-per-minute bucket refused it, false for
+	// requests per minute.
+	TPM bool
+	// RetryAfter is when the bucket will admit a request again.
+	RetryAfter time.Duration
+}
+
+// Allow admits a request from apiKey for model at priority p if every
+// applicable bucket has room, taking one request from each RPM bucket.
+// Requests below queue.High can't dip into a limit's reserve. When a
+// bucket is empty it returns the longest wait among the refusing buckets
+// and charges nothing.
+func (l *Limiter) Allow(apiKey, model string, p queue.Priority) (Reservation, *Denial) {
+	if !l.Enabled() {
+		return Reservation{}, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+
+	var rpm, tpm []*bucket
+	var denial *Denial
+	for i, lim := range l.limits {
+		if !lim.Applies(apiKey, model) {
+			continue
+		}
+		check := func(perMinute int, isTPM bool) {
+			if perMinute <= 0 {
+				return
+			}
+			b := l.bucket(bucketKey{limit: i, apiKey: apiKey, tpm: isTPM}, perMinute, now)
+			if isTPM {
+				tpm = append(tpm, b)
+			} else {
+				rpm = append(rpm, b)
+			}
+			var floor float64
+			if p < queue.High {
+				floor = lim.Reserve * b.capacity
+			}
+			if w := b.wait(floor); w > 0 && (denial == nil || w > denial.RetryAfter) {
+				denial = &Denial{Limit: lim, TPM: isTPM, RetryAfter: w}
+			}
+		}
+		check(lim.RPM, false)
+		check(lim.TPM, true)
+	}
+	if denial != nil {
+		return Reservation{}, denial
+	}
+	for _, b := range rpm {
+		b.level--
+	}
+	return Reservation{l: l, buckets: tpm}, nil
+}
+
+// bucket returns the refilled bucket for key, creating it full.
+func (l *Limiter) bucket(key bucketKey, perMinute int, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{level: float64(perMinute), capacity: float64(perMinute), rate: float64(perMinute) / 60, last: now}
+		l.buckets[key] = b
+		return b
+	}
+	b.refill(now)
+	return b
+}
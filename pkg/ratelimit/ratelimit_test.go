@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/queue"
+)
+
+func newTestLimiter(limits ...config.RateLimit) (*Limiter, *time.Time) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := New(limits)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestRPM(t *testing.T) {
+	l, now := newTestLimiter(config.RateLimit{APIKey: "*", RPM: 2})
+
+	for i := 0; i < 2; i++ {
+		if _, d := l.Allow("key-a", "gpt-4", queue.Normal); d != nil {
+			t.Fatalf("request %d refused: %+v", i+1, d)
+		}
+	}
+	_, d := l.Allow("key-a", "gpt-4", queue.Normal)
+	if d == nil || d.TPM {
+		t.Fatalf("third request: denial = %+v, want an RPM denial", d)
+	}
+	if d.RetryAfter != 30*time.Second {
+		t.Errorf("RetryAfter = %v, want 30s (one request refills every 30s at 2 RPM)", d.RetryAfter)
+	}
+
+	// "*" gives every key its own bucket.
+	if _, d := l.Allow("key-b", "gpt-4", queue.Normal); d != nil {
+		t.Errorf("key-b refused by key-a's bucket: %+v", d)
+	}
+
+	*now = now.Add(30 * time.Second)
+	if _, d := l.Allow("key-a", "gpt-4", queue.Normal); d != nil {
+		t.Errorf("refused after refill: %+v", d)
+	}
+}
+
+func TestTPMChargedAfterResponse(t *testing.T) {
+	l, now := newTestLimiter(config.RateLimit{APIKey: "key-a", TPM: 600})
+
+	res, d := l.Allow("key-a", "gpt-4", queue.Normal)
+	if d != nil {
+		t.Fatal(d)
+	}
+	// A response can overdraw the bucket.
+	res.Spend(900)
+	_, d = l.Allow("key-a", "gpt-4", queue.Normal)
+	if d == nil || !d.TPM {
+		t.Fatalf("denial = %+v, want a TPM denial while in debt", d)
+	}
+	// 301 tokens short at 10 tokens/s.
+	if want := 30100 * time.Millisecond; d.RetryAfter != want {
+		t.Errorf("RetryAfter = %v, want %v", d.RetryAfter, want)
+	}
+
+	*now = now.Add(31 * time.Second)
+	if _, d := l.Allow("key-a", "gpt-4", queue.Normal); d != nil {
+		t.Errorf("refused after the debt was repaid: %+v", d)
+	}
+}
+
+func TestScope(t *testing.T) {
+	l, _ := newTestLimiter(
+		config.RateLimit{APIKey: "key-a", Model: "gpt-4", RPM: 1},
+		config.RateLimit{APIKey: "key-a", RPM: 3},
+	)
+	tests := []struct {
+		model   string
+		allowed bool
+	}{
+		{"gpt-4", true},
+		{"gpt-4", false},  // model limit exhausted
+		{"gpt-4o", true},  // other models only share the key-wide limit
+		{"gpt-4o", true},  // key-wide limit: 3 of 3
+		{"gpt-4o", false}, // key-wide limit exhausted
+	}
+	for i, tt := range tests {
+		_, d := l.Allow("key-a", tt.model, queue.Normal)
+		if (d == nil) != tt.allowed {
+			t.Errorf("request %d (%s): allowed = %v, want %v", i+1, tt.model, d == nil, tt.allowed)
+		}
+	}
+	if _, d := l.Allow("key-b", "gpt-4", queue.Normal); d != nil {
+		t.Errorf("unlisted key refused: %+v", d)
+	}
+}
+
+func TestRefusedRequestChargesNothing(t *testing.T) {
+	l, _ := newTestLimiter(
+		config.RateLimit{APIKey: "*", RPM: 5},
+		config.RateLimit{APIKey: "*", Model: "gpt-4", RPM: 1},
+	)
+	l.Allow("key-a", "gpt-4", queue.Normal)
+	for i := 0; i < 3; i++ {
+		if _, d := l.Allow("key-a", "gpt-4", queue.Normal); d == nil {
+			t.Fatal("expected the model limit to refuse")
+		}
+	}
+	// Refusals didn't drain the key-wide bucket: 4 of 5 remain.
+	for i := 0; i < 4; i++ {
+		if _, d := l.Allow("key-a", "gpt-4o", queue.Normal); d != nil {
+			t.Fatalf("request %d refused: %+v", i+1, d)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	l, now := newTestLimiter(config.RateLimit{APIKey: "*", RPM: 10, Reserve: 0.2})
+
+	// Normal traffic gets 8 of 10; the last 2 are held for high priority.
+	for i := 0; i < 8; i++ {
+		if _, d := l.Allow("key-a", "gpt-4", queue.Normal); d != nil {
+			t.Fatalf("request %d refused: %+v", i+1, d)
+		}
+	}
+	_, d := l.Allow("key-a", "gpt-4", queue.Low)
+	if d == nil {
+		t.Fatal("expected the reserve to refuse low priority")
+	}
+	if d.RetryAfter != 6*time.Second {
+		t.Errorf("RetryAfter = %v, want 6s", d.RetryAfter)
+	}
+	for i := 0; i < 2; i++ {
+		if _, d := l.Allow("key-a", "gpt-4", queue.High); d != nil {
+			t.Fatalf("high-priority request %d refused: %+v", i+1, d)
+		}
+	}
+	if _, d := l.Allow("key-a", "gpt-4", queue.High); d == nil {
+		t.Error("expected an empty bucket to refuse high priority too")
+	}
+
+	*now = now.Add(30 * time.Second) // refills 5
+	if _, d := l.Allow("key-a", "gpt-4", queue.Normal); d != nil {
+		t.Errorf("refused after refilling past the reserve: %+v", d)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	var l *Limiter
+	if l.Enabled() {
+		t.Error("nil limiter should be disabled")
+	}
+	res, d := New(nil).Allow("key", "model", queue.Normal)
+	if d != nil {
+		t.Errorf("no limits should allow everything, got %+v", d)
+	}
+	res.Spend(100) // no-op
+}
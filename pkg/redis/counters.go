@@ -0,0 +1,125 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// seededField marks a counter whose totals include everything recorded
+// before it was first incremented.
+const seededField = "seeded"
+
+// Counters stores usage counters as Redis hashes of float fields. It
+// implements tracker.CounterStore.
+type Counters struct {
+	c *Client
+}
+
+// NewCounters returns a counter store backed by c.
+func NewCounters(c *Client) *Counters {
+	return &Counters{c: c}
+}
+
+// Add increments the fields of the counter at key and sets its expiry.
+func (s *Counters) Add(ctx context.Context, key string, fields map[string]float64, ttl time.Duration) error {
+	return s.add(ctx, key, fields, ttl)
+}
+
+// Get returns the fields of the counter at key, and whether it is seeded.
+// A missing counter has no fields.
+func (s *Counters) Get(ctx context.Context, key string) (map[string]float64, bool, error) {
+	reply, err := s.c.Do(ctx, "HGETALL", key)
+	if err != nil {
+		return nil, false, err
+	}
+	items, _ := reply.([]any)
+	fields := make(map[string]float64, len(items)/2)
+	seeded := false
+	for i := 0; i+1 < len(items); i += 2 {
+		name, _ := items[i].(string)
+		value, _ := items[i+1].(string)
+		if name == seededField {
+			seeded = true
+			continue
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("redis: counter %s field %s: %w", key, name, err)
+		}
+		fields[name] = f
+	}
+	return fields, seeded, nil
+}
+
+// Seed marks the counter at key seeded and adds fields to it, unless it
+// was seeded already. It reports whether it seeded the counter.
+func (s *Counters) Seed(ctx context.Context, key string, fields map[string]float64, ttl time.Duration) (bool, error) {
+	reply, err := s.c.Do(ctx, "HSETNX", key, seededField, "1")
+	if err != nil {
+		return false, err
+	}
+	if n, _ := reply.(int64); n == 0 {
+		return false, nil
+	}
+	return true, s.add(ctx, key, fields, ttl)
+}
+
+// Delete removes counters.
+func (s *Counters) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := s.c.Do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// DeletePrefix removes every counter whose key starts with prefix.
+func (s *Counters) DeletePrefix(ctx context.Context, prefix string) error {
+	cursor := "0"
+	for {
+		reply, err := s.c.Do(ctx, "SCAN", cursor, "MATCH", prefix+"*", "COUNT", "1000")
+		if err != nil {
+			return err
+		}
+		page, _ := reply.([]any)
+		if len(page) != 2 {
+			return fmt.Errorf("redis: unexpected SCAN reply %v", reply)
+		}
+		cursor, _ = page[0].(string)
+		items, _ := page[1].([]any)
+		keys := make([]string, 0, len(items))
+		for _, k := range items {
+			if k, ok := k.(string); ok {
+				keys = append(keys, k)
+			}
+		}
+		if err := s.Delete(ctx, keys...); err != nil {
+			return err
+		}
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+func (s *Counters) add(ctx context.Context, key string, fields map[string]float64, ttl time.Duration) error {
+	cmds := make([][]string, 0, len(fields)+1)
+	for name, v := range fields {
+		if v != 0 {
+			cmds = append(cmds, []string{"HINCRBYFLOAT", key, name, strconv.FormatFloat(v, 'f', -1, 64)})
+		}
+	}
+	cmds = append(cmds, []string{"PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10)})
+	replies, err := s.c.Pipeline(ctx, cmds)
+	if err != nil {
+		return err
+	}
+	for _, r := range replies {
+		if err, ok := r.(Error); ok {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+// Package redis is a minimal Redis client: enough of RESP2 to run commands,
+// pipelined, over a small pool of connections.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error is an error reply from the server.
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// maxIdle is how many idle connections the client keeps for reuse.
+const maxIdle = 8
+
+// Options configures a Client.
+type Options struct {
+	Addr     string
+	Password string
+	DB       int
+	// TLS, when set, connects over TLS.
+	TLS *tls.Config
+	// Timeout bounds dialing and each command (default 2s).
+	Timeout time.Duration
+}
+
+// ParseURL parses a redis:// or rediss:// (TLS) URL, e.g.
+// redis://:password@localhost:6379/0, into Options.
+func ParseURL(raw string) (Options, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Options{}, fmt.Errorf("parse redis url: %w", err)
+	}
+	var opts Options
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		opts.TLS = &tls.Config{ServerName: u.Hostname()}
+	default:
+		return Options{}, fmt.Errorf("redis url: scheme must be redis or rediss, got %q", u.Scheme)
+	}
+	opts.Addr = u.Host
+	if u.Port() == "" {
+		opts.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if p, ok := u.User.Password(); ok {
+		opts.Password = p
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if opts.DB, err = strconv.Atoi(db); err != nil {
+			return Options{}, fmt.Errorf("redis url: invalid db %q", db)
+		}
+	}
+	return opts, nil
+}
+
+// Client runs commands against one Redis server. It is safe for
+// concurrent use.
+type Client struct {
+	opts Options
+
+	mu   sync.Mutex
+	idle []*conn
+}
+
+// New creates a Client. Connections are opened on first use.
+func New(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	return &Client{opts: opts}
+}
+
+// Do runs one command and returns its reply: a string, int64, nil, or
+// []any of those. An error reply is returned as an Error.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	replies, err := c.Pipeline(ctx, [][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := replies[0].(Error); ok {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// Pipeline sends commands in one round trip and returns their replies in
+// order. Error replies are returned in place, as Error values.
+func (c *Client) Pipeline(ctx context.Context, cmds [][]string) ([]any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(c.opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = cn.nc.SetDeadline(deadline)
+	replies, err := cn.roundTrip(cmds)
+	if err != nil {
+		_ = cn.nc.Close()
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	c.put(cn)
+	return replies, nil
+}
+
+// Close closes the idle connections.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cn := range c.idle {
+		_ = cn.nc.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+	return c.dial(ctx)
+}
+
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.idle) >= maxIdle {
+		_ = cn.nc.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+// dial opens a connection, authenticating and selecting the database.
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	d := &net.Dialer{Timeout: c.opts.Timeout}
+	var nc net.Conn
+	var err error
+	if c.opts.TLS != nil {
+		nc, err = (&tls.Dialer{NetDialer: d, Config: c.opts.TLS}).DialContext(ctx, "tcp", c.opts.Addr)
+	} else {
+		nc, err = d.DialContext(ctx, "tcp", c.opts.Addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: dial %s: %w", c.opts.Addr, err)
+	}
+	cn := &conn{nc: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	var setup [][]string
+	if c.opts.Password != "" {
+		setup = append(setup, []string{"AUTH", c.opts.Password})
+	}
+	if c.opts.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.opts.DB)})
+	}
+	if len(setup) > 0 {
+		_ = nc.SetDeadline(time.Now().Add(c.opts.Timeout))
+		replies, err := cn.roundTrip(setup)
+		if err == nil {
+			for _, r := range replies {
+				if e, ok := r.(Error); ok {
+					err = e
+					break
+				}
+			}
+		}
+		if err != nil {
+			_ = nc.Close()
+			return nil, fmt.Errorf("redis: connect %s: %w", c.opts.Addr, err)
+		}
+	}
+	return cn, nil
+}
+
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+}
+
+func (cn *conn) roundTrip(cmds [][]string) ([]any, error) {
+	for _, args := range cmds {
+		fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+		for _, a := range args {
+			fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(a), a)
+		}
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]any, len(cmds))
+	for i := range cmds {
+		r, err := readReply(cn.r)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = r
+	}
+	return replies, nil
+}
+
+// readReply reads one RESP2 reply.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, errors.New("malformed reply")
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return Error(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("malformed bulk length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("malformed array length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unknown reply type %q", kind)
+}
@@ -0,0 +1,239 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer speaks enough RESP2 to serve the hash commands Counters uses.
+type fakeServer struct {
+	ln       net.Listener
+	password string
+
+	mu     sync.Mutex
+	hashes map[string]map[string]string
+	ttls   map[string]int64
+}
+
+func newFakeServer(t *testing.T, password string) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{ln: ln, password: password, hashes: make(map[string]map[string]string), ttls: make(map[string]int64)}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	t.Cleanup(func() { _ = ln.Close() })
+	return s
+}
+
+func (s *fakeServer) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authed := s.password == ""
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]any)
+		args := make([]string, len(items))
+		for i, it := range items {
+			args[i], _ = it.(string)
+		}
+		if len(args) == 0 {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		if !authed && cmd != "AUTH" {
+			io.WriteString(c, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		if cmd == "AUTH" {
+			if args[1] != s.password {
+				io.WriteString(c, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			authed = true
+		}
+		io.WriteString(c, s.exec(cmd, args[1:]))
+	}
+}
+
+func (s *fakeServer) exec(cmd string, args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch cmd {
+	case "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "HINCRBYFLOAT":
+		h := s.hash(args[0])
+		cur, _ := strconv.ParseFloat(h[args[1]], 64)
+		by, _ := strconv.ParseFloat(args[2], 64)
+		h[args[1]] = strconv.FormatFloat(cur+by, 'f', -1, 64)
+		return bulk(h[args[1]])
+	case "HSETNX":
+		h := s.hash(args[0])
+		if _, ok := h[args[1]]; ok {
+			return ":0\r\n"
+		}
+		h[args[1]] = args[2]
+		return ":1\r\n"
+	case "HGETALL":
+		h := s.hashes[args[0]]
+		out := fmt.Sprintf("*%d\r\n", 2*len(h))
+		for k, v := range h {
+			out += bulk(k) + bulk(v)
+		}
+		return out
+	case "PEXPIRE":
+		ms, _ := strconv.ParseInt(args[1], 10, 64)
+		s.ttls[args[0]] = ms
+		return ":1\r\n"
+	case "DEL":
+		n := 0
+		for _, k := range args {
+			if _, ok := s.hashes[k]; ok {
+				delete(s.hashes, k)
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "SCAN":
+		// One page: every key matching the MATCH prefix.
+		prefix := strings.TrimSuffix(args[2], "*")
+		var keys []string
+		for k := range s.hashes {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, bulk(k))
+			}
+		}
+		return fmt.Sprintf("*2\r\n%s*%d\r\n%s", bulk("0"), len(keys), strings.Join(keys, ""))
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func (s *fakeServer) hash(key string) map[string]string {
+	h := s.hashes[key]
+	if h == nil {
+		h = make(map[string]string)
+		s.hashes[key] = h
+	}
+	return h
+}
+
+func bulk(v string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    Options
+		tls     bool
+		wantErr bool
+	}{
+		{url: "redis://localhost", want: Options{Addr: "localhost:6379"}},
+		{url: "redis://:secret@redis:6380/2", want: Options{Addr: "redis:6380", Password: "secret", DB: 2}},
+		{url: "rediss://cache.example.com:6380", want: Options{Addr: "cache.example.com:6380"}, tls: true},
+		{url: "http://localhost:6379", wantErr: true},
+		{url: "redis://localhost/x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := ParseURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if (got.TLS != nil) != tt.tls {
+				t.Errorf("TLS = %v, want %v", got.TLS != nil, tt.tls)
+			}
+			got.TLS = nil
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCounters(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	ctx := context.Background()
+
+	bad := New(Options{Addr: srv.ln.Addr().String(), Password: "wrong"})
+	if _, err := bad.Do(ctx, "HGETALL", "k"); err == nil {
+		t.Error("wrong password accepted")
+	}
+
+	client := New(Options{Addr: srv.ln.Addr().String(), Password: "secret", DB: 1})
+	defer client.Close()
+	c := NewCounters(client)
+
+	if err := c.Add(ctx, "k", map[string]float64{"gpt-4|t": 100, "gpt-4|m": 0.25}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	fields, seeded, err := c.Get(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seeded || fields["gpt-4|t"] != 100 || fields["gpt-4|m"] != 0.25 {
+		t.Errorf("after add: fields %v, seeded %v", fields, seeded)
+	}
+	srv.mu.Lock()
+	ttl := srv.ttls["k"]
+	srv.mu.Unlock()
+	if ttl != time.Hour.Milliseconds() {
+		t.Errorf("ttl = %dms, want 1h", ttl)
+	}
+
+	for i, want := range []bool{true, false} {
+		ok, err := c.Seed(ctx, "k", map[string]float64{"gpt-4|t": 50}, time.Hour)
+		if err != nil || ok != want {
+			t.Errorf("seed %d = %v, %v; want %v", i, ok, err, want)
+		}
+	}
+	fields, seeded, _ = c.Get(ctx, "k")
+	if !seeded || fields["gpt-4|t"] != 150 {
+		t.Errorf("after seed: fields %v, seeded %v", fields, seeded)
+	}
+
+	if err := c.Delete(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if fields, _, _ = c.Get(ctx, "k"); len(fields) != 0 {
+		t.Errorf("after delete: fields %v", fields)
+	}
+
+	for _, k := range []string{"usage:a", "usage:b", "other"} {
+		_ = c.Add(ctx, k, map[string]float64{"x|t": 1}, time.Hour)
+	}
+	if err := c.DeletePrefix(ctx, "usage:"); err != nil {
+		t.Fatal(err)
+	}
+	srv.mu.Lock()
+	left := len(srv.hashes)
+	_, kept := srv.hashes["other"]
+	srv.mu.Unlock()
+	if left != 1 || !kept {
+		t.Errorf("after delete prefix: %d counters left, other kept %v", left, kept)
+	}
+}
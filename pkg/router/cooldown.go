@@ -0,0 +1,89 @@
+package router
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TargetCooldown is the failure state of a route target.
+type TargetCooldown struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	// Failures is the number of consecutive failed attempts.
+	Failures int `json:"failures"`
+	// CoolingUntil is set while the target is demoted.
+	CoolingUntil time.Time `json:"cooling_until,omitempty"`
+}
+
+// cooldowns tracks failure streaks per target. Targets are only tracked
+// while they have a streak.
+type cooldowns struct {
+	mu      sync.Mutex
+	targets map[targetKey]*TargetCooldown
+}
+
+func newCooldowns() *cooldowns {
+	return &cooldowns{targets: make(map[targetKey]*TargetCooldown)}
+}
+
+// Failed counts a failed attempt, a transport error or 5xx, against a
+// target. With router.cooldown set, the target is demoted once its streak
+// reaches cooldown.failures, and again after each further failure.
+func (r *Router) Failed(provider, model string) {
+	cd := r.Config().Router.Cooldown
+	if cd.Failures <= 0 {
+		return
+	}
+	now := r.now()
+	c := r.cooldown
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := targetKey{provider, model}
+	t := c.targets[k]
+	if t == nil {
+		t = &TargetCooldown{Provider: provider, Model: model}
+		c.targets[k] = t
+	}
+	t.Failures++
+	if t.Failures >= cd.Failures {
+		t.CoolingUntil = now.Add(cd.Duration)
+		log.Printf("router: %s/%s failed %d times in a row, cooling down until %s",
+			provider, model, t.Failures, t.CoolingUntil.Format(time.RFC3339))
+	}
+}
+
+// Succeeded ends a target's failure streak.
+func (r *Router) Succeeded(provider, model string) {
+	c := r.cooldown
+	c.mu.Lock()
+	delete(c.targets, targetKey{provider, model})
+	c.mu.Unlock()
+}
+
+// cooling reports whether a target is demoted.
+func (c *cooldowns) cooling(provider, model string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.targets[targetKey{provider, model}]
+	return t != nil && now.Before(t.CoolingUntil)
+}
+
+// Cooldowns returns the targets with a failure streak, ordered by provider
+// and model.
+func (r *Router) Cooldowns() []TargetCooldown {
+	r.cooldown.mu.Lock()
+	defer r.cooldown.mu.Unlock()
+	out := make([]TargetCooldown, 0, len(r.cooldown.targets))
+	for _, t := range r.cooldown.targets {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Provider != out[j].Provider {
+			return out[i].Provider < out[j].Provider
+		}
+		return out[i].Model < out[j].Model
+	})
+	return out
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCooldown(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := fallbackConfig(0)
+	cfg.Router.Cooldown.Failures = 2
+	cfg.Router.Cooldown.Duration = time.Minute
+	r := New(cfg)
+	r.now = func() time.Time { return now }
+
+	r.Failed("openai", "gpt-4o-mini")
+	if got := firstProvider(t, r); got != "openai" {
+		t.Errorf("expected openai first below the threshold, got %s", got)
+	}
+
+	r.Failed("openai", "gpt-4o-mini")
+	routes, err := r.Resolve("fast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || routes[0].Provider.Name != "anthropic" || routes[1].Provider.Name != "openai" {
+		t.Errorf("expected cooling target last, got %+v", routes)
+	}
+
+	// Once the cooldown passes the target is probed in its usual position,
+	// and one more failure cools it down again.
+	now = now.Add(time.Minute)
+	if got := firstProvider(t, r); got != "openai" {
+		t.Errorf("expected re-probe after cooldown, got %s first", got)
+	}
+	r.Failed("openai", "gpt-4o-mini")
+	if got := firstProvider(t, r); got != "anthropic" {
+		t.Errorf("expected failed probe to cool down again, got %s first", got)
+	}
+
+	r.Succeeded("openai", "gpt-4o-mini")
+	if got := firstProvider(t, r); got != "openai" {
+		t.Errorf("expected success to end the cooldown, got %s first", got)
+	}
+	if got := r.Cooldowns(); len(got) != 0 {
+		t.Errorf("expected no streaks, got %+v", got)
+	}
+}
+
+func TestCooldownDisabled(t *testing.T) {
+	r := New(fallbackConfig(0))
+	for range 5 {
+		r.Failed("openai", "gpt-4o-mini")
+	}
+	if got := firstProvider(t, r); got != "openai" {
+		t.Errorf("expected no cooldown without router.cooldown, got %s first", got)
+	}
+	if got := r.Cooldowns(); len(got) != 0 {
+		t.Errorf("expected no streaks tracked, got %+v", got)
+	}
+}
@@ -0,0 +1,56 @@
+package router
+
+import (
+	"sort"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// Requests of unknown size are costed as nominalPromptTokens of prompt;
+// completions of unknown size as defaultCompletionTokens.
+const (
+	nominalPromptTokens     = 1000
+	defaultCompletionTokens = 256
+)
+
+// byCost orders routes cheapest first for a request of the given size,
+// using the pricing catalog of cfg. Targets without a price go last, since
+// nothing says they are cheap; ties keep the configured order.
+func byCost(routes []Route, cfg *config.Config, size Hints) []Route {
+	if len(routes) < 2 {
+		return routes
+	}
+	if size.PromptTokens <= 0 {
+		size.PromptTokens = nominalPromptTokens
+	}
+	if size.CompletionTokens <= 0 {
+		size.CompletionTokens = defaultCompletionTokens
+	}
+	pricing := make(map[string]models.ModelPricing)
+	for _, p := range cfg.Pricing() {
+		pricing[p.Model] = p
+	}
+
+	type costed struct {
+		route Route
+		cost  float64
+		known bool
+	}
+	cs := make([]costed, len(routes))
+	for i, rt := range routes {
+		p, ok := pricing[rt.Model]
+		cs[i] = costed{rt, p.Cost(int64(size.PromptTokens), int64(size.CompletionTokens)), ok}
+	}
+	sort.SliceStable(cs, func(i, j int) bool {
+		if cs[i].known != cs[j].known {
+			return cs[i].known
+		}
+		return cs[i].cost < cs[j].cost
+	})
+	out := make([]Route, len(cs))
+	for i, c := range cs {
+		out[i] = c.route
+	}
+	return out
+}
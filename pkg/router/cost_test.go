@@ -0,0 +1,90 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/pario-ai/pario/pkg/config"
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestCheapestStrategy(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "openai", URL: "https://api.openai.com"},
+			{Name: "anthropic", URL: "https://api.anthropic.com", Type: "anthropic"},
+		},
+		Router: config.RouterConfig{Routes: []config.RouteConfig{{
+			Model:    "any",
+			Strategy: config.StrategyCheapest,
+			Targets: []config.RouteTarget{
+				{Provider: "openai", Model: "unpriced"},
+				{Provider: "openai", Model: "long-output"},
+				{Provider: "anthropic", Model: "long-input"},
+			},
+		}}},
+	}
+	cfg.Attribution.Pricing = []models.ModelPricing{
+		// Cheap prompts, expensive completions.
+		{Model: "long-output", PromptCost: 1, CompletionCost: 10},
+		// The reverse.
+		{Model: "long-input", PromptCost: 5, CompletionCost: 1},
+	}
+
+	tests := []struct {
+		name string
+		size Hints
+		want []string
+	}{
+		{"large prompt", Hints{PromptTokens: 10000, CompletionTokens: 100}, []string{"long-output", "long-input", "unpriced"}},
+		{"large completion", Hints{PromptTokens: 100, CompletionTokens: 4000}, []string{"long-input", "long-output", "unpriced"}},
+		// 1K prompt and 256 completion tokens: 3.56 vs 5.256.
+		{"unknown size", Hints{}, []string{"long-output", "long-input", "unpriced"}},
+	}
+	r := New(cfg)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes, err := r.ResolveFor("any", tt.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, rt := range routes {
+				got = append(got, rt.Model)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheapestPrefersLocal(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "openai", URL: "https://api.openai.com"},
+			{Name: "ollama", URL: "http://localhost:11434", Type: "openai-compatible"},
+		},
+		Router: config.RouterConfig{Routes: []config.RouteConfig{{
+			Model:    "chat",
+			Strategy: config.StrategyCheapest,
+			Targets: []config.RouteTarget{
+				{Provider: "openai", Model: "gpt-4o-mini"},
+				{Provider: "ollama", Model: "qwen2.5:7b"},
+			},
+		}}},
+	}
+	cfg.Attribution.Pricing = []models.ModelPricing{{Model: "gpt-4o-mini", PromptCost: 0.15, CompletionCost: 0.6}}
+
+	routes, err := New(cfg).Resolve("chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if routes[0].Model != "qwen2.5:7b" {
+		t.Errorf("expected free local model first, got %s", routes[0].Model)
+	}
+}
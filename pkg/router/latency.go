@@ -0,0 +1,118 @@
+package router
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyAlpha is the weight of each new sample in a target's latency
+// EWMA. At 0.2 a sustained change is mostly reflected after about ten
+// requests.
+const latencyAlpha = 0.2
+
+// latencyStale is how long a target's latency stays valid without new
+// samples. Targets ordered last by latency get no traffic to correct a
+// stale figure, so once it expires they are re-probed.
+const latencyStale = 5 * time.Minute
+
+// TargetLatency is the observed latency of one route target.
+type TargetLatency struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	// EWMAMs is the exponentially weighted moving average of the time, in
+	// milliseconds, from sending a request to receiving response headers.
+	EWMAMs    float64   `json:"ewma_ms"`
+	Samples   int       `json:"samples"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type targetKey struct{ provider, model string }
+
+// latencies tracks per-target latency EWMAs.
+type latencies struct {
+	mu      sync.Mutex
+	targets map[targetKey]*TargetLatency
+	now     func() time.Time
+}
+
+func newLatencies() *latencies {
+	return &latencies{targets: make(map[targetKey]*TargetLatency), now: time.Now}
+}
+
+// ObserveLatency feeds the time an upstream call to model on provider took
+// to return response headers into the target's latency average. Calls
+// that failed at the transport level or with a 5xx should not be fed in.
+func (r *Router) ObserveLatency(provider, model string, d time.Duration) {
+	l := r.latency
+	ms := float64(d) / float64(time.Millisecond)
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	k := targetKey{provider, model}
+	t := l.targets[k]
+	switch {
+	case t == nil:
+		t = &TargetLatency{Provider: provider, Model: model, EWMAMs: ms}
+		l.targets[k] = t
+	case now.Sub(t.UpdatedAt) >= latencyStale:
+		t.EWMAMs = ms
+	default:
+		t.EWMAMs = latencyAlpha*ms + (1-latencyAlpha)*t.EWMAMs
+	}
+	t.Samples++
+	t.UpdatedAt = now
+}
+
+// estimate returns a target's current latency average, or false if it has
+// no recent samples.
+func (l *latencies) estimate(provider, model string) (float64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t := l.targets[targetKey{provider, model}]
+	if t == nil || l.now().Sub(t.UpdatedAt) >= latencyStale {
+		return 0, false
+	}
+	return t.EWMAMs, true
+}
+
+// byLatency orders routes fastest first. Targets without recent samples go
+// first so they get measured; ties keep the configured order.
+func (r *Router) byLatency(routes []Route) []Route {
+	if len(routes) < 2 {
+		return routes
+	}
+	est := make([]float64, len(routes))
+	for i, rt := range routes {
+		est[i], _ = r.latency.estimate(rt.Provider.Name, rt.Model)
+	}
+	idx := make([]int, len(routes))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return est[idx[a]] < est[idx[b]] })
+	out := make([]Route, len(routes))
+	for i, j := range idx {
+		out[i] = routes[j]
+	}
+	return out
+}
+
+// Latencies returns a snapshot of the observed target latencies, ordered
+// by provider and model.
+func (r *Router) Latencies() []TargetLatency {
+	r.latency.mu.Lock()
+	defer r.latency.mu.Unlock()
+	out := make([]TargetLatency, 0, len(r.latency.targets))
+	for _, t := range r.latency.targets {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Provider != out[j].Provider {
+			return out[i].Provider < out[j].Provider
+		}
+		return out[i].Model < out[j].Model
+	})
+	return out
+}
@@ -0,0 +1,70 @@
+package router
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+)
+
+func latencyConfig() *config.Config {
+	cfg := fallbackConfig(0)
+	cfg.Router.Routes[0].Strategy = config.StrategyLatency
+	return cfg
+}
+
+func TestObserveLatencyEWMA(t *testing.T) {
+	r := New(latencyConfig())
+	r.ObserveLatency("openai", "gpt-4o-mini", 100*time.Millisecond)
+	r.ObserveLatency("openai", "gpt-4o-mini", 200*time.Millisecond)
+
+	got := r.Latencies()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 target, got %+v", got)
+	}
+	// 0.2*200 + 0.8*100
+	if math.Abs(got[0].EWMAMs-120) > 1e-9 || got[0].Samples != 2 {
+		t.Errorf("unexpected latency %+v", got[0])
+	}
+}
+
+func TestLatencyStrategy(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := New(latencyConfig())
+	r.latency.now = func() time.Time { return now }
+
+	r.ObserveLatency("openai", "gpt-4o-mini", 900*time.Millisecond)
+	if got := firstProvider(t, r); got != "anthropic" {
+		t.Errorf("expected unmeasured target first, got %s", got)
+	}
+
+	r.ObserveLatency("anthropic", "claude-haiku-4-5", 300*time.Millisecond)
+	if got := firstProvider(t, r); got != "anthropic" {
+		t.Errorf("expected faster target first, got %s", got)
+	}
+
+	// The slow target's figure expires, so it is probed again.
+	now = now.Add(latencyStale)
+	r.ObserveLatency("anthropic", "claude-haiku-4-5", 300*time.Millisecond)
+	if got := firstProvider(t, r); got != "openai" {
+		t.Errorf("expected stale target re-probed first, got %s", got)
+	}
+
+	// Rate-limit headroom still takes precedence over speed.
+	r.ObserveLatency("openai", "gpt-4o-mini", 100*time.Millisecond)
+	r.Observe("openai", http.StatusTooManyRequests, http.Header{"Retry-After": {"60"}})
+	if got := firstProvider(t, r); got != "anthropic" {
+		t.Errorf("expected rate-limited target last, got %s first", got)
+	}
+}
+
+func TestOrderedStrategyIgnoresLatency(t *testing.T) {
+	r := New(fallbackConfig(0))
+	r.ObserveLatency("openai", "gpt-4o-mini", time.Second)
+	r.ObserveLatency("anthropic", "claude-haiku-4-5", time.Millisecond)
+	if got := firstProvider(t, r); got != "openai" {
+		t.Errorf("expected configured order, got %s first", got)
+	}
+}
@@ -0,0 +1,197 @@
+package router
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limit is the last known state of one provider rate limit (requests or
+// tokens), as reported by the provider's response headers.
+type Limit struct {
+	Limit     int64     `json:"limit,omitempty"`
+	Remaining int64     `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+// ProviderLimits is the last known rate-limit state of a provider.
+type ProviderLimits struct {
+	Requests *Limit `json:"requests,omitempty"`
+	Tokens   *Limit `json:"tokens,omitempty"`
+	// LimitedUntil is set after a 429 and holds the provider back until
+	// Retry-After (or the limit's reset) has passed.
+	LimitedUntil time.Time `json:"limited_until,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// rateLimits tracks per-provider limits observed from responses. Each
+// response replaces the provider's buckets; between responses a bucket
+// counts as refilled once its reset time passes.
+type rateLimits struct {
+	mu        sync.Mutex
+	providers map[string]*ProviderLimits
+	headroom  float64
+	now       func() time.Time
+}
+
+func newRateLimits(headroom float64) *rateLimits {
+	return &rateLimits{providers: make(map[string]*ProviderLimits), headroom: headroom, now: time.Now}
+}
+
+func (l *rateLimits) setHeadroom(h float64) {
+	l.mu.Lock()
+	l.headroom = h
+	l.mu.Unlock()
+}
+
+// Observe updates a provider's rate-limit state from an upstream response.
+// OpenAI-style x-ratelimit-* and Anthropic anthropic-ratelimit-* headers
+// are understood; responses without either leave the state unchanged
+// unless the status is 429.
+func (r *Router) Observe(provider string, status int, h http.Header) {
+	l := r.limits
+	now := l.now()
+
+	reqs := parseLimit(h, now,
+		"x-ratelimit-limit-requests", "x-ratelimit-remaining-requests", "x-ratelimit-reset-requests",
+		"anthropic-ratelimit-requests-limit", "anthropic-ratelimit-requests-remaining", "anthropic-ratelimit-requests-reset")
+	toks := parseLimit(h, now,
+		"x-ratelimit-limit-tokens", "x-ratelimit-remaining-tokens", "x-ratelimit-reset-tokens",
+		"anthropic-ratelimit-tokens-limit", "anthropic-ratelimit-tokens-remaining", "anthropic-ratelimit-tokens-reset")
+	if reqs == nil && toks == nil && status != http.StatusTooManyRequests {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p := l.providers[provider]
+	if p == nil {
+		p = &ProviderLimits{}
+		l.providers[provider] = p
+	}
+	if reqs != nil {
+		p.Requests = reqs
+	}
+	if toks != nil {
+		p.Tokens = toks
+	}
+	p.UpdatedAt = now
+	if status == http.StatusTooManyRequests {
+		until := now.Add(retryAfter(h))
+		for _, lim := range []*Limit{reqs, toks} {
+			if lim != nil && lim.Remaining <= 0 && lim.Reset.After(until) {
+				until = lim.Reset
+			}
+		}
+		p.LimitedUntil = until
+	}
+}
+
+// defaultRetryAfter holds a provider back after a 429 that carries no
+// Retry-After header.
+const defaultRetryAfter = time.Second
+
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return defaultRetryAfter
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return defaultRetryAfter
+}
+
+// parseLimit reads one limit from either header family. OpenAI reports
+// resets as durations ("6m0s", "20ms"); Anthropic as RFC 3339 times.
+func parseLimit(h http.Header, now time.Time, oaLimit, oaRemaining, oaReset, anLimit, anRemaining, anReset string) *Limit {
+	limitKey, remainingKey, resetKey := oaLimit, oaRemaining, oaReset
+	if h.Get(remainingKey) == "" {
+		limitKey, remainingKey, resetKey = anLimit, anRemaining, anReset
+	}
+	remaining, err := strconv.ParseInt(h.Get(remainingKey), 10, 64)
+	if err != nil {
+		return nil
+	}
+	lim := &Limit{Remaining: remaining}
+	lim.Limit, _ = strconv.ParseInt(h.Get(limitKey), 10, 64)
+	if v := h.Get(resetKey); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			lim.Reset = now.Add(d)
+		} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+			lim.Reset = t
+		}
+	}
+	return lim
+}
+
+// hasHeadroom reports whether a provider is believed able to take another
+// request. Providers with no observed limits have headroom.
+func (l *rateLimits) hasHeadroom(provider string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p := l.providers[provider]
+	if p == nil {
+		return true
+	}
+	now := l.now()
+	if now.Before(p.LimitedUntil) {
+		return false
+	}
+	return l.bucketOK(p.Requests, now) && l.bucketOK(p.Tokens, now)
+}
+
+func (l *rateLimits) bucketOK(lim *Limit, now time.Time) bool {
+	if lim == nil || (!lim.Reset.IsZero() && !now.Before(lim.Reset)) {
+		return true
+	}
+	if lim.Remaining <= 0 {
+		return false
+	}
+	if l.headroom > 0 && lim.Limit > 0 {
+		return float64(lim.Remaining)/float64(lim.Limit) >= l.headroom
+	}
+	return true
+}
+
+// preferAvailable moves routes whose provider is out of rate-limit
+// headroom, or whose target is cooling down after repeated failures, to the
+// end, keeping the order otherwise. Those routes stay in the chain as a
+// last resort.
+func (r *Router) preferAvailable(routes []Route) []Route {
+	if len(routes) < 2 {
+		return routes
+	}
+	now := r.now()
+	ok := make([]bool, len(routes))
+	for i, rt := range routes {
+		ok[i] = r.limits.hasHeadroom(rt.Provider.Name) && !r.cooldown.cooling(rt.Provider.Name, rt.Model, now)
+	}
+	idx := make([]int, len(routes))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return ok[idx[a]] && !ok[idx[b]] })
+	out := make([]Route, len(routes))
+	for i, j := range idx {
+		out[i] = routes[j]
+	}
+	return out
+}
+
+// RateLimits returns a snapshot of the observed rate-limit state, keyed by
+// provider name.
+func (r *Router) RateLimits() map[string]ProviderLimits {
+	r.limits.mu.Lock()
+	defer r.limits.mu.Unlock()
+	out := make(map[string]ProviderLimits, len(r.limits.providers))
+	for name, p := range r.limits.providers {
+		out[name] = *p
+	}
+	return out
+}
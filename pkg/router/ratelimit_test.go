@@ -0,0 +1,128 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/config"
+)
+
+func fallbackConfig(headroom float64) *config.Config {
+	return &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "openai", URL: "https://api.openai.com"},
+			{Name: "anthropic", URL: "https://api.anthropic.com", Type: "anthropic"},
+		},
+		Router: config.RouterConfig{
+			RateLimitHeadroom: headroom,
+			Routes: []config.RouteConfig{{
+				Model: "fast",
+				Targets: []config.RouteTarget{
+					{Provider: "openai", Model: "gpt-4o-mini"},
+					{Provider: "anthropic", Model: "claude-haiku-4-5"},
+				},
+			}},
+		},
+	}
+}
+
+func firstProvider(t *testing.T, r *Router) string {
+	t.Helper()
+	routes, err := r.Resolve("fast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("expected limited routes kept as fallback, got %d", len(routes))
+	}
+	return routes[0].Provider.Name
+}
+
+func TestParseLimit(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header http.Header
+		want   *Limit
+	}{
+		{"none", http.Header{}, nil},
+		{"openai", http.Header{
+			"X-Ratelimit-Limit-Tokens":     {"10000"},
+			"X-Ratelimit-Remaining-Tokens": {"250"},
+			"X-Ratelimit-Reset-Tokens":     {"6m0s"},
+		}, &Limit{Limit: 10000, Remaining: 250, Reset: now.Add(6 * time.Minute)}},
+		{"anthropic", http.Header{
+			"Anthropic-Ratelimit-Tokens-Limit":     {"80000"},
+			"Anthropic-Ratelimit-Tokens-Remaining": {"0"},
+			"Anthropic-Ratelimit-Tokens-Reset":     {"2026-01-01T00:00:30Z"},
+		}, &Limit{Limit: 80000, Remaining: 0, Reset: now.Add(30 * time.Second)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseLimit(tt.header, now,
+				"x-ratelimit-limit-tokens", "x-ratelimit-remaining-tokens", "x-ratelimit-reset-tokens",
+				"anthropic-ratelimit-tokens-limit", "anthropic-ratelimit-tokens-remaining", "anthropic-ratelimit-tokens-reset")
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			if got != nil && (got.Limit != tt.want.Limit || got.Remaining != tt.want.Remaining || !got.Reset.Equal(tt.want.Reset)) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreferHeadroom(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := New(fallbackConfig(0))
+	r.limits.now = func() time.Time { return now }
+
+	if got := firstProvider(t, r); got != "openai" {
+		t.Fatalf("expected configured order with no observations, got %s", got)
+	}
+
+	r.Observe("openai", http.StatusOK, http.Header{
+		"X-Ratelimit-Remaining-Requests": {"0"},
+		"X-Ratelimit-Reset-Requests":     {"20s"},
+	})
+	if got := firstProvider(t, r); got != "anthropic" {
+		t.Errorf("expected exhausted provider moved last, got %s first", got)
+	}
+
+	now = now.Add(21 * time.Second)
+	if got := firstProvider(t, r); got != "openai" {
+		t.Errorf("expected provider restored after reset, got %s first", got)
+	}
+}
+
+func TestHeadroomThreshold(t *testing.T) {
+	r := New(fallbackConfig(0.1))
+	r.Observe("openai", http.StatusOK, http.Header{
+		"X-Ratelimit-Limit-Tokens":     {"10000"},
+		"X-Ratelimit-Remaining-Tokens": {"500"},
+		"X-Ratelimit-Reset-Tokens":     {"1m"},
+	})
+	if got := firstProvider(t, r); got != "anthropic" {
+		t.Errorf("expected provider under 10%% headroom moved last, got %s first", got)
+	}
+}
+
+func TestObserve429(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := New(fallbackConfig(0))
+	r.limits.now = func() time.Time { return now }
+
+	r.Observe("openai", http.StatusTooManyRequests, http.Header{"Retry-After": {"5"}})
+	if got := firstProvider(t, r); got != "anthropic" {
+		t.Errorf("expected 429'd provider moved last, got %s first", got)
+	}
+	if lim := r.RateLimits()["openai"]; !lim.LimitedUntil.Equal(now.Add(5 * time.Second)) {
+		t.Errorf("expected limited until +5s, got %v", lim.LimitedUntil)
+	}
+
+	now = now.Add(6 * time.Second)
+	if got := firstProvider(t, r); got != "openai" {
+		t.Errorf("expected provider restored after Retry-After, got %s first", got)
+	}
+}
@@ -1,64 +1,336 @@
 package router
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/pario-ai/pario/pkg/config"
 )
 
+// ErrUnmatched is returned for a model no route matches when
+// router.unmatched is "reject".
+var ErrUnmatched = errors.New("no route for model")
+
 // Route represents a resolved provider and model to try.
 type Route struct {
 	Provider config.ProviderConfig
 	Model    string
+	// ContextWindow is the model's context window in tokens (0 = unknown).
+	ContextWindow int
+	// OnOverflow is how a request too large for ContextWindow is handled.
+	OnOverflow string
+	// Structured and SchemaRetry carry the route's structured_output and
+	// schema_retry settings.
+	Structured  bool
+	SchemaRetry string
+	// Retry is the route's policy for retrying this target.
+	Retry config.RetryConfig
+	// Downgrade marks the target as a route's cheaper choice for keys near
+	// their budget.
+	Downgrade bool
+	// Alias is the model of the configured route the target belongs to,
+	// which may be a pattern; empty without a configured route. Sticky
+	// marks targets of routes that pin sessions.
+	Alias  string
+	Sticky bool
+	// Params are the request parameters enforced for the target: the
+	// route's, overridden by the target's own.
+	Params config.ParamsConfig
+}
+
+// Hints describe the request being routed, for the rules that depend on
+// more than its model.
+type Hints struct {
+	// PromptTokens and CompletionTokens estimate the request's size, used
+	// to cost targets for strategy "cheapest". CompletionTokens is the
+	// expected completion, such as the request's max_tokens; zero assumes
+	// defaultCompletionTokens.
+	PromptTokens     int
+	CompletionTokens int
+	// Downgrade prefers the route's downgrade targets, for a key past a
+	// budget policy's downgrade_at. DowngradeOnly leaves out the other
+	// targets, for a key over a policy with action downgrade.
+	Downgrade     bool
+	DowngradeOnly bool
+	// Session identifies the client session the request belongs to, for
+	// sticky routes. Empty for requests outside a session.
+	Session string
 }
 
 // Router resolves requested model names to ordered provider+model chains.
 type Router struct {
+	mu  sync.RWMutex
 	cfg *config.Config
+	// patterns holds the compiled model patterns of cfg's routes.
+	patterns map[string]*regexp.Regexp
+	limits   *rateLimits
+	latency  *latencies
+	pins     *pins
+	cooldown *cooldowns
+	now      func() time.Time
 }
 
 // New creates a Router from the given configuration.
 func New(cfg *config.Config) *Router {
-	return &Router{cfg: cfg}
+	return &Router{cfg: cfg, patterns: compilePatterns(cfg), limits: newRateLimits(cfg.Router.RateLimitHeadroom), latency: newLatencies(), pins: newPins(), cooldown: newCooldowns(), now: time.Now}
 }
 
 // Resolve returns an ordered list of routes for the requested model.
-// If the model matches a configured route, the route's targets are returned.
-// Otherwise, the first provider is used with the original model name.
+// If the model matches a configured route, the route's targets are returned;
+// a route naming the model wins over routes with a matching pattern.
+// Routes with strategy "latency" are ordered by observed target latency,
+// and routes with strategy "cheapest" by the cost of a request of unknown
+// size. Targets outside their schedule are left out, and targets that are
+// cooling down after repeated failures or whose provider is out of
+// rate-limit headroom are moved to the end. Models no route matches go to
+// the catch-all route "*" if there is one; otherwise the first provider is
+// used with the original model name, or with router.unmatched "reject",
+// ErrUnmatched is returned.
 func (r *Router) Resolve(requestedModel string) ([]Route, error) {
-	if len(r.cfg.Providers) == 0 {
-		return nil, fmt.Errorf("no providers configured")
+	return r.ResolveFor(requestedModel, Hints{})
+}
+
+// ResolveFor is Resolve with hints about the request: routes with strategy
+// "cheapest" are costed for its size, sticky routes put the target its
+// session is pinned to first, and with Downgrade set the route's downgrade
+// targets are moved to the front. DowngradeOnly keeps only them.
+func (r *Router) ResolveFor(requestedModel string, hints Hints) ([]Route, error) {
+	p, err := r.Plan(requestedModel, hints)
+	return p.Routes, err
+}
+
+// Plan explains how a model resolves: the route it matched and the targets
+// left out of the chain, besides the chain itself.
+type Plan struct {
+	// Route is the configured route the model matched; its Model is empty
+	// when no route matched.
+	Route config.RouteConfig
+	// Routes is the chain ResolveFor returns.
+	Routes []Route
+	// Skipped lists the route's targets that are not in Routes.
+	Skipped []SkippedTarget
+}
+
+// SkippedTarget is a route target left out of a chain, and why.
+type SkippedTarget struct {
+	Provider string
+	Model    string
+	Reason   string
+}
+
+// Reasons a route target is left out of a chain.
+const (
+	SkipUnknownProvider = "unknown provider"
+	SkipOffSchedule     = "outside its schedule"
+	SkipNotDowngrade    = "not a downgrade target; key over budget"
+)
+
+// Plan is ResolveFor, reporting the matched route and skipped targets too.
+// It is meant for explaining routing; the proxy uses ResolveFor.
+func (r *Router) Plan(requestedModel string, hints Hints) (Plan, error) {
+	r.mu.RLock()
+	cfg, patterns := r.cfg, r.patterns
+	r.mu.RUnlock()
+
+	if len(cfg.Providers) == 0 {
+		return Plan{}, fmt.Errorf("no providers configured")
 	}
 
 	// Build provider index by name
-	providerIndex := make(map[string]config.ProviderConfig, len(r.cfg.Providers))
-	for _, p := range r.cfg.Providers {
+	providerIndex := make(map[string]config.ProviderConfig, len(cfg.Providers))
+	for _, p := range cfg.Providers {
 		providerIndex[p.Name] = p
 	}
 
-	// Check configured routes
-	for _, route := range r.cfg.Router.Routes {
-		if route.Model != requestedModel {
-			continue
-		}
+	if route, ok := matchRoute(cfg, patterns, requestedModel); ok {
+		plan := Plan{Route: route}
 		var routes []Route
+		var offSchedule, notDowngrade int
 		for _, target := range route.Targets {
-			provider, ok := providerIndex[target.Provider]
-			if !ok {
-				continue // skip unknown providers
-			}
 			model := target.Model
 			if model == "" {
 				model = requestedModel
 			}
-			routes = append(routes, Route{Provider: provider, Model: model})
+			provider, ok := providerIndex[target.Provider]
+			if !ok {
+				plan.Skipped = append(plan.Skipped, SkippedTarget{target.Provider, model, SkipUnknownProvider})
+				continue
+			}
+			if !r.scheduled(target, cfg) {
+				plan.Skipped = append(plan.Skipped, SkippedTarget{target.Provider, model, SkipOffSchedule})
+				offSchedule++
+				continue
+			}
+			if hints.DowngradeOnly && !target.Downgrade {
+				plan.Skipped = append(plan.Skipped, SkippedTarget{target.Provider, model, SkipNotDowngrade})
+				notDowngrade++
+				continue
+			}
+			window := target.ContextWindow
+			if window == 0 {
+				window = cfg.Router.ContextWindows[model]
+			}
+			routes = append(routes, Route{
+				Provider:      provider,
+				Model:         model,
+				ContextWindow: window,
+				OnOverflow:    overflowMode(route.OnOverflow, cfg),
+				Structured:    route.StructuredOutput,
+				SchemaRetry:   route.SchemaRetry,
+				Retry:         route.Retry,
+				Downgrade:     target.Downgrade,
+				Alias:         route.Model,
+				Sticky:        route.Sticky,
+				Params:        route.Params.Override(target.Params),
+			})
+		}
+		if len(routes) == 0 && notDowngrade > 0 {
+			return plan, fmt.Errorf("route %q: no downgrade target available", requestedModel)
+		}
+		if len(routes) == 0 && offSchedule > 0 {
+			return plan, fmt.Errorf("route %q: no target scheduled at this time", requestedModel)
 		}
 		if len(routes) == 0 {
-			return nil, fmt.Errorf("route %q: all providers unknown", requestedModel)
+			return plan, fmt.Errorf("route %q: all providers unknown", requestedModel)
+		}
+		switch route.Strategy {
+		case config.StrategyLatency:
+			routes = r.byLatency(routes)
+		case config.StrategyCheapest:
+			routes = byCost(routes, cfg, hints)
+		}
+		if route.Sticky && hints.Session != "" {
+			routes = r.preferPinned(routes, hints.Session, route.Model)
 		}
-		return routes, nil
+		if hints.Downgrade {
+			routes = preferDowngrade(routes)
+		}
+		plan.Routes = r.preferAvailable(routes)
+		return plan, nil
+	}
+
+	if hints.DowngradeOnly {
+		return Plan{}, fmt.Errorf("model %q: no route with downgrade targets", requestedModel)
+	}
+	if cfg.Router.Unmatched == config.UnmatchedReject {
+		return Plan{}, fmt.Errorf("%w %q", ErrUnmatched, requestedModel)
 	}
 
 	// No matching route — default to first provider
-	return []Route{{Provider: r.cfg.Providers[0], Model: requestedModel}}, nil
+	return Plan{Routes: []Route{{
+		Provider:      cfg.Providers[0],
+		Model:         requestedModel,
+		ContextWindow: cfg.Router.ContextWindows[requestedModel],
+		OnOverflow:    overflowMode("", cfg),
+	}}}, nil
+}
+
+// Downgradable reports whether the route model resolves to has a downgrade
+// target available now, so a key over a budget policy with action
+// downgrade can be rerouted instead of blocked.
+func (r *Router) Downgradable(model string) bool {
+	plan, err := r.Plan(model, Hints{DowngradeOnly: true})
+	return err == nil && len(plan.Routes) > 0
+}
+
+// preferDowngrade moves downgrade targets to the front, keeping the order
+// within each group. Routes without any are unchanged.
+func preferDowngrade(routes []Route) []Route {
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].Downgrade && !routes[j].Downgrade
+	})
+	return routes
+}
+
+// scheduled reports whether a target may be used now: it has no schedule,
+// or one of its windows is open.
+func (r *Router) scheduled(target config.RouteTarget, cfg *config.Config) bool {
+	if len(target.Schedule) == 0 {
+		return true
+	}
+	loc, err := cfg.Location()
+	if err != nil {
+		loc = time.UTC
+	}
+	now := r.now()
+	for _, w := range target.Schedule {
+		if w.Contains(now, loc) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRoute returns the route for a requested model: the route naming it,
+// or else the first route whose pattern matches it, or else the catch-all
+// route.
+func matchRoute(cfg *config.Config, patterns map[string]*regexp.Regexp, model string) (config.RouteConfig, bool) {
+	for _, route := range cfg.Router.Routes {
+		if route.Model == model && !route.IsPattern() {
+			return route, true
+		}
+	}
+	for _, route := range cfg.Router.Routes {
+		if route.IsCatchAll() {
+			continue
+		}
+		if re := patterns[route.Model]; re != nil && re.MatchString(model) {
+			return route, true
+		}
+	}
+	for _, route := range cfg.Router.Routes {
+		if route.IsCatchAll() {
+			return route, true
+		}
+	}
+	return config.RouteConfig{}, false
+}
+
+// compilePatterns compiles the model patterns of cfg's routes, keyed by
+// pattern. Invalid patterns, which config validation rejects, are left
+// out and so never match.
+func compilePatterns(cfg *config.Config) map[string]*regexp.Regexp {
+	patterns := make(map[string]*regexp.Regexp)
+	for _, route := range cfg.Router.Routes {
+		if !route.IsPattern() {
+			continue
+		}
+		if re, err := route.ModelPattern(); err == nil {
+			patterns[route.Model] = re
+		}
+	}
+	return patterns
+}
+
+func overflowMode(mode string, cfg *config.Config) string {
+	if mode == "" {
+		mode = cfg.Router.OnOverflow
+	}
+	if mode == "" {
+		mode = config.OverflowReject
+	}
+	return mode
+}
+
+// Config returns the config routes are currently resolved against. Callers
+// must not modify it.
+func (r *Router) Config() *config.Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cfg
+}
+
+// Update swaps in the routes and providers of cfg. Requests already holding
+// a resolved chain keep it; rate-limit, latency, and failure observations
+// and session pins are kept.
+func (r *Router) Update(cfg *config.Config) {
+	patterns := compilePatterns(cfg)
+	r.mu.Lock()
+	r.cfg, r.patterns = cfg, patterns
+	r.mu.Unlock()
+	r.limits.setHeadroom(cfg.Router.RateLimitHeadroom)
 }
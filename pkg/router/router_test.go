@@ -1,7 +1,9 @@
 package router
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/pario-ai/pario/pkg/config"
 )
@@ -144,3 +146,249 @@ func TestResolveNoProviders(t *testing.T) {
 		t.Fatal("expected error for no providers")
 	}
 }
+
+func TestResolvePatterns(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "openai", URL: "https://api.openai.com", APIKey: "sk-1"},
+			{Name: "azure", URL: "https://example.openai.azure.com", APIKey: "sk-2"},
+			{Name: "anthropic", URL: "https://api.anthropic.com", APIKey: "sk-3"},
+		},
+		Router: config.RouterConfig{
+			Routes: []config.RouteConfig{
+				{Model: "gpt-4*", Targets: []config.RouteTarget{{Provider: "azure"}, {Provider: "openai"}}},
+				{Model: "~^claude-3.*", Targets: []config.RouteTarget{{Provider: "anthropic"}}},
+				{Model: "gpt-4o-mini", Targets: []config.RouteTarget{{Provider: "openai"}}},
+				{Model: "o?-mini", Targets: []config.RouteTarget{{Provider: "openai", Model: "o3-mini"}}},
+			},
+		},
+	}
+	tests := []struct {
+		model, provider, upstream string
+	}{
+		{"gpt-4o-2024-08-06", "azure", "gpt-4o-2024-08-06"},
+		{"gpt-4o-mini", "openai", "gpt-4o-mini"}, // exact route wins over an earlier pattern
+		{"claude-3-5-sonnet-20241022", "anthropic", "claude-3-5-sonnet-20241022"},
+		{"o1-mini", "openai", "o3-mini"},
+		{"gpt-3.5-turbo", "openai", "gpt-3.5-turbo"}, // no match: first provider
+		{"my-gpt-4", "openai", "my-gpt-4"},           // globs match whole names
+	}
+	r := New(cfg)
+	for _, tt := range tests {
+		routes, err := r.Resolve(tt.model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if routes[0].Provider.Name != tt.provider || routes[0].Model != tt.upstream {
+			t.Errorf("%s: got %s/%s, want %s/%s", tt.model, routes[0].Provider.Name, routes[0].Model, tt.provider, tt.upstream)
+		}
+	}
+}
+
+func TestResolveCatchAll(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "openai", URL: "https://api.openai.com", APIKey: "sk-1"},
+			{Name: "azure", URL: "https://example.openai.azure.com", APIKey: "sk-2"},
+			{Name: "anthropic", URL: "https://api.anthropic.com", APIKey: "sk-3"},
+		},
+		Router: config.RouterConfig{
+			Routes: []config.RouteConfig{
+				// Listed first, but matched only after every other route.
+				{Model: "*", Targets: []config.RouteTarget{{Provider: "azure"}, {Provider: "openai", Model: "gpt-4o-mini"}}},
+				{Model: "claude-*", Targets: []config.RouteTarget{{Provider: "anthropic"}}},
+				{Model: "fast", Targets: []config.RouteTarget{{Provider: "openai", Model: "gpt-4o-mini"}}},
+			},
+		},
+	}
+	tests := []struct {
+		model, provider, upstream string
+	}{
+		{"fast", "openai", "gpt-4o-mini"},
+		{"claude-haiku-4-5", "anthropic", "claude-haiku-4-5"},
+		{"gpt-4o", "azure", "gpt-4o"},
+		{"gtp-4o", "azure", "gtp-4o"},
+	}
+	r := New(cfg)
+	for _, tt := range tests {
+		routes, err := r.Resolve(tt.model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if routes[0].Provider.Name != tt.provider || routes[0].Model != tt.upstream {
+			t.Errorf("%s: got %s/%s, want %s/%s", tt.model, routes[0].Provider.Name, routes[0].Model, tt.provider, tt.upstream)
+		}
+	}
+	routes, _ := r.Resolve("gpt-4o")
+	if len(routes) != 2 || routes[1].Model != "gpt-4o-mini" {
+		t.Errorf("expected catch-all chain, got %+v", routes)
+	}
+
+	// With unmatched: reject, the catch-all still takes unmatched models.
+	cfg.Router.Unmatched = config.UnmatchedReject
+	r.Update(cfg)
+	if _, err := r.Resolve("gtp-4o"); err != nil {
+		t.Errorf("expected catch-all to win over reject, got %v", err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "batchy", URL: "https://batch.example.com", APIKey: "sk-1"},
+			{Name: "openai", URL: "https://api.openai.com", APIKey: "sk-2"},
+		},
+		Router: config.RouterConfig{
+			Routes: []config.RouteConfig{
+				{Model: "bulk", Targets: []config.RouteTarget{
+					{Provider: "batchy", Model: "cheap", Schedule: []config.TimeWindow{{From: "00:00", To: "06:00"}}},
+					{Provider: "gone"},
+					{Provider: "openai", Model: "gpt-4o-mini"},
+				}},
+			},
+		},
+	}
+	r := New(cfg)
+	r.now = func() time.Time { return time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC) }
+
+	plan, err := r.Plan("bulk", Hints{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Route.Model != "bulk" || len(plan.Routes) != 1 || plan.Routes[0].Provider.Name != "openai" {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+	want := []SkippedTarget{
+		{"batchy", "cheap", SkipOffSchedule},
+		{"gone", "bulk", SkipUnknownProvider},
+	}
+	if len(plan.Skipped) != len(want) {
+		t.Fatalf("skipped = %+v, want %+v", plan.Skipped, want)
+	}
+	for i := range want {
+		if plan.Skipped[i] != want[i] {
+			t.Errorf("skipped[%d] = %+v, want %+v", i, plan.Skipped[i], want[i])
+		}
+	}
+
+	plan, err = r.Plan("gpt-4", Hints{})
+	if err != nil || plan.Route.Model != "" || plan.Routes[0].Provider.Name != "batchy" {
+		t.Errorf("expected unmatched model on the first provider, got %+v, %v", plan, err)
+	}
+}
+
+func TestResolveUnmatchedReject(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "openai", URL: "https://api.openai.com", APIKey: "sk-1"},
+		},
+		Router: config.RouterConfig{
+			Unmatched: config.UnmatchedReject,
+			Routes: []config.RouteConfig{
+				{Model: "fast", Targets: []config.RouteTarget{{Provider: "openai", Model: "gpt-4o-mini"}}},
+			},
+		},
+	}
+	r := New(cfg)
+	if _, err := r.Resolve("fast"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := r.Resolve("gtp-4o")
+	if !errors.Is(err, ErrUnmatched) {
+		t.Errorf("expected ErrUnmatched, got %v", err)
+	}
+}
+
+func TestResolveSchedule(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "batchy", URL: "https://batch.example.com", APIKey: "sk-1"},
+			{Name: "openai", URL: "https://api.openai.com", APIKey: "sk-2"},
+		},
+		Router: config.RouterConfig{
+			Routes: []config.RouteConfig{
+				{Model: "bulk", Targets: []config.RouteTarget{
+					{Provider: "batchy", Model: "cheap", Schedule: []config.TimeWindow{{From: "00:00", To: "06:00"}}},
+					{Provider: "openai", Model: "gpt-4o-mini"},
+				}},
+				{Model: "night-only", Targets: []config.RouteTarget{
+					{Provider: "batchy", Model: "cheap", Schedule: []config.TimeWindow{{From: "00:00", To: "06:00"}}},
+				}},
+			},
+		},
+	}
+	r := New(cfg)
+
+	r.now = func() time.Time { return time.Date(2026, 1, 5, 3, 0, 0, 0, time.UTC) }
+	routes, err := r.Resolve("bulk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || routes[0].Model != "cheap" {
+		t.Errorf("expected scheduled target first during its window, got %+v", routes)
+	}
+
+	r.now = func() time.Time { return time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC) }
+	routes, err = r.Resolve("bulk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 || routes[0].Model != "gpt-4o-mini" {
+		t.Errorf("expected scheduled target skipped outside its window, got %+v", routes)
+	}
+	if _, err := r.Resolve("night-only"); err == nil {
+		t.Error("expected error when no target is scheduled")
+	}
+}
+
+func TestResolveDowngrade(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "anthropic", URL: "https://api.anthropic.com", APIKey: "sk-1"},
+		},
+		Router: config.RouterConfig{
+			Routes: []config.RouteConfig{{Model: "smart", Targets: []config.RouteTarget{
+				{Provider: "anthropic", Model: "claude-sonnet-4-5"},
+				{Provider: "anthropic", Model: "claude-haiku-4-5", Downgrade: true},
+			}}},
+		},
+	}
+	r := New(cfg)
+	tests := []struct {
+		downgrade bool
+		want      []string
+	}{
+		{false, []string{"claude-sonnet-4-5", "claude-haiku-4-5"}},
+		{true, []string{"claude-haiku-4-5", "claude-sonnet-4-5"}},
+	}
+	for _, tt := range tests {
+		routes, err := r.ResolveFor("smart", Hints{Downgrade: tt.downgrade})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(routes) != 2 || routes[0].Model != tt.want[0] || routes[1].Model != tt.want[1] {
+			t.Errorf("downgrade=%v: got %+v, want %v", tt.downgrade, routes, tt.want)
+		}
+	}
+
+	plan, err := r.Plan("smart", Hints{DowngradeOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Routes) != 1 || plan.Routes[0].Model != "claude-haiku-4-5" {
+		t.Errorf("downgrade only: got %+v, want claude-haiku-4-5 alone", plan.Routes)
+	}
+	if len(plan.Skipped) != 1 || plan.Skipped[0].Reason != SkipNotDowngrade {
+		t.Errorf("downgrade only: skipped %+v", plan.Skipped)
+	}
+
+	cfg.Router.Routes = append(cfg.Router.Routes, config.RouteConfig{Model: "fast", Targets: []config.RouteTarget{
+		{Provider: "anthropic", Model: "claude-haiku-4-5"},
+	}})
+	r = New(cfg)
+	for model, want := range map[string]bool{"smart": true, "fast": false, "unrouted": false} {
+		if got := r.Downgradable(model); got != want {
+			t.Errorf("Downgradable(%q) = %v, want %v", model, got, want)
+		}
+	}
+}
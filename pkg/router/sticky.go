@@ -0,0 +1,78 @@
+package router
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultStickyTTL is how long an idle session keeps its pin when
+// session.gap_timeout is unset.
+const defaultStickyTTL = 30 * time.Minute
+
+type pinKey struct{ session, route string }
+
+// pin is the target a session's requests for one route go to.
+type pin struct {
+	provider, model string
+	lastUsed        time.Time
+}
+
+// pins holds the targets sessions are pinned to on sticky routes. A pin
+// lasts until its session has been idle for the session gap timeout.
+type pins struct {
+	mu        sync.Mutex
+	pins      map[pinKey]pin
+	lastSweep time.Time
+}
+
+func newPins() *pins {
+	return &pins{pins: make(map[pinKey]pin)}
+}
+
+func (r *Router) stickyTTL() time.Duration {
+	if ttl := r.Config().Session.GapTimeout; ttl > 0 {
+		return ttl
+	}
+	return defaultStickyTTL
+}
+
+// Pin records that rt served a request of session, so the session's later
+// requests to the same route try rt first. It does nothing for routes
+// without sticky or requests outside a session.
+func (r *Router) Pin(session string, rt Route) {
+	if !rt.Sticky || session == "" {
+		return
+	}
+	now, ttl := r.now(), r.stickyTTL()
+	p := r.pins
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pins[pinKey{session, rt.Alias}] = pin{provider: rt.Provider.Name, model: rt.Model, lastUsed: now}
+	if now.Sub(p.lastSweep) >= ttl {
+		for k, v := range p.pins {
+			if now.Sub(v.lastUsed) >= ttl {
+				delete(p.pins, k)
+			}
+		}
+		p.lastSweep = now
+	}
+}
+
+// preferPinned moves the target session is pinned to for route alias to
+// the front. The other targets stay behind it as fallbacks.
+func (r *Router) preferPinned(routes []Route, session, alias string) []Route {
+	p := r.pins
+	p.mu.Lock()
+	pn, ok := p.pins[pinKey{session, alias}]
+	p.mu.Unlock()
+	if !ok || r.now().Sub(pn.lastUsed) >= r.stickyTTL() {
+		return routes
+	}
+	for i, rt := range routes {
+		if rt.Provider.Name == pn.provider && rt.Model == pn.model {
+			out := append([]Route{rt}, routes[:i]...)
+			return append(out, routes[i+1:]...)
+		}
+	}
+	return routes
+}
@@ -0,0 +1,66 @@
+package router
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStickySessions(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := latencyConfig()
+	cfg.Router.Routes[0].Sticky = true
+	cfg.Session.GapTimeout = 10 * time.Minute
+	r := New(cfg)
+	r.now = func() time.Time { return now }
+	r.latency.now = r.now
+
+	first := func(session string) string {
+		t.Helper()
+		routes, err := r.ResolveFor("fast", Hints{Session: session})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(routes) != 2 {
+			t.Fatalf("expected pinned target's fallbacks kept, got %d routes", len(routes))
+		}
+		return routes[0].Provider.Name
+	}
+
+	routes, _ := r.ResolveFor("fast", Hints{Session: "a"})
+	r.Pin("a", routes[1]) // anthropic served, e.g. after openai failed
+	r.ObserveLatency("openai", "gpt-4o-mini", 10*time.Millisecond)
+	r.ObserveLatency("anthropic", "claude-haiku-4-5", time.Second)
+
+	if got := first("a"); got != "anthropic" {
+		t.Errorf("pinned session: got %s first, want anthropic", got)
+	}
+	if got := first("b"); got != "openai" {
+		t.Errorf("other session: got %s first, want the faster openai", got)
+	}
+	if got := first(""); got != "openai" {
+		t.Errorf("no session: got %s first, want openai", got)
+	}
+
+	now = now.Add(10 * time.Minute)
+	r.ObserveLatency("openai", "gpt-4o-mini", 10*time.Millisecond)
+	r.ObserveLatency("anthropic", "claude-haiku-4-5", time.Second)
+	if got := first("a"); got != "openai" {
+		t.Errorf("expired pin: got %s first, want openai", got)
+	}
+}
+
+func TestPinIgnoredWithoutSticky(t *testing.T) {
+	r := New(fallbackConfig(0))
+	routes, err := r.ResolveFor("fast", Hints{Session: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Pin("a", routes[1])
+	if got := firstProvider(t, r); got != "openai" {
+		t.Errorf("expected configured order, got %s first", got)
+	}
+	routes, _ = r.ResolveFor("fast", Hints{Session: "a"})
+	if routes[0].Provider.Name != "openai" {
+		t.Errorf("non-sticky route pinned to %s", routes[0].Provider.Name)
+	}
+}
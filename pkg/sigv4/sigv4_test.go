@@ -0,0 +1,90 @@
+package sigv4
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Vectors from the AWS Signature Version 4 test suite.
+func TestSign(t *testing.T) {
+	creds := Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			name: "get-vanilla",
+			url:  "https://example.amazonaws.com/",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name: "get-vanilla-query-order-key-case",
+			url:  "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			Sign(req, creds, "us-east-1", "service", EmptyPayloadHash, now)
+			if got := req.Header.Get("Authorization"); got != tt.want {
+				t.Errorf("Authorization =\n%s\nwant\n%s", got, tt.want)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %q", got)
+			}
+		})
+	}
+}
+
+func TestSignSessionToken(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	Sign(req, Credentials{AccessKeyID: "a", SecretAccessKey: "b", SessionToken: "tok"}, "us-east-1", "s3", EmptyPayloadHash, time.Now())
+	if req.Header.Get("X-Amz-Security-Token") != "tok" {
+		t.Error("expected security token header")
+	}
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, "SignedHeaders=host;x-amz-date;x-amz-security-token") {
+		t.Errorf("session token not signed: %s", got)
+	}
+}
+
+func TestPayloadHash(t *testing.T) {
+	if got := PayloadHash(nil); got != EmptyPayloadHash {
+		t.Errorf("PayloadHash(nil) = %s", got)
+	}
+}
+
+func TestCanonicalPath(t *testing.T) {
+	tests := []struct {
+		url    string
+		double bool
+		want   string
+	}{
+		{"https://example.com", false, "/"},
+		{"https://example.com/bucket/a%20b.txt", false, "/bucket/a%20b.txt"},
+		{"https://example.com/model/claude-v2%3A1/invoke", false, "/model/claude-v2%3A1/invoke"},
+		{"https://example.com/model/claude-v2%3A1/invoke", true, "/model/claude-v2%253A1/invoke"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := canonicalPath(u, tt.double); got != tt.want {
+			t.Errorf("canonicalPath(%q, %v) = %q, want %q", tt.url, tt.double, got, tt.want)
+		}
+	}
+}
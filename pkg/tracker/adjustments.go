@@ -0,0 +1,90 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+const createAdjustmentsTable = `
+CREATE TABLE IF NOT EXISTS budget_adjustments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	api_key TEXT NOT NULL DEFAULT '',
+	team TEXT NOT NULL DEFAULT '',
+	project TEXT NOT NULL DEFAULT '',
+	env TEXT NOT NULL DEFAULT '',
+	model TEXT NOT NULL DEFAULT '',
+	tokens INTEGER NOT NULL DEFAULT 0,
+	cost_usd REAL NOT NULL DEFAULT 0,
+	reason TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_budget_adjustments_scope ON budget_adjustments(api_key, team, project, env, model, created_at);
+`
+
+// RecordAdjustment stores a budget ledger entry and returns it with its ID
+// set. A zero CreatedAt is set to now.
+func (t *SQLiteTracker) RecordAdjustment(ctx context.Context, a models.BudgetAdjustment) (models.BudgetAdjustment, error) {
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now().UTC()
+	}
+	res, err := t.db.ExecContext(ctx,
+		`INSERT INTO budget_adjustments (api_key, team, project, env, model, tokens, cost_usd, reason, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.APIKey, a.Team, a.Project, a.Env, a.Model, a.Tokens, a.CostUSD, a.Reason, a.CreatedAt,
+	)
+	if err != nil {
+		return a, fmt.Errorf("record budget adjustment: %w", err)
+	}
+	if a.ID, err = res.LastInsertId(); err != nil {
+		return a, fmt.Errorf("record budget adjustment: %w", err)
+	}
+	t.countAdjustment(ctx, a)
+	return a, nil
+}
+
+// AdjustmentTotal sums the ledger entries made since a given time with
+// exactly the given scope. A non-empty apiKey selects key entries, and
+// otherwise labels select label entries.
+func (t *SQLiteTracker) AdjustmentTotal(ctx context.Context, apiKey string, labels models.CostLabel, model string, since time.Time) (int64, float64, error) {
+	if apiKey != "" && labels == (models.CostLabel{}) {
+		if tokens, usd, ok := t.countedAdjustment(ctx, apiKey, model, since); ok {
+			return tokens, usd, nil
+		}
+	}
+	var tokens int64
+	var usd float64
+	err := t.db.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(tokens), 0), COALESCE(SUM(cost_usd), 0) FROM budget_adjustments
+		 WHERE api_key = ? AND team = ? AND project = ? AND env = ? AND model = ? AND created_at >= ?`,
+		apiKey, labels.Team, labels.Project, labels.Env, model, since,
+	).Scan(&tokens, &usd)
+	if err != nil {
+		return 0, 0, fmt.Errorf("query budget adjustments: %w", err)
+	}
+	return tokens, usd, nil
+}
+
+// Adjustments returns the ledger entries made since a given time, newest
+// first.
+func (t *SQLiteTracker) Adjustments(ctx context.Context, since time.Time) ([]models.BudgetAdjustment, error) {
+	rows, err := t.db.QueryContext(ctx,
+		`SELECT id, api_key, team, project, env, model, tokens, cost_usd, reason, created_at
+		 FROM budget_adjustments WHERE created_at >= ? ORDER BY created_at DESC, id DESC`, since)
+	if err != nil {
+		return nil, fmt.Errorf("query budget adjustments: %w", err)
+	}
+	defer rows.Close()
+
+	var adjustments []models.BudgetAdjustment
+	for rows.Next() {
+		var a models.BudgetAdjustment
+		if err := rows.Scan(&a.ID, &a.APIKey, &a.Team, &a.Project, &a.Env, &a.Model, &a.Tokens, &a.CostUSD, &a.Reason, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan budget adjustment: %w", err)
+		}
+		adjustments = append(adjustments, a)
+	}
+	return adjustments, rows.Err()
+}
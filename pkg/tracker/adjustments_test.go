@@ -0,0 +1,64 @@
+package tracker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestBudgetAdjustments(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	yesterday := now.Add(-24 * time.Hour)
+
+	for _, a := range []models.BudgetAdjustment{
+		{APIKey: "sk-batch", Tokens: -500, Reason: "runaway loop", CreatedAt: now},
+		{APIKey: "sk-batch", Tokens: 100, CostUSD: 1.5, CreatedAt: now},
+		{APIKey: "sk-batch", Tokens: -9000, CreatedAt: yesterday},
+		{APIKey: "sk-batch", Model: "gpt-4", Tokens: -70, CreatedAt: now},
+		{Team: "ml", CostUSD: -20, CreatedAt: now},
+		{Team: "ml", Env: "prod", CostUSD: -5, CreatedAt: now},
+	} {
+		if _, err := tr.RecordAdjustment(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	since := now.Add(-time.Hour)
+	tests := []struct {
+		name   string
+		apiKey string
+		labels models.CostLabel
+		model  string
+		tokens int64
+		usd    float64
+	}{
+		{"key, all models", "sk-batch", models.CostLabel{}, "", -400, 1.5},
+		{"key, one model", "sk-batch", models.CostLabel{}, "gpt-4", -70, 0},
+		{"other key", "sk-other", models.CostLabel{}, "", 0, 0},
+		{"labels match exactly", "", models.CostLabel{Team: "ml"}, "", 0, -20},
+		{"more labels", "", models.CostLabel{Team: "ml", Env: "prod"}, "", 0, -5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, usd, err := tr.AdjustmentTotal(ctx, tt.apiKey, tt.labels, tt.model, since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tokens != tt.tokens || usd != tt.usd {
+				t.Errorf("got %d tokens, $%.2f; want %d, $%.2f", tokens, usd, tt.tokens, tt.usd)
+			}
+		})
+	}
+
+	list, err := tr.Adjustments(ctx, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 5 || list[len(list)-1].Reason != "runaway loop" {
+		t.Errorf("Adjustments = %+v, want 5 entries, oldest last", list)
+	}
+}
@@ -0,0 +1,137 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+const createAnomaliesTable = `
+CREATE TABLE IF NOT EXISTS anomalies (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	dimension TEXT NOT NULL,
+	value TEXT NOT NULL,
+	metric TEXT NOT NULL,
+	window_start DATETIME NOT NULL,
+	window_end DATETIME NOT NULL,
+	observed REAL NOT NULL,
+	median REAL NOT NULL,
+	mean REAL NOT NULL,
+	stddev REAL NOT NULL,
+	z_score REAL NOT NULL,
+	detected_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	UNIQUE (dimension, value, metric, window_start)
+);
+CREATE INDEX IF NOT EXISTS idx_anomalies_window ON anomalies(window_end);
+`
+
+// anomalyColumns maps each dimension anomalies are detected on to its
+// usage_records column.
+var anomalyColumns = map[string]string{
+	models.TopByKey:  "api_key",
+	models.TopByTeam: "team",
+}
+
+// UsageWindows returns the usage of each value of by ("api_key" or
+// "team") and model in consecutive windows of width starting at since,
+// up to now. Windows without usage are left out, as is usage without a
+// team when grouping by team.
+func (t *SQLiteTracker) UsageWindows(ctx context.Context, by string, since time.Time, width time.Duration) ([]models.WindowUsage, error) {
+	col, ok := anomalyColumns[by]
+	if !ok {
+		return nil, fmt.Errorf("usage windows: unknown dimension %q (want api_key or team)", by)
+	}
+	secs := int64(width / time.Second)
+	if secs <= 0 {
+		return nil, fmt.Errorf("usage windows: width must be at least a second")
+	}
+	since = since.UTC().Truncate(time.Second)
+	// Records are stored in UTC; see hourExpr.
+	query := `SELECT w, ` + col + `, model, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), ` + detailSums + `, ` + costSum + `
+		 FROM (SELECT *, (CAST(strftime('%s', substr(created_at, 1, 19)) AS INTEGER) - ?) / ? AS w
+		       FROM usage_records WHERE created_at >= ?`
+	if by == models.TopByTeam {
+		query += ` AND team != ''`
+	}
+	query += `) GROUP BY w, ` + col + `, model ORDER BY w`
+
+	rows, err := t.db.QueryContext(ctx, query, since.Unix(), secs, since)
+	if err != nil {
+		return nil, fmt.Errorf("query usage windows: %w", err)
+	}
+	defer rows.Close()
+
+	var windows []models.WindowUsage
+	for rows.Next() {
+		var u models.WindowUsage
+		var w int64
+		c := &u.Usage
+		if err := rows.Scan(&w, &u.Value, &c.Model, &c.RequestCount, &c.PromptTokens, &c.CompletionTokens, &c.TotalTokens,
+			&c.CacheReadTokens, &c.CacheCreationTokens, &c.ReasoningTokens, &c.EstimatedCost); err != nil {
+			return nil, fmt.Errorf("scan usage window: %w", err)
+		}
+		u.Start = since.Add(time.Duration(w) * width)
+		windows = append(windows, u)
+	}
+	return windows, rows.Err()
+}
+
+// RecordAnomaly stores a detected anomaly. An anomaly already stored for
+// the same value, metric, and window is updated with a's figures and
+// keeps its ID and detection time.
+func (t *SQLiteTracker) RecordAnomaly(ctx context.Context, a models.Anomaly) error {
+	_, err := t.db.ExecContext(ctx,
+		`INSERT INTO anomalies (dimension, value, metric, window_start, window_end, observed, median, mean, stddev, z_score, detected_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(dimension, value, metric, window_start) DO UPDATE SET
+		 window_end = excluded.window_end, observed = excluded.observed, median = excluded.median, mean = excluded.mean,
+		 stddev = excluded.stddev, z_score = excluded.z_score, updated_at = excluded.updated_at`,
+		a.Dimension, a.Value, a.Metric, a.WindowStart.UTC(), a.WindowEnd.UTC(), a.Observed, a.Median, a.Mean, a.StdDev, a.ZScore,
+		a.DetectedAt.UTC(), a.DetectedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert anomaly: %w", err)
+	}
+	return nil
+}
+
+// Anomalies returns stored anomalies matching q, newest window first.
+func (t *SQLiteTracker) Anomalies(ctx context.Context, q models.AnomalyQuery) ([]models.Anomaly, error) {
+	query := `SELECT id, dimension, value, metric, window_start, window_end, observed, median, mean, stddev, z_score, detected_at, updated_at
+		 FROM anomalies WHERE window_end > ?`
+	args := []any{q.Since.UTC()}
+	if q.Dimension != "" {
+		query += ` AND dimension = ?`
+		args = append(args, q.Dimension)
+	}
+	if q.Value != "" {
+		query += ` AND value = ?`
+		args = append(args, q.Value)
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	query += ` ORDER BY window_start DESC, z_score DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query anomalies: %w", err)
+	}
+	defer rows.Close()
+
+	var anomalies []models.Anomaly
+	for rows.Next() {
+		var a models.Anomaly
+		if err := rows.Scan(&a.ID, &a.Dimension, &a.Value, &a.Metric, &a.WindowStart, &a.WindowEnd, &a.Observed,
+			&a.Median, &a.Mean, &a.StdDev, &a.ZScore, &a.DetectedAt, &a.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan anomaly: %w", err)
+		}
+		anomalies = append(anomalies, a)
+	}
+	return anomalies, rows.Err()
+}
@@ -0,0 +1,284 @@
+package tracker
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// AsyncStats reports on the queue of usage records awaiting an async
+// write.
+type AsyncStats struct {
+	Enabled bool `json:"enabled"`
+	// Depth is the number of records queued or being written, out of
+	// Capacity.
+	Depth    int `json:"depth"`
+	Capacity int `json:"capacity"`
+	// Written counts records stored and Batches the transactions that
+	// stored them. Dropped counts records lost to a full queue or a
+	// failed write.
+	Written int64 `json:"written"`
+	Batches int64 `json:"batches"`
+	Dropped int64 `json:"dropped"`
+}
+
+// asyncWriter queues usage records and writes them in batched
+// transactions.
+type asyncWriter struct {
+	t        *SQLiteTracker
+	queue    chan models.UsageRecord
+	interval time.Duration
+	batch    int
+
+	// pending holds the records queued or being written, oldest first,
+	// so budget queries can count them before they are stored. queued
+	// holds the idempotency keys of those that have one, so a record
+	// written twice before it is stored is queued once.
+	mu      sync.Mutex
+	pending []models.UsageRecord
+	queued  map[attemptKey]bool
+
+	written atomic.Int64
+	batches atomic.Int64
+	dropped atomic.Int64
+
+	done     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// UseAsyncWrites makes Record queue records, up to size of them, and
+// write them in transactions of up to batch records every interval
+// rather than one INSERT per call. Records arriving while the queue is
+// full are dropped and counted in AsyncStats. Budget queries still count
+// queued records; other queries see them once written. Close writes what
+// is left. Call it before the tracker is shared.
+func (t *SQLiteTracker) UseAsyncWrites(size, batch int, interval time.Duration) {
+	a := &asyncWriter{
+		t:        t,
+		queue:    make(chan models.UsageRecord, size),
+		interval: interval,
+		batch:    batch,
+		queued:   make(map[attemptKey]bool),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	t.async = a
+	go a.run()
+}
+
+// AsyncStats reports on the async write queue.
+func (t *SQLiteTracker) AsyncStats() AsyncStats {
+	a := t.async
+	if a == nil {
+		return AsyncStats{}
+	}
+	a.mu.Lock()
+	depth := len(a.pending)
+	a.mu.Unlock()
+	return AsyncStats{
+		Enabled:  true,
+		Depth:    depth,
+		Capacity: cap(a.queue),
+		Written:  a.written.Load(),
+		Batches:  a.batches.Load(),
+		Dropped:  a.dropped.Load(),
+	}
+}
+
+// enqueue queues rec, or drops it if the queue is full. A record already
+// queued is ignored.
+func (a *asyncWriter) enqueue(rec models.UsageRecord) {
+	a.mu.Lock()
+	k := attemptKey{rec.RequestID, rec.Attempt}
+	if rec.RequestID != "" && a.queued[k] {
+		a.mu.Unlock()
+		return
+	}
+	if len(a.pending) >= cap(a.queue) {
+		a.mu.Unlock()
+		if n := a.dropped.Add(1); n == 1 || n%1000 == 0 {
+			log.Printf("usage write queue full: %d records dropped", n)
+		}
+		return
+	}
+	a.pending = append(a.pending, rec)
+	if rec.RequestID != "" {
+		a.queued[k] = true
+	}
+	// pending never holds fewer records than the queue, so this never
+	// blocks.
+	a.queue <- rec
+	a.mu.Unlock()
+}
+
+func (a *asyncWriter) run() {
+	defer close(a.stopped)
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	var batch []models.UsageRecord
+	for {
+		select {
+		case rec := <-a.queue:
+			batch = append(batch, rec)
+			if len(batch) >= a.batch {
+				batch = a.write(batch)
+			}
+		case <-ticker.C:
+			batch = a.write(batch)
+		case <-a.done:
+			for {
+				select {
+				case rec := <-a.queue:
+					batch = append(batch, rec)
+				default:
+					a.write(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// write stores batch in one transaction and returns it emptied. If the
+// transaction fails, the records are written one by one, so a record the
+// database rejects loses only itself.
+func (a *asyncWriter) write(batch []models.UsageRecord) []models.UsageRecord {
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx := context.Background()
+	stored, unsampled, err := a.insert(ctx, batch)
+	switch {
+	case err != nil && len(batch) > 1:
+		log.Printf("async usage write: %v; retrying %d records one at a time", err, len(batch))
+		stored, unsampled = a.insertEach(ctx, batch)
+	case err != nil:
+		log.Printf("async usage write: %v", err)
+		a.dropped.Add(1)
+	default:
+		a.written.Add(int64(len(stored) + len(unsampled)))
+		a.batches.Add(1)
+	}
+
+	// Count before leaving pending, so budget queries see the records
+	// twice for a moment rather than not at all.
+	for _, rec := range stored {
+		a.t.stored(ctx, rec)
+	}
+	for _, rec := range unsampled {
+		a.t.countRecord(ctx, rec)
+	}
+	a.mu.Lock()
+	for _, rec := range a.pending[:len(batch)] {
+		delete(a.queued, attemptKey{rec.RequestID, rec.Attempt})
+	}
+	a.pending = slices.Delete(a.pending, 0, len(batch))
+	a.mu.Unlock()
+	return batch[:0]
+}
+
+// insertEach stores each record of batch in a transaction of its own,
+// dropping those that fail, and returns the records insert returns.
+func (a *asyncWriter) insertEach(ctx context.Context, batch []models.UsageRecord) (stored, unsampled []models.UsageRecord) {
+	for _, rec := range batch {
+		s, u, err := a.insert(ctx, []models.UsageRecord{rec})
+		if err != nil {
+			log.Printf("async usage write: dropped record %q attempt %d for %s: %v", rec.RequestID, rec.Attempt, rec.Model, err)
+			a.dropped.Add(1)
+			continue
+		}
+		stored = append(stored, s...)
+		unsampled = append(unsampled, u...)
+		a.written.Add(int64(len(s) + len(u)))
+		a.batches.Add(1)
+	}
+	return stored, unsampled
+}
+
+// insert stores batch in one transaction, returning the records stored as
+// rows that were not duplicates, and those left out by sampling.
+func (a *asyncWriter) insert(ctx context.Context, batch []models.UsageRecord) (stored, unsampled []models.UsageRecord, err error) {
+	tx, err := a.t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmts := a.t.stmts.in(ctx, tx)
+	for _, rec := range batch {
+		if !a.t.keep(rec) {
+			added, err := insertUnsampled(ctx, stmts, rec)
+			if err != nil {
+				return nil, nil, err
+			}
+			if added {
+				unsampled = append(unsampled, rec)
+			}
+			continue
+		}
+		id, err := insertRecord(ctx, stmts, rec)
+		if err != nil {
+			return nil, nil, err
+		}
+		if id != 0 {
+			rec.ID = id
+			stored = append(stored, rec)
+		}
+	}
+	return stored, unsampled, tx.Commit()
+}
+
+// stop writes the queued records and stops the writer.
+func (a *asyncWriter) stop() {
+	a.stopOnce.Do(func() { close(a.done) })
+	<-a.stopped
+}
+
+// pendingSpend returns the queued records keep selects, grouped by model
+// like SpendByKey. It is empty without async writes.
+func (t *SQLiteTracker) pendingSpend(keep func(r *models.UsageRecord) bool) []models.CostReport {
+	if t.async == nil {
+		return nil
+	}
+	t.async.mu.Lock()
+	var recs []models.UsageRecord
+	for i := range t.async.pending {
+		if keep(&t.async.pending[i]) {
+			recs = append(recs, t.async.pending[i])
+		}
+	}
+	t.async.mu.Unlock()
+	return byModel(recs)
+}
+
+// mergeSpend adds the per-model rows of more to rows.
+func mergeSpend(rows, more []models.CostReport) []models.CostReport {
+	if len(more) == 0 {
+		return rows
+	}
+	for _, m := range more {
+		i := slices.IndexFunc(rows, func(r models.CostReport) bool { return r.Model == m.Model })
+		if i < 0 {
+			rows = append(rows, m)
+			continue
+		}
+		rows[i].RequestCount += m.RequestCount
+		rows[i].PromptTokens += m.PromptTokens
+		rows[i].CompletionTokens += m.CompletionTokens
+		rows[i].TotalTokens += m.TotalTokens
+		rows[i].CacheReadTokens += m.CacheReadTokens
+		rows[i].CacheCreationTokens += m.CacheCreationTokens
+		rows[i].ReasoningTokens += m.ReasoningTokens
+		rows[i].EstimatedCost += m.EstimatedCost
+	}
+	slices.SortFunc(rows, func(a, b models.CostReport) int { return cmp.Compare(a.Model, b.Model) })
+	return rows
+}
@@ -0,0 +1,119 @@
+package tracker
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestAsyncWrites(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	tr, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A long interval and large batches keep records queued until Close.
+	tr.UseAsyncWrites(3, 100, time.Hour)
+	now := time.Now().UTC()
+	since := now.Add(-time.Hour)
+
+	for i := range 4 {
+		rec := models.UsageRecord{APIKey: "k1", Model: "gpt-4", TotalTokens: 100, RequestID: "r", Attempt: i, CreatedAt: now}
+		if err := tr.Record(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st := tr.AsyncStats()
+	if !st.Enabled || st.Depth != 3 || st.Capacity != 3 || st.Dropped != 1 || st.Written != 0 {
+		t.Errorf("stats before flush = %+v", st)
+	}
+	// Budget queries count queued records; reports don't yet.
+	if total, _ := tr.TotalByKey(ctx, "k1", since); total != 300 {
+		t.Errorf("TotalByKey = %d, want 300", total)
+	}
+	if total, _ := tr.TotalByKeyAndModel(ctx, "k1", "gpt-4", since); total != 300 {
+		t.Errorf("TotalByKeyAndModel = %d, want 300", total)
+	}
+	spend, _ := tr.SpendByKey(ctx, "k1", "", since)
+	if len(spend) != 1 || spend[0].RequestCount != 3 {
+		t.Errorf("SpendByKey = %+v", spend)
+	}
+	if recs, _ := tr.QueryByKey(ctx, "k1", since); len(recs) != 0 {
+		t.Errorf("QueryByKey before flush = %d records, want 0", len(recs))
+	}
+
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = reopened.Close() }()
+	if total, _ := reopened.TotalByKey(ctx, "k1", since); total != 300 {
+		t.Errorf("TotalByKey after close = %d, want 300", total)
+	}
+	if st := tr.AsyncStats(); st.Depth != 0 || st.Written != 3 || st.Batches != 1 {
+		t.Errorf("stats after close = %+v", st)
+	}
+}
+
+func TestAsyncWritesBatch(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	tr.UseAsyncWrites(10, 2, time.Hour)
+	now := time.Now().UTC()
+
+	for i := range 2 {
+		_ = tr.Record(ctx, models.UsageRecord{APIKey: "k1", Model: "gpt-4", TotalTokens: 10, CreatedAt: now.Add(time.Duration(i))})
+	}
+	// A full batch is written without waiting for the interval.
+	deadline := time.Now().Add(5 * time.Second)
+	for tr.AsyncStats().Written < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("batch not written: %+v", tr.AsyncStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if recs, _ := tr.QueryByKey(ctx, "k1", now.Add(-time.Minute)); len(recs) != 2 {
+		t.Errorf("QueryByKey = %d records, want 2", len(recs))
+	}
+	if total, _ := tr.TotalByKey(ctx, "k1", now.Add(-time.Minute)); total != 20 {
+		t.Errorf("TotalByKey = %d, want 20", total)
+	}
+}
+
+func TestAsyncWritesBadRecord(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	// The trigger stands in for a record the database rejects.
+	if _, err := tr.db.Exec(`CREATE TRIGGER reject_bad BEFORE INSERT ON usage_records
+		WHEN NEW.model = 'bad' BEGIN SELECT RAISE(ABORT, 'malformed record'); END`); err != nil {
+		t.Fatal(err)
+	}
+	tr.UseAsyncWrites(10, 3, time.Hour)
+	now := time.Now().UTC()
+
+	for i, model := range []string{"gpt-4", "bad", "gpt-4"} {
+		_ = tr.Record(ctx, models.UsageRecord{APIKey: "k1", Model: model, TotalTokens: 10, RequestID: "r", Attempt: i, CreatedAt: now})
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for tr.AsyncStats().Depth > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("batch not written: %+v", tr.AsyncStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if st := tr.AsyncStats(); st.Written != 2 || st.Dropped != 1 {
+		t.Errorf("stats = %+v, want 2 written and 1 dropped", st)
+	}
+	if recs, _ := tr.QueryByKey(ctx, "k1", now.Add(-time.Minute)); len(recs) != 2 {
+		t.Errorf("QueryByKey = %d records, want the 2 good ones", len(recs))
+	}
+}
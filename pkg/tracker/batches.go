@@ -0,0 +1,105 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+const createBatchesTable = `
+CREATE TABLE IF NOT EXISTS batch_jobs (
+	id TEXT PRIMARY KEY,
+	provider TEXT NOT NULL,
+	api_key TEXT NOT NULL,
+	endpoint TEXT NOT NULL DEFAULT '',
+	team TEXT NOT NULL DEFAULT '',
+	project TEXT NOT NULL DEFAULT '',
+	env TEXT NOT NULL DEFAULT '',
+	labels TEXT NOT NULL DEFAULT '{}',
+	pipeline TEXT NOT NULL DEFAULT '',
+	branch TEXT NOT NULL DEFAULT '',
+	commit_sha TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	finished_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_batch_jobs_pending ON batch_jobs(finished_at);
+`
+
+// batchColumns lists batch_jobs columns added after the initial schema.
+var batchColumns = []struct{ name, def string }{
+	{"metadata", "TEXT NOT NULL DEFAULT '{}'"},
+}
+
+// RecordBatch stores a submitted batch job. Recording the same batch ID
+// again is a no-op.
+func (t *SQLiteTracker) RecordBatch(ctx context.Context, job models.BatchJob) error {
+	labels, err := encodeLabels(job.Labels)
+	if err != nil {
+		return err
+	}
+	metadata, err := encodeLabels(job.Metadata)
+	if err != nil {
+		return err
+	}
+	_, err = t.db.ExecContext(ctx,
+		`INSERT INTO batch_jobs (id, provider, api_key, endpoint, team, project, env, labels, metadata,
+		 pipeline, branch, commit_sha, status, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(id) DO NOTHING`,
+		job.ID, job.Provider, job.APIKey, job.Endpoint, job.Team, job.Project, job.Env, labels, metadata,
+		job.Pipeline, job.Branch, job.Commit, job.Status, job.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("record batch job: %w", err)
+	}
+	return nil
+}
+
+// PendingBatches returns batch jobs that have not finished, oldest first.
+func (t *SQLiteTracker) PendingBatches(ctx context.Context) ([]models.BatchJob, error) {
+	rows, err := t.db.QueryContext(ctx,
+		`SELECT id, provider, api_key, endpoint, team, project, env, labels, metadata,
+		 pipeline, branch, commit_sha, status, created_at, finished_at
+		 FROM batch_jobs WHERE finished_at IS NULL ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("query batch jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.BatchJob
+	for rows.Next() {
+		var j models.BatchJob
+		var labels, metadata string
+		var finished sql.NullTime
+		if err := rows.Scan(&j.ID, &j.Provider, &j.APIKey, &j.Endpoint, &j.Team, &j.Project, &j.Env, &labels, &metadata,
+			&j.Pipeline, &j.Branch, &j.Commit, &j.Status, &j.CreatedAt, &finished); err != nil {
+			return nil, fmt.Errorf("scan batch job: %w", err)
+		}
+		if labels != "" && labels != "{}" {
+			_ = json.Unmarshal([]byte(labels), &j.Labels)
+		}
+		if metadata != "" && metadata != "{}" {
+			_ = json.Unmarshal([]byte(metadata), &j.Metadata)
+		}
+		if finished.Valid {
+			j.FinishedAt = &finished.Time
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// FinishBatch marks a batch job finished with its terminal status.
+func (t *SQLiteTracker) FinishBatch(ctx context.Context, id, status string, at time.Time) error {
+	_, err := t.db.ExecContext(ctx,
+		`UPDATE batch_jobs SET status = ?, finished_at = ? WHERE id = ?`, status, at, id)
+	if err != nil {
+		return fmt.Errorf("finish batch job: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package tracker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestBatchJobs(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for _, j := range []models.BatchJob{
+		{ID: "batch_1", Provider: "openai", APIKey: "k1", Team: "search", Labels: map[string]string{"tier": "gold"}, Status: "validating", CreatedAt: now.Add(-time.Hour)},
+		{ID: "batch_2", Provider: "openai", APIKey: "k2", Commit: "abc123", Status: "validating", CreatedAt: now},
+		{ID: "batch_1", Provider: "openai", APIKey: "k3", Status: "validating", CreatedAt: now}, // duplicate: ignored
+	} {
+		if err := tr.RecordBatch(ctx, j); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jobs, err := tr.PendingBatches(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("got %d pending jobs, want 2", len(jobs))
+	}
+	if j := jobs[0]; j.ID != "batch_1" || j.APIKey != "k1" || j.Team != "search" || j.Labels["tier"] != "gold" {
+		t.Errorf("jobs[0] = %+v", j)
+	}
+	if j := jobs[1]; j.ID != "batch_2" || j.Commit != "abc123" {
+		t.Errorf("jobs[1] = %+v", j)
+	}
+
+	if err := tr.FinishBatch(ctx, "batch_1", "completed", now); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err = tr.PendingBatches(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != "batch_2" {
+		t.Errorf("pending after finish = %+v", jobs)
+	}
+}
@@ -0,0 +1,351 @@
+package tracker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// CounterStore holds running usage totals shared by every proxy on a
+// tracker database, e.g. in Redis. A counter is a set of named fields.
+type CounterStore interface {
+	// Add increments fields of the counter at key, creating it if needed,
+	// and expires it after ttl.
+	Add(ctx context.Context, key string, fields map[string]float64, ttl time.Duration) error
+	// Get returns the fields of the counter at key and whether it has
+	// been seeded.
+	Get(ctx context.Context, key string) (map[string]float64, bool, error)
+	// Seed marks the counter at key seeded and adds fields to it, unless
+	// it is seeded already. It reports whether it seeded the counter.
+	Seed(ctx context.Context, key string, fields map[string]float64, ttl time.Duration) (bool, error)
+	// Delete removes counters.
+	Delete(ctx context.Context, keys ...string) error
+	// DeletePrefix removes every counter whose key starts with prefix.
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// CounterPeriod is a period usage is counted over, e.g. a key's budget day.
+type CounterPeriod struct {
+	Start, End time.Time
+}
+
+// CounterPeriods returns the periods to count an API key's usage at a
+// given time over.
+type CounterPeriods func(apiKey string, at time.Time) []CounterPeriod
+
+// counters keeps per-key, per-period usage totals in a CounterStore, so
+// TotalByKey, TotalByKeyAndModel, SpendByKey, and key AdjustmentTotal
+// since the start of a counted period read a counter instead of summing
+// usage_records and budget_adjustments.
+type counters struct {
+	store   CounterStore
+	periods CounterPeriods
+}
+
+// counterGrace keeps a counter past the end of its period, for checks
+// that straddle the boundary.
+const counterGrace = time.Hour
+
+// Counter field suffixes, after the model name and counterSep.
+const (
+	counterSep      = "|"
+	fieldRequests   = "n"
+	fieldPrompt     = "p"
+	fieldCompletion = "c"
+	fieldTotal      = "t"
+	fieldCacheRead  = "cr"
+	fieldCacheWrite = "cw"
+	fieldReasoning  = "r"
+	fieldCostUSD    = "usd"
+	fieldAdjTokens  = "at"
+	fieldAdjUSD     = "au"
+)
+
+// counterPrefix starts the store key of every usage counter. It changed
+// when counters began holding each record's stored cost rather than only
+// its media cost, so older counters are seeded again instead of read.
+const counterPrefix = "pario:usage:v2:"
+
+// UseCounters makes the tracker keep running usage totals in store for
+// the periods returned by periods, and answer key usage queries since the
+// start of one from them. A counter missing from the store is seeded from
+// the database on first read. Store errors fall back to the database.
+func (t *SQLiteTracker) UseCounters(store CounterStore, periods CounterPeriods) {
+	t.counters = &counters{store: store, periods: periods}
+}
+
+// counterKey returns the store key of apiKey's counter for the period
+// starting at start. The key is hashed so it isn't stored in the clear.
+func counterKey(apiKey string, start time.Time) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return counterPrefix + hex.EncodeToString(sum[:16]) + ":" + strconv.FormatInt(start.Unix(), 10)
+}
+
+// countRecord adds a stored record to its key's counters. A counter that
+// can't be updated is dropped, to be seeded again from the database.
+func (t *SQLiteTracker) countRecord(ctx context.Context, rec models.UsageRecord) {
+	c := t.counters
+	if c == nil {
+		return
+	}
+	fields := counterFields(models.CostReport{
+		Model:               rec.Model,
+		RequestCount:        1,
+		PromptTokens:        int64(rec.PromptTokens),
+		CompletionTokens:    int64(rec.CompletionTokens),
+		TotalTokens:         int64(rec.TotalTokens),
+		CacheReadTokens:     int64(rec.CacheReadTokens),
+		CacheCreationTokens: int64(rec.CacheCreationTokens),
+		ReasoningTokens:     int64(rec.ReasoningTokens),
+		EstimatedCost:       rec.EstimatedCostUSD,
+	})
+	c.add(ctx, rec.APIKey, rec.CreatedAt, fields)
+}
+
+// countAdjustment adds a stored key ledger entry to the key's counters.
+// Label entries aren't counted.
+func (t *SQLiteTracker) countAdjustment(ctx context.Context, a models.BudgetAdjustment) {
+	c := t.counters
+	if c == nil || a.APIKey == "" || a.Labels() != (models.CostLabel{}) {
+		return
+	}
+	c.add(ctx, a.APIKey, a.CreatedAt, adjustmentFields(a.Model, float64(a.Tokens), a.CostUSD))
+}
+
+// add adds fields to apiKey's counters for the periods containing at that
+// haven't ended. A counter that can't be updated is dropped, to be seeded
+// again from the database.
+func (c *counters) add(ctx context.Context, apiKey string, at time.Time, fields map[string]float64) {
+	now := time.Now()
+	for _, p := range c.periods(apiKey, at) {
+		if !p.End.After(now) {
+			continue
+		}
+		key := counterKey(apiKey, p.Start)
+		if err := c.store.Add(ctx, key, fields, p.End.Sub(now)+counterGrace); err != nil {
+			log.Printf("usage counter: %v", err)
+			_ = c.store.Delete(ctx, key)
+		}
+	}
+}
+
+// countedSpend returns apiKey's usage since a given time grouped by
+// model from its counter, if since starts a counted period. ok is false
+// when the database must be queried instead.
+func (t *SQLiteTracker) countedSpend(ctx context.Context, apiKey string, since time.Time) (rows []models.CostReport, ok bool) {
+	fields, ok := t.countedFields(ctx, apiKey, since)
+	if !ok {
+		return nil, false
+	}
+	return counterRows(fields), true
+}
+
+// countedAdjustment returns the total of apiKey's ledger entries for
+// model since a given time from its counter, as countedSpend.
+func (t *SQLiteTracker) countedAdjustment(ctx context.Context, apiKey, model string, since time.Time) (tokens int64, usd float64, ok bool) {
+	fields, ok := t.countedFields(ctx, apiKey, since)
+	if !ok {
+		return 0, 0, false
+	}
+	prefix := model + counterSep
+	return int64(fields[prefix+fieldAdjTokens]), fields[prefix+fieldAdjUSD], true
+}
+
+// countedFields returns the fields of apiKey's counter for the counted
+// period starting at since, seeding it from the database if needed. ok is
+// false when since starts no counted period or the store failed.
+func (t *SQLiteTracker) countedFields(ctx context.Context, apiKey string, since time.Time) (map[string]float64, bool) {
+	c := t.counters
+	if c == nil {
+		return nil, false
+	}
+	var period *CounterPeriod
+	for _, p := range c.periods(apiKey, time.Now()) {
+		if p.Start.Equal(since) {
+			period = &p
+			break
+		}
+	}
+	if period == nil {
+		return nil, false
+	}
+	key := counterKey(apiKey, period.Start)
+	fields, seeded, err := c.store.Get(ctx, key)
+	if err != nil {
+		log.Printf("usage counter: %v", err)
+		return nil, false
+	}
+	if seeded {
+		return fields, true
+	}
+
+	// Seed the counter with what it is missing: the usage and ledger
+	// entries recorded before it was first incremented.
+	want, err := t.seedFields(ctx, apiKey, since)
+	if err != nil {
+		return nil, false
+	}
+	delta := make(map[string]float64, len(want))
+	for name, v := range want {
+		delta[name] = v - fields[name]
+	}
+	for name, v := range fields {
+		if _, ok := want[name]; !ok {
+			delta[name] = -v
+		}
+	}
+	if _, err := c.store.Seed(ctx, key, delta, time.Until(period.End)+counterGrace); err != nil {
+		log.Printf("usage counter: %v", err)
+	}
+	return want, true
+}
+
+// seedFields returns the counter fields for apiKey's usage and key ledger
+// entries since a given time, from the database.
+func (t *SQLiteTracker) seedFields(ctx context.Context, apiKey string, since time.Time) (map[string]float64, error) {
+	rows, err := t.spendByKey(ctx, apiKey, "", since)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]float64)
+	for _, r := range rows {
+		for name, v := range counterFields(r) {
+			fields[name] += v
+		}
+	}
+	adj, err := t.db.QueryContext(ctx,
+		`SELECT model, SUM(tokens), SUM(cost_usd) FROM budget_adjustments
+		 WHERE api_key = ? AND team = '' AND project = '' AND env = '' AND created_at >= ? GROUP BY model`,
+		apiKey, since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query budget adjustments: %w", err)
+	}
+	defer adj.Close()
+	for adj.Next() {
+		var model string
+		var tokens, usd float64
+		if err := adj.Scan(&model, &tokens, &usd); err != nil {
+			return nil, fmt.Errorf("scan budget adjustments: %w", err)
+		}
+		for name, v := range adjustmentFields(model, tokens, usd) {
+			fields[name] += v
+		}
+	}
+	return fields, adj.Err()
+}
+
+// forgetCounters drops the counters of apiKeys for the periods containing
+// now that overlap [from, to), after usage in that range was changed other
+// than by Record.
+func (t *SQLiteTracker) forgetCounters(ctx context.Context, apiKeys []string, from, to time.Time) {
+	c := t.counters
+	if c == nil {
+		return
+	}
+	now := time.Now()
+	var keys []string
+	for _, k := range apiKeys {
+		for _, p := range c.periods(k, now) {
+			if p.Start.Before(to) && p.End.After(from) {
+				keys = append(keys, counterKey(k, p.Start))
+			}
+		}
+	}
+	if err := c.store.Delete(ctx, keys...); err != nil {
+		log.Printf("usage counter: %v", err)
+	}
+}
+
+// counterFields returns the counter fields for a model's usage.
+func counterFields(r models.CostReport) map[string]float64 {
+	prefix := r.Model + counterSep
+	return map[string]float64{
+		prefix + fieldRequests:   float64(r.RequestCount),
+		prefix + fieldPrompt:     float64(r.PromptTokens),
+		prefix + fieldCompletion: float64(r.CompletionTokens),
+		prefix + fieldTotal:      float64(r.TotalTokens),
+		prefix + fieldCacheRead:  float64(r.CacheReadTokens),
+		prefix + fieldCacheWrite: float64(r.CacheCreationTokens),
+		prefix + fieldReasoning:  float64(r.ReasoningTokens),
+		prefix + fieldCostUSD:    r.EstimatedCost,
+	}
+}
+
+// adjustmentFields returns the counter fields for ledger entries for a
+// model.
+func adjustmentFields(model string, tokens, usd float64) map[string]float64 {
+	prefix := model + counterSep
+	return map[string]float64{prefix + fieldAdjTokens: tokens, prefix + fieldAdjUSD: usd}
+}
+
+// ResetCounters removes every usage counter from store, e.g. after the
+// tracker database was restored from a backup. They are seeded again on
+// first read.
+func ResetCounters(ctx context.Context, store CounterStore) error {
+	return store.DeletePrefix(ctx, counterPrefix)
+}
+
+// counterRows converts counter fields back to usage grouped by model,
+// sorted by model.
+func counterRows(fields map[string]float64) []models.CostReport {
+	byModel := make(map[string]*models.CostReport)
+	for name, v := range fields {
+		i := strings.LastIndex(name, counterSep)
+		if i < 0 {
+			continue
+		}
+		model := name[:i]
+		r := byModel[model]
+		if r == nil {
+			r = &models.CostReport{Model: model}
+			byModel[model] = r
+		}
+		switch name[i+1:] {
+		case fieldRequests:
+			r.RequestCount = int(v)
+		case fieldPrompt:
+			r.PromptTokens = int64(v)
+		case fieldCompletion:
+			r.CompletionTokens = int64(v)
+		case fieldTotal:
+			r.TotalTokens = int64(v)
+		case fieldCacheRead:
+			r.CacheReadTokens = int64(v)
+		case fieldCacheWrite:
+			r.CacheCreationTokens = int64(v)
+		case fieldReasoning:
+			r.ReasoningTokens = int64(v)
+		case fieldCostUSD:
+			r.EstimatedCost = v
+		}
+	}
+	rows := make([]models.CostReport, 0, len(byModel))
+	for _, r := range byModel {
+		if r.RequestCount > 0 {
+			rows = append(rows, *r)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Model < rows[j].Model })
+	return rows
+}
+
+// spendTotal sums the total tokens of usage rows, optionally for one
+// model.
+func spendTotal(rows []models.CostReport, model string) int64 {
+	var total int64
+	for _, r := range rows {
+		if model == "" || r.Model == model {
+			total += r.TotalTokens
+		}
+	}
+	return total
+}
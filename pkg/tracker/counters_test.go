@@ -0,0 +1,185 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// memCounters is an in-memory CounterStore.
+type memCounters struct {
+	mu     sync.Mutex
+	fields map[string]map[string]float64
+	seeded map[string]bool
+	fail   bool
+}
+
+func newMemCounters() *memCounters {
+	return &memCounters{fields: make(map[string]map[string]float64), seeded: make(map[string]bool)}
+}
+
+var errCounterStore = errors.New("counter store down")
+
+func (m *memCounters) Add(_ context.Context, key string, fields map[string]float64, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fail {
+		return errCounterStore
+	}
+	if m.fields[key] == nil {
+		m.fields[key] = make(map[string]float64)
+	}
+	for k, v := range fields {
+		m.fields[key][k] += v
+	}
+	return nil
+}
+
+func (m *memCounters) Get(_ context.Context, key string) (map[string]float64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fail {
+		return nil, false, errCounterStore
+	}
+	out := make(map[string]float64)
+	for k, v := range m.fields[key] {
+		out[k] = v
+	}
+	return out, m.seeded[key], nil
+}
+
+func (m *memCounters) Seed(ctx context.Context, key string, fields map[string]float64, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	if m.seeded[key] {
+		m.mu.Unlock()
+		return false, nil
+	}
+	m.seeded[key] = true
+	m.mu.Unlock()
+	return true, m.Add(ctx, key, fields, ttl)
+}
+
+func (m *memCounters) Delete(_ context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range keys {
+		delete(m.fields, k)
+		delete(m.seeded, k)
+	}
+	return nil
+}
+
+func (m *memCounters) DeletePrefix(_ context.Context, prefix string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k := range m.fields {
+		if strings.HasPrefix(k, prefix) {
+			delete(m.fields, k)
+			delete(m.seeded, k)
+		}
+	}
+	for k := range m.seeded {
+		if strings.HasPrefix(k, prefix) {
+			delete(m.seeded, k)
+		}
+	}
+	return nil
+}
+
+// dailyPeriods counts usage per UTC day.
+func dailyPeriods(_ string, at time.Time) []CounterPeriod {
+	start := at.UTC().Truncate(24 * time.Hour)
+	return []CounterPeriod{{Start: start, End: start.Add(24 * time.Hour)}}
+}
+
+func TestCounters(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	today := now.Truncate(24 * time.Hour)
+
+	// Recorded before counters were in use: seeded from the database.
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "k1", Model: "gpt-4", PromptTokens: 60, CompletionTokens: 40, TotalTokens: 100, RequestID: "r1", CreatedAt: now})
+	store := newMemCounters()
+	tr.UseCounters(store, dailyPeriods)
+
+	if total, err := tr.TotalByKey(ctx, "k1", today); err != nil || total != 100 {
+		t.Fatalf("seeding read: total = %d, %v; want 100", total, err)
+	}
+
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "k1", Model: "gpt-4o", TotalTokens: 50, MediaCostUSD: 0.5, EstimatedCostUSD: 0.5, RequestID: "r2", CreatedAt: now})
+	// A retried write of the same attempt isn't counted again.
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "k1", Model: "gpt-4o", TotalTokens: 50, MediaCostUSD: 0.5, EstimatedCostUSD: 0.5, RequestID: "r2", CreatedAt: now})
+
+	// Reads now come from the counter, not the database.
+	if _, err := tr.db.Exec(`DELETE FROM usage_records`); err != nil {
+		t.Fatal(err)
+	}
+	if total, _ := tr.TotalByKey(ctx, "k1", today); total != 150 {
+		t.Errorf("counted total = %d, want 150", total)
+	}
+	if total, _ := tr.TotalByKeyAndModel(ctx, "k1", "gpt-4", today); total != 100 {
+		t.Errorf("counted gpt-4 total = %d, want 100", total)
+	}
+	rows, err := tr.SpendByKey(ctx, "k1", "gpt-4o", today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].RequestCount != 1 || rows[0].TotalTokens != 50 || rows[0].EstimatedCost != 0.5 {
+		t.Errorf("counted spend = %+v", rows)
+	}
+
+	// Other start times, and store errors, go to the database.
+	if total, _ := tr.TotalByKey(ctx, "k1", today.Add(time.Hour)); total != 0 {
+		t.Errorf("uncounted since: total = %d, want 0 from the database", total)
+	}
+	store.fail = true
+	if total, _ := tr.TotalByKey(ctx, "k1", today); total != 0 {
+		t.Errorf("store down: total = %d, want 0 from the database", total)
+	}
+	store.fail = false
+
+	// A re-import drops the counters of the keys it touches.
+	if err := tr.ReplaceImported(ctx, "openai", today, today.Add(24*time.Hour), []models.UsageRecord{
+		{APIKey: "k1", Model: "gpt-4", TotalTokens: 7, CreatedAt: now},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if total, _ := tr.TotalByKey(ctx, "k1", today); total != 7 {
+		t.Errorf("after import: total = %d, want 7", total)
+	}
+
+	// Key ledger entries are counted too.
+	if _, err := tr.RecordAdjustment(ctx, models.BudgetAdjustment{APIKey: "k1", Tokens: -5, CostUSD: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.db.Exec(`DELETE FROM budget_adjustments`); err != nil {
+		t.Fatal(err)
+	}
+	if tokens, usd, _ := tr.AdjustmentTotal(ctx, "k1", models.CostLabel{}, "", today); tokens != -5 || usd != -1 {
+		t.Errorf("counted adjustment = %d, %v; want -5, -1", tokens, usd)
+	}
+	// After a reset, counters are seeded from the database again.
+	if err := ResetCounters(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.RecordAdjustment(ctx, models.BudgetAdjustment{APIKey: "k1", Model: "gpt-4", Tokens: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if tokens, _, _ := tr.AdjustmentTotal(ctx, "k1", models.CostLabel{}, "gpt-4", today); tokens != 3 {
+		t.Errorf("seeded adjustment = %d, want 3", tokens)
+	}
+
+	// Pruning drops the counters of the periods it reaches into.
+	if _, err := tr.PruneUsage(ctx, now.Add(time.Minute), false); err != nil {
+		t.Fatal(err)
+	}
+	if total, _ := tr.TotalByKey(ctx, "k1", today); total != 0 {
+		t.Errorf("after prune: total = %d, want 0", total)
+	}
+}
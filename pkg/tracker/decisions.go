@@ -0,0 +1,101 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+const createDecisionsTable = `
+CREATE TABLE IF NOT EXISTS budget_decisions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	request_id TEXT NOT NULL DEFAULT '',
+	api_key TEXT NOT NULL,
+	model TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL,
+	policy_api_key TEXT NOT NULL,
+	policy_model TEXT NOT NULL DEFAULT '',
+	max_tokens INTEGER NOT NULL,
+	period TEXT NOT NULL,
+	warn_at REAL NOT NULL DEFAULT 0,
+	used INTEGER NOT NULL,
+	period_start DATETIME NOT NULL,
+	created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_budget_decisions_time ON budget_decisions(created_at);
+CREATE INDEX IF NOT EXISTS idx_budget_decisions_key ON budget_decisions(api_key, created_at);
+`
+
+// decisionColumns lists budget_decisions columns added after the initial
+// schema, in the order they were introduced.
+var decisionColumns = []struct{ name, def string }{
+	{"policy_team", "TEXT NOT NULL DEFAULT ''"},
+	{"policy_project", "TEXT NOT NULL DEFAULT ''"},
+	{"policy_env", "TEXT NOT NULL DEFAULT ''"},
+	{"max_cost_usd", "REAL NOT NULL DEFAULT 0"},
+	{"used_usd", "REAL NOT NULL DEFAULT 0"},
+}
+
+// RecordDecision stores a budget enforcement decision.
+func (t *SQLiteTracker) RecordDecision(ctx context.Context, d models.BudgetDecision) error {
+	_, err := t.db.ExecContext(ctx,
+		`INSERT INTO budget_decisions (request_id, api_key, model, action, policy_api_key, policy_model,
+		 policy_team, policy_project, policy_env, max_tokens, max_cost_usd, period, warn_at, used, used_usd, period_start, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.RequestID, d.APIKey, d.Model, string(d.Action), d.Policy.APIKey, d.Policy.Model,
+		d.Policy.Team, d.Policy.Project, d.Policy.Env,
+		d.Policy.MaxTokens, d.Policy.MaxCostUSD, string(d.Policy.Period), d.Policy.WarnAt, d.Used, d.UsedUSD, d.PeriodStart, d.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("record budget decision: %w", err)
+	}
+	return nil
+}
+
+// Decisions returns stored budget decisions matching q, newest first.
+func (t *SQLiteTracker) Decisions(ctx context.Context, q models.BudgetDecisionQuery) ([]models.BudgetDecision, error) {
+	query := `SELECT id, request_id, api_key, model, action, policy_api_key, policy_model,
+		 policy_team, policy_project, policy_env, max_tokens, max_cost_usd, period, warn_at, used, used_usd, period_start, created_at
+		 FROM budget_decisions WHERE created_at >= ?`
+	args := []any{q.Since}
+	if q.APIKey != "" {
+		query += ` AND api_key = ?`
+		args = append(args, q.APIKey)
+	}
+	if q.Action != "" {
+		query += ` AND action = ?`
+		args = append(args, string(q.Action))
+	}
+	if q.Denied {
+		query += ` AND action IN (?, ?, ?)`
+		args = append(args, string(models.BudgetBlock), string(models.BudgetShed), string(models.BudgetQueueFull))
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query budget decisions: %w", err)
+	}
+	defer rows.Close()
+
+	var decisions []models.BudgetDecision
+	for rows.Next() {
+		var d models.BudgetDecision
+		var action, period string
+		if err := rows.Scan(&d.ID, &d.RequestID, &d.APIKey, &d.Model, &action, &d.Policy.APIKey, &d.Policy.Model,
+			&d.Policy.Team, &d.Policy.Project, &d.Policy.Env, &d.Policy.MaxTokens, &d.Policy.MaxCostUSD, &period, &d.Policy.WarnAt,
+			&d.Used, &d.UsedUSD, &d.PeriodStart, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan budget decision: %w", err)
+		}
+		d.Action = models.BudgetAction(action)
+		d.Policy.Period = models.BudgetPeriod(period)
+		decisions = append(decisions, d)
+	}
+	return decisions, rows.Err()
+}
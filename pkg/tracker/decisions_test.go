@@ -0,0 +1,64 @@
+package tracker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestDecisions(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	policy := models.BudgetPolicy{APIKey: "*", Team: "ml", Env: "prod", MaxTokens: 1000, MaxCostUSD: 5, Period: models.BudgetDaily, WarnAt: 0.8}
+
+	for _, d := range []models.BudgetDecision{
+		{APIKey: "k1", Action: models.BudgetWarn, Used: 800, CreatedAt: now.Add(-48 * time.Hour)},
+		{APIKey: "k1", Action: models.BudgetBlock, Used: 1000, UsedUSD: 2.5, CreatedAt: now.Add(-time.Hour)},
+		{APIKey: "k2", Action: models.BudgetShed, Used: 950, CreatedAt: now.Add(-30 * time.Minute)},
+		{APIKey: "k2", Action: models.BudgetWarn, Used: 900, CreatedAt: now},
+	} {
+		d.Policy = policy
+		d.PeriodStart = now.Truncate(24 * time.Hour)
+		if err := tr.RecordDecision(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		q    models.BudgetDecisionQuery
+		want []int64 // Used, newest first
+	}{
+		{"all", models.BudgetDecisionQuery{}, []int64{900, 950, 1000, 800}},
+		{"since", models.BudgetDecisionQuery{Since: now.Add(-24 * time.Hour)}, []int64{900, 950, 1000}},
+		{"key", models.BudgetDecisionQuery{APIKey: "k1"}, []int64{1000, 800}},
+		{"action", models.BudgetDecisionQuery{Action: models.BudgetWarn}, []int64{900, 800}},
+		{"denied", models.BudgetDecisionQuery{Denied: true}, []int64{950, 1000}},
+		{"limit", models.BudgetDecisionQuery{Limit: 1}, []int64{900}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tr.Decisions(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d decisions, want %d", len(got), len(tt.want))
+			}
+			for i, d := range got {
+				if d.Used != tt.want[i] {
+					t.Errorf("decision %d used = %d, want %d", i, d.Used, tt.want[i])
+				}
+				if d.Used == 1000 && d.UsedUSD != 2.5 {
+					t.Errorf("decision %d used_usd = %v, want 2.5", i, d.UsedUSD)
+				}
+				if d.Policy != policy {
+					t.Errorf("decision %d policy = %+v, want %+v", i, d.Policy, policy)
+				}
+			}
+		})
+	}
+}
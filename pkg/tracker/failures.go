@@ -0,0 +1,121 @@
+package tracker
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+const createFailuresTable = `
+CREATE TABLE IF NOT EXISTS upstream_failures (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	request_id TEXT NOT NULL DEFAULT '',
+	api_key TEXT NOT NULL,
+	provider TEXT NOT NULL,
+	model TEXT NOT NULL,
+	endpoint TEXT NOT NULL DEFAULT '',
+	attempt INTEGER NOT NULL,
+	status_code INTEGER NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	latency_ms INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_upstream_failures_time ON upstream_failures(created_at);
+`
+
+// RecordFailure stores a failed upstream attempt.
+func (t *SQLiteTracker) RecordFailure(ctx context.Context, f models.UpstreamFailure) error {
+	_, err := t.db.ExecContext(ctx,
+		`INSERT INTO upstream_failures (request_id, api_key, provider, model, endpoint, attempt, status_code, error, latency_ms, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		f.RequestID, f.APIKey, f.Provider, f.Model, f.Endpoint, f.Attempt, f.StatusCode, f.Error, f.LatencyMs, f.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert upstream failure: %w", err)
+	}
+	return nil
+}
+
+// ProviderReliability returns each provider's served requests, failed
+// attempts, and fallbacks since a given time, by provider. Imported usage
+// is left out.
+func (t *SQLiteTracker) ProviderReliability(ctx context.Context, since time.Time) ([]models.ProviderReliability, error) {
+	byProvider := make(map[string]*models.ProviderReliability)
+	get := func(provider string) *models.ProviderReliability {
+		p, ok := byProvider[provider]
+		if !ok {
+			p = &models.ProviderReliability{Provider: provider}
+			byProvider[provider] = p
+		}
+		return p
+	}
+
+	rows, err := t.db.QueryContext(ctx,
+		`SELECT provider, COUNT(*), COALESCE(SUM(attempt > 1 AND retry_reason = ''), 0) FROM usage_records
+		 WHERE created_at >= ? AND provider != '' AND imported = 0
+		 GROUP BY provider`,
+		since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("provider reliability: %w", err)
+	}
+	for rows.Next() {
+		var provider string
+		var served, fallbacks int
+		if err := rows.Scan(&provider, &served, &fallbacks); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan provider reliability: %w", err)
+		}
+		p := get(provider)
+		p.Served, p.Fallbacks = served, fallbacks
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("provider reliability: %w", err)
+	}
+
+	rows, err = t.db.QueryContext(ctx,
+		`SELECT provider, COUNT(*), COALESCE(SUM(request_id != '' AND EXISTS (
+		   SELECT 1 FROM usage_records u WHERE u.request_id = f.request_id AND u.request_id != '' AND u.attempt > f.attempt)), 0)
+		 FROM upstream_failures f WHERE created_at >= ?
+		 GROUP BY provider`,
+		since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("provider failures: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var provider string
+		var failures, recovered int
+		if err := rows.Scan(&provider, &failures, &recovered); err != nil {
+			return nil, fmt.Errorf("scan provider failures: %w", err)
+		}
+		p := get(provider)
+		p.Failures, p.Recovered = failures, recovered
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("provider failures: %w", err)
+	}
+	return reliabilityStats(byProvider), nil
+}
+
+// reliabilityStats fills in error rates and returns the providers sorted
+// by name.
+func reliabilityStats(byProvider map[string]*models.ProviderReliability) []models.ProviderReliability {
+	stats := make([]models.ProviderReliability, 0, len(byProvider))
+	for _, p := range byProvider {
+		if attempts := p.Served + p.Failures; attempts > 0 {
+			p.ErrorRate = float64(p.Failures) / float64(attempts)
+		}
+		stats = append(stats, *p)
+	}
+	slices.SortFunc(stats, func(a, b models.ProviderReliability) int {
+		return cmp.Compare(a.Provider, b.Provider)
+	})
+	return stats
+}
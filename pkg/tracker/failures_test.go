@@ -0,0 +1,63 @@
+package tracker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestProviderReliability(t *testing.T) {
+	for name, tr := range map[string]Tracker{"sqlite": newTestTracker(t), "memory": NewMemory()} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+
+			// r1 failed on openai and was served by azure; r2 failed on
+			// openai twice over and was never served; r3 was served by
+			// openai straight away.
+			for _, f := range []models.UpstreamFailure{
+				{RequestID: "r1", APIKey: "k1", Provider: "openai", Model: "gpt-4", Attempt: 1, StatusCode: 503, CreatedAt: now},
+				{RequestID: "r2", APIKey: "k1", Provider: "openai", Model: "gpt-4", Attempt: 1, Error: "connection refused", CreatedAt: now},
+				{RequestID: "r2", APIKey: "k1", Provider: "azure", Model: "gpt-4", Attempt: 2, StatusCode: 502, CreatedAt: now},
+				// Outside the window.
+				{RequestID: "r0", APIKey: "k1", Provider: "openai", Model: "gpt-4", Attempt: 1, StatusCode: 500, CreatedAt: now.Add(-48 * time.Hour)},
+			} {
+				if err := tr.RecordFailure(ctx, f); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, rec := range []models.UsageRecord{
+				{RequestID: "r1", Attempt: 2, APIKey: "k1", Model: "gpt-4", Provider: "azure", TotalTokens: 10, CreatedAt: now},
+				{RequestID: "r3", Attempt: 1, APIKey: "k1", Model: "gpt-4", Provider: "openai", TotalTokens: 10, CreatedAt: now},
+				// A schema retry isn't a fallback.
+				{RequestID: "r4", Attempt: 1, APIKey: "k1", Model: "gpt-4", Provider: "openai", TotalTokens: 10, CreatedAt: now},
+				{RequestID: "r4", Attempt: 2, APIKey: "k1", Model: "gpt-4", Provider: "openai", RetryReason: "schema", TotalTokens: 10, CreatedAt: now},
+				// Imported usage says nothing about upstream attempts.
+				{APIKey: "imported:openai", Model: "gpt-4", Provider: "openai", Imported: true, TotalTokens: 10, CreatedAt: now},
+			} {
+				if err := tr.Record(ctx, rec); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			stats, err := tr.ProviderReliability(ctx, now.Add(-time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []models.ProviderReliability{
+				{Provider: "azure", Served: 1, Failures: 1, ErrorRate: 0.5, Fallbacks: 1},
+				{Provider: "openai", Served: 3, Failures: 2, ErrorRate: 0.4, Recovered: 1},
+			}
+			if len(stats) != len(want) {
+				t.Fatalf("stats = %+v, want %+v", stats, want)
+			}
+			for i := range want {
+				if stats[i] != want[i] {
+					t.Errorf("stats[%d] = %+v, want %+v", i, stats[i], want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,665 @@
+package tracker
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/events"
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// Memory is a Tracker that keeps everything in process memory. It answers
+// every query like SQLiteTracker but loses its data on exit, for tests,
+// ephemeral sidecars, and serving with --no-persist.
+type Memory struct {
+	mu          sync.Mutex
+	records     []models.UsageRecord
+	attempts    map[attemptKey]bool
+	sessions    map[string]*models.Session
+	decisions   []models.BudgetDecision
+	failures    []models.UpstreamFailure
+	adjustments []models.BudgetAdjustment
+	batches     map[string]models.BatchJob
+	nextID      int64
+	usage       *events.Hub[models.UsageRecord]
+}
+
+// attemptKey is the idempotency key of a usage record.
+type attemptKey struct {
+	requestID string
+	attempt   int
+}
+
+var _ Tracker = (*Memory)(nil)
+
+// NewMemory returns an empty in-memory tracker.
+func NewMemory() *Memory {
+	return &Memory{
+		attempts: make(map[attemptKey]bool),
+		sessions: make(map[string]*models.Session),
+		batches:  make(map[string]models.BatchJob),
+		usage:    events.NewHub[models.UsageRecord](),
+	}
+}
+
+// id returns the next row ID. The caller must hold m.mu.
+func (m *Memory) id() int64 {
+	m.nextID++
+	return m.nextID
+}
+
+// Record stores a usage record and updates session counters. A record whose
+// (RequestID, Attempt) was already stored is ignored.
+func (m *Memory) Record(_ context.Context, rec models.UsageRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rec.RequestID != "" {
+		k := attemptKey{rec.RequestID, rec.Attempt}
+		if m.attempts[k] {
+			return nil
+		}
+		m.attempts[k] = true
+	}
+	rec.ID = m.id()
+	rec.Labels = maps.Clone(rec.Labels)
+	rec.Metadata = maps.Clone(rec.Metadata)
+	m.records = append(m.records, rec)
+	if s, ok := m.sessions[rec.SessionID]; ok && rec.SessionID != "" {
+		s.LastActivity = rec.CreatedAt
+		s.RequestCount++
+		s.TotalTokens += rec.TotalTokens
+		s.EndedAt = time.Time{}
+	}
+	if m.usage.Active() {
+		rec.Labels = maps.Clone(rec.Labels)
+		rec.Metadata = maps.Clone(rec.Metadata)
+		m.usage.Publish(rec)
+	}
+	return nil
+}
+
+// SubscribeUsage returns a subscription that receives every usage record
+// once it is stored; see SQLiteTracker.SubscribeUsage.
+func (m *Memory) SubscribeUsage(buffer int) *events.Subscription[models.UsageRecord] {
+	return m.usage.Subscribe(buffer)
+}
+
+// filter returns copies of the records keep selects, in insertion order.
+func (m *Memory) filter(keep func(r *models.UsageRecord) bool) []models.UsageRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []models.UsageRecord
+	for i := range m.records {
+		if keep(&m.records[i]) {
+			r := m.records[i]
+			r.Labels = maps.Clone(r.Labels)
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// QueryByKey returns usage records for an API key since a given time,
+// newest first.
+func (m *Memory) QueryByKey(_ context.Context, apiKey string, since time.Time) ([]models.UsageRecord, error) {
+	recs := m.filter(func(r *models.UsageRecord) bool {
+		return r.APIKey == apiKey && !r.CreatedAt.Before(since)
+	})
+	slices.SortStableFunc(recs, func(a, b models.UsageRecord) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return recs, nil
+}
+
+// QuerySince returns all usage records since a given time, oldest first.
+func (m *Memory) QuerySince(_ context.Context, since time.Time) ([]models.UsageRecord, error) {
+	recs := m.filter(func(r *models.UsageRecord) bool { return !r.CreatedAt.Before(since) })
+	slices.SortStableFunc(recs, func(a, b models.UsageRecord) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return recs, nil
+}
+
+// TotalByKey returns total tokens used by an API key since a given time.
+func (m *Memory) TotalByKey(ctx context.Context, apiKey string, since time.Time) (int64, error) {
+	rows, err := m.SpendByKey(ctx, apiKey, "", since)
+	return spendTotal(rows, ""), err
+}
+
+// TotalByKeyAndModel returns total tokens used by an API key and model since a given time.
+func (m *Memory) TotalByKeyAndModel(ctx context.Context, apiKey, model string, since time.Time) (int64, error) {
+	rows, err := m.SpendByKey(ctx, apiKey, model, since)
+	return spendTotal(rows, model), err
+}
+
+// SpendByKey returns an API key's usage since a given time grouped by
+// model, optionally restricted to one model.
+func (m *Memory) SpendByKey(_ context.Context, apiKey, model string, since time.Time) ([]models.CostReport, error) {
+	recs := m.filter(func(r *models.UsageRecord) bool {
+		return r.APIKey == apiKey && !r.CreatedAt.Before(since) && (model == "" || r.Model == model)
+	})
+	return byModel(recs), nil
+}
+
+// SpendByLabels returns the usage since a given time of every key carrying
+// labels, grouped by model and optionally restricted to one model. Empty
+// labels match any value.
+func (m *Memory) SpendByLabels(_ context.Context, labels models.CostLabel, model string, since time.Time) ([]models.CostReport, error) {
+	recs := m.filter(func(r *models.UsageRecord) bool {
+		return !r.CreatedAt.Before(since) &&
+			(labels.Team == "" || r.Team == labels.Team) &&
+			(labels.Project == "" || r.Project == labels.Project) &&
+			(labels.Env == "" || r.Env == labels.Env) &&
+			(model == "" || r.Model == model)
+	})
+	return byModel(recs), nil
+}
+
+// byModel aggregates recs into one spend row per model, sorted by model.
+func byModel(recs []models.UsageRecord) []models.CostReport {
+	groups := make(map[string]*models.CostReport)
+	var reports []models.CostReport
+	for _, r := range recs {
+		g, ok := groups[r.Model]
+		if !ok {
+			g = &models.CostReport{Model: r.Model}
+			groups[r.Model] = g
+		}
+		addCost(g, r)
+	}
+	for _, g := range groups {
+		reports = append(reports, *g)
+	}
+	slices.SortFunc(reports, func(a, b models.CostReport) int { return cmp.Compare(a.Model, b.Model) })
+	return reports
+}
+
+// addCost adds r to the running totals of a cost row.
+func addCost(c *models.CostReport, r models.UsageRecord) {
+	c.RequestCount++
+	c.PromptTokens += int64(r.PromptTokens)
+	c.CompletionTokens += int64(r.CompletionTokens)
+	c.TotalTokens += int64(r.TotalTokens)
+	c.CacheReadTokens += int64(r.CacheReadTokens)
+	c.CacheCreationTokens += int64(r.CacheCreationTokens)
+	c.ReasoningTokens += int64(r.ReasoningTokens)
+	c.EstimatedCost += r.EstimatedCostUSD
+}
+
+// RecordAdjustment stores a budget ledger entry and returns it with its ID
+// set. A zero CreatedAt is set to now.
+func (m *Memory) RecordAdjustment(_ context.Context, a models.BudgetAdjustment) (models.BudgetAdjustment, error) {
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now().UTC()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a.ID = m.id()
+	m.adjustments = append(m.adjustments, a)
+	return a, nil
+}
+
+// AdjustmentTotal sums the ledger entries made since a given time with
+// exactly the given scope.
+func (m *Memory) AdjustmentTotal(_ context.Context, apiKey string, labels models.CostLabel, model string, since time.Time) (int64, float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tokens int64
+	var usd float64
+	for _, a := range m.adjustments {
+		if a.APIKey == apiKey && a.Team == labels.Team && a.Project == labels.Project && a.Env == labels.Env &&
+			a.Model == model && !a.CreatedAt.Before(since) {
+			tokens += a.Tokens
+			usd += a.CostUSD
+		}
+	}
+	return tokens, usd, nil
+}
+
+// Summary returns aggregated usage grouped by API key, model, provider,
+// and route alias.
+func (m *Memory) Summary(_ context.Context, apiKey string) ([]models.UsageSummary, error) {
+	recs := m.filter(func(r *models.UsageRecord) bool { return apiKey == "" || r.APIKey == apiKey })
+	type group struct{ apiKey, model, provider, alias string }
+	groups := make(map[group]*models.UsageSummary)
+	for _, r := range recs {
+		k := group{r.APIKey, r.Model, r.Provider, r.RouteAlias}
+		s, ok := groups[k]
+		if !ok {
+			s = &models.UsageSummary{APIKey: r.APIKey, Model: r.Model, Provider: r.Provider, RouteAlias: r.RouteAlias}
+			groups[k] = s
+		}
+		s.RequestCount++
+		s.TotalPrompt += r.PromptTokens
+		s.TotalCompletion += r.CompletionTokens
+		s.TotalTokens += r.TotalTokens
+		if r.Streamed {
+			s.StreamedRequests++
+			s.StreamedTokens += r.TotalTokens
+		}
+		if r.Partial {
+			s.PartialRequests++
+		}
+	}
+	var summaries []models.UsageSummary
+	for _, s := range groups {
+		summaries = append(summaries, *s)
+	}
+	slices.SortFunc(summaries, func(a, b models.UsageSummary) int {
+		return cmp.Or(cmp.Compare(a.APIKey, b.APIKey), cmp.Compare(a.Model, b.Model),
+			cmp.Compare(a.Provider, b.Provider), cmp.Compare(a.RouteAlias, b.RouteAlias))
+	})
+	return summaries, nil
+}
+
+// ResolveSession returns a session ID. If explicitID is non-empty, it
+// ensures the session exists and returns it. Otherwise it reuses the key's
+// most recent session if it was active within gapTimeout, or creates one.
+func (m *Memory) ResolveSession(_ context.Context, apiKey, explicitID string, gapTimeout time.Duration) (string, error) {
+	now := time.Now().UTC()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if explicitID != "" {
+		if _, ok := m.sessions[explicitID]; !ok {
+			m.sessions[explicitID] = &models.Session{ID: explicitID, APIKey: apiKey, StartedAt: now, LastActivity: now}
+		}
+		return explicitID, nil
+	}
+
+	var last *models.Session
+	for _, s := range m.sessions {
+		if s.APIKey == apiKey && s.EndedAt.IsZero() && (last == nil || s.LastActivity.After(last.LastActivity)) {
+			last = s
+		}
+	}
+	if last != nil && now.Sub(last.LastActivity) <= gapTimeout {
+		return last.ID, nil
+	}
+
+	id := generateSessionID()
+	m.sessions[id] = &models.Session{ID: id, APIKey: apiKey, StartedAt: now, LastActivity: now}
+	return id, nil
+}
+
+// ListSessions returns the sessions matching q, most recently started
+// first.
+func (m *Memory) ListSessions(_ context.Context, q models.SessionQuery) ([]models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sessions []models.Session
+	for _, s := range m.sessions {
+		if q.Match(*s) {
+			c := *s
+			c.Tags = maps.Clone(s.Tags)
+			sessions = append(sessions, c)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b models.Session) int {
+		return cmp.Or(b.StartedAt.Compare(a.StartedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return sessions, nil
+}
+
+// UpdateSession sets a session's name, unless name is empty, and merges
+// tags into its tags.
+func (m *Memory) UpdateSession(_ context.Context, id, name string, tags map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if name != "" {
+		s.Name = name
+	}
+	if len(tags) > 0 {
+		if s.Tags == nil {
+			s.Tags = make(map[string]string, len(tags))
+		}
+		maps.Copy(s.Tags, tags)
+	}
+	return nil
+}
+
+// SessionRequests returns per-request detail for a session with context growth.
+func (m *Memory) SessionRequests(_ context.Context, sessionID string) ([]models.SessionRequest, error) {
+	recs := m.filter(func(r *models.UsageRecord) bool { return r.SessionID == sessionID })
+	slices.SortStableFunc(recs, func(a, b models.UsageRecord) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	var reqs []models.SessionRequest
+	for i, r := range recs {
+		req := models.SessionRequest{
+			Seq:              i + 1,
+			CreatedAt:        r.CreatedAt,
+			PromptTokens:     r.PromptTokens,
+			CompletionTokens: r.CompletionTokens,
+			TotalTokens:      r.TotalTokens,
+		}
+		if i > 0 {
+			req.ContextGrowth = r.PromptTokens - recs[i-1].PromptTokens
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// CostReport returns aggregated usage grouped by team, project, model,
+// provider, and route alias. EstimatedCost holds the stored media cost.
+func (m *Memory) CostReport(_ context.Context, since time.Time, team, project string) ([]models.CostReport, error) {
+	recs := m.filter(func(r *models.UsageRecord) bool {
+		return !r.CreatedAt.Before(since) && (team == "" || r.Team == team) && (project == "" || r.Project == project)
+	})
+	type group struct{ team, project, model, provider, alias string }
+	groups := make(map[group]*models.CostReport)
+	for _, r := range recs {
+		k := group{r.Team, r.Project, r.Model, r.Provider, r.RouteAlias}
+		c, ok := groups[k]
+		if !ok {
+			c = &models.CostReport{Team: r.Team, Project: r.Project, Model: r.Model, Provider: r.Provider, RouteAlias: r.RouteAlias}
+			groups[k] = c
+		}
+		addCost(c, r)
+	}
+	var reports []models.CostReport
+	for _, c := range groups {
+		reports = append(reports, *c)
+	}
+	slices.SortFunc(reports, func(a, b models.CostReport) int {
+		return cmp.Or(cmp.Compare(a.Team, b.Team), cmp.Compare(a.Project, b.Project), cmp.Compare(a.Model, b.Model),
+			cmp.Compare(a.Provider, b.Provider), cmp.Compare(a.RouteAlias, b.RouteAlias))
+	})
+	return reports, nil
+}
+
+// Top returns the values of q.By with the most usage since q.Since, by
+// total tokens or estimated cost.
+func (m *Memory) Top(_ context.Context, q models.TopQuery) ([]models.TopEntry, error) {
+	if err := q.Validate(); err != nil {
+		return nil, fmt.Errorf("top: %w", err)
+	}
+	recs := m.filter(func(r *models.UsageRecord) bool {
+		return !r.CreatedAt.Before(q.Since) && (q.By != models.TopBySession || r.SessionID != "")
+	})
+	groups := make(map[topGroup]*models.CostReport)
+	for _, r := range recs {
+		g := topGroup{model: r.Model}
+		switch q.By {
+		case models.TopByKey:
+			g.value = r.APIKey
+		case models.TopBySession:
+			g.value = r.SessionID
+		case models.TopByModel:
+			g.value = r.Model
+		case models.TopByTeam:
+			g.value = r.Team
+		}
+		c, ok := groups[g]
+		if !ok {
+			c = &models.CostReport{}
+			groups[g] = c
+		}
+		addCost(c, r)
+	}
+	return rankTop(q, groups), nil
+}
+
+// labelValue returns the value of label key on r, resolving the columns in
+// columnLabels and metadata like labelExpr.
+func labelValue(r *models.UsageRecord, key string) string {
+	if name, ok := strings.CutPrefix(key, models.MetadataPrefix); ok {
+		return r.Metadata[name]
+	}
+	switch columnLabels[key] {
+	case "pipeline":
+		return r.Pipeline
+	case "branch":
+		return r.Branch
+	case "commit_sha":
+		return r.Commit
+	case "endpoint":
+		return r.Endpoint
+	case "provider":
+		return r.Provider
+	case "route_alias":
+		return r.RouteAlias
+	}
+	return r.Labels[key]
+}
+
+// LabelReport returns aggregated usage grouped by the value of q.GroupBy
+// and model, restricted to records whose labels match every filter.
+func (m *Memory) LabelReport(_ context.Context, q models.LabelQuery) ([]models.LabelReport, error) {
+	recs := m.filter(func(r *models.UsageRecord) bool {
+		if r.CreatedAt.Before(q.Since) {
+			return false
+		}
+		for k, v := range q.Filters {
+			if labelValue(r, k) != v {
+				return false
+			}
+		}
+		return true
+	})
+	type group struct{ value, model string }
+	groups := make(map[group]*models.LabelReport)
+	for _, r := range recs {
+		var value string
+		if q.GroupBy != "" {
+			value = labelValue(&r, q.GroupBy)
+		}
+		k := group{value, r.Model}
+		l, ok := groups[k]
+		if !ok {
+			l = &models.LabelReport{Label: q.GroupBy, Value: value, Model: r.Model}
+			groups[k] = l
+		}
+		l.RequestCount++
+		l.PromptTokens += int64(r.PromptTokens)
+		l.CompletionTokens += int64(r.CompletionTokens)
+		l.TotalTokens += int64(r.TotalTokens)
+		l.CacheReadTokens += int64(r.CacheReadTokens)
+		l.CacheCreationTokens += int64(r.CacheCreationTokens)
+		l.ReasoningTokens += int64(r.ReasoningTokens)
+		l.EstimatedCost += r.EstimatedCostUSD
+	}
+	var reports []models.LabelReport
+	for _, l := range groups {
+		reports = append(reports, *l)
+	}
+	slices.SortFunc(reports, func(a, b models.LabelReport) int {
+		return cmp.Or(cmp.Compare(a.Value, b.Value), cmp.Compare(a.Model, b.Model))
+	})
+	return reports, nil
+}
+
+// Throughput returns output tokens/sec distributions grouped by model and
+// provider since a given time. Records without a measured latency are skipped.
+func (m *Memory) Throughput(_ context.Context, since time.Time) ([]models.ThroughputStat, error) {
+	recs := m.filter(func(r *models.UsageRecord) bool {
+		return !r.CreatedAt.Before(since) && r.OutputTokensPerSec > 0
+	})
+	type group struct{ model, provider string }
+	values := make(map[group][]float64)
+	for _, r := range recs {
+		k := group{r.Model, r.Provider}
+		values[k] = append(values[k], r.OutputTokensPerSec)
+	}
+	var stats []models.ThroughputStat
+	for k, v := range values {
+		slices.Sort(v)
+		var sum float64
+		for _, x := range v {
+			sum += x
+		}
+		stats = append(stats, models.ThroughputStat{
+			Model:    k.model,
+			Provider: k.provider,
+			Requests: len(v),
+			Mean:     sum / float64(len(v)),
+			P50:      percentile(v, 50),
+			P90:      percentile(v, 90),
+			Min:      v[0],
+			Max:      v[len(v)-1],
+		})
+	}
+	slices.SortFunc(stats, func(a, b models.ThroughputStat) int {
+		return cmp.Or(cmp.Compare(a.Model, b.Model), cmp.Compare(a.Provider, b.Provider))
+	})
+	return stats, nil
+}
+
+// Latency returns upstream latency distributions in milliseconds grouped
+// by model and provider since a given time. Records without a measured
+// latency are skipped.
+func (m *Memory) Latency(_ context.Context, since time.Time) ([]models.LatencyStat, error) {
+	recs := m.filter(func(r *models.UsageRecord) bool {
+		return !r.CreatedAt.Before(since) && r.LatencyMs > 0
+	})
+	type group struct{ model, provider string }
+	values := make(map[group][]float64)
+	for _, r := range recs {
+		k := group{r.Model, r.Provider}
+		values[k] = append(values[k], float64(r.LatencyMs))
+	}
+	var stats []models.LatencyStat
+	for k, v := range values {
+		slices.Sort(v)
+		stats = append(stats, latencyStat(k.model, k.provider, v))
+	}
+	slices.SortFunc(stats, func(a, b models.LatencyStat) int {
+		return cmp.Or(cmp.Compare(a.Model, b.Model), cmp.Compare(a.Provider, b.Provider))
+	})
+	return stats, nil
+}
+
+// RecordFailure stores a failed upstream attempt.
+func (m *Memory) RecordFailure(_ context.Context, f models.UpstreamFailure) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f.ID = m.id()
+	m.failures = append(m.failures, f)
+	return nil
+}
+
+// ProviderReliability returns each provider's served requests, failed
+// attempts, and fallbacks since a given time, by provider. Imported usage
+// is left out.
+func (m *Memory) ProviderReliability(_ context.Context, since time.Time) ([]models.ProviderReliability, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	byProvider := make(map[string]*models.ProviderReliability)
+	get := func(provider string) *models.ProviderReliability {
+		p, ok := byProvider[provider]
+		if !ok {
+			p = &models.ProviderReliability{Provider: provider}
+			byProvider[provider] = p
+		}
+		return p
+	}
+	for _, r := range m.records {
+		if r.CreatedAt.Before(since) || r.Provider == "" || r.Imported {
+			continue
+		}
+		p := get(r.Provider)
+		p.Served++
+		if r.Attempt > 1 && r.RetryReason == "" {
+			p.Fallbacks++
+		}
+	}
+	for _, f := range m.failures {
+		if f.CreatedAt.Before(since) {
+			continue
+		}
+		p := get(f.Provider)
+		p.Failures++
+		if f.RequestID != "" && slices.ContainsFunc(m.records, func(r models.UsageRecord) bool {
+			return r.RequestID == f.RequestID && r.Attempt > f.Attempt
+		}) {
+			p.Recovered++
+		}
+	}
+	return reliabilityStats(byProvider), nil
+}
+
+// RecordDecision stores a budget enforcement decision.
+func (m *Memory) RecordDecision(_ context.Context, d models.BudgetDecision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d.ID = m.id()
+	m.decisions = append(m.decisions, d)
+	return nil
+}
+
+// Decisions returns stored budget decisions matching q, newest first.
+func (m *Memory) Decisions(_ context.Context, q models.BudgetDecisionQuery) ([]models.BudgetDecision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var decisions []models.BudgetDecision
+	for _, d := range m.decisions {
+		if d.CreatedAt.Before(q.Since) ||
+			(q.APIKey != "" && d.APIKey != q.APIKey) ||
+			(q.Action != "" && d.Action != q.Action) ||
+			(q.Denied && d.Action != models.BudgetBlock && d.Action != models.BudgetShed && d.Action != models.BudgetQueueFull) {
+			continue
+		}
+		decisions = append(decisions, d)
+	}
+	slices.SortFunc(decisions, func(a, b models.BudgetDecision) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(b.ID, a.ID))
+	})
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if len(decisions) > limit {
+		decisions = decisions[:limit]
+	}
+	return decisions, nil
+}
+
+// RecordBatch stores a submitted batch job. Recording the same batch ID
+// again is a no-op.
+func (m *Memory) RecordBatch(_ context.Context, job models.BatchJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.batches[job.ID]; !ok {
+		job.Labels = maps.Clone(job.Labels)
+		job.Metadata = maps.Clone(job.Metadata)
+		job.FinishedAt = nil
+		m.batches[job.ID] = job
+	}
+	return nil
+}
+
+// PendingBatches returns batch jobs that have not finished, oldest first.
+func (m *Memory) PendingBatches(_ context.Context) ([]models.BatchJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var jobs []models.BatchJob
+	for _, j := range m.batches {
+		if j.FinishedAt == nil {
+			jobs = append(jobs, j)
+		}
+	}
+	slices.SortFunc(jobs, func(a, b models.BatchJob) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return jobs, nil
+}
+
+// FinishBatch marks a batch job finished with its terminal status.
+func (m *Memory) FinishBatch(_ context.Context, id, status string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if j, ok := m.batches[id]; ok {
+		j.Status = status
+		j.FinishedAt = &at
+		m.batches[id] = j
+	}
+	return nil
+}
+
+// Close is a no-op; the data is dropped with the tracker.
+func (m *Memory) Close() error { return nil }
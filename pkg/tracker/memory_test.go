@@ -0,0 +1,165 @@
+package tracker
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// TestMemoryMatchesSQLite records the same usage in a Memory and a
+// SQLiteTracker and checks that every query answers the same.
+func TestMemoryMatchesSQLite(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemory()
+	db := newTestTracker(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	recs := []models.UsageRecord{
+		{APIKey: "k1", Model: "gpt-4", PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150, Team: "a", Project: "x",
+			Provider: "openai", OutputTokensPerSec: 40, LatencyMs: 1200, UpstreamStatus: 200, Labels: map[string]string{"feature": "chat"},
+			Metadata: map[string]string{"feature": "checkout"}, EstimatedCostUSD: 0.2, CreatedAt: now.Add(-3 * time.Hour)},
+		{APIKey: "k1", Model: "gpt-4", PromptTokens: 200, CompletionTokens: 20, TotalTokens: 220, Team: "a", Project: "y",
+			Streamed: true, Provider: "openai", OutputTokensPerSec: 60, LatencyMs: 300, Pipeline: "ci", CreatedAt: now.Add(-2 * time.Hour)},
+		{APIKey: "k1", Model: "claude", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, Team: "b", Env: "prod",
+			Partial: true, MediaCostUSD: 0.5, EstimatedCostUSD: 0.6, RequestID: "r1", Attempt: 1, CreatedAt: now.Add(-time.Hour)},
+		// A retried write of the same attempt is ignored.
+		{APIKey: "k1", Model: "claude", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, Team: "b", Env: "prod",
+			Partial: true, MediaCostUSD: 0.5, EstimatedCostUSD: 0.6, RequestID: "r1", Attempt: 1, CreatedAt: now.Add(-time.Hour)},
+		{APIKey: "k2", Model: "gpt-4", PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2, Team: "b",
+			Labels: map[string]string{"feature": "search"}, CreatedAt: now},
+	}
+	for _, tr := range []Tracker{mem, db} {
+		for _, rec := range recs {
+			if err := tr.Record(ctx, rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		d := models.BudgetDecision{APIKey: "k1", Action: models.BudgetBlock, Policy: models.BudgetPolicy{Period: models.BudgetDaily}, CreatedAt: now}
+		if err := tr.RecordDecision(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+		f := models.UpstreamFailure{RequestID: "r1", APIKey: "k1", Provider: "anthropic", Model: "claude", Attempt: 0, StatusCode: 529, CreatedAt: now}
+		if err := tr.RecordFailure(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+		job := models.BatchJob{ID: "batch_1", Provider: "openai", APIKey: "k1", Metadata: map[string]string{"feature": "export"}, CreatedAt: now}
+		if err := tr.RecordBatch(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	since := now.Add(-24 * time.Hour)
+	same := func(name string, query func(Tracker) (any, error)) {
+		t.Helper()
+		want, err := query(db)
+		if err != nil {
+			t.Fatalf("%s: sqlite: %v", name, err)
+		}
+		got, err := query(mem)
+		if err != nil {
+			t.Fatalf("%s: memory: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", name, got, want)
+		}
+	}
+	// withoutTimes drops the IDs and time zones that only differ in how
+	// the two stores assign and round-trip them.
+	withoutTimes := func(recs []models.UsageRecord, err error) (any, error) {
+		for i := range recs {
+			recs[i].ID = 0
+			recs[i].CreatedAt = recs[i].CreatedAt.UTC()
+		}
+		return recs, err
+	}
+
+	same("QueryByKey", func(tr Tracker) (any, error) { return withoutTimes(tr.QueryByKey(ctx, "k1", since)) })
+	same("QuerySince", func(tr Tracker) (any, error) { return withoutTimes(tr.QuerySince(ctx, since)) })
+	same("TotalByKey", func(tr Tracker) (any, error) { return tr.TotalByKey(ctx, "k1", since) })
+	same("TotalByKeyAndModel", func(tr Tracker) (any, error) { return tr.TotalByKeyAndModel(ctx, "k1", "gpt-4", since) })
+	same("SpendByKey", func(tr Tracker) (any, error) { return tr.SpendByKey(ctx, "k1", "", since) })
+	same("SpendByLabels", func(tr Tracker) (any, error) {
+		return tr.SpendByLabels(ctx, models.CostLabel{Team: "b"}, "", since)
+	})
+	same("Summary", func(tr Tracker) (any, error) { return tr.Summary(ctx, "") })
+	same("CostReport", func(tr Tracker) (any, error) { return tr.CostReport(ctx, since, "", "") })
+	same("LabelReport", func(tr Tracker) (any, error) {
+		return tr.LabelReport(ctx, models.LabelQuery{Since: since, GroupBy: "feature", Filters: map[string]string{"provider": ""}})
+	})
+	same("LabelReport metadata", func(tr Tracker) (any, error) {
+		return tr.LabelReport(ctx, models.LabelQuery{Since: since, GroupBy: "metadata.feature", Filters: models.MetadataFilters(nil, map[string]string{"feature": "checkout"})})
+	})
+	same("Throughput", func(tr Tracker) (any, error) { return tr.Throughput(ctx, since) })
+	same("Latency", func(tr Tracker) (any, error) { return tr.Latency(ctx, since) })
+	same("ProviderReliability", func(tr Tracker) (any, error) { return tr.ProviderReliability(ctx, since) })
+	same("Top", func(tr Tracker) (any, error) {
+		return tr.Top(ctx, models.TopQuery{By: models.TopByTeam, Since: since, OrderBy: models.TopOrderCost})
+	})
+	same("Decisions", func(tr Tracker) (any, error) {
+		ds, err := tr.Decisions(ctx, models.BudgetDecisionQuery{Since: since, Denied: true})
+		return len(ds), err
+	})
+	same("PendingBatches", func(tr Tracker) (any, error) {
+		jobs, err := tr.PendingBatches(ctx)
+		var ids []string
+		for _, j := range jobs {
+			ids = append(ids, j.ID+"/"+j.Metadata["feature"])
+		}
+		return ids, err
+	})
+}
+
+func TestMemorySessions(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemory()
+
+	id, err := mem.ResolveSession(ctx, "k1", "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := mem.ResolveSession(ctx, "k1", "", time.Hour)
+	if again != id {
+		t.Errorf("session within gap: got %s, want %s", again, id)
+	}
+	if _, err := mem.ResolveSession(ctx, "k2", "explicit", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	for i, prompt := range []int{100, 250} {
+		_ = mem.Record(ctx, models.UsageRecord{APIKey: "k1", SessionID: id, PromptTokens: prompt, TotalTokens: prompt + 10,
+			CreatedAt: now.Add(time.Duration(i) * time.Second)})
+	}
+
+	sessions, _ := mem.ListSessions(ctx, models.SessionQuery{APIKey: "k1"})
+	if len(sessions) != 1 || sessions[0].RequestCount != 2 || sessions[0].TotalTokens != 370 {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+	all, _ := mem.ListSessions(ctx, models.SessionQuery{})
+	if len(all) != 2 {
+		t.Errorf("all sessions = %d, want 2", len(all))
+	}
+
+	reqs, _ := mem.SessionRequests(ctx, id)
+	if len(reqs) != 2 || reqs[1].Seq != 2 || reqs[1].ContextGrowth != 150 {
+		t.Errorf("session requests = %+v", reqs)
+	}
+
+	if err := mem.RecordBatch(ctx, models.BatchJob{ID: "b1", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	_ = mem.FinishBatch(ctx, "b1", "completed", now)
+	if pending, _ := mem.PendingBatches(ctx); len(pending) != 0 {
+		t.Errorf("pending after finish = %+v", pending)
+	}
+
+	if _, err := mem.RecordAdjustment(ctx, models.BudgetAdjustment{APIKey: "k1", Tokens: -50}); err != nil {
+		t.Fatal(err)
+	}
+	if tokens, _, _ := mem.AdjustmentTotal(ctx, "k1", models.CostLabel{}, "", now.Add(-time.Minute)); tokens != -50 {
+		t.Errorf("adjustment total = %d, want -50", tokens)
+	}
+}
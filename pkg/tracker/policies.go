@@ -0,0 +1,120 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// ErrNotFound is returned when a stored item doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// PolicyStore stores managed budget policies. SQLiteTracker stores them in
+// its database; Remote stores them on its tracker server.
+type PolicyStore interface {
+	ManagedPolicies(ctx context.Context) ([]models.ManagedBudgetPolicy, error)
+	CreatePolicy(ctx context.Context, p models.ManagedBudgetPolicy) (models.ManagedBudgetPolicy, error)
+	UpdatePolicy(ctx context.Context, p models.ManagedBudgetPolicy) (models.ManagedBudgetPolicy, error)
+	DeletePolicy(ctx context.Context, id int64) error
+}
+
+var (
+	_ PolicyStore = (*SQLiteTracker)(nil)
+	_ PolicyStore = (*Remote)(nil)
+)
+
+const createPoliciesTable = `
+CREATE TABLE IF NOT EXISTS budget_policies (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	policy TEXT NOT NULL,
+	expires_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+`
+
+// CreatePolicy stores a managed budget policy and returns it with its ID
+// and timestamps set.
+func (t *SQLiteTracker) CreatePolicy(ctx context.Context, p models.ManagedBudgetPolicy) (models.ManagedBudgetPolicy, error) {
+	data, err := json.Marshal(p.BudgetPolicy)
+	if err != nil {
+		return p, fmt.Errorf("create budget policy: %w", err)
+	}
+	p.CreatedAt = time.Now().UTC()
+	p.UpdatedAt = p.CreatedAt
+	res, err := t.db.ExecContext(ctx,
+		`INSERT INTO budget_policies (policy, expires_at, created_at, updated_at) VALUES (?, ?, ?, ?)`,
+		string(data), p.ExpiresAt, p.CreatedAt, p.UpdatedAt,
+	)
+	if err != nil {
+		return p, fmt.Errorf("create budget policy: %w", err)
+	}
+	if p.ID, err = res.LastInsertId(); err != nil {
+		return p, fmt.Errorf("create budget policy: %w", err)
+	}
+	return p, nil
+}
+
+// UpdatePolicy replaces the managed budget policy with p's ID, keeping its
+// creation time. It returns ErrNotFound if there is none.
+func (t *SQLiteTracker) UpdatePolicy(ctx context.Context, p models.ManagedBudgetPolicy) (models.ManagedBudgetPolicy, error) {
+	data, err := json.Marshal(p.BudgetPolicy)
+	if err != nil {
+		return p, fmt.Errorf("update budget policy: %w", err)
+	}
+	p.UpdatedAt = time.Now().UTC()
+	err = t.db.QueryRowContext(ctx,
+		`UPDATE budget_policies SET policy = ?, expires_at = ?, updated_at = ? WHERE id = ? RETURNING created_at`,
+		string(data), p.ExpiresAt, p.UpdatedAt, p.ID,
+	).Scan(&p.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, fmt.Errorf("update budget policy %d: %w", p.ID, ErrNotFound)
+	}
+	if err != nil {
+		return p, fmt.Errorf("update budget policy: %w", err)
+	}
+	return p, nil
+}
+
+// DeletePolicy removes a managed budget policy. It returns ErrNotFound if
+// there is none with the ID.
+func (t *SQLiteTracker) DeletePolicy(ctx context.Context, id int64) error {
+	res, err := t.db.ExecContext(ctx, `DELETE FROM budget_policies WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete budget policy: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("delete budget policy %d: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// ManagedPolicies returns every stored budget policy, expired ones
+// included, oldest first.
+func (t *SQLiteTracker) ManagedPolicies(ctx context.Context) ([]models.ManagedBudgetPolicy, error) {
+	rows, err := t.db.QueryContext(ctx,
+		`SELECT id, policy, expires_at, created_at, updated_at FROM budget_policies ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("query budget policies: %w", err)
+	}
+	defer rows.Close()
+
+	var policies []models.ManagedBudgetPolicy
+	for rows.Next() {
+		var p models.ManagedBudgetPolicy
+		var data string
+		if err := rows.Scan(&p.ID, &data, &p.ExpiresAt, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan budget policy: %w", err)
+		}
+		if err := json.Unmarshal([]byte(data), &p.BudgetPolicy); err != nil {
+			return nil, fmt.Errorf("decode budget policy %d: %w", p.ID, err)
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
@@ -0,0 +1,65 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestManagedPolicies(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	expires := time.Date(2030, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	a, err := tr.CreatePolicy(ctx, models.ManagedBudgetPolicy{
+		BudgetPolicy: models.BudgetPolicy{APIKey: "sk-batch", MaxTokens: 2000, Period: models.BudgetDaily},
+		ExpiresAt:    expires,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tr.CreatePolicy(ctx, models.ManagedBudgetPolicy{
+		BudgetPolicy: models.BudgetPolicy{Team: "ml", Model: "o3*", MaxCostUSD: 50, Period: models.BudgetMonthly},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID == 0 || b.ID == a.ID || a.CreatedAt.IsZero() {
+		t.Fatalf("created %+v and %+v", a, b)
+	}
+
+	b.MaxCostUSD = 80
+	if _, err := tr.UpdatePolicy(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.UpdatePolicy(ctx, models.ManagedBudgetPolicy{ID: 99}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("update missing = %v, want ErrNotFound", err)
+	}
+
+	got, err := tr.ManagedPolicies(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d policies, want 2", len(got))
+	}
+	if got[0].BudgetPolicy != a.BudgetPolicy || !got[0].ExpiresAt.Equal(expires) {
+		t.Errorf("policy 0 = %+v, want %+v", got[0], a)
+	}
+	if got[1].MaxCostUSD != 80 || got[1].Team != "ml" || !got[1].ExpiresAt.IsZero() || !got[1].CreatedAt.Equal(b.CreatedAt) {
+		t.Errorf("policy 1 = %+v", got[1])
+	}
+
+	if err := tr.DeletePolicy(ctx, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.DeletePolicy(ctx, a.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("delete twice = %v, want ErrNotFound", err)
+	}
+	if got, _ := tr.ManagedPolicies(ctx); len(got) != 1 || got[0].ID != b.ID {
+		t.Errorf("after delete = %+v", got)
+	}
+}
@@ -0,0 +1,293 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// remotePath is where a tracker server serves calls, followed by the
+// method name.
+const remotePath = "/pario/tracker/"
+
+// remoteArgs carries the arguments of every remote tracker call. Each
+// method reads the fields it takes.
+type remoteArgs struct {
+	APIKey        string                      `json:"api_key,omitempty"`
+	Model         string                      `json:"model,omitempty"`
+	Since         time.Time                   `json:"since,omitzero"`
+	Labels        models.CostLabel            `json:"labels,omitzero"`
+	Team          string                      `json:"team,omitempty"`
+	Project       string                      `json:"project,omitempty"`
+	SessionID     string                      `json:"session_id,omitempty"`
+	SessionQuery  models.SessionQuery         `json:"session_query,omitzero"`
+	Name          string                      `json:"name,omitempty"`
+	Tags          map[string]string           `json:"tags,omitempty"`
+	GapTimeout    time.Duration               `json:"gap_timeout,omitempty"`
+	Record        *models.UsageRecord         `json:"record,omitempty"`
+	LabelQuery    *models.LabelQuery          `json:"label_query,omitempty"`
+	TopQuery      *models.TopQuery            `json:"top_query,omitempty"`
+	Failure       *models.UpstreamFailure     `json:"failure,omitempty"`
+	Decision      *models.BudgetDecision      `json:"decision,omitempty"`
+	DecisionQuery *models.BudgetDecisionQuery `json:"decision_query,omitempty"`
+	Batch         *models.BatchJob            `json:"batch,omitempty"`
+	ID            string                      `json:"id,omitempty"`
+	Status        string                      `json:"status,omitempty"`
+	At            time.Time                   `json:"at,omitzero"`
+	Policy        *models.ManagedBudgetPolicy `json:"policy,omitempty"`
+	PolicyID      int64                       `json:"policy_id,omitempty"`
+}
+
+// remoteError is the body of a failed call.
+type remoteError struct {
+	Error string `json:"error"`
+}
+
+// Remote implements Tracker by calling a tracker server, so several proxy
+// replicas can share one usage store and see each other's usage in
+// budget checks.
+type Remote struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+var _ Tracker = (*Remote)(nil)
+
+// NewRemote returns a Tracker that calls the tracker server at baseURL,
+// authenticating with token. Each call times out after timeout.
+func NewRemote(baseURL, token string, timeout time.Duration) *Remote {
+	return &Remote{
+		url:    strings.TrimSuffix(baseURL, "/") + remotePath,
+		token:  token,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// call invokes method with args and decodes the result into out, unless
+// out is nil.
+func (r *Remote) call(ctx context.Context, method string, args remoteArgs, out any) error {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("remote tracker %s: %w", method, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url+method, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("remote tracker %s: %w", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.token)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("remote tracker %s: %w", method, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		var e remoteError
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(raw, &e) != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(string(raw))
+		}
+		if resp.StatusCode == http.StatusNotFound && e.Error == ErrNotFound.Error() {
+			return fmt.Errorf("remote tracker %s: %w", method, ErrNotFound)
+		}
+		return fmt.Errorf("remote tracker %s: %s: %s", method, resp.Status, e.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("remote tracker %s: decode: %w", method, err)
+	}
+	return nil
+}
+
+// Record sends a usage record to the server.
+func (r *Remote) Record(ctx context.Context, rec models.UsageRecord) error {
+	return r.call(ctx, "Record", remoteArgs{Record: &rec}, nil)
+}
+
+// QueryByKey returns usage records for an API key since a given time.
+func (r *Remote) QueryByKey(ctx context.Context, apiKey string, since time.Time) ([]models.UsageRecord, error) {
+	var out []models.UsageRecord
+	return out, r.call(ctx, "QueryByKey", remoteArgs{APIKey: apiKey, Since: since}, &out)
+}
+
+// QuerySince returns all usage records since a given time, oldest first.
+func (r *Remote) QuerySince(ctx context.Context, since time.Time) ([]models.UsageRecord, error) {
+	var out []models.UsageRecord
+	return out, r.call(ctx, "QuerySince", remoteArgs{Since: since}, &out)
+}
+
+// TotalByKey returns total tokens used by an API key since a given time.
+func (r *Remote) TotalByKey(ctx context.Context, apiKey string, since time.Time) (int64, error) {
+	var out int64
+	return out, r.call(ctx, "TotalByKey", remoteArgs{APIKey: apiKey, Since: since}, &out)
+}
+
+// TotalByKeyAndModel returns total tokens used by an API key and model
+// since a given time.
+func (r *Remote) TotalByKeyAndModel(ctx context.Context, apiKey, model string, since time.Time) (int64, error) {
+	var out int64
+	return out, r.call(ctx, "TotalByKeyAndModel", remoteArgs{APIKey: apiKey, Model: model, Since: since}, &out)
+}
+
+// SpendByKey returns an API key's usage grouped by model.
+func (r *Remote) SpendByKey(ctx context.Context, apiKey, model string, since time.Time) ([]models.CostReport, error) {
+	var out []models.CostReport
+	return out, r.call(ctx, "SpendByKey", remoteArgs{APIKey: apiKey, Model: model, Since: since}, &out)
+}
+
+// SpendByLabels returns the usage of every key carrying labels grouped by
+// model.
+func (r *Remote) SpendByLabels(ctx context.Context, labels models.CostLabel, model string, since time.Time) ([]models.CostReport, error) {
+	var out []models.CostReport
+	return out, r.call(ctx, "SpendByLabels", remoteArgs{Labels: labels, Model: model, Since: since}, &out)
+}
+
+// AdjustmentTotal sums budget ledger entries.
+func (r *Remote) AdjustmentTotal(ctx context.Context, apiKey string, labels models.CostLabel, model string, since time.Time) (int64, float64, error) {
+	var out struct {
+		Tokens int64   `json:"tokens"`
+		USD    float64 `json:"usd"`
+	}
+	err := r.call(ctx, "AdjustmentTotal", remoteArgs{APIKey: apiKey, Labels: labels, Model: model, Since: since}, &out)
+	return out.Tokens, out.USD, err
+}
+
+// Summary returns aggregated usage, optionally for one API key.
+func (r *Remote) Summary(ctx context.Context, apiKey string) ([]models.UsageSummary, error) {
+	var out []models.UsageSummary
+	return out, r.call(ctx, "Summary", remoteArgs{APIKey: apiKey}, &out)
+}
+
+// ResolveSession returns a session ID for the given API key.
+func (r *Remote) ResolveSession(ctx context.Context, apiKey, explicitID string, gapTimeout time.Duration) (string, error) {
+	var out string
+	return out, r.call(ctx, "ResolveSession", remoteArgs{APIKey: apiKey, SessionID: explicitID, GapTimeout: gapTimeout}, &out)
+}
+
+// ListSessions returns the sessions matching q.
+func (r *Remote) ListSessions(ctx context.Context, q models.SessionQuery) ([]models.Session, error) {
+	var out []models.Session
+	return out, r.call(ctx, "ListSessions", remoteArgs{SessionQuery: q}, &out)
+}
+
+// UpdateSession names and tags a session.
+func (r *Remote) UpdateSession(ctx context.Context, id, name string, tags map[string]string) error {
+	return r.call(ctx, "UpdateSession", remoteArgs{SessionID: id, Name: name, Tags: tags}, nil)
+}
+
+// Top returns the values with the most usage.
+func (r *Remote) Top(ctx context.Context, q models.TopQuery) ([]models.TopEntry, error) {
+	var out []models.TopEntry
+	return out, r.call(ctx, "Top", remoteArgs{TopQuery: &q}, &out)
+}
+
+// SessionRequests returns per-request detail for a session.
+func (r *Remote) SessionRequests(ctx context.Context, sessionID string) ([]models.SessionRequest, error) {
+	var out []models.SessionRequest
+	return out, r.call(ctx, "SessionRequests", remoteArgs{SessionID: sessionID}, &out)
+}
+
+// CostReport returns usage grouped by team, project, and model.
+func (r *Remote) CostReport(ctx context.Context, since time.Time, team, project string) ([]models.CostReport, error) {
+	var out []models.CostReport
+	return out, r.call(ctx, "CostReport", remoteArgs{Since: since, Team: team, Project: project}, &out)
+}
+
+// LabelReport returns usage grouped by a label value and model.
+func (r *Remote) LabelReport(ctx context.Context, q models.LabelQuery) ([]models.LabelReport, error) {
+	var out []models.LabelReport
+	return out, r.call(ctx, "LabelReport", remoteArgs{LabelQuery: &q}, &out)
+}
+
+// Throughput returns output tokens/sec distributions per model and
+// provider.
+func (r *Remote) Throughput(ctx context.Context, since time.Time) ([]models.ThroughputStat, error) {
+	var out []models.ThroughputStat
+	return out, r.call(ctx, "Throughput", remoteArgs{Since: since}, &out)
+}
+
+// Latency returns upstream latency percentiles per model and provider.
+func (r *Remote) Latency(ctx context.Context, since time.Time) ([]models.LatencyStat, error) {
+	var out []models.LatencyStat
+	return out, r.call(ctx, "Latency", remoteArgs{Since: since}, &out)
+}
+
+// RecordFailure stores a failed upstream attempt.
+func (r *Remote) RecordFailure(ctx context.Context, f models.UpstreamFailure) error {
+	return r.call(ctx, "RecordFailure", remoteArgs{Failure: &f}, nil)
+}
+
+// ProviderReliability returns failure and fallback counts per provider.
+func (r *Remote) ProviderReliability(ctx context.Context, since time.Time) ([]models.ProviderReliability, error) {
+	var out []models.ProviderReliability
+	return out, r.call(ctx, "ProviderReliability", remoteArgs{Since: since}, &out)
+}
+
+// RecordDecision stores a budget decision.
+func (r *Remote) RecordDecision(ctx context.Context, d models.BudgetDecision) error {
+	return r.call(ctx, "RecordDecision", remoteArgs{Decision: &d}, nil)
+}
+
+// Decisions returns stored budget decisions matching a query.
+func (r *Remote) Decisions(ctx context.Context, q models.BudgetDecisionQuery) ([]models.BudgetDecision, error) {
+	var out []models.BudgetDecision
+	return out, r.call(ctx, "Decisions", remoteArgs{DecisionQuery: &q}, &out)
+}
+
+// RecordBatch stores a submitted Batch API job.
+func (r *Remote) RecordBatch(ctx context.Context, job models.BatchJob) error {
+	return r.call(ctx, "RecordBatch", remoteArgs{Batch: &job}, nil)
+}
+
+// PendingBatches returns batch jobs that have not finished.
+func (r *Remote) PendingBatches(ctx context.Context) ([]models.BatchJob, error) {
+	var out []models.BatchJob
+	return out, r.call(ctx, "PendingBatches", remoteArgs{}, &out)
+}
+
+// FinishBatch marks a batch job finished.
+func (r *Remote) FinishBatch(ctx context.Context, id, status string, at time.Time) error {
+	return r.call(ctx, "FinishBatch", remoteArgs{ID: id, Status: status, At: at}, nil)
+}
+
+// ManagedPolicies returns the server's managed budget policies.
+func (r *Remote) ManagedPolicies(ctx context.Context) ([]models.ManagedBudgetPolicy, error) {
+	var out []models.ManagedBudgetPolicy
+	return out, r.call(ctx, "ManagedPolicies", remoteArgs{}, &out)
+}
+
+// CreatePolicy stores a managed budget policy on the server.
+func (r *Remote) CreatePolicy(ctx context.Context, p models.ManagedBudgetPolicy) (models.ManagedBudgetPolicy, error) {
+	var out models.ManagedBudgetPolicy
+	return out, r.call(ctx, "CreatePolicy", remoteArgs{Policy: &p}, &out)
+}
+
+// UpdatePolicy replaces a managed budget policy on the server. It returns
+// ErrNotFound if there is none with p's ID.
+func (r *Remote) UpdatePolicy(ctx context.Context, p models.ManagedBudgetPolicy) (models.ManagedBudgetPolicy, error) {
+	var out models.ManagedBudgetPolicy
+	return out, r.call(ctx, "UpdatePolicy", remoteArgs{Policy: &p}, &out)
+}
+
+// DeletePolicy removes a managed budget policy from the server. It returns
+// ErrNotFound if there is none with the ID.
+func (r *Remote) DeletePolicy(ctx context.Context, id int64) error {
+	return r.call(ctx, "DeletePolicy", remoteArgs{PolicyID: id}, nil)
+}
+
+// Close releases idle connections. The server's store stays open.
+func (r *Remote) Close() error {
+	r.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,153 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func newTestRemote(t *testing.T, token string) (*Remote, *SQLiteTracker) {
+	t.Helper()
+	store := newTestTracker(t)
+	srv := httptest.NewServer(Handler(store, "secret"))
+	t.Cleanup(srv.Close)
+	r := NewRemote(srv.URL, token, 5*time.Second)
+	t.Cleanup(func() { _ = r.Close() })
+	return r, store
+}
+
+func TestRemote(t *testing.T) {
+	r, store := newTestRemote(t, "secret")
+	ctx := context.Background()
+	since := time.Now().Add(-time.Hour)
+
+	rec := models.UsageRecord{
+		APIKey: "k1", Model: "gpt-4", Provider: "openai", Team: "a",
+		PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150, CacheReadTokens: 40, CreatedAt: time.Now().UTC(),
+	}
+	if err := r.Record(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+
+	// The record lands in the server's store.
+	if got, _ := store.TotalByKey(ctx, "k1", since); got != 150 {
+		t.Errorf("store total = %d, want 150", got)
+	}
+	total, err := r.TotalByKey(ctx, "k1", since)
+	if err != nil || total != 150 {
+		t.Errorf("TotalByKey = %d, %v", total, err)
+	}
+	spend, err := r.SpendByKey(ctx, "k1", "", since)
+	if err != nil || len(spend) != 1 || spend[0].CacheReadTokens != 40 {
+		t.Errorf("SpendByKey = %+v, %v", spend, err)
+	}
+	tokens, usd, err := r.AdjustmentTotal(ctx, "k1", models.CostLabel{}, "", since)
+	if err != nil || tokens != 0 || usd != 0 {
+		t.Errorf("AdjustmentTotal = %d, %v, %v", tokens, usd, err)
+	}
+	recs, err := r.QueryByKey(ctx, "k1", since)
+	if err != nil || len(recs) != 1 || recs[0].Team != "a" {
+		t.Errorf("QueryByKey = %+v, %v", recs, err)
+	}
+
+	id, err := r.ResolveSession(ctx, "k1", "", 30*time.Minute)
+	if err != nil || id == "" {
+		t.Fatalf("ResolveSession = %q, %v", id, err)
+	}
+	if again, _ := r.ResolveSession(ctx, "k1", "", 30*time.Minute); again != id {
+		t.Errorf("second ResolveSession = %q, want %q", again, id)
+	}
+
+	report, err := r.LabelReport(ctx, models.LabelQuery{Since: since, GroupBy: "provider"})
+	if err != nil || len(report) != 1 || report[0].Value != "openai" {
+		t.Errorf("LabelReport = %+v, %v", report, err)
+	}
+}
+
+func TestRemoteAuth(t *testing.T) {
+	r, _ := newTestRemote(t, "wrong")
+	err := r.Record(context.Background(), models.UsageRecord{APIKey: "k1"})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Record with a bad token = %v, want 401", err)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	srv := httptest.NewServer(Handler(newTestTracker(t), "secret"))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"unknown method", http.MethodPost, "Drop", "{}", http.StatusNotFound},
+		{"get", http.MethodGet, "Summary", "", http.StatusMethodNotAllowed},
+		{"bad json", http.MethodPost, "Summary", "{", http.StatusBadRequest},
+		{"missing record", http.MethodPost, "Record", "{}", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, srv.URL+remotePath+tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer secret")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemotePolicies(t *testing.T) {
+	r, store := newTestRemote(t, "secret")
+	ctx := context.Background()
+
+	p, err := r.CreatePolicy(ctx, models.ManagedBudgetPolicy{
+		BudgetPolicy: models.BudgetPolicy{APIKey: "sk-batch", MaxTokens: 2000, Period: models.BudgetDaily},
+	})
+	if err != nil || p.ID == 0 {
+		t.Fatalf("CreatePolicy = %+v, %v", p, err)
+	}
+	p.MaxTokens = 3000
+	if _, err := r.UpdatePolicy(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.ManagedPolicies(ctx)
+	if err != nil || len(stored) != 1 || stored[0].MaxTokens != 3000 {
+		t.Errorf("stored policies = %+v, %v", stored, err)
+	}
+	got, err := r.ManagedPolicies(ctx)
+	if err != nil || len(got) != 1 || got[0].ID != p.ID {
+		t.Errorf("ManagedPolicies = %+v, %v", got, err)
+	}
+
+	if _, err := r.UpdatePolicy(ctx, models.ManagedBudgetPolicy{ID: 99}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("update missing = %v, want ErrNotFound", err)
+	}
+	if err := r.DeletePolicy(ctx, p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeletePolicy(ctx, p.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("delete missing = %v, want ErrNotFound", err)
+	}
+
+	// A server without a policy store says so.
+	srv := httptest.NewServer(Handler(NewMemory(), "secret"))
+	defer srv.Close()
+	mem := NewRemote(srv.URL, "secret", 5*time.Second)
+	if _, err := mem.ManagedPolicies(ctx); err == nil || !strings.Contains(err.Error(), "501") {
+		t.Errorf("ManagedPolicies from a memory tracker = %v, want 501", err)
+	}
+}
@@ -0,0 +1,239 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/dbmaint"
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// Rollup periods.
+const (
+	RollupHourly = "hourly"
+	RollupDaily  = "daily"
+)
+
+const createRollupsTable = `
+CREATE TABLE IF NOT EXISTS usage_rollups (
+	period TEXT NOT NULL,
+	bucket TEXT NOT NULL,
+	api_key TEXT NOT NULL,
+	model TEXT NOT NULL,
+	provider TEXT NOT NULL,
+	team TEXT NOT NULL,
+	project TEXT NOT NULL,
+	env TEXT NOT NULL,
+	endpoint TEXT NOT NULL,
+	requests INTEGER NOT NULL,
+	prompt_tokens INTEGER NOT NULL,
+	completion_tokens INTEGER NOT NULL,
+	total_tokens INTEGER NOT NULL,
+	media_cost_usd REAL NOT NULL,
+	PRIMARY KEY (period, bucket, api_key, model, provider, team, project, env, endpoint)
+);
+CREATE TABLE IF NOT EXISTS rollup_state (
+	name TEXT PRIMARY KEY,
+	at DATETIME NOT NULL
+);
+`
+
+// rollupColumns lists usage_rollups columns added after the initial schema.
+var rollupColumns = []struct{ name, def string }{
+	{"estimated_cost_usd", "REAL NOT NULL DEFAULT 0"},
+}
+
+// Names of rollup_state rows. rolledUntil is the end of the last hour
+// rolled up; rawSince is the cutoff of the last raw record prune, before
+// which rollups can no longer be recomputed.
+const (
+	rolledUntil = "rolled_until"
+	rawSince    = "raw_since"
+)
+
+// rollupDelay holds back the latest hour's rollup so that records written
+// late, e.g. from the async queue, are part of it.
+const rollupDelay = 5 * time.Minute
+
+// bucketFormat is how rollup buckets are stored, in UTC.
+const bucketFormat = "2006-01-02 15:04:05"
+
+// hourExpr is the hour bucket of a usage record. Records are stored in
+// UTC, and the driver's time format starts with the bucketFormat fields,
+// so the bucket is a prefix of created_at.
+const hourExpr = `substr(created_at, 1, 13) || ':00:00'`
+
+// Rollup aggregates usage records into hourly and daily buckets up to the
+// last full hour before now. Buckets from the previous run on are
+// recomputed, and re-imported ranges are recomputed too, so Rollup can run
+// at any interval. Daily buckets are UTC days and include the current,
+// partial day.
+func (t *SQLiteTracker) Rollup(ctx context.Context, now time.Time) error {
+	end := now.Add(-rollupDelay).UTC().Truncate(time.Hour)
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin rollup: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	start, err := rollupState(ctx, tx, rolledUntil)
+	if err != nil {
+		return err
+	}
+	if start.IsZero() {
+		var first sql.NullString
+		if err := tx.QueryRowContext(ctx, `SELECT MIN(b) FROM (SELECT MIN(`+hourExpr+`) AS b FROM usage_records
+			 UNION ALL SELECT MIN(substr(bucket, 1, 13) || ':00:00') FROM usage_unsampled)`).Scan(&first); err != nil {
+			return fmt.Errorf("rollup start: %w", err)
+		}
+		if !first.Valid {
+			return nil
+		}
+		if start, err = time.Parse(bucketFormat, first.String); err != nil {
+			return fmt.Errorf("rollup start: %w", err)
+		}
+	}
+	raw, err := rollupState(ctx, tx, rawSince)
+	if err != nil {
+		return err
+	}
+	// Hours whose records were pruned, even in part, can't be recomputed.
+	if h := raw.Truncate(time.Hour); h.Before(raw) {
+		raw = h.Add(time.Hour)
+	}
+	if start.Before(raw) {
+		start = raw
+	}
+	if !start.Before(end) {
+		return nil
+	}
+
+	from, to := start.UTC().Format(bucketFormat), end.Format(bucketFormat)
+	if _, err := tx.ExecContext(ctx, `DELETE FROM usage_rollups WHERE period = ? AND bucket >= ? AND bucket < ?`,
+		RollupHourly, from, to); err != nil {
+		return fmt.Errorf("clear hourly rollups: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO usage_rollups (period, bucket, api_key, model, provider, team, project, env, endpoint,
+		 requests, prompt_tokens, completion_tokens, total_tokens, media_cost_usd, estimated_cost_usd)
+		 SELECT ?, b, api_key, model, provider, team, project, env, endpoint,
+		 SUM(requests), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), SUM(media_cost_usd), `+costSum+`
+		 FROM (SELECT `+hourExpr+` AS b, api_key, model, provider, team, project, env, endpoint, 1 AS requests,
+		       prompt_tokens, completion_tokens, total_tokens, media_cost_usd, estimated_cost_usd
+		       FROM usage_records WHERE created_at >= ? AND created_at < ?
+		       UNION ALL SELECT substr(bucket, 1, 13) || ':00:00', api_key, model, provider, team, project, env, endpoint, requests,
+		       prompt_tokens, completion_tokens, total_tokens, media_cost_usd, estimated_cost_usd
+		       FROM usage_unsampled WHERE bucket >= ? AND bucket < ?)
+		 GROUP BY b, api_key, model, provider, team, project, env, endpoint`,
+		RollupHourly, start, end, start, end); err != nil {
+		return fmt.Errorf("roll up hours: %w", err)
+	}
+
+	// Days are rebuilt from their hours, whole days at a time.
+	dayFrom := start.UTC().Truncate(24 * time.Hour).Format(bucketFormat)
+	if _, err := tx.ExecContext(ctx, `DELETE FROM usage_rollups WHERE period = ? AND bucket >= ?`,
+		RollupDaily, dayFrom); err != nil {
+		return fmt.Errorf("clear daily rollups: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO usage_rollups (period, bucket, api_key, model, provider, team, project, env, endpoint,
+		 requests, prompt_tokens, completion_tokens, total_tokens, media_cost_usd, estimated_cost_usd)
+		 SELECT ?, substr(bucket, 1, 10) || ' 00:00:00', api_key, model, provider, team, project, env, endpoint,
+		 SUM(requests), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), SUM(media_cost_usd), SUM(estimated_cost_usd)
+		 FROM usage_rollups WHERE period = ? AND bucket >= ?
+		 GROUP BY substr(bucket, 1, 10), api_key, model, provider, team, project, env, endpoint`,
+		RollupDaily, RollupHourly, dayFrom); err != nil {
+		return fmt.Errorf("roll up days: %w", err)
+	}
+
+	if err := setRollupState(ctx, tx, rolledUntil, end); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit rollup: %w", err)
+	}
+	return nil
+}
+
+// rollupState returns the time stored under name, or the zero time.
+func rollupState(ctx context.Context, tx *sql.Tx, name string) (time.Time, error) {
+	var at time.Time
+	err := tx.QueryRowContext(ctx, `SELECT at FROM rollup_state WHERE name = ?`, name).Scan(&at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("read rollup state: %w", err)
+	}
+	return at.UTC(), nil
+}
+
+// setRollupState stores at under name.
+func setRollupState(ctx context.Context, tx *sql.Tx, name string, at time.Time) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO rollup_state (name, at) VALUES (?, ?) ON CONFLICT(name) DO UPDATE SET at = excluded.at`,
+		name, at.UTC())
+	if err != nil {
+		return fmt.Errorf("write rollup state: %w", err)
+	}
+	return nil
+}
+
+// rewindRollups makes the next Rollup recompute the hours from since on,
+// after records in that range changed.
+func rewindRollups(ctx context.Context, tx *sql.Tx, since time.Time) error {
+	until, err := rollupState(ctx, tx, rolledUntil)
+	if err != nil || until.IsZero() || !since.Before(until) {
+		return err
+	}
+	return setRollupState(ctx, tx, rolledUntil, since.UTC().Truncate(time.Hour))
+}
+
+// Rollups returns the period's ("hourly" or "daily") buckets starting at
+// or after since, optionally for one API key, oldest first.
+func (t *SQLiteTracker) Rollups(ctx context.Context, period string, apiKey string, since time.Time) ([]models.UsageRollup, error) {
+	if period != RollupHourly && period != RollupDaily {
+		return nil, fmt.Errorf("rollups: unknown period %q", period)
+	}
+	query := `SELECT bucket, api_key, model, provider, team, project, env, endpoint,
+		 requests, prompt_tokens, completion_tokens, total_tokens, media_cost_usd, estimated_cost_usd
+		 FROM usage_rollups WHERE period = ? AND bucket >= ?`
+	args := []any{period, since.UTC().Format(bucketFormat)}
+	if apiKey != "" {
+		query += ` AND api_key = ?`
+		args = append(args, apiKey)
+	}
+	query += ` ORDER BY bucket, api_key, model, provider, team, project, env, endpoint`
+
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query rollups: %w", err)
+	}
+	defer rows.Close()
+
+	var rollups []models.UsageRollup
+	for rows.Next() {
+		r := models.UsageRollup{Period: period}
+		var bucket string
+		if err := rows.Scan(&bucket, &r.APIKey, &r.Model, &r.Provider, &r.Team, &r.Project, &r.Env, &r.Endpoint,
+			&r.RequestCount, &r.PromptTokens, &r.CompletionTokens, &r.TotalTokens, &r.MediaCostUSD, &r.EstimatedCostUSD); err != nil {
+			return nil, fmt.Errorf("scan rollup: %w", err)
+		}
+		if r.Bucket, err = time.Parse(bucketFormat, bucket); err != nil {
+			return nil, fmt.Errorf("scan rollup: %w", err)
+		}
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+// PruneRollups deletes the period's buckets that start before the cutoff.
+// With dryRun set it only reports what would be deleted.
+func (t *SQLiteTracker) PruneRollups(ctx context.Context, period string, before time.Time, dryRun bool) (dbmaint.PruneResult, error) {
+	return dbmaint.Prune(ctx, t.db, "usage_rollups", "period = ? AND bucket < ?", dryRun,
+		period, before.UTC().Format(bucketFormat))
+}
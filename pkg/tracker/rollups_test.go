@@ -0,0 +1,111 @@
+package tracker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestRollup(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	for _, rec := range []models.UsageRecord{
+		{APIKey: "k1", Model: "gpt-4", Team: "a", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, CreatedAt: day.Add(9*time.Hour + 10*time.Minute)},
+		{APIKey: "k1", Model: "gpt-4", Team: "a", PromptTokens: 20, CompletionTokens: 5, TotalTokens: 25, CreatedAt: day.Add(9*time.Hour + 50*time.Minute)},
+		{APIKey: "k1", Model: "gpt-4", Team: "a", PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2, CreatedAt: day.Add(11 * time.Hour)},
+		{APIKey: "k2", Model: "claude", TotalTokens: 7, MediaCostUSD: 0.25, EstimatedCostUSD: 0.25, CreatedAt: day.Add(9 * time.Hour)},
+		// Not rolled up yet: the hour isn't over.
+		{APIKey: "k1", Model: "gpt-4", Team: "a", TotalTokens: 1000, CreatedAt: day.Add(12*time.Hour + time.Minute)},
+	} {
+		if err := tr.Record(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tr.Rollup(ctx, day.Add(12*time.Hour+30*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	hourly, err := tr.Rollups(ctx, RollupHourly, "k1", day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hourly) != 2 {
+		t.Fatalf("hourly rollups = %+v", hourly)
+	}
+	if h := hourly[0]; !h.Bucket.Equal(day.Add(9*time.Hour)) || h.RequestCount != 2 || h.PromptTokens != 30 || h.TotalTokens != 40 || h.Team != "a" {
+		t.Errorf("09:00 rollup = %+v", h)
+	}
+	daily, _ := tr.Rollups(ctx, RollupDaily, "", day)
+	if len(daily) != 2 || daily[0].APIKey != "k1" || daily[0].TotalTokens != 42 || daily[1].MediaCostUSD != 0.25 || daily[1].EstimatedCostUSD != 0.25 {
+		t.Fatalf("daily rollups = %+v", daily)
+	}
+
+	// The next run picks up the finished hour.
+	if err := tr.Rollup(ctx, day.Add(13*time.Hour+30*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	daily, _ = tr.Rollups(ctx, RollupDaily, "k1", day)
+	if len(daily) != 1 || daily[0].TotalTokens != 1042 || daily[0].RequestCount != 4 {
+		t.Errorf("daily rollup after second run = %+v", daily)
+	}
+
+	// Pruning raw records keeps their rollups.
+	if _, err := tr.PruneUsage(ctx, day.Add(24*time.Hour), false); err != nil {
+		t.Fatal(err)
+	}
+	if recs, _ := tr.QuerySince(ctx, day); len(recs) != 0 {
+		t.Fatalf("records after prune = %d", len(recs))
+	}
+	if err := tr.Rollup(ctx, day.Add(48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	daily, _ = tr.Rollups(ctx, RollupDaily, "k1", day)
+	if len(daily) != 1 || daily[0].TotalTokens != 1042 {
+		t.Errorf("daily rollup after prune = %+v", daily)
+	}
+
+	res, err := tr.PruneRollups(ctx, RollupHourly, day.Add(24*time.Hour), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Rows != 4 {
+		t.Errorf("pruned hourly rollups = %d, want 4", res.Rows)
+	}
+	if daily, _ := tr.Rollups(ctx, RollupDaily, "", day); len(daily) != 2 {
+		t.Errorf("daily rollups after hourly prune = %+v", daily)
+	}
+}
+
+func TestRollupReimport(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	import1 := []models.UsageRecord{{APIKey: "imported:openai", Model: "gpt-4", TotalTokens: 100, CreatedAt: day}}
+	if err := tr.ReplaceImported(ctx, "openai", day, day.Add(24*time.Hour), import1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Rollup(ctx, day.Add(72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Re-importing the range recomputes its rollups.
+	import2 := []models.UsageRecord{{APIKey: "imported:openai", Model: "gpt-4", TotalTokens: 300, CreatedAt: day}}
+	if err := tr.ReplaceImported(ctx, "openai", day, day.Add(24*time.Hour), import2); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Rollup(ctx, day.Add(72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	daily, _ := tr.Rollups(ctx, RollupDaily, "", day)
+	if len(daily) != 1 || daily[0].TotalTokens != 300 || daily[0].Provider != "openai" {
+		t.Errorf("daily rollups = %+v", daily)
+	}
+
+	if _, err := tr.Rollups(ctx, "weekly", "", day); err == nil {
+		t.Error("unknown period: want error")
+	}
+}
@@ -0,0 +1,124 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// createUnsampledTable holds the totals of usage records left out of
+// usage_records by sampling, per minute and rollup dimensions.
+const createUnsampledTable = `
+CREATE TABLE IF NOT EXISTS usage_unsampled (
+	bucket DATETIME NOT NULL,
+	api_key TEXT NOT NULL,
+	model TEXT NOT NULL,
+	provider TEXT NOT NULL,
+	team TEXT NOT NULL,
+	project TEXT NOT NULL,
+	env TEXT NOT NULL,
+	endpoint TEXT NOT NULL,
+	requests INTEGER NOT NULL,
+	prompt_tokens INTEGER NOT NULL,
+	completion_tokens INTEGER NOT NULL,
+	total_tokens INTEGER NOT NULL,
+	cache_read_tokens INTEGER NOT NULL,
+	cache_creation_tokens INTEGER NOT NULL,
+	reasoning_tokens INTEGER NOT NULL,
+	media_cost_usd REAL NOT NULL,
+	estimated_cost_usd REAL NOT NULL,
+	PRIMARY KEY (bucket, api_key, model, provider, team, project, env, endpoint)
+);
+CREATE INDEX IF NOT EXISTS idx_usage_unsampled_key ON usage_unsampled(api_key, bucket);
+CREATE TABLE IF NOT EXISTS usage_unsampled_keys (
+	request_id TEXT NOT NULL,
+	attempt INTEGER NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (request_id, attempt)
+) WITHOUT ROWID;
+`
+
+// claimUnsampledKey stores the idempotency key of a record left out by
+// sampling, or does nothing if it was already stored.
+const claimUnsampledKey = `INSERT OR IGNORE INTO usage_unsampled_keys (request_id, attempt, created_at) VALUES (?, ?, ?)`
+
+// addUnsampled adds a record to its minute's totals.
+const addUnsampled = `INSERT INTO usage_unsampled (bucket, api_key, model, provider, team, project, env, endpoint,
+	requests, prompt_tokens, completion_tokens, total_tokens, cache_read_tokens, cache_creation_tokens, reasoning_tokens,
+	media_cost_usd, estimated_cost_usd)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (bucket, api_key, model, provider, team, project, env, endpoint) DO UPDATE SET
+	requests = requests + 1,
+	prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+	completion_tokens = completion_tokens + excluded.completion_tokens,
+	total_tokens = total_tokens + excluded.total_tokens,
+	cache_read_tokens = cache_read_tokens + excluded.cache_read_tokens,
+	cache_creation_tokens = cache_creation_tokens + excluded.cache_creation_tokens,
+	reasoning_tokens = reasoning_tokens + excluded.reasoning_tokens,
+	media_cost_usd = media_cost_usd + excluded.media_cost_usd,
+	estimated_cost_usd = estimated_cost_usd + excluded.estimated_cost_usd`
+
+// budgetUsage is the usage budgets count: stored records plus the totals
+// of records left out by sampling, one row per request or minute.
+const budgetUsage = `(SELECT api_key, model, team, project, env, created_at, 1 AS requests,
+	prompt_tokens, completion_tokens, total_tokens, cache_read_tokens, cache_creation_tokens, reasoning_tokens,
+	media_cost_usd, estimated_cost_usd FROM usage_records
+	UNION ALL SELECT api_key, model, team, project, env, bucket, requests,
+	prompt_tokens, completion_tokens, total_tokens, cache_read_tokens, cache_creation_tokens, reasoning_tokens,
+	media_cost_usd, estimated_cost_usd FROM usage_unsampled)`
+
+// UseSampling makes Record store about rate (between 0 and 1) of usage
+// records as rows. The rest are added to per-minute totals instead, which
+// budgets, key counters, sessions, and rollups count, so those stay exact
+// while reports read from rows see a sample. All attempts of a request are
+// kept or left out together. Call it before the tracker is shared.
+func (t *SQLiteTracker) UseSampling(rate float64) {
+	t.sampleRate = rate
+}
+
+// keep reports whether rec is stored as a row under sampling.
+func (t *SQLiteTracker) keep(rec models.UsageRecord) bool {
+	if t.sampleRate <= 0 || t.sampleRate >= 1 || rec.Imported {
+		return true
+	}
+	if rec.RequestID == "" {
+		return rand.Float64() < t.sampleRate
+	}
+	h := fnv.New64a()
+	h.Write([]byte(rec.RequestID))
+	return float64(h.Sum64())/math.MaxUint64 < t.sampleRate
+}
+
+// insertUnsampled adds rec to its minute's totals and updates its
+// session's counters. It returns false, and adds nothing, if a record with
+// the same request ID and attempt was already added; only its key is kept,
+// so duplicates are still ignored.
+func insertUnsampled(ctx context.Context, stmts recordStmts, rec models.UsageRecord) (bool, error) {
+	if rec.RequestID != "" {
+		res, err := stmts.unsampledKey.ExecContext(ctx, rec.RequestID, rec.Attempt, rec.CreatedAt)
+		if err != nil {
+			return false, fmt.Errorf("record unsampled usage: %w", err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return false, nil
+		}
+	}
+	_, err := stmts.unsampled.ExecContext(ctx, rec.CreatedAt.UTC().Truncate(time.Minute),
+		rec.APIKey, rec.Model, rec.Provider, rec.Team, rec.Project, rec.Env, rec.Endpoint,
+		rec.PromptTokens, rec.CompletionTokens, rec.TotalTokens, rec.CacheReadTokens, rec.CacheCreationTokens, rec.ReasoningTokens,
+		rec.MediaCostUSD, rec.EstimatedCostUSD)
+	if err != nil {
+		return false, fmt.Errorf("record unsampled usage: %w", err)
+	}
+	if rec.SessionID != "" {
+		if _, err := stmts.session.ExecContext(ctx, rec.CreatedAt, rec.TotalTokens, rec.SessionID); err != nil {
+			return false, fmt.Errorf("update session counters: %w", err)
+		}
+	}
+	return true, nil
+}
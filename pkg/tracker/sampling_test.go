@@ -0,0 +1,104 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestSamplingKeepsTotalsExact(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	now := day.Add(9 * time.Hour)
+
+	for _, async := range []bool{false, true} {
+		t.Run(fmt.Sprintf("async=%v", async), func(t *testing.T) {
+			tr := newTestTracker(t)
+			tr.UseSampling(0.1)
+			tr.UseCounters(newMemCounters(), dailyPeriods)
+			if async {
+				tr.UseAsyncWrites(2000, 100, time.Hour)
+			}
+			if _, err := tr.ResolveSession(ctx, "k1", "s1", 0); err != nil {
+				t.Fatal(err)
+			}
+
+			const n = 1000
+			for i := range n {
+				rec := models.UsageRecord{RequestID: fmt.Sprintf("req_%d", i), Attempt: 1, APIKey: "k1", Model: "gpt-4", Team: "a",
+					SessionID: "s1", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, EstimatedCostUSD: 0.01,
+					CreatedAt: now.Add(time.Duration(i) * time.Second)}
+				if err := tr.Record(ctx, rec); err != nil {
+					t.Fatal(err)
+				}
+				// A retried write is ignored whether or not the record
+				// was kept.
+				if i%10 == 0 {
+					if err := tr.Record(ctx, rec); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if async {
+				tr.async.stop()
+			}
+
+			// Only a sample is stored as rows, and all attempts of a
+			// request are sampled alike.
+			var rows int
+			if err := tr.db.QueryRow(`SELECT COUNT(*) FROM usage_records`).Scan(&rows); err != nil {
+				t.Fatal(err)
+			}
+			if rows < n/20 || rows > n/5 {
+				t.Errorf("stored %d of %d records, want about %d", rows, n, n/10)
+			}
+			if tr.keep(models.UsageRecord{RequestID: "req_0", Attempt: 1}) != tr.keep(models.UsageRecord{RequestID: "req_0", Attempt: 2}) {
+				t.Error("attempts of one request sampled differently")
+			}
+
+			// Counters, budget queries, sessions, and rollups count every
+			// record.
+			if total, _ := tr.TotalByKey(ctx, "k1", day); total != n*15 {
+				t.Errorf("counted total = %d, want %d", total, n*15)
+			}
+			if total, _ := tr.TotalByKeyAndModel(ctx, "k1", "gpt-4", now); total != n*15 {
+				t.Errorf("database total = %d, want %d", total, n*15)
+			}
+			spend, err := tr.SpendByKey(ctx, "k1", "", now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(spend) != 1 || spend[0].RequestCount != n || spend[0].PromptTokens != n*10 || spend[0].EstimatedCost < 9.999 || spend[0].EstimatedCost > 10.001 {
+				t.Errorf("spend = %+v", spend)
+			}
+			labels, _ := tr.SpendByLabels(ctx, models.CostLabel{Team: "a"}, "", now)
+			if len(labels) != 1 || labels[0].RequestCount != n {
+				t.Errorf("label spend = %+v", labels)
+			}
+			sessions, _ := tr.ListSessions(ctx, models.SessionQuery{APIKey: "k1"})
+			if len(sessions) != 1 || sessions[0].RequestCount != n || sessions[0].TotalTokens != n*15 {
+				t.Errorf("sessions = %+v", sessions)
+			}
+
+			if err := tr.Rollup(ctx, day.Add(12*time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			hourly, err := tr.Rollups(ctx, RollupHourly, "k1", now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var requests int
+			var tokens int64
+			for _, r := range hourly {
+				requests += r.RequestCount
+				tokens += r.TotalTokens
+			}
+			if requests != n || tokens != n*15 {
+				t.Errorf("hourly rollups = %d requests, %d tokens; want %d, %d", requests, tokens, n, n*15)
+			}
+		})
+	}
+}
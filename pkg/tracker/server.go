@@ -0,0 +1,210 @@
+package tracker
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// maxRemoteBody bounds the request body of a remote tracker call.
+const maxRemoteBody = 1 << 20
+
+// remoteMethods maps each Tracker method a Remote calls to how the server
+// runs it.
+var remoteMethods = map[string]func(ctx context.Context, tr Tracker, a remoteArgs) (any, error){
+	"Record": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		if a.Record == nil {
+			return nil, errBadArgs
+		}
+		return nil, tr.Record(ctx, *a.Record)
+	},
+	"QueryByKey": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return tr.QueryByKey(ctx, a.APIKey, a.Since)
+	},
+	"QuerySince": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return tr.QuerySince(ctx, a.Since)
+	},
+	"TotalByKey": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return tr.TotalByKey(ctx, a.APIKey, a.Since)
+	},
+	"TotalByKeyAndModel": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return tr.TotalByKeyAndModel(ctx, a.APIKey, a.Model, a.Since)
+	},
+	"SpendByKey": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return tr.SpendByKey(ctx, a.APIKey, a.Model, a.Since)
+	},
+	"SpendByLabels": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return tr.SpendByLabels(ctx, a.Labels, a.Model, a.Since)
+	},
+	"AdjustmentTotal": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		tokens, usd, err := tr.AdjustmentTotal(ctx, a.APIKey, a.Labels, a.Model, a.Since)
+		return map[string]any{"tokens": tokens, "usd": usd}, err
+	},
+	"Summary": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return tr.Summary(ctx, a.APIKey)
+	},
+	"ResolveSession": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return tr.ResolveSession(ctx, a.APIKey, a.SessionID, a.GapTimeout)
+	},
+	"ListSessions": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return tr.ListSessions(ctx, a.SessionQuery)
+	},
+	"UpdateSession": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return nil, tr.UpdateSession(ctx, a.SessionID, a.Name, a.Tags)
+	},
+	"Top": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		if a.TopQuery == nil {
+			return nil, errBadArgs
+		}
+		return tr.Top(ctx, *a.TopQuery)
+	},
+	"SessionRequests": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return tr.SessionRequests(ctx, a.SessionID)
+	},
+	"CostReport": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return tr.CostReport(ctx, a.Since, a.Team, a.Project)
+	},
+	"LabelReport": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		if a.LabelQuery == nil {
+			return nil, errBadArgs
+		}
+		return tr.LabelReport(ctx, *a.LabelQuery)
+	},
+	"Throughput": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return tr.Throughput(ctx, a.Since)
+	},
+	"Latency": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return tr.Latency(ctx, a.Since)
+	},
+	"RecordFailure": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		if a.Failure == nil {
+			return nil, errBadArgs
+		}
+		return nil, tr.RecordFailure(ctx, *a.Failure)
+	},
+	"ProviderReliability": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return tr.ProviderReliability(ctx, a.Since)
+	},
+	"RecordDecision": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		if a.Decision == nil {
+			return nil, errBadArgs
+		}
+		return nil, tr.RecordDecision(ctx, *a.Decision)
+	},
+	"Decisions": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		if a.DecisionQuery == nil {
+			return nil, errBadArgs
+		}
+		return tr.Decisions(ctx, *a.DecisionQuery)
+	},
+	"RecordBatch": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		if a.Batch == nil {
+			return nil, errBadArgs
+		}
+		return nil, tr.RecordBatch(ctx, *a.Batch)
+	},
+	"PendingBatches": func(ctx context.Context, tr Tracker, _ remoteArgs) (any, error) {
+		return tr.PendingBatches(ctx)
+	},
+	"FinishBatch": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		return nil, tr.FinishBatch(ctx, a.ID, a.Status, a.At)
+	},
+	"ManagedPolicies": func(ctx context.Context, tr Tracker, _ remoteArgs) (any, error) {
+		store, ok := tr.(PolicyStore)
+		if !ok {
+			return nil, errUnsupported
+		}
+		return store.ManagedPolicies(ctx)
+	},
+	"CreatePolicy": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		store, ok := tr.(PolicyStore)
+		if !ok {
+			return nil, errUnsupported
+		}
+		if a.Policy == nil {
+			return nil, errBadArgs
+		}
+		return store.CreatePolicy(ctx, *a.Policy)
+	},
+	"UpdatePolicy": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		store, ok := tr.(PolicyStore)
+		if !ok {
+			return nil, errUnsupported
+		}
+		if a.Policy == nil {
+			return nil, errBadArgs
+		}
+		return store.UpdatePolicy(ctx, *a.Policy)
+	},
+	"DeletePolicy": func(ctx context.Context, tr Tracker, a remoteArgs) (any, error) {
+		store, ok := tr.(PolicyStore)
+		if !ok {
+			return nil, errUnsupported
+		}
+		return nil, store.DeletePolicy(ctx, a.PolicyID)
+	},
+}
+
+var (
+	// errBadArgs rejects a call missing a required argument.
+	errBadArgs = errors.New("missing arguments")
+	// errUnsupported rejects a call the served tracker can't handle.
+	errUnsupported = errors.New("not supported by this tracker")
+)
+
+// Handler serves tr to Remote trackers at /pario/tracker/<method>. Every
+// call must carry token as a bearer token.
+func Handler(tr Tracker, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeRemoteError(w, http.StatusUnauthorized, "invalid tracker token")
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeRemoteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		method, ok := remoteMethods[strings.TrimPrefix(r.URL.Path, remotePath)]
+		if !ok {
+			writeRemoteError(w, http.StatusNotFound, "unknown tracker method")
+			return
+		}
+		var args remoteArgs
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRemoteBody)).Decode(&args); err != nil {
+			writeRemoteError(w, http.StatusBadRequest, "invalid arguments: "+err.Error())
+			return
+		}
+		out, err := method(r.Context(), tr, args)
+		if errors.Is(err, errBadArgs) {
+			writeRemoteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, ErrNotFound) {
+			// Remote matches the bare message to return ErrNotFound.
+			writeRemoteError(w, http.StatusNotFound, ErrNotFound.Error())
+			return
+		}
+		if errors.Is(err, errUnsupported) {
+			writeRemoteError(w, http.StatusNotImplemented, err.Error())
+			return
+		}
+		if err != nil {
+			log.Printf("tracker %s: %v", r.URL.Path, err)
+			writeRemoteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	})
+}
+
+func writeRemoteError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(remoteError{Error: message})
+}
@@ -0,0 +1,168 @@
+package tracker
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// sessionColumns lists sessions columns added after the initial schema, in
+// the order they were introduced.
+var sessionColumns = []struct{ name, def string }{
+	{"ended_at", "DATETIME"},
+	{"name", "TEXT NOT NULL DEFAULT ''"},
+	{"tags", "TEXT NOT NULL DEFAULT '{}'"},
+}
+
+// createSessionActivityIndex serves session expiry and retention, which
+// both select by last activity.
+const createSessionActivityIndex = `
+CREATE INDEX IF NOT EXISTS idx_sessions_activity ON sessions(last_activity);
+`
+
+// sessionSelect reads the columns scanSession expects.
+const sessionSelect = `SELECT id, api_key, started_at, last_activity, request_count, total_tokens, ended_at, name, tags FROM sessions`
+
+// scanSession reads a row selected with sessionSelect.
+func scanSession(rows *sql.Rows) (models.Session, error) {
+	var s models.Session
+	var ended sql.NullTime
+	var tags string
+	if err := rows.Scan(&s.ID, &s.APIKey, &s.StartedAt, &s.LastActivity, &s.RequestCount, &s.TotalTokens, &ended, &s.Name, &tags); err != nil {
+		return s, fmt.Errorf("scan session: %w", err)
+	}
+	s.EndedAt = ended.Time
+	if tags != "" && tags != "{}" {
+		_ = json.Unmarshal([]byte(tags), &s.Tags)
+	}
+	return s, nil
+}
+
+// UpdateSession sets a session's name, unless name is empty, and merges
+// tags into its tags. It returns ErrNotFound if there is no such session.
+func (t *SQLiteTracker) UpdateSession(ctx context.Context, id, name string, tags map[string]string) error {
+	patch, err := encodeLabels(tags)
+	if err != nil {
+		return err
+	}
+	res, err := t.db.ExecContext(ctx,
+		`UPDATE sessions SET name = CASE WHEN ? = '' THEN name ELSE ? END, tags = json_patch(tags, ?) WHERE id = ?`,
+		name, name, patch, id)
+	if err != nil {
+		return fmt.Errorf("update session: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ExpireSessions ends open sessions whose last activity is before the
+// cutoff, stamping them with their last activity. Ended sessions are no
+// longer picked up by auto-detection; a new record in one, sent with an
+// explicit session ID, reopens it. It returns the number of sessions ended.
+func (t *SQLiteTracker) ExpireSessions(ctx context.Context, idleBefore time.Time) (int64, error) {
+	res, err := t.db.ExecContext(ctx,
+		`UPDATE sessions SET ended_at = last_activity WHERE ended_at IS NULL AND last_activity < ?`, idleBefore.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("expire sessions: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// ArchivedSession is a line of a session archive: a session and its usage
+// records, oldest first.
+type ArchivedSession struct {
+	models.Session
+	Records []models.UsageRecord `json:"records,omitempty"`
+}
+
+// ArchiveSessions writes sessions whose last activity is before the cutoff
+// to w as gzip-compressed JSON lines, one ArchivedSession each, then
+// deletes them, as PruneSessions would. Their usage records are copied
+// into the archive in the same transaction and kept in the database, where
+// retention.usage_days applies. Nothing is deleted unless the whole archive
+// was written. It returns the number of sessions archived.
+func (t *SQLiteTracker) ArchiveSessions(ctx context.Context, w io.Writer, before time.Time) (int64, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin archive: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, sessionSelect+` WHERE last_activity < ? ORDER BY id`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("archive sessions: %w", err)
+	}
+	var sessions []models.Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		sessions = append(sessions, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("archive sessions: %w", err)
+	}
+
+	// Records come in session ID order, like the sessions, so each session
+	// is written once its records have been read.
+	rows, err = tx.QueryContext(ctx, usageSelect+` WHERE session_id IN (SELECT id FROM sessions WHERE last_activity < ?)
+		 ORDER BY session_id, created_at, id`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("archive session usage: %w", err)
+	}
+	defer rows.Close()
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+	var n int
+	var cur ArchivedSession
+	if len(sessions) > 0 {
+		cur.Session = sessions[0]
+	}
+	for rows.Next() {
+		rec, err := scanUsageRow(rows)
+		if err != nil {
+			return 0, err
+		}
+		for cur.ID != rec.SessionID {
+			if err := enc.Encode(cur); err != nil {
+				return 0, fmt.Errorf("write session archive: %w", err)
+			}
+			n++
+			cur = ArchivedSession{Session: sessions[n]}
+		}
+		cur.Records = append(cur.Records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("archive session usage: %w", err)
+	}
+	for ; n < len(sessions); n++ {
+		if cur.ID != sessions[n].ID {
+			cur = ArchivedSession{Session: sessions[n]}
+		}
+		if err := enc.Encode(cur); err != nil {
+			return 0, fmt.Errorf("write session archive: %w", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return 0, fmt.Errorf("write session archive: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE last_activity < ?`, before.UTC()); err != nil {
+		return 0, fmt.Errorf("delete archived sessions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit archive: %w", err)
+	}
+	return int64(n), nil
+}
@@ -0,0 +1,170 @@
+package tracker
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestExpireSessions(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	gap := 30 * time.Minute
+
+	first, err := tr.ResolveSession(ctx, "k1", "", gap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.ResolveSession(ctx, "k2", "", gap); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is idle yet.
+	if n, err := tr.ExpireSessions(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Fatalf("ExpireSessions = %d, %v, want 0", n, err)
+	}
+	if n, err := tr.ExpireSessions(ctx, time.Now().Add(time.Minute)); err != nil || n != 2 {
+		t.Fatalf("ExpireSessions = %d, %v, want 2", n, err)
+	}
+	sessions, _ := tr.ListSessions(ctx, models.SessionQuery{APIKey: "k1"})
+	if len(sessions) != 1 || sessions[0].EndedAt.IsZero() {
+		t.Fatalf("sessions = %+v, want one ended", sessions)
+	}
+
+	// Auto-detection doesn't resume an ended session, even within the gap.
+	next, err := tr.ResolveSession(ctx, "k1", "", gap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == first {
+		t.Errorf("ResolveSession resumed ended session %s", first)
+	}
+
+	// A record in an ended session reopens it.
+	rec := models.UsageRecord{APIKey: "k1", Model: "gpt-4", SessionID: first, TotalTokens: 10, CreatedAt: time.Now().UTC()}
+	if err := tr.Record(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	sessions, _ = tr.ListSessions(ctx, models.SessionQuery{APIKey: "k1"})
+	for _, s := range sessions {
+		if s.ID == first && (!s.EndedAt.IsZero() || s.RequestCount != 1) {
+			t.Errorf("reopened session = %+v", s)
+		}
+	}
+}
+
+func TestArchiveSessions(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	// s0 and s3 have no usage records.
+	for _, id := range []string{"s0", "s1", "s2", "s3"} {
+		if _, err := tr.ResolveSession(ctx, "k1", id, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().UTC()
+	for i, id := range []string{"s2", "s1", "s2", ""} {
+		rec := models.UsageRecord{APIKey: "k1", Model: "gpt-4", SessionID: id, TotalTokens: 10 * (i + 1), CreatedAt: now.Add(time.Duration(i) * time.Second)}
+		if err := tr.Record(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := tr.ArchiveSessions(ctx, &buf, time.Now().Add(-time.Hour))
+	if err != nil || n != 0 {
+		t.Fatalf("ArchiveSessions before any cutoff = %d, %v", n, err)
+	}
+
+	buf.Reset()
+	n, err = tr.ArchiveSessions(ctx, &buf, time.Now().Add(time.Minute))
+	if err != nil || n != 4 {
+		t.Fatalf("ArchiveSessions = %d, %v, want 4", n, err)
+	}
+	if sessions, _ := tr.ListSessions(ctx, models.SessionQuery{}); len(sessions) != 0 {
+		t.Errorf("sessions after archive = %+v", sessions)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	tokens := map[string][]int{}
+	sc := bufio.NewScanner(gz)
+	for sc.Scan() {
+		var s ArchivedSession
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, s.ID)
+		for _, rec := range s.Records {
+			if rec.SessionID != s.ID {
+				t.Errorf("session %s archived with a record of %q", s.ID, rec.SessionID)
+			}
+			tokens[s.ID] = append(tokens[s.ID], rec.TotalTokens)
+		}
+	}
+	if !slices.Equal(ids, []string{"s0", "s1", "s2", "s3"}) {
+		t.Errorf("archived sessions = %v", ids)
+	}
+	// Each session carries its records, oldest first.
+	if !slices.Equal(tokens["s1"], []int{20}) || !slices.Equal(tokens["s2"], []int{10, 30}) {
+		t.Errorf("archived record tokens = %v", tokens)
+	}
+	// The records stay for usage retention to prune.
+	if recs, _ := tr.QueryByKey(ctx, "k1", now.Add(-time.Minute)); len(recs) != 4 {
+		t.Errorf("usage records after archive = %d, want 4", len(recs))
+	}
+}
+
+func TestSessionNameAndTags(t *testing.T) {
+	ctx := context.Background()
+	for name, tr := range map[string]Tracker{"sqlite": newTestTracker(t), "memory": NewMemory()} {
+		t.Run(name, func(t *testing.T) {
+			for _, id := range []string{"s1", "s2"} {
+				if _, err := tr.ResolveSession(ctx, "k1", id, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tr.UpdateSession(ctx, "s1", "nightly eval run", map[string]string{"agent": "planner", "run": "1"}); err != nil {
+				t.Fatal(err)
+			}
+			// Tags merge, and an empty name keeps the current one.
+			if err := tr.UpdateSession(ctx, "s1", "", map[string]string{"run": "2"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := tr.UpdateSession(ctx, "s2", "ad hoc", nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := tr.UpdateSession(ctx, "nope", "x", nil); !errors.Is(err, ErrNotFound) {
+				t.Errorf("UpdateSession on a missing session = %v, want ErrNotFound", err)
+			}
+
+			got, err := tr.ListSessions(ctx, models.SessionQuery{Name: "eval"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0].ID != "s1" || got[0].Name != "nightly eval run" || got[0].FormatTags() != "agent=planner,run=2" {
+				t.Errorf("sessions named eval = %+v", got)
+			}
+			if got, _ := tr.ListSessions(ctx, models.SessionQuery{Tags: map[string]string{"agent": "planner", "run": "2"}}); len(got) != 1 || got[0].ID != "s1" {
+				t.Errorf("sessions tagged agent=planner,run=2 = %+v", got)
+			}
+			if got, _ := tr.ListSessions(ctx, models.SessionQuery{Tags: map[string]string{"run": "1"}}); len(got) != 0 {
+				t.Errorf("sessions tagged run=1 = %+v", got)
+			}
+			if got, _ := tr.ListSessions(ctx, models.SessionQuery{APIKey: "k1"}); len(got) != 2 {
+				t.Errorf("sessions for k1 = %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package tracker
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+// topColumns maps each top-N dimension to its usage_records column.
+var topColumns = map[string]string{
+	models.TopByKey:     "api_key",
+	models.TopBySession: "session_id",
+	models.TopByModel:   "model",
+	models.TopByTeam:    "team",
+}
+
+// topGroup is a dimension value's usage of one model.
+type topGroup struct{ value, model string }
+
+// Top returns the values of q.By with the most usage since q.Since, by
+// total tokens or estimated cost. Usage without a session is left out of
+// the session ranking.
+func (t *SQLiteTracker) Top(ctx context.Context, q models.TopQuery) ([]models.TopEntry, error) {
+	if err := q.Validate(); err != nil {
+		return nil, fmt.Errorf("top: %w", err)
+	}
+	col := topColumns[q.By]
+	query := `SELECT ` + col + `, model, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), ` + detailSums + `, ` + costSum + `
+		 FROM usage_records WHERE created_at >= ?`
+	if q.By == models.TopBySession {
+		query += ` AND session_id != ''`
+	}
+	query += ` GROUP BY ` + col + `, model`
+
+	rows, err := t.db.QueryContext(ctx, query, q.Since)
+	if err != nil {
+		return nil, fmt.Errorf("query top: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make(map[topGroup]*models.CostReport)
+	for rows.Next() {
+		var g topGroup
+		var c models.CostReport
+		if err := rows.Scan(&g.value, &g.model, &c.RequestCount, &c.PromptTokens, &c.CompletionTokens, &c.TotalTokens,
+			&c.CacheReadTokens, &c.CacheCreationTokens, &c.ReasoningTokens, &c.EstimatedCost); err != nil {
+			return nil, fmt.Errorf("scan top: %w", err)
+		}
+		groups[g] = &c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query top: %w", err)
+	}
+	return rankTop(q, groups), nil
+}
+
+// rankTop sums the groups of each value and returns the top q.Limit
+// values.
+func rankTop(q models.TopQuery, groups map[topGroup]*models.CostReport) []models.TopEntry {
+	byValue := make(map[string]*models.TopEntry)
+	for g, c := range groups {
+		e, ok := byValue[g.value]
+		if !ok {
+			e = &models.TopEntry{Value: g.value}
+			byValue[g.value] = e
+		}
+		e.RequestCount += c.RequestCount
+		e.PromptTokens += c.PromptTokens
+		e.CompletionTokens += c.CompletionTokens
+		e.TotalTokens += c.TotalTokens
+		e.EstimatedCost += c.EstimatedCost
+	}
+
+	entries := make([]models.TopEntry, 0, len(byValue))
+	for _, e := range byValue {
+		entries = append(entries, *e)
+	}
+	slices.SortFunc(entries, func(a, b models.TopEntry) int {
+		if q.OrderBy == models.TopOrderCost {
+			if c := cmp.Compare(b.EstimatedCost, a.EstimatedCost); c != 0 {
+				return c
+			}
+		}
+		return cmp.Or(cmp.Compare(b.TotalTokens, a.TotalTokens), cmp.Compare(a.Value, b.Value))
+	})
+	if limit := cmp.Or(q.Limit, models.DefaultTopLimit); len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
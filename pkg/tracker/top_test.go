@@ -0,0 +1,67 @@
+package tracker
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pario-ai/pario/pkg/models"
+)
+
+func TestTop(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for _, rec := range []models.UsageRecord{
+		// k1 uses the most tokens, on a cheap model.
+		{APIKey: "k1", Model: "mini", SessionID: "s1", Team: "a", PromptTokens: 9000, CompletionTokens: 1000, TotalTokens: 10000, EstimatedCostUSD: 0.0013, CreatedAt: now},
+		// k2 uses fewer tokens on an expensive model, plus an image.
+		{APIKey: "k2", Model: "big", SessionID: "s2", Team: "b", PromptTokens: 900, CompletionTokens: 100, TotalTokens: 1000, EstimatedCostUSD: 0.012, CreatedAt: now},
+		{APIKey: "k2", Model: "image", Team: "b", MediaCostUSD: 0.04, EstimatedCostUSD: 0.04, CreatedAt: now},
+		{APIKey: "k3", Model: "mini", Team: "a", PromptTokens: 10, TotalTokens: 10, EstimatedCostUSD: 0.000001, CreatedAt: now},
+		// Outside the window.
+		{APIKey: "k3", Model: "big", TotalTokens: 1e6, CreatedAt: now.Add(-48 * time.Hour)},
+	} {
+		if err := tr.Record(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	since := now.Add(-time.Hour)
+
+	byTokens, err := tr.Top(ctx, models.TopQuery{By: models.TopByKey, Since: since})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byTokens) != 3 || byTokens[0].Value != "k1" || byTokens[1].Value != "k2" || byTokens[1].RequestCount != 2 {
+		t.Fatalf("top keys by tokens = %+v", byTokens)
+	}
+
+	byCost, err := tr.Top(ctx, models.TopQuery{By: models.TopByKey, Since: since, OrderBy: models.TopOrderCost, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 0.012 in tokens plus 0.04 for the image.
+	if len(byCost) != 1 || byCost[0].Value != "k2" || math.Abs(byCost[0].EstimatedCost-0.052) > 1e-9 {
+		t.Fatalf("top key by cost = %+v", byCost)
+	}
+
+	teams, _ := tr.Top(ctx, models.TopQuery{By: models.TopByTeam, Since: since})
+	if len(teams) != 2 || teams[0].Value != "a" || teams[0].TotalTokens != 10010 {
+		t.Errorf("top teams = %+v", teams)
+	}
+	// Records without a session are left out of the session ranking.
+	sessions, _ := tr.Top(ctx, models.TopQuery{By: models.TopBySession, Since: since})
+	if len(sessions) != 2 || sessions[0].Value != "s1" {
+		t.Errorf("top sessions = %+v", sessions)
+	}
+	modelsTop, _ := tr.Top(ctx, models.TopQuery{By: models.TopByModel, Since: since, OrderBy: models.TopOrderCost})
+	if len(modelsTop) != 3 || modelsTop[0].Value != "image" {
+		t.Errorf("top models by cost = %+v", modelsTop)
+	}
+
+	if _, err := tr.Top(ctx, models.TopQuery{By: "region", Since: since}); err == nil {
+		t.Error("unknown dimension: want error")
+	}
+}
@@ -5,11 +5,18 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
 
+	"github.com/pario-ai/pario/pkg/dbmaint"
+	"github.com/pario-ai/pario/pkg/events"
 	"github.com/pario-ai/pario/pkg/models"
 )
 
@@ -19,21 +26,53 @@ type Tracker interface {
 	Record(ctx context.Context, rec models.UsageRecord) error
 	// QueryByKey returns usage records for an API key since a given time.
 	QueryByKey(ctx context.Context, apiKey string, since time.Time) ([]models.UsageRecord, error)
+	// QuerySince returns all usage records since a given time, oldest first.
+	QuerySince(ctx context.Context, since time.Time) ([]models.UsageRecord, error)
 	// TotalByKey returns total tokens used by an API key since a given time.
 	TotalByKey(ctx context.Context, apiKey string, since time.Time) (int64, error)
 	// TotalByKeyAndModel returns total tokens used by an API key and model since a given time.
 	TotalByKeyAndModel(ctx context.Context, apiKey, model string, since time.Time) (int64, error)
+	// SpendByKey returns an API key's usage grouped by model, optionally for one model, with media costs.
+	SpendByKey(ctx context.Context, apiKey, model string, since time.Time) ([]models.CostReport, error)
+	// SpendByLabels is SpendByKey for the usage of every key carrying the given attribution labels.
+	SpendByLabels(ctx context.Context, labels models.CostLabel, model string, since time.Time) ([]models.CostReport, error)
+	// AdjustmentTotal sums manual budget ledger entries with exactly the given key or labels and model since a given time.
+	AdjustmentTotal(ctx context.Context, apiKey string, labels models.CostLabel, model string, since time.Time) (int64, float64, error)
 	// Summary returns aggregated usage summaries, optionally filtered by API key.
 	Summary(ctx context.Context, apiKey string) ([]models.UsageSummary, error)
 	// ResolveSession returns a session ID for the given API key, using the explicit
 	// session ID if provided, otherwise auto-detecting by time gap.
 	ResolveSession(ctx context.Context, apiKey, explicitID string, gapTimeout time.Duration) (string, error)
-	// ListSessions returns all sessions, optionally filtered by API key.
-	ListSessions(ctx context.Context, apiKey string) ([]models.Session, error)
+	// ListSessions returns the sessions matching q, most recently started first.
+	ListSessions(ctx context.Context, q models.SessionQuery) ([]models.Session, error)
+	// UpdateSession sets a session's name, unless name is empty, and merges tags into its tags.
+	UpdateSession(ctx context.Context, id, name string, tags map[string]string) error
+	// Top returns the API keys, sessions, models, or teams with the most usage since a given time.
+	Top(ctx context.Context, q models.TopQuery) ([]models.TopEntry, error)
 	// SessionRequests returns per-request detail for a session with context growth.
 	SessionRequests(ctx context.Context, sessionID string) ([]models.SessionRequest, error)
 	// CostReport returns aggregated usage grouped by team, project, and model.
 	CostReport(ctx context.Context, since time.Time, team, project string) ([]models.CostReport, error)
+	// LabelReport returns usage grouped by a free-form label value and model, filtered by labels.
+	LabelReport(ctx context.Context, q models.LabelQuery) ([]models.LabelReport, error)
+	// Throughput returns output tokens/sec distributions per model and provider since a given time.
+	Throughput(ctx context.Context, since time.Time) ([]models.ThroughputStat, error)
+	// Latency returns upstream latency percentiles per model and provider since a given time.
+	Latency(ctx context.Context, since time.Time) ([]models.LatencyStat, error)
+	// RecordFailure stores a failed upstream attempt.
+	RecordFailure(ctx context.Context, f models.UpstreamFailure) error
+	// ProviderReliability returns served requests, failed attempts, and fallbacks per provider since a given time.
+	ProviderReliability(ctx context.Context, since time.Time) ([]models.ProviderReliability, error)
+	// RecordDecision stores a budget block or soft-limit warning.
+	RecordDecision(ctx context.Context, d models.BudgetDecision) error
+	// Decisions returns stored budget decisions matching a query, newest first.
+	Decisions(ctx context.Context, q models.BudgetDecisionQuery) ([]models.BudgetDecision, error)
+	// RecordBatch stores a submitted Batch API job for deferred attribution.
+	RecordBatch(ctx context.Context, job models.BatchJob) error
+	// PendingBatches returns batch jobs that have not finished, oldest first.
+	PendingBatches(ctx context.Context) ([]models.BatchJob, error)
+	// FinishBatch marks a batch job finished with its terminal status.
+	FinishBatch(ctx context.Context, id, status string, at time.Time) error
 	// Close releases resources.
 	Close() error
 }
@@ -41,6 +80,17 @@ type Tracker interface {
 // SQLiteTracker implements Tracker with a SQLite database.
 type SQLiteTracker struct {
 	db *sql.DB
+	// stmts are Record's prepared statements.
+	stmts recordStmts
+	// counters, when set, keeps running key totals; see UseCounters.
+	counters *counters
+	// async, when set, queues Record calls; see UseAsyncWrites.
+	async *asyncWriter
+	// usage publishes records as they are stored; see SubscribeUsage.
+	usage *events.Hub[models.UsageRecord]
+	// sampleRate, when between 0 and 1, is the share of records stored
+	// as rows; see UseSampling.
+	sampleRate float64
 }
 
 const createTable = `
@@ -68,12 +118,68 @@ CREATE TABLE IF NOT EXISTS sessions (
 CREATE INDEX IF NOT EXISTS idx_sessions_key ON sessions(api_key);
 `
 
+// usageColumns lists usage_records columns added after the initial schema,
+// in the order they were introduced.
+var usageColumns = []struct{ name, def string }{
+	{"session_id", "TEXT NOT NULL DEFAULT ''"},
+	{"team", "TEXT NOT NULL DEFAULT ''"},
+	{"project", "TEXT NOT NULL DEFAULT ''"},
+	{"env", "TEXT NOT NULL DEFAULT ''"},
+	{"streamed", "INTEGER NOT NULL DEFAULT 0"},
+	{"provider", "TEXT NOT NULL DEFAULT ''"},
+	{"latency_ms", "INTEGER NOT NULL DEFAULT 0"},
+	{"output_tps", "REAL NOT NULL DEFAULT 0"},
+	{"labels", "TEXT NOT NULL DEFAULT '{}'"},
+	{"imported", "INTEGER NOT NULL DEFAULT 0"},
+	{"request_id", "TEXT NOT NULL DEFAULT ''"},
+	{"attempt", "INTEGER NOT NULL DEFAULT 0"},
+	{"input_audio_tokens", "INTEGER NOT NULL DEFAULT 0"},
+	{"output_audio_tokens", "INTEGER NOT NULL DEFAULT 0"},
+	{"retry_reason", "TEXT NOT NULL DEFAULT ''"},
+	{"pipeline", "TEXT NOT NULL DEFAULT ''"},
+	{"branch", "TEXT NOT NULL DEFAULT ''"},
+	{"commit_sha", "TEXT NOT NULL DEFAULT ''"},
+	{"endpoint", "TEXT NOT NULL DEFAULT ''"},
+	{"images", "INTEGER NOT NULL DEFAULT 0"},
+	{"media_cost_usd", "REAL NOT NULL DEFAULT 0"},
+	{"audio_seconds", "REAL NOT NULL DEFAULT 0"},
+	{"characters", "INTEGER NOT NULL DEFAULT 0"},
+	{"partial", "INTEGER NOT NULL DEFAULT 0"},
+	{"route_alias", "TEXT NOT NULL DEFAULT ''"},
+	{"cache_read_tokens", "INTEGER NOT NULL DEFAULT 0"},
+	{"cache_creation_tokens", "INTEGER NOT NULL DEFAULT 0"},
+	{"reasoning_tokens", "INTEGER NOT NULL DEFAULT 0"},
+	{"upstream_status", "INTEGER NOT NULL DEFAULT 0"},
+	{"metadata", "TEXT NOT NULL DEFAULT '{}'"},
+	// NULL on records from before costs were stored; see PriceUnpriced.
+	{"estimated_cost_usd", "REAL"},
+}
+
+// createRecordKeyIndex makes (request_id, attempt) an idempotency key for
+// proxied records. Records without a request ID (imports, older rows) are
+// exempt.
+const createRecordKeyIndex = `
+CREATE UNIQUE INDEX IF NOT EXISTS idx_usage_record_key ON usage_records(request_id, attempt) WHERE request_id != '';
+`
+
+// dsnPragmas open every pooled connection in WAL mode, so reads don't
+// block the writer, and make a busy connection wait for the lock rather
+// than fail with "database is locked". Write transactions take the lock
+// when they begin, since SQLite can't wait to upgrade a read lock.
+const dsnPragmas = "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate"
+
+// maxConns bounds the tracker's connection pool. WAL serves reads in
+// parallel, but writes still take turns.
+const maxConns = 8
+
 // New creates a SQLiteTracker and runs auto-migration.
 func New(dbPath string) (*SQLiteTracker, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	db, err := sql.Open("sqlite", dbPath+dsnPragmas)
 	if err != nil {
 		return nil, fmt.Errorf("open tracker db: %w", err)
 	}
+	db.SetMaxOpenConns(maxConns)
+	db.SetMaxIdleConns(maxConns)
 
 	if _, err := db.Exec(createTable); err != nil {
 		db.Close()
@@ -85,25 +191,108 @@ func New(dbPath string) (*SQLiteTracker, error) {
 		return nil, fmt.Errorf("migrate sessions table: %w", err)
 	}
 
-	// Add session_id column to usage_records if missing.
-	if !columnExists(db, "usage_records", "session_id") {
-		if _, err := db.Exec(`ALTER TABLE usage_records ADD COLUMN session_id TEXT NOT NULL DEFAULT ''`); err != nil {
-			db.Close()
-			return nil, fmt.Errorf("add session_id column: %w", err)
+	if _, err := db.Exec(createDecisionsTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate budget decisions table: %w", err)
+	}
+
+	if _, err := db.Exec(createBatchesTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate batch jobs table: %w", err)
+	}
+
+	if _, err := db.Exec(createPoliciesTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate budget policies table: %w", err)
+	}
+
+	if _, err := db.Exec(createAdjustmentsTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate budget adjustments table: %w", err)
+	}
+
+	if _, err := db.Exec(createRollupsTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate usage rollups table: %w", err)
+	}
+
+	if _, err := db.Exec(createFailuresTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate upstream failures table: %w", err)
+	}
+
+	if _, err := db.Exec(createAnomaliesTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate anomalies table: %w", err)
+	}
+
+	if _, err := db.Exec(createUnsampledTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate unsampled usage table: %w", err)
+	}
+
+	// Add columns introduced after the initial schema.
+	for _, col := range usageColumns {
+		if !columnExists(db, "usage_records", col.name) {
+			if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE usage_records ADD COLUMN %s %s`, col.name, col.def)); err != nil {
+				db.Close()
+				return nil, fmt.Errorf("add %s column: %w", col.name, err)
+			}
+		}
+	}
+
+	for _, col := range decisionColumns {
+		if !columnExists(db, "budget_decisions", col.name) {
+			if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE budget_decisions ADD COLUMN %s %s`, col.name, col.def)); err != nil {
+				db.Close()
+				return nil, fmt.Errorf("add %s column: %w", col.name, err)
+			}
+		}
+	}
+
+	for _, col := range rollupColumns {
+		if !columnExists(db, "usage_rollups", col.name) {
+			if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE usage_rollups ADD COLUMN %s %s`, col.name, col.def)); err != nil {
+				db.Close()
+				return nil, fmt.Errorf("add %s column: %w", col.name, err)
+			}
+		}
+	}
+
+	for _, col := range batchColumns {
+		if !columnExists(db, "batch_jobs", col.name) {
+			if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE batch_jobs ADD COLUMN %s %s`, col.name, col.def)); err != nil {
+				db.Close()
+				return nil, fmt.Errorf("add %s column: %w", col.name, err)
+			}
 		}
 	}
 
-	// Add attribution columns if missing.
-	for _, col := range []string{"team", "project", "env"} {
-		if !columnExists(db, "usage_records", col) {
-			if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE usage_records ADD COLUMN %s TEXT NOT NULL DEFAULT ''`, col)); err != nil {
+	for _, col := range sessionColumns {
+		if !columnExists(db, "sessions", col.name) {
+			if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE sessions ADD COLUMN %s %s`, col.name, col.def)); err != nil {
 				db.Close()
-				return nil, fmt.Errorf("add %s column: %w", col, err)
+				return nil, fmt.Errorf("add %s column: %w", col.name, err)
 			}
 		}
 	}
 
-	return &SQLiteTracker{db: db}, nil
+	if _, err := db.Exec(createSessionActivityIndex); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create session activity index: %w", err)
+	}
+
+	if _, err := db.Exec(createRecordKeyIndex); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create record key index: %w", err)
+	}
+
+	stmts, err := prepareRecordStmts(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteTracker{db: db, stmts: stmts, usage: events.NewHub[models.UsageRecord]()}, nil
 }
 
 func columnExists(db *sql.DB, table, column string) bool {
@@ -135,31 +324,300 @@ func generateSessionID() string {
 	return fmt.Sprintf("sess_%s_%s", time.Now().UTC().Format("20060102"), hex.EncodeToString(b))
 }
 
-// Record stores a usage record and updates session counters.
+const insertUsage = `INSERT INTO usage_records (api_key, model, session_id, prompt_tokens, completion_tokens, total_tokens, team, project, env, streamed,
+	 provider, latency_ms, output_tps, labels, imported, request_id, attempt, input_audio_tokens, output_audio_tokens, retry_reason,
+	 pipeline, branch, commit_sha, endpoint, images, media_cost_usd, audio_seconds, characters, partial, route_alias,
+	 cache_read_tokens, cache_creation_tokens, reasoning_tokens, upstream_status, metadata, estimated_cost_usd, created_at)
+	 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	 ON CONFLICT(request_id, attempt) WHERE request_id != '' DO NOTHING`
+
+// insertArgs returns the insertUsage arguments for rec.
+func insertArgs(rec models.UsageRecord) ([]any, error) {
+	labels, err := encodeLabels(rec.Labels)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := encodeLabels(rec.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	return []any{
+		rec.APIKey, rec.Model, rec.SessionID, rec.PromptTokens, rec.CompletionTokens, rec.TotalTokens, rec.Team, rec.Project, rec.Env, rec.Streamed,
+		rec.Provider, rec.LatencyMs, rec.OutputTokensPerSec, labels, rec.Imported, rec.RequestID, rec.Attempt,
+		rec.InputAudioTokens, rec.OutputAudioTokens, rec.RetryReason,
+		rec.Pipeline, rec.Branch, rec.Commit, rec.Endpoint, rec.Images, rec.MediaCostUSD, rec.AudioSeconds, rec.Characters, rec.Partial, rec.RouteAlias,
+		rec.CacheReadTokens, rec.CacheCreationTokens, rec.ReasoningTokens, rec.UpstreamStatus, metadata, rec.EstimatedCostUSD, rec.CreatedAt,
+	}, nil
+}
+
+// Record stores a usage record and updates session counters. A record whose
+// (RequestID, Attempt) was already stored is ignored, so retried writes
+// never double count. With async writes on, the record is queued instead;
+// see UseAsyncWrites.
 func (t *SQLiteTracker) Record(ctx context.Context, rec models.UsageRecord) error {
-	_, err := t.db.ExecContext(ctx,
-		`INSERT INTO usage_records (api_key, model, session_id, prompt_tokens, completion_tokens, total_tokens, team, project, env, created_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		rec.APIKey, rec.Model, rec.SessionID, rec.PromptTokens, rec.CompletionTokens, rec.TotalTokens, rec.Team, rec.Project, rec.Env, rec.CreatedAt,
-	)
+	if t.async != nil {
+		t.async.enqueue(rec)
+		return nil
+	}
+	if !t.keep(rec) {
+		added, err := insertUnsampled(ctx, t.stmts, rec)
+		if err != nil {
+			return err
+		}
+		if added {
+			t.countRecord(ctx, rec)
+		}
+		return nil
+	}
+	id, err := insertRecord(ctx, t.stmts, rec)
+	if err != nil {
+		return err
+	}
+	if id != 0 {
+		rec.ID = id
+		t.stored(ctx, rec)
+	}
+	return nil
+}
+
+// stored updates the key counters for a newly stored record and publishes
+// it to usage subscribers.
+func (t *SQLiteTracker) stored(ctx context.Context, rec models.UsageRecord) {
+	t.countRecord(ctx, rec)
+	t.usage.Publish(rec)
+}
+
+// SubscribeUsage returns a subscription that receives every usage record
+// once it is stored, with its ID set, until closed. Duplicates and imported
+// records are not sent. Publishing never waits on a subscriber: records
+// that don't fit in its buffer are dropped and counted.
+func (t *SQLiteTracker) SubscribeUsage(buffer int) *events.Subscription[models.UsageRecord] {
+	return t.usage.Subscribe(buffer)
+}
+
+// touchSession updates a session's counters for a newly stored record.
+const touchSession = `UPDATE sessions SET last_activity = ?, request_count = request_count + 1, total_tokens = total_tokens + ?, ended_at = NULL WHERE id = ?`
+
+// recordStmts are the statements insertRecord and insertUnsampled run,
+// prepared once.
+type recordStmts struct {
+	insert       *sql.Stmt
+	session      *sql.Stmt
+	unsampled    *sql.Stmt
+	unsampledKey *sql.Stmt
+}
+
+func prepareRecordStmts(db *sql.DB) (recordStmts, error) {
+	insert, err := db.Prepare(insertUsage)
 	if err != nil {
-		return fmt.Errorf("record usage: %w", err)
+		return recordStmts{}, fmt.Errorf("prepare usage insert: %w", err)
+	}
+	session, err := db.Prepare(touchSession)
+	if err != nil {
+		insert.Close()
+		return recordStmts{}, fmt.Errorf("prepare session update: %w", err)
+	}
+	unsampled, err := db.Prepare(addUnsampled)
+	if err != nil {
+		insert.Close()
+		session.Close()
+		return recordStmts{}, fmt.Errorf("prepare unsampled usage insert: %w", err)
+	}
+	unsampledKey, err := db.Prepare(claimUnsampledKey)
+	if err != nil {
+		insert.Close()
+		session.Close()
+		unsampled.Close()
+		return recordStmts{}, fmt.Errorf("prepare unsampled usage key insert: %w", err)
+	}
+	return recordStmts{insert: insert, session: session, unsampled: unsampled, unsampledKey: unsampledKey}, nil
+}
+
+// in returns the statements bound to tx.
+func (s recordStmts) in(ctx context.Context, tx *sql.Tx) recordStmts {
+	return recordStmts{insert: tx.StmtContext(ctx, s.insert), session: tx.StmtContext(ctx, s.session),
+		unsampled: tx.StmtContext(ctx, s.unsampled), unsampledKey: tx.StmtContext(ctx, s.unsampledKey)}
+}
+
+func (s recordStmts) close() {
+	s.insert.Close()
+	s.session.Close()
+	s.unsampled.Close()
+	s.unsampledKey.Close()
+}
+
+// insertRecord inserts rec and updates its session's counters, returning
+// the new row's ID, or 0 if rec was ignored as a duplicate.
+func insertRecord(ctx context.Context, stmts recordStmts, rec models.UsageRecord) (int64, error) {
+	args, err := insertArgs(rec)
+	if err != nil {
+		return 0, fmt.Errorf("record usage: %w", err)
+	}
+	res, err := stmts.insert.ExecContext(ctx, args...)
+	if err != nil {
+		return 0, fmt.Errorf("record usage: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return 0, nil
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("record usage: %w", err)
 	}
 
 	// Update session counters if session is set.
 	if rec.SessionID != "" {
-		_, err = t.db.ExecContext(ctx,
-			`UPDATE sessions SET last_activity = ?, request_count = request_count + 1, total_tokens = total_tokens + ? WHERE id = ?`,
-			rec.CreatedAt, rec.TotalTokens, rec.SessionID,
-		)
+		_, err = stmts.session.ExecContext(ctx, rec.CreatedAt, rec.TotalTokens, rec.SessionID)
 		if err != nil {
-			return fmt.Errorf("update session counters: %w", err)
+			return 0, fmt.Errorf("update session counters: %w", err)
+		}
+	}
+	return id, nil
+}
+
+// PriceUnpriced stores the cost of records from before costs were stored,
+// at pricing, and returns how many it priced. Each record is priced once,
+// so run it at startup, before serving. Rollups of the priced hours are
+// recomputed on the next Rollup.
+func (t *SQLiteTracker) PriceUnpriced(ctx context.Context, pricing []models.ModelPricing) (int64, error) {
+	byModel := make(map[string]models.ModelPricing, len(pricing))
+	for _, p := range pricing {
+		byModel[p.Model] = p
+	}
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin pricing: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, model, prompt_tokens, completion_tokens, cache_read_tokens, cache_creation_tokens, reasoning_tokens, media_cost_usd, created_at
+		 FROM usage_records WHERE estimated_cost_usd IS NULL`)
+	if err != nil {
+		return 0, fmt.Errorf("query unpriced usage: %w", err)
+	}
+	type priced struct {
+		id   int64
+		cost float64
+	}
+	var costs []priced
+	var first time.Time
+	for rows.Next() {
+		var r models.UsageRecord
+		if err := rows.Scan(&r.ID, &r.Model, &r.PromptTokens, &r.CompletionTokens, &r.CacheReadTokens, &r.CacheCreationTokens, &r.ReasoningTokens,
+			&r.MediaCostUSD, &r.CreatedAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan unpriced usage: %w", err)
 		}
+		costs = append(costs, priced{r.ID, r.Cost(byModel)})
+		if first.IsZero() || r.CreatedAt.Before(first) {
+			first = r.CreatedAt
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("query unpriced usage: %w", err)
+	}
+	if len(costs) == 0 {
+		return 0, nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `UPDATE usage_records SET estimated_cost_usd = ? WHERE id = ?`)
+	if err != nil {
+		return 0, fmt.Errorf("price usage: %w", err)
 	}
+	defer stmt.Close()
+	for _, c := range costs {
+		if _, err := stmt.ExecContext(ctx, c.cost, c.id); err != nil {
+			return 0, fmt.Errorf("price usage: %w", err)
+		}
+	}
+	if err := rewindRollups(ctx, tx, first); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit pricing: %w", err)
+	}
+	return int64(len(costs)), nil
+}
 
+// ReplaceImported stores records imported from a provider usage export.
+// Previously imported records for the same provider in [since, until) are
+// deleted first, so re-running an import over a range doesn't double count.
+// Records observed by the proxy are never touched.
+func (t *SQLiteTracker) ReplaceImported(ctx context.Context, provider string, since, until time.Time, recs []models.UsageRecord) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin import: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	apiKeys, err := importedKeys(ctx, tx, provider, since, until)
+	if err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		if !slices.Contains(apiKeys, rec.APIKey) {
+			apiKeys = append(apiKeys, rec.APIKey)
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM usage_records WHERE imported = 1 AND provider = ? AND created_at >= ? AND created_at < ?`,
+		provider, since, until,
+	); err != nil {
+		return fmt.Errorf("clear imported usage: %w", err)
+	}
+	if err := rewindRollups(ctx, tx, since); err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		rec.Provider = provider
+		rec.Imported = true
+		args, err := insertArgs(rec)
+		if err != nil {
+			return fmt.Errorf("import usage: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, insertUsage, args...); err != nil {
+			return fmt.Errorf("import usage: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit import: %w", err)
+	}
+	t.forgetCounters(ctx, apiKeys, since, until)
 	return nil
 }
 
+// importedKeys returns the API keys of a provider's imported records in
+// [since, until), whose usage counters a re-import invalidates.
+func importedKeys(ctx context.Context, tx *sql.Tx, provider string, since, until time.Time) ([]string, error) {
+	return usageKeys(ctx, tx,
+		`SELECT DISTINCT api_key FROM usage_records WHERE imported = 1 AND provider = ? AND created_at >= ? AND created_at < ?`,
+		provider, since, until,
+	)
+}
+
+// usageKeys returns the API keys selected by query.
+func usageKeys(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+}, query string, args ...any) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query usage keys: %w", err)
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, fmt.Errorf("scan usage key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
 // ResolveSession returns a session ID. If explicitID is non-empty, it ensures
 // the session row exists and returns it. Otherwise it finds the most recent
 // session for the API key and reuses it if within gapTimeout, or creates a new one.
@@ -178,11 +636,11 @@ func (t *SQLiteTracker) ResolveSession(ctx context.Context, apiKey, explicitID s
 		return explicitID, nil
 	}
 
-	// Auto-detect: find most recent session for this key.
+	// Auto-detect: find most recent open session for this key.
 	var lastID string
 	var lastActivity time.Time
 	err := t.db.QueryRowContext(ctx,
-		`SELECT id, last_activity FROM sessions WHERE api_key = ? ORDER BY last_activity DESC LIMIT 1`,
+		`SELECT id, last_activity FROM sessions WHERE api_key = ? AND ended_at IS NULL ORDER BY last_activity DESC LIMIT 1`,
 		apiKey,
 	).Scan(&lastID, &lastActivity)
 
@@ -202,13 +660,27 @@ func (t *SQLiteTracker) ResolveSession(ctx context.Context, apiKey, explicitID s
 	return newID, nil
 }
 
-// ListSessions returns all sessions, optionally filtered by API key.
-func (t *SQLiteTracker) ListSessions(ctx context.Context, apiKey string) ([]models.Session, error) {
-	query := `SELECT id, api_key, started_at, last_activity, request_count, total_tokens FROM sessions`
+// ListSessions returns the sessions matching q, most recently started
+// first.
+func (t *SQLiteTracker) ListSessions(ctx context.Context, q models.SessionQuery) ([]models.Session, error) {
+	query := sessionSelect + ` WHERE 1 = 1`
 	var args []any
-	if apiKey != "" {
-		query += ` WHERE api_key = ?`
-		args = append(args, apiKey)
+	if q.APIKey != "" {
+		query += ` AND api_key = ?`
+		args = append(args, q.APIKey)
+	}
+	if q.Name != "" {
+		query += ` AND instr(name, ?) > 0`
+		args = append(args, q.Name)
+	}
+	keys := make([]string, 0, len(q.Tags))
+	for k := range q.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		query += ` AND COALESCE(json_extract(tags, ?), '') = ?`
+		args = append(args, labelPath(k), q.Tags[k])
 	}
 	query += ` ORDER BY started_at DESC`
 
@@ -220,9 +692,9 @@ func (t *SQLiteTracker) ListSessions(ctx context.Context, apiKey string) ([]mode
 
 	var sessions []models.Session
 	for rows.Next() {
-		var s models.Session
-		if err := rows.Scan(&s.ID, &s.APIKey, &s.StartedAt, &s.LastActivity, &s.RequestCount, &s.TotalTokens); err != nil {
-			return nil, fmt.Errorf("scan session: %w", err)
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
 		}
 		sessions = append(sessions, s)
 	}
@@ -260,65 +732,212 @@ func (t *SQLiteTracker) SessionRequests(ctx context.Context, sessionID string) (
 	return reqs, rows.Err()
 }
 
+// usageSelect selects every usage_records column in scanUsage order.
+const usageSelect = `SELECT id, request_id, attempt, api_key, model, session_id, prompt_tokens, completion_tokens, total_tokens, team, project, env, streamed,
+	 provider, latency_ms, output_tps, labels, imported, input_audio_tokens, output_audio_tokens, retry_reason,
+	 pipeline, branch, commit_sha, endpoint, images, media_cost_usd, audio_seconds, characters, partial, route_alias,
+	 cache_read_tokens, cache_creation_tokens, reasoning_tokens, upstream_status, metadata, COALESCE(estimated_cost_usd, media_cost_usd), created_at
+	 FROM usage_records`
+
+// scanUsage reads all rows selected with usageSelect.
+func scanUsage(rows *sql.Rows) ([]models.UsageRecord, error) {
+	defer rows.Close()
+
+	var records []models.UsageRecord
+	for rows.Next() {
+		r, err := scanUsageRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// scanUsageRow reads the current row selected with usageSelect.
+func scanUsageRow(rows *sql.Rows) (models.UsageRecord, error) {
+	var r models.UsageRecord
+	var labels, metadata string
+	if err := rows.Scan(&r.ID, &r.RequestID, &r.Attempt, &r.APIKey, &r.Model, &r.SessionID, &r.PromptTokens, &r.CompletionTokens, &r.TotalTokens, &r.Team, &r.Project, &r.Env, &r.Streamed,
+		&r.Provider, &r.LatencyMs, &r.OutputTokensPerSec, &labels, &r.Imported, &r.InputAudioTokens, &r.OutputAudioTokens, &r.RetryReason,
+		&r.Pipeline, &r.Branch, &r.Commit, &r.Endpoint, &r.Images, &r.MediaCostUSD, &r.AudioSeconds, &r.Characters, &r.Partial, &r.RouteAlias,
+		&r.CacheReadTokens, &r.CacheCreationTokens, &r.ReasoningTokens, &r.UpstreamStatus, &metadata, &r.EstimatedCostUSD, &r.CreatedAt); err != nil {
+		return r, fmt.Errorf("scan usage: %w", err)
+	}
+	if labels != "" && labels != "{}" {
+		_ = json.Unmarshal([]byte(labels), &r.Labels)
+	}
+	if metadata != "" && metadata != "{}" {
+		_ = json.Unmarshal([]byte(metadata), &r.Metadata)
+	}
+	return r, nil
+}
+
 // QueryByKey returns usage records for an API key since a given time.
 func (t *SQLiteTracker) QueryByKey(ctx context.Context, apiKey string, since time.Time) ([]models.UsageRecord, error) {
 	rows, err := t.db.QueryContext(ctx,
-		`SELECT id, api_key, model, session_id, prompt_tokens, completion_tokens, total_tokens, team, project, env, created_at
-		 FROM usage_records WHERE api_key = ? AND created_at >= ? ORDER BY created_at DESC`,
+		usageSelect+` WHERE api_key = ? AND created_at >= ? ORDER BY created_at DESC`,
 		apiKey, since,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("query usage: %w", err)
 	}
-	defer rows.Close()
+	return scanUsage(rows)
+}
 
-	var records []models.UsageRecord
-	for rows.Next() {
-		var r models.UsageRecord
-		if err := rows.Scan(&r.ID, &r.APIKey, &r.Model, &r.SessionID, &r.PromptTokens, &r.CompletionTokens, &r.TotalTokens, &r.Team, &r.Project, &r.Env, &r.CreatedAt); err != nil {
-			return nil, fmt.Errorf("scan usage: %w", err)
-		}
-		records = append(records, r)
+// QuerySince returns all usage records since a given time, oldest first.
+func (t *SQLiteTracker) QuerySince(ctx context.Context, since time.Time) ([]models.UsageRecord, error) {
+	rows, err := t.db.QueryContext(ctx,
+		usageSelect+` WHERE created_at >= ? ORDER BY created_at ASC, id ASC`,
+		since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query usage: %w", err)
 	}
-	return records, rows.Err()
+	return scanUsage(rows)
 }
 
 // TotalByKey returns total tokens used by an API key since a given time.
 func (t *SQLiteTracker) TotalByKey(ctx context.Context, apiKey string, since time.Time) (int64, error) {
+	pending := spendTotal(t.pendingSpend(keyRecords(apiKey, "", since)), "")
+	if rows, ok := t.countedSpend(ctx, apiKey, since); ok {
+		return spendTotal(rows, "") + pending, nil
+	}
 	var total int64
 	err := t.db.QueryRowContext(ctx,
-		`SELECT COALESCE(SUM(total_tokens), 0) FROM usage_records WHERE api_key = ? AND created_at >= ?`,
+		`SELECT COALESCE(SUM(total_tokens), 0) FROM `+budgetUsage+` WHERE api_key = ? AND created_at >= ?`,
 		apiKey, since,
 	).Scan(&total)
 	if err != nil {
 		return 0, fmt.Errorf("total usage: %w", err)
 	}
-	return total, nil
+	return total + pending, nil
 }
 
 // TotalByKeyAndModel returns total tokens used by an API key and model since a given time.
 func (t *SQLiteTracker) TotalByKeyAndModel(ctx context.Context, apiKey, model string, since time.Time) (int64, error) {
+	pending := spendTotal(t.pendingSpend(keyRecords(apiKey, model, since)), model)
+	if rows, ok := t.countedSpend(ctx, apiKey, since); ok {
+		return spendTotal(rows, model) + pending, nil
+	}
 	var total int64
 	err := t.db.QueryRowContext(ctx,
-		`SELECT COALESCE(SUM(total_tokens), 0) FROM usage_records WHERE api_key = ? AND model = ? AND created_at >= ?`,
+		`SELECT COALESCE(SUM(total_tokens), 0) FROM `+budgetUsage+` WHERE api_key = ? AND model = ? AND created_at >= ?`,
 		apiKey, model, since,
 	).Scan(&total)
 	if err != nil {
 		return 0, fmt.Errorf("total usage by model: %w", err)
 	}
-	return total, nil
+	return total + pending, nil
+}
+
+// SpendByKey returns an API key's usage since a given time grouped by
+// model, optionally restricted to one model, for pricing spend budgets.
+// EstimatedCost holds the stored media cost, as in CostReport.
+func (t *SQLiteTracker) SpendByKey(ctx context.Context, apiKey, model string, since time.Time) ([]models.CostReport, error) {
+	pending := t.pendingSpend(keyRecords(apiKey, model, since))
+	if rows, ok := t.countedSpend(ctx, apiKey, since); ok {
+		if model != "" {
+			rows = slices.DeleteFunc(rows, func(r models.CostReport) bool { return r.Model != model })
+		}
+		return mergeSpend(rows, pending), nil
+	}
+	rows, err := t.spendByKey(ctx, apiKey, model, since)
+	if err != nil {
+		return nil, err
+	}
+	return mergeSpend(rows, pending), nil
+}
+
+// keyRecords selects an API key's records since a given time, optionally
+// for one model.
+func keyRecords(apiKey, model string, since time.Time) func(r *models.UsageRecord) bool {
+	return func(r *models.UsageRecord) bool {
+		return r.APIKey == apiKey && !r.CreatedAt.Before(since) && (model == "" || r.Model == model)
+	}
+}
+
+// detailSums sums the cached and reasoning token columns of a report.
+const detailSums = `SUM(cache_read_tokens), SUM(cache_creation_tokens), SUM(reasoning_tokens)`
+
+// costSum sums the stored cost of a report's records. Records from before
+// costs were stored count only their media cost until PriceUnpriced runs.
+const costSum = `SUM(COALESCE(estimated_cost_usd, media_cost_usd))`
+
+// spendByKey is SpendByKey from the database.
+func (t *SQLiteTracker) spendByKey(ctx context.Context, apiKey, model string, since time.Time) ([]models.CostReport, error) {
+	query := `SELECT model, SUM(requests), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), ` + detailSums + `, ` + costSum + `
+		 FROM ` + budgetUsage + ` WHERE api_key = ? AND created_at >= ?`
+	args := []any{apiKey, since}
+	if model != "" {
+		query += ` AND model = ?`
+		args = append(args, model)
+	}
+	rows, err := t.spend(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("spend by key: %w", err)
+	}
+	return rows, nil
+}
+
+// SpendByLabels returns the usage since a given time of every key carrying
+// labels, grouped by model and optionally restricted to one model. Empty
+// labels match any value.
+func (t *SQLiteTracker) SpendByLabels(ctx context.Context, labels models.CostLabel, model string, since time.Time) ([]models.CostReport, error) {
+	query := `SELECT model, SUM(requests), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), ` + detailSums + `, ` + costSum + `
+		 FROM ` + budgetUsage + ` WHERE created_at >= ?`
+	args := []any{since}
+	for _, f := range []struct{ col, value string }{{"team", labels.Team}, {"project", labels.Project}, {"env", labels.Env}, {"model", model}} {
+		if f.value != "" {
+			query += ` AND ` + f.col + ` = ?`
+			args = append(args, f.value)
+		}
+	}
+	rows, err := t.spend(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("spend by labels: %w", err)
+	}
+	return mergeSpend(rows, t.pendingSpend(func(r *models.UsageRecord) bool {
+		return !r.CreatedAt.Before(since) &&
+			(labels.Team == "" || r.Team == labels.Team) &&
+			(labels.Project == "" || r.Project == labels.Project) &&
+			(labels.Env == "" || r.Env == labels.Env) &&
+			(model == "" || r.Model == model)
+	})), nil
 }
 
-// Summary returns aggregated usage grouped by API key and model.
+// spend runs a SpendByKey or SpendByLabels query, grouping it by model.
+func (t *SQLiteTracker) spend(ctx context.Context, query string, args []any) ([]models.CostReport, error) {
+	rows, err := t.db.QueryContext(ctx, query+` GROUP BY model`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []models.CostReport
+	for rows.Next() {
+		var r models.CostReport
+		if err := rows.Scan(&r.Model, &r.RequestCount, &r.PromptTokens, &r.CompletionTokens, &r.TotalTokens,
+			&r.CacheReadTokens, &r.CacheCreationTokens, &r.ReasoningTokens, &r.EstimatedCost); err != nil {
+			return nil, fmt.Errorf("scan spend: %w", err)
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// Summary returns aggregated usage grouped by API key, model, provider,
+// and route alias.
 func (t *SQLiteTracker) Summary(ctx context.Context, apiKey string) ([]models.UsageSummary, error) {
-	query := `SELECT api_key, model, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens)
+	query := `SELECT api_key, model, provider, route_alias, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens),
+		 SUM(streamed), SUM(CASE WHEN streamed THEN total_tokens ELSE 0 END), SUM(partial)
 		 FROM usage_records`
 	var args []any
 	if apiKey != "" {
 		query += ` WHERE api_key = ?`
 		args = append(args, apiKey)
 	}
-	query += ` GROUP BY api_key, model ORDER BY api_key, model`
+	query += ` GROUP BY api_key, model, provider, route_alias ORDER BY api_key, model, provider, route_alias`
 
 	rows, err := t.db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -329,7 +948,8 @@ func (t *SQLiteTracker) Summary(ctx context.Context, apiKey string) ([]models.Us
 	var summaries []models.UsageSummary
 	for rows.Next() {
 		var s models.UsageSummary
-		if err := rows.Scan(&s.APIKey, &s.Model, &s.RequestCount, &s.TotalPrompt, &s.TotalCompletion, &s.TotalTokens); err != nil {
+		if err := rows.Scan(&s.APIKey, &s.Model, &s.Provider, &s.RouteAlias, &s.RequestCount, &s.TotalPrompt, &s.TotalCompletion, &s.TotalTokens,
+			&s.StreamedRequests, &s.StreamedTokens, &s.PartialRequests); err != nil {
 			return nil, fmt.Errorf("scan summary: %w", err)
 		}
 		summaries = append(summaries, s)
@@ -337,9 +957,10 @@ func (t *SQLiteTracker) Summary(ctx context.Context, apiKey string) ([]models.Us
 	return summaries, rows.Err()
 }
 
-// CostReport returns aggregated usage grouped by team, project, and model.
+// CostReport returns aggregated usage grouped by team, project, model,
+// provider, and route alias.
 func (t *SQLiteTracker) CostReport(ctx context.Context, since time.Time, team, project string) ([]models.CostReport, error) {
-	query := `SELECT team, project, model, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens)
+	query := `SELECT team, project, model, provider, route_alias, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), ` + detailSums + `, ` + costSum + `
 		 FROM usage_records WHERE created_at >= ?`
 	args := []any{since}
 	if team != "" {
@@ -350,7 +971,7 @@ func (t *SQLiteTracker) CostReport(ctx context.Context, since time.Time, team, p
 		query += ` AND project = ?`
 		args = append(args, project)
 	}
-	query += ` GROUP BY team, project, model ORDER BY team, project, model`
+	query += ` GROUP BY team, project, model, provider, route_alias ORDER BY team, project, model, provider, route_alias`
 
 	rows, err := t.db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -361,7 +982,8 @@ func (t *SQLiteTracker) CostReport(ctx context.Context, since time.Time, team, p
 	var reports []models.CostReport
 	for rows.Next() {
 		var r models.CostReport
-		if err := rows.Scan(&r.Team, &r.Project, &r.Model, &r.RequestCount, &r.PromptTokens, &r.CompletionTokens, &r.TotalTokens); err != nil {
+		if err := rows.Scan(&r.Team, &r.Project, &r.Model, &r.Provider, &r.RouteAlias, &r.RequestCount, &r.PromptTokens, &r.CompletionTokens, &r.TotalTokens,
+			&r.CacheReadTokens, &r.CacheCreationTokens, &r.ReasoningTokens, &r.EstimatedCost); err != nil {
 			return nil, fmt.Errorf("scan cost report: %w", err)
 		}
 		reports = append(reports, r)
@@ -369,7 +991,443 @@ func (t *SQLiteTracker) CostReport(ctx context.Context, since time.Time, team, p
 	return reports, rows.Err()
 }
 
+// columnLabels maps the build attribution fields, the API endpoint, the
+// provider, and the route alias, which are stored in their own columns
+// rather than in labels, to those columns.
+var columnLabels = map[string]string{
+	"pipeline":    "pipeline",
+	"branch":      "branch",
+	"commit":      "commit_sha",
+	"endpoint":    "endpoint",
+	"provider":    "provider",
+	"route_alias": "route_alias",
+}
+
+// labelExpr returns the SQL expression and argument selecting label key.
+// Build attribution fields, endpoint, provider, and route alias resolve to
+// their columns, "metadata.<name>" to the metadata JSON, and everything else
+// is looked up in the labels JSON.
+func labelExpr(key string) (string, []any) {
+	if col, ok := columnLabels[key]; ok {
+		return col, nil
+	}
+	if name, ok := strings.CutPrefix(key, models.MetadataPrefix); ok {
+		return `COALESCE(json_extract(metadata, ?), '')`, []any{labelPath(name)}
+	}
+	return `COALESCE(json_extract(labels, ?), '')`, []any{labelPath(key)}
+}
+
+// LabelReport returns aggregated usage grouped by the value of q.GroupBy and
+// model, restricted to records whose labels match every filter. Records
+// without the grouping label are reported with an empty value. The build
+// attribution fields pipeline, branch, and commit, the API endpoint, the
+// provider, the route alias, and metadata.<name> can be used like labels.
+func (t *SQLiteTracker) LabelReport(ctx context.Context, q models.LabelQuery) ([]models.LabelReport, error) {
+	groupExpr := `''`
+	var args []any
+	if q.GroupBy != "" {
+		var groupArgs []any
+		groupExpr, groupArgs = labelExpr(q.GroupBy)
+		args = append(args, groupArgs...)
+	}
+	query := `SELECT ` + groupExpr + ` AS value, model, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), ` + detailSums + `, ` + costSum + `
+		 FROM usage_records WHERE created_at >= ?`
+	args = append(args, q.Since)
+
+	keys := make([]string, 0, len(q.Filters))
+	for k := range q.Filters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		expr, exprArgs := labelExpr(k)
+		query += ` AND ` + expr + ` = ?`
+		args = append(args, exprArgs...)
+		args = append(args, q.Filters[k])
+	}
+	query += ` GROUP BY value, model ORDER BY value, model`
+
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("label report: %w", err)
+	}
+	defer rows.Close()
+
+	var reports []models.LabelReport
+	for rows.Next() {
+		r := models.LabelReport{Label: q.GroupBy}
+		if err := rows.Scan(&r.Value, &r.Model, &r.RequestCount, &r.PromptTokens, &r.CompletionTokens, &r.TotalTokens,
+			&r.CacheReadTokens, &r.CacheCreationTokens, &r.ReasoningTokens, &r.EstimatedCost); err != nil {
+			return nil, fmt.Errorf("scan label report: %w", err)
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// labelColumns are the usage_records columns holding attribution labels.
+var labelColumns = []string{"team", "project", "env", "pipeline", "branch"}
+
+// LabelValues returns up to limit distinct stored values, sorted, of each
+// attribution label: team, project, env, the build fields, and the
+// free-form labels named in keys, or every free-form label key if keys is
+// empty. The proxy uses it to seed label cardinality caps on startup; each
+// key's query stops once it has found limit values.
+func (t *SQLiteTracker) LabelValues(ctx context.Context, keys []string, limit int) (map[string][]string, error) {
+	values := make(map[string][]string)
+	for _, col := range labelColumns {
+		vals, err := t.labelValues(ctx,
+			`SELECT DISTINCT `+col+` FROM usage_records WHERE `+col+` != '' LIMIT ?`, limit)
+		if err != nil {
+			return nil, err
+		}
+		if len(vals) > 0 {
+			values[col] = vals
+		}
+	}
+	if len(keys) == 0 {
+		var err error
+		keys, err = t.labelValues(ctx,
+			`SELECT DISTINCT j.key FROM usage_records, json_each(usage_records.labels) j
+			 WHERE usage_records.labels != '{}'`)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, k := range keys {
+		vals, err := t.labelValues(ctx,
+			`SELECT DISTINCT j.value FROM usage_records, json_each(usage_records.labels) j
+			 WHERE usage_records.labels != '{}' AND j.key = ? LIMIT ?`, k, limit)
+		if err != nil {
+			return nil, err
+		}
+		if len(vals) > 0 {
+			values[k] = vals
+		}
+	}
+	return values, nil
+}
+
+// labelValues runs a query returning one string column and sorts the result.
+func (t *SQLiteTracker) labelValues(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("label values: %w", err)
+	}
+	defer rows.Close()
+
+	var vals []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("scan label value: %w", err)
+		}
+		vals = append(vals, v)
+	}
+	sort.Strings(vals)
+	return vals, rows.Err()
+}
+
+// distinctColumns are the usage_records columns Distinct may query.
+var distinctColumns = map[string]bool{
+	"api_key":     true,
+	"model":       true,
+	"session_id":  true,
+	"team":        true,
+	"project":     true,
+	"env":         true,
+	"provider":    true,
+	"route_alias": true,
+	"pipeline":    true,
+	"branch":      true,
+	"endpoint":    true,
+}
+
+// Distinct returns up to limit distinct non-empty values of a usage_records
+// column that start with prefix, most recently used first. It backs shell
+// completion and prefix expansion in the CLI.
+func (t *SQLiteTracker) Distinct(ctx context.Context, column, prefix string, limit int) ([]string, error) {
+	if !distinctColumns[column] {
+		return nil, fmt.Errorf("distinct: unsupported column %q", column)
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := t.db.QueryContext(ctx,
+		`SELECT `+column+` FROM usage_records
+		 WHERE `+column+` != '' AND substr(`+column+`, 1, ?) = ?
+		 GROUP BY `+column+` ORDER BY MAX(created_at) DESC LIMIT ?`,
+		len(prefix), prefix, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("distinct %s: %w", column, err)
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("scan distinct %s: %w", column, err)
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// encodeLabels serializes labels as a JSON object. Empty labels encode as
+// "{}" so json_extract never sees malformed input.
+func encodeLabels(labels map[string]string) (string, error) {
+	if len(labels) == 0 {
+		return "{}", nil
+	}
+	b, err := json.Marshal(labels)
+	if err != nil {
+		return "", fmt.Errorf("encode labels: %w", err)
+	}
+	return string(b), nil
+}
+
+// labelPath returns the JSON path selecting a label key, quoted so keys
+// containing dots are matched literally.
+func labelPath(key string) string {
+	return `$."` + strings.ReplaceAll(key, `"`, ``) + `"`
+}
+
+// Throughput returns output tokens/sec distributions grouped by model and
+// provider since a given time. Records without a measured latency are skipped.
+func (t *SQLiteTracker) Throughput(ctx context.Context, since time.Time) ([]models.ThroughputStat, error) {
+	rows, err := t.db.QueryContext(ctx,
+		`SELECT model, provider, output_tps FROM usage_records
+		 WHERE created_at >= ? AND output_tps > 0
+		 ORDER BY model, provider, output_tps`,
+		since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("throughput: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []models.ThroughputStat
+	var values []float64
+	flush := func(model, provider string) {
+		if len(values) == 0 {
+			return
+		}
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		stats = append(stats, models.ThroughputStat{
+			Model:    model,
+			Provider: provider,
+			Requests: len(values),
+			Mean:     sum / float64(len(values)),
+			P50:      percentile(values, 50),
+			P90:      percentile(values, 90),
+			Min:      values[0],
+			Max:      values[len(values)-1],
+		})
+		values = values[:0]
+	}
+
+	var curModel, curProvider string
+	for rows.Next() {
+		var model, provider string
+		var tps float64
+		if err := rows.Scan(&model, &provider, &tps); err != nil {
+			return nil, fmt.Errorf("scan throughput: %w", err)
+		}
+		if model != curModel || provider != curProvider {
+			flush(curModel, curProvider)
+			curModel, curProvider = model, provider
+		}
+		values = append(values, tps)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	flush(curModel, curProvider)
+	return stats, nil
+}
+
+// Latency returns upstream latency distributions in milliseconds grouped
+// by model and provider since a given time. Records without a measured
+// latency, such as imported ones, are skipped.
+func (t *SQLiteTracker) Latency(ctx context.Context, since time.Time) ([]models.LatencyStat, error) {
+	rows, err := t.db.QueryContext(ctx,
+		`SELECT model, provider, latency_ms FROM usage_records
+		 WHERE created_at >= ? AND latency_ms > 0
+		 ORDER BY model, provider, latency_ms`,
+		since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("latency: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []models.LatencyStat
+	var values []float64
+	var curModel, curProvider string
+	for rows.Next() {
+		var model, provider string
+		var ms int64
+		if err := rows.Scan(&model, &provider, &ms); err != nil {
+			return nil, fmt.Errorf("scan latency: %w", err)
+		}
+		if (model != curModel || provider != curProvider) && len(values) > 0 {
+			stats = append(stats, latencyStat(curModel, curProvider, values))
+			values = values[:0]
+		}
+		curModel, curProvider = model, provider
+		values = append(values, float64(ms))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(values) > 0 {
+		stats = append(stats, latencyStat(curModel, curProvider, values))
+	}
+	return stats, nil
+}
+
+// latencyStat summarizes the sorted latencies of a model and provider.
+func latencyStat(model, provider string, sorted []float64) models.LatencyStat {
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	return models.LatencyStat{
+		Model:    model,
+		Provider: provider,
+		Requests: len(sorted),
+		MeanMs:   sum / float64(len(sorted)),
+		P50Ms:    percentile(sorted, 50),
+		P95Ms:    percentile(sorted, 95),
+		P99Ms:    percentile(sorted, 99),
+		MaxMs:    sorted[len(sorted)-1],
+	}
+}
+
+// percentile returns the nearest-rank percentile p (0-100) of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Maintain checkpoints, analyzes, and vacuums the tracker database.
+func (t *SQLiteTracker) Maintain(ctx context.Context) (dbmaint.Report, error) {
+	return dbmaint.Run(ctx, t.db)
+}
+
+// Vacuum checkpoints and vacuums the tracker database.
+func (t *SQLiteTracker) Vacuum(ctx context.Context) (dbmaint.Report, error) {
+	return dbmaint.Vacuum(ctx, t.db)
+}
+
+// Analyze refreshes the tracker database's planner statistics.
+func (t *SQLiteTracker) Analyze(ctx context.Context) (dbmaint.Report, error) {
+	return dbmaint.Analyze(ctx, t.db)
+}
+
+// DBStats reports the size of the tracker database and its tables.
+func (t *SQLiteTracker) DBStats(ctx context.Context) (dbmaint.Stats, error) {
+	return dbmaint.ReadStats(ctx, t.db)
+}
+
+// PruneUsage deletes usage records created before the cutoff, dropping
+// the usage counters they were part of. Their rollups are brought up to
+// date first and kept. With dryRun set it only reports what would be
+// deleted.
+func (t *SQLiteTracker) PruneUsage(ctx context.Context, before time.Time, dryRun bool) (dbmaint.PruneResult, error) {
+	if !dryRun {
+		if err := t.Rollup(ctx, time.Now()); err != nil {
+			return dbmaint.PruneResult{}, err
+		}
+	}
+	var apiKeys []string
+	if t.counters != nil && !dryRun {
+		var err error
+		if apiKeys, err = usageKeys(ctx, t.db, `SELECT api_key FROM usage_records WHERE created_at < ?
+			 UNION SELECT api_key FROM usage_unsampled WHERE bucket < ?`, before.UTC(), before.UTC()); err != nil {
+			return dbmaint.PruneResult{}, err
+		}
+	}
+	res, err := dbmaint.Prune(ctx, t.db, "usage_records", "created_at < ?", dryRun, before.UTC())
+	if err != nil {
+		return res, err
+	}
+	unsampled, err := dbmaint.Prune(ctx, t.db, "usage_unsampled", "bucket < ?", dryRun, before.UTC())
+	res.Rows += unsampled.Rows
+	res.Bytes += unsampled.Bytes
+	if err != nil {
+		return res, err
+	}
+	keys, err := dbmaint.Prune(ctx, t.db, "usage_unsampled_keys", "created_at < ?", dryRun, before.UTC())
+	res.Bytes += keys.Bytes
+	if err != nil || dryRun {
+		return res, err
+	}
+	t.forgetCounters(ctx, apiKeys, time.Time{}, before)
+	return res, t.markPruned(ctx, before)
+}
+
+// markPruned records that usage records before the cutoff are gone, so
+// Rollup keeps the buckets they were rolled up into.
+func (t *SQLiteTracker) markPruned(ctx context.Context, before time.Time) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin prune: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	raw, err := rollupState(ctx, tx, rawSince)
+	if err != nil || !raw.Before(before) {
+		return err
+	}
+	if err := setRollupState(ctx, tx, rawSince, before); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PruneSessions deletes sessions whose last activity is before the cutoff.
+// Their usage records are kept. With dryRun set it only reports what would
+// be deleted.
+func (t *SQLiteTracker) PruneSessions(ctx context.Context, before time.Time, dryRun bool) (dbmaint.PruneResult, error) {
+	return dbmaint.Prune(ctx, t.db, "sessions", "last_activity < ?", dryRun, before.UTC())
+}
+
+// PruneEvents deletes upstream failures and budget decisions recorded
+// before the cutoff, and anomalies whose window ended before it. With
+// dryRun set it only reports what would be deleted.
+func (t *SQLiteTracker) PruneEvents(ctx context.Context, before time.Time, dryRun bool) (dbmaint.PruneResult, error) {
+	var res dbmaint.PruneResult
+	for _, p := range []struct{ table, cond string }{
+		{"upstream_failures", "created_at < ?"},
+		{"budget_decisions", "created_at < ?"},
+		{"anomalies", "window_end < ?"},
+	} {
+		r, err := dbmaint.Prune(ctx, t.db, p.table, p.cond, dryRun, before.UTC())
+		res.Rows += r.Rows
+		res.Bytes += r.Bytes
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
 // Close releases the database connection.
 func (t *SQLiteTracker) Close() error {
+	if t.async != nil {
+		t.async.stop()
+	}
+	t.stmts.close()
 	return t.db.Close()
 }
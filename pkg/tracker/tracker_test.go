@@ -2,10 +2,16 @@ package tracker
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/pario-ai/pario/pkg/events"
 	"github.com/pario-ai/pario/pkg/models"
 )
 
@@ -20,6 +26,52 @@ func newTestTracker(t *testing.T) *SQLiteTracker {
 	return tr
 }
 
+func TestConcurrentRecord(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	var mode string
+	if err := tr.db.QueryRowContext(ctx, `PRAGMA journal_mode`).Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q, want wal", mode)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 250)
+	for i := range 200 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- tr.Record(ctx, models.UsageRecord{RequestID: fmt.Sprintf("req_%d", i), Attempt: 1, APIKey: "k1", Model: "gpt-4", TotalTokens: 1, CreatedAt: now})
+		}()
+		if i%4 == 0 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := tr.TotalByKey(ctx, "k1", now.Add(-time.Minute))
+				errs <- err
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	total, err := tr.TotalByKey(ctx, "k1", now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 200 {
+		t.Errorf("total = %d, want 200", total)
+	}
+}
+
 func TestRecordAndQuery(t *testing.T) {
 	tr := newTestTracker(t)
 	ctx := context.Background()
@@ -109,6 +161,50 @@ func TestTotalByKeyAndModel(t *testing.T) {
 	}
 }
 
+func TestSpendByLabels(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for _, rec := range []models.UsageRecord{
+		{APIKey: "key1", Model: "gpt-4", TotalTokens: 100, Team: "ml", Project: "search", CreatedAt: now},
+		{APIKey: "key2", Model: "gpt-4", TotalTokens: 200, Team: "ml", Project: "chat", CreatedAt: now},
+		{APIKey: "key2", Model: "dall-e-3", MediaCostUSD: 0.04, EstimatedCostUSD: 0.04, Team: "ml", Project: "chat", CreatedAt: now},
+		{APIKey: "key3", Model: "gpt-4", TotalTokens: 400, Team: "web", CreatedAt: now},
+		{APIKey: "key1", Model: "gpt-4", TotalTokens: 800, Team: "ml", CreatedAt: now.Add(-time.Hour)},
+	} {
+		_ = tr.Record(ctx, rec)
+	}
+
+	tests := []struct {
+		name   string
+		labels models.CostLabel
+		model  string
+		tokens int64
+		rows   int
+	}{
+		{"team across keys", models.CostLabel{Team: "ml"}, "", 300, 2},
+		{"team and project", models.CostLabel{Team: "ml", Project: "chat"}, "", 200, 2},
+		{"model", models.CostLabel{Team: "ml"}, "gpt-4", 300, 1},
+		{"no match", models.CostLabel{Team: "data"}, "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := tr.SpendByLabels(ctx, tt.labels, tt.model, now.Add(-time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var tokens int64
+			for _, r := range rows {
+				tokens += r.TotalTokens
+			}
+			if len(rows) != tt.rows || tokens != tt.tokens {
+				t.Errorf("got %d rows with %d tokens, want %d with %d", len(rows), tokens, tt.rows, tt.tokens)
+			}
+		})
+	}
+}
+
 func TestSummary(t *testing.T) {
 	tr := newTestTracker(t)
 	ctx := context.Background()
@@ -204,7 +300,7 @@ func TestListSessions(t *testing.T) {
 	_, _ = tr.ResolveSession(ctx, "key1", "sess-a", 30*time.Minute)
 	_, _ = tr.ResolveSession(ctx, "key2", "sess-b", 30*time.Minute)
 
-	all, err := tr.ListSessions(ctx, "")
+	all, err := tr.ListSessions(ctx, models.SessionQuery{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -212,7 +308,7 @@ func TestListSessions(t *testing.T) {
 		t.Fatalf("expected 2 sessions, got %d", len(all))
 	}
 
-	filtered, err := tr.ListSessions(ctx, "key1")
+	filtered, err := tr.ListSessions(ctx, models.SessionQuery{APIKey: "key1"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -259,7 +355,7 @@ func TestSessionRequests(t *testing.T) {
 	}
 
 	// Verify session counters were updated.
-	sessions, _ := tr.ListSessions(ctx, "key1")
+	sessions, _ := tr.ListSessions(ctx, models.SessionQuery{APIKey: "key1"})
 	if len(sessions) != 1 {
 		t.Fatalf("expected 1 session, got %d", len(sessions))
 	}
@@ -281,6 +377,7 @@ func TestCostReport(t *testing.T) {
 		{APIKey: "k1", Model: "gpt-4", Team: "backend", Project: "api", PromptTokens: 2000, CompletionTokens: 1000, TotalTokens: 3000, CreatedAt: now},
 		{APIKey: "k2", Model: "claude-sonnet", Team: "frontend", Project: "web", PromptTokens: 500, CompletionTokens: 200, TotalTokens: 700, CreatedAt: now},
 		{APIKey: "k3", Model: "gpt-4", Team: "backend", Project: "worker", PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150, CreatedAt: now},
+		{APIKey: "k1", Model: "gpt-4", Team: "backend", Project: "api", Images: 2, MediaCostUSD: 0.08, EstimatedCostUSD: 0.08, CreatedAt: now},
 	}
 	for _, r := range records {
 		if err := tr.Record(ctx, r); err != nil {
@@ -314,12 +411,103 @@ func TestCostReport(t *testing.T) {
 	if len(reports) != 1 {
 		t.Fatalf("expected 1 group for backend/api, got %d", len(reports))
 	}
-	if reports[0].RequestCount != 2 {
-		t.Errorf("expected 2 requests, got %d", reports[0].RequestCount)
+	if reports[0].RequestCount != 3 {
+		t.Errorf("expected 3 requests, got %d", reports[0].RequestCount)
 	}
 	if reports[0].PromptTokens != 3000 {
 		t.Errorf("expected 3000 prompt tokens, got %d", reports[0].PromptTokens)
 	}
+	if reports[0].EstimatedCost != 0.08 {
+		t.Errorf("expected media cost 0.08, got %v", reports[0].EstimatedCost)
+	}
+}
+
+func TestCacheAndReasoningTokens(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for _, r := range []models.UsageRecord{
+		{APIKey: "k1", Model: "claude", PromptTokens: 1000, CompletionTokens: 100, TotalTokens: 1100, CacheReadTokens: 800, CacheCreationTokens: 100, CreatedAt: now},
+		{APIKey: "k1", Model: "o3", PromptTokens: 100, CompletionTokens: 500, TotalTokens: 600, ReasoningTokens: 400, CreatedAt: now},
+	} {
+		if err := tr.Record(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recs, err := tr.QuerySince(ctx, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[0].CacheReadTokens != 800 || recs[0].CacheCreationTokens != 100 || recs[1].ReasoningTokens != 400 {
+		t.Fatalf("records = %+v", recs)
+	}
+
+	reports, err := tr.CostReport(ctx, now.Add(-time.Minute), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pricing := models.ModelPricing{PromptCost: 1, CompletionCost: 2, CacheReadCost: 0.1, CacheCreationCost: 1.25, ReasoningCost: 3}
+	if len(reports) != 2 || reports[0].CacheReadTokens != 800 || reports[1].ReasoningTokens != 400 {
+		t.Fatalf("reports = %+v", reports)
+	}
+	// 100 uncached + 800 read at 0.1 + 100 written at 1.25, then 100 completion at 2.
+	if got := pricing.TokenCost(reports[0].Tokens()); got < 0.5049 || got > 0.5051 {
+		t.Errorf("claude cost = %v, want 0.505", got)
+	}
+	// Reasoning tokens default to the completion rate.
+	if got := (models.ModelPricing{PromptCost: 1, CompletionCost: 2}).TokenCost(reports[1].Tokens()); got < 1.0999 || got > 1.1001 {
+		t.Errorf("o3 cost = %v, want 1.1", got)
+	}
+
+	spend, err := tr.SpendByKey(ctx, "k1", "o3", now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spend) != 1 || spend[0].ReasoningTokens != 400 {
+		t.Errorf("spend = %+v", spend)
+	}
+}
+
+func TestPriceUnpriced(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for _, r := range []models.UsageRecord{
+		{APIKey: "k1", Model: "gpt-4", PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500, EstimatedCostUSD: 0.05, CreatedAt: now},
+		{APIKey: "k1", Model: "gpt-4", PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500, CreatedAt: now},
+		{APIKey: "k1", Model: "dall-e-3", Images: 1, MediaCostUSD: 0.04, CreatedAt: now},
+	} {
+		if err := tr.Record(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Records stored before costs were have none.
+	if _, err := tr.db.Exec(`UPDATE usage_records SET estimated_cost_usd = NULL WHERE id > 1`); err != nil {
+		t.Fatal(err)
+	}
+	if reports, _ := tr.CostReport(ctx, now.Add(-time.Minute), "", ""); len(reports) != 2 || reports[1].EstimatedCost != 0.05 {
+		t.Fatalf("unpriced reports = %+v", reports)
+	}
+
+	pricing := []models.ModelPricing{{Model: "gpt-4", PromptCost: 0.01, CompletionCost: 0.04}}
+	n, err := tr.PriceUnpriced(ctx, pricing)
+	if err != nil || n != 2 {
+		t.Fatalf("priced = %d, %v; want 2", n, err)
+	}
+	// The priced record is 0.01 + 0.02; the already priced one keeps 0.05.
+	reports, err := tr.CostReport(ctx, now.Add(-time.Minute), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 || reports[0].EstimatedCost != 0.04 || math.Abs(reports[1].EstimatedCost-0.08) > 1e-9 {
+		t.Errorf("priced reports = %+v", reports)
+	}
+	if n, _ := tr.PriceUnpriced(ctx, pricing); n != 0 {
+		t.Errorf("second run priced %d records, want 0", n)
+	}
 }
 
 func TestCostReportNoLabels(t *testing.T) {
@@ -346,6 +534,60 @@ func TestCostReportNoLabels(t *testing.T) {
 	}
 }
 
+func TestProviderAndRouteAlias(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for _, r := range []models.UsageRecord{
+		{APIKey: "k1", Model: "gpt-4o", Provider: "openai", RouteAlias: "smart", TotalTokens: 10, CreatedAt: now},
+		{APIKey: "k1", Model: "gpt-4o", Provider: "azure", RouteAlias: "smart", TotalTokens: 20, CreatedAt: now},
+		{APIKey: "k1", Model: "gpt-4o", Provider: "openai", TotalTokens: 30, CreatedAt: now},
+	} {
+		if err := tr.Record(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recs, err := tr.QueryByKey(ctx, "k1", now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 || !slices.ContainsFunc(recs, func(r models.UsageRecord) bool { return r.RouteAlias == "smart" }) {
+		t.Fatalf("records = %+v", recs)
+	}
+
+	summaries, err := tr.Summary(ctx, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 3 {
+		t.Fatalf("summaries = %+v", summaries)
+	}
+	if s := summaries[0]; s.Provider != "azure" || s.RouteAlias != "smart" || s.TotalTokens != 20 {
+		t.Errorf("first summary = %+v", s)
+	}
+
+	reports, err := tr.CostReport(ctx, now.Add(-time.Minute), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("reports = %+v", reports)
+	}
+	if r := reports[1]; r.Provider != "openai" || r.RouteAlias != "" || r.TotalTokens != 30 {
+		t.Errorf("second report = %+v", r)
+	}
+
+	byAlias, err := tr.LabelReport(ctx, models.LabelQuery{Since: now.Add(-time.Minute), GroupBy: "route_alias"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byAlias) != 2 {
+		t.Errorf("reports by route_alias = %+v", byAlias)
+	}
+}
+
 func TestMigrationIdempotent(t *testing.T) {
 	dbPath := filepath.Join(t.TempDir(), "test.db")
 
@@ -362,3 +604,515 @@ func TestMigrationIdempotent(t *testing.T) {
 	}
 	_ = tr2.Close()
 }
+
+func TestSummaryStreamedSplit(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	records := []models.UsageRecord{
+		{APIKey: "k1", Model: "gpt-4", PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150, CreatedAt: now},
+		{APIKey: "k1", Model: "gpt-4", PromptTokens: 200, CompletionTokens: 100, TotalTokens: 300, Streamed: true, CreatedAt: now},
+		{APIKey: "k1", Model: "gpt-4", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, Streamed: true, Partial: true, CreatedAt: now},
+	}
+	for _, r := range records {
+		if err := tr.Record(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summaries, err := tr.Summary(ctx, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 {
+		t.Fatalf("expected 1 summary, got %d", len(summaries))
+	}
+	s := summaries[0]
+	if s.RequestCount != 3 || s.StreamedRequests != 2 {
+		t.Errorf("expected 2 of 3 requests streamed, got %d of %d", s.StreamedRequests, s.RequestCount)
+	}
+	if s.StreamedTokens != 315 {
+		t.Errorf("expected 315 streamed tokens, got %d", s.StreamedTokens)
+	}
+	if s.PartialRequests != 1 {
+		t.Errorf("expected 1 partial request, got %d", s.PartialRequests)
+	}
+
+	recs, err := tr.QueryByKey(ctx, "k1", now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed := 0
+	for _, r := range recs {
+		if r.Streamed {
+			streamed++
+		}
+	}
+	if streamed != 2 {
+		t.Errorf("expected 2 streamed records, got %d", streamed)
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	records := []models.UsageRecord{
+		{APIKey: "k1", Model: "gpt-4o", Provider: "openai", CompletionTokens: 100, TotalTokens: 100, OutputTokensPerSec: 50, CreatedAt: now},
+		{APIKey: "k1", Model: "gpt-4o", Provider: "openai", CompletionTokens: 100, TotalTokens: 100, OutputTokensPerSec: 100, CreatedAt: now},
+		{APIKey: "k1", Model: "gpt-4o", Provider: "openai", CompletionTokens: 100, TotalTokens: 100, OutputTokensPerSec: 150, CreatedAt: now},
+		{APIKey: "k1", Model: "gpt-4o", Provider: "azure", CompletionTokens: 100, TotalTokens: 100, OutputTokensPerSec: 40, CreatedAt: now},
+		// No latency measured: excluded from the distribution.
+		{APIKey: "k1", Model: "gpt-4o", Provider: "openai", CompletionTokens: 100, TotalTokens: 100, CreatedAt: now},
+	}
+	for _, r := range records {
+		if err := tr.Record(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := tr.Throughput(ctx, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(stats))
+	}
+	azure, openai := stats[0], stats[1]
+	if azure.Provider != "azure" || azure.Requests != 1 || azure.P50 != 40 {
+		t.Errorf("unexpected azure stats: %+v", azure)
+	}
+	if openai.Requests != 3 {
+		t.Errorf("expected 3 openai requests, got %d", openai.Requests)
+	}
+	if openai.Mean != 100 || openai.P50 != 100 || openai.P90 != 150 || openai.Min != 50 || openai.Max != 150 {
+		t.Errorf("unexpected openai stats: %+v", openai)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for i := 1; i <= 100; i++ {
+		rec := models.UsageRecord{APIKey: "k1", Model: "gpt-4o", Provider: "openai", LatencyMs: int64(i * 10), UpstreamStatus: 200, CreatedAt: now}
+		if err := tr.Record(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Imported records have no latency and are skipped.
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "k1", Model: "gpt-4o", Provider: "openai", Imported: true, CreatedAt: now})
+	_ = tr.Record(ctx, models.UsageRecord{APIKey: "k1", Model: "gpt-4o", Provider: "azure", LatencyMs: 700, CreatedAt: now})
+
+	stats, err := tr.Latency(ctx, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 groups, got %+v", stats)
+	}
+	if azure := stats[0]; azure.Provider != "azure" || azure.Requests != 1 || azure.P99Ms != 700 {
+		t.Errorf("unexpected azure stats: %+v", azure)
+	}
+	openai := stats[1]
+	if openai.Requests != 100 || openai.MeanMs != 505 || openai.P50Ms != 500 || openai.P95Ms != 950 || openai.P99Ms != 990 || openai.MaxMs != 1000 {
+		t.Errorf("unexpected openai stats: %+v", openai)
+	}
+
+	recs, _ := tr.QueryByKey(ctx, "k1", now.Add(-time.Minute))
+	if !slices.ContainsFunc(recs, func(r models.UsageRecord) bool { return r.UpstreamStatus == 200 }) {
+		t.Error("upstream status not stored")
+	}
+}
+
+func TestLabelReport(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	records := []models.UsageRecord{
+		{APIKey: "k1", Model: "gpt-4", TotalTokens: 100, Labels: map[string]string{"tier": "enterprise", "feature": "search"}, Pipeline: "review-bot", Provider: "openai", CreatedAt: now},
+		{APIKey: "k1", Model: "gpt-4", TotalTokens: 200, Labels: map[string]string{"tier": "enterprise", "feature": "chat"}, Provider: "openai", CreatedAt: now},
+		{APIKey: "k2", Model: "gpt-4", TotalTokens: 50, Labels: map[string]string{"tier": "free", "feature": "chat"}, Pipeline: "review-bot", Branch: "main", Provider: "azure", CreatedAt: now},
+		{APIKey: "k3", Model: "gpt-4", TotalTokens: 10, Endpoint: "embeddings", CreatedAt: now},
+	}
+	for _, r := range records {
+		if err := tr.Record(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		q     models.LabelQuery
+		want  map[string]int64
+		count int
+	}{
+		{
+			name: "group by tier",
+			q:    models.LabelQuery{Since: now.Add(-time.Minute), GroupBy: "tier"},
+			want: map[string]int64{"enterprise": 300, "free": 50, "": 10},
+		},
+		{
+			name: "filter and group",
+			q:    models.LabelQuery{Since: now.Add(-time.Minute), GroupBy: "tier", Filters: map[string]string{"feature": "chat"}},
+			want: map[string]int64{"enterprise": 200, "free": 50},
+		},
+		{
+			name: "filter only",
+			q:    models.LabelQuery{Since: now.Add(-time.Minute), Filters: map[string]string{"tier": "enterprise"}},
+			want: map[string]int64{"": 300},
+		},
+		{
+			name: "group by pipeline",
+			q:    models.LabelQuery{Since: now.Add(-time.Minute), GroupBy: "pipeline"},
+			want: map[string]int64{"review-bot": 150, "": 210},
+		},
+		{
+			name: "filter by pipeline",
+			q:    models.LabelQuery{Since: now.Add(-time.Minute), GroupBy: "tier", Filters: map[string]string{"pipeline": "review-bot", "branch": "main"}},
+			want: map[string]int64{"free": 50},
+		},
+		{
+			name: "group by endpoint",
+			q:    models.LabelQuery{Since: now.Add(-time.Minute), GroupBy: "endpoint"},
+			want: map[string]int64{"embeddings": 10, "": 350},
+		},
+		{
+			name: "group by provider",
+			q:    models.LabelQuery{Since: now.Add(-time.Minute), GroupBy: "provider"},
+			want: map[string]int64{"openai": 300, "azure": 50, "": 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reports, err := tr.LabelReport(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]int64)
+			for _, r := range reports {
+				got[r.Value] += r.TotalTokens
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("value %q: got %d tokens, want %d", k, got[k], v)
+				}
+			}
+		})
+	}
+
+	recs, err := tr.QueryByKey(ctx, "k1", now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recs[0].Labels["tier"] != "enterprise" {
+		t.Errorf("expected labels round-trip, got %v", recs[0].Labels)
+	}
+}
+
+func TestLabelValues(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	records := []models.UsageRecord{
+		{APIKey: "k1", Model: "gpt-4", Team: "eng", Labels: map[string]string{"tier": "pro"}, CreatedAt: now},
+		{APIKey: "k1", Model: "gpt-4", Team: "eng", Env: "prod", Labels: map[string]string{"tier": "free"}, CreatedAt: now},
+		{APIKey: "k2", Model: "gpt-4", Team: "ml", CreatedAt: now},
+	}
+	for _, r := range records {
+		if err := tr.Record(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		keys  []string
+		limit int
+		want  map[string][]string
+	}{
+		{"all keys", nil, 10, map[string][]string{
+			"team": {"eng", "ml"},
+			"env":  {"prod"},
+			"tier": {"free", "pro"},
+		}},
+		{"allowed keys", []string{"region"}, 10, map[string][]string{
+			"team": {"eng", "ml"},
+			"env":  {"prod"},
+		}},
+		{"limited", nil, 1, map[string][]string{
+			"team": {"eng"},
+			"env":  {"prod"},
+			"tier": {"pro"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tr.LabelValues(ctx, tt.keys, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.limit < 10 {
+				// Which values a limited query finds is up to SQLite.
+				for k, vals := range got {
+					if len(vals) != tt.limit {
+						t.Errorf("%s: %d values, want %d", k, len(vals), tt.limit)
+					}
+				}
+				if len(got) != len(tt.want) {
+					t.Errorf("LabelValues = %v, want keys of %v", got, tt.want)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LabelValues = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceImported(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if err := tr.Record(ctx, models.UsageRecord{APIKey: "k1", Model: "gpt-4", Provider: "openai", TotalTokens: 7, CreatedAt: day.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	recs := []models.UsageRecord{
+		{APIKey: "imported:openai", Model: "gpt-4", TotalTokens: 100, CreatedAt: day},
+	}
+	// Importing the same range twice must not double count.
+	for i := 0; i < 2; i++ {
+		if err := tr.ReplaceImported(ctx, "openai", day, day.AddDate(0, 0, 1), recs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := tr.QueryByKey(ctx, "imported:openai", day.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !got[0].Imported || got[0].Provider != "openai" {
+		t.Errorf("unexpected imported records: %+v", got)
+	}
+	live, err := tr.TotalByKey(ctx, "k1", day.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live != 7 {
+		t.Errorf("live records touched by import: total = %d", live)
+	}
+}
+
+func TestRecordIdempotent(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	sid, err := tr.ResolveSession(ctx, "k1", "sess-1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []models.UsageRecord{
+		{RequestID: "req_1", Attempt: 1, APIKey: "k1", Model: "gpt-4", SessionID: sid, TotalTokens: 100, CreatedAt: now},
+		{RequestID: "req_1", Attempt: 1, APIKey: "k1", Model: "gpt-4", SessionID: sid, TotalTokens: 100, CreatedAt: now},
+		{RequestID: "req_1", Attempt: 2, APIKey: "k1", Model: "gpt-4", SessionID: sid, TotalTokens: 40, CreatedAt: now},
+		{APIKey: "k1", Model: "gpt-4", TotalTokens: 5, CreatedAt: now},
+		{APIKey: "k1", Model: "gpt-4", TotalTokens: 5, CreatedAt: now},
+	}
+	for _, r := range records {
+		if err := tr.Record(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	total, err := tr.TotalByKey(ctx, "k1", now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 150 {
+		t.Errorf("total = %d, want 150 (duplicate attempt ignored)", total)
+	}
+	sessions, err := tr.ListSessions(ctx, models.SessionQuery{APIKey: "k1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].RequestCount != 2 || sessions[0].TotalTokens != 140 {
+		t.Errorf("unexpected session counters: %+v", sessions)
+	}
+}
+
+func TestSubscribeUsage(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for name, tr := range map[string]interface {
+		Tracker
+		SubscribeUsage(int) *events.Subscription[models.UsageRecord]
+	}{
+		"sqlite": newTestTracker(t),
+		"memory": NewMemory(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			sub := tr.SubscribeUsage(4)
+			defer sub.Close()
+
+			rec := models.UsageRecord{RequestID: "req_1", Attempt: 1, APIKey: "k1", Model: "gpt-4", TotalTokens: 10, CreatedAt: now}
+			for range 2 {
+				if err := tr.Record(ctx, rec); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			select {
+			case got := <-sub.C:
+				if got.ID == 0 || got.RequestID != "req_1" || got.TotalTokens != 10 {
+					t.Errorf("unexpected record: %+v", got)
+				}
+			default:
+				t.Fatal("no record published")
+			}
+			select {
+			case got := <-sub.C:
+				t.Errorf("duplicate published: %+v", got)
+			default:
+			}
+		})
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	records := []models.UsageRecord{
+		{APIKey: "sk-a", Model: "gpt-4", SessionID: "sess_1", CreatedAt: now.Add(-3 * time.Minute)},
+		{APIKey: "sk-b", Model: "gpt-4o", SessionID: "sess_2", CreatedAt: now.Add(-2 * time.Minute)},
+		{APIKey: "sk-a", Model: "claude-sonnet-4", CreatedAt: now.Add(-time.Minute)},
+	}
+	for _, r := range records {
+		if err := tr.Record(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		column, prefix string
+		want           []string
+		wantErr        bool
+	}{
+		{column: "model", want: []string{"claude-sonnet-4", "gpt-4o", "gpt-4"}},
+		{column: "model", prefix: "gpt", want: []string{"gpt-4o", "gpt-4"}},
+		{column: "api_key", want: []string{"sk-a", "sk-b"}},
+		{column: "session_id", prefix: "sess_", want: []string{"sess_2", "sess_1"}},
+		{column: "labels", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.column+"/"+tt.prefix, func(t *testing.T) {
+			got, err := tr.Distinct(ctx, tt.column, tt.prefix, 10)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Distinct error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Distinct = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for _, age := range []time.Duration{0, 48 * time.Hour, 72 * time.Hour} {
+		if err := tr.Record(ctx, models.UsageRecord{APIKey: "k1", Model: "gpt-4", TotalTokens: 10, CreatedAt: now.Add(-age)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tr.ResolveSession(ctx, "k1", "sess-1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	cutoff := now.Add(-24 * time.Hour)
+
+	tests := []struct {
+		name   string
+		prune  func(bool) (int64, error)
+		dryRun bool
+		want   int64
+	}{
+		{"usage dry run", func(d bool) (int64, error) { r, err := tr.PruneUsage(ctx, cutoff, d); return r.Rows, err }, true, 2},
+		{"usage", func(d bool) (int64, error) { r, err := tr.PruneUsage(ctx, cutoff, d); return r.Rows, err }, false, 2},
+		{"usage again", func(d bool) (int64, error) { r, err := tr.PruneUsage(ctx, cutoff, d); return r.Rows, err }, false, 0},
+		{"active session kept", func(d bool) (int64, error) { r, err := tr.PruneSessions(ctx, cutoff, d); return r.Rows, err }, false, 0},
+		{"idle session", func(d bool) (int64, error) {
+			r, err := tr.PruneSessions(ctx, now.Add(time.Minute), d)
+			return r.Rows, err
+		}, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.prune(tt.dryRun)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("rows = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	total, err := tr.TotalByKey(ctx, "k1", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 10 {
+		t.Errorf("recent usage total = %d, want 10", total)
+	}
+}
+
+func TestPruneEvents(t *testing.T) {
+	tr := newTestTracker(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for _, at := range []time.Time{now, now.Add(-48 * time.Hour)} {
+		if err := tr.RecordFailure(ctx, models.UpstreamFailure{APIKey: "k1", Provider: "openai", Model: "gpt-4", Attempt: 1, CreatedAt: at}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.RecordDecision(ctx, models.BudgetDecision{APIKey: "k1", Action: models.BudgetBlock, PeriodStart: at, CreatedAt: at}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.RecordAnomaly(ctx, models.Anomaly{Dimension: models.TopByKey, Value: "k1", Metric: "tokens",
+			WindowStart: at.Add(-time.Hour), WindowEnd: at, DetectedAt: at, UpdatedAt: at}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cutoff := now.Add(-24 * time.Hour)
+
+	res, err := tr.PruneEvents(ctx, cutoff, true)
+	if err != nil || res.Rows != 3 {
+		t.Fatalf("dry run = %+v, %v, want 3 rows", res, err)
+	}
+	if res, err = tr.PruneEvents(ctx, cutoff, false); err != nil || res.Rows != 3 {
+		t.Fatalf("prune = %+v, %v, want 3 rows", res, err)
+	}
+	for _, table := range []string{"upstream_failures", "budget_decisions", "anomalies"} {
+		var n int
+		if err := tr.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("%s: %d rows left, want 1", table, n)
+		}
+	}
+}